@@ -0,0 +1,317 @@
+// Package archive files the artifacts of proven batches (framed proof,
+// proof JSON, public inputs, calldata, receipt, batch data) out of the flat
+// working directory into one directory per batch under a dated layout,
+// proofs/2025/01/15/<batch id>/ by default, and keeps an index of what is
+// where. GC deletes whole batches by age or total size.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+)
+
+// IndexName is the index file in the archive root: one Entry per line,
+// appended as batches are archived; the last line for a batch ID wins.
+const IndexName = "index.jsonl"
+
+// DefaultLayout files a batch by the UTC day it was proven.
+const DefaultLayout Layout = "proofs/{yyyy}/{mm}/{dd}/{batch}"
+
+// Layout is the directory of a batch relative to the archive root, a slash
+// path of literal names and the placeholders {yyyy}, {mm}, {dd} (the UTC
+// day the batch was proven), {profile} and {batch} (its hex batch ID),
+// which it must contain so that batches never share a directory.
+type Layout string
+
+var placeholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// ParseLayout checks s as a Layout.
+func ParseLayout(s string) (Layout, error) {
+	if s == "" || strings.HasPrefix(s, "/") || strings.Contains(s, `\`) {
+		return "", fmt.Errorf("%w: layout %q is not a relative slash path", errs.ErrInvalidInput, s)
+	}
+	for _, elem := range strings.Split(s, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return "", fmt.Errorf("%w: layout %q: empty, . or .. element", errs.ErrInvalidInput, s)
+		}
+	}
+	for _, p := range placeholder.FindAllString(s, -1) {
+		if !slices.Contains([]string{"{yyyy}", "{mm}", "{dd}", "{profile}", "{batch}"}, p) {
+			return "", fmt.Errorf("%w: layout %q: unknown placeholder %s", errs.ErrInvalidInput, s, p)
+		}
+	}
+	if !strings.Contains(s, "{batch}") {
+		return "", fmt.Errorf("%w: layout %q has no {batch}", errs.ErrInvalidInput, s)
+	}
+	return Layout(s), nil
+}
+
+// Dir is the directory of the batch, relative to the archive root.
+func (l Layout) Dir(batchID, profile string, proven time.Time) string {
+	t := proven.UTC()
+	return filepath.FromSlash(strings.NewReplacer(
+		"{yyyy}", t.Format("2006"),
+		"{mm}", t.Format("01"),
+		"{dd}", t.Format("02"),
+		"{profile}", profile,
+		"{batch}", batchID,
+	).Replace(string(l)))
+}
+
+// Entry is an archived batch.
+type Entry struct {
+	BatchID string    `json:"batch_id"` // hex
+	Profile string    `json:"profile"`
+	Time    time.Time `json:"time"` // when it was proven
+	Dir     string    `json:"dir"`  // relative to the archive root, slash-separated
+	Files   []File    `json:"files"`
+}
+
+// File is an archived file of an Entry.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Size is the total size of e's files.
+func (e *Entry) Size() int64 {
+	var n int64
+	for _, f := range e.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// Archive is an archive root. It is safe for concurrent use; one process
+// writes an archive at a time.
+type Archive struct {
+	Root   string
+	Layout Layout // DefaultLayout when empty
+
+	mu sync.Mutex
+}
+
+// Add copies the files at paths into the directory of the batch (each
+// written whole, see artifacts.WriteFile) and records them in the index.
+// Adding to a batch already archived, a receipt published after the proof
+// say, keeps its directory and the files not added again.
+func (a *Archive) Add(batchID, profile string, proven time.Time, paths ...string) (Entry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if id, err := hex.DecodeString(batchID); err != nil || len(id) != 32 {
+		return Entry{}, fmt.Errorf("%w: batch ID %q", errs.ErrInvalidInput, batchID)
+	}
+	batchID = strings.ToLower(batchID)
+	index, err := a.index()
+	if err != nil {
+		return Entry{}, err
+	}
+	e, ok := find(index, batchID)
+	if !ok {
+		layout := a.Layout
+		if layout == "" {
+			layout = DefaultLayout
+		}
+		e = Entry{BatchID: batchID, Profile: profile, Time: proven.UTC().Truncate(time.Second), Dir: filepath.ToSlash(layout.Dir(batchID, profile, proven))}
+	}
+	dir := filepath.Join(a.Root, filepath.FromSlash(e.Dir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Entry{}, err
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return Entry{}, err
+		}
+		name := filepath.Base(p)
+		if err := artifacts.WriteFile(filepath.Join(dir, name), bytes.NewReader(data), false); err != nil {
+			return Entry{}, fmt.Errorf("archive %s: %w", p, err)
+		}
+		sum := sha256.Sum256(data)
+		f := File{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+		if i := slices.IndexFunc(e.Files, func(f File) bool { return f.Name == name }); i >= 0 {
+			e.Files[i] = f
+		} else {
+			e.Files = append(e.Files, f)
+		}
+	}
+	slices.SortFunc(e.Files, func(a, b File) int { return strings.Compare(a.Name, b.Name) })
+	return e, a.appendIndex(e)
+}
+
+// Index returns the archived batches, oldest first.
+func (a *Archive) Index() ([]Entry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.index()
+}
+
+// Find is the archived batch with the hex batchID, ErrNotFound when there
+// is none.
+func (a *Archive) Find(batchID string) (Entry, error) {
+	index, err := a.Index()
+	if err != nil {
+		return Entry{}, err
+	}
+	e, ok := find(index, strings.ToLower(batchID))
+	if !ok {
+		return Entry{}, fmt.Errorf("%w: batch %s is not in the archive %s", errs.ErrNotFound, batchID, a.Root)
+	}
+	return e, nil
+}
+
+func find(index []Entry, batchID string) (Entry, bool) {
+	for _, e := range index {
+		if e.BatchID == batchID {
+			e.Files = slices.Clone(e.Files)
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// index reads the index; a line that does not parse, the torn end of an
+// append after a crash, is skipped. A missing index is an empty archive.
+func (a *Archive) index() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(a.Root, IndexName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]int)
+	var index []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.BatchID == "" {
+			continue
+		}
+		if i, ok := byID[e.BatchID]; ok {
+			index[i] = e
+			continue
+		}
+		byID[e.BatchID] = len(index)
+		index = append(index, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(index, func(a, b Entry) int { return a.Time.Compare(b.Time) })
+	return index, nil
+}
+
+func (a *Archive) appendIndex(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(a.Root, IndexName), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	// after a torn append, start a line of our own
+	last := make([]byte, 1)
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Retention bounds the archive. Batches go whole, oldest first.
+type Retention struct {
+	MaxAge   time.Duration // batches proven longer ago are deleted; 0 keeps them
+	MaxBytes int64         // the oldest batches are deleted while the archive is larger; 0 for no limit
+}
+
+// GC deletes the batches r no longer keeps at now and returns them. Only
+// the files the index lists are deleted, then the directories left empty
+// up to the root; the index is rewritten without them. With dryRun nothing
+// is deleted.
+func (a *Archive) GC(r Retention, now time.Time, dryRun bool) ([]Entry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	index, err := a.index()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range index {
+		total += e.Size()
+	}
+	var removed, kept []Entry
+	for _, e := range index {
+		old := r.MaxAge > 0 && now.Sub(e.Time) > r.MaxAge
+		big := r.MaxBytes > 0 && total > r.MaxBytes
+		if !old && !big {
+			kept = append(kept, e)
+			continue
+		}
+		removed = append(removed, e)
+		total -= e.Size()
+	}
+	if dryRun || len(removed) == 0 {
+		return removed, nil
+	}
+
+	// the index first: a crash then leaves files no entry lists, never an
+	// entry whose files are gone
+	var buf bytes.Buffer
+	for _, e := range kept {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if err := artifacts.WriteFile(filepath.Join(a.Root, IndexName), &buf, false); err != nil {
+		return nil, err
+	}
+	root := filepath.Clean(a.Root)
+	for _, e := range removed {
+		dir := filepath.Join(root, filepath.FromSlash(e.Dir))
+		if !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			return removed, fmt.Errorf("%w: batch %s: directory %q is outside the archive", errs.ErrInvalidInput, e.BatchID, e.Dir)
+		}
+		for _, f := range e.Files {
+			if err := os.Remove(filepath.Join(dir, f.Name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, err
+			}
+		}
+		for d := dir; d != root && strings.HasPrefix(d, root+string(filepath.Separator)); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break // not empty
+			}
+		}
+	}
+	return removed, nil
+}
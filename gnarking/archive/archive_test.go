@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+func TestParseLayout(t *testing.T) {
+	for _, s := range []string{string(DefaultLayout), "{profile}/{batch}", "{batch}"} {
+		if _, err := ParseLayout(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "proofs/{yyyy}", "/abs/{batch}", "../{batch}", "a//{batch}", "{year}/{batch}", `a\{batch}`} {
+		if _, err := ParseLayout(s); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%q: %v, want ErrInvalidInput", s, err)
+		}
+	}
+	got := DefaultLayout.Dir("ab", "8", time.Date(2025, 1, 15, 23, 30, 0, 0, time.FixedZone("", -3600)))
+	if want := filepath.FromSlash("proofs/2025/01/16/ab"); got != want {
+		t.Errorf("dir %s, want %s (UTC day)", got, want)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	work, root := t.TempDir(), t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(work, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	a := &Archive{Root: root}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	old, recent := strings.Repeat("01", 32), strings.Repeat("02", 32)
+	if _, err := a.Add(old, "8", now.Add(-60*24*time.Hour), write("proof_8.json", "old proof"), write("public_8.json", "{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Add(recent, "8", now.Add(-time.Hour), write("proof_8.json", "recent proof")); err != nil {
+		t.Fatal(err)
+	}
+	// a receipt published later joins its batch
+	e, err := a.Add(strings.ToUpper(recent), "8", now, write("receipt_8.json", "receipt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Dir != "proofs/2025/03/01/"+recent || len(e.Files) != 2 || e.Files[1].Name != "receipt_8.json" {
+		t.Fatalf("entry %+v", e)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "proofs/2025/03/01", recent, "proof_8.json")); err != nil || string(b) != "recent proof" {
+		t.Fatalf("archived proof %q: %v", b, err)
+	}
+	if _, err := a.Add("beef", "8", now); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("short batch ID: %v", err)
+	}
+	if _, err := a.Find(strings.Repeat("03", 32)); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("find unknown batch: %v", err)
+	}
+	index, err := a.Index()
+	if err != nil || len(index) != 2 || index[0].BatchID != old {
+		t.Fatalf("index %v: %v", index, err)
+	}
+
+	// a file the index does not list is never deleted, nor its directory
+	oldDir := filepath.Join(root, "proofs/2024/12/31", old)
+	stray := filepath.Join(root, "proofs/2024/12/notes.txt")
+	os.WriteFile(stray, []byte("mine"), 0o644)
+
+	r := Retention{MaxAge: 30 * 24 * time.Hour}
+	removed, err := a.GC(r, now, true)
+	if err != nil || len(removed) != 1 || removed[0].BatchID != old {
+		t.Fatalf("dry run %v: %v", removed, err)
+	}
+	if _, err := os.Stat(oldDir); err != nil {
+		t.Fatalf("dry run deleted: %v", err)
+	}
+	if removed, err = a.GC(r, now, false); err != nil || len(removed) != 1 {
+		t.Fatalf("gc %v: %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "proofs/2024/12/31")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty day directory left: %v", err)
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Errorf("stray file: %v", err)
+	}
+	if _, err := a.Find(old); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("collected batch still indexed: %v", err)
+	}
+
+	// over the size limit, the oldest go first
+	if removed, err = a.GC(Retention{MaxBytes: 1}, now, false); err != nil || len(removed) != 1 || removed[0].BatchID != recent {
+		t.Fatalf("gc by size %v: %v", removed, err)
+	}
+	if index, _ := a.Index(); len(index) != 0 {
+		t.Fatalf("index after gc %v", index)
+	}
+}
+
+func TestIndexTornLine(t *testing.T) {
+	root := t.TempDir()
+	a := &Archive{Root: root}
+	id := strings.Repeat("0a", 32)
+	src := filepath.Join(t.TempDir(), "proof_8.json")
+	os.WriteFile(src, []byte("p"), 0o644)
+	if _, err := a.Add(id, "8", time.Now(), src); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(filepath.Join(root, IndexName), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"batch_id":"0b`)
+	f.Close()
+	if e, err := a.Find(id); err != nil || len(e.Files) != 1 {
+		t.Fatalf("after a torn append: %+v %v", e, err)
+	}
+	// the next append is not lost to it
+	next := strings.Repeat("0c", 32)
+	if _, err := a.Add(next, "8", time.Now(), src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Find(next); err != nil {
+		t.Fatalf("append after a torn line: %v", err)
+	}
+}
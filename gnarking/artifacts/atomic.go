@@ -0,0 +1,85 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gnarking/errs"
+	"gnarking/ioutilx"
+)
+
+// WriterFunc adapts an export function such as vk.ExportSolidity to
+// io.WriterTo.
+type WriterFunc func(w io.Writer) error
+
+func (f WriterFunc) WriteTo(w io.Writer) (int64, error) {
+	cw := &ioutilx.CountingWriter{W: w}
+	err := f(cw)
+	return cw.N, err
+}
+
+// WriteFile writes a to name, zstd-compressed when compress is set, so that
+// name only ever holds a complete artifact: the content goes to a temporary
+// file next to it, is fsynced, read back and checked against the SHA-256 of
+// what was written, then renamed over name. A crash leaves the old file (or
+// none) and at worst a stray .tmp file, never a torn pk or vk.
+func WriteFile(name string, a io.WriterTo, compress bool) (err error) {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	written := ioutilx.NewHashWriter(tmp)
+	zw, err := NewWriter(written, compress)
+	if err != nil {
+		return err
+	}
+	if _, err = a.WriteTo(zw); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	// read back what reached the disk
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	onDisk := ioutilx.NewHashWriter(nil)
+	if _, err = io.Copy(onDisk, tmp); err != nil {
+		return err
+	}
+	if written.Sum() != onDisk.Sum() {
+		return fmt.Errorf("%w: %s does not read back as written", errs.ErrArtifactMismatch, name)
+	}
+
+	// CreateTemp makes the file 0600, artifacts are shared
+	if err = tmp.Chmod(0o644); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	// persist the rename itself
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,63 @@
+package artifacts
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "pk_8.groth16")
+	payload := bytes.Repeat([]byte("proving key bytes "), 4096)
+
+	for _, compress := range []bool{false, true} {
+		if err := WriteFile(name, WriterFunc(func(w io.Writer) error {
+			_, err := w.Write(payload)
+			return err
+		}), compress); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		f.Close()
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("compress=%v: read back %d bytes, err %v", compress, len(got), err)
+		}
+	}
+
+	// a writer failing halfway leaves the previous artifact untouched
+	before, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crash := errors.New("crash")
+	err = WriteFile(name, WriterFunc(func(w io.Writer) error {
+		w.Write(payload[:100])
+		return crash
+	}), false)
+	if !errors.Is(err, crash) {
+		t.Fatalf("err %v, want %v", err, crash)
+	}
+	after, err := os.ReadFile(name)
+	if err != nil || !bytes.Equal(before, after) {
+		t.Fatalf("failed write changed %s", name)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("%d files left in %s, want 1", len(entries), dir)
+	}
+	if fi, _ := entries[0].Info(); fi.Mode().Perm() != 0o644 {
+		t.Fatalf("mode %v", fi.Mode())
+	}
+}
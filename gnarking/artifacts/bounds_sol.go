@@ -0,0 +1,64 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// BoundCheck is one public input the contract range checks before it
+// calls the verifier.
+type BoundCheck struct {
+	Name  string // circuit.PublicInput name, e.g. k_old
+	Index int    // into the verifier's input array
+	Bits  int
+}
+
+// SolidityBounds is a Solidity library checking the public inputs against
+// the widths the circuit was set up with, so a contract rejects an input
+// out of range with a named revert instead of a failed pairing, and can
+// store it in a uintN.
+type SolidityBounds struct {
+	Profile string
+	Inputs  int // length of the verifier's input array
+	Checks  []BoundCheck
+}
+
+var _ io.WriterTo = (*SolidityBounds)(nil)
+
+var boundsTmpl = template.Must(template.New("bounds").Funcs(template.FuncMap{
+	"upper": func(s string) string { return strings.ToUpper(s) },
+}).Parse(`// SPDX-License-Identifier: MIT
+
+pragma solidity ^0.8.0;
+
+/// Bit widths of the settlement circuit's public inputs, profile {{.Profile}}.
+/// Generated by ddm export from the setup manifest; do not edit.
+library SettlementBounds {
+{{- range .Checks}}
+    uint256 internal constant {{upper .Name}}_BITS = {{.Bits}};
+{{- end}}
+
+    /// Reverts unless every bounded input fits its width.
+    function check(uint256[{{.Inputs}}] calldata input) internal pure {
+{{- range .Checks}}
+        require(input[{{.Index}}] >> {{upper .Name}}_BITS == 0, "{{.Name}} out of range");
+{{- end}}
+    }
+}
+`))
+
+func (b *SolidityBounds) WriteTo(w io.Writer) (int64, error) {
+	for _, c := range b.Checks {
+		if c.Index < 0 || c.Index >= b.Inputs || c.Bits <= 0 || c.Bits >= 256 {
+			return 0, fmt.Errorf("invalid bound check %s: index %d of %d, %d bits", c.Name, c.Index, b.Inputs, c.Bits)
+		}
+	}
+	var sb strings.Builder
+	if err := boundsTmpl.Execute(&sb, b); err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
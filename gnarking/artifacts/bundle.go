@@ -0,0 +1,126 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gnarking/errs"
+	"gnarking/ioutilx"
+)
+
+// BundleExt is the extension of single-file artifact bundles.
+const BundleExt = ".ddmbundle"
+
+// ManifestMember is the first entry of every bundle and doubles as its index.
+const ManifestMember = "manifest.json"
+
+// WriteBundle writes a zstd-compressed tar holding the manifest followed by
+// members in the given order. Every member must be recorded in m.Files.
+// Members are serialized twice (size, then content) so nothing is buffered.
+func WriteBundle(w io.Writer, m *Manifest, names []string, members map[string]io.WriterTo) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	put := func(name string, a io.WriterTo) error {
+		size, err := ioutilx.SizeOf(a)
+		if err != nil {
+			return fmt.Errorf("size %s: %w", name, err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size}); err != nil {
+			return err
+		}
+		if _, err := a.WriteTo(tw); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := put(ManifestMember, m); err != nil {
+		return err
+	}
+	for _, name := range names {
+		a, ok := members[name]
+		if !ok {
+			return fmt.Errorf("bundle member %s missing", name)
+		}
+		if _, ok := m.Files[name]; !ok {
+			return fmt.Errorf("bundle member %s not in manifest", name)
+		}
+		if err := put(name, a); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadBundle streams a bundle, decompressing each wanted member straight into
+// its reader (so a pk is never held compressed and decompressed at once) and
+// checking it against the manifest hash. Members without a reader are skipped.
+func ReadBundle(r io.Reader, members map[string]io.ReaderFrom) (*Manifest, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("bundle: %w", err)
+	}
+	if hdr.Name != ManifestMember {
+		return nil, fmt.Errorf("%w: bundle: first member is %s, want %s", errs.ErrArtifactMismatch, hdr.Name, ManifestMember)
+	}
+	var m Manifest
+	if _, err := m.ReadFrom(tr); err != nil {
+		return nil, fmt.Errorf("bundle manifest: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bundle: %w", err)
+		}
+		dst, ok := members[hdr.Name]
+		if !ok {
+			continue
+		}
+		entry, ok := m.Files[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: bundle member %s not in manifest", errs.ErrArtifactMismatch, hdr.Name)
+		}
+		h := ioutilx.NewHashWriter(nil)
+		if _, err := Decode(dst, io.TeeReader(tr, h)); err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		// drain what the reader left so the hash covers the whole member
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if sum := h.Sum(); hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%w: bundle member %s: sha256 %s, manifest says %s", errs.ErrArtifactMismatch, hdr.Name, hex.EncodeToString(sum[:]), entry.SHA256)
+		}
+		seen[hdr.Name] = true
+	}
+	for name := range members {
+		if !seen[name] {
+			return nil, fmt.Errorf("%w: bundle member %s not found", errs.ErrArtifactMismatch, name)
+		}
+	}
+	return &m, nil
+}
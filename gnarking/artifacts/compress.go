@@ -0,0 +1,63 @@
+package artifacts
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gnarking/errs"
+)
+
+// ZstdMagic opens every zstd frame (RFC 8878). gnark artifacts start with a
+// curve point or a length, so an uncompressed one starting with it is a
+// 2^-32 accident.
+var ZstdMagic = [4]byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// NewReader returns r, decompressed on the fly when it starts with a zstd
+// frame. Decompression streams with one decoder goroutine and a bounded
+// window, so loading a compressed pk never holds it twice. Close releases the
+// decoder; it does not close r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(ZstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(magic, ZstdMagic[:]) {
+		return io.NopCloser(br), nil
+	}
+	zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// Decode reads dst from r. gnark's decoders trust the lengths they read, so
+// a corrupt key or circuit can panic on an allocation or index; Decode
+// reports that as errs.ErrInvalidInput instead.
+func Decode(dst io.ReaderFrom, r io.Reader) (n int64, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%w: corrupt %T: %v", errs.ErrInvalidInput, dst, p)
+		}
+	}()
+	return dst.ReadFrom(r)
+}
+
+// NewWriter returns w, zstd-compressed when compress is set. Close ends the
+// frame; it does not close w.
+func NewWriter(w io.Writer, compress bool) (io.WriteCloser, error) {
+	if !compress {
+		return nopWriteCloser{w}, nil
+	}
+	return zstd.NewWriter(w)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,52 @@
+package artifacts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("proving key bytes "), 4096)
+	for _, compress := range []bool{false, true} {
+		var file bytes.Buffer
+		w, err := NewWriter(&file, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if compressed := bytes.HasPrefix(file.Bytes(), ZstdMagic[:]); compressed != compress {
+			t.Fatalf("compress=%v: zstd magic present = %v", compress, compressed)
+		}
+		if compress && file.Len() >= len(payload)/10 {
+			t.Fatalf("compressed %d bytes to %d", len(payload), file.Len())
+		}
+
+		r, err := NewReader(&file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("compress=%v: round trip changed the data", compress)
+		}
+	}
+
+	// files shorter than the magic pass through
+	r, err := NewReader(bytes.NewReader([]byte{0x28, 0xb5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, []byte{0x28, 0xb5}) {
+		t.Fatalf("short file read as %x", got)
+	}
+}
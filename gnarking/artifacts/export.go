@@ -0,0 +1,108 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	fr_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"golang.org/x/crypto/sha3"
+)
+
+// PublicInputsHex is the public witness as 0x-prefixed 32-byte words, the
+// `input` argument of the exported Solidity verifier.
+type PublicInputsHex []string
+
+var _ io.WriterTo = (*PublicInputsHex)(nil)
+
+func NewPublicInputsHexFromWitness(w witness.Witness) (PublicInputsHex, error) {
+	raw := w.Vector()
+	vec, ok := raw.(fr_bn254.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected witness vector type %T", raw)
+	}
+
+	out := make([]string, len(vec))
+	for i := range vec {
+		b := vec[i].BigInt(new(big.Int))   // fr.Element -> *big.Int
+		out[i] = fmt.Sprintf("0x%064x", b) // 32-byte, 0x-prefixed
+	}
+
+	return out, nil
+}
+
+func (p *PublicInputsHex) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(b).WriteTo(w)
+}
+
+// ProofWrap is a proof as the 8 uint256 words of MarshalSolidity.
+type ProofWrap [8]string
+
+func NewProofWrap(g *groth16_bn254.Proof) (ProofWrap, error) {
+	raw := g.MarshalSolidity()
+	if len(raw) != 8*32 {
+		return ProofWrap{}, fmt.Errorf("invalid proof length: got %d", len(raw))
+	}
+
+	var w ProofWrap
+	for i := 0; i < 8; i++ {
+		w[i] = "0x" + hex.EncodeToString(raw[i*32:(i+1)*32])
+	}
+	return w, nil
+}
+
+var _ io.WriterTo = (*ProofWrap)(nil)
+var _ io.ReaderFrom = (*ProofWrap)(nil)
+
+func (p *ProofWrap) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(b).WriteTo(w)
+}
+
+func (p *ProofWrap) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return int64(len(data)), err
+	}
+	return int64(len(data)), nil
+}
+
+// Calldata is the ABI-encoded call verifyProof(uint256[8] proof,
+// uint256[n] input) of the exported Solidity verifier, n = len(inputs).
+type Calldata []byte
+
+func NewCalldata(proof ProofWrap, inputs PublicInputsHex) (Calldata, error) {
+	sig := fmt.Sprintf("verifyProof(uint256[8],uint256[%d])", len(inputs))
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(sig))
+	out := h.Sum(nil)[:4]
+
+	words, err := packWords(append(proof[:], inputs...))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, words...), nil
+}
+
+var _ io.WriterTo = (*Calldata)(nil)
+
+// WriteTo writes the calldata as 0x-prefixed hex, as eth tooling takes it.
+func (c *Calldata) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, "0x"+hex.EncodeToString(*c)+"\n")
+	return int64(n), err
+}
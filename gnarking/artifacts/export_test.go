@@ -0,0 +1,79 @@
+package artifacts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCalldata(t *testing.T) {
+	var proof ProofWrap
+	for i := range proof {
+		proof[i] = fmt.Sprintf("0x%064x", i+1)
+	}
+	inputs := PublicInputsHex{"0x2a", "0x00"}
+
+	c, err := NewCalldata(proof, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 4+32*(8+2) {
+		t.Fatalf("calldata length %d", len(c))
+	}
+	// proof[0] == 1 and input[0] == 42, each a right-aligned word
+	if c[4+31] != 1 || c[4+8*32+31] != 42 {
+		t.Fatalf("unexpected word layout %s", hex.EncodeToString(c))
+	}
+
+	inputs[1] = "0x1" + fmt.Sprintf("%064x", 0) // 257 bits
+	if _, err := NewCalldata(proof, inputs); err == nil {
+		t.Fatal("oversized word accepted")
+	}
+}
+
+func TestSolidityBounds(t *testing.T) {
+	b := SolidityBounds{Profile: "8", Inputs: 8, Checks: []BoundCheck{{Name: "k_old", Index: 1, Bits: 40}}}
+	var sb strings.Builder
+	if _, err := b.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"uint256 internal constant K_OLD_BITS = 40;",
+		"function check(uint256[8] calldata input)",
+		`require(input[1] >> K_OLD_BITS == 0, "k_old out of range");`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("missing %q in\n%s", want, sb.String())
+		}
+	}
+
+	b.Checks[0].Index = 8
+	if _, err := b.WriteTo(io.Discard); err == nil {
+		t.Fatal("check past the input array accepted")
+	}
+}
+
+func TestSolidityHeartbeat(t *testing.T) {
+	h := SolidityHeartbeat{Profile: "8", Inputs: 8, KOld: 1, M: 2, Total: 3}
+	var sb strings.Builder
+	if _, err := h.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"bool internal constant EMPTY_BATCHES = false;",
+		"function isHeartbeat(uint256[8] calldata input)",
+		"return input[2] == input[1] && input[3] == 0;",
+		`require(!heartbeat || EMPTY_BATCHES, "empty batches not enabled");`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("missing %q in\n%s", want, sb.String())
+		}
+	}
+
+	h.Total = 8
+	if _, err := h.WriteTo(io.Discard); err == nil {
+		t.Fatal("index past the input array accepted")
+	}
+}
@@ -0,0 +1,63 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// SolidityHeartbeat is a Solidity library telling heartbeat batches, empty
+// batches that settle nothing and leave the recipient's nonce at KOld
+// (M == KOld, TotalSettle 0), from batches with rows. A contract calls
+// check before it settles, so a deployment whose circuit was not set up
+// with empty batches rejects one by name, and one whose circuit was can
+// skip the transfer and count the heartbeat.
+type SolidityHeartbeat struct {
+	Profile string
+	Inputs  int  // length of the verifier's input array
+	KOld    int  // index of k_old in it
+	M       int  // of m
+	Total   int  // of total_settle
+	Enabled bool // the setup's circuit proves empty batches
+}
+
+var _ io.WriterTo = (*SolidityHeartbeat)(nil)
+
+var heartbeatTmpl = template.Must(template.New("heartbeat").Parse(`// SPDX-License-Identifier: MIT
+
+pragma solidity ^0.8.0;
+
+/// Heartbeat (empty) batches of the settlement circuit, profile {{.Profile}}.
+/// Generated by ddm export from the setup manifest; do not edit.
+library SettlementHeartbeat {
+    bool internal constant EMPTY_BATCHES = {{.Enabled}};
+
+    /// Whether the batch settles nothing: M == KOld and TotalSettle == 0.
+    function isHeartbeat(uint256[{{.Inputs}}] calldata input) internal pure returns (bool) {
+        return input[{{.M}}] == input[{{.KOld}}] && input[{{.Total}}] == 0;
+    }
+
+    /// Reverts on a heartbeat unless the circuit proves empty batches;
+    /// returns whether the batch is one, to skip the transfer.
+    function check(uint256[{{.Inputs}}] calldata input) internal pure returns (bool) {
+        bool heartbeat = isHeartbeat(input);
+        require(!heartbeat || EMPTY_BATCHES, "empty batches not enabled");
+        return heartbeat;
+    }
+}
+`))
+
+func (h *SolidityHeartbeat) WriteTo(w io.Writer) (int64, error) {
+	for _, i := range []int{h.KOld, h.M, h.Total} {
+		if i < 0 || i >= h.Inputs {
+			return 0, fmt.Errorf("invalid heartbeat input index %d of %d", i, h.Inputs)
+		}
+	}
+	var sb strings.Builder
+	if err := heartbeatTmpl.Execute(&sb, h); err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
@@ -0,0 +1,81 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gnarking/errs"
+	"gnarking/ioutilx"
+)
+
+const ManifestVersion = 1
+
+// Manifest describes the artifacts produced by one setup run.
+type Manifest struct {
+	Version      int                  `json:"version"`
+	Profile      string               `json:"profile,omitempty"` // circuit.Profile name
+	N            int                  `json:"n"`
+	Curve        string               `json:"curve"`
+	Backend      string               `json:"backend"`
+	DataHash     string               `json:"data_hash"`
+	Ordering     string               `json:"ordering"`
+	Msg          string               `json:"msg"`
+	NonceBits    int                  `json:"nonce_bits,omitempty"` // circuit.Bounds, absent when unbounded
+	SizeBits     int                  `json:"size_bits,omitempty"`
+	TotalBits    int                  `json:"total_bits,omitempty"`
+	MinSize      uint64               `json:"min_size,omitempty"`      // circuit.Bounds.MinSize, absent when rows may settle nothing
+	SizeScale    int                  `json:"size_scale,omitempty"`    // decimal places of sizes in batch JSON, absent for integers
+	Cosigner     string               `json:"cosigner,omitempty"`      // circuit.Params.Cosigner of a 2-of-2 setup
+	CircuitHash  string               `json:"circuit_hash"`            // hex sha256 of the ccs
+	Hints        string               `json:"hints,omitempty"`         // circuit.HintSet the ccs was compiled against
+	Features     string               `json:"features,omitempty"`      // circuit.Features of the ccs, absent from manifests that predate them
+	PublicInputs int                  `json:"public_inputs,omitempty"` // len(circuit.PublicLayout) of the setup, absent from manifests that predate it
+	Files        map[string]FileEntry `json:"files"`
+}
+
+// FileEntry pins the content of one artifact.
+type FileEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // hex
+}
+
+var _ io.WriterTo = (*Manifest)(nil)
+var _ io.ReaderFrom = (*Manifest)(nil)
+
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(b).WriteTo(w)
+}
+
+func (m *Manifest) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return int64(len(data)), err
+	}
+	if m.Version != ManifestVersion {
+		return int64(len(data)), fmt.Errorf("%w: unsupported manifest version %d", errs.ErrArtifactMismatch, m.Version)
+	}
+	return int64(len(data)), nil
+}
+
+// Add records the serialized size and hash of an artifact under name.
+func (m *Manifest) Add(name string, a io.WriterTo) error {
+	n, sum, err := ioutilx.HashOf(a)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", name, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]FileEntry)
+	}
+	m.Files[name] = FileEntry{Size: n, SHA256: hex.EncodeToString(sum[:])}
+	return nil
+}
@@ -0,0 +1,160 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/errs"
+)
+
+const MultiVersion = 1
+
+// Multi is one submission of k independently proven batches of a profile,
+// for a contract-side multicall that verifies them in one transaction where
+// no aggregation circuit is available: proofs and input words in submission
+// order, the digest of each batch's inputs, and the aggregated digest over
+// all of them the contract recomputes and records.
+//
+// A batch's digest is keccak256 of its input words, 32 bytes each, in
+// verifier order (keccak256(abi.encodePacked(input))); the aggregated
+// digest is keccak256 of the batch digests in order. Calldata is the call
+// verifyMany(uint256[8][] proofs, uint256[n][] inputs, bytes32 digest).
+type Multi struct {
+	Version  int          `json:"version"`
+	Profile  string       `json:"profile"`
+	Inputs   int          `json:"inputs"` // words per batch, n
+	Digest   string       `json:"digest"` // 0x-hex aggregated digest
+	Batches  []MultiBatch `json:"batches"`
+	Function string       `json:"function"` // signature Calldata calls
+	Calldata string       `json:"calldata"` // 0x-hex
+}
+
+// MultiBatch is one proven batch of a Multi.
+type MultiBatch struct {
+	BatchID string          `json:"batch_id"` // hex, circuit.BatchID
+	Digest  string          `json:"digest"`   // 0x-hex keccak256 of Inputs
+	Proof   ProofWrap       `json:"proof"`
+	Inputs  PublicInputsHex `json:"inputs"`
+}
+
+var _ io.WriterTo = (*Multi)(nil)
+var _ io.ReaderFrom = (*Multi)(nil)
+
+// NewMulti builds the submission of batches, in order, filling in the
+// digests and the calldata. Every batch must take the same number of
+// inputs.
+func NewMulti(profile string, batches []MultiBatch) (*Multi, error) {
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("%w: no batches", errs.ErrInvalidInput)
+	}
+	n := len(batches[0].Inputs)
+	m := &Multi{
+		Version:  MultiVersion,
+		Profile:  profile,
+		Inputs:   n,
+		Batches:  make([]MultiBatch, len(batches)),
+		Function: fmt.Sprintf("verifyMany(uint256[8][],uint256[%d][],bytes32)", n),
+	}
+	agg := sha3.NewLegacyKeccak256()
+	proofs := make([]byte, 0, len(batches)*8*32)
+	inputs := make([]byte, 0, len(batches)*n*32)
+	for i, b := range batches {
+		if len(b.Inputs) != n {
+			return nil, fmt.Errorf("%w: batch %d has %d inputs, batch 0 has %d", errs.ErrInvalidInput, i, len(b.Inputs), n)
+		}
+		proofWords, err := packWords(b.Proof[:])
+		if err != nil {
+			return nil, fmt.Errorf("batch %d proof: %w", i, err)
+		}
+		inputWords, err := packWords(b.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d inputs: %w", i, err)
+		}
+		h := sha3.NewLegacyKeccak256()
+		h.Write(inputWords)
+		digest := h.Sum(nil)
+		agg.Write(digest)
+
+		b.Digest = "0x" + hex.EncodeToString(digest)
+		m.Batches[i] = b
+		proofs = append(proofs, proofWords...)
+		inputs = append(inputs, inputWords...)
+	}
+	digest := agg.Sum(nil)
+	m.Digest = "0x" + hex.EncodeToString(digest)
+
+	// head: two offsets and the digest; tails: length, then the words
+	k := big.NewInt(int64(len(batches)))
+	word := func(v *big.Int) []byte { return v.FillBytes(make([]byte, 32)) }
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(m.Function))
+	call := h.Sum(nil)[:4]
+	call = append(call, word(big.NewInt(3*32))...)
+	call = append(call, word(big.NewInt(int64(3*32+32+len(proofs))))...)
+	call = append(call, digest...)
+	call = append(call, word(k)...)
+	call = append(call, proofs...)
+	call = append(call, word(k)...)
+	call = append(call, inputs...)
+	m.Calldata = "0x" + hex.EncodeToString(call)
+	return m, nil
+}
+
+// Check recomputes the digests and calldata from the proofs and inputs,
+// failing with ErrArtifactMismatch when m was altered.
+func (m *Multi) Check() error {
+	want, err := NewMulti(m.Profile, m.Batches)
+	if err != nil {
+		return err
+	}
+	for i := range m.Batches {
+		if m.Batches[i].Digest != want.Batches[i].Digest {
+			return fmt.Errorf("%w: batch %d digest %s, inputs hash to %s", errs.ErrArtifactMismatch, i, m.Batches[i].Digest, want.Batches[i].Digest)
+		}
+	}
+	if m.Inputs != want.Inputs || m.Digest != want.Digest || m.Function != want.Function || m.Calldata != want.Calldata {
+		return fmt.Errorf("%w: multi digest or calldata do not match its batches", errs.ErrArtifactMismatch)
+	}
+	return nil
+}
+
+func (m *Multi) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (m *Multi) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return int64(len(data)), err
+	}
+	if m.Version != MultiVersion {
+		return int64(len(data)), fmt.Errorf("%w: unsupported multi version %d", errs.ErrArtifactMismatch, m.Version)
+	}
+	return int64(len(data)), nil
+}
+
+// packWords is words as consecutive 32-byte big-endian values.
+func packWords(words []string) ([]byte, error) {
+	out := make([]byte, 0, 32*len(words))
+	for i, word := range words {
+		v, ok := new(big.Int).SetString(word, 0)
+		if !ok || v.Sign() < 0 || v.BitLen() > 256 {
+			return nil, fmt.Errorf("word %d: invalid uint256 %q", i, word)
+		}
+		out = append(out, v.FillBytes(make([]byte, 32))...)
+	}
+	return out, nil
+}
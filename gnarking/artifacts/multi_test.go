@@ -0,0 +1,91 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/errs"
+)
+
+func TestMulti(t *testing.T) {
+	batch := func(seed int) MultiBatch {
+		b := MultiBatch{BatchID: fmt.Sprintf("%064x", seed), Inputs: make(PublicInputsHex, 3)}
+		for i := range b.Proof {
+			b.Proof[i] = fmt.Sprintf("0x%064x", 100*seed+i)
+		}
+		for i := range b.Inputs {
+			b.Inputs[i] = fmt.Sprintf("0x%064x", 1000*seed+i)
+		}
+		return b
+	}
+	m, err := NewMulti("8", []MultiBatch{batch(1), batch(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Function != "verifyMany(uint256[8][],uint256[3][],bytes32)" {
+		t.Fatalf("function %s", m.Function)
+	}
+
+	// digests as the contract computes them
+	keccak := func(data []byte) []byte {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(data)
+		return h.Sum(nil)
+	}
+	var agg []byte
+	for i, b := range m.Batches {
+		words, err := packWords(b.Inputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := keccak(words)
+		if b.Digest != "0x"+hex.EncodeToString(d) {
+			t.Fatalf("batch %d digest %s", i, b.Digest)
+		}
+		agg = append(agg, d...)
+	}
+	digest := keccak(agg)
+	if m.Digest != "0x"+hex.EncodeToString(digest) {
+		t.Fatalf("aggregated digest %s", m.Digest)
+	}
+
+	// selector, offsets, digest, then each array's length and words
+	call, err := hex.DecodeString(strings.TrimPrefix(m.Calldata, "0x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 4 + 32*(3+1+2*8+1+2*3); len(call) != want {
+		t.Fatalf("calldata %d bytes, want %d", len(call), want)
+	}
+	word := func(i int) *big.Int { return new(big.Int).SetBytes(call[4+32*i : 4+32*(i+1)]) }
+	if !bytes.Equal(call[:4], keccak([]byte(m.Function))[:4]) || word(0).Int64() != 96 || word(1).Int64() != 96+32+2*8*32 {
+		t.Fatalf("calldata head %x", call[:4+64])
+	}
+	if !bytes.Equal(call[4+64:4+96], digest) || word(3).Int64() != 2 || word(3+1+2*8).Int64() != 2 {
+		t.Fatal("calldata digest or array lengths")
+	}
+	if word(4+8).Int64() != 200 || word(3+1+2*8+1+3).Int64() != 2000 {
+		t.Fatal("second batch's words out of place")
+	}
+
+	if err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	m.Batches[1].Inputs = batch(3).Inputs
+	if err := m.Check(); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("altered inputs: %v", err)
+	}
+
+	short := batch(2)
+	short.Inputs = short.Inputs[:2]
+	if _, err := NewMulti("8", []MultiBatch{batch(1), short}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("batches of different widths: %v", err)
+	}
+}
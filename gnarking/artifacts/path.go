@@ -0,0 +1,142 @@
+package artifacts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+
+	"gnarking/errs"
+)
+
+// Kind is what an artifact file holds.
+type Kind string
+
+const (
+	KindCCS      Kind = "ccs"
+	KindPK       Kind = "pk"
+	KindVK       Kind = "vk"
+	KindProof    Kind = "proof"
+	KindManifest Kind = "manifest"
+)
+
+func (k Kind) ext() string {
+	if k == KindManifest {
+		return ".json"
+	}
+	return ".groth16"
+}
+
+// Params pins the setup an artifact belongs to.
+type Params struct {
+	N           int
+	Curve       ecc.ID
+	Backend     backend.ID
+	CircuitHash [32]byte
+	Version     int // ManifestVersion of the setup
+}
+
+// Path is the file name of kind for p,
+//
+//	<kind>_n<N>_<curve>_<backend>_<circuit hash, 8 hex>_v<version>.<ext>
+//
+// e.g. pk_n8_bn254_groth16_1f2e3d4c_v1.groth16: setups that differ in any of
+// them, a recompiled circuit included, never share a name.
+func Path(kind Kind, p Params) string {
+	return fmt.Sprintf("%s_n%d_%s_%s_%x_v%d%s", kind, p.N, p.Curve, p.Backend, p.CircuitHash[:4], p.Version, kind.ext())
+}
+
+// ParamsOf reads the Params of the setup m describes.
+func ParamsOf(m *Manifest) (Params, error) {
+	p := Params{N: m.N, Version: m.Version, Backend: backend.IDFromString(m.Backend)}
+	var err error
+	if p.Curve, err = ecc.IDFromString(m.Curve); err != nil {
+		return p, fmt.Errorf("%w: manifest curve: %w", errs.ErrArtifactMismatch, err)
+	}
+	if p.Backend == backend.UNKNOWN {
+		return p, fmt.Errorf("%w: manifest backend %q", errs.ErrArtifactMismatch, m.Backend)
+	}
+	h, err := hex.DecodeString(m.CircuitHash)
+	if err != nil || len(h) != len(p.CircuitHash) {
+		return p, fmt.Errorf("%w: manifest circuit hash %q", errs.ErrArtifactMismatch, m.CircuitHash)
+	}
+	copy(p.CircuitHash[:], h)
+	return p, nil
+}
+
+// Resolver finds artifacts in Dir, named by Path or, for setups written
+// before it, <kind>_<profile>.
+type Resolver struct {
+	Dir string
+}
+
+// ForManifest is the path of kind for the setup m describes.
+func (r Resolver) ForManifest(kind Kind, m *Manifest) (string, error) {
+	p, err := ParamsOf(m)
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{Path(kind, p)}
+	if m.Profile != "" {
+		candidates = append(candidates, fmt.Sprintf("%s_%s%s", kind, m.Profile, kind.ext()))
+	}
+	for _, name := range candidates {
+		path := filepath.Join(r.Dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no %s in %s", errs.ErrArtifactMismatch, strings.Join(candidates, " or "), r.Dir)
+}
+
+// ForProof is the path of kind for the setup hdr's proof was made with: the
+// manifest in Dir with hdr's curve, backend and circuit hash.
+func (r Resolver) ForProof(kind Kind, hdr *ProofHeader) (string, error) {
+	if hdr == nil {
+		return "", fmt.Errorf("%w: a legacy proof names no circuit", errs.ErrArtifactMismatch)
+	}
+	m, err := r.Manifest(hdr)
+	if err != nil {
+		return "", err
+	}
+	return r.ForManifest(kind, m)
+}
+
+// Manifest is the manifest in Dir of the setup hdr's proof was made with.
+func (r Resolver) Manifest(hdr *ProofHeader) (*Manifest, error) {
+	names, err := filepath.Glob(filepath.Join(r.Dir, string(KindManifest)+"_*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		m, err := readManifest(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p, err := ParamsOf(m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if p.CircuitHash == hdr.CircuitHash && p.Curve == hdr.Curve && p.Backend == hdr.Backend {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no manifest in %s for %s/%s circuit %x", errs.ErrArtifactMismatch, r.Dir, hdr.Curve, hdr.Backend, hdr.CircuitHash[:8])
+}
+
+func readManifest(name string) (*Manifest, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var m Manifest
+	if _, err := m.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,76 @@
+package artifacts
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+
+	"gnarking/errs"
+)
+
+func TestPath(t *testing.T) {
+	p := Params{N: 8, Curve: ecc.BN254, Backend: backend.GROTH16, CircuitHash: [32]byte{0x1f, 0x2e, 0x3d, 0x4c, 0x5b}, Version: 1}
+	if got, want := Path(KindPK, p), "pk_n8_bn254_groth16_1f2e3d4c_v1.groth16"; got != want {
+		t.Errorf("Path(pk) = %s, want %s", got, want)
+	}
+	if got, want := Path(KindManifest, p), "manifest_n8_bn254_groth16_1f2e3d4c_v1.json"; got != want {
+		t.Errorf("Path(manifest) = %s, want %s", got, want)
+	}
+	q := p
+	q.CircuitHash[0]++
+	if Path(KindVK, p) == Path(KindVK, q) {
+		t.Error("recompiled circuit shares a name")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir := t.TempDir()
+	hash := [32]byte{1, 2, 3}
+	m := &Manifest{Version: ManifestVersion, Profile: "8", N: 8, Curve: "bn254", Backend: "groth16", CircuitHash: hex.EncodeToString(hash[:])}
+	touch := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteFile(filepath.Join(dir, "manifest_8.json"), m, false); err != nil {
+		t.Fatal(err)
+	}
+	// another setup of the same profile, in the same directory
+	other := *m
+	other.CircuitHash = hex.EncodeToString(make([]byte, 32))
+	if err := WriteFile(filepath.Join(dir, "manifest_n8_bn254_groth16_00000000_v1.json"), &other, false); err != nil {
+		t.Fatal(err)
+	}
+	r := Resolver{Dir: dir}
+	hdr := &ProofHeader{Curve: ecc.BN254, Backend: backend.GROTH16, CircuitHash: hash}
+
+	// a setup written before Path resolves to its profile names
+	if _, err := r.ForProof(KindVK, hdr); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("no vk yet: %v", err)
+	}
+	touch("vk_8.groth16")
+	if got, err := r.ForProof(KindVK, hdr); err != nil || got != filepath.Join(dir, "vk_8.groth16") {
+		t.Fatalf("legacy vk: %s, %v", got, err)
+	}
+	// the deterministic name wins
+	touch("vk_n8_bn254_groth16_01020300_v1.groth16")
+	if got, err := r.ForProof(KindVK, hdr); err != nil || got != filepath.Join(dir, "vk_n8_bn254_groth16_01020300_v1.groth16") {
+		t.Fatalf("vk: %s, %v", got, err)
+	}
+
+	for name, h := range map[string]*ProofHeader{
+		"other circuit": {Curve: ecc.BN254, Backend: backend.GROTH16, CircuitHash: [32]byte{9}},
+		"other curve":   {Curve: ecc.BLS12_381, Backend: backend.GROTH16, CircuitHash: hash},
+		"other backend": {Curve: ecc.BN254, Backend: backend.PLONK, CircuitHash: hash},
+		"legacy proof":  nil,
+	} {
+		if got, err := r.ForProof(KindVK, h); !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s: %s, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package artifacts reads and writes the files produced by setup and prove.
+package artifacts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+
+	"gnarking/errs"
+	"gnarking/ioutilx"
+)
+
+// ProofMagic starts every framed proof file. A headerless (legacy) groth16
+// BN254 proof starts with a compressed G1 point; 0x44 has the "infinity"
+// flag bits set without being the canonical infinity encoding (0x40), so the
+// two formats can't be confused.
+var ProofMagic = [4]byte{'D', 'D', 'M', 'P'}
+
+const ProofHeaderVersion = 3
+
+// headerLen is the encoded size of a header, magic included:
+// magic(4) version(1) curve(2) backend(2) circuit(32) batch(32) time(8),
+// then from version 2 on max age(4), from version 3 on features(4)
+const (
+	headerLenV1 = 4 + 1 + 2 + 2 + 32 + 32 + 8
+	headerLenV2 = headerLenV1 + 4
+	headerLen   = headerLenV2 + 4
+)
+
+// ProofHeader is the context framed in front of the raw proof bytes.
+type ProofHeader struct {
+	Version     uint8
+	Curve       ecc.ID
+	Backend     backend.ID
+	CircuitHash [32]byte  // sha256 of the serialized ccs
+	BatchID     [32]byte  // circuit.BatchID of the public inputs
+	Timestamp   time.Time // seconds precision
+	// MaxAge after Timestamp the proof is stale and must not be submitted,
+	// seconds precision; zero (and every version 1 header) leaves it to the
+	// submitter
+	MaxAge time.Duration
+	// Features is the circuit.Features bitmask of the setup that proved it;
+	// versions 1 and 2 did not record it, see HasFeatures
+	Features uint32
+}
+
+// HasFeatures reports whether the header records its setup's features.
+func (h *ProofHeader) HasFeatures() bool {
+	return h.Version >= 3
+}
+
+// Expires returns when the proof goes stale, ok is false without a MaxAge.
+func (h *ProofHeader) Expires() (t time.Time, ok bool) {
+	if h.MaxAge <= 0 {
+		return time.Time{}, false
+	}
+	return h.Timestamp.Add(h.MaxAge), true
+}
+
+func (h *ProofHeader) String() string {
+	s := fmt.Sprintf("v%d %s/%s circuit %x batch %x at %s",
+		h.Version, h.Curve, h.Backend, h.CircuitHash[:8], h.BatchID[:8], h.Timestamp.UTC().Format(time.RFC3339))
+	if h.MaxAge > 0 {
+		s += fmt.Sprintf(" max age %s", h.MaxAge)
+	}
+	if h.HasFeatures() {
+		s += fmt.Sprintf(" features %#x", h.Features)
+	}
+	return s
+}
+
+// Proof is a proof file, framed or legacy. Proof must be allocated by the
+// caller before reading (e.g. &groth16_bn254.Proof{}).
+type Proof struct {
+	Header *ProofHeader // nil for legacy headerless files
+	Proof  interface {
+		io.WriterTo
+		io.ReaderFrom
+	}
+}
+
+var _ io.WriterTo = (*Proof)(nil)
+var _ io.ReaderFrom = (*Proof)(nil)
+
+// WriteTo writes the header (if any) followed by the raw proof.
+func (p *Proof) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	if p.Header != nil {
+		var buf [headerLen]byte
+		copy(buf[0:4], ProofMagic[:])
+		buf[4] = p.Header.Version
+		binary.BigEndian.PutUint16(buf[5:7], uint16(p.Header.Curve))
+		binary.BigEndian.PutUint16(buf[7:9], uint16(p.Header.Backend))
+		copy(buf[9:41], p.Header.CircuitHash[:])
+		copy(buf[41:73], p.Header.BatchID[:])
+		binary.BigEndian.PutUint64(buf[73:81], uint64(p.Header.Timestamp.Unix()))
+		binary.BigEndian.PutUint32(buf[81:85], uint32(p.Header.MaxAge/time.Second))
+		binary.BigEndian.PutUint32(buf[85:89], p.Header.Features)
+		size := headerLen
+		switch p.Header.Version {
+		case 1:
+			size = headerLenV1
+		case 2:
+			size = headerLenV2
+		}
+		k, err := w.Write(buf[:size])
+		n += int64(k)
+		if err != nil {
+			return n, err
+		}
+	}
+	k, err := p.Proof.WriteTo(w)
+	return n + k, err
+}
+
+// ReadFrom accepts both framed and legacy headerless proofs.
+func (p *Proof) ReadFrom(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var n int64
+	p.Header = nil
+
+	magic, err := br.Peek(len(ProofMagic))
+	if err == nil && bytes.Equal(magic, ProofMagic[:]) {
+		var buf [headerLen]byte
+		k, err := io.ReadFull(br, buf[:5])
+		n += int64(k)
+		if err != nil {
+			return n, fmt.Errorf("%w: proof header: %w", errs.ErrInvalidInput, err)
+		}
+		size := headerLen
+		switch buf[4] {
+		case 1:
+			size = headerLenV1
+		case 2:
+			size = headerLenV2
+		case ProofHeaderVersion:
+		default:
+			return n, fmt.Errorf("%w: unsupported proof header version %d", errs.ErrArtifactMismatch, buf[4])
+		}
+		k, err = io.ReadFull(br, buf[5:size])
+		n += int64(k)
+		if err != nil {
+			return n, fmt.Errorf("%w: proof header: %w", errs.ErrInvalidInput, err)
+		}
+		h := &ProofHeader{
+			Version:   buf[4],
+			Curve:     ecc.ID(binary.BigEndian.Uint16(buf[5:7])),
+			Backend:   backend.ID(binary.BigEndian.Uint16(buf[7:9])),
+			Timestamp: time.Unix(int64(binary.BigEndian.Uint64(buf[73:81])), 0),
+		}
+		copy(h.CircuitHash[:], buf[9:41])
+		copy(h.BatchID[:], buf[41:73])
+		if size >= headerLenV2 {
+			h.MaxAge = time.Duration(binary.BigEndian.Uint32(buf[81:85])) * time.Second
+		}
+		if size == headerLen {
+			h.Features = binary.BigEndian.Uint32(buf[85:89])
+		}
+		p.Header = h
+	}
+
+	k, err := p.Proof.ReadFrom(br)
+	if err != nil {
+		return n + k, fmt.Errorf("%w: proof: %w", errs.ErrInvalidInput, err)
+	}
+	return n + k, nil
+}
+
+// CircuitHash is the sha256 of a serialized constraint system.
+func CircuitHash(ccs io.WriterTo) ([32]byte, error) {
+	_, sum, err := ioutilx.HashOf(ccs)
+	return sum, err
+}
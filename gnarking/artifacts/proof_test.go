@@ -0,0 +1,121 @@
+package artifacts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+)
+
+// rawProof stands in for a groth16 proof: it reads everything that's left.
+type rawProof struct{ b []byte }
+
+func (p *rawProof) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(p.b)
+	return int64(n), err
+}
+
+func (p *rawProof) ReadFrom(r io.Reader) (int64, error) {
+	var err error
+	p.b, err = io.ReadAll(r)
+	return int64(len(p.b)), err
+}
+
+func TestProofFraming(t *testing.T) {
+	payload := []byte{0x80, 1, 2, 3, 4, 5}
+
+	hdr := &ProofHeader{
+		Version:   ProofHeaderVersion,
+		Curve:     ecc.BN254,
+		Backend:   backend.GROTH16,
+		Timestamp: time.Unix(1700000000, 0),
+		MaxAge:    10 * time.Minute,
+		Features:  0x10021,
+	}
+	hdr.CircuitHash[0] = 0xaa
+	hdr.BatchID[31] = 0xbb
+
+	var buf bytes.Buffer
+	if _, err := (&Proof{Header: hdr, Proof: &rawProof{payload}}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != headerLen+len(payload) {
+		t.Fatalf("framed size %d, want %d", buf.Len(), headerLen+len(payload))
+	}
+
+	got := Proof{Proof: &rawProof{}}
+	if _, err := got.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header == nil || *got.Header != *hdr {
+		t.Fatalf("header mismatch: %v != %v", got.Header, hdr)
+	}
+	if !bytes.Equal(got.Proof.(*rawProof).b, payload) {
+		t.Fatalf("payload mismatch")
+	}
+
+	if exp, ok := got.Header.Expires(); !ok || !exp.Equal(time.Unix(1700000600, 0)) {
+		t.Fatalf("expires %v %v", exp, ok)
+	}
+
+	if !got.Header.HasFeatures() {
+		t.Fatal("v3 header without features")
+	}
+
+	// version 2 headers have no features
+	v2 := *hdr
+	v2.Version, v2.Features = 2, 0
+	buf.Reset()
+	if _, err := (&Proof{Header: &v2, Proof: &rawProof{payload}}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != headerLenV2+len(payload) {
+		t.Fatalf("v2 framed size %d, want %d", buf.Len(), headerLenV2+len(payload))
+	}
+	got = Proof{Proof: &rawProof{}}
+	if _, err := got.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header == nil || *got.Header != v2 || !bytes.Equal(got.Proof.(*rawProof).b, payload) {
+		t.Fatalf("v2 mismatch: %v != %v", got.Header, &v2)
+	}
+	if got.Header.HasFeatures() {
+		t.Fatal("v2 header has features")
+	}
+
+	// version 1 headers have no max age either
+	v1 := v2
+	v1.Version, v1.MaxAge = 1, 0
+	buf.Reset()
+	if _, err := (&Proof{Header: &v1, Proof: &rawProof{payload}}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != headerLenV1+len(payload) {
+		t.Fatalf("v1 framed size %d, want %d", buf.Len(), headerLenV1+len(payload))
+	}
+	got = Proof{Proof: &rawProof{}}
+	if _, err := got.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header == nil || *got.Header != v1 || !bytes.Equal(got.Proof.(*rawProof).b, payload) {
+		t.Fatalf("v1 mismatch: %v != %v", got.Header, &v1)
+	}
+	if _, ok := got.Header.Expires(); ok {
+		t.Fatal("v1 header expires")
+	}
+
+	// legacy headerless file
+	legacy := Proof{Proof: &rawProof{}}
+	if _, err := legacy.ReadFrom(bytes.NewReader(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Header != nil {
+		t.Fatalf("unexpected header on legacy proof")
+	}
+	if !bytes.Equal(legacy.Proof.(*rawProof).b, payload) {
+		t.Fatalf("legacy payload mismatch")
+	}
+}
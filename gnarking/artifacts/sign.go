@@ -0,0 +1,65 @@
+package artifacts
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// manifestDomain separates manifest signatures from anything else the
+// release key might sign.
+const manifestDomain = "ddm-manifest-v1\x00"
+
+// ManifestDigest is the SHA-256 of m as WriteTo encodes it, what a release
+// signature covers and what ddm fetch -pin pins. Since the manifest pins
+// every file by hash, the digest pins the whole setup.
+func ManifestDigest(m *Manifest) ([32]byte, error) {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(b.Bytes()), nil
+}
+
+// SignManifest is key's Ed25519 signature of m's digest.
+func SignManifest(key ed25519.PrivateKey, m *Manifest) ([]byte, error) {
+	d, err := ManifestDigest(m)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(key, append([]byte(manifestDomain), d[:]...)), nil
+}
+
+// VerifyManifest checks sig, as SignManifest makes it, against any of keys:
+// ErrVerificationFailed when none signed m.
+func VerifyManifest(m *Manifest, sig []byte, keys []ed25519.PublicKey) error {
+	d, err := ManifestDigest(m)
+	if err != nil {
+		return err
+	}
+	msg := append([]byte(manifestDomain), d[:]...)
+	for _, k := range keys {
+		if ed25519.Verify(k, msg, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: manifest of profile %s (digest %x) is not signed by any of the %d release keys", errs.ErrVerificationFailed, m.Profile, d, len(keys))
+}
+
+// ParseReleaseKeys reads comma-separated hex Ed25519 public keys.
+func ParseReleaseKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for k := range strings.SplitSeq(s, ",") {
+		b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(k), "0x"))
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: release key %q: want %d hex bytes", errs.ErrInvalidInput, k, ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(b))
+	}
+	return keys, nil
+}
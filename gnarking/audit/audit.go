@@ -0,0 +1,144 @@
+// Package audit keeps an append-only, hash-chained JSONL log of verification
+// requests. Every entry carries the hash of the previous one, so editing or
+// dropping a line breaks the chain from that point on.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// GenesisHash is the PrevHash of the first entry.
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Entry is one verification request.
+type Entry struct {
+	Seq       uint64          `json:"seq"`
+	Time      time.Time       `json:"time"`
+	Caller    string          `json:"caller"`
+	Profile   string          `json:"profile,omitempty"`
+	ProofHash string          `json:"proof_hash"` // hex sha256 of the submitted proof bytes
+	Public    json.RawMessage `json:"public"`
+	Valid     bool            `json:"valid"`
+	Error     string          `json:"error,omitempty"`
+	LatencyNS int64           `json:"latency_ns"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"` // hex sha256 of the entry with Hash empty
+}
+
+// digest is the entry hash, computed over its JSON encoding with Hash unset.
+func (e Entry) digest() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to a JSONL file. It is safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	seq  uint64
+	prev string
+}
+
+// Open opens (or creates) the log at path, checking the existing chain so
+// new entries continue from its head.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	head, err := VerifyChain(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+	l := &Log{f: f, prev: GenesisHash}
+	if head != nil {
+		l.seq = head.Seq + 1
+		l.prev = head.Hash
+	}
+	return l, nil
+}
+
+// Append chains e onto the log and syncs it to disk. Seq, PrevHash and Hash
+// are filled in.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq
+	e.PrevHash = l.prev
+	h, err := e.digest()
+	if err != nil {
+		return e, err
+	}
+	e.Hash = h
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return e, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return e, err
+	}
+	l.seq++
+	l.prev = e.Hash
+	return e, nil
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// VerifyChain reads a log and checks sequence numbers, entry hashes and
+// links. It returns the last entry (nil for an empty log).
+func VerifyChain(r io.Reader) (*Entry, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var head *Entry
+	prev := GenesisHash
+	line := 0
+	for sc.Scan() {
+		line++
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return head, fmt.Errorf("line %d: %w", line, err)
+		}
+		if want := uint64(line - 1); e.Seq != want {
+			return head, fmt.Errorf("line %d: seq %d, want %d", line, e.Seq, want)
+		}
+		if e.PrevHash != prev {
+			return head, fmt.Errorf("line %d: prev_hash %s does not link to %s", line, e.PrevHash, prev)
+		}
+		h, err := e.digest()
+		if err != nil {
+			return head, fmt.Errorf("line %d: %w", line, err)
+		}
+		if h != e.Hash {
+			return head, fmt.Errorf("line %d: hash %s, content hashes to %s", line, e.Hash, h)
+		}
+		prev = e.Hash
+		head = &e
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return head, err
+	}
+	return head, nil
+}
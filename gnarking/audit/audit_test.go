@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.Append(Entry{Time: time.Unix(int64(i), 0).UTC(), Caller: "test", Public: []byte(`{"m": 8}`), Valid: i != 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// reopening continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := l.Append(Entry{Caller: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if e.Seq != 3 {
+		t.Fatalf("seq %d after reopen, want 3", e.Seq)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := VerifyChain(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash != e.Hash {
+		t.Fatalf("head %s, want %s", head.Hash, e.Hash)
+	}
+
+	// flipping a result breaks the chain
+	tampered := bytes.Replace(data, []byte(`"valid":false`), []byte(`"valid":true`), 1)
+	if _, err := VerifyChain(bytes.NewReader(tampered)); err == nil {
+		t.Fatal("tampered log verified")
+	}
+
+	// dropping a line breaks the chain
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	dropped := bytes.Join(append(lines[:1:1], lines[2:]...), nil)
+	if _, err := VerifyChain(bytes.NewReader(dropped)); err == nil {
+		t.Fatal("log with a dropped line verified")
+	}
+}
@@ -0,0 +1,184 @@
+// Package canon is the canonical JSON form every hash of batch content is
+// computed over, so IDs do not depend on Go's encoder, map order or how a
+// client formatted its request.
+//
+// The form:
+//   - object keys sorted by their UTF-8 bytes, duplicate keys rejected
+//   - no insignificant whitespace
+//   - numbers must be integers, written in plain decimal (no exponent,
+//     fraction, leading zeros or "-0"); anything else is rejected
+//   - strings escape only '"', '\\' and control characters: \b \t \n \f \r
+//     and \u00XX (lowercase hex) for the rest; other characters are raw UTF-8
+package canon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+
+	"gnarking/errs"
+)
+
+// Marshal encodes v with encoding/json and canonicalizes the result.
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(data)
+}
+
+// Hash is the sha256 of v's canonical form.
+func Hash(v any) ([32]byte, error) {
+	b, err := Marshal(v)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+// Canonicalize rewrites one JSON value into canonical form.
+func Canonicalize(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := value(dec, &buf); err != nil {
+		return nil, fmt.Errorf("%w: canonical json: %w", errs.ErrInvalidInput, err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: canonical json: trailing data", errs.ErrInvalidInput)
+	}
+	return buf.Bytes(), nil
+}
+
+func value(dec *json.Decoder, buf *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return object(dec, buf)
+		case '[':
+			return array(dec, buf)
+		}
+		return fmt.Errorf("unexpected %s", t)
+	case string:
+		writeString(buf, t)
+	case json.Number:
+		return writeNumber(buf, t)
+	case bool:
+		if t {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+func object(dec *json.Decoder, buf *bytes.Buffer) error {
+	members := make(map[string][]byte)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		if _, dup := members[key]; dup {
+			return fmt.Errorf("duplicate key %q", key)
+		}
+		var v bytes.Buffer
+		if err := value(dec, &v); err != nil {
+			return err
+		}
+		members[key] = v.Bytes()
+	}
+	if _, err := dec.Token(); err != nil { // '}'
+		return err
+	}
+
+	keys := make([]string, 0, len(members))
+	for k := range members {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, k)
+		buf.WriteByte(':')
+		buf.Write(members[k])
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func array(dec *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := value(dec, buf); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil { // ']'
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeNumber(buf *bytes.Buffer, n json.Number) error {
+	i, ok := new(big.Int).SetString(n.String(), 10)
+	if !ok {
+		return fmt.Errorf("number %s is not an integer", n)
+	}
+	buf.WriteString(i.String())
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	const hexDigits = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\b':
+			buf.WriteString(`\b`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[r>>4])
+			buf.WriteByte(hexDigits[r&0xf])
+		default:
+			var b [utf8.UTFMax]byte
+			buf.Write(b[:utf8.EncodeRune(b[:], r)])
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,76 @@
+package canon
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// testdata/vectors.json pins the canonical form: outputs (and hashes, where
+// given) must never change across versions, or batch IDs change with them.
+type vectors struct {
+	Valid []struct {
+		Name   string `json:"name"`
+		In     string `json:"in"`
+		Out    string `json:"out"`
+		SHA256 string `json:"sha256"`
+	} `json:"valid"`
+	Invalid []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"invalid"`
+}
+
+func TestVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range v.Valid {
+		out, err := Canonicalize([]byte(tc.In))
+		if err != nil {
+			t.Errorf("%s: %v", tc.Name, err)
+			continue
+		}
+		if string(out) != tc.Out {
+			t.Errorf("%s: got %s, want %s", tc.Name, out, tc.Out)
+		}
+		// canonical form is a fixed point
+		again, err := Canonicalize(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("%s: not idempotent: %s", tc.Name, again)
+		}
+		if tc.SHA256 != "" {
+			var raw json.RawMessage = []byte(tc.In)
+			h, err := Hash(raw)
+			if err != nil || hex.EncodeToString(h[:]) != tc.SHA256 {
+				t.Errorf("%s: hash %x, want %s", tc.Name, h, tc.SHA256)
+			}
+		}
+	}
+	for _, tc := range v.Invalid {
+		if out, err := Canonicalize([]byte(tc.In)); err == nil {
+			t.Errorf("%s: accepted as %s", tc.Name, out)
+		}
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	type row struct {
+		Size  uint64            `json:"size"`
+		Nonce uint64            `json:"nonce"`
+		Meta  map[string]string `json:"meta"`
+	}
+	b, err := Marshal(row{Size: 1, Nonce: 2, Meta: map[string]string{"y": "<", "x": "&"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"meta":{"x":"&","y":"<"},"nonce":2,"size":1}`; string(b) != want {
+		t.Fatalf("got %s, want %s", b, want)
+	}
+}
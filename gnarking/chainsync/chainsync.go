@@ -0,0 +1,433 @@
+// Package chainsync reads the settlement contract's per-recipient nonce
+// high-water mark (KOld) over Ethereum JSON-RPC, so batches are built and
+// witnessed against on-chain state rather than a local guess.
+package chainsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/errs"
+	"gnarking/retry"
+)
+
+// KOldSignature is the contract getter read by RPC.KOld:
+//
+//	function kOld(uint256 recipient) external view returns (uint256);
+const KOldSignature = "kOld(uint256)"
+
+// Source returns the last settled nonce for a recipient.
+type Source interface {
+	KOld(ctx context.Context, recipient *big.Int) (*big.Int, error)
+}
+
+// RPC is a Source backed by eth_call against a deployed settlement contract.
+type RPC struct {
+	URL      string
+	Contract string // 0x-prefixed 20-byte address
+	Block    string // block tag, "latest" when empty
+	Client   *http.Client
+	// Retry is applied to every call but SendTransaction, which a lost
+	// reply could otherwise have sent twice; Send pins the nonce, so a
+	// resend is at most a duplicate the node refuses.
+	Retry retry.Policy
+}
+
+func NewRPC(url, contract string) (*RPC, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(contract, "0x"))
+	if err != nil || len(b) != 20 {
+		return nil, fmt.Errorf("%w: invalid contract address %q", errs.ErrInvalidInput, contract)
+	}
+	return &RPC{URL: url, Contract: "0x" + hex.EncodeToString(b)}, nil
+}
+
+func (c *RPC) KOld(ctx context.Context, recipient *big.Int) (*big.Int, error) {
+	if recipient.Sign() < 0 || recipient.BitLen() > 256 {
+		return nil, fmt.Errorf("%w: recipient %s does not fit uint256", errs.ErrInvalidInput, recipient)
+	}
+	data := append(selector(KOldSignature), recipient.FillBytes(make([]byte, 32))...)
+
+	block := c.Block
+	if block == "" {
+		block = "latest"
+	}
+	call := map[string]string{"to": c.Contract, "data": "0x" + hex.EncodeToString(data)}
+	var out string
+	if err := c.call(ctx, "eth_call", []any{call, block}, &out); err != nil {
+		return nil, err
+	}
+	ret, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("eth_call result: %w", err)
+	}
+	if len(ret) != 32 {
+		return nil, fmt.Errorf("eth_call returned %d bytes, want 32 (is %s a settlement contract?)", len(ret), c.Contract)
+	}
+	return new(big.Int).SetBytes(ret), nil
+}
+
+// SendTransaction submits a transaction of data to the contract at to from
+// an account the node (or a signing proxy in front of it) holds, via
+// eth_sendTransaction, and returns the transaction hash. It is tried once:
+// the node picks the nonce, so a retry could post data twice.
+func (c *RPC) SendTransaction(ctx context.Context, from, to string, data []byte) (string, error) {
+	tx := map[string]string{"from": from, "to": to, "data": "0x" + hex.EncodeToString(data)}
+	var hash string
+	if err := c.callOnce(ctx, "eth_sendTransaction", []any{tx}, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Tx is an EIP-1559 transaction for eth_sendTransaction. Sending another Tx
+// with the same From and Nonce and fees raised by at least the node's
+// replacement bump (10% in geth) replaces it in the mempool.
+type Tx struct {
+	From, To             string
+	Data                 []byte
+	Nonce                uint64
+	MaxFeePerGas         *big.Int // wei
+	MaxPriorityFeePerGas *big.Int // wei
+}
+
+// Send submits tx from an account the node holds and returns its hash.
+func (c *RPC) Send(ctx context.Context, tx Tx) (string, error) {
+	params := map[string]string{
+		"from":                 tx.From,
+		"to":                   tx.To,
+		"data":                 "0x" + hex.EncodeToString(tx.Data),
+		"nonce":                hexQuantity(new(big.Int).SetUint64(tx.Nonce)),
+		"type":                 "0x2",
+		"maxFeePerGas":         hexQuantity(tx.MaxFeePerGas),
+		"maxPriorityFeePerGas": hexQuantity(tx.MaxPriorityFeePerGas),
+	}
+	var hash string
+	if err := c.call(ctx, "eth_sendTransaction", []any{params}, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Nonce is the transaction count of addr at block ("pending" counts the
+// mempool, "latest" only mined transactions).
+func (c *RPC) Nonce(ctx context.Context, addr, block string) (uint64, error) {
+	var out string
+	if err := c.call(ctx, "eth_getTransactionCount", []any{addr, block}, &out); err != nil {
+		return 0, err
+	}
+	n, err := parseQuantity(out)
+	if err != nil || !n.IsUint64() {
+		return 0, fmt.Errorf("eth_getTransactionCount result %q", out)
+	}
+	return n.Uint64(), nil
+}
+
+// SuggestFees returns the node's suggested tip and a fee cap of twice the
+// latest base fee plus the tip, which stays includable through six full
+// blocks of base fee increases.
+func (c *RPC) SuggestFees(ctx context.Context) (maxFee, tip *big.Int, err error) {
+	var tipHex string
+	if err := c.call(ctx, "eth_maxPriorityFeePerGas", []any{}, &tipHex); err != nil {
+		return nil, nil, err
+	}
+	if tip, err = parseQuantity(tipHex); err != nil {
+		return nil, nil, fmt.Errorf("eth_maxPriorityFeePerGas result %q", tipHex)
+	}
+	var block struct {
+		BaseFee string `json:"baseFeePerGas"`
+	}
+	if err := c.call(ctx, "eth_getBlockByNumber", []any{"latest", false}, &block); err != nil {
+		return nil, nil, err
+	}
+	baseFee, err := parseQuantity(block.BaseFee)
+	if err != nil {
+		return nil, nil, fmt.Errorf("latest block base fee %q (pre-London chain?)", block.BaseFee)
+	}
+	maxFee = new(big.Int).Lsh(baseFee, 1)
+	return maxFee.Add(maxFee, tip), tip, nil
+}
+
+// Receipt is the outcome of a mined transaction.
+type Receipt struct {
+	Block   uint64
+	Success bool
+	GasUsed uint64
+	// GasPrice is the effective price paid per gas, wei; nil when the node
+	// does not report one
+	GasPrice *big.Int
+}
+
+// Receipt returns hash's receipt, nil while it is not mined (or was
+// reorged out).
+func (c *RPC) Receipt(ctx context.Context, hash string) (*Receipt, error) {
+	var out *struct {
+		BlockNumber       string `json:"blockNumber"`
+		Status            string `json:"status"`
+		GasUsed           string `json:"gasUsed"`
+		EffectiveGasPrice string `json:"effectiveGasPrice"`
+	}
+	if err := c.call(ctx, "eth_getTransactionReceipt", []any{hash}, &out); err != nil {
+		return nil, err
+	}
+	if out == nil || out.BlockNumber == "" {
+		return nil, nil
+	}
+	block, err := parseQuantity(out.BlockNumber)
+	if err != nil || !block.IsUint64() {
+		return nil, fmt.Errorf("receipt of %s: block %q", hash, out.BlockNumber)
+	}
+	rc := &Receipt{Block: block.Uint64(), Success: out.Status == "0x1"}
+	if out.GasUsed != "" {
+		gas, err := parseQuantity(out.GasUsed)
+		if err != nil || !gas.IsUint64() {
+			return nil, fmt.Errorf("receipt of %s: gas used %q", hash, out.GasUsed)
+		}
+		rc.GasUsed = gas.Uint64()
+	}
+	if out.EffectiveGasPrice != "" {
+		if rc.GasPrice, err = parseQuantity(out.EffectiveGasPrice); err != nil {
+			return nil, fmt.Errorf("receipt of %s: effective gas price %q", hash, out.EffectiveGasPrice)
+		}
+	}
+	return rc, nil
+}
+
+// BlockNumber is the number of the latest block.
+func (c *RPC) BlockNumber(ctx context.Context) (uint64, error) {
+	var out string
+	if err := c.call(ctx, "eth_blockNumber", []any{}, &out); err != nil {
+		return 0, err
+	}
+	n, err := parseQuantity(out)
+	if err != nil || !n.IsUint64() {
+		return 0, fmt.Errorf("eth_blockNumber result %q", out)
+	}
+	return n.Uint64(), nil
+}
+
+// BatchSettledSignature is the event the contract emits per settled batch,
+// read by RPC.BatchSettled:
+//
+//	event BatchSettled(bytes32 indexed batchId, uint256 indexed recipient, uint256 kOld, uint256 m, uint256 totalSettle);
+//
+// batchId is circuit.BatchID of the proof's public inputs.
+const BatchSettledSignature = "BatchSettled(bytes32,uint256,uint256,uint256,uint256)"
+
+// LogsSpan is the most blocks one eth_getLogs asks for; providers refuse
+// wider ranges (10000 blocks is a common cap).
+const LogsSpan = 5000
+
+// Settled is one BatchSettled event.
+type Settled struct {
+	BatchID     [32]byte
+	Recipient   *big.Int
+	KOld        *big.Int
+	M           *big.Int
+	TotalSettle *big.Int
+	Block       uint64
+	TxHash      string
+	LogIndex    uint64
+}
+
+// BatchSettled returns the contract's BatchSettled events in blocks
+// [from, to], oldest first, asking for LogsSpan blocks at a time. Logs
+// removed by a reorg are left out.
+func (c *RPC) BatchSettled(ctx context.Context, from, to uint64) ([]Settled, error) {
+	logs, err := c.Logs(ctx, from, to, keccak([]byte(BatchSettledSignature)))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Settled, 0, len(logs))
+	for _, l := range logs {
+		if len(l.Topics) != 3 || len(l.Data) != 3*32 {
+			return nil, fmt.Errorf("%w: BatchSettled log in tx %s: %d topics, %d data bytes (is %s a settlement contract?)",
+				errs.ErrInvalidInput, l.TxHash, len(l.Topics), len(l.Data), c.Contract)
+		}
+		e := Settled{
+			Recipient:   new(big.Int).SetBytes(l.Topics[2]),
+			KOld:        new(big.Int).SetBytes(l.Data[0:32]),
+			M:           new(big.Int).SetBytes(l.Data[32:64]),
+			TotalSettle: new(big.Int).SetBytes(l.Data[64:96]),
+			Block:       l.Block,
+			TxHash:      l.TxHash,
+			LogIndex:    l.LogIndex,
+		}
+		copy(e.BatchID[:], l.Topics[1])
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Log is one log of the contract.
+type Log struct {
+	Topics   [][]byte // 32 bytes each, the event's topic first
+	Data     []byte
+	Block    uint64
+	TxHash   string
+	LogIndex uint64
+}
+
+// Logs returns the contract's logs in blocks [from, to] whose first topic
+// is one of topics, oldest first, asking for LogsSpan blocks at a time.
+// Logs removed by a reorg are left out.
+func (c *RPC) Logs(ctx context.Context, from, to uint64, topics ...[]byte) ([]Log, error) {
+	hexTopics := make([]string, len(topics))
+	for i, t := range topics {
+		hexTopics[i] = "0x" + hex.EncodeToString(t)
+	}
+	var first any = hexTopics
+	if len(hexTopics) == 1 {
+		first = hexTopics[0]
+	}
+	var out []Log
+	for lo := from; lo <= to; lo += LogsSpan {
+		hi := min(lo+LogsSpan-1, to)
+		filter := map[string]any{
+			"address":   c.Contract,
+			"fromBlock": hexQuantity(new(big.Int).SetUint64(lo)),
+			"toBlock":   hexQuantity(new(big.Int).SetUint64(hi)),
+			"topics":    []any{first},
+		}
+		var logs []struct {
+			Topics   []string `json:"topics"`
+			Data     string   `json:"data"`
+			Block    string   `json:"blockNumber"`
+			TxHash   string   `json:"transactionHash"`
+			LogIndex string   `json:"logIndex"`
+			Removed  bool     `json:"removed"`
+		}
+		if err := c.call(ctx, "eth_getLogs", []any{filter}, &logs); err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			if l.Removed {
+				continue
+			}
+			data, err := hex.DecodeString(strings.TrimPrefix(l.Data, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: log in tx %s: data %q", errs.ErrInvalidInput, l.TxHash, l.Data)
+			}
+			block, err := parseQuantity(l.Block)
+			if err != nil || !block.IsUint64() {
+				return nil, fmt.Errorf("log in tx %s: block %q", l.TxHash, l.Block)
+			}
+			index, err := parseQuantity(l.LogIndex)
+			if err != nil || !index.IsUint64() {
+				return nil, fmt.Errorf("log in tx %s: log index %q", l.TxHash, l.LogIndex)
+			}
+			lg := Log{Data: data, Block: block.Uint64(), TxHash: l.TxHash, LogIndex: index.Uint64()}
+			for _, t := range l.Topics {
+				b, err := hex.DecodeString(strings.TrimPrefix(t, "0x"))
+				if err != nil || len(b) != 32 {
+					return nil, fmt.Errorf("%w: log in tx %s: topic %q", errs.ErrInvalidInput, l.TxHash, t)
+				}
+				lg.Topics = append(lg.Topics, b)
+			}
+			out = append(out, lg)
+		}
+		if hi == to {
+			break // lo += LogsSpan would wrap at the top of the range
+		}
+	}
+	return out, nil
+}
+
+// hexQuantity and parseQuantity convert JSON-RPC quantities, 0x-prefixed hex
+// without leading zeros.
+func hexQuantity(x *big.Int) string { return "0x" + x.Text(16) }
+
+func parseQuantity(s string) (*big.Int, error) {
+	x, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || !strings.HasPrefix(s, "0x") || x.Sign() < 0 {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return x, nil
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call is callOnce under c.Retry.
+func (c *RPC) call(ctx context.Context, method string, params []any, out any) error {
+	return c.Retry.Do(ctx, func(ctx context.Context) error {
+		return c.callOnce(ctx, method, params, out)
+	})
+}
+
+func (c *RPC) callOnce(ctx context.Context, method string, params []any, out any) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrUnavailable, method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: HTTP %s", errs.ErrUnavailable, method, resp.Status)
+	}
+
+	var r rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if r.Error != nil {
+		return fmt.Errorf("%s: rpc error %d: %s", method, r.Error.Code, r.Error.Message)
+	}
+	return json.Unmarshal(r.Result, out)
+}
+
+// selector is the 4-byte ABI function selector of sig.
+func selector(sig string) []byte {
+	return keccak([]byte(sig))[:4]
+}
+
+func keccak(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// CheckFresh fails when kOld, the value a batch was built against, is no
+// longer the on-chain KOld for recipient.
+func CheckFresh(ctx context.Context, src Source, recipient, kOld *big.Int) error {
+	chain, err := src.KOld(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	if chain.Cmp(kOld) != 0 {
+		return fmt.Errorf("%w for recipient %s: batch KOld %s, on-chain %s", errs.ErrStaleNonce, recipient, kOld, chain)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package chainsync
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRPCKOld(t *testing.T) {
+	const contract = "0x00000000000000000000000000000000000000aa"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_call" {
+			t.Errorf("bad request %v %q", err, req.Method)
+		}
+		var call map[string]string
+		json.Unmarshal(req.Params[0], &call)
+		// kOld(uint256) selector, recipient 42
+		want := "0x" + hex.EncodeToString(selector(KOldSignature)) + "000000000000000000000000000000000000000000000000000000000000002a"
+		if call["to"] != contract || call["data"] != want {
+			t.Errorf("call %v", call)
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000011"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewRPC(srv.URL, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kOld, err := c.KOld(context.Background(), big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kOld.Int64() != 17 {
+		t.Fatalf("kOld %s, want 17", kOld)
+	}
+
+	if err := CheckFresh(context.Background(), c, big.NewInt(42), big.NewInt(17)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFresh(context.Background(), c, big.NewInt(42), big.NewInt(16)); err == nil {
+		t.Fatal("stale KOld accepted")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	// well-known: transfer(address,uint256)
+	if got := hex.EncodeToString(selector("transfer(address,uint256)")); got != "a9059cbb" {
+		t.Fatalf("selector %s", got)
+	}
+}
+
+func TestRPCSendTransaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string              `json:"method"`
+			Params []map[string]string `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_sendTransaction" {
+			t.Errorf("bad request %v %q", err, req.Method)
+		}
+		if tx := req.Params[0]; tx["from"] != "0x01" || tx["to"] != "0x02" || tx["data"] != "0xbeef" {
+			t.Errorf("tx %v", tx)
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xabc"}`))
+	}))
+	defer srv.Close()
+
+	c := &RPC{URL: srv.URL}
+	hash, err := c.SendTransaction(context.Background(), "0x01", "0x02", []byte{0xbe, 0xef})
+	if err != nil || hash != "0xabc" {
+		t.Fatalf("hash %q, err %v", hash, err)
+	}
+}
+
+func TestRPCFeesNonceReceipt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		result := map[string]string{
+			"eth_maxPriorityFeePerGas":  `"0x3b9aca00"`,
+			"eth_getBlockByNumber":      `{"number":"0x10","baseFeePerGas":"0x7"}`,
+			"eth_getTransactionCount":   `"0x2a"`,
+			"eth_blockNumber":           `"0x10"`,
+			"eth_sendTransaction":       `"0xfeed"`,
+			"eth_getTransactionReceipt": `null`,
+		}[req.Method]
+		switch req.Method {
+		case "eth_getTransactionReceipt":
+			if string(req.Params[0]) == `"0xfeed"` {
+				result = `{"blockNumber":"0xf","status":"0x0"}`
+			}
+		case "eth_sendTransaction":
+			var tx map[string]string
+			json.Unmarshal(req.Params[0], &tx)
+			if tx["nonce"] != "0x2a" || tx["type"] != "0x2" || tx["maxFeePerGas"] != "0x64" || tx["maxPriorityFeePerGas"] != "0x0" {
+				t.Errorf("tx %v", tx)
+			}
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	c := &RPC{URL: srv.URL}
+
+	maxFee, tip, err := c.SuggestFees(ctx)
+	if err != nil || tip.Int64() != 1e9 || maxFee.Int64() != 1e9+14 {
+		t.Fatalf("fees %v %v, err %v", maxFee, tip, err)
+	}
+	if n, err := c.Nonce(ctx, "0x01", "pending"); err != nil || n != 42 {
+		t.Fatalf("nonce %d, err %v", n, err)
+	}
+	if n, err := c.BlockNumber(ctx); err != nil || n != 16 {
+		t.Fatalf("block %d, err %v", n, err)
+	}
+	hash, err := c.Send(ctx, Tx{From: "0x01", To: "0x02", Nonce: 42, MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(0)})
+	if err != nil || hash != "0xfeed" {
+		t.Fatalf("hash %q, err %v", hash, err)
+	}
+	if rc, err := c.Receipt(ctx, hash); err != nil || rc == nil || rc.Block != 15 || rc.Success {
+		t.Fatalf("receipt %+v, err %v", rc, err)
+	}
+	if rc, err := c.Receipt(ctx, "0xbeef"); err != nil || rc != nil {
+		t.Fatalf("unmined receipt %+v, err %v", rc, err)
+	}
+}
+
+func TestRPCBatchSettled(t *testing.T) {
+	const contract = "0x00000000000000000000000000000000000000aa"
+	topic := "0x" + hex.EncodeToString(keccak([]byte(BatchSettledSignature)))
+	word := func(v int64) string { return hex.EncodeToString(new(big.Int).SetInt64(v).FillBytes(make([]byte, 32))) }
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params []struct {
+				Address   string   `json:"address"`
+				FromBlock string   `json:"fromBlock"`
+				ToBlock   string   `json:"toBlock"`
+				Topics    []string `json:"topics"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_getLogs" {
+			t.Errorf("bad request %v %q", err, req.Method)
+		}
+		f := req.Params[0]
+		if f.Address != contract || len(f.Topics) != 1 || f.Topics[0] != topic {
+			t.Errorf("filter %+v", f)
+		}
+		ranges = append(ranges, f.FromBlock+"-"+f.ToBlock)
+		if f.FromBlock != "0x64" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[]}`))
+			return
+		}
+		log := func(id string, removed bool) string {
+			return `{"topics":["` + topic + `","0x` + id + `","0x` + word(42) + `"],"data":"0x` + word(0) + word(8) + word(36) +
+				`","blockNumber":"0x65","transactionHash":"0xabc","logIndex":"0x1","removed":` + fmt.Sprint(removed) + `}`
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[` + log(word(7), false) + `,` + log(word(9), true) + `]}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewRPC(srv.URL, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.BatchSettled(context.Background(), 100, 100+LogsSpan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0x64-0x13eb", "0x13ec-0x13ec"}; fmt.Sprint(ranges) != fmt.Sprint(want) {
+		t.Fatalf("asked for %v, want %v", ranges, want)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1 (the reorged one dropped)", len(events))
+	}
+	e := events[0]
+	if e.BatchID[31] != 7 || e.Recipient.Int64() != 42 || e.KOld.Sign() != 0 || e.M.Int64() != 8 || e.TotalSettle.Int64() != 36 ||
+		e.Block != 0x65 || e.TxHash != "0xabc" || e.LogIndex != 1 {
+		t.Fatalf("event %+v", e)
+	}
+}
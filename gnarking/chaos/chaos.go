@@ -0,0 +1,81 @@
+// Package chaos injects faults into the proving pipeline so tests can check
+// every layer surfaces them as errors and never reports a bad proof as
+// valid. Injection exists only in builds with the ddm_chaos tag; elsewhere
+// every hook is a no-op and Set fails.
+//
+// A build with the tag reads its faults from DDM_CHAOS, a comma-separated
+// list of:
+//
+//	corrupt-pk[=OFFSET]     flip every bit of the proving key byte at OFFSET (default 1024)
+//	truncate-proof[=BYTES]  cut proof files after BYTES bytes (default 128)
+//	flip-public[=INDEX]     flip the low bit of public input INDEX before verifying (default 0)
+//	kill-prove=PHASE        fail proving once PHASE ("solve" or "msm") has started
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Env names the variable a ddm_chaos build reads its faults from.
+const Env = "DDM_CHAOS"
+
+// ErrKilled is what a prove killed by kill-prove fails with. It wraps no errs
+// sentinel on purpose: to callers it is an internal failure, as a crashed
+// prover would be.
+var ErrKilled = errors.New("chaos: prove killed")
+
+// Config is the set of faults to inject; the zero Config injects none.
+type Config struct {
+	CorruptPK     bool
+	PKOffset      int64
+	TruncateProof bool
+	ProofBytes    int64
+	FlipPublic    bool
+	PublicIndex   int
+	KillPhase     string
+}
+
+// Parse reads a DDM_CHAOS spec.
+func Parse(spec string) (Config, error) {
+	c := Config{PKOffset: 1024, ProofBytes: 128}
+	for _, f := range strings.Split(spec, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(f), "=")
+		num := func(dst *int64) error {
+			if !hasArg {
+				return nil
+			}
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("chaos: %s wants a non-negative integer, got %q", name, arg)
+			}
+			*dst = n
+			return nil
+		}
+		var err error
+		switch name {
+		case "":
+		case "corrupt-pk":
+			c.CorruptPK, err = true, num(&c.PKOffset)
+		case "truncate-proof":
+			c.TruncateProof, err = true, num(&c.ProofBytes)
+		case "flip-public":
+			var i int64
+			c.FlipPublic, err = true, num(&i)
+			c.PublicIndex = int(i)
+		case "kill-prove":
+			if arg != "solve" && arg != "msm" {
+				return Config{}, fmt.Errorf("chaos: kill-prove wants a phase, solve or msm, got %q", arg)
+			}
+			c.KillPhase = arg
+		default:
+			return Config{}, fmt.Errorf("chaos: unknown fault %q", name)
+		}
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
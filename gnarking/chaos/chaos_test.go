@@ -0,0 +1,228 @@
+//go:build ddm_chaos
+
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/chaos"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/prover"
+	"gnarking/verifier"
+)
+
+// publicCircuit has the settlement public inputs, so verifier.Verify takes
+// its proofs, and proves knowledge of X with X*X == TotalSettle. Sum binds
+// every other input, as the settlement circuit does.
+type publicCircuit struct {
+	P   circuit.SettlementCircuitPublic
+	X   frontend.Variable
+	Sum frontend.Variable
+}
+
+func (c *publicCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.P.TotalSettle)
+	api.AssertIsEqual(c.Sum, api.Add(c.P.Recipient, c.P.KOld, c.P.M, c.P.ChainID, c.P.Pk.A.X, c.P.Pk.A.Y, c.P.BatchDataRoot))
+	return nil
+}
+
+// fixture is a key pair and a valid assignment of publicCircuit, with the pk
+// and a framed proof on disk the way ddm keeps them.
+type fixture struct {
+	ccs       *cs_bn254.R1CS
+	vk        *groth16_bn254.VerifyingKey
+	pub       circuit.SettlementCircuitPublic
+	pkPath    string
+	proofPath string
+}
+
+func newFixture(t *testing.T) *fixture {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &publicCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{
+		ccs: ccs.(*cs_bn254.R1CS),
+		vk:  vk.(*groth16_bn254.VerifyingKey),
+		pub: circuit.SettlementCircuitPublic{
+			Recipient: big.NewInt(42), KOld: big.NewInt(0), M: big.NewInt(8), TotalSettle: big.NewInt(49),
+			ChainID: big.NewInt(1), BatchDataRoot: big.NewInt(3),
+		},
+		pkPath:    filepath.Join(t.TempDir(), "pk_test"),
+		proofPath: filepath.Join(t.TempDir(), "proof_test"),
+	}
+	f.pub.Pk.A.X, f.pub.Pk.A.Y = big.NewInt(1), big.NewInt(2)
+	write(t, f.pkPath, pk)
+
+	proof, err := f.prove(pk.(*groth16_bn254.ProvingKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := &artifacts.ProofHeader{Version: artifacts.ProofHeaderVersion, Curve: ecc.BN254, Backend: backend.GROTH16, Timestamp: time.Now()}
+	if hdr.BatchID, err = circuit.BatchID(f.pub); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f.proofPath, &artifacts.Proof{Header: hdr, Proof: proof})
+	return f
+}
+
+func (f *fixture) prove(pk *groth16_bn254.ProvingKey, report func(prover.Progress)) (*groth16_bn254.Proof, error) {
+	w, err := frontend.NewWitness(&publicCircuit{P: f.pub, X: 7, Sum: 42 + 0 + 8 + 1 + 1 + 2 + 3}, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		report = func(prover.Progress) {}
+	}
+	return new(prover.Tracker).Prove(context.Background(), f.ccs, pk, w, 0, report)
+}
+
+func write(t *testing.T, path string, w io.WriterTo) {
+	if err := artifacts.WriteFile(path, w, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// load reads path through the chaos hooks, as ddm's readFile does.
+func load(path string, r io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = artifacts.Decode(r, chaos.Reader(path, f))
+	return err
+}
+
+// verify loads the proof and checks it the way ddm verify does.
+func (f *fixture) verify() error {
+	var proof groth16_bn254.Proof
+	framed := artifacts.Proof{Proof: &proof}
+	if err := load(f.proofPath, &framed); err != nil {
+		return err
+	}
+	if err := verifier.CheckBatchID(framed.Header, f.pub); err != nil {
+		return err
+	}
+	return verifier.Verify(f.vk, &proof, f.pub)
+}
+
+func set(t *testing.T, spec string) {
+	c, err := chaos.Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chaos.Set(c)
+	t.Cleanup(func() { chaos.Set(chaos.Config{}) })
+}
+
+func TestParse(t *testing.T) {
+	c, err := chaos.Parse("corrupt-pk, truncate-proof=40,flip-public=3,kill-prove=msm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chaos.Config{CorruptPK: true, PKOffset: 1024, TruncateProof: true, ProofBytes: 40, FlipPublic: true, PublicIndex: 3, KillPhase: "msm"}
+	if c != want {
+		t.Fatalf("Parse = %+v, want %+v", c, want)
+	}
+	for _, bad := range []string{"melt-cpu", "kill-prove", "kill-prove=fft", "truncate-proof=-1", "corrupt-pk=x"} {
+		if _, err := chaos.Parse(bad); err == nil {
+			t.Errorf("Parse(%q) accepted", bad)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	f := newFixture(t)
+	if err := f.verify(); err != nil {
+		t.Fatalf("no faults: %v", err)
+	}
+
+	t.Run("truncate-proof", func(t *testing.T) {
+		for _, n := range []string{"0", "40", "128", "200"} {
+			set(t, "truncate-proof="+n)
+			if err := f.verify(); !errors.Is(err, errs.ErrInvalidInput) {
+				t.Errorf("proof cut after %s bytes: %v, want ErrInvalidInput", n, err)
+			}
+		}
+	})
+
+	t.Run("flip-public", func(t *testing.T) {
+		for _, i := range []string{"0", "3", "7"} {
+			set(t, "flip-public="+i)
+			if err := f.verify(); !errors.Is(err, errs.ErrVerificationFailed) {
+				t.Errorf("public input %s flipped: %v, want ErrVerificationFailed", i, err)
+			}
+		}
+		// the batched path too
+		var proof groth16_bn254.Proof
+		if err := load(f.proofPath, &artifacts.Proof{Proof: &proof}); err != nil {
+			t.Fatal(err)
+		}
+		ps := []*groth16_bn254.Proof{&proof, &proof}
+		pubs := []circuit.SettlementCircuitPublic{f.pub, f.pub}
+		if err := verifier.BatchVerify(ps, pubs, f.vk); !errors.Is(err, errs.ErrVerificationFailed) {
+			t.Errorf("batch with a flipped input: %v, want ErrVerificationFailed", err)
+		}
+	})
+
+	// a corrupted pk fails to load, fails to prove, or its proofs fail to verify
+	t.Run("corrupt-pk", func(t *testing.T) {
+		for _, off := range []string{"=0", "=200", "=500", "=900"} {
+			set(t, "corrupt-pk"+off)
+			var pk groth16_bn254.ProvingKey
+			if err := load(f.pkPath, &pk); err != nil {
+				continue
+			}
+			proof, err := f.prove(&pk, nil)
+			if err != nil {
+				continue
+			}
+			if err := verifier.Verify(f.vk, proof, f.pub); !errors.Is(err, errs.ErrVerificationFailed) {
+				t.Errorf("pk corrupted at%s: proof verifies (%v)", off, err)
+			}
+		}
+	})
+
+	t.Run("kill-prove", func(t *testing.T) {
+		var pk groth16_bn254.ProvingKey
+		if err := load(f.pkPath, &pk); err != nil {
+			t.Fatal(err)
+		}
+		for _, phase := range []prover.Phase{prover.PhaseSolve, prover.PhaseMSM} {
+			set(t, "kill-prove="+string(phase))
+			var last prover.Progress
+			proof, err := f.prove(&pk, func(p prover.Progress) { last = p })
+			if !errors.Is(err, chaos.ErrKilled) || proof != nil {
+				t.Errorf("killed at %s: proof %v, err %v", phase, proof, err)
+			}
+			if errs.CodeOf(err) != errs.CodeInternal {
+				t.Errorf("killed at %s: code %s, want %s", phase, errs.CodeOf(err), errs.CodeInternal)
+			}
+			if last.Phase != phase || last.Percent == 100 {
+				t.Errorf("killed at %s: last progress %+v", phase, last)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+//go:build ddm_chaos
+
+package chaos
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// Enabled reports whether this binary was built with the ddm_chaos tag.
+// Never ship such a build.
+const Enabled = true
+
+var active atomic.Pointer[Config]
+
+func init() {
+	c, err := Parse(os.Getenv(Env))
+	if err != nil {
+		panic(err)
+	}
+	active.Store(&c)
+}
+
+// Set replaces the faults being injected.
+func Set(c Config) error {
+	active.Store(&c)
+	return nil
+}
+
+// Reader returns r with the faults for the file at path applied: a
+// corrupted byte for proving keys (pk_*), a cut for proofs (proof_*).
+func Reader(path string, r io.Reader) io.Reader {
+	c, base := active.Load(), filepath.Base(path)
+	switch {
+	case c.CorruptPK && strings.HasPrefix(base, "pk"):
+		return &corruptReader{r: r, at: c.PKOffset}
+	case c.TruncateProof && strings.HasPrefix(base, "proof"):
+		return io.LimitReader(r, c.ProofBytes)
+	}
+	return r
+}
+
+type corruptReader struct {
+	r   io.Reader
+	off int64
+	at  int64
+}
+
+func (c *corruptReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if i := c.at - c.off; i >= 0 && i < int64(n) {
+		p[i] ^= 0xff
+	}
+	c.off += int64(n)
+	return n, err
+}
+
+// FlipPublic flips the low bit of one public input in place.
+func FlipPublic(v fr.Vector) {
+	if c := active.Load(); c.FlipPublic && c.PublicIndex < len(v) {
+		var one fr.Element
+		one.SetOne()
+		if v[c.PublicIndex].Bits()[0]&1 == 1 {
+			v[c.PublicIndex].Sub(&v[c.PublicIndex], &one)
+		} else {
+			v[c.PublicIndex].Add(&v[c.PublicIndex], &one)
+		}
+	}
+}
+
+// Kill fails when proving is to be killed at phase.
+func Kill(phase string) error {
+	if c := active.Load(); c.KillPhase == phase {
+		return fmt.Errorf("%w at %s", ErrKilled, phase)
+	}
+	return nil
+}
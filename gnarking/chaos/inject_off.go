@@ -0,0 +1,25 @@
+//go:build !ddm_chaos
+
+package chaos
+
+import (
+	"errors"
+	"io"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// Enabled reports whether this binary was built with the ddm_chaos tag.
+const Enabled = false
+
+// Set fails: fault injection exists only in test builds
+// (go build -tags ddm_chaos).
+func Set(c Config) error {
+	return errors.New("fault injection needs a build with -tags ddm_chaos")
+}
+
+func Reader(path string, r io.Reader) io.Reader { return r }
+
+func FlipPublic(v fr.Vector) {}
+
+func Kill(phase string) error { return nil }
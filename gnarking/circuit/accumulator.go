@@ -0,0 +1,200 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+
+	"gnarking/errs"
+)
+
+// CumulativeBits bounds a recipient's lifetime settled total. Batch totals
+// are range-checked to it as well, so old + total never wraps the field.
+const CumulativeBits = 128
+
+// AccumulatorPublic is AccumulatorCircuit's own public inputs, after
+// SettlementCircuitPublic's: the recipient's accumulator before and after
+// the batch. An accumulator is the commitment MiMC(Recipient, Cumulative,
+// Blinding) to the recipient's lifetime settled total; 0 is the empty
+// accumulator, cumulative 0, so a contract needs no genesis value and keeps
+// one slot per recipient.
+type AccumulatorPublic struct {
+	OldAcc frontend.Variable `gnark:",public"`
+	NewAcc frontend.Variable `gnark:",public"`
+}
+
+// AccumulatorCircuit is SettlementCircuit chained across batches: besides
+// the batch it proves NewAcc commits to the cumulative total OldAcc commits
+// to plus TotalSettle. The contract checks OldAcc against its stored slot
+// and replaces it with NewAcc, so the lifetime total is tracked in O(1)
+// storage without being revealed; the blinding holder can open it.
+type AccumulatorCircuit struct {
+	P           SettlementCircuitPublic
+	X           AccumulatorPublic
+	Cumulative  frontend.Variable // before this batch
+	OldBlinding frontend.Variable
+	NewBlinding frontend.Variable
+	Size        []frontend.Variable
+	Nonce       []frontend.Variable
+	Sig         []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewAccumulatorCircuit allocates the rows of an n-row batch.
+func NewAccumulatorCircuit(n int) *AccumulatorCircuit {
+	s := NewSettlementCircuit(n)
+	return &AccumulatorCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig}
+}
+
+func (c *AccumulatorCircuit) Define(api frontend.API) error {
+	// 0a. OldAcc is empty with Cumulative == 0, or opens to
+	//     MiMC(Recipient, Cumulative, OldBlinding)
+	old, err := accumulator(api, c.P.Recipient, c.Cumulative, c.OldBlinding)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(api.Mul(c.X.OldAcc, api.Sub(c.X.OldAcc, old)), 0)
+	api.AssertIsEqual(api.Mul(api.IsZero(c.X.OldAcc), c.Cumulative), 0)
+
+	// 0b. NewAcc == MiMC(Recipient, Cumulative + TotalSettle, NewBlinding),
+	//     every term below 2^CumulativeBits so the sum cannot wrap
+	api.ToBinary(c.Cumulative, CumulativeBits)
+	api.ToBinary(c.P.TotalSettle, CumulativeBits)
+	cumulative := api.Add(c.Cumulative, c.P.TotalSettle)
+	api.ToBinary(cumulative, CumulativeBits)
+	acc, err := accumulator(api, c.P.Recipient, cumulative, c.NewBlinding)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(acc, c.X.NewAcc)
+
+	// 1-6. the settlement constraints
+	inner := SettlementCircuit{
+		P:            c.P,
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+	}
+	return inner.Define(api)
+}
+
+func accumulator(api frontend.API, recipient, cumulative, blinding frontend.Variable) (frontend.Variable, error) {
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(recipient, cumulative, blinding)
+	return h.Sum(), nil
+}
+
+// Accumulator is the native MiMC(recipient, cumulative, blinding).
+func Accumulator(recipient, cumulative, blinding *big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	h.Write(encodeFieldElement(recipient))
+	h.Write(encodeFieldElement(cumulative))
+	h.Write(encodeFieldElement(blinding))
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// NextAccumulator returns the cumulative total after a batch settling total
+// and its accumulator under blinding: the NewAcc a prover commits to.
+func NextAccumulator(recipient, cumulative, total, blinding *big.Int) (next, acc *big.Int, err error) {
+	next = new(big.Int).Add(cumulative, total)
+	if cumulative.Sign() < 0 || total.Sign() < 0 || next.BitLen() > CumulativeBits {
+		return nil, nil, fmt.Errorf("%w: cumulative %s + total %s outside [0, 2^%d)", errs.ErrInvalidBatch, cumulative, total, CumulativeBits)
+	}
+	return next, Accumulator(recipient, next, blinding), nil
+}
+
+// ChainedAccumulator is the Variant proving AccumulatorCircuit. Profile
+// "accumulator-8" is the built-in one. A batch's variant inputs open the
+// recipient's accumulator before it, "old", absent for the empty one, and
+// blind the one after it, e.g. {"old": {"cumulative": "8", "blinding":
+// "111"}, "new_blinding": "222"}; the next batch's "old" is then the
+// cumulative total after this one under new_blinding. old_acc and new_acc
+// follow the PublicFields.
+type ChainedAccumulator struct{}
+
+// AccumulatorOpening opens an accumulator: the recipient's lifetime
+// settled total and the blinding it is committed under.
+type AccumulatorOpening struct {
+	Cumulative FieldJSON `json:"cumulative"`
+	Blinding   FieldJSON `json:"blinding"`
+}
+
+// AccumulatorInputs is a chained batch's variant inputs.
+type AccumulatorInputs struct {
+	Old         *AccumulatorOpening `json:"old,omitempty"` // nil for the empty accumulator
+	NewBlinding FieldJSON           `json:"new_blinding"`
+}
+
+func (v ChainedAccumulator) circuit(p Profile) *AccumulatorCircuit {
+	c := NewAccumulatorCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (v ChainedAccumulator) Define(p Profile) frontend.Circuit { return v.circuit(p) }
+
+// WitnessFromBatch commits to the new cumulative total natively, so one
+// past CumulativeBits is errs.ErrInvalidBatch before it reaches the solver.
+func (v ChainedAccumulator) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	old, hasOld := raw["old"]
+	delete(raw, "old")
+	if err != nil || len(raw) != 1 || raw["new_blinding"] == nil || hasOld && string(old) == "null" {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"old": {"cumulative": ..., "blinding": ...}, "new_blinding": ...}, "old" absent for the empty accumulator`, errs.ErrInvalidInput)
+	}
+	var in AccumulatorInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	head, err := fieldInts(base.P.Recipient, base.P.TotalSettle)
+	if err != nil {
+		return nil, err
+	}
+	cumulative, oldBlinding, oldAcc := new(big.Int), new(big.Int), new(big.Int)
+	if in.Old != nil {
+		cumulative, oldBlinding = (*big.Int)(&in.Old.Cumulative), (*big.Int)(&in.Old.Blinding)
+		oldAcc = Accumulator(head[0], cumulative, oldBlinding)
+	}
+	newBlinding := (*big.Int)(&in.NewBlinding)
+	_, newAcc, err := NextAccumulator(head[0], cumulative, head[1], newBlinding)
+	if err != nil {
+		return nil, err
+	}
+	c := v.circuit(p)
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	c.X.OldAcc, c.X.NewAcc = oldAcc, newAcc
+	c.Cumulative, c.OldBlinding, c.NewBlinding = cumulative, oldBlinding, newBlinding
+	return c, nil
+}
+
+func (ChainedAccumulator) PublicLayout(p Profile, base Layout) (Layout, error) {
+	return base.Append(
+		PublicInput{Name: "old_acc", Type: "field", Field: "X.OldAcc", Doc: "recipient's accumulator before the batch, MiMC(recipient, cumulative, blinding), 0 for none yet: the contract's stored slot"},
+		PublicInput{Name: "new_acc", Type: "field", Field: "X.NewAcc", Doc: "recipient's accumulator after the batch, over cumulative + total_settle: the contract stores it"},
+	), nil
+}
+
+func (ChainedAccumulator) feature() Features { return FeatureAccumulator }
@@ -0,0 +1,100 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+// TestAccumulatorProfile chains two batches through the built-in profile,
+// the second opening the accumulator the first committed to.
+func TestAccumulatorProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p, err := LookupProfile("accumulator-8")
+	assert.NoError(err)
+	assert.Equal(FeatureAccumulator, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(2, l.Extra())
+	assert.Equal("new_acc", l[len(l)-1].Name)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	ones := []int64{1, 1, 1, 1, 1, 1, 1, 1}
+	first := signedSettlement(assert, priv, MsgV1, 0, ones, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	second := signedSettlement(assert, priv, MsgV1, 8, []int64{5, 1, 2, 3, 4, 1, 1, 1}, []int64{9, 10, 11, 12, 13, 14, 15, 16})
+	recipient := first.P.Recipient.(*big.Int)
+
+	assign := func(s *SettlementCircuit, in string) *AccumulatorCircuit {
+		c, err := p.Assign(s, json.RawMessage(in))
+		assert.NoError(err)
+		return c.(*AccumulatorCircuit)
+	}
+	// empty accumulator, then chained on the first batch's
+	genesis := assign(&first, `{"new_blinding": "111"}`)
+	next := assign(&second, `{"old": {"cumulative": "8", "blinding": "111"}, "new_blinding": "222"}`)
+	assert.Equal(0, genesis.X.NewAcc.(*big.Int).Cmp(next.X.OldAcc.(*big.Int)))
+	assert.Equal(0, next.X.NewAcc.(*big.Int).Cmp(Accumulator(recipient, big.NewInt(26), big.NewInt(222))))
+	w, err := frontend.NewWitness(next, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	pub, err := PublicFromWitness(w)
+	assert.NoError(err)
+	assert.Equal(2, len(pub.Extra))
+
+	// empty accumulator claimed to hold a total already
+	inflatedGenesis := *genesis
+	inflatedGenesis.Cumulative = big.NewInt(100)
+	inflatedGenesis.X.NewAcc = Accumulator(recipient, big.NewInt(108), big.NewInt(111))
+	// old accumulator opened to another total
+	wrongOpening := *next
+	wrongOpening.Cumulative = big.NewInt(100)
+	wrongOpening.X.NewAcc = Accumulator(recipient, big.NewInt(118), big.NewInt(222))
+	// new accumulator leaves the batch out
+	skipped := *next
+	skipped.X.NewAcc = Accumulator(recipient, big.NewInt(8), big.NewInt(222))
+	// restarted from empty: valid in-circuit, the contract rejects an
+	// OldAcc that is not its stored slot
+	reset := assign(&second, `{"new_blinding": "222"}`)
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(genesis),
+		test.WithValidAssignment(next),
+		test.WithValidAssignment(reset),
+		test.WithInvalidAssignment(&inflatedGenesis),
+		test.WithInvalidAssignment(&wrongOpening),
+		test.WithInvalidAssignment(&skipped),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, tc := range map[string]struct {
+		in   string
+		want error
+	}{
+		"null old":             {`{"old": null, "new_blinding": "1"}`, errs.ErrInvalidInput},
+		"no new blinding":      {`{"old": {"cumulative": "8", "blinding": "111"}}`, errs.ErrInvalidInput},
+		"unknown member":       {`{"new_blinding": "1", "epoch": 5}`, errs.ErrInvalidInput},
+		"blinding not a field": {`{"new_blinding": "0x"}`, errs.ErrInvalidInput},
+		"total past the bound": {`{"old": {"cumulative": "340282366920938463463374607431768211455", "blinding": "1"}, "new_blinding": "1"}`, errs.ErrInvalidBatch},
+	} {
+		if _, err := p.Assign(&second, json.RawMessage(tc.in)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package circuit
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"gnarking/canon"
+)
+
+// BatchID content-addresses a batch: the sha256 of the canonical JSON of its
+// public inputs in BatchIDJSON's form (see package canon). Proof headers
+// carry it.
+func BatchID(pub SettlementCircuitPublic) ([32]byte, error) {
+	b, err := BatchIDJSON(pub)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return canon.Hash(json.RawMessage(b))
+}
+
+// batchIDJSON is SettlementCircuitPublicJSON with the field values as plain
+// JSON numbers, the form public JSON had before FieldJSON.
+type batchIDJSON struct {
+	Recipient     string        `json:"recipient"`
+	KOld          json.Number   `json:"k_old"`
+	M             json.Number   `json:"m"`
+	TotalSettle   json.Number   `json:"total_settle"`
+	ChainID       json.Number   `json:"chain_id"`
+	PkX           string        `json:"pk_x"`
+	PkY           string        `json:"pk_y"`
+	BatchDataRoot string        `json:"batch_data_root"`
+	Extra         []json.Number `json:"extra,omitempty"`
+}
+
+// BatchIDJSON is the JSON BatchID hashes: pub's public JSON with k_old, m,
+// total_settle and chain_id as decimal numbers rather than strings, so a
+// batch keeps its ID whichever way its public JSON spells them.
+func BatchIDJSON(pub SettlementCircuitPublic) ([]byte, error) {
+	js, err := pub.jsonForm()
+	if err != nil {
+		return nil, err
+	}
+	num := func(f *FieldJSON) json.Number { return json.Number((*big.Int)(f).String()) }
+	var extra []json.Number
+	for i := range js.Extra {
+		extra = append(extra, num(&js.Extra[i]))
+	}
+	return json.Marshal(batchIDJSON{
+		Recipient:     js.Recipient,
+		KOld:          num(&js.KOld),
+		M:             num(&js.M),
+		TotalSettle:   num(&js.TotalSettle),
+		ChainID:       num(&js.ChainID),
+		PkX:           js.PkX,
+		PkY:           js.PkY,
+		BatchDataRoot: js.BatchDataRoot,
+		Extra:         extra,
+	})
+}
@@ -0,0 +1,212 @@
+package circuit
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/errs"
+)
+
+func TestBatchID(t *testing.T) {
+	pub := SettlementCircuitPublic{
+		Recipient:     big.NewInt(42),
+		KOld:          big.NewInt(0),
+		M:             big.NewInt(8),
+		TotalSettle:   big.NewInt(8),
+		ChainID:       big.NewInt(1),
+		BatchDataRoot: big.NewInt(3),
+	}
+	// fixed-width bytes as PublicKey.Assign leaves them
+	pub.Pk.A.X = append(make([]byte, 31), 1)
+	pub.Pk.A.Y = append(make([]byte, 31), 2)
+
+	id, err := BatchID(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same vector as canon/testdata/vectors.json "public inputs"
+	const want = "1e0304bc9c168fd1579a13285c5f39d7e289dbd382ff00a89708e405427fdaf9"
+	if got := hex.EncodeToString(id[:]); got != want {
+		t.Fatalf("batch ID %s, want %s", got, want)
+	}
+
+	// the ID survives a JSON round trip, i.e. the server sees the same one
+	data, err := pub.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back SettlementCircuitPublic
+	if err := back.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if id2, err := BatchID(back); err != nil || id2 != id {
+		t.Fatalf("batch ID after round trip %x, want %x (%v)", id2, id, err)
+	}
+
+	// and a witness round trip, i.e. a remote prover sees the same one
+	w, err := PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromWitness, err := PublicFromWitness(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id3, err := BatchID(fromWitness); err != nil || id3 != id {
+		t.Fatalf("batch ID from witness %x, want %x (%v)", id3, id, err)
+	}
+
+	// a variant's own inputs are part of the batch, through both round trips
+	pub.Extra = []frontend.Variable{big.NewInt(10), big.NewInt(7)}
+	withExtra, err := BatchID(pub)
+	if err != nil || withExtra == id {
+		t.Fatalf("batch ID with extra inputs %x (%v)", withExtra, err)
+	}
+	if data, err = pub.MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"extra":["10","7"]`) {
+		t.Fatalf("extra inputs not in the JSON: %s", data)
+	}
+	if err := back.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = PublicWitness(back); err != nil {
+		t.Fatal(err)
+	}
+	if fromWitness, err = PublicFromWitness(w); err != nil {
+		t.Fatal(err)
+	}
+	if id4, err := BatchID(fromWitness); err != nil || id4 != withExtra {
+		t.Fatalf("batch ID with extra inputs after round trips %x, want %x (%v)", id4, withExtra, err)
+	}
+}
+
+func TestPublicJSONFieldRange(t *testing.T) {
+	r := ecc.BN254.ScalarField()
+	top := new(big.Int).Sub(r, big.NewInt(1))
+	pub := SettlementCircuitPublic{
+		Recipient:     big.NewInt(42),
+		KOld:          new(big.Int).Lsh(big.NewInt(1), 64), // one past uint64
+		M:             top,
+		TotalSettle:   new(big.Int).Sub(r, big.NewInt(2)),
+		ChainID:       big.NewInt(1),
+		BatchDataRoot: big.NewInt(3),
+	}
+	pub.Pk.A.X = big.NewInt(1)
+	pub.Pk.A.Y = big.NewInt(2)
+
+	data, err := pub.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"m":"`+top.String()+`"`) {
+		t.Fatalf("m not a decimal string: %s", data)
+	}
+	var back SettlementCircuitPublic
+	if err := back.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range [][2]any{{back.KOld, pub.KOld}, {back.M, pub.M}, {back.TotalSettle, pub.TotalSettle}} {
+		if v[0].(*big.Int).Cmp(v[1].(*big.Int)) != 0 {
+			t.Fatalf("field %d: %v after round trip, want %v", i, v[0], v[1])
+		}
+	}
+
+	// r itself is not a field element: refused both ways, never reduced
+	pub.M = r
+	if _, err := pub.MarshalJSON(); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("marshal m = r: %v", err)
+	}
+	legacy := `{"recipient":"0x2a","k_old":0,"m":8,"total_settle":8,"chain_id":1,"pk_x":"01","pk_y":"02","batch_data_root":"0x03"}`
+	for _, tc := range []struct {
+		name, json string
+		ok         bool
+	}{
+		{"legacy numbers", legacy, true},
+		{"hex string", strings.Replace(legacy, `"m":8`, `"m":"0x`+top.Text(16)+`"`, 1), true},
+		{"number past uint64", strings.Replace(legacy, `"m":8`, `"m":`+top.String(), 1), true},
+		{"modulus", strings.Replace(legacy, `"m":8`, `"m":"`+r.String()+`"`, 1), false},
+		{"negative", strings.Replace(legacy, `"m":8`, `"m":-1`, 1), false},
+		{"fraction", strings.Replace(legacy, `"m":8`, `"m":"8.5"`, 1), false},
+	} {
+		var s SettlementCircuitPublic
+		err := s.UnmarshalJSON([]byte(tc.json))
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%s: %v, want ErrInvalidInput", tc.name, err)
+		}
+	}
+}
+
+func TestPublicJSONLayout(t *testing.T) {
+	full := `{"recipient":"42","k_old":"0","m":"8","total_settle":"8","chain_id":"1","pk_x":"01","pk_y":"02","batch_data_root":"0x03"}`
+	for _, tc := range []struct {
+		name, json string
+		want       []string // in the error
+	}{
+		{"missing", strings.Replace(full, `"m":"8",`, ``, 1), []string{"missing [m]", "unexpected []"}},
+		{"extra", strings.Replace(full, `}`, `,"nonce":"1"}`, 1), []string{"missing []", "unexpected [nonce]"}},
+		{"renamed", strings.Replace(full, `"pk_x"`, `"pkx"`, 1), []string{"missing [pk_x]", "unexpected [pkx]"}},
+		{"null", strings.Replace(full, `"m":"8"`, `"m":null`, 1), []string{"$.m: required, got null"}},
+		{"null hex", strings.Replace(full, `"pk_x":"01"`, `"pk_x":null`, 1), []string{"$.pk_x: required"}},
+		{"twice", strings.Replace(full, `}`, `,"m":"9"}`, 1), []string{"$.m is given twice"}},
+		{"number for hex", strings.Replace(full, `"recipient":"42"`, `"recipient":42`, 1), []string{"$.recipient: want a hex string"}},
+		{"bad hex", strings.Replace(full, `"pk_y":"02"`, `"pk_y":"0g"`, 1), []string{"$.pk_y: hex"}},
+		{"bad field", strings.Replace(full, `"total_settle":"8"`, `"total_settle":"8.5"`, 1), []string{"$.total_settle: \"8.5\" is not"}},
+		{"hex past r", strings.Replace(full, `"pk_x":"01"`, `"pk_x":"`+strings.Repeat("f", 64)+`"`, 1), []string{"$.pk_x:", "outside the scalar field"}},
+		{"null extra", strings.Replace(full, `}`, `,"extra":null}`, 1), []string{"$.extra: required, got null"}},
+		{"bad extra", strings.Replace(full, `}`, `,"extra":["1","x"]}`, 1), []string{"$.extra:"}},
+		{"not an object", `["recipient"]`, []string{"want an object"}},
+		{"trailing", full + `{}`, []string{"data after the object"}},
+	} {
+		var s SettlementCircuitPublic
+		err := s.UnmarshalJSON([]byte(tc.json))
+		if !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%s: %v, want ErrInvalidInput", tc.name, err)
+			continue
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: %q does not name %q", tc.name, err, w)
+			}
+		}
+	}
+
+	// set in code rather than parsed: unset fields are named
+	_, err := PublicWitness(SettlementCircuitPublic{Recipient: 1, M: 8})
+	if err == nil || !strings.Contains(err.Error(), "[k_old total_settle chain_id pk_x pk_y batch_data_root]") {
+		t.Fatalf("PublicWitness with unset fields: %v", err)
+	}
+}
+
+func TestDiffPublic(t *testing.T) {
+	a := SettlementCircuitPublic{Recipient: big.NewInt(42), KOld: 0, M: 8, TotalSettle: 8, ChainID: 1, BatchDataRoot: 3}
+	a.Pk.A.X, a.Pk.A.Y = big.NewInt(1), big.NewInt(2)
+	b := a
+	// same values, other Go types
+	b.Recipient, b.KOld, b.Pk.A.X = 42, big.NewInt(0), []byte{1}
+	if diff, err := DiffPublic(a, b); err != nil || len(diff) != 0 {
+		t.Fatalf("equal inputs: %v, %v", diff, err)
+	}
+	b.TotalSettle, b.BatchDataRoot = 9, 4
+	if diff, err := DiffPublic(a, b); err != nil || strings.Join(diff, " ") != "total_settle batch_data_root" {
+		t.Fatalf("diff %v, %v", diff, err)
+	}
+	a.Extra, b.Extra = []frontend.Variable{1, 2}, []frontend.Variable{1, 3}
+	if diff, err := DiffPublic(a, b); err != nil || strings.Join(diff, " ") != "total_settle batch_data_root extra[1]" {
+		t.Fatalf("diff %v, %v", diff, err)
+	}
+	b.Extra = nil
+	if diff, err := DiffPublic(a, b); err != nil || strings.Join(diff, " ") != "total_settle batch_data_root extra" {
+		t.Fatalf("diff %v, %v", diff, err)
+	}
+}
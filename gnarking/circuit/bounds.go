@@ -0,0 +1,231 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/cmp"
+
+	"gnarking/errs"
+)
+
+// MaxBoundBits is the widest bound: the bounded comparator needs the field
+// to be wider than the differences it compares.
+const MaxBoundBits = 252
+
+// Bounds are a deployment's bit widths for batch values, and its smallest
+// row size, read from its parameters file (LoadParams) and applied
+// everywhere the values are checked: the circuit range checks them and
+// orders nonces with a bounded comparator, Check refuses them natively, and
+// the POST /prove schema and the Solidity bounds check are generated from
+// them (ddm describe -format schema, ddm export). Setup records them in the
+// manifest.
+//
+// A zero width leaves that value unbounded: nonces are then compared over
+// the whole field, as circuits set up without a parameters file do. A zero
+// MinSize lets rows settle nothing.
+type Bounds struct {
+	NonceBits int `json:"nonce_bits"` // every nonce, KOld and M below 2^NonceBits
+	SizeBits  int `json:"size_bits"`  // every row size below 2^SizeBits
+	TotalBits int `json:"total_bits"` // TotalSettle below 2^TotalBits
+	// MinSize is the dust floor: every row of a batch settles at least
+	// this, so rows that settle nothing cannot burn nonces. Empty batches
+	// (EmptyBatches) are exempt.
+	MinSize uint64 `json:"min_size"`
+}
+
+// Params is a deployment parameters file: the value bounds, the decimal
+// places of sizes in batch JSON (0: integers in base units, as before
+// decimals) and, for a 2-of-2 profile (Cosign), the co-signer's key. Setup
+// records them in the manifest.
+type Params struct {
+	Bounds
+	SizeScale int    `json:"size_scale"`
+	Cosigner  string `json:"cosigner,omitempty"` // hex, see ParseCosigner
+}
+
+// LoadParams reads a deployment parameters file; unknown fields are an
+// error so a typo does not silently leave a value unbounded.
+func LoadParams(path string) (Params, error) {
+	var p Params
+	f, err := os.Open(path)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return p, fmt.Errorf("%w: parameters %s: %w", errs.ErrInvalidInput, path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("parameters %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p Params) Validate() error {
+	if p.SizeScale < 0 || p.SizeScale > MaxSizeScale {
+		return fmt.Errorf("%w: size_scale = %d outside [0, %d]", errs.ErrInvalidInput, p.SizeScale, MaxSizeScale)
+	}
+	if p.Cosigner != "" {
+		if _, err := ParseCosigner(p.Cosigner); err != nil {
+			return err
+		}
+	}
+	return p.Bounds.Validate()
+}
+
+// Apply is profile under p: its bounds and size scale, and its co-signer,
+// which only a Cosign profile takes.
+func (p Params) Apply(profile Profile) (Profile, error) {
+	if err := p.Validate(); err != nil {
+		return profile, err
+	}
+	profile.Bounds, profile.SizeScale = p.Bounds, p.SizeScale
+	if p.Cosigner == "" {
+		return profile, nil
+	}
+	if _, ok := profile.Variant.(Cosign); !ok {
+		return profile, fmt.Errorf("%w: cosigner given for profile %s, which has no co-signer", errs.ErrInvalidInput, profile.Name)
+	}
+	pk, err := ParseCosigner(p.Cosigner)
+	if err != nil {
+		return profile, err
+	}
+	profile.Variant = Cosign{Pk: pk}
+	return profile, nil
+}
+
+func (b Bounds) Validate() error {
+	for _, w := range []struct {
+		name string
+		bits int
+	}{{"nonce_bits", b.NonceBits}, {"size_bits", b.SizeBits}, {"total_bits", b.TotalBits}} {
+		if w.bits < 0 || w.bits > MaxBoundBits {
+			return fmt.Errorf("%w: %s = %d outside [0, %d]", errs.ErrInvalidInput, w.name, w.bits, MaxBoundBits)
+		}
+	}
+	if max := BoundMax(b.SizeBits); max != nil && max.Cmp(new(big.Int).SetUint64(b.MinSize)) < 0 {
+		return fmt.Errorf("%w: min_size = %d above the largest %d-bit size", errs.ErrInvalidInput, b.MinSize, b.SizeBits)
+	}
+	return nil
+}
+
+func (b Bounds) IsZero() bool { return b == Bounds{} }
+
+func (b Bounds) String() string {
+	width := func(bits int) string {
+		if bits == 0 {
+			return "field"
+		}
+		return fmt.Sprint(bits)
+	}
+	s := fmt.Sprintf("nonce %s, size %s, total %s bits", width(b.NonceBits), width(b.SizeBits), width(b.TotalBits))
+	if b.MinSize > 0 {
+		s += fmt.Sprintf(", min size %d", b.MinSize)
+	}
+	return s
+}
+
+// BoundMax is the largest value of a bits-wide bound, nil when unbounded.
+func BoundMax(bits int) *big.Int {
+	if bits == 0 {
+		return nil
+	}
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+}
+
+// Check is the native counterpart of the circuit's range checks, failing
+// with ErrInvalidBatch on the first value out of bounds.
+func (b Bounds) Check(kOld, total *big.Int, sizes, nonces []*big.Int) error {
+	check := func(name string, v *big.Int, bits int) error {
+		if bits > 0 && (v.Sign() < 0 || v.BitLen() > bits) {
+			return fmt.Errorf("%w: %s %s outside [0, 2^%d)", errs.ErrInvalidBatch, name, v, bits)
+		}
+		return nil
+	}
+	if err := check("k_old", kOld, b.NonceBits); err != nil {
+		return err
+	}
+	if err := check("total", total, b.TotalBits); err != nil {
+		return err
+	}
+	empty := true // every row at KOld, as only an empty batch has them
+	for i := range sizes {
+		if err := check(fmt.Sprintf("row %d size", i), sizes[i], b.SizeBits); err != nil {
+			return err
+		}
+		if err := check(fmt.Sprintf("row %d nonce", i), nonces[i], b.NonceBits); err != nil {
+			return err
+		}
+		empty = empty && nonces[i].Cmp(kOld) == 0
+	}
+	if b.MinSize == 0 || empty {
+		return nil
+	}
+	for i := range sizes {
+		if sizes[i].Cmp(new(big.Int).SetUint64(b.MinSize)) < 0 {
+			return fmt.Errorf("%w: row %d size %s below the minimum %d", errs.ErrInvalidBatch, i, sizes[i], b.MinSize)
+		}
+	}
+	return nil
+}
+
+// assertBounds range checks the batch values b bounds. M needs no check of
+// its own: the orderings tie it to a nonce.
+func assertBounds(api frontend.API, b Bounds, kOld, total frontend.Variable, size, nonce []frontend.Variable) {
+	if b.NonceBits > 0 {
+		api.ToBinary(kOld, b.NonceBits)
+		for i := range nonce {
+			api.ToBinary(nonce[i], b.NonceBits)
+		}
+	}
+	if b.SizeBits > 0 {
+		for i := range size {
+			api.ToBinary(size[i], b.SizeBits)
+		}
+	}
+	if b.TotalBits > 0 {
+		api.ToBinary(total, b.TotalBits)
+	}
+}
+
+// assertMinSize asserts every row size is at least b.MinSize, except in an
+// empty batch (empty is 1; nil without EmptyBatches): with bounded sizes
+// Size - MinSize must fit SizeBits, which a row below the minimum wraps
+// past, else the sizes are compared over the whole field.
+func assertMinSize(api frontend.API, b Bounds, empty frontend.Variable, size []frontend.Variable) {
+	if b.MinSize == 0 {
+		return
+	}
+	for i := range size {
+		s := size[i]
+		if empty != nil {
+			s = api.Select(empty, b.MinSize, s)
+		}
+		if b.SizeBits > 0 {
+			api.ToBinary(api.Sub(s, b.MinSize), b.SizeBits)
+		} else {
+			api.AssertIsLessOrEqual(b.MinSize, s)
+		}
+	}
+}
+
+// nonceLess asserts a < b on nonces: over the whole field, or with one
+// NonceBits-wide decomposition once assertBounds range checked them.
+type nonceLess func(a, b frontend.Variable)
+
+func newNonceLess(api frontend.API, b Bounds) nonceLess {
+	if b.NonceBits == 0 {
+		return func(x, y frontend.Variable) {
+			api.AssertIsLessOrEqual(x, y)
+			api.AssertIsDifferent(x, y)
+		}
+	}
+	bc := cmp.NewBoundedComparator(api, BoundMax(b.NonceBits), false)
+	return bc.AssertIsLess
+}
@@ -0,0 +1,165 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+func TestLoadParams(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		data string
+		want Params
+		ok   bool
+	}{
+		{`{"nonce_bits": 40, "size_bits": 32, "total_bits": 48}`, Params{Bounds: Bounds{NonceBits: 40, SizeBits: 32, TotalBits: 48}}, true},
+		{`{"size_bits": 16, "min_size": 100}`, Params{Bounds: Bounds{SizeBits: 16, MinSize: 100}}, true},
+		{`{"size_bits": 4, "min_size": 16}`, Params{}, false}, // no 4-bit size reaches it
+		{`{"size_bits": 16}`, Params{Bounds: Bounds{SizeBits: 16}}, true},
+		{`{"size_bits": 64, "size_scale": 6}`, Params{Bounds: Bounds{SizeBits: 64}, SizeScale: 6}, true},
+		{`{}`, Params{}, true},
+		{`{"nonce_bit": 40}`, Params{}, false}, // typo
+		{`{"nonce_bits": 253}`, Params{}, false},
+		{`{"total_bits": -1}`, Params{}, false},
+		{`{"size_scale": 19}`, Params{}, false},
+	} {
+		path := filepath.Join(dir, "params.json")
+		if err := os.WriteFile(path, []byte(tc.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		p, err := LoadParams(path)
+		if !tc.ok {
+			if !errors.Is(err, errs.ErrInvalidInput) {
+				t.Errorf("%s: err = %v, want ErrInvalidInput", tc.data, err)
+			}
+			continue
+		}
+		if err != nil || p != tc.want {
+			t.Errorf("%s: got %+v, %v, want %+v", tc.data, p, err, tc.want)
+		}
+	}
+}
+
+func TestBoundsCheck(t *testing.T) {
+	b := Bounds{NonceBits: 8, SizeBits: 4, TotalBits: 6}
+	ints := func(vs ...int64) []*big.Int {
+		out := make([]*big.Int, len(vs))
+		for i, v := range vs {
+			out[i] = big.NewInt(v)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name          string
+		kOld, total   int64
+		sizes, nonces []int64
+		ok            bool
+	}{
+		{"in range", 0, 30, []int64{15, 15}, []int64{1, 255}, true},
+		{"k_old", 256, 2, []int64{1, 1}, []int64{1, 2}, false},
+		{"size", 0, 17, []int64{16, 1}, []int64{1, 2}, false},
+		{"nonce", 0, 2, []int64{1, 1}, []int64{1, 256}, false},
+		{"total", 0, 64, []int64{15, 15}, []int64{1, 2}, false},
+	} {
+		err := b.Check(big.NewInt(tc.kOld), big.NewInt(tc.total), ints(tc.sizes...), ints(tc.nonces...))
+		if tc.ok != (err == nil) || (err != nil && !errors.Is(err, errs.ErrInvalidBatch)) {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+	if err := (Bounds{}).Check(new(big.Int).Lsh(big.NewInt(1), 200), big.NewInt(0), nil, nil); err != nil {
+		t.Errorf("zero bounds: %v", err)
+	}
+
+	floor := Bounds{MinSize: 5}
+	if err := floor.Check(big.NewInt(0), big.NewInt(11), ints(5, 6), ints(1, 2)); err != nil {
+		t.Errorf("at the floor: %v", err)
+	}
+	if err := floor.Check(big.NewInt(0), big.NewInt(10), ints(6, 4), ints(1, 2)); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("below the floor: %v", err)
+	}
+	if err := floor.Check(big.NewInt(7), big.NewInt(0), ints(0, 0), ints(7, 7)); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+}
+
+// TestSettlementCircuit_MinSize solves the settlement circuit with a row
+// size floor, over bounded and unbounded sizes: a row below it fails, an
+// empty batch's zero rows do not.
+func TestSettlementCircuit_MinSize(t *testing.T) {
+	assert := test.NewAssert(t)
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	field := ecc.BN254.ScalarField()
+	nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	for _, b := range []Bounds{{MinSize: 3}, {SizeBits: 8, MinSize: 3}} {
+		circuit := func() *SettlementCircuit {
+			c := NewSettlementCircuit(N)
+			c.Bounds, c.EmptyBatches = b, true
+			return c
+		}
+		valid := signedSettlement(assert, priv, MsgV1, 0, []int64{3, 3, 4, 5, 6, 7, 8, 255}, nonces)
+		assert.NoError(test.IsSolved(circuit(), &valid, field), "%s", b)
+		dust := signedSettlement(assert, priv, MsgV1, 0, []int64{3, 3, 4, 5, 6, 7, 8, 2}, nonces)
+		if test.IsSolved(circuit(), &dust, field) == nil {
+			t.Errorf("%s: row below the floor accepted", b)
+		}
+		empty := signedSettlement(assert, priv, MsgV1, 4, make([]int64, N), []int64{4, 4, 4, 4, 4, 4, 4, 4})
+		assert.NoError(test.IsSolved(circuit(), &empty, field), "%s: empty batch", b)
+	}
+}
+
+// TestSettlementCircuit_Bounds solves the settlement circuit with bounds:
+// values within them prove, values beyond them, which the unbounded circuit
+// accepts, do not.
+func TestSettlementCircuit_Bounds(t *testing.T) {
+	assert := test.NewAssert(t)
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	b := Bounds{NonceBits: 16, SizeBits: 8, TotalBits: 10}
+	sizes := []int64{1, 2, 3, 4, 5, 6, 7, 255}
+	bounded := func() *SettlementCircuit {
+		c := NewSettlementCircuit(N)
+		c.Bounds = b
+		return c
+	}
+	field := ecc.BN254.ScalarField()
+
+	valid := signedSettlement(assert, priv, MsgV1, 0, sizes, []int64{1, 2, 3, 4, 5, 6, 7, 65535})
+	assert.NoError(test.IsSolved(bounded(), &valid, field))
+
+	for name, w := range map[string]SettlementCircuit{
+		"nonce": signedSettlement(assert, priv, MsgV1, 0, sizes, []int64{1, 2, 3, 4, 5, 6, 7, 65536}),
+		"size":  signedSettlement(assert, priv, MsgV1, 0, []int64{1, 2, 3, 4, 5, 6, 7, 256}, []int64{1, 2, 3, 4, 5, 6, 7, 8}),
+		"total": signedSettlement(assert, priv, MsgV1, 0, []int64{255, 255, 255, 255, 1, 1, 1, 1}, []int64{1, 2, 3, 4, 5, 6, 7, 8}),
+	} {
+		if test.IsSolved(bounded(), &w, field) == nil {
+			t.Errorf("%s out of bounds accepted", name)
+		}
+		assert.NoError(test.IsSolved(NewSettlementCircuit(N), &w, field), "unbounded circuit rejects %s", name)
+	}
+
+	// one 16-bit decomposition per nonce replaces a full-width comparison
+	count := func(c frontend.Circuit) int {
+		ccs, err := frontend.Compile(field, r1cs.NewBuilder, c)
+		assert.NoError(err)
+		return ccs.GetNbConstraints()
+	}
+	if nb, nu := count(bounded()), count(NewSettlementCircuit(N)); nb >= nu {
+		t.Errorf("bounded circuit has %d constraints, unbounded %d", nb, nu)
+	}
+}
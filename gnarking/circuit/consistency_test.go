@@ -0,0 +1,155 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+// hashCase is one hash with its in-circuit and native implementations,
+// which must agree on every input.
+type hashCase struct {
+	name    string
+	curve   ecc.ID
+	inputs  int
+	bits    int // input bound, the full field when 0
+	circuit func(api frontend.API, in []frontend.Variable) (frontend.Variable, error)
+	native  func(in []*big.Int) (*big.Int, error)
+}
+
+// hashCircuit wraps one hashCase: Out is the hash of In.
+type hashCircuit struct {
+	In  []frontend.Variable
+	Out frontend.Variable
+	h   *hashCase `gnark:"-"`
+}
+
+func (c *hashCircuit) Define(api frontend.API) error {
+	out, err := c.h.circuit(api, c.In)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(out, c.Out)
+	return nil
+}
+
+// msgVersions and dataHashes enumerate what the parsers accept, so a new
+// format is covered as soon as it can be selected.
+func msgVersions() []MsgVersion {
+	var vs []MsgVersion
+	for v := MsgVersion(0); ; v++ {
+		if _, err := ParseMsgVersion(v.String()); err != nil {
+			return vs
+		}
+		vs = append(vs, v)
+	}
+}
+
+func dataHashes() []DataHash {
+	var hs []DataHash
+	for h := DataHash(0); ; h++ {
+		if _, err := ParseDataHash(h.String()); err != nil {
+			return hs
+		}
+		hs = append(hs, h)
+	}
+}
+
+// hashCases is every message format and data hash on every curve with a
+// native implementation (only BN254: the native side is bn254's MiMC).
+func hashCases() []hashCase {
+	var cases []hashCase
+	for _, curve := range []ecc.ID{ecc.BN254} {
+		for _, v := range msgVersions() {
+			// recipient, size, nonce, chain ID
+			cases = append(cases, hashCase{
+				name:   fmt.Sprintf("msg-%s/%s", v, curve),
+				curve:  curve,
+				inputs: 4,
+				circuit: func(api frontend.API, in []frontend.Variable) (frontend.Variable, error) {
+					m, err := newMsgHasher(api, v, in[0], in[3])
+					if err != nil {
+						return nil, err
+					}
+					return m.sum(in[1], in[2], in[3])
+				},
+				native: func(in []*big.Int) (*big.Int, error) {
+					return new(big.Int).SetBytes(MsgHash(v, in[0], in[1], in[2], in[3])), nil
+				},
+			})
+		}
+		for _, h := range dataHashes() {
+			// three rows of (size, nonce)
+			c := hashCase{
+				name:   fmt.Sprintf("data-%s/%s", h, curve),
+				curve:  curve,
+				inputs: 6,
+				circuit: func(api frontend.API, in []frontend.Variable) (frontend.Variable, error) {
+					return batchDataRoot(api, h, []frontend.Variable{in[0], in[2], in[4]}, []frontend.Variable{in[1], in[3], in[5]})
+				},
+				native: func(in []*big.Int) (*big.Int, error) {
+					return BatchDataRoot(h, []*big.Int{in[0], in[2], in[4]}, []*big.Int{in[1], in[3], in[5]})
+				},
+			}
+			if h == DataHashKeccak {
+				c.bits = 64
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases
+}
+
+// TestHashConsistency hashes random inputs natively and in a circuit
+// holding nothing but the hash, for every hashCase: a native helper that
+// drifts from its gadget would produce batches no proof can be made for.
+func TestHashConsistency(t *testing.T) {
+	samples := 8
+	if testing.Short() {
+		samples = 2
+	}
+	for _, hc := range hashCases() {
+		t.Run(hc.name, func(t *testing.T) {
+			bound := hc.curve.ScalarField()
+			if hc.bits > 0 {
+				bound = new(big.Int).Lsh(big.NewInt(1), uint(hc.bits))
+			}
+			for s := range samples {
+				in := make([]*big.Int, hc.inputs)
+				for i := range in {
+					v, err := rand.Int(rand.Reader, bound)
+					if err != nil {
+						t.Fatal(err)
+					}
+					in[i] = v
+				}
+				// the edges of the input range, once
+				if s == 0 {
+					in[0] = new(big.Int)
+					in[1] = new(big.Int).Sub(bound, big.NewInt(1))
+				}
+				want, err := hc.native(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assignment := &hashCircuit{In: make([]frontend.Variable, hc.inputs), Out: want}
+				for i, v := range in {
+					assignment.In[i] = v
+				}
+				if err := test.IsSolved(&hashCircuit{In: make([]frontend.Variable, hc.inputs), h: &hc}, assignment, hc.curve.ScalarField()); err != nil {
+					t.Fatalf("inputs %v: in-circuit hash differs from native %x: %v", in, want, err)
+				}
+				assignment.Out = new(big.Int).Add(want, big.NewInt(1))
+				if test.IsSolved(&hashCircuit{In: make([]frontend.Variable, hc.inputs), h: &hc}, assignment, hc.curve.ScalarField()) == nil {
+					t.Fatalf("inputs %v: circuit accepts a wrong hash", in)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package circuit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/native/twistededwards"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"gnarking/errs"
+)
+
+// CosignPublic is CosignCircuit's own public inputs, after
+// SettlementCircuitPublic's: the co-signer's key, bound as Pk is, so the
+// contract pins which co-signer approved the batch.
+type CosignPublic struct {
+	CoPkX frontend.Variable `gnark:",public"`
+	CoPkY frontend.Variable `gnark:",public"`
+}
+
+// CosignCircuit is SettlementCircuit for 2-of-2 rows: every row is signed
+// by Pk (the operator) and by CoPk (e.g. a risk engine), both over the
+// row's one message, so neither key alone settles anything. CoPk is
+// compiled in, so a setup serves the one co-signer its deployment names,
+// and X is asserted to be it. Pk and CoPk must differ; an operator signing
+// with the co-signer's key gets a batch it cannot prove rather than a
+// 1-of-1 in disguise.
+type CosignCircuit struct {
+	P     SettlementCircuitPublic
+	X     CosignPublic
+	Size  []frontend.Variable
+	Nonce []frontend.Variable
+	Sig   []stdEddsa.Signature
+	CoSig []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+	CoPk         [32]byte   `gnark:"-"` // compressed EdDSA key, see Cosign
+}
+
+// NewCosignCircuit allocates the rows of an n-row batch.
+func NewCosignCircuit(n int) *CosignCircuit {
+	s := NewSettlementCircuit(n)
+	return &CosignCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig, CoSig: make([]stdEddsa.Signature, n)}
+}
+
+func (c *CosignCircuit) Define(api frontend.API) error {
+	coX, coY, err := cosignerPoint(c.CoPk)
+	if err != nil {
+		return err
+	}
+	// 0a. X is CoPk
+	api.AssertIsEqual(c.X.CoPkX, coX)
+	api.AssertIsEqual(c.X.CoPkY, coY)
+
+	// 0b. Pk != CoPk
+	sameX := api.IsZero(api.Sub(c.P.Pk.A.X, coX))
+	sameY := api.IsZero(api.Sub(c.P.Pk.A.Y, coY))
+	api.AssertIsEqual(api.And(sameX, sameY), 0)
+
+	// 1-6. the settlement constraints, then 7. CoSig[i] signs the message
+	//      Sig[i] does, under CoPk
+	inner := SettlementCircuit{
+		P:            c.P,
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+		rowsSigned: func(api frontend.API, msgs []frontend.Variable) error {
+			pk, sigs := eddsaVars(stdEddsa.PublicKey{A: twistededwards.Point{X: coX, Y: coY}}, c.CoSig)
+			return EdDSA{}.AssertRows(api, pk, sigs, msgs)
+		},
+	}
+	return inner.Define(api)
+}
+
+// cosignerPoint is the affine point of a compressed co-signer key.
+func cosignerPoint(pk [32]byte) (x, y *big.Int, err error) {
+	if pk == [32]byte{} {
+		return nil, nil, fmt.Errorf("%w: no co-signer key: set cosigner in the deployment parameters", errs.ErrInvalidInput)
+	}
+	var key bnEddsa.PublicKey
+	if _, err := key.SetBytes(pk[:]); err != nil {
+		return nil, nil, fmt.Errorf("%w: co-signer key: %w", errs.ErrInvalidInput, err)
+	}
+	return key.A.X.BigInt(new(big.Int)), key.A.Y.BigInt(new(big.Int)), nil
+}
+
+// ParseCosigner reads a co-signer key, 32-byte compressed EdDSA hex as
+// ddm keys prints it.
+func ParseCosigner(s string) ([32]byte, error) {
+	var pk [32]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(pk) {
+		return pk, fmt.Errorf("%w: cosigner: want %d bytes of hex", errs.ErrInvalidInput, len(pk))
+	}
+	copy(pk[:], b)
+	if _, _, err := cosignerPoint(pk); err != nil {
+		return pk, err
+	}
+	return pk, nil
+}
+
+// Cosign is the Variant proving CosignCircuit under Pk, the co-signer's
+// compressed key. Profile "cosign-8" is the built-in one, its key a
+// deployment's: the parameters file's "cosigner" (Params.Apply), which
+// setup records in the manifest. A batch's variant inputs are the
+// co-signatures in row order, {"sigs": ["<hex>", ...]}, as package cosign
+// writes them; co_pk_x and co_pk_y follow the PublicFields.
+type Cosign struct {
+	Pk [32]byte
+}
+
+// CosignInputs is a co-signed batch's variant inputs.
+type CosignInputs struct {
+	Sigs []string `json:"sigs"`
+}
+
+// Cosigner is the hex key of p's co-signer, empty unless p is a Cosign
+// profile with one set.
+func (p Profile) Cosigner() string {
+	if v, ok := p.Variant.(Cosign); ok && v.Pk != [32]byte{} {
+		return hex.EncodeToString(v.Pk[:])
+	}
+	return ""
+}
+
+func (v Cosign) circuit(p Profile) *CosignCircuit {
+	c := NewCosignCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches, c.CoPk = p.EmptyBatches, v.Pk
+	return c
+}
+
+func (v Cosign) Define(p Profile) frontend.Circuit { return v.circuit(p) }
+
+// WitnessFromBatch checks every co-signature natively, so a batch the
+// co-signer did not approve is errs.ErrInvalidBatch before it reaches the
+// solver.
+func (v Cosign) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	if err != nil || len(raw) != 1 || raw["sigs"] == nil {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"sigs": [...]}`, errs.ErrInvalidInput)
+	}
+	var in CosignInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(in.Sigs) != len(base.Size) {
+		return nil, fmt.Errorf("%w: %d co-signatures for %d rows", errs.ErrInvalidBatch, len(in.Sigs), len(base.Size))
+	}
+	coX, coY, err := cosignerPoint(v.Pk)
+	if err != nil {
+		return nil, err
+	}
+	head, err := fieldInts(base.P.Recipient, base.P.ChainID, base.P.Pk.A.X, base.P.Pk.A.Y)
+	if err != nil {
+		return nil, err
+	}
+	if head[2].Cmp(coX) == 0 && head[3].Cmp(coY) == 0 {
+		return nil, fmt.Errorf("%w: the batch is signed with the co-signer's own key", errs.ErrPolicyRejected)
+	}
+	c := v.circuit(p)
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	c.X.CoPkX, c.X.CoPkY = coX, coY
+	for i, h := range in.Sigs {
+		row, err := fieldInts(base.Size[i], base.Nonce[i])
+		if err != nil {
+			return nil, err
+		}
+		sig, err := hex.DecodeString(strings.TrimPrefix(h, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d co-signature hex: %w", errs.ErrInvalidInput, i, err)
+		}
+		msg := MsgHash(p.Msg, head[0], row[0], row[1], head[1])
+		if err := (EdDSA{}).Verify(v.Pk[:], sig, msg); err != nil {
+			return nil, fmt.Errorf("%w: row %d: co-signature: %w", errs.ErrInvalidBatch, i, err)
+		}
+		c.CoSig[i].Assign(te.BN254, sig)
+	}
+	return c, nil
+}
+
+func (Cosign) PublicLayout(p Profile, base Layout) (Layout, error) {
+	return base.Append(
+		PublicInput{Name: "co_pk_x", Type: "field", Field: "X.CoPkX", Doc: "co-signer's EdDSA key, x on babyjubjub, the one the setup compiled in"},
+		PublicInput{Name: "co_pk_y", Type: "field", Field: "X.CoPkY", Doc: "co-signer's EdDSA key, y on babyjubjub"},
+	), nil
+}
+
+func (Cosign) feature() Features { return FeatureCosign }
+
+// fieldInts reads assigned variables back as integers.
+func fieldInts(vs ...frontend.Variable) ([]*big.Int, error) {
+	out := make([]*big.Int, len(vs))
+	for i, v := range vs {
+		var e fr.Element
+		if _, err := e.SetInterface(v); err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+		}
+		out[i] = e.BigInt(new(big.Int))
+	}
+	return out, nil
+}
@@ -0,0 +1,153 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/signature"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+func cosignProfile(assert *test.Assert, co signature.Signer) Profile {
+	p, err := LookupProfile("cosign-8")
+	assert.NoError(err)
+	p, err = Params{Cosigner: hex.EncodeToString(co.Public().Bytes())}.Apply(p)
+	assert.NoError(err)
+	return p
+}
+
+// cosignPublic is the public inputs X of a Cosign circuit co-signed by co.
+func cosignPublic(assert *test.Assert, co signature.Signer) CosignPublic {
+	var pk [32]byte
+	copy(pk[:], co.Public().Bytes())
+	x, y, err := cosignerPoint(pk)
+	assert.NoError(err)
+	return CosignPublic{CoPkX: x, CoPkY: y}
+}
+
+func TestCosignCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	operator, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	risk, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	sizes, nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}, []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	s := signedSettlement(assert, operator, MsgV1, 0, sizes, nonces)
+	// the same rows signed by the co-signer
+	co := signedSettlement(assert, risk, MsgV1, 0, sizes, nonces)
+
+	p := cosignProfile(assert, risk)
+	assign := func(coSigs []stdEddsa.Signature) *CosignCircuit {
+		c := p.Define().(*CosignCircuit)
+		c.P, c.Size, c.Nonce, c.Sig, c.CoSig = s.P, s.Size, s.Nonce, s.Sig, coSigs
+		c.X = cosignPublic(assert, risk)
+		return c
+	}
+	valid := assign(co.Sig)
+	// the right co-signatures, another co-signer's key public
+	claimed := assign(co.Sig)
+	claimed.X = cosignPublic(assert, operator)
+	// one co-signature over another row's message
+	swapped := assign(append(co.Sig[:0:0], co.Sig...))
+	swapped.CoSig[0], swapped.CoSig[1] = swapped.CoSig[1], swapped.CoSig[0]
+	// the co-signer's key compiled in, the operator's signatures given
+	forged := assign(s.Sig)
+	// the co-signer approved another size for row 0
+	other := signedSettlement(assert, risk, MsgV1, 0, append([]int64{9}, sizes[1:]...), nonces)
+	tampered := assign(append(other.Sig[:1:1], co.Sig[1:]...))
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(valid),
+		test.WithInvalidAssignment(claimed),
+		test.WithInvalidAssignment(swapped),
+		test.WithInvalidAssignment(forged),
+		test.WithInvalidAssignment(tampered),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	// one key compiled in as the co-signer and signing as the operator
+	single := cosignProfile(assert, operator)
+	c := single.Define().(*CosignCircuit)
+	c.P, c.Size, c.Nonce, c.Sig, c.CoSig = s.P, s.Size, s.Nonce, s.Sig, s.Sig
+	c.X = cosignPublic(assert, operator)
+	assert.Error(test.IsSolved(single.Define(), c, ecc.BN254.ScalarField()))
+}
+
+// TestCosignProfile proves through the built-in profile, as the servers
+// and settlement_demo do: the co-signer from the deployment parameters,
+// the co-signatures the batch's variant inputs.
+func TestCosignProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	operator, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	risk, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	p := cosignProfile(assert, risk)
+	assert.Equal(FeatureCosign, p.Features())
+	assert.Equal(hex.EncodeToString(risk.Public().Bytes()), p.Cosigner())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(PublicFields[0], l[0].Name)
+	assert.Equal(len(PublicFields)+2, len(l))
+	assert.Equal("co_pk_x", l[len(PublicFields)].Name)
+	assert.Equal("co_pk_y", l[len(PublicFields)+1].Name)
+
+	// a co-signer only fits a Cosign profile
+	plain, err := LookupProfile(DefaultProfile)
+	assert.NoError(err)
+	if _, err := (Params{Cosigner: p.Cosigner()}).Apply(plain); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("cosigner for profile %s: %v", plain.Name, err)
+	}
+	if _, err := ParseCosigner(hex.EncodeToString(make([]byte, 32))); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("zero cosigner: %v", err)
+	}
+
+	sizes, nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}, []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	s := signedSettlement(assert, operator, MsgV1, 0, sizes, nonces)
+	cosigs := func(signer signature.Signer) json.RawMessage {
+		in := CosignInputs{}
+		for i := range sizes {
+			sig, err := EdDSA{}.Sign(signer, MsgHash(MsgV1, big.NewInt(42), big.NewInt(sizes[i]), big.NewInt(nonces[i]), big.NewInt(1)))
+			assert.NoError(err)
+			in.Sigs = append(in.Sigs, hex.EncodeToString(sig))
+		}
+		b, err := json.Marshal(in)
+		assert.NoError(err)
+		return b
+	}
+	full, err := p.Assign(&s, cosigs(risk))
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(p.Define(), full, ecc.BN254.ScalarField()))
+	// the co-signer's key is public, after the settlement inputs
+	assert.Equal(cosignPublic(assert, risk), full.(*CosignCircuit).X)
+
+	if _, err := p.Assign(&s, cosigs(operator)); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("co-signatures under another key: %v", err)
+	}
+	if _, err := cosignProfile(assert, operator).Assign(&s, cosigs(operator)); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Errorf("operator as co-signer: %v", err)
+	}
+	for _, in := range []string{``, `{}`, `{"sigs": []}`, `{"sigs": [], "pk": ""}`} {
+		if _, err := p.Assign(&s, json.RawMessage(in)); err == nil {
+			t.Errorf("variant inputs %q accepted", in)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"gnarking/errs"
+)
+
+// NChains is the number of allowed chain IDs in a cross-chain batch.
+const NChains = 4
+
+// CrossChainPublic is CrossChainSettlementCircuit's own public inputs,
+// after SettlementCircuitPublic's, whose ChainID is the first allowed
+// chain: ChainIDs are the others, pairwise distinct with it, and
+// ChainTotals[j] what the rows of allowed chain j settle, P.ChainID's
+// first. Unused slots carry an ID no row uses and a zero total.
+type CrossChainPublic struct {
+	ChainIDs    [NChains - 1]frontend.Variable `gnark:",public"`
+	ChainTotals [NChains]frontend.Variable     `gnark:",public"`
+}
+
+// CrossChainSettlementCircuit is SettlementCircuit with a per-row ChainID:
+//   - every ChainID[i] is one of the allowed chains, P.ChainID and X.ChainIDs
+//   - ChainTotals[j] == SUM(Size[i] where ChainID[i] is allowed chain j)
+//   - msg_i is the Msg version's message over ChainID[i], e.g. MsgV1's
+//     MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID[i])
+//   - BatchDataRoot over (Size, Nonce, ChainID) rows
+//
+// OrderingPermuted is not supported: its sort carries (Size, Nonce) only;
+// nor are empty batches, whose rows would have no chain to settle on.
+type CrossChainSettlementCircuit struct {
+	P       SettlementCircuitPublic
+	X       CrossChainPublic
+	Size    []frontend.Variable
+	Nonce   []frontend.Variable
+	ChainID []frontend.Variable
+	Sig     []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"` // nil means EdDSA
+	Bounds       Bounds     `gnark:"-"` // zero: unbounded
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewCrossChainSettlementCircuit allocates the rows of an n-row batch.
+func NewCrossChainSettlementCircuit(n int) *CrossChainSettlementCircuit {
+	s := NewSettlementCircuit(n)
+	return &CrossChainSettlementCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig, ChainID: make([]frontend.Variable, n)}
+}
+
+// CrossChainCircuit returns p's CrossChainSettlementCircuit, rows allocated
+// and config set, as Circuit does for SettlementCircuit.
+func (p Profile) CrossChainCircuit() *CrossChainSettlementCircuit {
+	c := NewCrossChainSettlementCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+// chains is the allowed chain IDs, P.ChainID first.
+func (c *CrossChainSettlementCircuit) chains() [NChains]frontend.Variable {
+	var ids [NChains]frontend.Variable
+	ids[0] = c.P.ChainID
+	copy(ids[1:], c.X.ChainIDs[:])
+	return ids
+}
+
+func (c *CrossChainSettlementCircuit) Define(api frontend.API) error {
+	n := len(c.Size)
+	if n == 0 || len(c.Nonce) != n || len(c.ChainID) != n || len(c.Sig) != n {
+		return fmt.Errorf("cross-chain circuit rows: %d sizes, %d nonces, %d chain IDs, %d signatures", n, len(c.Nonce), len(c.ChainID), len(c.Sig))
+	}
+	if c.EmptyBatches {
+		return fmt.Errorf("empty batches are not supported for a cross-chain batch")
+	}
+	chains := c.chains()
+
+	// 1. allowed chain IDs are pairwise distinct, so a row selects exactly one
+	for j := 0; j < NChains; j++ {
+		for k := j + 1; k < NChains; k++ {
+			api.AssertIsDifferent(chains[j], chains[k])
+		}
+	}
+
+	// 2. selector sel[i][j] = (ChainID[i] == chains[j]), SUM_j sel[i][j] == 1
+	//    and ChainTotals[j] == SUM_i sel[i][j] * Size[i]
+	var chainSum [NChains]frontend.Variable
+	for j := range chainSum {
+		chainSum[j] = 0
+	}
+	sum := frontend.Variable(0)
+	for i := 0; i < n; i++ {
+		hits := frontend.Variable(0)
+		for j := 0; j < NChains; j++ {
+			sel := api.IsZero(api.Sub(c.ChainID[i], chains[j]))
+			hits = api.Add(hits, sel)
+			chainSum[j] = api.Add(chainSum[j], api.Mul(sel, c.Size[i]))
+		}
+		api.AssertIsEqual(hits, 1)
+		sum = api.Add(sum, c.Size[i])
+	}
+	for j := 0; j < NChains; j++ {
+		api.AssertIsEqual(chainSum[j], c.X.ChainTotals[j])
+	}
+
+	// 3. SUM(Size[i]) == TotalSettle
+	api.AssertIsEqual(sum, c.P.TotalSettle)
+
+	// 3b. every value within the deployment's Bounds, if it sets any
+	assertBounds(api, c.Bounds, c.P.KOld, c.P.TotalSettle, c.Size, c.Nonce)
+	assertMinSize(api, c.Bounds, nil, c.Size)
+	less := newNonceLess(api, c.Bounds)
+
+	// 4. KOld < Nonce[0] < ... < Nonce[n-1] == M, or unique IDs
+	switch c.Ordering {
+	case OrderingMonotonic:
+		assertNonceOrder(less, api, c.P.KOld, c.P.M, c.Nonce)
+	case OrderingUnique:
+		if err := assertUniqueIDs(less, api, c.P.KOld, c.P.M, c.Nonce); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported ordering %s for a cross-chain batch", c.Ordering)
+	}
+
+	// 5. BatchDataRoot == H(Size[0], Nonce[0], ChainID[0], ...)
+	root, err := batchDataRoot(api, c.DataHash, c.Size, c.Nonce, c.ChainID)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(root, c.P.BatchDataRoot)
+
+	// 6. each row signed over its own chain ID
+	// MsgV1 absorbs ChainID per row, after the shared prefix; MsgV2 and
+	// MsgSHA256 bind it in the prefix, so each row hashes its own
+	hasher, err := newMsgHasher(api, c.Msg, c.P.Recipient, c.ChainID[0])
+	if err != nil {
+		return err
+	}
+	msgs := make([]frontend.Variable, n)
+	for i := 0; i < n; i++ {
+		if i > 0 && c.Msg != MsgV1 {
+			if hasher, err = newMsgHasher(api, c.Msg, c.P.Recipient, c.ChainID[i]); err != nil {
+				return err
+			}
+		}
+		if msgs[i], err = hasher.sum(c.Size[i], c.Nonce[i], c.ChainID[i]); err != nil {
+			return err
+		}
+	}
+	pk, sigs := eddsaVars(c.P.Pk, c.Sig)
+	return sigScheme(c.Scheme).AssertRows(api, pk, sigs, msgs)
+}
+
+// ChainTotals is the native counterpart of the in-circuit per-chain totals.
+func ChainTotals(chainIDs [NChains]*big.Int, sizes, rowChainIDs []*big.Int) ([NChains]*big.Int, error) {
+	var totals [NChains]*big.Int
+	for j := range totals {
+		totals[j] = new(big.Int)
+	}
+	if len(sizes) != len(rowChainIDs) {
+		return totals, fmt.Errorf("%w: sizes/chain IDs length mismatch: %d != %d", errs.ErrInvalidBatch, len(sizes), len(rowChainIDs))
+	}
+	for i := range sizes {
+		found := false
+		for j, id := range chainIDs {
+			if id.Cmp(rowChainIDs[i]) == 0 {
+				totals[j].Add(totals[j], sizes[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return totals, fmt.Errorf("%w: row %d: chain ID %s not allowed", errs.ErrInvalidBatch, i, rowChainIDs[i])
+		}
+	}
+	return totals, nil
+}
+
+// CrossChain is the Variant proving CrossChainSettlementCircuit. Profile
+// "crosschain-8" is the built-in one. A batch's chain_id is its first
+// allowed chain, its rows' signatures are over each row's own chain, and
+// its variant inputs are the other allowed chains and every row's, e.g.
+// {"chain_ids": [10, 42161, 8453], "rows": [1, 10, 1, ...]}. Its public
+// inputs go on after the PublicFields with chain_id_1 to chain_id_3, then
+// chain_total_0 to chain_total_3.
+type CrossChain struct{}
+
+// CrossChainInputs is a cross-chain batch's variant inputs.
+type CrossChainInputs struct {
+	ChainIDs []uint64 `json:"chain_ids"` // allowed chains after the batch's chain_id, NChains-1 of them
+	Rows     []uint64 `json:"rows"`      // each row's chain, in row order
+}
+
+func (CrossChain) Define(p Profile) frontend.Circuit { return p.CrossChainCircuit() }
+
+// WitnessFromBatch recomputes BatchDataRoot over the rows' chains and the
+// per-chain totals natively, so a row on a chain the batch does not allow
+// is errs.ErrInvalidBatch before it reaches the solver.
+func (CrossChain) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	if err != nil || len(raw) != 2 || raw["chain_ids"] == nil || raw["rows"] == nil {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"chain_ids": [...], "rows": [...]}`, errs.ErrInvalidInput)
+	}
+	var in CrossChainInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(in.ChainIDs) != NChains-1 {
+		return nil, fmt.Errorf("%w: %d chain IDs besides the batch's, want %d", errs.ErrInvalidInput, len(in.ChainIDs), NChains-1)
+	}
+	if len(in.Rows) != len(base.Size) {
+		return nil, fmt.Errorf("%w: %d row chain IDs for %d rows", errs.ErrInvalidBatch, len(in.Rows), len(base.Size))
+	}
+	head, err := fieldInts(base.P.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	chains := [NChains]*big.Int{head[0]}
+	for j, id := range in.ChainIDs {
+		chains[j+1] = new(big.Int).SetUint64(id)
+		for _, prev := range chains[:j+1] {
+			if prev.Cmp(chains[j+1]) == 0 {
+				return nil, fmt.Errorf("%w: chain ID %d allowed twice", errs.ErrInvalidInput, id)
+			}
+		}
+	}
+	sizes, err := fieldInts(base.Size...)
+	if err != nil {
+		return nil, err
+	}
+	nonces, err := fieldInts(base.Nonce...)
+	if err != nil {
+		return nil, err
+	}
+	rowChains := make([]*big.Int, len(in.Rows))
+	for i, id := range in.Rows {
+		rowChains[i] = new(big.Int).SetUint64(id)
+	}
+	totals, err := ChainTotals(chains, sizes, rowChains)
+	if err != nil {
+		return nil, err
+	}
+
+	c := p.CrossChainCircuit()
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	if c.P.BatchDataRoot, err = BatchDataRoot(p.DataHash, sizes, nonces, rowChains); err != nil {
+		return nil, err
+	}
+	for i := range rowChains {
+		c.ChainID[i] = rowChains[i]
+	}
+	for j := range c.X.ChainIDs {
+		c.X.ChainIDs[j] = chains[j+1]
+	}
+	for j := range c.X.ChainTotals {
+		c.X.ChainTotals[j] = totals[j]
+	}
+	return c, nil
+}
+
+func (CrossChain) PublicLayout(p Profile, base Layout) (Layout, error) {
+	var ins []PublicInput
+	for j := 1; j < NChains; j++ {
+		ins = append(ins, PublicInput{Name: fmt.Sprintf("chain_id_%d", j), Type: "uint64", Field: fmt.Sprintf("X.ChainIDs[%d]", j-1), Doc: fmt.Sprintf("allowed chain %d, pairwise distinct with chain_id and the others", j)})
+	}
+	for j := 0; j < NChains; j++ {
+		ins = append(ins, PublicInput{Name: fmt.Sprintf("chain_total_%d", j), Type: base[3].Type, Field: fmt.Sprintf("X.ChainTotals[%d]", j), Doc: fmt.Sprintf("sum of the sizes of the rows signed for allowed chain %d", j)})
+	}
+	for i := range base {
+		switch base[i].Name {
+		case "chain_id":
+			base[i].Doc = "allowed chain 0; every row is signed for one of the allowed chains, see chain_id_1 on"
+		case "batch_data_root":
+			base[i].Doc = "commitment to the (size, nonce, chain ID) rows, see DataHash; hex in JSON"
+		}
+	}
+	return base.Append(ins...), nil
+}
+
+func (CrossChain) feature() Features { return FeatureCrossChain }
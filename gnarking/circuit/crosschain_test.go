@@ -0,0 +1,180 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/signature"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+// crossChainBatch is the settlement assignment of a batch of p whose row i
+// is signed for rowChains[i], as POST /prove builds it from the batch: its
+// chain_id the first allowed chain, its root over (size, nonce) alone.
+func crossChainBatch(assert *test.Assert, priv signature.Signer, p Profile, nonces []int64, rowChains []uint64) *SettlementCircuit {
+	recipient := big.NewInt(42)
+	c := p.Circuit()
+	c.P.Recipient, c.P.ChainID, c.P.KOld = recipient, big.NewInt(1), big.NewInt(0)
+	sizes, bNonces := make([]*big.Int, p.N), make([]*big.Int, p.N)
+	total, m := big.NewInt(0), big.NewInt(0)
+	for i := range p.N {
+		sizes[i], bNonces[i] = big.NewInt(int64(i+1)), big.NewInt(nonces[i])
+		c.Size[i], c.Nonce[i] = sizes[i], bNonces[i]
+		sig, err := EdDSA{}.Sign(priv, MsgHash(p.Msg, recipient, sizes[i], bNonces[i], new(big.Int).SetUint64(rowChains[i])))
+		assert.NoError(err)
+		c.Sig[i].Assign(te.BN254, sig)
+		total.Add(total, sizes[i])
+		if bNonces[i].Cmp(m) > 0 {
+			m = bNonces[i]
+		}
+	}
+	c.P.TotalSettle, c.P.M = total, m
+	c.P.Pk.Assign(te.BN254, priv.Public().Bytes())
+	var err error
+	c.P.BatchDataRoot, err = BatchDataRoot(p.DataHash, sizes, bNonces)
+	assert.NoError(err)
+	return c
+}
+
+func crossChainInputs(assert *test.Assert, chainIDs []uint64, rows []uint64) json.RawMessage {
+	b, err := json.Marshal(CrossChainInputs{ChainIDs: chainIDs, Rows: rows})
+	assert.NoError(err)
+	return b
+}
+
+// TestCrossChainProfile proves through the built-in profile, as the servers
+// and settlement_demo do: the allowed chains and the rows' chains are the
+// batch's variant inputs, the chains and their totals public inputs after
+// the PublicFields.
+func TestCrossChainProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p, err := LookupProfile("crosschain-8")
+	assert.NoError(err)
+	assert.Equal(FeatureCrossChain, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(len(PublicFields)+2*NChains-1, len(l))
+	assert.Equal(2*NChains-1, l.Extra())
+	assert.Equal("chain_id_1", l[len(PublicFields)].Name)
+	assert.Equal("chain_total_3", l[len(l)-1].Name)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	others := []uint64{10, 42161, 8453}
+	// rows alternate between the first three chains, the last stays unused
+	rows := []uint64{1, 10, 42161, 1, 10, 42161, 1, 10}
+	nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	base := crossChainBatch(assert, priv, p, nonces, rows)
+	full, err := p.Assign(base, crossChainInputs(assert, others, rows))
+	assert.NoError(err)
+	valid := full.(*CrossChainSettlementCircuit)
+
+	w, err := frontend.NewWitness(valid, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	pub, err := PublicFromWitness(w)
+	assert.NoError(err)
+	// chain_id_1..3, then the totals: 1+4+7, 2+5+8, 3+6, 0
+	want := []int64{10, 42161, 8453, 12, 15, 9, 0}
+	assert.Equal(len(want), len(pub.Extra))
+	for i, x := range want {
+		assert.Equal(0, pub.Extra[i].(*big.Int).Cmp(big.NewInt(x)), "extra[%d] = %v, want %d", i, pub.Extra[i], x)
+	}
+
+	// per-chain totals moved between chains
+	invalidTotals := *valid
+	invalidTotals.X.ChainTotals[0] = big.NewInt(13)
+	invalidTotals.X.ChainTotals[1] = big.NewInt(14)
+	// row relabelled to another chain without re-signing
+	invalidChain := *valid
+	invalidChain.ChainID = slices.Clone(valid.ChainID)
+	invalidChain.ChainID[0] = big.NewInt(10)
+	// an allowed chain ID repeated
+	invalidIDs := *valid
+	invalidIDs.X.ChainIDs[2] = big.NewInt(1)
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(valid),
+		test.WithInvalidAssignment(&invalidTotals),
+		test.WithInvalidAssignment(&invalidChain),
+		test.WithInvalidAssignment(&invalidIDs),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, tc := range map[string]struct {
+		in   json.RawMessage
+		want error
+	}{
+		"row on another chain":  {crossChainInputs(assert, others, append([]uint64{137}, rows[1:]...)), errs.ErrInvalidBatch},
+		"row chains missing":    {crossChainInputs(assert, others, rows[1:]), errs.ErrInvalidBatch},
+		"chain allowed twice":   {crossChainInputs(assert, []uint64{10, 1, 8453}, rows), errs.ErrInvalidInput},
+		"too few chains":        {crossChainInputs(assert, others[1:], rows), errs.ErrInvalidInput},
+		"no inputs":             {nil, errs.ErrInvalidInput},
+		"unknown member":        {json.RawMessage(`{"chain_ids": [10, 42161, 8453], "rows": [], "totals": []}`), errs.ErrInvalidInput},
+		"chain ID not a number": {json.RawMessage(`{"chain_ids": ["10", 42161, 8453], "rows": []}`), errs.ErrInvalidInput},
+	} {
+		if _, err := p.Assign(base, tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+// TestCrossChainProfile_Config checks the circuit honours the profile's
+// message version, ordering and bounds.
+func TestCrossChainProfile_Config(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	p, err := LookupProfile("crosschain-8")
+	assert.NoError(err)
+	p.Ordering, p.Msg, p.Bounds = OrderingUnique, MsgV2, Bounds{NonceBits: 16, SizeBits: 8, TotalBits: 16}
+
+	others := []uint64{10, 42161, 8453}
+	rows := []uint64{1, 10, 42161, 8453, 1, 10, 42161, 8453}
+	assign := func(nonces []int64) frontend.Circuit {
+		full, err := p.Assign(crossChainBatch(assert, priv, p, nonces, rows), crossChainInputs(assert, others, rows))
+		assert.NoError(err)
+		return full
+	}
+	// unique IDs in any order
+	nonces := []int64{8, 7, 6, 5, 4, 3, 2, 1}
+	// a nonce past NonceBits
+	wide := slices.Clone(nonces)
+	wide[0] = 1 << p.Bounds.NonceBits
+	// a repeated ID
+	dup := slices.Clone(nonces)
+	dup[1] = dup[0]
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(assign(nonces)),
+		test.WithInvalidAssignment(assign(wide)),
+		test.WithInvalidAssignment(assign(dup)),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	p.Ordering = OrderingPermuted
+	_, err = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Define())
+	assert.Error(err, "permuted ordering")
+}
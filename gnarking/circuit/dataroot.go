@@ -0,0 +1,225 @@
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdSha3 "github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/uints"
+
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/errs"
+)
+
+// DataHash selects how BatchDataRoot commits to the batch rows. Rows are
+// absorbed row-major, column order as given (Size, Nonce[, ChainID]).
+//
+//   - DataHashMiMC: root = MiMC(Size[0], Nonce[0], ..., Size[N-1], Nonce[N-1]).
+//     Cheap to prove, expensive for a contract to recompute.
+//   - DataHashKeccak: root = keccak256(Size[0] || Nonce[0] || ...) mod 2^248,
+//     every value packed as 8 bytes big-endian. Expensive to prove, but
+//     Solidity recomputes it with
+//     uint256(keccak256(abi.encodePacked(uint64 ...))) & type(uint248).max.
+//   - DataHashMiMCTree: root = the root of a binary tree over the row leaves
+//     MiMC(Size[i], Nonce[i]), each node MiMC(left, right), zero leaves
+//     padding N to a power of two. About as cheap to prove as DataHashMiMC,
+//     and a row published as its leaf alone still recomputes the root, so
+//     exported batch data can be redacted (package redact).
+type DataHash uint8
+
+const (
+	DataHashMiMC DataHash = iota
+	DataHashKeccak
+	DataHashMiMCTree
+)
+
+// keccak digests are 256 bits and do not fit the BN254 scalar field,
+// so the root keeps the low 31 bytes.
+const keccakRootBytes = 31
+
+func (h DataHash) String() string {
+	switch h {
+	case DataHashMiMC:
+		return "mimc"
+	case DataHashKeccak:
+		return "keccak"
+	case DataHashMiMCTree:
+		return "mimc-tree"
+	default:
+		return fmt.Sprintf("DataHash(%d)", uint8(h))
+	}
+}
+
+func ParseDataHash(s string) (DataHash, error) {
+	switch s {
+	case "mimc":
+		return DataHashMiMC, nil
+	case "keccak":
+		return DataHashKeccak, nil
+	case "mimc-tree":
+		return DataHashMiMCTree, nil
+	default:
+		return 0, fmt.Errorf("unknown data hash %q (want mimc, keccak or mimc-tree)", s)
+	}
+}
+
+// batchDataRoot computes the in-circuit BatchDataRoot over the rows, one
+// slice per column.
+func batchDataRoot(api frontend.API, h DataHash, cols ...[]frontend.Variable) (frontend.Variable, error) {
+	switch h {
+	case DataHashMiMC:
+		hRoot, err := stdMimc.NewMiMC(api)
+		if err != nil {
+			return nil, err
+		}
+		for i := range cols[0] {
+			for _, col := range cols {
+				hRoot.Write(col[i])
+			}
+		}
+		return hRoot.Sum(), nil
+	case DataHashKeccak:
+		u64, err := uints.New[uints.U64](api)
+		if err != nil {
+			return nil, err
+		}
+		hRoot, err := stdSha3.NewLegacyKeccak256(api)
+		if err != nil {
+			return nil, err
+		}
+		for i := range cols[0] {
+			for _, col := range cols {
+				// ValueOf range checks every value to 64 bits
+				hRoot.Write(u64.UnpackMSB(u64.ValueOf(col[i])))
+			}
+		}
+		digest := hRoot.Sum()
+		root := frontend.Variable(0)
+		for _, b := range digest[len(digest)-keccakRootBytes:] {
+			root = api.Add(api.Mul(root, 256), u64.Value(b))
+		}
+		return root, nil
+	case DataHashMiMCTree:
+		level := make([]frontend.Variable, treeWidth(len(cols[0])))
+		for i := range level {
+			level[i] = 0
+			if i >= len(cols[0]) {
+				continue
+			}
+			hLeaf, err := stdMimc.NewMiMC(api)
+			if err != nil {
+				return nil, err
+			}
+			for _, col := range cols {
+				hLeaf.Write(col[i])
+			}
+			level[i] = hLeaf.Sum()
+		}
+		for len(level) > 1 {
+			for i := range len(level) / 2 {
+				var err error
+				if level[i], err = mimc2(api, level[2*i], level[2*i+1]); err != nil {
+					return nil, err
+				}
+			}
+			level = level[:len(level)/2]
+		}
+		return level[0], nil
+	default:
+		return nil, fmt.Errorf("unsupported data hash %s", h)
+	}
+}
+
+// treeWidth is the number of leaves of a DataHashMiMCTree over n rows.
+func treeWidth(n int) int {
+	w := 1
+	for w < n {
+		w *= 2
+	}
+	return w
+}
+
+// BatchDataRoot is the native counterpart of the in-circuit BatchDataRoot,
+// e.g. BatchDataRoot(h, sizes, nonces).
+func BatchDataRoot(h DataHash, cols ...[]*big.Int) (*big.Int, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%w: no columns", errs.ErrInvalidBatch)
+	}
+	for _, col := range cols[1:] {
+		if len(col) != len(cols[0]) {
+			return nil, fmt.Errorf("%w: column length mismatch: %d != %d", errs.ErrInvalidBatch, len(col), len(cols[0]))
+		}
+	}
+	switch h {
+	case DataHashMiMC:
+		hRoot := bnMimc.NewMiMC()
+		for i := range cols[0] {
+			for _, col := range cols {
+				hRoot.Write(encodeFieldElement(col[i]))
+			}
+		}
+		return new(big.Int).SetBytes(hRoot.Sum(nil)), nil
+	case DataHashKeccak:
+		hRoot := sha3.NewLegacyKeccak256()
+		var buf [8]byte
+		for i := range cols[0] {
+			for _, col := range cols {
+				v := col[i]
+				if v.Sign() < 0 || v.BitLen() > 64 {
+					return nil, fmt.Errorf("%w: row %d: value %s does not fit in 64 bits", errs.ErrInvalidBatch, i, v)
+				}
+				v.FillBytes(buf[:])
+				hRoot.Write(buf[:])
+			}
+		}
+		digest := hRoot.Sum(nil)
+		return new(big.Int).SetBytes(digest[len(digest)-keccakRootBytes:]), nil
+	case DataHashMiMCTree:
+		leaves := make([]*big.Int, len(cols[0]))
+		row := make([]*big.Int, len(cols))
+		for i := range leaves {
+			for j, col := range cols {
+				row[j] = col[i]
+			}
+			leaves[i] = DataLeaf(row...)
+		}
+		return DataTreeRoot(leaves)
+	default:
+		return nil, fmt.Errorf("unsupported data hash %s", h)
+	}
+}
+
+// DataLeaf is the native DataHashMiMCTree leaf of a row, MiMC over its
+// values in column order; a tree node is DataLeaf(left, right).
+func DataLeaf(row ...*big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	for _, v := range row {
+		h.Write(encodeFieldElement(v))
+	}
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// DataTreeRoot is the native DataHashMiMCTree root over the row leaves.
+func DataTreeRoot(leaves []*big.Int) (*big.Int, error) {
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("%w: no rows", errs.ErrInvalidBatch)
+	}
+	level := make([]*big.Int, treeWidth(len(leaves)))
+	for i := range level {
+		level[i] = new(big.Int)
+		if i < len(leaves) {
+			level[i] = leaves[i]
+		}
+	}
+	for len(level) > 1 {
+		for i := range len(level) / 2 {
+			level[i] = DataLeaf(level[2*i], level[2*i+1])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0], nil
+}
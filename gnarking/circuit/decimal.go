@@ -0,0 +1,61 @@
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// MaxSizeScale is the most decimal places sizes can have: at 19, one whole
+// unit no longer fits the uint64 sizes are carried in.
+const MaxSizeScale = 18
+
+// ParseDecimal is the integer s denotes at scale decimal places, s*10^scale:
+// "1.25" at scale 6 is 1250000. s is digits with an optional fraction of
+// at most scale digits; more is an error rather than rounding, as are
+// signs, exponents and a fraction without digits on both sides.
+func ParseDecimal(s string, scale int) (*big.Int, error) {
+	if scale < 0 || scale > MaxSizeScale {
+		return nil, fmt.Errorf("%w: scale %d outside [0, %d]", errs.ErrInvalidInput, scale, MaxSizeScale)
+	}
+	whole, frac, dotted := strings.Cut(s, ".")
+	if !digits(whole) || (dotted && !digits(frac)) {
+		return nil, fmt.Errorf("%w: %q is not a decimal", errs.ErrInvalidInput, s)
+	}
+	if len(frac) > scale {
+		return nil, fmt.Errorf("%w: %q has more than %d decimal places", errs.ErrInvalidInput, s, scale)
+	}
+	v, _ := new(big.Int).SetString(whole+frac+strings.Repeat("0", scale-len(frac)), 10)
+	return v, nil
+}
+
+// FormatDecimal is v at scale decimal places without trailing zeros,
+// ParseDecimal's inverse for non-negative v.
+func FormatDecimal(v *big.Int, scale int) string {
+	s := v.String()
+	if scale <= 0 || v.Sign() < 0 {
+		return s
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-scale], strings.TrimRight(s[len(s)-scale:], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
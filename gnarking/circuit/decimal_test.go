@@ -0,0 +1,56 @@
+package circuit
+
+import (
+	"errors"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		scale int
+		want  string // the integer, "" for an error
+		back  string // FormatDecimal of it, s when empty
+	}{
+		{"1.25", 6, "1250000", ""},
+		{"1.250000", 6, "1250000", "1.25"},
+		{"7", 6, "7000000", ""},
+		{"0.000001", 6, "1", ""},
+		{"0", 2, "0", ""},
+		{"007.5", 2, "750", "7.5"},
+		{"42", 0, "42", ""},
+		{"18446744073.709551615", 9, "18446744073709551615", ""},
+		{"99999999999999999999999", 18, "99999999999999999999999000000000000000000", ""}, // no overflow here, callers bound the result
+		{"1.2", 0, "", ""},
+		{"1.255", 2, "", ""},
+		{"-1", 2, "", ""},
+		{"+1", 2, "", ""},
+		{"1e3", 2, "", ""},
+		{".5", 2, "", ""},
+		{"1.", 2, "", ""},
+		{"", 2, "", ""},
+		{"1,5", 2, "", ""},
+		{"1", 19, "", ""},
+	} {
+		v, err := ParseDecimal(tc.s, tc.scale)
+		if tc.want == "" {
+			if !errors.Is(err, errs.ErrInvalidInput) {
+				t.Errorf("%q at %d: %v, %v, want ErrInvalidInput", tc.s, tc.scale, v, err)
+			}
+			continue
+		}
+		if err != nil || v.String() != tc.want {
+			t.Errorf("%q at %d: %v, %v, want %s", tc.s, tc.scale, v, err, tc.want)
+			continue
+		}
+		back := tc.back
+		if back == "" {
+			back = tc.s
+		}
+		if got := FormatDecimal(v, tc.scale); got != back {
+			t.Errorf("FormatDecimal(%s, %d) = %s, want %s", v, tc.scale, got, back)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package circuit
+
+import "github.com/consensys/gnark/frontend"
+
+// An empty batch advances nothing: a heartbeat, proven so a protocol can
+// move its epochs on with no settlement. It is a batch of a profile with
+// EmptyBatches whose M is KOld; every one of its N rows is the heartbeat
+// row (Size 0, Nonce KOld), signed by Pk like any other, so TotalSettle is
+// 0 and the signature checks are those of a full batch. An ordering never
+// lets a batch with rows end where it started (M > KOld, or a distinct
+// nonce above KOld == 0 for OrderingUnique once N > 1), so M == KOld tells
+// the two apart, on-chain too (artifacts.SolidityHeartbeat).
+
+// assertEmptyRows returns whether the batch is empty, M == KOld, and
+// asserts that every row of an empty batch is the heartbeat row.
+func assertEmptyRows(api frontend.API, kOld, m frontend.Variable, size, nonce []frontend.Variable) frontend.Variable {
+	empty := api.IsZero(api.Sub(m, kOld))
+	for i := range size {
+		api.AssertIsEqual(api.Mul(empty, size[i]), 0)
+		api.AssertIsEqual(api.Mul(empty, api.Sub(nonce[i], kOld)), 0)
+	}
+	return empty
+}
+
+// placeholderNonces is what the ordering constraints check: KOld, M and
+// the nonces, or 0, N and 1..N for an empty batch, which satisfy every
+// ordering.
+func placeholderNonces(api frontend.API, empty, kOld, m frontend.Variable, nonce []frontend.Variable) (frontend.Variable, frontend.Variable, []frontend.Variable) {
+	out := make([]frontend.Variable, len(nonce))
+	for i := range nonce {
+		out[i] = api.Select(empty, i+1, nonce[i])
+	}
+	return api.Select(empty, 0, kOld), api.Select(empty, len(nonce), m), out
+}
@@ -0,0 +1,55 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+	"github.com/consensys/gnark/test"
+)
+
+func TestSettlementCircuit_EmptyBatches(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	field := ecc.BN254.ScalarField()
+
+	const n = 4
+	at := func(v int64) []int64 {
+		out := make([]int64, n)
+		for i := range out {
+			out[i] = v
+		}
+		return out
+	}
+	for _, o := range []Ordering{OrderingMonotonic, OrderingUnique, OrderingPermuted} {
+		kOld := int64(10)
+		if o == OrderingUnique {
+			kOld = 0
+		}
+		c := NewSettlementCircuit(n)
+		c.Ordering, c.EmptyBatches = o, true
+		plain := NewSettlementCircuit(n)
+		plain.Ordering = o
+
+		heartbeat := signedSettlement(assert, priv, MsgV1, kOld, at(0), at(kOld))
+		assert.NoError(test.IsSolved(c, &heartbeat, field), "%s: heartbeat", o)
+		assert.Error(test.IsSolved(plain, &heartbeat, field), "%s: heartbeat without empty batches", o)
+
+		// an empty batch settles nothing
+		sized := signedSettlement(assert, priv, MsgV1, kOld, []int64{0, 1, 0, 0}, at(kOld))
+		sized.P.TotalSettle = big.NewInt(0)
+		assert.Error(test.IsSolved(c, &sized, field), "%s: sized heartbeat", o)
+
+		// nor can a batch with rows claim to end at KOld
+		nonces := []int64{kOld + 1, kOld + 2, kOld + 3, kOld + 4}
+		rows := signedSettlement(assert, priv, MsgV1, kOld, at(1), nonces)
+		assert.NoError(test.IsSolved(c, &rows, field), "%s: rows", o)
+		rows.P.M = big.NewInt(kOld)
+		assert.Error(test.IsSolved(c, &rows, field), "%s: rows ending at KOld", o)
+	}
+}
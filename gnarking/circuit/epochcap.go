@@ -0,0 +1,241 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+
+	"gnarking/errs"
+)
+
+// EpochBits bounds an epoch ID.
+const EpochBits = 64
+
+// EpochCapPublic is EpochCapCircuit's own public inputs, after
+// SettlementCircuitPublic's: the epoch the batch settles in, the
+// recipient's cap per epoch and its epoch accumulator before and after the
+// batch. An epoch accumulator is the commitment MiMC(Recipient, Epoch,
+// Spent, Blinding) to what the recipient has settled in Epoch; 0 is the
+// empty accumulator, nothing settled yet.
+type EpochCapPublic struct {
+	EpochID  frontend.Variable `gnark:",public"`
+	EpochCap frontend.Variable `gnark:",public"`
+	OldAcc   frontend.Variable `gnark:",public"`
+	NewAcc   frontend.Variable `gnark:",public"`
+}
+
+// EpochCapCircuit is SettlementCircuit with a ceiling on what a recipient
+// settles per epoch, so a compromised signer cannot drain more than
+// EpochCap per epoch however many batches it signs. The contract pins
+// EpochID (e.g. block.timestamp / epoch length) and EpochCap, checks OldAcc
+// against its stored slot and replaces it with NewAcc; the proof shows
+// NewAcc commits to the epoch's spent total plus TotalSettle, at most
+// EpochCap, where the spent total starts over at 0 when EpochID moves past
+// the epoch OldAcc is of. Epochs never go back.
+type EpochCapCircuit struct {
+	P           SettlementCircuitPublic
+	X           EpochCapPublic
+	PrevEpoch   frontend.Variable // the epoch OldAcc is of
+	Spent       frontend.Variable // settled in PrevEpoch before this batch
+	OldBlinding frontend.Variable
+	NewBlinding frontend.Variable
+	Size        []frontend.Variable
+	Nonce       []frontend.Variable
+	Sig         []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewEpochCapCircuit allocates the rows of an n-row batch.
+func NewEpochCapCircuit(n int) *EpochCapCircuit {
+	s := NewSettlementCircuit(n)
+	return &EpochCapCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig}
+}
+
+func (c *EpochCapCircuit) Define(api frontend.API) error {
+	// 0a. OldAcc is empty with Spent == 0, or opens to
+	//     MiMC(Recipient, PrevEpoch, Spent, OldBlinding)
+	old, err := epochAccumulator(api, c.P.Recipient, c.PrevEpoch, c.Spent, c.OldBlinding)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(api.Mul(c.X.OldAcc, api.Sub(c.X.OldAcc, old)), 0)
+	api.AssertIsEqual(api.Mul(api.IsZero(c.X.OldAcc), c.Spent), 0)
+
+	// 0b. PrevEpoch <= EpochID, both below 2^EpochBits
+	api.ToBinary(c.PrevEpoch, EpochBits)
+	api.ToBinary(c.X.EpochID, EpochBits)
+	api.ToBinary(api.Sub(c.X.EpochID, c.PrevEpoch), EpochBits)
+
+	// 0c. spent = (Spent if the epoch is PrevEpoch, else 0) + TotalSettle
+	//     <= EpochCap, every term below 2^CumulativeBits so nothing wraps
+	api.ToBinary(c.Spent, CumulativeBits)
+	api.ToBinary(c.P.TotalSettle, CumulativeBits)
+	api.ToBinary(c.X.EpochCap, CumulativeBits)
+	sameEpoch := api.IsZero(api.Sub(c.X.EpochID, c.PrevEpoch))
+	spent := api.Add(api.Mul(sameEpoch, c.Spent), c.P.TotalSettle)
+	api.ToBinary(api.Sub(c.X.EpochCap, spent), CumulativeBits)
+
+	// 0d. NewAcc == MiMC(Recipient, EpochID, spent, NewBlinding)
+	acc, err := epochAccumulator(api, c.P.Recipient, c.X.EpochID, spent, c.NewBlinding)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(acc, c.X.NewAcc)
+
+	// 1-6. the settlement constraints
+	inner := SettlementCircuit{
+		P:            c.P,
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+	}
+	return inner.Define(api)
+}
+
+func epochAccumulator(api frontend.API, recipient, epoch, spent, blinding frontend.Variable) (frontend.Variable, error) {
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(recipient, epoch, spent, blinding)
+	return h.Sum(), nil
+}
+
+// EpochAccumulator is the native MiMC(recipient, epoch, spent, blinding).
+func EpochAccumulator(recipient, epoch, spent, blinding *big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	h.Write(encodeFieldElement(recipient))
+	h.Write(encodeFieldElement(epoch))
+	h.Write(encodeFieldElement(spent))
+	h.Write(encodeFieldElement(blinding))
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// NextEpochSpent is the native pre-check: what the recipient has settled in
+// epoch after a batch settling total, given it had settled spent in
+// prevEpoch. A batch over epochCap is refused with ErrPolicyRejected before
+// any proving work is spent on it.
+func NextEpochSpent(prevEpoch, spent, epoch, total, epochCap *big.Int) (*big.Int, error) {
+	for _, e := range []*big.Int{prevEpoch, epoch} {
+		if e.Sign() < 0 || e.BitLen() > EpochBits {
+			return nil, fmt.Errorf("%w: epoch %s outside [0, 2^%d)", errs.ErrInvalidInput, e, EpochBits)
+		}
+	}
+	if epoch.Cmp(prevEpoch) < 0 {
+		return nil, fmt.Errorf("%w: epoch %s is before the accumulator's %s", errs.ErrInvalidInput, epoch, prevEpoch)
+	}
+	for _, v := range []*big.Int{spent, total, epochCap} {
+		if v.Sign() < 0 || v.BitLen() > CumulativeBits {
+			return nil, fmt.Errorf("%w: %s outside [0, 2^%d)", errs.ErrInvalidBatch, v, CumulativeBits)
+		}
+	}
+	next := new(big.Int).Set(total)
+	if epoch.Cmp(prevEpoch) == 0 {
+		next.Add(next, spent)
+	}
+	if next.Cmp(epochCap) > 0 {
+		return nil, fmt.Errorf("%w: epoch %s: %s settled would exceed the cap %s", errs.ErrPolicyRejected, epoch, next, epochCap)
+	}
+	return next, nil
+}
+
+// EpochCap is the Variant proving EpochCapCircuit. Profile "epochcap-8" is
+// the built-in one. A batch's variant inputs are the epoch it settles in,
+// the cap, the opening of the recipient's epoch accumulator before it,
+// "old", absent for the empty one, and the blinding of the one after it,
+// e.g. {"epoch": 5, "cap": "30", "old": {"epoch": 5, "spent": "8",
+// "blinding": "111"}, "new_blinding": "222"}; the next batch's "old" is
+// then the epoch's spent total after this one under new_blinding.
+// epoch_id, epoch_cap, old_acc and new_acc follow the PublicFields.
+type EpochCap struct{}
+
+// EpochOpening opens an epoch accumulator: the epoch, what the recipient
+// has settled in it and the blinding it is committed under.
+type EpochOpening struct {
+	Epoch    uint64    `json:"epoch"`
+	Spent    FieldJSON `json:"spent"`
+	Blinding FieldJSON `json:"blinding"`
+}
+
+// EpochCapInputs is an epoch-capped batch's variant inputs.
+type EpochCapInputs struct {
+	Epoch       uint64        `json:"epoch"`
+	Cap         FieldJSON     `json:"cap"`
+	Old         *EpochOpening `json:"old,omitempty"` // nil for the empty accumulator
+	NewBlinding FieldJSON     `json:"new_blinding"`
+}
+
+func (v EpochCap) circuit(p Profile) *EpochCapCircuit {
+	c := NewEpochCapCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (v EpochCap) Define(p Profile) frontend.Circuit { return v.circuit(p) }
+
+// WitnessFromBatch checks the cap natively (NextEpochSpent), so a batch
+// over it is errs.ErrPolicyRejected before it reaches the solver.
+func (v EpochCap) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	old, hasOld := raw["old"]
+	delete(raw, "old")
+	if err != nil || len(raw) != 3 || raw["epoch"] == nil || raw["cap"] == nil || raw["new_blinding"] == nil || hasOld && string(old) == "null" {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"epoch": ..., "cap": ..., "old": {"epoch": ..., "spent": ..., "blinding": ...}, "new_blinding": ...}, "old" absent for the empty accumulator`, errs.ErrInvalidInput)
+	}
+	var in EpochCapInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	head, err := fieldInts(base.P.Recipient, base.P.TotalSettle)
+	if err != nil {
+		return nil, err
+	}
+	prevEpoch, spent, oldBlinding, oldAcc := new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+	if in.Old != nil {
+		prevEpoch.SetUint64(in.Old.Epoch)
+		spent, oldBlinding = (*big.Int)(&in.Old.Spent), (*big.Int)(&in.Old.Blinding)
+		oldAcc = EpochAccumulator(head[0], prevEpoch, spent, oldBlinding)
+	}
+	epoch, epochCap, newBlinding := new(big.Int).SetUint64(in.Epoch), (*big.Int)(&in.Cap), (*big.Int)(&in.NewBlinding)
+	next, err := NextEpochSpent(prevEpoch, spent, epoch, head[1], epochCap)
+	if err != nil {
+		return nil, err
+	}
+	c := v.circuit(p)
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	c.X.EpochID, c.X.EpochCap = epoch, epochCap
+	c.X.OldAcc, c.X.NewAcc = oldAcc, EpochAccumulator(head[0], epoch, next, newBlinding)
+	c.PrevEpoch, c.Spent, c.OldBlinding, c.NewBlinding = prevEpoch, spent, oldBlinding, newBlinding
+	return c, nil
+}
+
+func (EpochCap) PublicLayout(p Profile, base Layout) (Layout, error) {
+	return base.Append(
+		PublicInput{Name: "epoch_id", Type: fmt.Sprintf("uint%d", EpochBits), Field: "X.EpochID", Doc: "epoch the batch settles in, pinned by the contract (e.g. block.timestamp / epoch length)"},
+		PublicInput{Name: "epoch_cap", Type: fmt.Sprintf("uint%d", CumulativeBits), Field: "X.EpochCap", Doc: "most the recipient may settle in one epoch"},
+		PublicInput{Name: "old_acc", Type: "field", Field: "X.OldAcc", Doc: "recipient's epoch accumulator before the batch, MiMC(recipient, epoch, spent, blinding), 0 for none yet: the contract's stored slot"},
+		PublicInput{Name: "new_acc", Type: "field", Field: "X.NewAcc", Doc: "recipient's epoch accumulator after the batch, over epoch_id and its spent total with total_settle: the contract stores it"},
+	), nil
+}
+
+func (EpochCap) feature() Features { return FeatureEpochCap }
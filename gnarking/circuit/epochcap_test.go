@@ -0,0 +1,123 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+// TestEpochCapProfile chains batches through the built-in profile within
+// an epoch and across into the next.
+func TestEpochCapProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p, err := LookupProfile("epochcap-8")
+	assert.NoError(err)
+	assert.Equal(FeatureEpochCap, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(4, l.Extra())
+	assert.Equal("epoch_id", l[len(PublicFields)].Name)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	ones := []int64{1, 1, 1, 1, 1, 1, 1, 1}
+	first := signedSettlement(assert, priv, MsgV1, 0, ones, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	second := signedSettlement(assert, priv, MsgV1, 8, []int64{5, 1, 2, 3, 4, 1, 1, 1}, []int64{9, 10, 11, 12, 13, 14, 15, 16})
+	recipient := first.P.Recipient.(*big.Int)
+	acc := func(epoch, spent, blinding int64) *big.Int {
+		return EpochAccumulator(recipient, big.NewInt(epoch), big.NewInt(spent), big.NewInt(blinding))
+	}
+
+	assign := func(s *SettlementCircuit, in string) *EpochCapCircuit {
+		c, err := p.Assign(s, json.RawMessage(in))
+		assert.NoError(err)
+		return c.(*EpochCapCircuit)
+	}
+	// 8 then 18 in epoch 5: 26 in all
+	genesis := assign(&first, `{"epoch": 5, "cap": "30", "new_blinding": "111"}`)
+	sameEpoch := assign(&second, `{"epoch": 5, "cap": "30", "old": {"epoch": 5, "spent": "8", "blinding": "111"}, "new_blinding": "222"}`)
+	assert.Equal(0, genesis.X.NewAcc.(*big.Int).Cmp(acc(5, 8, 111)))
+	assert.Equal(0, sameEpoch.X.NewAcc.(*big.Int).Cmp(acc(5, 26, 222)))
+	// the next epoch starts over: 18 under a cap of 20
+	nextEpoch := assign(&second, `{"epoch": 6, "cap": "20", "old": {"epoch": 5, "spent": "8", "blinding": "111"}, "new_blinding": "222"}`)
+
+	// 26 in epoch 5 over a cap of 20
+	overCap := *sameEpoch
+	overCap.X.EpochCap = big.NewInt(20)
+	// over the cap, hiding the spent total by restarting the epoch
+	forgotten := overCap
+	forgotten.X.NewAcc = acc(5, 18, 222)
+	// back to an earlier epoch to start over there
+	backwards := *nextEpoch
+	backwards.X.EpochID = big.NewInt(4)
+	backwards.X.NewAcc = acc(4, 18, 222)
+	// old accumulator opened to another epoch to reset the spent total
+	wrongOpening := *nextEpoch
+	wrongOpening.X.EpochID, wrongOpening.PrevEpoch = big.NewInt(5), big.NewInt(4)
+	wrongOpening.X.NewAcc = acc(5, 18, 222)
+	// a single batch over the cap from empty
+	bigBatch := *assign(&second, `{"epoch": 5, "cap": "18", "new_blinding": "222"}`)
+	bigBatch.X.EpochCap = big.NewInt(17)
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(genesis),
+		test.WithValidAssignment(sameEpoch),
+		test.WithValidAssignment(nextEpoch),
+		test.WithInvalidAssignment(&overCap),
+		test.WithInvalidAssignment(&forgotten),
+		test.WithInvalidAssignment(&backwards),
+		test.WithInvalidAssignment(&wrongOpening),
+		test.WithInvalidAssignment(&bigBatch),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, tc := range map[string]struct {
+		in   string
+		want error
+	}{
+		"over the cap":   {`{"epoch": 5, "cap": "20", "old": {"epoch": 5, "spent": "8", "blinding": "111"}, "new_blinding": "222"}`, errs.ErrPolicyRejected},
+		"earlier epoch":  {`{"epoch": 4, "cap": "20", "old": {"epoch": 5, "spent": "8", "blinding": "111"}, "new_blinding": "222"}`, errs.ErrInvalidInput},
+		"no cap":         {`{"epoch": 5, "new_blinding": "222"}`, errs.ErrInvalidInput},
+		"null old":       {`{"epoch": 5, "cap": "30", "old": null, "new_blinding": "222"}`, errs.ErrInvalidInput},
+		"unknown member": {`{"epoch": 5, "cap": "30", "new_blinding": "222", "sigs": []}`, errs.ErrInvalidInput},
+	} {
+		if _, err := p.Assign(&second, json.RawMessage(tc.in)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestNextEpochSpent(t *testing.T) {
+	n := big.NewInt
+	if got, err := NextEpochSpent(n(5), n(8), n(5), n(18), n(30)); err != nil || got.Int64() != 26 {
+		t.Fatalf("same epoch: %v %v", got, err)
+	}
+	if got, err := NextEpochSpent(n(5), n(8), n(6), n(18), n(20)); err != nil || got.Int64() != 18 {
+		t.Fatalf("next epoch: %v %v", got, err)
+	}
+	if _, err := NextEpochSpent(n(5), n(8), n(5), n(18), n(20)); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Errorf("over the cap: %v", err)
+	}
+	if _, err := NextEpochSpent(n(5), n(8), n(4), n(1), n(20)); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("earlier epoch: %v", err)
+	}
+	if _, err := NextEpochSpent(n(0), n(0), new(big.Int).Lsh(n(1), EpochBits), n(1), n(20)); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("epoch out of range: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package circuit
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// Features is the bitmask of what a setup's circuit enforces beyond the
+// default SettlementCircuit (MiMC root, monotonic nonces, v1 messages,
+// unbounded). Setup records it in the manifest, prove echoes it in the
+// proof header, and verify and export refuse a proof whose features are not
+// the setup's: two setups that differ only in a variant can share a batch
+// size and a verifier ABI, so nothing else tells their artifacts apart
+// before a pairing check fails or, worse, a contract accepts the wrong
+// statement.
+//
+// The low 16 bits are SettlementCircuit's compile-time config, derived from
+// a Profile. Of bits 16-23, 16 (crosschain), 17 (private), 18 (partial),
+// 19 (accumulator), 20 (epoch_cap), 21 (revocation) and 22 (cosign) name
+// this package's variants and 23 is unassigned. Bit 24 marks a Variant
+// registered from outside the package.
+type Features uint32
+
+const (
+	FeatureKeccakRoot   Features = 1 << iota // DataHashKeccak
+	FeatureUnique                            // OrderingUnique
+	FeaturePermuted                          // OrderingPermuted
+	FeatureMsgV2                             // MsgV2
+	FeatureMsgSHA256                         // MsgSHA256
+	FeatureBounds                            // Bounds not zero
+	FeatureDecimalSizes                      // SizeScale > 0
+	FeatureTreeRoot                          // DataHashMiMCTree
+	FeatureEmptyBatches                      // EmptyBatches
+)
+
+// The built-in variants, each its own bit.
+const (
+	FeatureCrossChain  Features = 1 << 16 // CrossChain
+	FeaturePrivate     Features = 1 << 17 // PrivateRecipient
+	FeaturePartial     Features = 1 << 18 // PartialSettlement
+	FeatureAccumulator Features = 1 << 19 // ChainedAccumulator
+	FeatureEpochCap    Features = 1 << 20 // EpochCap
+	FeatureRevocation  Features = 1 << 21 // Revocation
+	FeatureCosign      Features = 1 << 22 // Cosign
+)
+
+// FeaturePlugin marks a profile with a Variant from outside this package,
+// whatever its circuit.
+const FeaturePlugin Features = 1 << 24
+
+// builtinVariant is a Variant of this package, named by its own feature
+// bit rather than FeaturePlugin.
+type builtinVariant interface {
+	Variant
+	feature() Features
+}
+
+// featureNames are the manifest spellings, bit i at index i.
+var featureNames = [...]string{
+	0:  "keccak_root",
+	1:  "unique",
+	2:  "permuted",
+	3:  "msg_v2",
+	4:  "msg_sha256",
+	5:  "bounds",
+	6:  "decimal_sizes",
+	7:  "tree_root",
+	8:  "empty_batches",
+	16: "crosschain",
+	17: "private",
+	18: "partial",
+	19: "accumulator",
+	20: "epoch_cap",
+	21: "revocation",
+	22: "cosign",
+	24: "plugin",
+}
+
+// Features is the profile's feature set: its config, plus its built-in
+// variant's bit or FeaturePlugin for a profile with a Variant.
+func (p Profile) Features() Features {
+	var f Features
+	switch p.DataHash {
+	case DataHashKeccak:
+		f |= FeatureKeccakRoot
+	case DataHashMiMCTree:
+		f |= FeatureTreeRoot
+	}
+	switch p.Ordering {
+	case OrderingUnique:
+		f |= FeatureUnique
+	case OrderingPermuted:
+		f |= FeaturePermuted
+	}
+	switch p.Msg {
+	case MsgV2:
+		f |= FeatureMsgV2
+	case MsgSHA256:
+		f |= FeatureMsgSHA256
+	}
+	if !p.Bounds.IsZero() {
+		f |= FeatureBounds
+	}
+	if p.SizeScale > 0 {
+		f |= FeatureDecimalSizes
+	}
+	if p.EmptyBatches {
+		f |= FeatureEmptyBatches
+	}
+	if v, ok := p.Variant.(builtinVariant); ok {
+		f |= v.feature()
+	} else if p.Variant != nil {
+		f |= FeaturePlugin
+	}
+	return f
+}
+
+// WithFeatures is p with the settings a setup records only as feature
+// bits, EmptyBatches, taken from f.
+func (p Profile) WithFeatures(f Features) Profile {
+	p.EmptyBatches = f&FeatureEmptyBatches != 0
+	return p
+}
+
+// String is the comma-separated feature names, "none" for the default
+// circuit; unnamed bits print as bit<i>.
+func (f Features) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	for rest := f; rest != 0; rest &= rest - 1 {
+		i := bits.TrailingZeros32(uint32(rest))
+		if i < len(featureNames) && featureNames[i] != "" {
+			names = append(names, featureNames[i])
+		} else {
+			names = append(names, fmt.Sprintf("bit%d", i))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseFeatures reads Features.String's output back.
+func ParseFeatures(s string) (Features, error) {
+	var f Features
+	if s == "none" || s == "" {
+		return f, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		bit := -1
+		for i, n := range featureNames {
+			if n != "" && n == name {
+				bit = i
+			}
+		}
+		if i, err := strconv.Atoi(strings.TrimPrefix(name, "bit")); err == nil && strings.HasPrefix(name, "bit") && i >= 0 && i < 32 {
+			bit = i
+		}
+		if bit < 0 {
+			return 0, fmt.Errorf("unknown feature %q", name)
+		}
+		f |= 1 << bit
+	}
+	return f, nil
+}
+
+// Check fails with errs.ErrArtifactMismatch unless f, the features of what
+// is at hand (a proof, a profile), are want, the setup's; what names the
+// former in the error.
+func (f Features) Check(what string, want Features) error {
+	if f == want {
+		return nil
+	}
+	var diff []string
+	if extra := f &^ want; extra != 0 {
+		diff = append(diff, "extra "+extra.String())
+	}
+	if missing := want &^ f; missing != 0 {
+		diff = append(diff, "missing "+missing.String())
+	}
+	return fmt.Errorf("%w: %s has features %s, setup has %s (%s)", errs.ErrArtifactMismatch, what, f, want, strings.Join(diff, ", "))
+}
@@ -0,0 +1,44 @@
+package circuit
+
+import (
+	"errors"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestFeatures(t *testing.T) {
+	base := Profile{Name: "8", N: N}
+	if f := base.Features(); f != 0 || f.String() != "none" {
+		t.Fatalf("default profile: %s (%#x), want none", f, uint32(f))
+	}
+	p := Profile{Name: "8", N: N, DataHash: DataHashKeccak, Ordering: OrderingPermuted, Msg: MsgV2, Bounds: Bounds{SizeBits: 64}, SizeScale: 6}
+	want := FeatureKeccakRoot | FeaturePermuted | FeatureMsgV2 | FeatureBounds | FeatureDecimalSizes
+	if f := p.Features(); f != want {
+		t.Fatalf("features %s, want %s", f, want)
+	}
+
+	for _, f := range []Features{0, want, want | FeaturePlugin, FeaturePlugin | 1<<30} {
+		got, err := ParseFeatures(f.String())
+		if err != nil || got != f {
+			t.Errorf("ParseFeatures(%q) = %s, %v, want %s", f.String(), got, err, f)
+		}
+	}
+	// a setup records empty batches only as its feature bit
+	if e := (Profile{Name: "8", N: N, EmptyBatches: true}); e.Features() != FeatureEmptyBatches || !base.WithFeatures(e.Features()).EmptyBatches {
+		t.Errorf("empty batches: %s", e.Features())
+	}
+	if _, err := ParseFeatures("keccak_root,padding"); err == nil {
+		t.Error("unknown feature parsed")
+	}
+
+	if err := want.Check("proof", want); err != nil {
+		t.Fatal(err)
+	}
+	// a plugin setup's proof against the plain one, and the other way
+	for _, c := range [][2]Features{{want | FeaturePlugin, want}, {want, want | FeaturePlugin}, {FeatureUnique, FeaturePermuted}} {
+		if err := c[0].Check("proof", c[1]); !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s against %s: %v, want ErrArtifactMismatch", c[0], c[1], err)
+		}
+	}
+}
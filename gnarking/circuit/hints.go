@@ -0,0 +1,170 @@
+package circuit
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/errs"
+)
+
+// Hint is a solver hint under a stable name and version. gnark keys hints by
+// their Go function name, so renaming a hint breaks every compiled ccs and
+// changing its body silently breaks none of them: the solver runs the new
+// code against constraints written for the old, and proving fails deep in
+// the solve with an unsatisfied constraint (or worse, a gadget that under-
+// constrains its hint accepts the new output). Registered hints are keyed by
+// ID() instead, derived from name and version: bump Version whenever the
+// outputs change, and a ccs compiled against the old version asks for an ID
+// this build does not have. CheckHints catches that when the ccs is loaded.
+type Hint struct {
+	Name    string // stable across refactors, e.g. "sort-rows"
+	Version int
+	Fn      solver.Hint
+}
+
+// ID is the solver's key for h: FNV-32a of "gnarking/<name>/v<version>",
+// the hash gnark uses for its own IDs.
+func (h Hint) ID() solver.HintID {
+	f := fnv.New32a()
+	f.Write([]byte(h.key()))
+	return solver.HintID(f.Sum32())
+}
+
+func (h Hint) key() string { return fmt.Sprintf("gnarking/%s/v%d", h.Name, h.Version) }
+
+func (h Hint) String() string { return fmt.Sprintf("%s@v%d", h.Name, h.Version) }
+
+var (
+	hintsMu sync.RWMutex
+	hints   = map[string]Hint{}        // by name
+	hintIDs = map[solver.HintID]Hint{} // by ID
+)
+
+func init() {
+	for _, h := range []Hint{
+		{Name: "sort", Version: 1, Fn: sortHint},
+		{Name: "sort-rows", Version: 1, Fn: sortRowsHint},
+		{Name: "pro-rata", Version: 1, Fn: proRataHint},
+	} {
+		if err := RegisterHint(h); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterHint adds h to this package's registry and the solver's. Names are
+// unique (one version per build), and an ID already taken in the solver's
+// registry, by another hint here or by a gnark gadget, is refused rather than
+// shadowed.
+func RegisterHint(h Hint) error {
+	if h.Name == "" || h.Version <= 0 || h.Fn == nil {
+		return fmt.Errorf("invalid hint %q version %d", h.Name, h.Version)
+	}
+	hintsMu.Lock()
+	defer hintsMu.Unlock()
+	if old, ok := hints[h.Name]; ok {
+		return fmt.Errorf("hint %q already registered as %s", h.Name, old)
+	}
+	id := h.ID()
+	if old, ok := hintIDs[id]; ok {
+		return fmt.Errorf("hint %s: ID %d collides with %s", h, id, old)
+	}
+	if solver.GetRegisteredHint(id) != nil {
+		return fmt.Errorf("hint %s: ID %d collides with a solver hint", h, id)
+	}
+	solver.RegisterNamedHint(h.Fn, id)
+	hints[h.Name] = h
+	hintIDs[id] = h
+	return nil
+}
+
+// Hints returns the registered hints by name.
+func Hints() []Hint {
+	hintsMu.RLock()
+	defer hintsMu.RUnlock()
+	out := make([]Hint, 0, len(hints))
+	for _, h := range hints {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// HintSet names the registered hints and their versions, e.g.
+// "pro-rata@v1,sort@v1,sort-rows@v1". Setup records it in the manifest.
+func HintSet() string {
+	var names []string
+	for _, h := range Hints() {
+		names = append(names, h.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// CheckHintSet compares a recorded HintSet with this build's: a hint both
+// have must be at the same version. Hints only one side has are left to
+// CheckHints, which knows whether the ccs needs them. An empty set
+// (manifests written before hints were versioned) is not checked.
+func CheckHintSet(set string) error {
+	if set == "" || set == HintSet() {
+		return nil
+	}
+	hintsMu.RLock()
+	defer hintsMu.RUnlock()
+	for _, s := range strings.Split(set, ",") {
+		name, _, _ := strings.Cut(s, "@")
+		if h, ok := hints[name]; ok && h.String() != s {
+			return fmt.Errorf("%w: artifacts were set up with hints %s, this build has %s", errs.ErrArtifactMismatch, set, HintSet())
+		}
+	}
+	return nil
+}
+
+// CheckHints fails unless the solver can resolve every hint ccs depends on,
+// so a ccs compiled against other hint versions is refused on load instead
+// of when the first proof is solved.
+func CheckHints(ccs *cs_bn254.R1CS) error {
+	var missing []string
+	for id, name := range ccs.MHintsDependencies {
+		if solver.GetRegisteredHint(id) != nil {
+			continue
+		}
+		// hints called by ID are recorded under their ID only
+		if name == strconv.Itoa(int(id)) {
+			name = fmt.Sprintf("ID %d", id)
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("%w: circuit needs hints this build does not register: %s (this build has %s)",
+		errs.ErrArtifactMismatch, strings.Join(missing, ", "), HintSet())
+}
+
+// newHint is api.Compiler().NewHint for a registered hint, by name.
+func newHint(api frontend.API, name string, nbOutputs int, inputs ...frontend.Variable) ([]frontend.Variable, error) {
+	hintsMu.RLock()
+	h, ok := hints[name]
+	hintsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("hint %q not registered", name)
+	}
+	// the R1CS builder and the test engine both have it, frontend.Compiler
+	// does not
+	c, ok := api.Compiler().(interface {
+		NewHintForId(id solver.HintID, nbOutputs int, inputs ...frontend.Variable) ([]frontend.Variable, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("hint %s: compiler %T cannot call hints by ID", h, api.Compiler())
+	}
+	return c.NewHintForId(h.ID(), nbOutputs, inputs...)
+}
@@ -0,0 +1,61 @@
+package circuit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/errs"
+)
+
+func TestRegisterHint(t *testing.T) {
+	if got, want := HintSet(), "pro-rata@v1,sort@v1,sort-rows@v1"; got != want {
+		t.Fatalf("HintSet() = %q, want %q", got, want)
+	}
+	// one version per name
+	if err := RegisterHint(Hint{Name: "sort", Version: 2, Fn: sortHint}); err == nil {
+		t.Fatal("registered a second version of sort")
+	}
+	if err := RegisterHint(Hint{Name: "noop", Version: 0, Fn: sortHint}); err == nil {
+		t.Fatal("registered version 0")
+	}
+	if err := CheckHintSet("pro-rata@v1,sort@v1,sort-rows@v2"); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("CheckHintSet: %v", err)
+	}
+	// a hint this build dropped, or one it added, is the ccs's business
+	if err := CheckHintSet("pro-rata@v1,sort@v1,sort-rows@v1,split@v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckHintSet("sort@v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckHintSet(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHints(t *testing.T) {
+	p := Profile{Name: "hints", N: 4, Ordering: OrderingPermuted}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := ccs.(*cs_bn254.R1CS)
+	if err := CheckHints(r1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r1.MHintsDependencies[Hint{Name: "sort-rows", Version: 1}.ID()]; !ok {
+		t.Fatalf("ccs does not depend on sort-rows@v1: %v", r1.MHintsDependencies)
+	}
+
+	// as if compiled by a build with sort-rows@v2
+	v2 := Hint{Name: "sort-rows", Version: 2}.ID()
+	r1.MHintsDependencies[v2] = "v2"
+	if err := CheckHints(r1); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("CheckHints with an unknown hint: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// PublicInput describes one entry of the public input array, as the
+// Solidity verifier takes it (uint256[] input, Index into it).
+type PublicInput struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`  // key in public_N.json, see PublicFields
+	Type  string `json:"type"`  // range of the value: field or uintN, e.g. uint64, uint248
+	Field string `json:"field"` // Go path in the circuit, e.g. P.Pk.A.X
+	Doc   string `json:"doc"`
+}
+
+// Layout is a circuit's public inputs in order.
+type Layout []PublicInput
+
+// publicInputs are the settlement circuit's, in PublicFields order.
+var publicInputs = []PublicInput{
+	{Name: "recipient", Type: "field", Field: "P.Recipient", Doc: "settled recipient, hex in JSON"},
+	{Name: "k_old", Type: "uint64", Field: "P.KOld", Doc: "nonce settled up to before the batch"},
+	{Name: "m", Type: "uint64", Field: "P.M", Doc: "nonce settled up to after the batch, the highest row nonce"},
+	{Name: "total_settle", Type: "field", Field: "P.TotalSettle", Doc: "sum of row sizes"},
+	{Name: "chain_id", Type: "uint64", Field: "P.ChainID", Doc: "chain the rows were signed for"},
+	{Name: "pk_x", Type: "field", Field: "P.Pk.A.X", Doc: "signer's EdDSA key, x on babyjubjub, hex in JSON"},
+	{Name: "pk_y", Type: "field", Field: "P.Pk.A.Y", Doc: "signer's EdDSA key, y on babyjubjub, hex in JSON"},
+	{Name: "batch_data_root", Type: "field", Field: "P.BatchDataRoot", Doc: "commitment to the rows, see DataHash; hex in JSON"},
+}
+
+// PublicLayout is the public input layout of p's circuit. It starts with
+// PublicFields for every profile; p's Bounds narrow k_old, m and
+// total_settle, the data hash batch_data_root (DataHashKeccak keeps 248
+// bits), and a Variant may narrow them further and append its own.
+func PublicLayout(p Profile) (Layout, error) {
+	l, err := settlementLayout(p)
+	if err != nil || p.Variant == nil {
+		return l, err
+	}
+	return p.Variant.PublicLayout(p, l)
+}
+
+func settlementLayout(p Profile) (Layout, error) {
+	if _, err := ParseDataHash(p.DataHash.String()); err != nil {
+		return nil, err
+	}
+	if err := p.Bounds.Validate(); err != nil {
+		return nil, err
+	}
+	l := make(Layout, len(publicInputs))
+	copy(l, publicInputs)
+	for i := range l {
+		l[i].Index = i
+		switch {
+		case (l[i].Name == "k_old" || l[i].Name == "m") && p.Bounds.NonceBits > 0:
+			l[i].Type = fmt.Sprintf("uint%d", p.Bounds.NonceBits)
+		case l[i].Name == "total_settle" && p.Bounds.TotalBits > 0:
+			l[i].Type = fmt.Sprintf("uint%d", p.Bounds.TotalBits)
+		case l[i].Name == "batch_data_root" && p.DataHash == DataHashKeccak:
+			l[i].Type = fmt.Sprintf("uint%d", 8*keccakRootBytes)
+		}
+	}
+	return l, nil
+}
+
+// Append is l followed by ins, indexed on from l's end: a Variant's own
+// public inputs after the settlement's.
+func (l Layout) Append(ins ...PublicInput) Layout {
+	for _, in := range ins {
+		in.Index = len(l)
+		l = append(l, in)
+	}
+	return l
+}
+
+// Extra is the number of inputs past PublicFields, a Variant's own: the
+// length of SettlementCircuitPublic.Extra in a proof of the layout.
+func (l Layout) Extra() int { return max(0, len(l)-len(PublicFields)) }
+
+// Bits is the width of an input typed uintN, 0 for a field element.
+func (in PublicInput) Bits() int {
+	var bits int
+	if _, err := fmt.Sscanf(in.Type, "uint%d", &bits); err != nil {
+		return 0
+	}
+	return bits
+}
+
+// String is l as an aligned table, one input per line.
+func (l Layout) String() string { return l.Table(nil) }
+
+// Table is l as an aligned table with values, e.g. the exported input words,
+// in a column next to the inputs they should be: a misordered input array
+// shows as values under the wrong names. values may be nil.
+func (l Layout) Table(values []string) string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	if values != nil {
+		fmt.Fprintln(tw, "#\tname\ttype\tvalue\tfield\tdoc")
+	} else {
+		fmt.Fprintln(tw, "#\tname\ttype\tfield\tdoc")
+	}
+	for _, in := range l {
+		if values != nil {
+			v := "(missing)"
+			if in.Index < len(values) {
+				v = values[in.Index]
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", in.Index, in.Name, in.Type, v, in.Field, in.Doc)
+		} else {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", in.Index, in.Name, in.Type, in.Field, in.Doc)
+		}
+	}
+	if len(values) > len(l) {
+		fmt.Fprintf(tw, "\t(%d extra values)\t\t\t\t\n", len(values)-len(l))
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// WriteTo writes l as indented JSON.
+func (l Layout) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
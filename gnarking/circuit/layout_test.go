@@ -0,0 +1,50 @@
+package circuit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+)
+
+// TestPublicLayout checks the layout against the order gnark lays the
+// public witness out in, which the Solidity verifier's input array follows.
+func TestPublicLayout(t *testing.T) {
+	var walked []string
+	tVariable := reflect.TypeOf((*frontend.Variable)(nil)).Elem()
+	_, err := schema.Walk(ecc.BN254.ScalarField(), NewSettlementCircuit(N), tVariable, func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility == schema.Public {
+			walked = append(walked, strings.ReplaceAll(leaf.FullName(), "_", "."))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []Profile{{Name: "m", N: N}, {Name: "k", N: N, DataHash: DataHashKeccak}} {
+		l, err := PublicLayout(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(l) != len(walked) || len(l) != len(PublicFields) {
+			t.Fatalf("%d inputs in the layout, %d in the circuit, %d PublicFields", len(l), len(walked), len(PublicFields))
+		}
+		for i, in := range l {
+			if in.Index != i || in.Field != walked[i] || in.Name != PublicFields[i] {
+				t.Errorf("input %d: layout has %s (%s) at %d, circuit %s, PublicFields %s", i, in.Name, in.Field, in.Index, walked[i], PublicFields[i])
+			}
+		}
+		if root := l[len(l)-1].Type; (p.DataHash == DataHashKeccak) != (root == "uint248") {
+			t.Errorf("data hash %s: batch_data_root is %s", p.DataHash, root)
+		}
+	}
+
+	l, _ := PublicLayout(Profile{Name: "m", N: N})
+	if table := l.Table([]string{"0x1", "0x2"}); !strings.Contains(table, "(missing)") || !strings.Contains(table, "0x2") {
+		t.Errorf("table with short values:\n%s", table)
+	}
+}
@@ -0,0 +1,151 @@
+package circuit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"golang.org/x/crypto/sha3"
+)
+
+// refMiMC is MiMC-BN254 as the signed row messages assume it, written from
+// the construction rather than from gnark-crypto: Miyaguchi-Preneel over the
+// MiMC-x^5 block cipher, 110 rounds, round constants the Keccak-256 chain of
+// "seed", zero initial state, one 32-byte big-endian field element a block.
+// Everything is math/big mod r, so an upstream change to any of these (or
+// to the block encoding) shows up as a mismatch below instead of as
+// signatures no other implementation accepts.
+type refMiMC struct {
+	h *big.Int
+}
+
+const refMiMCRounds = 110
+
+// refMiMCConstants derives the round constants: c_0 = keccak(keccak("seed")),
+// c_i = keccak(c_{i-1}), each read big-endian mod r.
+func refMiMCConstants() []*big.Int {
+	r := ecc.BN254.ScalarField()
+	keccak := func(b []byte) []byte {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(b)
+		return h.Sum(nil)
+	}
+	rnd := keccak([]byte("seed"))
+	out := make([]*big.Int, refMiMCRounds)
+	for i := range out {
+		rnd = keccak(rnd)
+		out[i] = new(big.Int).Mod(new(big.Int).SetBytes(rnd), r)
+	}
+	return out
+}
+
+// encrypt is the MiMC cipher E_k(m): m <- (m + k + c_i)^5 for every round,
+// then m + k.
+func (d *refMiMC) encrypt(m *big.Int) *big.Int {
+	r := ecc.BN254.ScalarField()
+	five := big.NewInt(5)
+	m = new(big.Int).Set(m)
+	for _, c := range refMiMCConstants() {
+		m.Add(m, d.h).Add(m, c)
+		m.Exp(m, five, r)
+	}
+	return m.Add(m, d.h).Mod(m, r)
+}
+
+// write absorbs one block: h <- E_h(x) + h + x.
+func (d *refMiMC) write(x *big.Int) {
+	r := ecc.BN254.ScalarField()
+	if d.h == nil {
+		d.h = new(big.Int)
+	}
+	e := d.encrypt(x)
+	d.h = e.Add(e, d.h).Add(e, x).Mod(e, r)
+}
+
+// sum is the state, 32 bytes big-endian.
+func (d *refMiMC) sum() []byte {
+	if d.h == nil {
+		d.h = new(big.Int)
+	}
+	return d.h.FillBytes(make([]byte, 32))
+}
+
+func refMiMCHash(xs ...*big.Int) []byte {
+	var d refMiMC
+	for _, x := range xs {
+		d.write(x)
+	}
+	return d.sum()
+}
+
+func TestMiMCMatchesReference(t *testing.T) {
+	want := refMiMCConstants()
+	got := bnMimc.GetConstants()
+	if len(got) != len(want) {
+		t.Fatalf("gnark-crypto has %d MiMC rounds, reference %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Cmp(want[i]) != 0 {
+			t.Fatalf("round constant %d: gnark-crypto %s, reference %s", i, got[i].String(), want[i])
+		}
+	}
+
+	mod := ecc.BN254.ScalarField()
+	domain, domainV2 := new(big.Int).SetBytes(DOMAIN), new(big.Int).SetBytes(DOMAIN_V2)
+	for i := 0; i < 8; i++ {
+		var vals [4]*big.Int
+		for j := range vals {
+			v, err := rand.Int(rand.Reader, mod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vals[j] = v
+		}
+		recipient, size, nonce, chainID := vals[0], vals[1], vals[2], vals[3]
+
+		// the domain-separated preimages, as the row messages order them
+		if got, want := MimcMsg(recipient, size, nonce, chainID), refMiMCHash(domain, recipient, size, nonce, chainID); !bytes.Equal(got, want) {
+			t.Fatalf("v1 message: gnark-crypto %x, reference %x", got, want)
+		}
+		if got, want := MimcMsgV2(recipient, size, nonce, chainID), refMiMCHash(domainV2, recipient, chainID, size, nonce); !bytes.Equal(got, want) {
+			t.Fatalf("v2 message: gnark-crypto %x, reference %x", got, want)
+		}
+		// the prefix state rows resume from
+		h := bnMimc.NewMiMC()
+		h.Write(encodeFieldElement(domainV2))
+		h.Write(encodeFieldElement(recipient))
+		h.Write(encodeFieldElement(chainID))
+		if got, want := h.State(), refMiMCHash(domainV2, recipient, chainID); !bytes.Equal(got, want) {
+			t.Fatalf("v2 prefix state: gnark-crypto %x, reference %x", got, want)
+		}
+	}
+
+	// pinned, so the reference itself can't drift along with upstream
+	for _, c := range []struct {
+		v      MsgVersion
+		domain []byte
+		want   string
+	}{
+		{MsgV1, DOMAIN, refMsgV1},
+		{MsgV2, DOMAIN_V2, refMsgV2},
+	} {
+		got := refMiMCHash(new(big.Int).SetBytes(c.domain), big.NewInt(42), big.NewInt(1), big.NewInt(1), big.NewInt(1))
+		if hex.EncodeToString(got) != c.want {
+			t.Errorf("%s reference over (42, 1, 1, 1) = %x, pinned %s", c.v, got, c.want)
+		}
+		if msg := MsgHash(c.v, big.NewInt(42), big.NewInt(1), big.NewInt(1), big.NewInt(1)); hex.EncodeToString(msg) != c.want {
+			t.Errorf("%s message of (42, 1, 1, 1) = %x, pinned %s", c.v, msg, c.want)
+		}
+	}
+}
+
+// the messages of recipient 42, size 1, nonce 1, chain 1 (the argument
+// order is the same for both, only the domain differs)
+const (
+	refMsgV1 = "15903546d9bcd422f9b2cff87ab5e41ed52bd693ef69c1284d9ca8290f1e2a3e"
+	refMsgV2 = "1851a2c74ad3b6ba995448af5e6f2a02cb27d228648ce3724bf10e3f2bb387f7"
+)
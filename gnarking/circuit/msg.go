@@ -0,0 +1,276 @@
+package circuit
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/permutation/sha2"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// MsgVersion selects the signed per-row message format.
+//
+//   - MsgV1: MiMC("msettle1", Recipient, Size, Nonce, ChainID)
+//   - MsgV2: MiMC("msettle2", Recipient, ChainID, Size, Nonce)
+//   - MsgSHA256: SHA-256(Recipient || ChainID || "msettle3" || Size || Nonce)
+//     mod r, each value 32 bytes big-endian
+//
+// All hash the row-independent prefix once per batch and resume every row
+// from its state. V2 moves ChainID into that prefix, leaving two absorptions
+// per row instead of three; V1 stays for signers that already produce it, and
+// is the cheapest for per-row chain IDs (CrossChainSettlementCircuit), which
+// the other versions hash into a prefix per row. MsgSHA256 is for
+// signers whose crypto libraries have no MiMC: Recipient || ChainID is its
+// one-block prefix, each row costs two SHA-256 compressions, tens of
+// thousands of constraints against a few hundred for MiMC (ddm describe, or
+// settlement_demo --hash-report, has the counts). The signature itself is
+// still EdDSA with MiMC.
+type MsgVersion uint8
+
+const (
+	MsgV1 MsgVersion = iota
+	MsgV2
+	MsgSHA256
+)
+
+var (
+	DOMAIN_V2     = []byte("msettle2")
+	DOMAIN_SHA256 = []byte("msettle3")
+)
+
+func (v MsgVersion) String() string {
+	switch v {
+	case MsgV1:
+		return "v1"
+	case MsgV2:
+		return "v2"
+	case MsgSHA256:
+		return "sha256"
+	default:
+		return fmt.Sprintf("MsgVersion(%d)", uint8(v))
+	}
+}
+
+func ParseMsgVersion(s string) (MsgVersion, error) {
+	switch s {
+	case "v1":
+		return MsgV1, nil
+	case "v2":
+		return MsgV2, nil
+	case "sha256":
+		return MsgSHA256, nil
+	default:
+		return 0, fmt.Errorf("unknown message version %q (want v1, v2 or sha256)", s)
+	}
+}
+
+// msgHasher hashes row messages in-circuit from a shared prefix state.
+type msgHasher struct {
+	api     frontend.API
+	version MsgVersion
+	prefix  frontend.Variable
+	// MsgSHA256: the state after the prefix block
+	uapi  *uints.BinaryField[uints.U32]
+	state [8]uints.U32
+}
+
+// newMsgHasher absorbs the batch prefix once. chainID is part of the prefix
+// for MsgV2 and MsgSHA256 only; V1 takes it per row.
+func newMsgHasher(api frontend.API, v MsgVersion, recipient, chainID frontend.Variable) (*msgHasher, error) {
+	if v == MsgSHA256 {
+		uapi, err := uints.New[uints.U32](api)
+		if err != nil {
+			return nil, err
+		}
+		var block [64]uints.U8
+		copy(block[:32], wordBytes(api, uapi, recipient))
+		copy(block[32:], wordBytes(api, uapi, chainID))
+		var iv [8]uints.U32
+		for w := range iv {
+			iv[w] = uints.NewU32(sha256IV[w])
+		}
+		return &msgHasher{api: api, version: v, uapi: uapi, state: sha2.Permute(uapi, iv, block)}, nil
+	}
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	switch v {
+	case MsgV1:
+		h.Write(new(big.Int).SetBytes(DOMAIN), recipient)
+	case MsgV2:
+		h.Write(new(big.Int).SetBytes(DOMAIN_V2), recipient, chainID)
+	default:
+		return nil, fmt.Errorf("unsupported message version %s", v)
+	}
+	return &msgHasher{api: api, version: v, prefix: h.State()[0]}, nil
+}
+
+// sum returns msg_i for one row. chainID is ignored for MsgV2 and
+// MsgSHA256, which bound it in the prefix.
+func (m *msgHasher) sum(size, nonce, chainID frontend.Variable) (frontend.Variable, error) {
+	if m.version == MsgSHA256 {
+		return m.sumSHA256(size, nonce), nil
+	}
+	h, err := stdMimc.NewMiMC(m.api)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.SetState([]frontend.Variable{m.prefix}); err != nil {
+		return nil, err
+	}
+	switch m.version {
+	case MsgV1:
+		h.Write(size, nonce, chainID)
+	case MsgV2:
+		h.Write(size, nonce)
+	}
+	return h.Sum(), nil
+}
+
+// sha256IV is SHA-256's initial state.
+var sha256IV = [8]uint32{0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19}
+
+// sha256MsgLen is the bytes of a MsgSHA256 message: four values and the
+// domain.
+const sha256MsgLen = 4*32 + 8
+
+// sumSHA256 hashes the row's two blocks, domain, Size, Nonce and the
+// padding, from the prefix state and reads the digest mod r.
+func (m *msgHasher) sumSHA256(size, nonce frontend.Variable) frontend.Variable {
+	tail := make([]uints.U8, 0, 128)
+	for _, b := range DOMAIN_SHA256 {
+		tail = append(tail, uints.NewU8(b))
+	}
+	tail = append(tail, wordBytes(m.api, m.uapi, size)...)
+	tail = append(tail, wordBytes(m.api, m.uapi, nonce)...)
+	tail = append(tail, uints.NewU8(0x80))
+	for len(tail) < 120 {
+		tail = append(tail, uints.NewU8(0))
+	}
+	var bits [8]byte
+	binary.BigEndian.PutUint64(bits[:], sha256MsgLen*8)
+	for _, b := range bits {
+		tail = append(tail, uints.NewU8(b))
+	}
+	state := m.state
+	for b := range 2 {
+		state = sha2.Permute(m.uapi, state, [64]uints.U8(tail[64*b:64*b+64]))
+	}
+	// the digest read big-endian wraps mod r, as fr.Element.SetBytes does
+	msg := frontend.Variable(0)
+	for _, w := range state {
+		msg = m.api.Add(m.api.Mul(msg, 1<<32), m.uapi.ToValue(w))
+	}
+	return msg
+}
+
+// wordBytes is x as 32 big-endian bytes, from its canonical binary
+// decomposition.
+func wordBytes(api frontend.API, uapi *uints.BinaryField[uints.U32], x frontend.Variable) []uints.U8 {
+	bits := api.ToBinary(x)
+	out := make([]uints.U8, 32)
+	for k := range out {
+		lo := 8 * (31 - k)
+		byteVal := frontend.Variable(0)
+		if lo < len(bits) {
+			byteVal = api.FromBinary(bits[lo:min(lo+8, len(bits))]...)
+		}
+		out[k] = uapi.ByteValueOf(byteVal)
+	}
+	return out
+}
+
+// MsgHasher is the native counterpart: it computes the prefix state once and
+// hashes rows from it. Results equal MimcMsg (V1) / MimcMsgV2 / Sha256Msg.
+type MsgHasher struct {
+	version MsgVersion
+	prefix  []byte // the MiMC state; for MsgSHA256 the prefix block itself
+}
+
+func NewMsgHasher(v MsgVersion, recipient, chainID *big.Int) (*MsgHasher, error) {
+	if v == MsgSHA256 {
+		return &MsgHasher{version: v, prefix: append(encodeFieldElement(recipient), encodeFieldElement(chainID)...)}, nil
+	}
+	h := bnMimc.NewMiMC()
+	switch v {
+	case MsgV1:
+		h.Write(encodeFieldElement(new(big.Int).SetBytes(DOMAIN)))
+		h.Write(encodeFieldElement(recipient))
+	case MsgV2:
+		h.Write(encodeFieldElement(new(big.Int).SetBytes(DOMAIN_V2)))
+		h.Write(encodeFieldElement(recipient))
+		h.Write(encodeFieldElement(chainID))
+	default:
+		return nil, fmt.Errorf("unsupported message version %s", v)
+	}
+	return &MsgHasher{version: v, prefix: h.State()}, nil
+}
+
+// Sum returns msg_i for one row; chainID is ignored for MsgV2 and
+// MsgSHA256.
+func (m *MsgHasher) Sum(size, nonce, chainID *big.Int) []byte {
+	if m.version == MsgSHA256 {
+		return sha256Msg(m.prefix, size, nonce)
+	}
+	h := bnMimc.NewMiMC()
+	// prefix came out of State(), it is always a canonical element
+	if err := h.SetState(m.prefix); err != nil {
+		panic(err)
+	}
+	h.Write(encodeFieldElement(size))
+	h.Write(encodeFieldElement(nonce))
+	if m.version == MsgV1 {
+		h.Write(encodeFieldElement(chainID))
+	}
+	return h.Sum(nil)
+}
+
+// MimcMsgV2 is msg_i = MiMC("msettle2", Recipient, ChainID, Size[i], Nonce[i]),
+// hashed in one go like MimcMsg.
+func MimcMsgV2(recipient, size, nonce, chainID *big.Int) []byte {
+	h := bnMimc.NewMiMC()
+	h.Write(encodeFieldElement(new(big.Int).SetBytes(DOMAIN_V2)))
+	h.Write(encodeFieldElement(recipient))
+	h.Write(encodeFieldElement(chainID))
+	h.Write(encodeFieldElement(size))
+	h.Write(encodeFieldElement(nonce))
+	return h.Sum(nil)
+}
+
+// Sha256Msg is msg_i = SHA-256(Recipient || ChainID || "msettle3" ||
+// Size[i] || Nonce[i]) mod r, each value 32 bytes big-endian, what a signer
+// with standard crypto libraries computes before signing.
+func Sha256Msg(recipient, size, nonce, chainID *big.Int) []byte {
+	return sha256Msg(append(encodeFieldElement(recipient), encodeFieldElement(chainID)...), size, nonce)
+}
+
+func sha256Msg(prefix []byte, size, nonce *big.Int) []byte {
+	h := sha256.New()
+	h.Write(prefix)
+	h.Write(DOMAIN_SHA256)
+	h.Write(encodeFieldElement(size))
+	h.Write(encodeFieldElement(nonce))
+	var msg fr.Element
+	msg.SetBytes(h.Sum(nil))
+	b := msg.Bytes()
+	return b[:]
+}
+
+// MsgHash returns the message for one row in the given format.
+func MsgHash(v MsgVersion, recipient, size, nonce, chainID *big.Int) []byte {
+	switch v {
+	case MsgV2:
+		return MimcMsgV2(recipient, size, nonce, chainID)
+	case MsgSHA256:
+		return Sha256Msg(recipient, size, nonce, chainID)
+	}
+	return MimcMsg(recipient, size, nonce, chainID)
+}
@@ -0,0 +1,101 @@
+package circuit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+)
+
+func TestMsgHasher_MatchesFullHash(t *testing.T) {
+	mod := ecc.BN254.ScalarField()
+	for i := 0; i < 16; i++ {
+		var vals [4]*big.Int
+		for j := range vals {
+			v, err := rand.Int(rand.Reader, mod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vals[j] = v
+		}
+		recipient, size, nonce, chainID := vals[0], vals[1], vals[2], vals[3]
+
+		for _, v := range msgVersions() {
+			h, err := NewMsgHasher(v, recipient, chainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := h.Sum(size, nonce, chainID), MsgHash(v, recipient, size, nonce, chainID); !bytes.Equal(got, want) {
+				t.Fatalf("%s: prefix hasher %x, full hash %x", v, got, want)
+			}
+		}
+	}
+}
+
+func TestSettlementCircuit_MsgV2(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	sizes := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	v2 := signedSettlement(assert, priv, MsgV2, 0, sizes, nonces)
+	v1 := signedSettlement(assert, priv, MsgV1, 0, sizes, nonces)
+
+	c := NewSettlementCircuit(N)
+	c.Msg = MsgV2
+	assert.CheckCircuit(
+		c,
+		test.WithValidAssignment(&v2),
+		// V1 signatures don't verify under the V2 message
+		test.WithInvalidAssignment(&v1),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+		test.NoProverChecks(),
+	)
+
+	// V2 absorbs one field element less per row
+	ccsV1, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, NewSettlementCircuit(N))
+	assert.NoError(err)
+	ccsV2, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c)
+	assert.NoError(err)
+	assert.Less(ccsV2.GetNbConstraints(), ccsV1.GetNbConstraints())
+}
+
+func TestSettlementCircuit_MsgSHA256(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	sizes := []int64{1, 2, 3}
+	nonces := []int64{1, 2, 3}
+	valid := signedSettlement(assert, priv, MsgSHA256, 0, sizes, nonces)
+	v2 := signedSettlement(assert, priv, MsgV2, 0, sizes, nonces)
+
+	c := NewSettlementCircuit(len(sizes))
+	c.Msg = MsgSHA256
+	assert.CheckCircuit(
+		c,
+		test.WithValidAssignment(&valid),
+		// MiMC message signatures don't verify under the SHA-256 one
+		test.WithInvalidAssignment(&v2),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+		test.NoProverChecks(),
+	)
+}
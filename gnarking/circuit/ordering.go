@@ -0,0 +1,194 @@
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+)
+
+// Ordering selects how SettlementCircuit constrains Nonce[].
+//
+//   - OrderingMonotonic: KOld < Nonce[0] < ... < Nonce[N-1] == M.
+//   - OrderingUnique: Nonce[i] are row IDs in any order, only required to be
+//     pairwise distinct. KOld must be 0 and M == max(Nonce). Replay protection
+//     moves to the contract, which must reject a BatchDataRoot (or row ID)
+//     it has already settled.
+//   - OrderingPermuted: rows in any order, their sorted view monotonic:
+//     KOld < sorted Nonce[0] < ... < sorted Nonce[N-1] == M. Rows are sorted
+//     by a hinted permutation checked with a grand product, and
+//     BatchDataRoot is over the sorted rows (see RowsRoot), so callers need
+//     not pre-sort.
+type Ordering uint8
+
+const (
+	OrderingMonotonic Ordering = iota
+	OrderingUnique
+	OrderingPermuted
+)
+
+func (o Ordering) String() string {
+	switch o {
+	case OrderingMonotonic:
+		return "monotonic"
+	case OrderingUnique:
+		return "unique"
+	case OrderingPermuted:
+		return "permuted"
+	default:
+		return fmt.Sprintf("Ordering(%d)", uint8(o))
+	}
+}
+
+func ParseOrdering(s string) (Ordering, error) {
+	switch s {
+	case "monotonic":
+		return OrderingMonotonic, nil
+	case "unique":
+		return OrderingUnique, nil
+	case "permuted":
+		return OrderingPermuted, nil
+	default:
+		return 0, fmt.Errorf("unknown ordering %q (want monotonic, unique or permuted)", s)
+	}
+}
+
+// sortHint outputs its inputs in ascending order.
+func sortHint(_ *big.Int, inputs, outputs []*big.Int) error {
+	if len(inputs) != len(outputs) {
+		return fmt.Errorf("sortHint: %d inputs, %d outputs", len(inputs), len(outputs))
+	}
+	sorted := make([]*big.Int, len(inputs))
+	copy(sorted, inputs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	for i := range sorted {
+		outputs[i].Set(sorted[i])
+	}
+	return nil
+}
+
+// sortRowsHint takes n sizes then n nonces and outputs them reordered by
+// ascending nonce, in the same layout.
+func sortRowsHint(_ *big.Int, inputs, outputs []*big.Int) error {
+	if len(inputs) != len(outputs) || len(inputs)%2 != 0 {
+		return fmt.Errorf("sortRowsHint: %d inputs, %d outputs", len(inputs), len(outputs))
+	}
+	n := len(inputs) / 2
+	perm := sortedPerm(inputs[n:])
+	for i, j := range perm {
+		outputs[i].Set(inputs[j])
+		outputs[n+i].Set(inputs[n+j])
+	}
+	return nil
+}
+
+// sortedPerm returns the indices of nonces in ascending nonce order, ties in
+// input order.
+func sortedPerm(nonces []*big.Int) []int {
+	perm := make([]int, len(nonces))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(a, b int) bool { return nonces[perm[a]].Cmp(nonces[perm[b]]) < 0 })
+	return perm
+}
+
+// SortRows returns copies of the rows ordered by ascending nonce, the order
+// OrderingPermuted roots them in.
+func SortRows(sizes, nonces []*big.Int) ([]*big.Int, []*big.Int) {
+	perm := sortedPerm(nonces)
+	sortedSizes := make([]*big.Int, len(perm))
+	sortedNonces := make([]*big.Int, len(perm))
+	for i, j := range perm {
+		sortedSizes[i], sortedNonces[i] = sizes[j], nonces[j]
+	}
+	return sortedSizes, sortedNonces
+}
+
+// RowsRoot is the BatchDataRoot a circuit with ordering o commits to: over
+// the rows sorted by nonce for OrderingPermuted, as given otherwise.
+func RowsRoot(h DataHash, o Ordering, sizes, nonces []*big.Int) (*big.Int, error) {
+	if o == OrderingPermuted {
+		sizes, nonces = SortRows(sizes, nonces)
+	}
+	return BatchDataRoot(h, sizes, nonces)
+}
+
+// sortedView returns vals in ascending order. The order itself is left to the
+// caller; this only proves the result is a permutation of vals with the
+// grand-product check PROD(r - vals[i]) == PROD(r - sorted[i]), where the
+// challenge r = MiMC(vals, sorted) is fixed by both sides before use.
+func sortedView(api frontend.API, vals []frontend.Variable) ([]frontend.Variable, error) {
+	sorted, err := newHint(api, "sort", len(vals), vals...)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(vals...)
+	h.Write(sorted...)
+	r := h.Sum()
+
+	lhs, rhs := frontend.Variable(1), frontend.Variable(1)
+	for i := range vals {
+		lhs = api.Mul(lhs, api.Sub(r, vals[i]))
+		rhs = api.Mul(rhs, api.Sub(r, sorted[i]))
+	}
+	api.AssertIsEqual(lhs, rhs)
+
+	return sorted, nil
+}
+
+// assertUniqueIDs enforces pairwise distinct ids (any order), KOld == 0 and
+// M == max(ids).
+func assertUniqueIDs(less nonceLess, api frontend.API, kOld, m frontend.Variable, ids []frontend.Variable) error {
+	sorted, err := sortedView(api, ids)
+	if err != nil {
+		return err
+	}
+	// strictly increasing sorted view <=> no duplicates
+	for i := 0; i < len(sorted)-1; i++ {
+		less(sorted[i], sorted[i+1])
+	}
+	api.AssertIsEqual(kOld, 0)
+	api.AssertIsEqual(m, sorted[len(sorted)-1])
+	return nil
+}
+
+// sortedRows returns the rows reordered by ascending nonce. The order itself
+// is left to the caller, as in sortedView; the permutation is proven with
+// PROD(r - row_i) == PROD(r - sorted_i) over rows folded to
+// row = Nonce + a*Size, both challenges MiMC-derived from all the values.
+func sortedRows(api frontend.API, size, nonce []frontend.Variable) ([]frontend.Variable, []frontend.Variable, error) {
+	n := len(nonce)
+	out, err := newHint(api, "sort-rows", 2*n, append(append([]frontend.Variable{}, size...), nonce...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	sortedSize, sortedNonce := out[:n], out[n:]
+
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(size...)
+	h.Write(nonce...)
+	h.Write(out...)
+	a := h.Sum()
+	h.Write(a)
+	r := h.Sum()
+
+	lhs, rhs := frontend.Variable(1), frontend.Variable(1)
+	for i := 0; i < n; i++ {
+		lhs = api.Mul(lhs, api.Sub(r, api.Add(nonce[i], api.Mul(a, size[i]))))
+		rhs = api.Mul(rhs, api.Sub(r, api.Add(sortedNonce[i], api.Mul(a, sortedSize[i]))))
+	}
+	api.AssertIsEqual(lhs, rhs)
+
+	return sortedSize, sortedNonce, nil
+}
@@ -0,0 +1,150 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/signature"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/test"
+)
+
+// signedSettlement builds a len(sizes)-row SettlementCircuit assignment with
+// every row signed by priv over message format v. M is set to max(nonces).
+func signedSettlement(assert *test.Assert, priv signature.Signer, v MsgVersion, kOld int64, sizes, nonces []int64) SettlementCircuit {
+	n := len(sizes)
+	w := *NewSettlementCircuit(n)
+	recipient := big.NewInt(42)
+	chainID := big.NewInt(1)
+
+	w.P.Recipient = recipient
+	w.P.ChainID = chainID
+	w.P.KOld = big.NewInt(kOld)
+
+	total := big.NewInt(0)
+	m := int64(0)
+	bSizes := make([]*big.Int, n)
+	bNonces := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		bSizes[i] = big.NewInt(sizes[i])
+		bNonces[i] = big.NewInt(nonces[i])
+		w.Size[i] = bSizes[i]
+		w.Nonce[i] = bNonces[i]
+
+		sigBytes, err := EdDSA{}.Sign(priv, MsgHash(v, recipient, bSizes[i], bNonces[i], chainID))
+		assert.NoError(err)
+		w.Sig[i].Assign(te.BN254, sigBytes)
+
+		total.Add(total, bSizes[i])
+		m = max(m, nonces[i])
+	}
+	w.P.TotalSettle = total
+	w.P.M = big.NewInt(m)
+	w.P.Pk.Assign(te.BN254, priv.Public().Bytes())
+	root, err := BatchDataRoot(DataHashMiMC, bSizes, bNonces)
+	assert.NoError(err)
+	w.P.BatchDataRoot = root
+	return w
+}
+
+func TestSettlementCircuit_UniqueOrdering(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	sizes := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	unordered := []int64{907, 13, 512, 77, 1000, 3, 42, 600}
+	duplicate := []int64{907, 13, 512, 77, 1000, 13, 42, 600}
+
+	valid := signedSettlement(assert, priv, MsgV1, 0, sizes, unordered)
+	invalidDup := signedSettlement(assert, priv, MsgV1, 0, sizes, duplicate)
+
+	// M must be the max ID
+	invalidM := valid
+	invalidM.P.M = big.NewInt(907)
+
+	// KOld is pinned to 0 in unique mode
+	invalidKOld := valid
+	invalidKOld.P.KOld = big.NewInt(1)
+
+	c := *NewSettlementCircuit(N)
+	c.Ordering = OrderingUnique
+	assert.CheckCircuit(
+		&c,
+		test.WithValidAssignment(&valid),
+		test.WithInvalidAssignment(&invalidDup),
+		test.WithInvalidAssignment(&invalidM),
+		test.WithInvalidAssignment(&invalidKOld),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	// the same unordered rows are rejected by the default monotonic mode
+	monotonic := NewSettlementCircuit(N)
+	assert.SolvingFailed(monotonic, &valid, test.WithCurves(ecc.BN254), test.WithBackends(backend.GROTH16))
+}
+
+func TestSettlementCircuit_PermutedOrdering(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	kOld := int64(10)
+	sizes := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	shuffled := []int64{15, 11, 18, 13, 12, 17, 14, 16}
+	// the same rows sorted by nonce
+	sortedSizes := []int64{2, 5, 4, 7, 1, 8, 6, 3}
+	sortedNonces := []int64{11, 12, 13, 14, 15, 16, 17, 18}
+
+	// rows arrive in any order, the root is over the sorted rows
+	rooted := func(nonces []int64) SettlementCircuit {
+		w := signedSettlement(assert, priv, MsgV1, kOld, sizes, nonces)
+		bSizes, bNonces := make([]*big.Int, len(sizes)), make([]*big.Int, len(sizes))
+		for i := range sizes {
+			bSizes[i], bNonces[i] = big.NewInt(sizes[i]), big.NewInt(nonces[i])
+		}
+		root, err := RowsRoot(DataHashMiMC, OrderingPermuted, bSizes, bNonces)
+		assert.NoError(err)
+		w.P.BatchDataRoot = root
+		return w
+	}
+	valid := rooted(shuffled)
+	// pre-sorted rows root as given, as in monotonic mode
+	validSorted := signedSettlement(assert, priv, MsgV1, kOld, sortedSizes, sortedNonces)
+	invalidDup := rooted([]int64{15, 11, 18, 13, 12, 17, 14, 15})
+	invalidKOld := rooted([]int64{15, 10, 18, 13, 12, 17, 14, 16})
+
+	// the root over the rows as given does not match
+	invalidRoot := signedSettlement(assert, priv, MsgV1, kOld, sizes, shuffled)
+
+	invalidM := valid
+	invalidM.P.M = big.NewInt(16)
+
+	c := *NewSettlementCircuit(N)
+	c.Ordering = OrderingPermuted
+	assert.CheckCircuit(
+		&c,
+		test.WithValidAssignment(&valid),
+		test.WithValidAssignment(&validSorted),
+		test.WithInvalidAssignment(&invalidDup),
+		test.WithInvalidAssignment(&invalidKOld),
+		test.WithInvalidAssignment(&invalidRoot),
+		test.WithInvalidAssignment(&invalidM),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	// the order rows arrive in does not change the root
+	assert.Equal(validSorted.P.BatchDataRoot, valid.P.BatchDataRoot)
+}
@@ -0,0 +1,213 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"gnarking/errs"
+)
+
+// Bit widths PartialSettlementCircuit range-checks to. With Size < 2^64 and
+// RatioNum, RatioDen < 2^32 every product below stays far under the field
+// modulus, so the fixed-point equations cannot wrap.
+const (
+	SizeBits  = 64
+	RatioBits = 32
+)
+
+// PartialPublic is PartialSettlementCircuit's own public inputs, after
+// SettlementCircuitPublic's, whose TotalSettle is then the pro-rata total
+// SUM(floor(Size[i] * RatioNum / RatioDen)) instead of SUM(Size[i]).
+type PartialPublic struct {
+	RatioNum frontend.Variable `gnark:",public"`
+	RatioDen frontend.Variable `gnark:",public"`
+}
+
+// PartialSettlementCircuit settles a batch pro rata, e.g. while liquidity
+// is short: every row is settled at floor(Size[i] * RatioNum / RatioDen),
+// 0 < RatioDen, RatioNum <= RatioDen, rounding down so the batch never pays
+// more than the ratio. Rows, signatures and BatchDataRoot are over the full
+// signed sizes, as in SettlementCircuit, so the remainder stays provable
+// against the same data.
+type PartialSettlementCircuit struct {
+	P     SettlementCircuitPublic
+	X     PartialPublic
+	Size  []frontend.Variable
+	Nonce []frontend.Variable
+	Sig   []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewPartialSettlementCircuit allocates the rows of an n-row batch.
+func NewPartialSettlementCircuit(n int) *PartialSettlementCircuit {
+	s := NewSettlementCircuit(n)
+	return &PartialSettlementCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig}
+}
+
+// PartialCircuit returns p's PartialSettlementCircuit, rows allocated and
+// config set, as Circuit does for SettlementCircuit.
+func (p Profile) PartialCircuit() *PartialSettlementCircuit {
+	c := NewPartialSettlementCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (c *PartialSettlementCircuit) Define(api frontend.API) error {
+	n := len(c.Size)
+	if n == 0 {
+		return fmt.Errorf("partial settlement circuit rows: %d sizes", n)
+	}
+
+	// 0. 0 < RatioDen < 2^32, 0 <= RatioNum <= RatioDen. Plain bit
+	//    decompositions: std/rangecheck would add a commitment, changing the
+	//    proof and verifier format.
+	api.ToBinary(c.X.RatioNum, RatioBits)
+	api.ToBinary(c.X.RatioDen, RatioBits)
+	api.ToBinary(api.Sub(c.X.RatioDen, c.X.RatioNum), RatioBits)
+	api.AssertIsDifferent(c.X.RatioDen, 0)
+
+	// 1. Settled[i] = floor(Size[i] * RatioNum / RatioDen), from a hint:
+	//    Size[i] * RatioNum == Settled[i] * RatioDen + Rem[i], Rem[i] < RatioDen
+	//    and SUM(Settled[i]) == TotalSettle
+	in := append([]frontend.Variable{c.X.RatioNum, c.X.RatioDen}, c.Size...)
+	out, err := newHint(api, "pro-rata", 2*n, in...)
+	if err != nil {
+		return err
+	}
+	settled, rem := out[:n], out[n:]
+	sum, total := frontend.Variable(0), frontend.Variable(0)
+	for i := 0; i < n; i++ {
+		api.ToBinary(c.Size[i], SizeBits)
+		api.ToBinary(settled[i], SizeBits)
+		api.ToBinary(rem[i], RatioBits)
+		api.ToBinary(api.Sub(c.X.RatioDen, api.Add(rem[i], 1)), RatioBits)
+		api.AssertIsEqual(api.Mul(c.Size[i], c.X.RatioNum), api.Add(api.Mul(settled[i], c.X.RatioDen), rem[i]))
+		sum = api.Add(sum, settled[i])
+		total = api.Add(total, c.Size[i])
+	}
+	api.AssertIsEqual(sum, c.P.TotalSettle)
+
+	// 2-6. the settlement constraints over the full sizes
+	p := c.P
+	p.TotalSettle = total
+	inner := SettlementCircuit{
+		P:            p,
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+	}
+	return inner.Define(api)
+}
+
+// proRataHint takes num, den, then n sizes and outputs the n quotients
+// floor(size * num / den) followed by the n remainders.
+func proRataHint(_ *big.Int, inputs, outputs []*big.Int) error {
+	if len(inputs) < 2 || len(outputs) != 2*(len(inputs)-2) {
+		return fmt.Errorf("proRataHint: %d inputs, %d outputs", len(inputs), len(outputs))
+	}
+	num, den := inputs[0], inputs[1]
+	if den.Sign() == 0 {
+		return fmt.Errorf("proRataHint: zero denominator")
+	}
+	sizes := inputs[2:]
+	n := len(sizes)
+	for i, size := range sizes {
+		outputs[i].QuoRem(new(big.Int).Mul(size, num), den, outputs[n+i])
+	}
+	return nil
+}
+
+// ProRata is the native counterpart of the in-circuit settled amounts: each
+// row's floor(size * num / den) and their total, the TotalSettle of a
+// PartialSettlementCircuit.
+func ProRata(sizes []*big.Int, num, den *big.Int) (settled []*big.Int, total *big.Int, err error) {
+	maxRatio := new(big.Int).Lsh(big.NewInt(1), RatioBits)
+	if den.Sign() <= 0 || den.Cmp(maxRatio) >= 0 || num.Sign() < 0 || num.Cmp(den) > 0 {
+		return nil, nil, fmt.Errorf("%w: settle ratio %s/%s outside 0 <= num <= den < 2^%d, den > 0", errs.ErrInvalidInput, num, den, RatioBits)
+	}
+	maxSize := new(big.Int).Lsh(big.NewInt(1), SizeBits)
+	total = new(big.Int)
+	settled = make([]*big.Int, len(sizes))
+	for i, size := range sizes {
+		if size.Sign() < 0 || size.Cmp(maxSize) >= 0 {
+			return nil, nil, fmt.Errorf("%w: row %d: size %s outside [0, 2^%d)", errs.ErrInvalidBatch, i, size, SizeBits)
+		}
+		settled[i] = new(big.Int).Mul(size, num)
+		settled[i].Quo(settled[i], den)
+		total.Add(total, settled[i])
+	}
+	return settled, total, nil
+}
+
+// PartialSettlement is the Variant proving PartialSettlementCircuit.
+// Profile "partial-8" is the built-in one. A batch's variant inputs are its
+// settle ratio, e.g. {"num": 2, "den": 3}; its total_settle is then the
+// pro-rata total, and ratio_num, ratio_den follow the PublicFields.
+type PartialSettlement struct{}
+
+// PartialInputs is a partially settled batch's variant inputs.
+type PartialInputs struct {
+	Num uint32 `json:"num"`
+	Den uint32 `json:"den"`
+}
+
+func (PartialSettlement) Define(p Profile) frontend.Circuit { return p.PartialCircuit() }
+
+// WitnessFromBatch settles base's rows at the ratio natively, so a ratio
+// outside [0, 1] is errs.ErrInvalidInput before it reaches the solver.
+func (PartialSettlement) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	if err != nil || len(raw) != 2 || raw["num"] == nil || raw["den"] == nil {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"num": ..., "den": ...}`, errs.ErrInvalidInput)
+	}
+	var in PartialInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	sizes, err := fieldInts(base.Size...)
+	if err != nil {
+		return nil, err
+	}
+	num, den := new(big.Int).SetUint64(uint64(in.Num)), new(big.Int).SetUint64(uint64(in.Den))
+	_, total, err := ProRata(sizes, num, den)
+	if err != nil {
+		return nil, err
+	}
+	c := p.PartialCircuit()
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	c.P.TotalSettle = total
+	c.X.RatioNum, c.X.RatioDen = num, den
+	return c, nil
+}
+
+func (PartialSettlement) PublicLayout(p Profile, base Layout) (Layout, error) {
+	for i := range base {
+		if base[i].Name == "total_settle" {
+			base[i].Doc = "sum of floor(size * ratio_num / ratio_den) over the rows, rounded down row by row"
+		}
+	}
+	return base.Append(
+		PublicInput{Name: "ratio_num", Type: fmt.Sprintf("uint%d", RatioBits), Field: "X.RatioNum", Doc: "settle ratio numerator, at most ratio_den"},
+		PublicInput{Name: "ratio_den", Type: fmt.Sprintf("uint%d", RatioBits), Field: "X.RatioDen", Doc: "settle ratio denominator, not 0"},
+	), nil
+}
+
+func (PartialSettlement) feature() Features { return FeaturePartial }
@@ -0,0 +1,140 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+// TestPartialProfile proves through the built-in profile, as the servers
+// and settlement_demo do: the ratio is the batch's variant inputs and
+// public inputs after the PublicFields, total_settle the pro-rata total.
+func TestPartialProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p, err := LookupProfile("partial-8")
+	assert.NoError(err)
+	assert.Equal(FeaturePartial, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(2, l.Extra())
+	assert.Equal("ratio_den", l[len(l)-1].Name)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	sizes := []int64{10, 7, 1, 100, 3, 64, 5, 999}
+	s := signedSettlement(assert, priv, MsgV1, 0, sizes, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	assign := func(in string) *PartialSettlementCircuit {
+		c, err := p.Assign(&s, json.RawMessage(in))
+		assert.NoError(err)
+		return c.(*PartialSettlementCircuit)
+	}
+	// 2/3: every row but 3 rounds down
+	valid := assign(`{"num": 2, "den": 3}`)
+	assert.Equal(int64(789), valid.P.TotalSettle.(*big.Int).Int64())
+	w, err := frontend.NewWitness(valid, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	pub, err := PublicFromWitness(w)
+	assert.NoError(err)
+	assert.Equal(2, len(pub.Extra))
+	assert.Equal(0, pub.TotalSettle.(*big.Int).Cmp(big.NewInt(789)))
+	// 1/1 settles everything
+	full := assign(`{"num": 1, "den": 1}`)
+	assert.Equal(0, full.P.TotalSettle.(*big.Int).Cmp(s.P.TotalSettle.(*big.Int)))
+
+	// rounded up instead of down
+	roundedUp := *valid
+	roundedUp.P.TotalSettle = big.NewInt(790)
+	// full total claimed under a ratio
+	unscaled := *valid
+	unscaled.P.TotalSettle = s.P.TotalSettle
+	// more than the rows are worth: 3/2 of them
+	overOne := *valid
+	overOne.X.RatioNum, overOne.X.RatioDen = big.NewInt(3), big.NewInt(2)
+	overOne.P.TotalSettle = big.NewInt(1783)
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(valid),
+		test.WithValidAssignment(full),
+		test.WithInvalidAssignment(&roundedUp),
+		test.WithInvalidAssignment(&unscaled),
+		test.WithInvalidAssignment(&overOne),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, in := range map[string]string{
+		"over one":       `{"num": 3, "den": 2}`,
+		"zero den":       `{"num": 0, "den": 0}`,
+		"negative":       `{"num": -1, "den": 2}`,
+		"missing den":    `{"num": 1}`,
+		"unknown member": `{"num": 1, "den": 2, "rows": []}`,
+		"no inputs":      ``,
+	} {
+		if _, err := p.Assign(&s, json.RawMessage(in)); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%s: %v, want ErrInvalidInput", name, err)
+		}
+	}
+}
+
+// TestPartialProfile_Bounds checks the deployment's Bounds reach the
+// settlement constraints under the ratio.
+func TestPartialProfile_Bounds(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	p, err := LookupProfile("partial-8")
+	assert.NoError(err)
+	p.Bounds = Bounds{MinSize: 3}
+
+	nonces := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	assign := func(sizes []int64) frontend.Circuit {
+		s := signedSettlement(assert, priv, MsgV1, 0, sizes, nonces)
+		c, err := p.Assign(&s, json.RawMessage(`{"num": 1, "den": 2}`))
+		assert.NoError(err)
+		return c
+	}
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(assign([]int64{3, 3, 4, 5, 6, 7, 8, 9})),
+		// a dust row, however it rounds
+		test.WithInvalidAssignment(assign([]int64{3, 3, 4, 5, 6, 7, 8, 2})),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+}
+
+func TestProRata(t *testing.T) {
+	sizes := []*big.Int{big.NewInt(10), big.NewInt(1)}
+	for _, r := range [][2]int64{{1, 0}, {3, 2}, {-1, 2}, {1, 1 << 32}} {
+		if _, _, err := ProRata(sizes, big.NewInt(r[0]), big.NewInt(r[1])); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("ratio %d/%d: %v", r[0], r[1], err)
+		}
+	}
+	tooBig := []*big.Int{new(big.Int).Lsh(big.NewInt(1), SizeBits)}
+	if _, _, err := ProRata(tooBig, big.NewInt(1), big.NewInt(2)); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("size 2^%d: %v", SizeBits, err)
+	}
+	settled, total, err := ProRata(sizes, big.NewInt(0), big.NewInt(7))
+	if err != nil || total.Sign() != 0 || settled[0].Sign() != 0 {
+		t.Errorf("0/7: %v %v %v", settled, total, err)
+	}
+}
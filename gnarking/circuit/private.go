@@ -0,0 +1,156 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+
+	"gnarking/errs"
+)
+
+// PrivateRecipientPublic is SettlementCircuitPublic with Recipient replaced
+// by RecipientCommitment = MiMC(Recipient, Blinding), in its place: the
+// public inputs keep PublicFields order, "recipient" being the commitment.
+type PrivateRecipientPublic struct {
+	RecipientCommitment frontend.Variable  `gnark:",public"`
+	KOld                frontend.Variable  `gnark:",public"`
+	M                   frontend.Variable  `gnark:",public"`
+	TotalSettle         frontend.Variable  `gnark:",public"`
+	ChainID             frontend.Variable  `gnark:",public"`
+	Pk                  stdEddsa.PublicKey `gnark:",public"`
+	BatchDataRoot       frontend.Variable  `gnark:",public"`
+}
+
+// PrivateRecipientCircuit is the privacy mode of SettlementCircuit: the
+// recipient is a witness, only its blinded commitment is public. Row
+// signatures still bind the real Recipient, and the holder of the viewing
+// key (see package viewkey) can open the commitment.
+type PrivateRecipientCircuit struct {
+	P         PrivateRecipientPublic
+	Recipient frontend.Variable
+	Blinding  frontend.Variable
+	Size      []frontend.Variable
+	Nonce     []frontend.Variable
+	Sig       []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewPrivateRecipientCircuit allocates the rows of an n-row batch.
+func NewPrivateRecipientCircuit(n int) *PrivateRecipientCircuit {
+	s := NewSettlementCircuit(n)
+	return &PrivateRecipientCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig}
+}
+
+// PrivateCircuit returns p's PrivateRecipientCircuit, rows allocated and
+// config set, as Circuit does for SettlementCircuit.
+func (p Profile) PrivateCircuit() *PrivateRecipientCircuit {
+	c := NewPrivateRecipientCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (c *PrivateRecipientCircuit) Define(api frontend.API) error {
+	// 0. RecipientCommitment == MiMC(Recipient, Blinding)
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Recipient, c.Blinding)
+	api.AssertIsEqual(h.Sum(), c.P.RecipientCommitment)
+
+	// 1-6. the settlement constraints over the hidden recipient
+	inner := SettlementCircuit{
+		P: SettlementCircuitPublic{
+			Recipient:     c.Recipient,
+			KOld:          c.P.KOld,
+			M:             c.P.M,
+			TotalSettle:   c.P.TotalSettle,
+			ChainID:       c.P.ChainID,
+			Pk:            c.P.Pk,
+			BatchDataRoot: c.P.BatchDataRoot,
+		},
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+	}
+	return inner.Define(api)
+}
+
+// RecipientCommitment is the native MiMC(recipient, blinding).
+func RecipientCommitment(recipient, blinding *big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	h.Write(encodeFieldElement(recipient))
+	h.Write(encodeFieldElement(blinding))
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// PrivateRecipient is the Variant proving PrivateRecipientCircuit: the
+// "recipient" public input is the commitment, opened by the blinding a
+// batch gives as its variant inputs, {"blinding": "<field element>"}.
+// Profile "private-8" is the built-in one.
+type PrivateRecipient struct{}
+
+// PrivateInputs is a private-recipient batch's variant inputs.
+type PrivateInputs struct {
+	Blinding FieldJSON `json:"blinding"`
+}
+
+func (PrivateRecipient) Define(p Profile) frontend.Circuit { return p.PrivateCircuit() }
+
+func (PrivateRecipient) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	if err != nil || len(raw) != 1 || raw["blinding"] == nil {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"blinding": ...}`, errs.ErrInvalidInput)
+	}
+	var in PrivateInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, err
+	}
+	var recipient fr.Element
+	if _, err := recipient.SetInterface(base.P.Recipient); err != nil {
+		return nil, fmt.Errorf("%w: recipient: %w", errs.ErrInvalidInput, err)
+	}
+	r, blinding := recipient.BigInt(new(big.Int)), (*big.Int)(&in.Blinding)
+	c := p.PrivateCircuit()
+	c.P = PrivateRecipientPublic{
+		RecipientCommitment: RecipientCommitment(r, blinding),
+		KOld:                base.P.KOld,
+		M:                   base.P.M,
+		TotalSettle:         base.P.TotalSettle,
+		ChainID:             base.P.ChainID,
+		Pk:                  base.P.Pk,
+		BatchDataRoot:       base.P.BatchDataRoot,
+	}
+	c.Recipient, c.Blinding = r, blinding
+	c.Size, c.Nonce, c.Sig = base.Size, base.Nonce, base.Sig
+	return c, nil
+}
+
+func (PrivateRecipient) PublicLayout(p Profile, base Layout) (Layout, error) {
+	base[0].Field = "P.RecipientCommitment"
+	base[0].Doc = "MiMC(recipient, blinding), the recipient hidden (package viewkey opens it); hex in JSON"
+	return base, nil
+}
+
+func (PrivateRecipient) feature() Features { return FeaturePrivate }
@@ -0,0 +1,106 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+func TestPrivateRecipientCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+
+	// signedSettlement signs for recipient 42
+	s := signedSettlement(assert, priv, MsgV1, 0, []int64{1, 1, 1, 1, 1, 1, 1, 1}, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	recipient, blinding := big.NewInt(42), big.NewInt(987654321)
+
+	valid := PrivateRecipientCircuit{
+		P: PrivateRecipientPublic{
+			RecipientCommitment: RecipientCommitment(recipient, blinding),
+			KOld:                s.P.KOld,
+			M:                   s.P.M,
+			TotalSettle:         s.P.TotalSettle,
+			ChainID:             s.P.ChainID,
+			Pk:                  s.P.Pk,
+			BatchDataRoot:       s.P.BatchDataRoot,
+		},
+		Recipient: recipient,
+		Blinding:  blinding,
+		Size:      s.Size,
+		Nonce:     s.Nonce,
+		Sig:       s.Sig,
+	}
+
+	// commitment opened with another blinding
+	invalidBlinding := valid
+	invalidBlinding.Blinding = big.NewInt(1)
+
+	// consistent commitment to a recipient the rows were not signed for
+	invalidRecipient := valid
+	invalidRecipient.Recipient = big.NewInt(43)
+	invalidRecipient.P.RecipientCommitment = RecipientCommitment(big.NewInt(43), blinding)
+
+	assert.CheckCircuit(
+		NewPrivateRecipientCircuit(N),
+		test.WithValidAssignment(&valid),
+		test.WithInvalidAssignment(&invalidBlinding),
+		test.WithInvalidAssignment(&invalidRecipient),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+}
+
+// TestPrivateRecipientProfile proves through the built-in profile, as the
+// servers and settlement_demo do: the blinding is the batch's variant
+// input, the commitment takes the recipient's public input.
+func TestPrivateRecipientProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p, err := LookupProfile("private-8")
+	assert.NoError(err)
+	assert.Equal(FeaturePrivate, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal("P.RecipientCommitment", l[0].Field)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	s := signedSettlement(assert, priv, MsgV1, 0, []int64{1, 1, 1, 1, 1, 1, 1, 1}, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	blinding := big.NewInt(987654321)
+	extra, err := json.Marshal(&PrivateInputs{Blinding: FieldJSON(*blinding)})
+	assert.NoError(err)
+	full, err := p.Assign(&s, extra)
+	assert.NoError(err)
+
+	w, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	pub, err := PublicFromWitness(w)
+	assert.NoError(err)
+	assert.Equal(RecipientCommitment(big.NewInt(42), blinding), pub.Recipient)
+	diff, err := DiffPublic(pub, s.P)
+	assert.NoError(err)
+	assert.Equal([]string{"recipient"}, diff)
+
+	for _, in := range []string{``, `{}`, `{"blinding": "1", "recipient": "42"}`} {
+		if _, err := p.Assign(&s, json.RawMessage(in)); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("variant inputs %q: %v", in, err)
+		}
+	}
+	assert.NoError(test.IsSolved(p.Define(), full, ecc.BN254.ScalarField()))
+}
@@ -0,0 +1,139 @@
+package circuit
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gnarking/errs"
+)
+
+// Profile is one circuit shape a binary can compile, prove and verify: the
+// batch size plus the compile-time config. The name keys artifacts
+// (pk_<name>.groth16, ...), manifests and API requests.
+type Profile struct {
+	Name     string
+	N        int
+	DataHash DataHash
+	Ordering Ordering
+	Msg      MsgVersion
+	Bounds   Bounds // from the deployment parameters, zero for built-ins
+	// SizeScale is the decimal places of sizes in batch JSON, from the
+	// deployment parameters; the circuit only sees base units.
+	SizeScale int
+	// Variant, when set, is the circuit compiled and proven instead of
+	// SettlementCircuit, registered by a program building on this module
+	Variant Variant
+	// EmptyBatches lets the circuit prove empty batches, heartbeats that
+	// settle nothing (SettlementCircuit.EmptyBatches); setup records it as
+	// FeatureEmptyBatches
+	EmptyBatches bool
+}
+
+// DefaultProfile is used when no profile is given.
+const DefaultProfile = "8"
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{}
+)
+
+func init() {
+	// built-ins are named by their batch size, so the default profile's
+	// artifacts keep their pk_8.groth16, ... names
+	for _, n := range []int{N, 64, 512} {
+		if err := RegisterProfile(Profile{Name: fmt.Sprint(n), N: n}); err != nil {
+			panic(err)
+		}
+	}
+	// the built-in variants, at the default batch size
+	for _, p := range []Profile{
+		{Name: "crosschain-8", N: N, Variant: CrossChain{}},
+		{Name: "private-8", N: N, Variant: PrivateRecipient{}},
+		{Name: "partial-8", N: N, Variant: PartialSettlement{}},
+		{Name: "accumulator-8", N: N, Variant: ChainedAccumulator{}},
+		{Name: "epochcap-8", N: N, Variant: EpochCap{}},
+		{Name: "revocation-8", N: N, Variant: Revocation{}},
+		// its co-signer is a deployment's, see Params.Apply
+		{Name: "cosign-8", N: N, Variant: Cosign{}},
+	} {
+		if err := RegisterProfile(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterProfile adds a profile; names are unique. It is safe to call
+// while other goroutines look profiles up, e.g. from a plugin's init (see
+// package plugins). A profile with a Variant is checked to keep the
+// settlement public inputs.
+func RegisterProfile(p Profile) error {
+	if p.Name == "" || p.N <= 0 {
+		return fmt.Errorf("%w: invalid profile %q with N = %d", errs.ErrInvalidInput, p.Name, p.N)
+	}
+	if p.Variant != nil {
+		if err := checkVariant(p); err != nil {
+			return err
+		}
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if _, ok := profiles[p.Name]; ok {
+		return fmt.Errorf("%w: profile %q already registered", errs.ErrDuplicate, p.Name)
+	}
+	profiles[p.Name] = p
+	return nil
+}
+
+func LookupProfile(name string) (Profile, error) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := profiles[name]
+	if !ok {
+		return p, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// Profiles lists the registered profiles by batch size, then name.
+func Profiles() []Profile {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	out := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].N != out[j].N {
+			return out[i].N < out[j].N
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Circuit returns the profile's SettlementCircuit, rows allocated and
+// config set; use it both to compile and as the assignment.
+func (p Profile) Circuit() *SettlementCircuit {
+	c := NewSettlementCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (p Profile) String() string {
+	s := fmt.Sprintf("%s (N = %d, data hash %s, ordering %s, msg %s", p.Name, p.N, p.DataHash, p.Ordering, p.Msg)
+	if !p.Bounds.IsZero() {
+		s += ", " + p.Bounds.String()
+	}
+	if p.SizeScale > 0 {
+		s += fmt.Sprintf(", sizes at %d decimals", p.SizeScale)
+	}
+	if p.EmptyBatches {
+		s += ", empty batches"
+	}
+	if p.Variant != nil {
+		s += fmt.Sprintf(", variant %T", p.Variant)
+	}
+	return s + ")"
+}
@@ -0,0 +1,45 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/test"
+)
+
+func TestProfiles(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, name := range []string{"8", "64", "512"} {
+		p, err := LookupProfile(name)
+		assert.NoError(err)
+		assert.Equal(name, p.Name)
+	}
+	assert.Error(RegisterProfile(Profile{Name: DefaultProfile, N: 8}), "duplicate name")
+
+	// a registered profile of any size compiles and proves
+	assert.NoError(RegisterProfile(Profile{Name: "test-3-v2", N: 3, Msg: MsgV2}))
+	p, err := LookupProfile("test-3-v2")
+	assert.NoError(err)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	valid := signedSettlement(assert, priv, MsgV2, 0, []int64{5, 6, 7}, []int64{1, 2, 3})
+	// 8-row assignment for a 3-row circuit
+	wrongSize := signedSettlement(assert, priv, MsgV2, 0, []int64{1, 1, 1, 1, 1, 1, 1, 1}, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+
+	assert.CheckCircuit(
+		p.Circuit(),
+		test.WithValidAssignment(&valid),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+	assert.SolvingFailed(p.Circuit(), &wrongSize, test.WithCurves(ecc.BN254), test.WithBackends(backend.GROTH16))
+}
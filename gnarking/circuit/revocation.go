@@ -0,0 +1,187 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+
+	"gnarking/errs"
+)
+
+// RevocationDepth is the depth of the revocation tree: a key's slot is its
+// whole RevocationKey, so no two keys share one and none can be ground into
+// a revoked key's slot.
+const RevocationDepth = fr.Bits
+
+// RevocationPublic is RevocationCircuit's own public input, after
+// SettlementCircuitPublic's: the root of the revocation tree the contract
+// pins. Updating the root revokes keys without a new setup.
+type RevocationPublic struct {
+	RevocationRoot frontend.Variable `gnark:",public"`
+}
+
+// RevocationCircuit is SettlementCircuit for a key that is not revoked: the
+// revocation tree is a sparse Merkle tree whose leaf at a revoked key's slot
+// is its RevocationKey and 0 elsewhere, and the batch proves the leaf at
+// Pk's slot is empty.
+type RevocationCircuit struct {
+	P SettlementCircuitPublic
+	X RevocationPublic
+	// Siblings is the path from the leaf at Pk's slot to the root, leaf
+	// level first
+	Siblings [RevocationDepth]frontend.Variable
+	Size     []frontend.Variable
+	Nonce    []frontend.Variable
+	Sig      []stdEddsa.Signature
+
+	// compile-time config, as in SettlementCircuit
+	DataHash     DataHash   `gnark:"-"`
+	Ordering     Ordering   `gnark:"-"`
+	Msg          MsgVersion `gnark:"-"`
+	Scheme       SigScheme  `gnark:"-"`
+	Bounds       Bounds     `gnark:"-"`
+	EmptyBatches bool       `gnark:"-"`
+}
+
+// NewRevocationCircuit allocates the rows of an n-row batch.
+func NewRevocationCircuit(n int) *RevocationCircuit {
+	s := NewSettlementCircuit(n)
+	return &RevocationCircuit{Size: s.Size, Nonce: s.Nonce, Sig: s.Sig}
+}
+
+func (c *RevocationCircuit) Define(api frontend.API) error {
+	// 0a. key = MiMC(Pk.X, Pk.Y); its slot is its canonical decomposition
+	key, err := mimc2(api, c.P.Pk.A.X, c.P.Pk.A.Y)
+	if err != nil {
+		return err
+	}
+	slot := api.ToBinary(key, RevocationDepth)
+
+	// 0b. the leaf at slot is empty under RevocationRoot: Pk is not revoked
+	var node frontend.Variable = 0
+	for i, sibling := range c.Siblings {
+		left := api.Select(slot[i], sibling, node)
+		right := api.Select(slot[i], node, sibling)
+		if node, err = mimc2(api, left, right); err != nil {
+			return err
+		}
+	}
+	api.AssertIsEqual(node, c.X.RevocationRoot)
+
+	// 1-6. the settlement constraints
+	inner := SettlementCircuit{
+		P:            c.P,
+		Size:         c.Size,
+		Nonce:        c.Nonce,
+		Sig:          c.Sig,
+		DataHash:     c.DataHash,
+		Ordering:     c.Ordering,
+		Msg:          c.Msg,
+		Scheme:       c.Scheme,
+		Bounds:       c.Bounds,
+		EmptyBatches: c.EmptyBatches,
+	}
+	return inner.Define(api)
+}
+
+func mimc2(api frontend.API, a, b frontend.Variable) (frontend.Variable, error) {
+	h, err := stdMimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(a, b)
+	return h.Sum(), nil
+}
+
+// RevocationKey is the native MiMC(pkX, pkY): a key's slot in the
+// revocation tree, and its leaf there once revoked.
+func RevocationKey(pkX, pkY *big.Int) *big.Int {
+	return RevocationNode(pkX, pkY)
+}
+
+// RevocationNode is the native MiMC(left, right), an inner node of the
+// revocation tree.
+func RevocationNode(left, right *big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	h.Write(encodeFieldElement(left))
+	h.Write(encodeFieldElement(right))
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// Revocation is the Variant proving RevocationCircuit. Profile
+// "revocation-8" is the built-in one. A batch's variant inputs are the
+// non-membership witness of its operator key, {"root": ..., "siblings":
+// [...]}, as `ddm revoke witness` writes it (revocation.NonMembership);
+// revocation_root follows the PublicFields.
+type Revocation struct{}
+
+// RevocationInputs is a batch's variant inputs: the pinned root and the
+// RevocationDepth siblings of Pk's slot, leaf level first.
+type RevocationInputs struct {
+	Root     FieldJSON   `json:"root"`
+	Siblings []FieldJSON `json:"siblings"`
+}
+
+func (v Revocation) circuit(p Profile) *RevocationCircuit {
+	c := NewRevocationCircuit(p.N)
+	c.DataHash, c.Ordering, c.Msg, c.Bounds = p.DataHash, p.Ordering, p.Msg, p.Bounds
+	c.EmptyBatches = p.EmptyBatches
+	return c
+}
+
+func (v Revocation) Define(p Profile) frontend.Circuit { return v.circuit(p) }
+
+// WitnessFromBatch opens the path natively, so a revoked key, or a path
+// under another root, is errs.ErrPolicyRejected before it reaches the
+// solver.
+func (v Revocation) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	raw, err := decodeObject(extra)
+	if err != nil || len(raw) != 2 || raw["root"] == nil || raw["siblings"] == nil {
+		return nil, fmt.Errorf(`%w: variant inputs: want {"root": ..., "siblings": [...]}`, errs.ErrInvalidInput)
+	}
+	var in RevocationInputs
+	if err := json.Unmarshal(extra, &in); err != nil {
+		return nil, fmt.Errorf("%w: variant inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(in.Siblings) != RevocationDepth {
+		return nil, fmt.Errorf("%w: variant inputs: %d siblings, want %d", errs.ErrInvalidInput, len(in.Siblings), RevocationDepth)
+	}
+	pk, err := fieldInts(base.P.Pk.A.X, base.P.Pk.A.Y)
+	if err != nil {
+		return nil, err
+	}
+	c := v.circuit(p)
+	slot := RevocationKey(pk[0], pk[1])
+	node := new(big.Int)
+	for i := range in.Siblings {
+		sibling := (*big.Int)(&in.Siblings[i])
+		if slot.Bit(i) == 0 {
+			node = RevocationNode(node, sibling)
+		} else {
+			node = RevocationNode(sibling, node)
+		}
+		c.Siblings[i] = sibling
+	}
+	root := (*big.Int)(&in.Root)
+	if node.Cmp(root) != 0 {
+		return nil, fmt.Errorf("%w: path from an empty slot at the batch's key opens to %s, not the root %s", errs.ErrPolicyRejected, node, root)
+	}
+	c.P, c.Size, c.Nonce, c.Sig = base.P, base.Size, base.Nonce, base.Sig
+	c.X.RevocationRoot = root
+	return c, nil
+}
+
+func (Revocation) PublicLayout(p Profile, base Layout) (Layout, error) {
+	return base.Append(
+		PublicInput{Name: "revocation_root", Type: "field", Field: "X.RevocationRoot", Doc: "root of the revocation tree the contract pins; pk's slot in it is empty"},
+	), nil
+}
+
+func (Revocation) feature() Features { return FeatureRevocation }
@@ -0,0 +1,160 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+func TestRevocationCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	s := signedSettlement(assert, priv, MsgV1, 0, []int64{1, 1, 1, 1, 1, 1, 1, 1}, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+	key := RevocationKey(new(big.Int).SetBytes(s.P.Pk.A.X.([]byte)), new(big.Int).SetBytes(s.P.Pk.A.Y.([]byte)))
+
+	var zero [RevocationDepth + 1]*big.Int
+	zero[0] = new(big.Int)
+	for i := range RevocationDepth {
+		zero[i+1] = RevocationNode(zero[i], zero[i])
+	}
+	// the root of a tree holding leaf at slot alone, and the path of key's
+	// slot in it
+	path := func(slot, leaf *big.Int) (root *big.Int, siblings [RevocationDepth]frontend.Variable) {
+		n := leaf
+		for h := range RevocationDepth {
+			siblings[h] = zero[h]
+			if new(big.Int).Rsh(slot, uint(h)).Cmp(new(big.Int).Xor(new(big.Int).Rsh(key, uint(h)), big.NewInt(1))) == 0 {
+				siblings[h] = n
+			}
+			if slot.Bit(h) == 0 {
+				n = RevocationNode(n, zero[h])
+			} else {
+				n = RevocationNode(zero[h], n)
+			}
+		}
+		return n, siblings
+	}
+	assign := func(root *big.Int, siblings [RevocationDepth]frontend.Variable) *RevocationCircuit {
+		c := NewRevocationCircuit(N)
+		c.P, c.Size, c.Nonce, c.Sig = s.P, s.Size, s.Nonce, s.Sig
+		c.X.RevocationRoot, c.Siblings = root, siblings
+		return c
+	}
+	// inputs is the batch's variant inputs for a path
+	inputs := func(root *big.Int, siblings [RevocationDepth]frontend.Variable) json.RawMessage {
+		in := RevocationInputs{Root: FieldJSON(*root)}
+		for _, sib := range siblings {
+			in.Siblings = append(in.Siblings, FieldJSON(*sib.(*big.Int)))
+		}
+		b, err := json.Marshal(&in)
+		assert.NoError(err)
+		return b
+	}
+
+	// nothing revoked
+	empty := assign(path(key, zero[0]))
+	// another key revoked: in the neighbouring slot, and in one sharing
+	// key's low 64 bits, which a truncated slot would have confused
+	neighbour := new(big.Int).Xor(key, big.NewInt(1))
+	ground := new(big.Int).Xor(key, new(big.Int).Lsh(big.NewInt(1), 200))
+	beside := assign(path(neighbour, neighbour))
+	sameLow := assign(path(ground, ground))
+	// Pk itself revoked
+	revoked := assign(path(key, key))
+
+	p, err := LookupProfile("revocation-8")
+	assert.NoError(err)
+	assert.Equal(FeatureRevocation, p.Features())
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal(1, l.Extra())
+	assert.Equal("revocation_root", l[len(PublicFields)].Name)
+	// the profile's witness is the one assigned by hand
+	c, err := p.Assign(&s, inputs(path(key, zero[0])))
+	assert.NoError(err)
+	assert.Equal(empty.X, c.(*RevocationCircuit).X)
+	assert.Equal(empty.Siblings, c.(*RevocationCircuit).Siblings)
+	w, err := frontend.NewWitness(c, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	pub, err := PublicFromWitness(w)
+	assert.NoError(err)
+	assert.Equal(1, len(pub.Extra))
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(empty),
+		test.WithValidAssignment(beside),
+		test.WithValidAssignment(sameLow),
+		test.WithInvalidAssignment(revoked),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, tc := range map[string]struct {
+		in   json.RawMessage
+		want error
+	}{
+		"revoked":        {inputs(path(key, key)), errs.ErrPolicyRejected},
+		"short path":     {json.RawMessage(`{"root": "1", "siblings": ["0"]}`), errs.ErrInvalidInput},
+		"no root":        {json.RawMessage(`{"siblings": []}`), errs.ErrInvalidInput},
+		"unknown member": {json.RawMessage(`{"root": "1", "siblings": [], "pk": "00"}`), errs.ErrInvalidInput},
+	} {
+		if _, err := p.Assign(&s, tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+// TestRevocationProfile_Bounds checks the deployment's Bounds reach the
+// settlement constraints under the revocation check.
+func TestRevocationProfile_Bounds(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	p, err := LookupProfile("revocation-8")
+	assert.NoError(err)
+	p.Bounds = Bounds{MinSize: 3}
+
+	// nothing revoked: every sibling an empty subtree
+	in := RevocationInputs{Siblings: make([]FieldJSON, RevocationDepth)}
+	zero := new(big.Int)
+	for i := range in.Siblings {
+		in.Siblings[i] = FieldJSON(*zero)
+		zero = RevocationNode(zero, zero)
+	}
+	in.Root = FieldJSON(*zero)
+	b, err := json.Marshal(&in)
+	assert.NoError(err)
+	assign := func(sizes []int64) frontend.Circuit {
+		s := signedSettlement(assert, priv, MsgV1, 0, sizes, []int64{1, 2, 3, 4, 5, 6, 7, 8})
+		c, err := p.Assign(&s, b)
+		assert.NoError(err)
+		return c
+	}
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(assign([]int64{3, 3, 4, 5, 6, 7, 8, 9})),
+		test.WithInvalidAssignment(assign([]int64{3, 3, 4, 5, 6, 7, 8, 2})),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+}
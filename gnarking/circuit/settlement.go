@@ -5,17 +5,23 @@ import (
 	"io"
 	"bytes"
 
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/algebra/native/twistededwards"
-	stdMimc "github.com/consensys/gnark/std/hash/mimc"
 	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
 
-	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+
+	"gnarking/errs"
 )
 
+// N is the batch size of the default profile.
 const N = 8
 
 // SettlementCircuitPublic is your circuit-level public inputs.
@@ -26,17 +32,112 @@ type SettlementCircuitPublic struct {
 	TotalSettle frontend.Variable  `gnark:",public"`
 	ChainID     frontend.Variable  `gnark:",public"`
 	Pk          stdEddsa.PublicKey `gnark:",public"`
+	// BatchDataRoot commits to every (Size, Nonce) row, see DataHash
+	BatchDataRoot frontend.Variable `gnark:",public"`
+	// Extra are a Variant's own public inputs, after the PublicFields;
+	// the variant's circuit declares them, the settlement circuit has none
+	Extra []frontend.Variable `gnark:"-"`
+}
+
+// PublicFields names the public inputs in witness order, which is also the
+// Solidity verifier's, by their public JSON keys.
+var PublicFields = []string{"recipient", "k_old", "m", "total_settle", "chain_id", "pk_x", "pk_y", "batch_data_root"}
+
+// vars is s's inputs in PublicFields order.
+func (s *SettlementCircuitPublic) vars() []*frontend.Variable {
+	return []*frontend.Variable{&s.Recipient, &s.KOld, &s.M, &s.TotalSettle, &s.ChainID, &s.Pk.A.X, &s.Pk.A.Y, &s.BatchDataRoot}
+}
+
+// checkFields fails unless got has exactly the PublicFields, naming what is
+// missing and what is extra.
+func checkFields(got map[string]json.RawMessage) error {
+	var missing, extra []string
+	for _, f := range PublicFields {
+		if _, ok := got[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	for f := range got {
+		if !slices.Contains(PublicFields, f) {
+			extra = append(extra, f)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	slices.Sort(extra)
+	return fmt.Errorf("%w: public inputs: missing [%s], unexpected [%s]; want [%s]", errs.ErrInvalidInput,
+		strings.Join(missing, " "), strings.Join(extra, " "), strings.Join(PublicFields, " "))
 }
 
 // JSON form — the same fields but ready for JSON.
 type SettlementCircuitPublicJSON struct {
-	Recipient   string `json:"recipient"`     // hex
-	KOld        uint64 `json:"k_old"`
-	M           uint64 `json:"m"`
-	TotalSettle uint64 `json:"total_settle"`
-	ChainID     uint64 `json:"chain_id"`
-	PkX         string `json:"pk_x"`         // hex
-	PkY         string `json:"pk_y"`         // hex
+	Recipient     string    `json:"recipient"` // hex
+	KOld          FieldJSON `json:"k_old"`
+	M             FieldJSON `json:"m"`
+	TotalSettle   FieldJSON `json:"total_settle"`
+	ChainID       FieldJSON `json:"chain_id"`
+	PkX           string    `json:"pk_x"`            // hex
+	PkY           string    `json:"pk_y"`            // hex
+	BatchDataRoot string    `json:"batch_data_root"` // hex
+	// Extra is a variant's public inputs in its layout's order, absent
+	// for the settlement circuit
+	Extra []FieldJSON `json:"extra,omitempty"`
+}
+
+// FieldJSON is a BN254 scalar field element in JSON, the way gnark takes a
+// frontend.Variable from a string: written as a decimal string, read from a
+// decimal or 0x-hex string, or from a plain JSON number as files written
+// before the string form have it. Values outside [0, r) are refused rather
+// than reduced.
+type FieldJSON big.Int
+
+func (f *FieldJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*big.Int)(f).String())
+}
+
+func (f *FieldJSON) UnmarshalJSON(data []byte) error {
+	x, err := parseField(data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	*f = FieldJSON(*x)
+	return nil
+}
+
+// parseField is the FieldJSON in data.
+func parseField(data []byte) (*big.Int, error) {
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+	}
+	x, ok := new(big.Int), false
+	if len(text) >= 2 && (text[:2] == "0x" || text[:2] == "0X") {
+		_, ok = x.SetString(text[2:], 16)
+	} else {
+		_, ok = x.SetString(text, 10)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not a decimal or 0x-hex integer", data)
+	}
+	return x, inField(x)
+}
+
+// checkField refuses x outside the BN254 scalar field.
+func checkField(x *big.Int) error {
+	if err := inField(x); err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	return nil
+}
+
+func inField(x *big.Int) error {
+	if x.Sign() < 0 || x.Cmp(ecc.BN254.ScalarField()) >= 0 {
+		return fmt.Errorf("%s outside the scalar field", x)
+	}
+	return nil
 }
 
 func (s *SettlementCircuitPublic) WriteTo(w io.Writer) (int64, error) {
@@ -63,15 +164,29 @@ var _ io.ReaderFrom = (*SettlementCircuitPublic)(nil)
 
 // MarshalJSON encodes public inputs (BN254 only).
 func (s SettlementCircuitPublic) MarshalJSON() ([]byte, error) {
-	toU64 := func(v frontend.Variable) (uint64, error) {
-		switch x := v.(type) {
+	js, err := s.jsonForm()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&js)
+}
+
+// jsonForm is s as SettlementCircuitPublicJSON, every value range-checked.
+func (s SettlementCircuitPublic) jsonForm() (SettlementCircuitPublicJSON, error) {
+	toField := func(v frontend.Variable) (FieldJSON, error) {
+		var x *big.Int
+		switch v := v.(type) {
 		case *big.Int:
-			return x.Uint64(), nil
+			x = v
 		case big.Int:
-			return (&x).Uint64(), nil
+			x = &v
 		default:
-			return 0, fmt.Errorf("unexpected type %T", v)
+			return FieldJSON{}, fmt.Errorf("unexpected type %T", v)
+		}
+		if err := checkField(x); err != nil {
+			return FieldJSON{}, err
 		}
+		return FieldJSON(*x), nil
 	}
 
 	var js SettlementCircuitPublicJSON
@@ -83,85 +198,167 @@ func (s SettlementCircuitPublic) MarshalJSON() ([]byte, error) {
 	case big.Int:
 		js.Recipient = "0x" + hex.EncodeToString(x.Bytes())
 	default:
-		return nil, fmt.Errorf("unexpected Recipient type %T", s.Recipient)
+		return js, fmt.Errorf("unexpected Recipient type %T", s.Recipient)
 	}
 
 	var err error
-	if js.KOld, err = toU64(s.KOld); err != nil {
-		return nil, err
+	if js.KOld, err = toField(s.KOld); err != nil {
+		return js, err
 	}
-	if js.M, err = toU64(s.M); err != nil {
-		return nil, err
+	if js.M, err = toField(s.M); err != nil {
+		return js, err
 	}
-	if js.TotalSettle, err = toU64(s.TotalSettle); err != nil {
-		return nil, err
+	if js.TotalSettle, err = toField(s.TotalSettle); err != nil {
+		return js, err
 	}
-	if js.ChainID, err = toU64(s.ChainID); err != nil {
-		return nil, err
+	if js.ChainID, err = toField(s.ChainID); err != nil {
+		return js, err
 	}
 
 	// pk.A.X
+	// []byte from PublicKey.Assign is fixed-width; trim it like *big.Int so
+	// the JSON (and the BatchID over it) does not depend on the assignment
 	switch x := s.Pk.A.X.(type) {
 	case []byte:
-		js.PkX = hex.EncodeToString(x)
+		js.PkX = hex.EncodeToString(new(big.Int).SetBytes(x).Bytes())
 	case *big.Int:
 		js.PkX = hex.EncodeToString(x.Bytes())
 	case big.Int:
 		js.PkX = hex.EncodeToString(x.Bytes())
 	default:
-		return nil, fmt.Errorf("unexpected pk.A.X type %T", s.Pk.A.X)
+		return js, fmt.Errorf("unexpected pk.A.X type %T", s.Pk.A.X)
 	}
 
 	// pk.A.Y
 	switch y := s.Pk.A.Y.(type) {
 	case []byte:
-		js.PkY = hex.EncodeToString(y)
+		js.PkY = hex.EncodeToString(new(big.Int).SetBytes(y).Bytes())
 	case *big.Int:
 		js.PkY = hex.EncodeToString(y.Bytes())
 	case big.Int:
 		js.PkY = hex.EncodeToString(y.Bytes())
 	default:
-		return nil, fmt.Errorf("unexpected pk.A.Y type %T", s.Pk.A.Y)
+		return js, fmt.Errorf("unexpected pk.A.Y type %T", s.Pk.A.Y)
+	}
+
+	switch r := s.BatchDataRoot.(type) {
+	case *big.Int:
+		js.BatchDataRoot = "0x" + hex.EncodeToString(r.Bytes())
+	case big.Int:
+		js.BatchDataRoot = "0x" + hex.EncodeToString(r.Bytes())
+	default:
+		return js, fmt.Errorf("unexpected BatchDataRoot type %T", s.BatchDataRoot)
 	}
 
-	return json.Marshal(js)
+	for i, v := range s.Extra {
+		x, err := toField(v)
+		if err != nil {
+			return js, fmt.Errorf("extra[%d]: %w", i, err)
+		}
+		js.Extra = append(js.Extra, x)
+	}
+	return js, nil
 }
 
-// UnmarshalJSON decodes JSON into gnark frontend variables.
+// hexFields are the public inputs written as hex strings, 0x optional
+// (empty for zero); the others are FieldJSON.
+var hexFields = []string{"recipient", "pk_x", "pk_y", "batch_data_root"}
+
+// UnmarshalJSON decodes JSON into gnark frontend variables. It is strict:
+// the object must have exactly the PublicFields, each once and not null,
+// plus "extra" for a variant with public inputs of its own, and an error
+// names the field by its JSON path, so that a renamed or mistyped field
+// fails rather than proves a zero.
 func (s *SettlementCircuitPublic) UnmarshalJSON(data []byte) error {
-	var js SettlementCircuitPublicJSON
-	if err := json.Unmarshal(data, &js); err != nil {
+	raw, err := decodeObject(data)
+	if err != nil {
+		return fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	extra, hasExtra := raw["extra"]
+	delete(raw, "extra")
+	if err := checkFields(raw); err != nil {
 		return err
 	}
+	vars := s.vars()
+	for i, name := range PublicFields {
+		x, err := decodePublic(name, raw[name])
+		if err != nil {
+			return fmt.Errorf("%w: public inputs: $.%s: %w", errs.ErrInvalidInput, name, err)
+		}
+		*vars[i] = x
+	}
+	s.Extra = nil
+	if !hasExtra {
+		return nil
+	}
+	if string(extra) == "null" {
+		return fmt.Errorf("%w: public inputs: $.extra: required, got null", errs.ErrInvalidInput)
+	}
+	var xs []FieldJSON
+	if err := json.Unmarshal(extra, &xs); err != nil {
+		return fmt.Errorf("%w: public inputs: $.extra: %w", errs.ErrInvalidInput, err)
+	}
+	for i := range xs {
+		s.Extra = append(s.Extra, new(big.Int).Set((*big.Int)(&xs[i])))
+	}
+	return nil
+}
 
-	// Recipient
-	rHex := js.Recipient
-	if len(rHex) >= 2 && (rHex[:2] == "0x" || rHex[:2] == "0X") {
-		rHex = rHex[2:]
+// decodeObject is the members of the JSON object in data. A key given
+// twice is refused: encoding/json would keep the last one silently.
+func decodeObject(data []byte) (map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, fmt.Errorf("want an object, got %v", t)
 	}
-	rBytes, err := hex.DecodeString(rHex)
-	if err != nil {
-		return fmt.Errorf("invalid recipient hex: %w", err)
+	raw := make(map[string]json.RawMessage)
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := t.(string)
+		if _, ok := raw[key]; ok {
+			return nil, fmt.Errorf("$.%s is given twice", key)
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("$.%s: %w", key, err)
+		}
+		raw[key] = v
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("data after the object")
 	}
-	s.Recipient = new(big.Int).SetBytes(rBytes)
-	s.KOld = new(big.Int).SetUint64(js.KOld)
-	s.M = new(big.Int).SetUint64(js.M)
-	s.TotalSettle = new(big.Int).SetUint64(js.TotalSettle)
-	s.ChainID = new(big.Int).SetUint64(js.ChainID)
+	return raw, nil
+}
 
-	// Public key coords
-	xBytes, err := hex.DecodeString(js.PkX)
-	if err != nil {
-		return fmt.Errorf("invalid pk_x hex: %w", err)
+// decodePublic is the value of the public input name, in the field.
+func decodePublic(name string, raw json.RawMessage) (*big.Int, error) {
+	if string(raw) == "null" {
+		return nil, errors.New("required, got null")
+	}
+	if !slices.Contains(hexFields, name) {
+		return parseField(raw)
+	}
+	var h string
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, fmt.Errorf("want a hex string, got %s", raw)
+	}
+	if len(h) >= 2 && (h[:2] == "0x" || h[:2] == "0X") {
+		h = h[2:]
 	}
-	yBytes, err := hex.DecodeString(js.PkY)
+	b, err := hex.DecodeString(h)
 	if err != nil {
-		return fmt.Errorf("invalid pk_y hex: %w", err)
+		return nil, fmt.Errorf("hex: %w", err)
 	}
-	s.Pk.A.X = new(big.Int).SetBytes(xBytes)
-	s.Pk.A.Y = new(big.Int).SetBytes(yBytes)
-
-	return nil
+	x := new(big.Int).SetBytes(b)
+	return x, inField(x)
 }
 
 // SettlementCircuit:
@@ -169,69 +366,224 @@ func (s *SettlementCircuitPublic) UnmarshalJSON(data []byte) error {
 //   - public Recipient and ChainID
 //   - N EdDSA+MiMC signatures from the same public key Pk
 //     over msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID)
+//   - BatchDataRoot over all rows, hashed with DataHash
 type SettlementCircuit struct {
 	P SettlementCircuitPublic
-	// per-row fields (witnesses)
-	Size  [N]frontend.Variable
-	Nonce [N]frontend.Variable
-	Sig   [N]stdEddsa.Signature
+	// per-row fields (witnesses), all of the batch size, see NewSettlementCircuit
+	Size  []frontend.Variable
+	Nonce []frontend.Variable
+	Sig   []stdEddsa.Signature
+
+	// compile-time config, not part of the witness
+	DataHash DataHash   `gnark:"-"`
+	Ordering Ordering   `gnark:"-"`
+	Msg      MsgVersion `gnark:"-"`
+	Scheme   SigScheme  `gnark:"-"` // nil means EdDSA
+	Bounds   Bounds     `gnark:"-"` // zero: unbounded
+	// EmptyBatches accepts a batch with M == KOld as empty, see
+	// assertEmptyRows
+	EmptyBatches bool `gnark:"-"`
+
+	// rowsSigned, set by variants that want more signatures per row,
+	// asserts over the row messages once Pk's signatures are checked
+	rowsSigned func(api frontend.API, msgs []frontend.Variable) error
+}
+
+// NewSettlementCircuit allocates the rows of an n-row batch. The result is
+// both the circuit to compile and the assignment to fill in.
+func NewSettlementCircuit(n int) *SettlementCircuit {
+	return &SettlementCircuit{
+		Size:  make([]frontend.Variable, n),
+		Nonce: make([]frontend.Variable, n),
+		Sig:   make([]stdEddsa.Signature, n),
+	}
+}
+
+// publicCircuit holds the public inputs alone; they do not depend on the
+// batch size, so neither does a public witness.
+type publicCircuit struct {
+	P     SettlementCircuitPublic
+	Extra []frontend.Variable `gnark:",public"`
+}
+
+func (c *publicCircuit) Define(frontend.API) error {
+	return errors.New("public inputs only, compile a SettlementCircuit")
+}
+
+// PublicWitness is the public witness of pub, valid for every batch size.
+func PublicWitness(pub SettlementCircuitPublic) (witness.Witness, error) {
+	var unset []string
+	for i, v := range pub.vars() {
+		if *v == nil {
+			unset = append(unset, PublicFields[i])
+		}
+	}
+	for i, v := range pub.Extra {
+		if v == nil {
+			unset = append(unset, fmt.Sprintf("extra[%d]", i))
+		}
+	}
+	if len(unset) > 0 {
+		return nil, fmt.Errorf("unset: [%s]", strings.Join(unset, " "))
+	}
+	return frontend.NewWitness(&publicCircuit{P: pub, Extra: pub.Extra}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+}
+
+// DiffPublic names the PublicFields a and b disagree on, comparing them as
+// field elements whatever their Go types, then their Extra inputs: "extra"
+// when they have different counts of them, else extra[i].
+func DiffPublic(a, b SettlementCircuitPublic) ([]string, error) {
+	wa, err := PublicWitness(a)
+	if err != nil {
+		return nil, err
+	}
+	wb, err := PublicWitness(b)
+	if err != nil {
+		return nil, err
+	}
+	va, vb := wa.Vector().(fr.Vector), wb.Vector().(fr.Vector)
+	var diff []string
+	for i, f := range PublicFields {
+		if !va[i].Equal(&vb[i]) {
+			diff = append(diff, f)
+		}
+	}
+	if len(va) != len(vb) {
+		return append(diff, "extra"), nil
+	}
+	for i := len(PublicFields); i < len(va); i++ {
+		if !va[i].Equal(&vb[i]) {
+			diff = append(diff, fmt.Sprintf("extra[%d]", i-len(PublicFields)))
+		}
+	}
+	return diff, nil
+}
+
+// PublicFromWitness reads the public inputs back out of a full or public
+// settlement witness, the inverse of PublicWitness.
+func PublicFromWitness(w witness.Witness) (SettlementCircuitPublic, error) {
+	var pub SettlementCircuitPublic
+	pw, err := w.Public()
+	if err != nil {
+		return pub, err
+	}
+	v, ok := pw.Vector().(fr.Vector)
+	if !ok || len(v) < len(PublicFields) {
+		return pub, fmt.Errorf("%w: not a BN254 settlement witness", errs.ErrInvalidInput)
+	}
+	for i, f := range pub.vars() {
+		*f = v[i].BigInt(new(big.Int))
+	}
+	for _, x := range v[len(PublicFields):] {
+		pub.Extra = append(pub.Extra, x.BigInt(new(big.Int)))
+	}
+	return pub, nil
 }
 
 func (c *SettlementCircuit) Define(api frontend.API) error {
+	n := len(c.Size)
+	if n == 0 || len(c.Nonce) != n || len(c.Sig) != n {
+		return fmt.Errorf("settlement circuit rows: %d sizes, %d nonces, %d signatures", n, len(c.Nonce), len(c.Sig))
+	}
+
 	// 1. SUM(Size[i]) == TotalSettle
 	sum := frontend.Variable(0)
-	for i := 0; i < N; i++ {
+	for i := 0; i < n; i++ {
 		sum = api.Add(sum, c.Size[i])
 	}
 	api.AssertIsEqual(sum, c.P.TotalSettle)
 
-	// 2. Nonce[i] > KOld for all i (strict)
-	for i := 0; i < N; i++ {
-		api.AssertIsLessOrEqual(c.P.KOld, c.Nonce[i]) // Nonce[i] >= KOld
-		api.AssertIsDifferent(c.P.KOld, c.Nonce[i])   // Nonce[i] != KOld
-	}
+	// 1b. every value within the deployment's Bounds, if it sets any
+	assertBounds(api, c.Bounds, c.P.KOld, c.P.TotalSettle, c.Size, c.Nonce)
+	less := newNonceLess(api, c.Bounds)
 
-	// 3. Nonce[i+1] > Nonce[i] (strictly increasing)
-	for i := 0; i < N-1; i++ {
-		api.AssertIsLessOrEqual(c.Nonce[i], c.Nonce[i+1]) // Nonce[i+1] >= Nonce[i]
-		api.AssertIsDifferent(c.Nonce[i], c.Nonce[i+1])   // Nonce[i+1] != Nonce[i]
+	// 1c. an empty batch has every row (0, KOld); 2-4 check the placeholder
+	//     nonces 1..N instead of its rows
+	kOld, m, nonce := c.P.KOld, c.P.M, c.Nonce
+	var empty frontend.Variable
+	if c.EmptyBatches {
+		empty = assertEmptyRows(api, c.P.KOld, c.P.M, c.Size, c.Nonce)
+		kOld, m, nonce = placeholderNonces(api, empty, c.P.KOld, c.P.M, c.Nonce)
+		if c.Ordering == OrderingUnique {
+			kOld = c.P.KOld // always 0
+		}
 	}
 
-	// 4. M == last nonce
-	api.AssertIsEqual(c.P.M, c.Nonce[N-1])
+	// 1d. every row of a batch that is not empty at least Bounds.MinSize
+	assertMinSize(api, c.Bounds, empty, c.Size)
+
+	rootSize, rootNonce := c.Size, c.Nonce
+	switch c.Ordering {
+	case OrderingMonotonic:
+		// 2. Nonce[i] > KOld for all i (strict)
+		// 3. Nonce[i+1] > Nonce[i] (strictly increasing)
+		// 4. M == last nonce
+		assertNonceOrder(less, api, kOld, m, nonce)
+	case OrderingUnique:
+		// 2-4. Nonce[i] pairwise distinct, KOld == 0, M == max nonce
+		if err := assertUniqueIDs(less, api, kOld, m, nonce); err != nil {
+			return err
+		}
+	case OrderingPermuted:
+		// 2-4. as monotonic, over the rows sorted by nonce
+		var err error
+		if rootSize, rootNonce, err = sortedRows(api, c.Size, nonce); err != nil {
+			return err
+		}
+		assertNonceOrder(less, api, kOld, m, rootNonce)
+		if empty != nil {
+			// the root is over the rows themselves
+			for i := range rootNonce {
+				rootNonce[i] = api.Select(empty, c.P.KOld, rootNonce[i])
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported ordering %s", c.Ordering)
+	}
 
-	// SNARK-friendly Edwards curve on BN254 for EdDSA
-	curve, err := twistededwards.NewEdCurve(api, te.BN254)
+	// 5. BatchDataRoot == H(Size[0], Nonce[0], ..., Size[N-1], Nonce[N-1])
+	//    (rows sorted by nonce for OrderingPermuted)
+	root, err := batchDataRoot(api, c.DataHash, rootSize, rootNonce)
 	if err != nil {
 		return err
 	}
-	// domain separator: 8 bytes "msettle1" as a field element constant
-	dsBig := new(big.Int).SetBytes(DOMAIN)
-	domainSep := frontend.Variable(dsBig)
-	// 5. For each row: verify EdDSA signature over
-	//    msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID)
+	api.AssertIsEqual(root, c.P.BatchDataRoot)
+
+	// 6. For each row: verify the signature over
+	//    msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID) (MsgV1)
 	//    with the same public key c.Pk
-	for i := 0; i < N; i++ {
-		// outer MiMC for message hash
-		hMsg, err := stdMimc.NewMiMC(api)
-		if err != nil {
+	hasher, err := newMsgHasher(api, c.Msg, c.P.Recipient, c.P.ChainID)
+	if err != nil {
+		return err
+	}
+	msgs := make([]frontend.Variable, n)
+	for i := 0; i < n; i++ {
+		if msgs[i], err = hasher.sum(c.Size[i], c.Nonce[i], c.P.ChainID); err != nil {
 			return err
 		}
-		// hash the tuple (domain_separator, recipient, size, nonce, chain_id)
-		hMsg.Write(domainSep, c.P.Recipient, c.Size[i], c.Nonce[i], c.P.ChainID)
-		msg := hMsg.Sum()
+	}
+	pk, sigs := eddsaVars(c.P.Pk, c.Sig)
+	if err := sigScheme(c.Scheme).AssertRows(api, pk, sigs, msgs); err != nil {
+		return err
+	}
+	if c.rowsSigned != nil {
+		return c.rowsSigned(api, msgs)
+	}
+	return nil
+}
 
-		// MiMC instance for EdDSA (H(R, A, msg))
-		hSig, err := stdMimc.NewMiMC(api)
-		if err != nil {
-			return err
-		}
+// assertNonceOrder enforces KOld < Nonce[0] < ... < Nonce[n-1] == M.
+func assertNonceOrder(less nonceLess, api frontend.API, kOld, m frontend.Variable, nonce []frontend.Variable) {
+	// Nonce[i] > KOld for all i (strict)
+	for i := range nonce {
+		less(kOld, nonce[i])
+	}
 
-		// verify Sig[i] on msg with public key Pk
-		if err := stdEddsa.Verify(curve, c.Sig[i], msg, c.P.Pk, &hSig); err != nil {
-			return err
-		}
+	// Nonce[i+1] > Nonce[i] (strictly increasing)
+	for i := 0; i < len(nonce)-1; i++ {
+		less(nonce[i], nonce[i+1])
 	}
 
-	return nil
+	// M == last nonce
+	api.AssertIsEqual(m, nonce[len(nonce)-1])
 }
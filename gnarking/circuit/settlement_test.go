@@ -3,6 +3,7 @@ package circuit
 import (
 	"crypto/rand"
 	"math/big"
+	"slices"
 	"testing"
 
 	"github.com/consensys/gnark-crypto/ecc"
@@ -10,6 +11,7 @@ import (
 	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
 	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
 
+	"github.com/consensys/gnark/backend"
 	"github.com/consensys/gnark/test"
 )
 
@@ -32,13 +34,15 @@ func TestSettlementCircuit_EdDSA(t *testing.T) {
 	// --------------------
 	// Build VALID witness
 	// --------------------
-	var valid SettlementCircuit
+	valid := *NewSettlementCircuit(N)
 
 	valid.P.Recipient = recipient
 	valid.P.ChainID = chainID
 	valid.P.KOld = kOld
 
 	total := big.NewInt(0)
+	sizes := make([]*big.Int, N)
+	nonces := make([]*big.Int, N)
 
 	for i := 0; i < N; i++ {
 		size := big.NewInt(1)
@@ -46,6 +50,7 @@ func TestSettlementCircuit_EdDSA(t *testing.T) {
 
 		valid.Size[i] = new(big.Int).Set(size)
 		valid.Nonce[i] = new(big.Int).Set(nonce)
+		sizes[i], nonces[i] = size, nonce
 
 		// msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID)
 		msgBytes := MimcMsg(recipient, size, nonce, chainID)
@@ -68,9 +73,12 @@ func TestSettlementCircuit_EdDSA(t *testing.T) {
 	valid.P.TotalSettle = total
 	valid.P.M = big.NewInt(int64(N)) // last nonce
 	valid.P.Pk.Assign(te.BN254, pkBytes)
+	root, err := BatchDataRoot(DataHashMiMC, sizes, nonces)
+	assert.NoError(err)
+	valid.P.BatchDataRoot = root
 
 	// Circuit template
-	var c SettlementCircuit
+	c := *NewSettlementCircuit(N)
 
 	// Valid witness should succeed
 	assert.ProverSucceeded(
@@ -95,6 +103,7 @@ func TestSettlementCircuit_EdDSA(t *testing.T) {
 	// INVALID 2: break nonce ordering (nonce[5] == nonce[4])
 	// --------------------
 	invalidNonce := valid
+	invalidNonce.Nonce = slices.Clone(valid.Nonce)
 	invalidNonce.Nonce[5] = invalidNonce.Nonce[4]
 
 	assert.ProverFailed(
@@ -119,4 +128,37 @@ func TestSettlementCircuit_EdDSA(t *testing.T) {
 		&invalidPk,
 		test.WithCurves(ecc.BN254),
 	)
+
+	// --------------------
+	// INVALID 4: BatchDataRoot not matching the rows
+	// --------------------
+	invalidRoot := valid
+	invalidRoot.P.BatchDataRoot = new(big.Int).Add(root, big.NewInt(1))
+
+	assert.ProverFailed(
+		&c,
+		&invalidRoot,
+		test.WithCurves(ecc.BN254),
+	)
+
+	// --------------------
+	// keccak BatchDataRoot variant
+	// --------------------
+	keccakRoot, err := BatchDataRoot(DataHashKeccak, sizes, nonces)
+	assert.NoError(err)
+	keccakValid := valid
+	keccakValid.P.BatchDataRoot = keccakRoot
+
+	kc := *NewSettlementCircuit(N)
+	kc.DataHash = DataHashKeccak
+	assert.CheckCircuit(
+		&kc,
+		test.WithValidAssignment(&keccakValid),
+		test.WithInvalidAssignment(&valid),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+		test.NoProverChecks(),
+	)
 }
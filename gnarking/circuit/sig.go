@@ -0,0 +1,114 @@
+package circuit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/native/twistededwards"
+	stdMimc "github.com/consensys/gnark/std/hash/mimc"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/signature"
+)
+
+// SigScheme signs and verifies the row messages of a batch, natively and
+// in-circuit. The batch pipeline only produces one message per row; keys and
+// signatures reach the circuit side as flat variable lists, so a scheme with
+// another witness layout (e.g. one aggregated BLS signature for all rows)
+// plugs in without touching it.
+type SigScheme interface {
+	String() string
+
+	// Sign signs one row message natively.
+	Sign(priv signature.Signer, msg []byte) ([]byte, error)
+	// Verify checks one serialized signature natively.
+	Verify(pk, sig, msg []byte) error
+
+	// AssertRows asserts in-circuit that sigs[i] signs msgs[i] under pk.
+	// An aggregating scheme may take a single entry in sigs for all rows.
+	AssertRows(api frontend.API, pk []frontend.Variable, sigs [][]frontend.Variable, msgs []frontend.Variable) error
+}
+
+// EdDSA is EdDSA on the BN254 twisted Edwards curve with MiMC as the
+// signature hash. pk is (A.X, A.Y), each signature (R.X, R.Y, S).
+type EdDSA struct{}
+
+func (EdDSA) String() string { return "eddsa" }
+
+func (EdDSA) Sign(priv signature.Signer, msg []byte) ([]byte, error) {
+	return priv.Sign(msg, bnMimc.NewMiMC())
+}
+
+func (EdDSA) Verify(pk, sig, msg []byte) error {
+	var pub bnEddsa.PublicKey
+	if _, err := pub.SetBytes(pk); err != nil {
+		return fmt.Errorf("eddsa public key: %w", err)
+	}
+	ok, err := pub.Verify(sig, msg, bnMimc.NewMiMC())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("eddsa: invalid signature")
+	}
+	return nil
+}
+
+func (EdDSA) AssertRows(api frontend.API, pk []frontend.Variable, sigs [][]frontend.Variable, msgs []frontend.Variable) error {
+	if len(pk) != 2 {
+		return fmt.Errorf("eddsa: public key has %d variables, want 2", len(pk))
+	}
+	if len(sigs) != len(msgs) {
+		return fmt.Errorf("eddsa: %d signatures for %d messages", len(sigs), len(msgs))
+	}
+	curve, err := twistededwards.NewEdCurve(api, te.BN254)
+	if err != nil {
+		return err
+	}
+	key := stdEddsa.PublicKey{A: twistededwards.Point{X: pk[0], Y: pk[1]}}
+	for i, s := range sigs {
+		if len(s) != 3 {
+			return fmt.Errorf("eddsa: signature %d has %d variables, want 3", i, len(s))
+		}
+		sig := stdEddsa.Signature{R: twistededwards.Point{X: s[0], Y: s[1]}, S: s[2]}
+		// MiMC instance for EdDSA (H(R, A, msg))
+		hSig, err := stdMimc.NewMiMC(api)
+		if err != nil {
+			return err
+		}
+		if err := stdEddsa.Verify(curve, sig, msgs[i], key, &hSig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ParseSigScheme(s string) (SigScheme, error) {
+	switch s {
+	case "eddsa":
+		return EdDSA{}, nil
+	default:
+		return nil, fmt.Errorf("unknown signature scheme %q (want eddsa)", s)
+	}
+}
+
+// eddsaVars flattens the circuits' EdDSA witnesses for SigScheme.AssertRows.
+func eddsaVars(pk stdEddsa.PublicKey, sigs []stdEddsa.Signature) ([]frontend.Variable, [][]frontend.Variable) {
+	out := make([][]frontend.Variable, len(sigs))
+	for i, s := range sigs {
+		out[i] = []frontend.Variable{s.R.X, s.R.Y, s.S}
+	}
+	return []frontend.Variable{pk.A.X, pk.A.Y}, out
+}
+
+// sigScheme returns s, defaulting to EdDSA.
+func sigScheme(s SigScheme) SigScheme {
+	if s == nil {
+		return EdDSA{}
+	}
+	return s
+}
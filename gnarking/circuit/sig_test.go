@@ -0,0 +1,31 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+)
+
+func TestEdDSANative(t *testing.T) {
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scheme SigScheme = EdDSA{}
+	msg := MimcMsg(big.NewInt(42), big.NewInt(1), big.NewInt(1), big.NewInt(1))
+	sig, err := scheme.Sign(priv, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := priv.Public().Bytes()
+	if err := scheme.Verify(pk, sig, msg); err != nil {
+		t.Fatal(err)
+	}
+	other := MimcMsg(big.NewInt(42), big.NewInt(2), big.NewInt(1), big.NewInt(1))
+	if err := scheme.Verify(pk, sig, other); err == nil {
+		t.Fatal("signature verified over another message")
+	}
+}
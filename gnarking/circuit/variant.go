@@ -0,0 +1,103 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+
+	"gnarking/errs"
+)
+
+// Variant is a circuit a program outside this module registers under a
+// Profile, compiled, set up and proven in place of SettlementCircuit by
+// the servers, ddm and settlement_demo alike, without a fork. Its public
+// inputs must start with SettlementCircuitPublic's, in PublicFields order
+// (e.g. a P SettlementCircuitPublic of its own, first), and may go on with
+// inputs of its own, declared after P and named in its PublicLayout: public
+// JSON carries them as SettlementCircuitPublic.Extra, after the
+// PublicFields, and the proof header, batch IDs, verification, calldata and
+// the exported verifier take them as they take any profile's. What it
+// proves beyond the settlement statement is up to it, over its own secret
+// and public inputs.
+//
+// Profiles are compared with ==, so a Variant's dynamic type must be
+// comparable: a pointer, or a struct of comparable fields.
+type Variant interface {
+	// Define allocates p's circuit, p.N rows, to compile and to assign.
+	Define(p Profile) frontend.Circuit
+	// WitnessFromBatch is the full assignment of a batch: base is the
+	// settlement assignment POST /prove derives from the batch's rows,
+	// extra the batch JSON's "variant" object, nil when it has none.
+	WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error)
+	// PublicLayout is p's public inputs from base, the settlement layout
+	// of p: the same inputs in the same order, types and docs narrowed at
+	// most, then the variant's own inputs in witness order (see
+	// Layout.Append).
+	PublicLayout(p Profile, base Layout) (Layout, error)
+}
+
+// Define is the circuit p compiles: its Variant's, else Circuit().
+func (p Profile) Define() frontend.Circuit {
+	if p.Variant != nil {
+		return p.Variant.Define(p)
+	}
+	return p.Circuit()
+}
+
+// Assign is the full assignment of a batch of p from base, its settlement
+// assignment, and extra, the batch's variant inputs: base itself unless p
+// has a Variant, and then extra must be empty.
+func (p Profile) Assign(base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	if p.Variant != nil {
+		c, err := p.Variant.WitnessFromBatch(p, base, extra)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		return c, nil
+	}
+	if len(extra) > 0 && string(extra) != "null" {
+		return nil, fmt.Errorf("%w: variant inputs for profile %s, which has no variant", errs.ErrInvalidInput, p.Name)
+	}
+	return base, nil
+}
+
+// checkVariant fails unless p's Variant keeps the settlement public inputs
+// first and declares every input of its own in its layout.
+func checkVariant(p Profile) error {
+	if !reflect.TypeOf(p.Variant).Comparable() {
+		return fmt.Errorf("%w: profile %q: variant %T is not comparable", errs.ErrInvalidInput, p.Name, p.Variant)
+	}
+	l, err := PublicLayout(p)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w", p.Name, err)
+	}
+	names := make([]string, len(l))
+	for i, in := range l {
+		names[i] = in.Name
+		if in.Index != i {
+			return fmt.Errorf("%w: profile %q: public input %q at %d has index %d", errs.ErrInvalidInput, p.Name, in.Name, i, in.Index)
+		}
+	}
+	if len(names) < len(PublicFields) || !slices.Equal(names[:len(PublicFields)], PublicFields) {
+		return fmt.Errorf("%w: profile %q: variant public inputs %v, want %v first", errs.ErrInvalidInput, p.Name, names, PublicFields)
+	}
+	for i, name := range names[len(PublicFields):] {
+		if name == "" || name == "extra" || slices.Contains(names[:len(PublicFields)+i], name) {
+			return fmt.Errorf("%w: profile %q: variant public input %q is unnamed or taken", errs.ErrInvalidInput, p.Name, name)
+		}
+	}
+	// counted as witnesses count them, through pointers too
+	count, err := schema.Walk(ecc.BN254.ScalarField(), p.Variant.Define(p), reflect.TypeFor[frontend.Variable](), nil)
+	if err != nil {
+		return fmt.Errorf("%w: profile %q: %w", errs.ErrInvalidInput, p.Name, err)
+	}
+	if count.Public != len(l) {
+		return fmt.Errorf("%w: profile %q: variant circuit has %d public inputs, its layout %d", errs.ErrInvalidInput, p.Name, count.Public, len(l))
+	}
+	return nil
+}
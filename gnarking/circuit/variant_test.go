@@ -0,0 +1,152 @@
+package circuit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/errs"
+)
+
+// maxRowCircuit is a settlement with every row at most Max, as a plugin
+// would write one.
+type maxRowCircuit struct {
+	S   *SettlementCircuit
+	Max uint64 `gnark:"-"`
+}
+
+func (c *maxRowCircuit) Define(api frontend.API) error {
+	for i := range c.S.Size {
+		api.ToBinary(api.Sub(c.Max, c.S.Size[i]), 64)
+	}
+	return c.S.Define(api)
+}
+
+type maxRowVariant struct {
+	Max   uint64
+	extra bool // a public input too many
+}
+
+func (v maxRowVariant) Define(p Profile) frontend.Circuit {
+	if v.extra {
+		return &struct {
+			maxRowCircuit
+			Extra frontend.Variable `gnark:",public"`
+		}{maxRowCircuit: maxRowCircuit{S: p.Circuit(), Max: v.Max}}
+	}
+	return &maxRowCircuit{S: p.Circuit(), Max: v.Max}
+}
+
+func (v maxRowVariant) WitnessFromBatch(p Profile, base *SettlementCircuit, extra json.RawMessage) (frontend.Circuit, error) {
+	if extra != nil {
+		return nil, fmt.Errorf("%w: no variant inputs", errs.ErrInvalidInput)
+	}
+	return &maxRowCircuit{S: base, Max: v.Max}, nil
+}
+
+func (v maxRowVariant) PublicLayout(p Profile, base Layout) (Layout, error) {
+	base[3].Doc += fmt.Sprintf(", every row at most %d", v.Max)
+	return base, nil
+}
+
+type reorderedVariant struct{ maxRowVariant }
+
+func (v reorderedVariant) PublicLayout(p Profile, base Layout) (Layout, error) {
+	base[0], base[1] = base[1], base[0]
+	return base, nil
+}
+
+type sliceVariant struct {
+	maxRowVariant
+	rows []int
+}
+
+func TestVariantProfile(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	assert.NoError(RegisterProfile(Profile{Name: "test-variant-3", N: 3, Variant: maxRowVariant{Max: 6}}))
+	p, err := LookupProfile("test-variant-3")
+	assert.NoError(err)
+	assert.True(p.Features()&FeaturePlugin != 0, "plugin feature")
+	l, err := PublicLayout(p)
+	assert.NoError(err)
+	assert.Equal("sum of row sizes, every row at most 6", l[3].Doc)
+
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	assert.NoError(err)
+	assign := func(sizes []int64) frontend.Circuit {
+		s := signedSettlement(assert, priv, MsgV1, 0, sizes, []int64{1, 2, 3})
+		c, err := p.Assign(&s, nil)
+		assert.NoError(err)
+		return c
+	}
+	_, err = p.Assign(p.Circuit(), json.RawMessage(`{"max":1}`))
+	assert.True(errors.Is(err, errs.ErrInvalidInput), "variant refuses inputs: %v", err)
+	plain, err := LookupProfile(DefaultProfile)
+	assert.NoError(err)
+	_, err = plain.Assign(plain.Circuit(), json.RawMessage(`{}`))
+	assert.True(errors.Is(err, errs.ErrInvalidInput), "variant inputs without a variant: %v", err)
+
+	assert.CheckCircuit(
+		p.Define(),
+		test.WithValidAssignment(assign([]int64{4, 5, 6})),
+		test.WithInvalidAssignment(assign([]int64{4, 5, 7})),
+		test.WithCurves(ecc.BN254),
+		test.WithBackends(backend.GROTH16),
+		test.NoFuzzing(),
+		test.NoSerializationChecks(),
+	)
+
+	for name, tc := range map[string]struct {
+		p    Profile
+		want error
+	}{
+		"duplicate":        {Profile{Name: "test-variant-3", N: 3}, errs.ErrDuplicate},
+		"reordered inputs": {Profile{Name: "test-reordered", N: 3, Variant: reorderedVariant{}}, errs.ErrInvalidInput},
+		"extra input":      {Profile{Name: "test-extra", N: 3, Variant: maxRowVariant{extra: true}}, errs.ErrInvalidInput},
+		"not comparable":   {Profile{Name: "test-slice", N: 3, Variant: sliceVariant{}}, errs.ErrInvalidInput},
+	} {
+		if err := RegisterProfile(tc.p); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+// TestRegisterConcurrent registers profiles, as plugins loading on other
+// goroutines would, while profiles are looked up; run with -race.
+func TestRegisterConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := RegisterProfile(Profile{Name: fmt.Sprintf("test-concurrent-%d", i), N: 2, Variant: maxRowVariant{Max: 9}}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := LookupProfile(DefaultProfile); err != nil {
+				t.Error(err)
+			}
+			Profiles()
+		}()
+	}
+	wg.Wait()
+	for i := range 8 {
+		if _, err := LookupProfile(fmt.Sprintf("test-concurrent-%d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/archive"
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// archivedFiles are the per-batch files of a profile in the working
+// directory, by the profile name; those present are archived. The setup
+// (ccs, pk, vk, manifest, verifier) stays.
+var archivedFiles = []string{
+	"proof_%s.groth16", "proof_%s.json", "public_%s.json", "public_sol_%s.json", "calldata_%s.hex", "summary_%s.json",
+	"batch_%s.json", "batch_redacted_%s.json", "state_diff_%s.json", "receipt_%s.json", "commitments_%s.json", "cosig_%s.json", "disclosure_%s.json", "escrow_%s.bin",
+}
+
+// runArchive files the current batch of a profile, its proof, public
+// inputs, calldata, receipt and batch data, under the archive's layout.
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the artifacts")
+	root := fs.String("root", "./archive", "archive root")
+	layout := fs.String("layout", string(archive.DefaultLayout), "directory of a batch under -root: {yyyy}, {mm}, {dd} (UTC day proven), {profile}, {batch} (batch ID, required)")
+	move := fs.Bool("move", false, "remove the files from -dir once archived")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	l, err := archive.ParseLayout(*layout)
+	if err != nil {
+		return err
+	}
+	var pub circuit.SettlementCircuitPublic
+	publicFile := filepath.Join(*dir, fmt.Sprintf("public_%s.json", profile.Name))
+	if err := readFile(publicFile, &pub); err != nil {
+		return err
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return err
+	}
+
+	// proven when the framed proof says, else when the public inputs were
+	// written
+	var proven time.Time
+	framed := artifacts.Proof{Proof: new(groth16_bn254.Proof)}
+	proofFile := filepath.Join(*dir, fmt.Sprintf("proof_%s.groth16", profile.Name))
+	switch err := readFile(proofFile, &framed); {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("%s: %w", proofFile, err)
+	case framed.Header != nil && framed.Header.BatchID != id:
+		return fmt.Errorf("%w: %s is of batch %x, %s of batch %x", errs.ErrArtifactMismatch, proofFile, framed.Header.BatchID[:8], publicFile, id[:8])
+	case framed.Header != nil:
+		proven = framed.Header.Timestamp
+	}
+	if proven.IsZero() {
+		info, err := os.Stat(publicFile)
+		if err != nil {
+			return err
+		}
+		proven = info.ModTime()
+	}
+
+	var paths []string
+	for _, name := range archivedFiles {
+		p := filepath.Join(*dir, fmt.Sprintf(name, profile.Name))
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	a := &archive.Archive{Root: *root, Layout: l}
+	e, err := a.Add(hex.EncodeToString(id[:]), profile.Name, proven, paths...)
+	if err != nil {
+		return err
+	}
+	if *move {
+		for _, p := range paths {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("batch %s: %d files, %d bytes in %s\n", e.BatchID, len(e.Files), e.Size(), filepath.Join(*root, filepath.FromSlash(e.Dir)))
+	return nil
+}
+
+// runGC deletes the archived batches the retention no longer keeps.
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	root := fs.String("root", "./archive", "archive root")
+	retention := fs.Duration("retention", 0, "delete batches proven longer ago than this, e.g. 2160h (0 keeps them)")
+	maxMB := fs.Int64("max-mb", 0, "delete the oldest batches while the archive is larger (0: no limit)")
+	dryRun := fs.Bool("dry-run", false, "list what would be deleted, delete nothing")
+	asJSON := fs.Bool("json", false, "print the deleted batches as JSON")
+	fs.Parse(args)
+	if *retention <= 0 && *maxMB <= 0 {
+		return fmt.Errorf("%w: gc needs -retention or -max-mb", errs.ErrInvalidInput)
+	}
+	if _, err := os.Stat(*root); err != nil {
+		return err
+	}
+
+	a := &archive.Archive{Root: *root}
+	removed, err := a.GC(archive.Retention{MaxAge: *retention, MaxBytes: *maxMB << 20}, time.Now(), *dryRun)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(removed); err != nil {
+			return err
+		}
+		return err
+	}
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	var size int64
+	for _, e := range removed {
+		fmt.Printf("%s %s %s proven %s, %d bytes\n", verb, e.BatchID, e.Dir, e.Time.Format(time.RFC3339), e.Size())
+		size += e.Size()
+	}
+	fmt.Printf("%s %d batches, %d bytes\n", verb, len(removed), size)
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gnarking/audit"
+)
+
+func runAudit(args []string) error {
+	if len(args) < 1 || args[0] != "verify-chain" {
+		return fmt.Errorf("usage: ddm audit verify-chain <log.jsonl>")
+	}
+	fs := flag.NewFlagSet("audit verify-chain", flag.ExitOnError)
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ddm audit verify-chain <log.jsonl>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head, err := audit.VerifyChain(f)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		fmt.Println("audit log is empty")
+		return nil
+	}
+	fmt.Printf("audit chain OK: %d entries, head %s\n", head.Seq+1, head.Hash)
+	return nil
+}
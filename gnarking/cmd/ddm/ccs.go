@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/logger"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/spec"
+)
+
+const ccsUsage = "usage: ddm ccs dump [-profile -dir -ccs -limit -offset -match -format -out]"
+
+func runCCS(args []string) error {
+	if len(args) < 1 || args[0] != "dump" {
+		return errors.New(ccsUsage)
+	}
+	return runCCSDump(args[1:])
+}
+
+// runCCSDump prints what the deployed ccs enforces: wire and term counts,
+// constraints per step of Define when the profile recompiles to the same
+// circuit, how many constraints reference each input, and the constraints
+// themselves, wires by name.
+func runCCSDump(args []string) error {
+	fs := flag.NewFlagSet("ccs dump", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the setup; its manifest's parameters are recompiled with")
+	ccsFile := fs.String("ccs", "", "constraint system to dump (default <dir>/ccs_<profile>.groth16)")
+	limit := fs.Int("limit", 50, "most constraints to list, 0 for the summary only")
+	offset := fs.Int("offset", 0, "matched constraints to skip before listing")
+	match := fs.String("match", "", "list only constraints whose text contains this, e.g. a wire name (P_KOld, Size_3, v120)")
+	format := fs.String("format", "text", "text or json")
+	out := fs.String("out", "", "file to write (default stdout)")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *limit < 0 || *offset < 0 {
+		return errors.New(ccsUsage)
+	}
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+
+	var m artifacts.Manifest
+	err = readFile(filepath.Join(*dir, fmt.Sprintf("manifest_%s.json", profile.Name)), &m)
+	switch {
+	case err == nil:
+		if profile, err = manifestProfile(profile, &m); err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	if *ccsFile == "" {
+		*ccsFile = filepath.Join(*dir, fmt.Sprintf("ccs_%s.groth16", profile.Name))
+	}
+	var ccs cs_bn254.R1CS
+	if err := readFile(*ccsFile, &ccs); err != nil {
+		return err
+	}
+
+	// gnark logs the recompile to stdout, where the dump may go
+	logger.Disable()
+	d, err := spec.DumpCCS(&ccs, profile, spec.DumpOptions{Match: *match, Offset: *offset, Limit: *limit})
+	if err != nil {
+		return err
+	}
+	var doc io.WriterTo
+	switch *format {
+	case "text":
+		doc = d.Text()
+	case "json":
+		doc = d
+	default:
+		return fmt.Errorf("unknown format %q (want text or json)", *format)
+	}
+	return writeDoc(*out, doc)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/cosign"
+	"gnarking/errs"
+	"gnarking/keys"
+	"gnarking/server"
+)
+
+const cosignUsage = "usage: ddm cosign sign -master risk.hex -path m/2'/1' -key-policy policy.json [-profile -dir -batch -out] | ddm cosign verify [-profile -dir -batch -cosig] | ddm cosign attach [-profile -dir -batch -cosig -signed]"
+
+// runCosign is the co-signer's side of 2-of-2 batches (circuit.Cosign,
+// profile cosign-8): sign checks the operator's signed batch against the
+// co-signing key's usage policy and writes a second signature for every
+// row, verify checks a co-signature file
+// against its batch, and attach writes the batch with the co-signatures
+// as its variant inputs, ready for POST /prove.
+func runCosign(args []string) error {
+	if len(args) < 1 || (args[0] != "sign" && args[0] != "verify" && args[0] != "attach") {
+		return errors.New(cosignUsage)
+	}
+	fs := flag.NewFlagSet("cosign "+args[0], flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default files")
+	dir := fs.String("dir", "./artifact", "directory of the default files and the setup manifest")
+	batchFile := fs.String("batch", "", "the operator's signed batch (default <dir>/batch_<profile>.json)")
+	cosigFile := fs.String("cosig", "", "co-signatures (default <dir>/cosig_<profile>.json)")
+	seedFile := fs.String("master", "", "sign: the co-signer's master seed file (hex)")
+	pathStr := fs.String("path", "", "sign: derivation path of the co-signing key, hardened only")
+	keyPolicy := fs.String("key-policy", "", "sign: key usage policy (keys.UsagePolicy) the rows must pass before the co-signing key signs them; its daily totals and refusals persist in <master>.usage.json")
+	fs.StringVar(cosigFile, "out", "", "sign: alias of -cosig")
+	signedFile := fs.String("signed", "", "attach: the co-signed batch to write (default <dir>/cosigned_<profile>.json)")
+	fs.Parse(args[1:])
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	// the row message format is the setup's
+	var m artifacts.Manifest
+	if err := readFile(name("manifest_%s.json"), &m); err == nil {
+		if profile, err = manifestProfile(profile, &m); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if *batchFile == "" {
+		*batchFile = name("batch_%s.json")
+	}
+	if *cosigFile == "" {
+		*cosigFile = name("cosig_%s.json")
+	}
+	data, err := os.ReadFile(*batchFile)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, *batchFile, err)
+	}
+
+	if args[0] == "verify" {
+		var s cosign.Signatures
+		if err := readFile(*cosigFile, &s); err != nil {
+			return err
+		}
+		if err := s.Verify(profile, &req); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d rows signed by %s and co-signed by %s\n", *batchFile, len(req.Rows), req.Pk, s.Pk)
+		return nil
+	}
+	if args[0] == "attach" {
+		var s cosign.Signatures
+		if err := readFile(*cosigFile, &s); err != nil {
+			return err
+		}
+		if req.Variant, err = cosign.Inputs(profile, &req, &s); err != nil {
+			return err
+		}
+		if *signedFile == "" {
+			*signedFile = name("cosigned_%s.json")
+		}
+		if err := writeFile(*signedFile, artifacts.WriterFunc(func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "\t")
+			return enc.Encode(&req)
+		})); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s: %d rows co-signed by %s\n", *signedFile, len(req.Rows), s.Pk)
+		return nil
+	}
+
+	if *seedFile == "" || *pathStr == "" || *keyPolicy == "" {
+		return errors.New(cosignUsage)
+	}
+	policy, err := keys.LoadUsagePolicy(*keyPolicy)
+	if err != nil {
+		return err
+	}
+	seedText, err := os.ReadFile(*seedFile)
+	if err != nil {
+		return err
+	}
+	seed, err := keys.ParseSeed(string(seedText))
+	if err != nil {
+		return err
+	}
+	path, err := keys.ParsePath(*pathStr)
+	if err != nil {
+		return err
+	}
+	priv, err := keys.Derive(seed, path)
+	if err != nil {
+		return err
+	}
+	// the policy sees every batch before the key signs it, as the
+	// operator's does
+	enc := json.NewEncoder(os.Stderr)
+	e := &keys.Enforcer{Policy: policy, State: *seedFile + ".usage.json", Log: func(v keys.Violation) { enc.Encode(v) }}
+	sizes := make([]uint64, len(req.Rows))
+	for i, row := range req.Rows {
+		sizes[i] = row.Size
+	}
+	if err := e.Authorize(path, req.ChainID, sizes...); err != nil {
+		return err
+	}
+	s, err := cosign.Sign(priv, profile, &req)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*cosigFile, s); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %d rows co-signed by %s (%s)\n", *cosigFile, len(s.Sigs), s.Pk, path)
+	return nil
+}
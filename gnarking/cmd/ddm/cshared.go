@@ -0,0 +1,148 @@
+//go:build cshared
+
+// Built with -tags cshared -buildmode=c-shared, ddm is libddm: the prover
+// and verifier in-process for non-Go hosts, behind the C ABI of
+// ffi/ddm.h. Each call answers what the ddm serve endpoint of the same
+// name would, status and JSON body, so the two contracts cannot drift.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/consensys/gnark/logger"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+	"gnarking/verifier"
+)
+
+// abiVersion is bumped on any incompatible change to ffi/ddm.h or to the
+// JSON it carries.
+const abiVersion = 1
+
+// libConfig is ddm_init's config JSON, ddm serve's flags of the same names.
+type libConfig struct {
+	Dir         string   `json:"dir"`      // default ./artifact
+	Profiles    []string `json:"profiles"` // default circuit.DefaultProfile
+	Prove       bool     `json:"prove"`
+	VerifyCache int      `json:"verify_cache,omitempty"` // 0 disables
+}
+
+// libInit is ddm_init's reply on success.
+type libInit struct {
+	Code     errs.Code `json:"code"`
+	Profiles []string  `json:"profiles"`          // profiles verified, String form
+	Proving  []string  `json:"proving,omitempty"` // and proven
+}
+
+var lib struct {
+	mu sync.RWMutex
+	h  http.Handler // nil before ddm_init
+}
+
+//export ddm_abi_version
+func ddm_abi_version() C.int { return abiVersion }
+
+// ddm_init loads the configured profiles, replacing those of an earlier
+// call once loaded.
+//
+//export ddm_init
+func ddm_init(configJSON *C.char, out **C.char) C.int {
+	// the host owns stdout, where gnark logs
+	logger.Disable()
+	cfg := libConfig{Dir: "./artifact", Profiles: []string{circuit.DefaultProfile}}
+	if err := json.Unmarshal([]byte(C.GoString(configJSON)), &cfg); err != nil {
+		return libError(out, fmt.Errorf("%w: config: %w", errs.ErrInvalidInput, err))
+	}
+	profiles, err := parseProfiles(strings.Join(cfg.Profiles, ","))
+	if err != nil {
+		return libError(out, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err))
+	}
+	loaded, err := loadProfiles(cfg.Dir, profiles, cfg.Prove)
+	if err != nil {
+		return libError(out, err)
+	}
+	vks := make(map[string]server.VK)
+	reply := libInit{Code: errs.CodeOK}
+	for _, l := range loaded {
+		vks[l.profile.Name] = l.served()
+		reply.Profiles = append(reply.Profiles, l.profile.String())
+	}
+	srv, err := server.New(vks, nil)
+	if err != nil {
+		return libError(out, err)
+	}
+	if cfg.VerifyCache > 0 {
+		srv.EnableCache(&verifier.Cache{TTL: verifier.DefaultCacheTTL, Max: cfg.VerifyCache})
+	}
+	for _, l := range loaded {
+		if l.ccs == nil {
+			continue
+		}
+		if err := srv.EnableProving(l.profile, l.ccs, l.pk); err != nil {
+			return libError(out, err)
+		}
+		reply.Proving = append(reply.Proving, l.profile.String())
+	}
+	lib.mu.Lock()
+	lib.h = srv.Handler()
+	lib.mu.Unlock()
+	return libReply(out, http.StatusOK, reply)
+}
+
+// ddm_prove is POST /prove: batch_json is a server.ProveRequest.
+//
+//export ddm_prove
+func ddm_prove(batchJSON *C.char, out **C.char) C.int {
+	return libCall("POST /prove", batchJSON, out)
+}
+
+// ddm_verify is POST /verify: request_json is a server.VerifyRequest.
+//
+//export ddm_verify
+func ddm_verify(requestJSON *C.char, out **C.char) C.int {
+	return libCall("POST /verify", requestJSON, out)
+}
+
+// ddm_free frees a string the library returned through out.
+//
+//export ddm_free
+func ddm_free(s *C.char) { C.free(unsafe.Pointer(s)) }
+
+// libCall serves body to the endpoint, "METHOD /path", in-process.
+func libCall(endpoint string, body *C.char, out **C.char) C.int {
+	lib.mu.RLock()
+	h := lib.h
+	lib.mu.RUnlock()
+	if h == nil {
+		return libError(out, fmt.Errorf("%w: ddm_init has not succeeded", errs.ErrUnavailable))
+	}
+	method, path, _ := strings.Cut(endpoint, " ")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(C.GoString(body))))
+	*out = C.CString(rec.Body.String())
+	return C.int(rec.Code)
+}
+
+// libError replies with err as the server would.
+func libError(out **C.char, err error) C.int {
+	return libReply(out, errs.HTTPStatus(err), server.VerifyResponse{Code: errs.CodeOf(err), Error: err.Error()})
+}
+
+func libReply(out **C.char, status int, v any) C.int {
+	b, _ := json.Marshal(v)
+	*out = C.CString(string(b) + "\n")
+	return C.int(status)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gnarking/circuit"
+	"gnarking/server"
+	"gnarking/spec"
+)
+
+func runDescribe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile to describe")
+	format := fs.String("format", "md", "md, json, or schema (JSON Schema of the POST /prove body)")
+	params := fs.String("params", "", "deployment parameters file with the bounds and size scale to describe (see circuit.LoadParams)")
+	out := fs.String("out", "", "file to write (default stdout); spec/testdata/spec_<profile>.md is the checked-in one")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *params != "" {
+		p, err := circuit.LoadParams(*params)
+		if err != nil {
+			return err
+		}
+		if profile, err = p.Apply(profile); err != nil {
+			return err
+		}
+	}
+	if *format == "schema" {
+		return writeDoc(*out, server.RequestSchema(profile))
+	}
+	s, err := spec.Describe(profile)
+	if err != nil {
+		return err
+	}
+	var doc io.WriterTo
+	switch *format {
+	case "md":
+		doc = s.Markdown()
+	case "json":
+		doc = s
+	default:
+		return fmt.Errorf("unknown format %q (want md, json or schema)", *format)
+	}
+	return writeDoc(*out, doc)
+}
+
+// writeDoc writes doc to out, or stdout when out is empty.
+func writeDoc(out string, doc io.WriterTo) error {
+	if out == "" {
+		_, err := doc.WriteTo(os.Stdout)
+		return err
+	}
+	if err := writeFile(out, doc); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", out)
+	return nil
+}
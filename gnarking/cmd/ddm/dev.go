@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	mrand "math/rand/v2"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/logger"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/circuit"
+	"gnarking/server"
+	"gnarking/spec"
+)
+
+const devUsage = "usage: ddm dev [-profile -params -n -seed -json] [-watch [-dir circuit -interval 500ms]]"
+
+// devReport is one compile-and-check of the dev profile.
+type devReport struct {
+	Profile     string          `json:"profile"` // the profile the dev one is cut from
+	N           int             `json:"n"`
+	Constraints int             `json:"constraints"`
+	Internal    int             `json:"internal_variables"`
+	Categories  []spec.Category `json:"categories"`
+	Compile     time.Duration   `json:"compile_ns"`
+	Checks      []devCheck      `json:"checks"`
+}
+
+// devCheck is one test-engine run over the fixture batch.
+type devCheck struct {
+	Name  string `json:"name"`
+	Want  string `json:"want"` // solved or rejected
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"` // the engine's, when it did not do what was wanted
+}
+
+// runDev compiles a small-N copy of a profile and runs the test engine over
+// a fixture batch. With -watch it does so on every change under -dir, each
+// time in a fresh `go run` of this command so the edited circuit package is
+// what gets compiled, and prints the constraint deltas to the last run.
+func runDev(args []string) error {
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "profile whose config (data hash, ordering, msg, bounds) the dev profile takes")
+	params := fs.String("params", "", "deployment parameters file with the bounds and size scale to compile with (see circuit.LoadParams)")
+	n := fs.Int("n", 4, "rows of the dev profile")
+	seed := fs.Uint64("seed", 1, "seed of the fixture batch's key and sizes")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	watch := fs.Bool("watch", false, "run again on every change under -dir until interrupted")
+	dir := fs.String("dir", "circuit", "directory to watch, relative to the module root")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to look for changes; a change is picked up once files stop changing for this long")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *n < 1 || *interval <= 0 {
+		return errors.New(devUsage)
+	}
+	base, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *params != "" {
+		p, err := circuit.LoadParams(*params)
+		if err != nil {
+			return err
+		}
+		if base, err = p.Apply(base); err != nil {
+			return err
+		}
+	}
+	if !*watch {
+		r, err := devRun(base, *n, *seed)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+			return r.err()
+		}
+		fmt.Print(r.text(nil))
+		return r.err()
+	}
+
+	root, err := moduleRoot()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	child := []string{"run", "./cmd/ddm", "dev", "-json", "-profile", base.Name, "-n", fmt.Sprint(*n), "-seed", fmt.Sprint(*seed)}
+	if *params != "" {
+		abs, err := filepath.Abs(*params)
+		if err != nil {
+			return err
+		}
+		child = append(child, "-params", abs)
+	}
+	return devWatch(ctx, root, filepath.Join(root, *dir), *interval, child, os.Stdout)
+}
+
+// devWatch runs `go <child>` in root now and after every settled change
+// under dir, until ctx is done. A run that does not build or whose checks
+// fail is reported and waited out; the deltas are to the last report.
+func devWatch(ctx context.Context, root, dir string, interval time.Duration, child []string, w io.Writer) error {
+	snap, err := devSnapshot(dir)
+	if err != nil {
+		return err
+	}
+	var last *devReport
+	for {
+		fmt.Fprintf(w, "== %s: compiling\n", time.Now().Format(time.TimeOnly))
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, "go", child...)
+		cmd.Dir, cmd.Stdout, cmd.Stderr = root, &out, os.Stderr
+		runErr := cmd.Run()
+		if ctx.Err() != nil {
+			return nil
+		}
+		var r devReport
+		switch {
+		case json.Unmarshal(out.Bytes(), &r) == nil && r.N > 0:
+			// failed checks exit 1 with the report written
+			fmt.Fprint(w, r.text(last))
+			last = &r
+		case runErr != nil:
+			fmt.Fprintf(w, "build failed: %v\n", runErr)
+		default:
+			fmt.Fprintf(w, "no report: %q\n", out.String())
+		}
+		fmt.Fprintf(w, "watching %s\n", dir)
+
+		// wait for a change, then for the files to settle
+		for changed := false; ; {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+			next, err := devSnapshot(dir)
+			if err != nil {
+				return err
+			}
+			if next != snap {
+				snap, changed = next, true
+				continue
+			}
+			if changed {
+				break
+			}
+		}
+	}
+}
+
+// devSnapshot fingerprints the Go files under dir by name, size and
+// modification time.
+func devSnapshot(dir string) (string, error) {
+	var b strings.Builder
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
+
+// moduleRoot is the nearest directory up from the working directory with a
+// go.mod.
+func moduleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("dev -watch runs from within the module: no go.mod found")
+		}
+		dir = parent
+	}
+}
+
+// devRun compiles base's config at n rows, with constraints attributed to
+// the steps of Define, and runs the test engine over a fixture batch and
+// tampered copies of it.
+func devRun(base circuit.Profile, n int, seed uint64) (*devReport, error) {
+	p := base
+	p.Name, p.N = fmt.Sprintf("dev-%d", n), n
+	// gnark logs the compile to stdout, where the report goes
+	logger.Disable()
+	start := time.Now()
+	s, err := spec.Describe(p)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+	r := &devReport{Profile: base.Name, N: n, Constraints: s.Constraints, Internal: s.Internal, Categories: s.Categories, Compile: time.Since(start)}
+
+	req, err := devFixture(p, seed)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := server.BatchAssignment(p, req)
+	if err != nil {
+		return nil, fmt.Errorf("fixture batch: %w", err)
+	}
+	tamper := func(f func(c *circuit.SettlementCircuit)) *circuit.SettlementCircuit {
+		c, err := server.BatchAssignment(p, req)
+		if err != nil {
+			panic(err) // built once above
+		}
+		f(c)
+		return c
+	}
+	for _, c := range []struct {
+		name  string
+		a     *circuit.SettlementCircuit
+		solve bool
+	}{
+		{"fixture batch", valid, true},
+		{"total_settle + 1", tamper(func(c *circuit.SettlementCircuit) {
+			c.P.TotalSettle = new(big.Int).Add(c.P.TotalSettle.(*big.Int), big.NewInt(1))
+		}), false},
+		{"row 0 size + 1", tamper(func(c *circuit.SettlementCircuit) {
+			c.Size[0] = new(big.Int).Add(c.Size[0].(*big.Int), big.NewInt(1))
+			c.P.TotalSettle = new(big.Int).Add(c.P.TotalSettle.(*big.Int), big.NewInt(1))
+		}), false},
+		{"other chain_id", tamper(func(c *circuit.SettlementCircuit) {
+			c.P.ChainID = new(big.Int).Add(c.P.ChainID.(*big.Int), big.NewInt(1))
+		}), false},
+		{"k_old at m", tamper(func(c *circuit.SettlementCircuit) { c.P.KOld = c.P.M }), false},
+	} {
+		full, err := p.Assign(c.a, req.Variant)
+		if err == nil {
+			err = test.IsSolved(p.Define(), full, ecc.BN254.ScalarField())
+		}
+		check := devCheck{Name: c.name, Want: "rejected", OK: (err == nil) == c.solve}
+		if c.solve {
+			check.Want = "solved"
+		}
+		if !check.OK && err != nil {
+			check.Error = err.Error()
+		}
+		r.Checks = append(r.Checks, check)
+	}
+	return r, nil
+}
+
+// devFixture is a batch of p.N rows, nonces 1..N, signed by a key from
+// seed, with sizes within p's bounds.
+func devFixture(p circuit.Profile, seed uint64) (*server.ProveRequest, error) {
+	rng := mrand.NewChaCha8([32]byte{0: byte(seed), 1: byte(seed >> 8), 2: byte(seed >> 16), 3: byte(seed >> 24), 4: byte(seed >> 32), 5: byte(seed >> 40), 6: byte(seed >> 48), 7: byte(seed >> 56)})
+	var keySeed [32]byte
+	rng.Read(keySeed[:])
+	priv, err := bnEddsa.GenerateKey(bytes.NewReader(keySeed[:]))
+	if err != nil {
+		return nil, err
+	}
+	recipient, chainID := big.NewInt(0x2a), big.NewInt(1)
+	req := &server.ProveRequest{Profile: p.Name, Recipient: "2a", ChainID: 1, Pk: hex.EncodeToString(priv.PublicKey.Bytes()), SizeScale: p.SizeScale}
+	h, err := circuit.NewMsgHasher(p.Msg, recipient, chainID)
+	if err != nil {
+		return nil, err
+	}
+	limit := big.NewInt(1_000_000)
+	for _, bound := range []*big.Int{circuit.BoundMax(p.Bounds.SizeBits), circuit.BoundMax(p.Bounds.TotalBits)} {
+		if bound != nil && bound.Cmp(limit) < 0 {
+			limit = bound
+		}
+	}
+	if p.Bounds.TotalBits > 0 {
+		// the total too
+		limit.Div(limit, big.NewInt(int64(p.N)))
+	}
+	for i := range p.N {
+		floor := min(p.Bounds.MinSize, limit.Uint64())
+		size, nonce := floor+rng.Uint64()%(limit.Uint64()-floor+1), uint64(i+1)
+		sig, err := circuit.EdDSA{}.Sign(priv, h.Sum(new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), chainID))
+		if err != nil {
+			return nil, err
+		}
+		req.Rows = append(req.Rows, server.ProveRow{Size: size, Nonce: nonce, Sig: hex.EncodeToString(sig)})
+	}
+	return req, nil
+}
+
+// text is r, with the constraint deltas to last when there is one.
+func (r *devReport) text(last *devReport) string {
+	var b strings.Builder
+	delta := func(now, was int, known bool) string {
+		switch {
+		case !known:
+			return ""
+		case now == was:
+			return "  (=)"
+		}
+		return fmt.Sprintf("  (%+d)", now-was)
+	}
+	var wasConstraints, wasInternal int
+	if last != nil {
+		wasConstraints, wasInternal = last.Constraints, last.Internal
+	}
+	fmt.Fprintf(&b, "dev-%d (profile %s): %d constraints%s, %d internal variables%s, compiled in %s\n",
+		r.N, r.Profile, r.Constraints, delta(r.Constraints, wasConstraints, last != nil),
+		r.Internal, delta(r.Internal, wasInternal, last != nil), r.Compile.Round(time.Millisecond))
+	was := map[string]int{}
+	if last != nil {
+		for _, c := range last.Categories {
+			was[c.Name] = c.Constraints
+		}
+	}
+	for _, c := range r.Categories {
+		old, ok := was[c.Name]
+		d := delta(c.Constraints, old, ok)
+		if last != nil && !ok {
+			d = "  (new)"
+		}
+		delete(was, c.Name)
+		fmt.Fprintf(&b, "  %-40s %8d%s\n", c.Name, c.Constraints, d)
+	}
+	for name, old := range was {
+		fmt.Fprintf(&b, "  %-40s %8d  (gone, was %d)\n", name, 0, old)
+	}
+	for _, c := range r.Checks {
+		status := "ok"
+		if !c.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "  %-4s %s %s", status, c.Name, c.Want)
+		if c.Error != "" {
+			fmt.Fprintf(&b, ": %s", c.Error)
+		}
+		fmt.Fprintln(&b)
+	}
+	return b.String()
+}
+
+// err is a failed check, if any.
+func (r *devReport) err() error {
+	var failed []string
+	for _, c := range r.Checks {
+		if !c.OK {
+			failed = append(failed, c.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("checks failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
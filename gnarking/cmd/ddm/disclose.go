@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/logger"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/disclose"
+	"gnarking/errs"
+	"gnarking/tracing"
+	"gnarking/verifier"
+)
+
+const discloseUsage = "usage: ddm disclose setup [-dir] | ddm disclose prove -min <total> [-profile -dir -public -out] | ddm disclose verify [-vk] <disclosure.json>"
+
+func runDisclose(args []string) error {
+	if len(args) < 1 {
+		return errors.New(discloseUsage)
+	}
+	switch args[0] {
+	case "setup":
+		return runDiscloseSetup(args[1:])
+	case "prove":
+		return runDiscloseProve(args[1:])
+	case "verify":
+		return runDiscloseVerify(args[1:])
+	default:
+		return errors.New(discloseUsage)
+	}
+}
+
+// runDiscloseSetup compiles the disclosure circuit and runs its setup, once
+// for every batch of every profile.
+func runDiscloseSetup(args []string) error {
+	fs := flag.NewFlagSet("disclose setup", flag.ExitOnError)
+	dir := fs.String("dir", "./artifact", "directory to write ccs_, pk_ and vk_disclose.groth16 to")
+	fs.Parse(args)
+	ccs, err := disclose.Compile()
+	if err != nil {
+		return err
+	}
+	pk, vk, err := tracing.Setup(context.Background(), ccs)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		kind string
+		w    io.WriterTo
+	}{{"ccs", ccs}, {"pk", pk}, {"vk", vk}} {
+		if err := writeFile(filepath.Join(*dir, f.kind+"_disclose.groth16"), f.w); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("disclosure circuit: %d constraints, setup in %s\n", ccs.GetNbConstraints(), *dir)
+	return nil
+}
+
+// runDiscloseProve proves to a third party that a settled batch paid its
+// recipient at least -min, revealing neither the total nor the other public
+// inputs. The batch's settlement proof, when in -dir, must verify first.
+func runDiscloseProve(args []string) error {
+	fs := flag.NewFlagSet("disclose prove", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile the batch was proven under, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the disclosure setup and the batch's artifacts")
+	publicFile := fs.String("public", "", "the batch's public inputs (default <dir>/public_<profile>.json)")
+	minTotal := fs.String("min", "", "total to disclose the batch paid at least, in size units (decimal at the manifest's size_scale)")
+	out := fs.String("out", "", "disclosure to write (default <dir>/disclosure_<batch id prefix>.json)")
+	fs.Parse(args)
+	if *minTotal == "" || fs.NArg() != 0 {
+		return errors.New(discloseUsage)
+	}
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+
+	var m artifacts.Manifest
+	switch err := readFile(name("manifest_%s.json"), &m); {
+	case err == nil:
+		if profile, err = manifestProfile(profile, &m); err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	min, err := circuit.ParseDecimal(*minTotal, profile.SizeScale)
+	if err != nil {
+		return err
+	}
+	if *publicFile == "" {
+		*publicFile = name("public_%s.json")
+	}
+	var pub circuit.SettlementCircuitPublic
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+
+	// only disclose about batches that were proven
+	var proof groth16_bn254.Proof
+	framed := artifacts.Proof{Proof: &proof}
+	switch err := readFile(name("proof_%s.groth16"), &framed); {
+	case err == nil:
+		var vk groth16_bn254.VerifyingKey
+		if err := readFile(name("vk_%s.groth16"), &vk); err != nil {
+			return err
+		}
+		if err := verifier.CheckBatchID(framed.Header, pub); err != nil {
+			return err
+		}
+		if err := checkFeatures(framed.Header, profile, *dir); err != nil {
+			return err
+		}
+		if err := verifier.Verify(&vk, &proof, pub); err != nil {
+			return fmt.Errorf("settlement proof: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Fprintf(os.Stderr, "no %s, settlement proof not checked\n", name("proof_%s.groth16"))
+	default:
+		return err
+	}
+
+	var ccs cs_bn254.R1CS
+	if err := readFile(filepath.Join(*dir, "ccs_disclose.groth16"), &ccs); err != nil {
+		return err
+	}
+	var pk groth16_bn254.ProvingKey
+	if err := readFile(filepath.Join(*dir, "pk_disclose.groth16"), &pk); err != nil {
+		return err
+	}
+	logger.Disable()
+	d, err := disclose.Prove(&ccs, &pk, pub, min)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = filepath.Join(*dir, fmt.Sprintf("disclosure_%s.json", d.BatchID[:16]))
+	}
+	if err := writeFile(*out, d); err != nil {
+		return err
+	}
+	fmt.Printf("%s: batch %s paid %s at least %s\n", *out, d.BatchID, d.Recipient, circuit.FormatDecimal(min, profile.SizeScale))
+	return nil
+}
+
+// runDiscloseVerify is the third party's side: check a disclosure against
+// the disclosure circuit's vk.
+func runDiscloseVerify(args []string) error {
+	fs := flag.NewFlagSet("disclose verify", flag.ExitOnError)
+	vkFile := fs.String("vk", "./artifact/vk_disclose.groth16", "the disclosure circuit's verifying key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New(discloseUsage)
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var d disclose.Disclosure
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, fs.Arg(0), err)
+	}
+	var vk groth16_bn254.VerifyingKey
+	if err := readFile(*vkFile, &vk); err != nil {
+		return err
+	}
+	if err := disclose.Verify(&vk, &d); err != nil {
+		return err
+	}
+	fmt.Printf("disclosure valid: batch %s paid %s at least %s\n", d.BatchID, d.Recipient, d.MinTotal)
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/logger"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/escrow"
+	"gnarking/publish"
+	"gnarking/server"
+)
+
+const escrowUsage = "usage: ddm escrow keygen <arbiter.key> | ddm escrow seal -arbiter <hex> [-profile -dir -data -out] | ddm escrow open -key <arbiter.key> [-receipt -dir -out] <escrow.bin>"
+
+func runEscrow(args []string) error {
+	if len(args) < 1 {
+		return errors.New(escrowUsage)
+	}
+	switch args[0] {
+	case "keygen":
+		return runEscrowKeygen(args[1:])
+	case "seal":
+		return runEscrowSeal(args[1:])
+	case "open":
+		return runEscrowOpen(args[1:])
+	default:
+		return errors.New(escrowUsage)
+	}
+}
+
+// runEscrowKeygen writes a new arbiter key and prints its public key, what
+// provers seal to.
+func runEscrowKeygen(args []string) error {
+	fs := flag.NewFlagSet("escrow keygen", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New(escrowUsage)
+	}
+	k, err := escrow.NewKey()
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite a key witnesses were sealed to
+	f, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(k.Bytes())); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("arbiter public key %x\n", k.PublicKey().Bytes())
+	return nil
+}
+
+// runEscrowSeal rebuilds a batch's witness from its row data under the
+// setup's manifest and seals it to the arbiter, for batches proven without
+// settlement_demo --escrow-arbiter.
+func runEscrowSeal(args []string) error {
+	fs := flag.NewFlagSet("escrow seal", flag.ExitOnError)
+	arbiterHex := fs.String("arbiter", "", "arbiter's X25519 public key (hex, ddm escrow keygen)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the manifest and batch")
+	data := fs.String("data", "", "batch row data (default <dir>/batch_<profile>.json)")
+	out := fs.String("out", "", "sealed witness to write (default <dir>/escrow_<profile>.bin)")
+	fs.Parse(args)
+	if *arbiterHex == "" || fs.NArg() != 0 {
+		return errors.New(escrowUsage)
+	}
+	arbiter, err := escrow.ParsePublicKey(*arbiterHex)
+	if err != nil {
+		return err
+	}
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+
+	// the header names the circuit, so the manifest is required here
+	var m artifacts.Manifest
+	if err := readFile(name("manifest_%s.json"), &m); err != nil {
+		return err
+	}
+	if profile, err = manifestProfile(profile, &m); err != nil {
+		return err
+	}
+	params, err := artifacts.ParamsOf(&m)
+	if err != nil {
+		return err
+	}
+	if *data == "" {
+		*data = name("batch_%s.json")
+	}
+	b, err := os.ReadFile(*data)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, *data, err)
+	}
+	c, err := server.BatchAssignment(profile, &req)
+	if err != nil {
+		return err
+	}
+	full, err := profile.Assign(c, req.Variant)
+	if err != nil {
+		return err
+	}
+	w, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidBatch, err)
+	}
+	sealed, err := escrow.Seal(arbiter, params.CircuitHash, w)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = name("escrow_%s.bin")
+	}
+	if err := os.WriteFile(*out, sealed, 0o600); err != nil {
+		return err
+	}
+	h, _ := escrow.ReadHeader(sealed)
+	fmt.Printf("%s: %s, sha256 %s\n", *out, h, escrow.Hash(sealed))
+	return nil
+}
+
+// runEscrowOpen is the arbiter's side of a dispute: check the sealed file
+// against the batch's receipt, decrypt it, solve the witness against the
+// circuit the header names when its setup is in -dir, and write the full
+// assignment (public inputs and every row) as JSON.
+func runEscrowOpen(args []string) error {
+	fs := flag.NewFlagSet("escrow open", flag.ExitOnError)
+	keyFile := fs.String("key", "", "arbiter key file (hex)")
+	receiptFile := fs.String("receipt", "", "the batch's publish receipt; the file must be the escrow it records")
+	dir := fs.String("dir", "./artifact", "directory holding the setup (manifest and ccs) to re-solve the witness against; skipped when the circuit's is missing")
+	out := fs.String("out", "", "write the assignment here instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *keyFile == "" {
+		return errors.New(escrowUsage)
+	}
+	keyData, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := escrow.ParseKey(string(keyData))
+	if err != nil {
+		return err
+	}
+	sealed, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *receiptFile != "" {
+		var r publish.Receipt
+		if err := readFile(*receiptFile, &r); err != nil {
+			return err
+		}
+		if r.Escrow == nil {
+			return fmt.Errorf("%w: %s records no escrow", errs.ErrArtifactMismatch, *receiptFile)
+		}
+		if got := escrow.Hash(sealed); got != r.Escrow.SHA256 {
+			return fmt.Errorf("%w: %s hashes to %s, receipt records %s", errs.ErrArtifactMismatch, fs.Arg(0), got, r.Escrow.SHA256)
+		}
+		h, err := escrow.ReadHeader(sealed)
+		if err != nil {
+			return err
+		}
+		if id := hex.EncodeToString(h.BatchID[:]); id != r.BatchID {
+			return fmt.Errorf("%w: escrow holds batch %s, receipt is for %s", errs.ErrArtifactMismatch, id, r.BatchID)
+		}
+	}
+	h, w, err := escrow.Open(key, sealed)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "opened %s\n", h)
+
+	profile, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		return err
+	}
+	m, err := (artifacts.Resolver{Dir: *dir}).Manifest(&artifacts.ProofHeader{Curve: ecc.BN254, Backend: backend.GROTH16, CircuitHash: h.CircuitHash})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "not re-solved: %v\n", err)
+	} else {
+		name, err := (artifacts.Resolver{Dir: *dir}).ForManifest(artifacts.KindCCS, m)
+		if err != nil {
+			return err
+		}
+		// gnark logs the solve to stdout, where the assignment goes
+		logger.Disable()
+		var ccs cs_bn254.R1CS
+		if err := readFile(name, &ccs); err != nil {
+			return err
+		}
+		if err := circuit.CheckHints(&ccs); err != nil {
+			return err
+		}
+		if got, err := artifacts.CircuitHash(&ccs); err != nil || got != h.CircuitHash {
+			return fmt.Errorf("%w: %s is not the circuit the escrow names (%v)", errs.ErrArtifactMismatch, name, err)
+		}
+		if err := ccs.IsSolved(w); err != nil {
+			return fmt.Errorf("%w: witness does not solve %s: %w", errs.ErrInvalidBatch, name, err)
+		}
+		fmt.Fprintf(os.Stderr, "witness solves %s\n", name)
+		if m.Profile != "" {
+			if profile, err = circuit.LookupProfile(m.Profile); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the schema only depends on the batch size, the profile's is enough
+	schema, err := frontend.NewSchema(ecc.BN254.ScalarField(), profile.Define())
+	if err != nil {
+		return err
+	}
+	doc, err := w.ToJSON(schema)
+	if err != nil {
+		return fmt.Errorf("%w: witness is not a profile %s batch: %w", errs.ErrInvalidInput, profile.Name, err)
+	}
+	doc = append(doc, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(doc)
+		return err
+	}
+	return os.WriteFile(*out, doc, 0o600)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"gnarking/events"
+	"gnarking/events/eventspb"
+)
+
+const eventsUsage = "usage: ddm events tail (-server URL [-follow] | -log events.log) [-since SEQ | -n 10] [-json]"
+
+func runEvents(args []string) error {
+	if len(args) < 1 || args[0] != "tail" {
+		return errors.New(eventsUsage)
+	}
+	return runEventsTail(args[1:])
+}
+
+// runEventsTail prints the job lifecycle events of a ddm serve -events,
+// from its GET /events stream or its log file, and with -follow keeps
+// printing those the server appends.
+func runEventsTail(args []string) error {
+	fs := flag.NewFlagSet("events tail", flag.ExitOnError)
+	serverURL := fs.String("server", "", "ddm serve URL to stream GET /events from")
+	logName := fs.String("log", "", "read the -events log file instead of a server")
+	since := fs.Uint64("since", 0, "print the events after this seq (overrides -n)")
+	n := fs.Uint64("n", 10, "print the last n events, then follow with -follow")
+	follow := fs.Bool("follow", false, "with -server, keep printing events as they are appended, until interrupted")
+	asJSON := fs.Bool("json", false, "print each event as one line of protobuf JSON")
+	fs.Parse(args)
+	if (*serverURL == "") == (*logName == "") || fs.NArg() != 0 {
+		return errors.New(eventsUsage)
+	}
+	sinceSet := false
+	fs.Visit(func(f *flag.Flag) { sinceSet = sinceSet || f.Name == "since" })
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	print := func(e *eventspb.Event) error {
+		if *asJSON {
+			b, err := protojson.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+		fmt.Println(eventLine(e))
+		return nil
+	}
+
+	if *logName != "" {
+		// read only: the log may be a running server's, which streams the
+		// events it appends
+		if *follow {
+			return errors.New("-follow needs -server")
+		}
+		var tail []*eventspb.Event
+		err := events.Scan(*logName, func(e *eventspb.Event) error {
+			switch {
+			case sinceSet && e.Seq > *since:
+				return print(e)
+			case !sinceSet && *n > 0:
+				if uint64(len(tail)) == *n {
+					tail = tail[1:]
+				}
+				tail = append(tail, e)
+			}
+			return nil
+		})
+		for _, e := range tail {
+			if err == nil {
+				err = print(e)
+			}
+		}
+		return err
+	}
+
+	c := &events.Client{URL: *serverURL}
+	var err error
+	if sinceSet {
+		err = c.Follow(ctx, *since, *follow, print)
+	} else {
+		err = c.Tail(ctx, *n, *follow, print)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// eventLine is e as one line: seq, time, batch ID prefix, profile, kind and
+// the kind's fields.
+func eventLine(e *eventspb.Event) string {
+	id := hex.EncodeToString(e.BatchId)
+	if len(id) > 16 {
+		id = id[:16]
+	}
+	head := fmt.Sprintf("%6d %s %s %-4s %-13s", e.Seq, e.Time.AsTime().UTC().Format(time.RFC3339), id, e.Profile, events.Kind(e))
+	switch k := e.Kind.(type) {
+	case *eventspb.Event_JobSubmitted:
+		j := k.JobSubmitted
+		return fmt.Sprintf("%s rows %d, recipient %s, nonces (%s, %s], total %s, chain %s, %d cores", head, j.Rows, j.Recipient, j.KOld, j.M, j.TotalSettle, j.ChainId, j.Cores)
+	case *eventspb.Event_ProofReady:
+		p := k.ProofReady
+		return fmt.Sprintf("%s proof of %d bytes in %s on %d cores", head, len(p.Proof), p.ProveTime.AsDuration().Round(time.Millisecond), p.Cores)
+	case *eventspb.Event_Submitted:
+		return fmt.Sprintf("%s tx %s", head, k.Submitted.TxHash)
+	case *eventspb.Event_Confirmed:
+		c := k.Confirmed
+		return fmt.Sprintf("%s tx %s in block %d, %d confirmations", head, c.TxHash, c.Block, c.Confirmations)
+	case *eventspb.Event_Failed:
+		f := k.Failed
+		return fmt.Sprintf("%s %s %s: %s", head, f.Stage, f.Code, f.Error)
+	}
+	return head
+}
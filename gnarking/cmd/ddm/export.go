@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/verifier"
+)
+
+// runExport regenerates the on-chain exports from existing artifacts only:
+// no ccs, no pk, no setup or prove.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default inputs and the outputs")
+	vkFile := fs.String("vk", "", "verifying key (default ./artifact/vk_<profile>.groth16)")
+	proofFile := fs.String("proof", "", "proof, framed or legacy (default ./artifact/proof_<profile>.groth16)")
+	publicFile := fs.String("public", "", "public inputs JSON (default ./artifact/public_<profile>.json)")
+	outDir := fs.String("out", "./artifact", "output directory")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		flag   *string
+		format string
+	}{
+		{vkFile, "./artifact/vk_%s.groth16"},
+		{proofFile, "./artifact/proof_%s.groth16"},
+		{publicFile, "./artifact/public_%s.json"},
+	} {
+		if *f.flag == "" {
+			*f.flag = fmt.Sprintf(f.format, profile.Name)
+		}
+	}
+
+	var (
+		vk    groth16_bn254.VerifyingKey
+		proof groth16_bn254.Proof
+		pub   circuit.SettlementCircuitPublic
+	)
+	framed := artifacts.Proof{Proof: &proof}
+	if err := readFile(*vkFile, &vk); err != nil {
+		return err
+	}
+	if err := readFile(*proofFile, &framed); err != nil {
+		return err
+	}
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+
+	// refuse to export calldata that would revert on-chain
+	if err := verifier.CheckBatchID(framed.Header, pub); err != nil {
+		return err
+	}
+	if err := checkFeatures(framed.Header, profile, filepath.Dir(*vkFile)); err != nil {
+		return err
+	}
+	if err := verifier.Verify(&vk, &proof, pub); err != nil {
+		return err
+	}
+
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		return err
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		return err
+	}
+	proofWords, err := artifacts.NewProofWrap(&proof)
+	if err != nil {
+		return err
+	}
+	calldata, err := artifacts.NewCalldata(proofWords, inputs)
+	if err != nil {
+		return err
+	}
+	summary, err := verifier.NewSummary(&vk, &proof, pub)
+	if err != nil {
+		return err
+	}
+
+	// the data hash and bounds setup compiled with narrow the inputs' ranges
+	if m, err := (artifacts.Resolver{Dir: filepath.Dir(*vkFile)}).Manifest(framed.Header); err == nil {
+		if profile, err = manifestProfile(profile, m); err != nil {
+			return err
+		}
+	}
+	layout, err := circuit.PublicLayout(profile)
+	if err != nil {
+		return err
+	}
+	// a variant's own inputs are in the public JSON or the calldata is short
+	if len(inputs) != len(layout) {
+		return fmt.Errorf("%w: %d public inputs, profile %s's layout has %d", errs.ErrArtifactMismatch, len(inputs), profile.Name, len(layout))
+	}
+
+	bounds := artifacts.SolidityBounds{Profile: profile.Name, Inputs: len(layout)}
+	heartbeat := artifacts.SolidityHeartbeat{Profile: profile.Name, Inputs: len(layout), Enabled: profile.EmptyBatches}
+	for _, in := range layout {
+		if bits := in.Bits(); bits > 0 {
+			bounds.Checks = append(bounds.Checks, artifacts.BoundCheck{Name: in.Name, Index: in.Index, Bits: bits})
+		}
+		switch in.Name {
+		case "k_old":
+			heartbeat.KOld = in.Index
+		case "m":
+			heartbeat.M = in.Index
+		case "total_settle":
+			heartbeat.Total = in.Index
+		}
+	}
+
+	out := func(format string) string {
+		return filepath.Join(*outDir, fmt.Sprintf(format, profile.Name))
+	}
+	solName := out("settlement_verifier_%s.sol")
+	if err := writeFile(solName, artifacts.WriterFunc(func(w io.Writer) error { return vk.ExportSolidity(w) })); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", solName)
+
+	for _, e := range []struct {
+		name string
+		a    io.WriterTo
+	}{
+		{out("proof_%s.json"), &proofWords},
+		{out("public_sol_%s.json"), &inputs},
+		{out("calldata_%s.hex"), &calldata},
+		{out("public_layout_%s.json"), layout},
+		{out("settlement_bounds_%s.sol"), &bounds},
+		{out("settlement_heartbeat_%s.sol"), &heartbeat},
+		{out("summary_%s.json"), &summary},
+	} {
+		if err := writeFile(e.name, e.a); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", e.name)
+	}
+	fmt.Printf("\npublic inputs (verifier input order):\n%s", layout.Table(inputs))
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/fetch"
+	"gnarking/ioutilx"
+	"gnarking/retry"
+)
+
+const fetchUsage = "usage: ddm fetch -profile N -from s3://bucket/prefix|URL|DIR (-pin SHA256 | -release-keys HEX,...) [-dir] | ddm fetch keygen KEYFILE | ddm fetch sign -key KEYFILE [-profile -dir]"
+
+// runFetch bootstraps a prover host with a published setup, and signs
+// setups for publishing: the setup host runs settlement_demo --setup
+// --bundle, then ddm fetch sign, and uploads the bundle and the signature.
+func runFetch(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "keygen":
+			return runFetchKeygen(args[1:])
+		case "sign":
+			return runFetchSign(args[1:])
+		}
+	}
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile to fetch, names the artifacts (N=512 for 512)")
+	from := fs.String("from", "", "where the setup is published: s3://bucket/prefix (AWS_* credentials, region, endpoint), http(s)://host/path or a directory; holds settlement_<profile>.ddmbundle and manifest_<profile>.sig")
+	dir := fs.String("dir", "./artifact", "artifact directory to install into")
+	pin := fs.String("pin", "", "hex sha256 digest the manifest must have (ddm fetch sign prints it)")
+	releaseKeys := fs.String("release-keys", "", "comma-separated hex Ed25519 public keys, one of which must have signed the manifest")
+	timeout := fs.Duration("timeout", 2*time.Hour, "overall deadline")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of -from requests: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+	if *from == "" || fs.NArg() != 0 {
+		return errors.New(fetchUsage)
+	}
+	policy, err := retry.Parse(*retrySpec)
+	if err != nil {
+		return err
+	}
+	profile, err := circuit.LookupProfile(strings.TrimPrefix(*profileName, "N="))
+	if err != nil {
+		return err
+	}
+	trust := fetch.Trust{Pin: *pin}
+	if *releaseKeys != "" {
+		if trust.Keys, err = artifacts.ParseReleaseKeys(*releaseKeys); err != nil {
+			return err
+		}
+	}
+	src, err := fetch.Parse(*from, policy)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	installed, err := fetch.Install(ctx, src, profile.Name, *dir, trust, func(m *artifacts.Manifest) error {
+		// a setup of another circuit than this build's profile
+		if _, err := manifestProfile(profile, m); err != nil {
+			return err
+		}
+		return circuit.CheckHintSet(m.Hints)
+	})
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range installed {
+		total += f.Size
+		fmt.Printf("%-24s %10s\n", filepath.Base(f.Name), ioutilx.Size(f.Size))
+	}
+	took := time.Since(start)
+	fmt.Printf("installed profile %s from %s in %s (%s)\n", profile.Name, *from, took.Round(time.Millisecond), ioutilx.Rate(total, took))
+	return nil
+}
+
+// runFetchKeygen writes a new release key and prints its public key, what
+// prover hosts pass as -release-keys.
+func runFetchKeygen(args []string) error {
+	fs := flag.NewFlagSet("fetch keygen", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New(fetchUsage)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite a key hosts trust
+	f, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(priv.Seed())); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("release public key %x\n", pub)
+	return nil
+}
+
+// runFetchSign signs a profile's manifest with the release key, next to it
+// as manifest_<profile>.sig.
+func runFetchSign(args []string) error {
+	fs := flag.NewFlagSet("fetch sign", flag.ExitOnError)
+	keyFile := fs.String("key", "", "release key file (ddm fetch keygen)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the manifest")
+	dir := fs.String("dir", "./artifact", "directory holding the manifest")
+	fs.Parse(args)
+	if *keyFile == "" || fs.NArg() != 0 {
+		return errors.New(fetchUsage)
+	}
+	b, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return fmt.Errorf("%w: release key %s: want %d hex bytes", errs.ErrInvalidInput, *keyFile, ed25519.SeedSize)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	profile := strings.TrimPrefix(*profileName, "N=")
+
+	var m artifacts.Manifest
+	if err := readFile(filepath.Join(*dir, fmt.Sprintf("manifest_%s.json", profile)), &m); err != nil {
+		return err
+	}
+	sig, err := artifacts.SignManifest(key, &m)
+	if err != nil {
+		return err
+	}
+	d, err := artifacts.ManifestDigest(&m)
+	if err != nil {
+		return err
+	}
+	sigName := filepath.Join(*dir, fetch.SigName(profile))
+	if err := os.WriteFile(sigName, []byte(hex.EncodeToString(sig)+"\n"), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\nmanifest digest %x (ddm fetch -pin), release key %x\n", sigName, d, key.Public())
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/gas"
+	"gnarking/server"
+)
+
+// runGas runs the exported verifier with the current proof in an
+// in-process EVM and reports the exact gas of each submission format.
+func runGas(args []string) error {
+	fs := flag.NewFlagSet("gas", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default inputs")
+	dir := fs.String("dir", "./artifact", "directory of the default inputs")
+	proofFile := fs.String("proof", "", "proof, framed or legacy (default <dir>/proof_<profile>.groth16)")
+	publicFile := fs.String("public", "", "public inputs JSON (default <dir>/public_<profile>.json)")
+	batchFile := fs.String("batch", "", "the proven batch, for the formats that carry its rows (default <dir>/batch_<profile>.json when present)")
+	binFile := fs.String("bin", "", "runtime bytecode of the exported verifier, hex (default <dir>/settlement_verifier_<profile>.bin-runtime, else compiled with solc from PATH)")
+	options := fs.String("options", "all", "comma-separated formats, or all: "+joinOptions())
+	gasPrice := fs.Float64("gas-price-gwei", 0.01, "gas price")
+	blobGasPrice := fs.Float64("blob-gas-price-gwei", 1e-9, "blob gas price (the minimum is 1 wei)")
+	ethUSD := fs.Float64("eth-usd", 3000, "ETH price in USD")
+	asJSON := fs.Bool("json", false, "print the measurements as JSON")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	if *proofFile == "" {
+		*proofFile = name("proof_%s.groth16")
+	}
+	if *publicFile == "" {
+		*publicFile = name("public_%s.json")
+	}
+	var opts []gas.Option
+	if *options == "all" {
+		opts = gas.Options
+	} else {
+		for _, s := range strings.Split(*options, ",") {
+			o, err := gas.ParseOption(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			opts = append(opts, o)
+		}
+	}
+
+	var (
+		proof groth16_bn254.Proof
+		pub   circuit.SettlementCircuitPublic
+	)
+	framed := artifacts.Proof{Proof: &proof}
+	if err := readFile(*proofFile, &framed); err != nil {
+		return err
+	}
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+	code, err := verifierCode(*binFile, name("settlement_verifier_%s.bin-runtime"), name("settlement_verifier_%s.sol"))
+	if err != nil {
+		return err
+	}
+
+	var b gas.Batch
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		return err
+	}
+	if b.Inputs, err = artifacts.NewPublicInputsHexFromWitness(wit); err != nil {
+		return err
+	}
+	if b.Proof, err = artifacts.NewProofWrap(&proof); err != nil {
+		return err
+	}
+
+	// the data hash and ordering setup compiled with say how rows are rooted
+	if m, err := (artifacts.Resolver{Dir: *dir}).Manifest(framed.Header); err == nil {
+		if profile, err = manifestProfile(profile, m); err != nil {
+			return err
+		}
+	}
+	if *batchFile == "" {
+		if _, err := os.Stat(name("batch_%s.json")); err == nil {
+			*batchFile = name("batch_%s.json")
+		}
+	}
+	if *batchFile != "" {
+		if err := batchRows(&b, *batchFile, profile); err != nil {
+			return err
+		}
+	}
+
+	ms, err := gas.Measure(code, b, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(ms)
+	}
+	if *batchFile == "" {
+		fmt.Println("no -batch: the formats carrying rows are skipped")
+	}
+	fmt.Printf("gas at %g gwei, blob gas at %g gwei, ETH $%.0f\n", *gasPrice, *blobGasPrice, *ethUSD)
+	return gas.WriteTable(os.Stdout, ms, *gasPrice, *blobGasPrice, *ethUSD)
+}
+
+// verifierCode reads the verifier's runtime bytecode from bin, else from
+// defaultBin, else compiles sol with solc as the EVM parity test's
+// bytecode was: optimizer on, 200 runs.
+func verifierCode(bin, defaultBin, sol string) ([]byte, error) {
+	if bin == "" {
+		if _, err := os.Stat(defaultBin); err == nil {
+			bin = defaultBin
+		}
+	}
+	var text []byte
+	if bin != "" {
+		var err error
+		if text, err = os.ReadFile(bin); err != nil {
+			return nil, err
+		}
+	} else {
+		solc, err := exec.LookPath("solc")
+		if err != nil {
+			return nil, fmt.Errorf("no %s and no solc in PATH: compile %s with solc --optimize --bin-runtime and pass -bin", defaultBin, sol)
+		}
+		out, err := exec.Command(solc, "--optimize", "--optimize-runs", "200", "--bin-runtime", sol).Output()
+		if err != nil {
+			return nil, fmt.Errorf("solc %s: %w", sol, err)
+		}
+		// one "Binary of the runtime part:" per contract; the verifier's is the longest
+		for _, line := range bytes.Split(out, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > len(text) {
+				if _, err := hex.DecodeString(string(line)); err == nil {
+					text = line
+				}
+			}
+		}
+	}
+	code, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(text)), "0x"))
+	if err != nil || len(code) == 0 {
+		return nil, fmt.Errorf("%w: verifier bytecode: not hex", errs.ErrInvalidInput)
+	}
+	return code, nil
+}
+
+// batchRows packs the rows of the batch in batchFile into b, in root order,
+// checking they are the rows the proof's BatchDataRoot commits to.
+func batchRows(b *gas.Batch, batchFile string, profile circuit.Profile) error {
+	data, err := os.ReadFile(batchFile)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, batchFile, err)
+	}
+	sizes, nonces := make([]*big.Int, len(req.Rows)), make([]*big.Int, len(req.Rows))
+	for i, row := range req.Rows {
+		sizes[i], nonces[i] = new(big.Int).SetUint64(row.Size), new(big.Int).SetUint64(row.Nonce)
+	}
+	root, err := circuit.RowsRoot(profile.DataHash, profile.Ordering, sizes, nonces)
+	if err != nil {
+		return err
+	}
+	layout, err := circuit.PublicLayout(profile)
+	if err != nil {
+		return err
+	}
+	for _, in := range layout {
+		if in.Name != "batch_data_root" {
+			continue
+		}
+		if want, _ := new(big.Int).SetString(strings.TrimPrefix(b.Inputs[in.Index], "0x"), 16); root.Cmp(want) != 0 {
+			return fmt.Errorf("%w: %s is not the proven batch: its rows root to %#x, the proof's BatchDataRoot is %#x", errs.ErrInvalidBatch, batchFile, root, want)
+		}
+		if profile.DataHash == circuit.DataHashKeccak {
+			b.KeccakRoot = root
+		}
+	}
+	if profile.Ordering == circuit.OrderingPermuted {
+		sizes, nonces = circuit.SortRows(sizes, nonces)
+	}
+	packedSizes, packedNonces := make([]uint64, len(sizes)), make([]uint64, len(nonces))
+	for i := range sizes {
+		packedSizes[i], packedNonces[i] = sizes[i].Uint64(), nonces[i].Uint64()
+	}
+	b.Rows, err = gas.PackRows(packedSizes, packedNonces)
+	return err
+}
+
+func joinOptions() string {
+	names := make([]string, len(gas.Options))
+	for i, o := range gas.Options {
+		names[i] = string(o)
+	}
+	return strings.Join(names, ", ")
+}
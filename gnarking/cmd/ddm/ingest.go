@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/evmlog"
+	"gnarking/retry"
+	"gnarking/server"
+)
+
+const ingestUsage = `usage: ddm ingest -rpc URL -contract ADDR -events "Authorized(bytes32 indexed pk, address indexed recipient, uint256 amount, uint64 nonce, bytes sig)[; ...]" [-from-block -to-block -profile -chain-id -pk -out -flagged -server]`
+
+// runIngest reads the deposit and authorization events of an existing
+// escrow contract as settlement rows: the valid ones are written as
+// intents, and registered with a ddm serve's intake with -server, the
+// rest are listed with the reason they cannot be proven.
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "", "JSON-RPC endpoint (required)")
+	contract := fs.String("contract", "", "escrow contract address (required)")
+	eventDecls := fs.String("events", "", "semicolon-separated Solidity declarations of the events to read; parameters named pk, recipient, amount|size, nonce, chain_id and sig (bytes) supply the row")
+	fromBlock := fs.Uint64("from-block", 0, "first block to read events from, e.g. the contract's deployment")
+	toBlock := fs.Uint64("to-block", 0, "last block to read events from (default latest)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile of the intents, whose message version signatures are checked under")
+	chainID := fs.Uint64("chain-id", 1, "chain ID of rows whose event has no chain_id parameter")
+	pk := fs.String("pk", "", "hex EdDSA public key of the signer of rows whose event has no pk parameter")
+	out := fs.String("out", "intents.jsonl", "valid rows, one intake.Intent JSON per line")
+	flagged := fs.String("flagged", "flagged.jsonl", "rows that cannot be proven, one JSON per line with flag and reason")
+	serverURL := fs.String("server", "", "also submit the valid rows to this ddm serve's intake (POST /intents)")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of -rpc reads: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+	if *rpcURL == "" || *contract == "" || *eventDecls == "" || fs.NArg() != 0 {
+		return errors.New(ingestUsage)
+	}
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	rpc, err := chainsync.NewRPC(*rpcURL, *contract)
+	if err != nil {
+		return err
+	}
+	if rpc.Retry, err = retry.Parse(*retrySpec); err != nil {
+		return err
+	}
+	r := &evmlog.Reader{Logs: rpc, Profile: profile.Name, Msg: profile.Msg, ChainID: *chainID, Pk: *pk}
+	for decl := range strings.SplitSeq(*eventDecls, ";") {
+		if strings.TrimSpace(decl) == "" {
+			continue
+		}
+		e, err := evmlog.ParseEvent(decl)
+		if err != nil {
+			return err
+		}
+		r.Events = append(r.Events, e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if *toBlock == 0 {
+		if *toBlock, err = rpc.BlockNumber(ctx); err != nil {
+			return err
+		}
+	}
+	rows, err := r.Read(ctx, *fromBlock, *toBlock)
+	if err != nil {
+		return err
+	}
+	valid := evmlog.Valid(rows)
+	if err := writeLines(*out, valid); err != nil {
+		return err
+	}
+	var bad []evmlog.Row
+	byFlag := map[evmlog.Flag]int{}
+	for _, row := range rows {
+		if row.Flag != "" {
+			bad = append(bad, row)
+			byFlag[row.Flag]++
+		}
+	}
+	if err := writeLines(*flagged, bad); err != nil {
+		return err
+	}
+	fmt.Printf("blocks %d-%d: %d events, %d valid rows to %s, %d flagged to %s", *fromBlock, *toBlock, len(rows), len(valid), *out, len(bad), *flagged)
+	for _, f := range []evmlog.Flag{evmlog.FlagUnsigned, evmlog.FlagBadSignature, evmlog.FlagInvalid, evmlog.FlagDuplicate} {
+		if byFlag[f] > 0 {
+			fmt.Printf(", %s %d", f, byFlag[f])
+		}
+	}
+	fmt.Println()
+
+	if *serverURL == "" {
+		return nil
+	}
+	c := &server.Client{URL: *serverURL}
+	taken, dups := 0, 0
+	for _, in := range valid {
+		_, dup, err := c.Intent(ctx, in)
+		if err != nil {
+			return fmt.Errorf("intent %s/%d: %w", in.Pk, in.Nonce, err)
+		}
+		if dup {
+			dups++
+		} else {
+			taken++
+		}
+	}
+	fmt.Printf("%s: %d intents taken, %d already there\n", *serverURL, taken, dups)
+	return nil
+}
+
+// writeLines writes one JSON line per value of vs to name.
+func writeLines[T any](name string, vs []T) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, v := range vs {
+		if err := enc.Encode(v); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
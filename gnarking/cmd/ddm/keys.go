@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"gnarking/hsm"
+	"gnarking/keys"
+)
+
+const keysUsage = "usage: ddm keys new <master.hex> | ddm keys export -master <master.hex> (-path m/1'/2' | -recipient 0x.. | -epoch N) | ddm keys wrap -master <master.hex> (-path|-recipient|-epoch) -backend kms|pkcs11 -key-id <id> -out key.json | ddm keys ceremony -backend kms|pkcs11 [-out ceremony.md] | ddm keys violations [-json] <key>.usage.json"
+
+func runKeys(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf(keysUsage)
+	}
+	switch args[0] {
+	case "new":
+		return runKeysNew(args[1:])
+	case "export":
+		return runKeysExport(args[1:])
+	case "wrap":
+		return runKeysWrap(args[1:])
+	case "ceremony":
+		return runKeysCeremony(args[1:])
+	case "violations":
+		return runKeysViolations(args[1:])
+	default:
+		return fmt.Errorf(keysUsage)
+	}
+}
+
+func runKeysNew(args []string) error {
+	fs := flag.NewFlagSet("keys new", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf(keysUsage)
+	}
+	s, err := keys.NewSeed()
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite a seed registered keys were derived from
+	f, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// keyFlags are the master seed and path flags export and wrap share.
+type keyFlags struct {
+	seedFile, pathStr, recipientHex *string
+	epoch                           *int64
+}
+
+func newKeyFlags(fs *flag.FlagSet) keyFlags {
+	return keyFlags{
+		seedFile:     fs.String("master", "", "master seed file (hex)"),
+		pathStr:      fs.String("path", "", "derivation path, hardened only"),
+		recipientHex: fs.String("recipient", "", "derive at the recipient's path (keys.RecipientPath) instead"),
+		epoch:        fs.Int64("epoch", -1, "derive at the epoch's path (keys.EpochPath) instead"),
+	}
+}
+
+// node is the node the flags name, under the master seed they name.
+func (k keyFlags) node() (keys.Node, error) {
+	picked := 0
+	for _, set := range []bool{*k.pathStr != "", *k.recipientHex != "", *k.epoch >= 0} {
+		if set {
+			picked++
+		}
+	}
+	if *k.seedFile == "" || picked != 1 {
+		return keys.Node{}, fmt.Errorf(keysUsage)
+	}
+	data, err := os.ReadFile(*k.seedFile)
+	if err != nil {
+		return keys.Node{}, err
+	}
+	seed, err := keys.ParseSeed(string(data))
+	if err != nil {
+		return keys.Node{}, err
+	}
+
+	var path keys.Path
+	switch {
+	case *k.pathStr != "":
+		path, err = keys.ParsePath(*k.pathStr)
+	case *k.recipientHex != "":
+		recipient, ok := new(big.Int).SetString(strings.TrimPrefix(*k.recipientHex, "0x"), 16)
+		if !ok {
+			return keys.Node{}, fmt.Errorf("invalid recipient %q", *k.recipientHex)
+		}
+		path = keys.RecipientPath(recipient)
+	default:
+		path, err = keys.EpochPath(uint32(min(*k.epoch, keys.Hardened)))
+	}
+	if err != nil {
+		return keys.Node{}, err
+	}
+	return keys.Master(seed).Derive(path)
+}
+
+// runKeysExport prints the public key at a path as JSON, in the forms the
+// contract registration and batches take.
+func runKeysExport(args []string) error {
+	fs := flag.NewFlagSet("keys export", flag.ExitOnError)
+	kf := newKeyFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf(keysUsage)
+	}
+	n, err := kf.node()
+	if err != nil {
+		return err
+	}
+	priv, err := n.PrivateKey()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(keys.ExportKey(n.Path, &priv.PublicKey))
+}
+
+// runKeysWrap wraps the key at a path with a KMS key or a PKCS#11 token's
+// AES key (package hsm), for signers that hold no master seed. Store
+// settings beyond the key id come from the environment (hsm.ConfigFromEnv).
+func runKeysWrap(args []string) error {
+	fs := flag.NewFlagSet("keys wrap", flag.ExitOnError)
+	kf := newKeyFlags(fs)
+	backend := fs.String("backend", "", "key store: kms or pkcs11")
+	keyID := fs.String("key-id", "", "wrapping key: KMS key ARN, or slot=<id>;label=<label> on the token")
+	out := fs.String("out", "", "key file to write")
+	timeout := fs.Duration("timeout", time.Minute, "bound on the store's wrap and check")
+	fs.Parse(args)
+	if *backend == "" || *keyID == "" || *out == "" || fs.NArg() != 0 {
+		return fmt.Errorf(keysUsage)
+	}
+	n, err := kf.node()
+	if err != nil {
+		return err
+	}
+	b, err := hsm.ConfigFromEnv().Backend(*backend, *keyID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	f, err := hsm.Wrap(ctx, b, n)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*out, f); err != nil {
+		return err
+	}
+	fmt.Printf("wrapped %s (pk %s) with %s %s into %s\n", f.Path, f.Pk, f.Backend, f.KeyID, *out)
+	return nil
+}
+
+// runKeysCeremony prints the key ceremony for a store, as generated from
+// package hsm.
+func runKeysCeremony(args []string) error {
+	fs := flag.NewFlagSet("keys ceremony", flag.ExitOnError)
+	backend := fs.String("backend", "", "key store: kms or pkcs11")
+	out := fs.String("out", "", "write here instead of stdout")
+	fs.Parse(args)
+	if *backend == "" || fs.NArg() != 0 {
+		return fmt.Errorf(keysUsage)
+	}
+	doc, err := hsm.Ceremony(*backend)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(doc)
+		return err
+	}
+	return os.WriteFile(*out, doc, 0o644)
+}
+
+// runKeysViolations prints the signatures a key usage policy refused, as
+// kept in a signer's usage state file (keys.Enforcer.State: the
+// <key>.usage.json next to the key of settlement_demo --key-policy and
+// ddm cosign sign), oldest first.
+func runKeysViolations(args []string) error {
+	fs := flag.NewFlagSet("keys violations", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the violations as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf(keysUsage)
+	}
+	// the enforcer creates a missing state file: only read one that exists
+	if _, err := os.Stat(fs.Arg(0)); err != nil {
+		return err
+	}
+	vs, err := (&keys.Enforcer{State: fs.Arg(0)}).Violations()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(append([]keys.Violation{}, vs...)) // [] for none
+	}
+	for _, v := range vs {
+		fmt.Printf("%s %s chain %d size %d: %s\n", v.Time.Format(time.RFC3339), v.Path, v.ChainID, v.Size, v.Reason)
+	}
+	fmt.Printf("%d violations in %s (the last %d are kept)\n", len(vs), fs.Arg(0), keys.MaxViolations)
+	return nil
+}
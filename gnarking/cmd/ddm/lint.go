@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/lint"
+	"gnarking/server"
+)
+
+const lintUsage = "usage: ddm lint -rules rules.json [-profile -dir -batch -tenant -json]"
+
+// runLint checks a batch against lint rules offline, as ddm serve -lint
+// would before proving it: every rule it breaks, with the rows breaking
+// it. It fails when there are any.
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	rulesFile := fs.String("rules", "", "lint rules (JSON, see package lint)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default batch; the batch's own profile wins")
+	dir := fs.String("dir", "./artifact", "directory of the default batch")
+	batchFile := fs.String("batch", "", "the batch, as POST /prove takes it (default <dir>/batch_<profile>.json)")
+	tenant := fs.String("tenant", "", "tenant whose rules apply besides the rest, as ddm serve takes it from the "+lint.TenantHeader+" header")
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	fs.Parse(args)
+	if *rulesFile == "" || fs.NArg() != 0 {
+		return errors.New(lintUsage)
+	}
+	l, err := lint.Load(*rulesFile)
+	if err != nil {
+		return err
+	}
+	if *batchFile == "" {
+		*batchFile = filepath.Join(*dir, fmt.Sprintf("batch_%s.json", *profileName))
+	}
+	b, err := os.ReadFile(*batchFile)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, *batchFile, err)
+	}
+	profile := cmp.Or(req.Profile, *profileName)
+	batch, err := server.LintBatch(profile, *tenant, &req)
+	if err != nil {
+		return err
+	}
+
+	err = l.Check(batch)
+	var rep *lint.Report
+	if err != nil && !errors.As(err, &rep) {
+		return err
+	}
+	if *asJSON {
+		if rep == nil {
+			rep = &lint.Report{Profile: profile, Tenant: *tenant, Violations: []lint.Violation{}}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			return err
+		}
+	} else if rep == nil {
+		fmt.Printf("%s: %d rows pass %d lint rules\n", *batchFile, len(batch.Rows), l.Rules(profile, *tenant))
+	} else {
+		for _, v := range rep.Violations {
+			fmt.Println(v)
+		}
+	}
+	if rep != nil {
+		return fmt.Errorf("%w: %s breaks %d lint rules", errs.ErrPolicyRejected, *batchFile, len(rep.Violations))
+	}
+	return nil
+}
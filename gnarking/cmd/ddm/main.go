@@ -0,0 +1,118 @@
+// ddm is the operator CLI: ddm <command> [flags]
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gnarking/artifacts"
+	"gnarking/chaos"
+	"gnarking/plugins"
+	"gnarking/tracing"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":      {"run the verifier HTTP server", runServe},
+	"audit":      {"audit log tools (verify-chain)", runAudit},
+	"export":     {"regenerate Solidity verifier, proof JSON, inputs and calldata from vk/proof/public files", runExport},
+	"gas":        {"run the exported verifier with the current proof in an in-process EVM and compare the exact gas of each submission format (calldata, compressed proof, keccak rows, 4844 blob)", runGas},
+	"simulate":   {"estimate constraints, prove time on this host, memory, proof size, gas and cost per tx without proving", runSimulate},
+	"lint":       {"check a batch against lint rules as ddm serve -lint does before proving, and report every rule it breaks with the rows breaking it", runLint},
+	"submit":     {"post a proof to the verifier contract, refusing expired proofs and stale KOld", runSubmit},
+	"events":     {"follow the job lifecycle events of a ddm serve -events (tail), from GET /events or the log file", runEvents},
+	"stats":      {"percentiles of the per-proof statistics ddm serve -stats-dir records (prove time, phases, memory, cost) over a window", runStats},
+	"report":     {"end-of-day report over a window: batches proven, published and settled, value settled, cost per tx, gas and fees, failures with reasons", runReport},
+	"stream":     {"prove the intents of a Kafka topic or NATS JetStream consumer on a ddm serve, acknowledging each once its batch is proven", runStream},
+	"ingest":     {"read the deposit and authorization events of an existing escrow contract as settlement rows: valid ones to intents (and a ddm serve's intake), the rest flagged with why", runIngest},
+	"fetch":      {"bootstrap a prover host: download a profile's setup bundle from S3, HTTP or a directory, check it against a pinned digest or the release keys' signature, and install ccs/pk/vk and manifest (keygen, sign to publish)", runFetch},
+	"sync":       {"publish a setup in content-defined chunks, or sync one, fetching only the chunks local files lack (e.g. after a ceremony contribution)", runSync},
+	"publish":    {"pin proof JSON, public inputs and batch data to IPFS or a CAS directory and write a receipt of their CIDs", runPublish},
+	"disclose":   {"prove to a third party that a batch paid its recipient at least X, revealing nothing else (setup, prove, verify)", runDisclose},
+	"escrow":     {"seal a batch's witness to a dispute arbiter, and open it as the arbiter (keygen, seal, open)", runEscrow},
+	"redact":     {"write a proven batch's data with rows withheld as their leaves of a mimc-tree root, or check such a file against the proven root", runRedact},
+	"spotcheck":  {"sampled spot audits of a proven batch: commit to its rows, then open a Fiat–Shamir sample of them and check their signatures (keygen, commit, audit)", runSpotcheck},
+	"cosign":     {"co-sign a batch for 2-of-2 settlement (operator + risk engine keys), verify co-signatures and attach them to the batch (sign, verify, attach)", runCosign},
+	"revoke":     {"maintain the revocation list of operator keys (add, remove, root) and write a key's non-membership witness", runRevoke},
+	"mmr":        {"the Merkle mountain range of every proven batch root (root, append, check) and a batch's inclusion proof in it (prove, verify)", runMMR},
+	"view":       {"viewing keys for private-recipient batches (keygen, open)", runView},
+	"ccs":        {"dump the compiled constraint system for audits: constraints by wire name, counts per step and per input", runCCS},
+	"describe":   {"write the circuit specification (statement, inputs, constraints per step) as markdown or JSON", runDescribe},
+	"keys":       {"master seed and derived EdDSA signing keys (new, export public keys for contract registration)", runKeys},
+	"archive":    {"file a profile's proof, public inputs, calldata, receipt and batch data into a dated per-batch directory of the archive, with an index", runArchive},
+	"gc":         {"delete archived batches older than the retention or beyond a size limit, oldest first", runGC},
+	"migrate":    {"re-prove archived batches under a new circuit version and report old to new batch IDs and proofs", runMigrate},
+	"verify":     {"verify a proof against its vk and public inputs, -batch against the raw batch, -cross-check with a second, independent verifier", runVerify},
+	"verify-sol": {"check an exported Solidity verifier against its vk: every embedded vk constant, and the code against this ddm's export (source fingerprint), before deployment", runVerifySol},
+	"dev":        {"compile a small-N copy of a profile, run the test engine over a fixture batch and print constraints per step; -watch reruns on every circuit/ change with the deltas", runDev},
+	"vectors":    {"write the cross-language test vector fixtures (keys, messages, signatures, hashes, batches, proofs)", runVectors},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ddm <command> [flags]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ddm: unknown command %q\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	// profiles registered by the plugins in DDM_PLUGINS, before any flag
+	// names one
+	if _, err := plugins.LoadEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "ddm: %v\n", err)
+		os.Exit(1)
+	}
+	// spans go to OTEL_EXPORTER_OTLP_ENDPOINT when it is set
+	shutdown, err := tracing.Init(context.Background(), "ddm")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddm: tracing: %v\n", err)
+		os.Exit(1)
+	}
+	err = cmd.run(os.Args[2:])
+	shutdown(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddm %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func readFile(fName string, r io.ReaderFrom) error {
+	f, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := artifacts.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	_, err = artifacts.Decode(r, chaos.Reader(fName, zr))
+	return err
+}
+
+func writeFile(fName string, w io.WriterTo) error {
+	return artifacts.WriteFile(fName, w, false)
+}
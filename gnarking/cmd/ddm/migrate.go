@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/prover"
+	"gnarking/report"
+	"gnarking/server"
+	"gnarking/verifier"
+)
+
+const migrateUsage = "usage: ddm migrate -from OLD_DIR -to NEW_DIR [-profile -batches GLOB -out DIR -report FILE -dry-run]"
+
+// runMigrate re-proves archived batches under a new circuit version, for
+// when a fix to the circuit leaves every proof made under the old one
+// suspect. Each batch's public inputs are derived again from its rows under
+// both versions, the batch is proven and verified under the new setup, and
+// the report maps old batch IDs to new ones and new proof files.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile the batches were proven under")
+	from := fs.String("from", "", "directory of the old setup (manifest_<profile>.json)")
+	to := fs.String("to", "", "directory of the new setup: its manifest, ccs, pk and vk")
+	batches := fs.String("batches", "", "archived batch files to migrate (default <from>/batch_*.json)")
+	out := fs.String("out", "", "directory for the new proof_*.groth16 and public_*.json (default -to; never -from)")
+	reportName := fs.String("report", "", "mapping report to write (default <out>/migration_<profile>.json)")
+	dryRun := fs.Bool("dry-run", false, "derive and compare public inputs only, prove nothing")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return errors.New(migrateUsage)
+	}
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = *to
+	}
+	// the old proofs are the record of what was settled, never overwrite them
+	if same, err := sameDir(*out, *from); err != nil {
+		return err
+	} else if same {
+		return fmt.Errorf("%w: -out %s is the old setup's directory", errs.ErrInvalidInput, *out)
+	}
+	if *batches == "" {
+		*batches = filepath.Join(*from, "batch_*.json")
+	}
+	if *reportName == "" {
+		*reportName = filepath.Join(*out, fmt.Sprintf("migration_%s.json", profile.Name))
+	}
+
+	var oldM, newM artifacts.Manifest
+	if err := readFile(filepath.Join(*from, fmt.Sprintf("manifest_%s.json", profile.Name)), &oldM); err != nil {
+		return fmt.Errorf("old setup: %w", err)
+	}
+	if err := readFile(filepath.Join(*to, fmt.Sprintf("manifest_%s.json", profile.Name)), &newM); err != nil {
+		return fmt.Errorf("new setup: %w", err)
+	}
+	oldP, err := manifestProfile(profile, &oldM)
+	if err != nil {
+		return fmt.Errorf("old setup: %w", err)
+	}
+	newP, err := manifestProfile(profile, &newM)
+	if err != nil {
+		return fmt.Errorf("new setup: %w", err)
+	}
+
+	var s *migrationSetup
+	if !*dryRun {
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			return err
+		}
+		if s, err = loadMigrationSetup(*to, &newM); err != nil {
+			return fmt.Errorf("new setup: %w", err)
+		}
+	}
+
+	names, err := filepath.Glob(*batches)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: no batch files match %s", errs.ErrInvalidInput, *batches)
+	}
+	rep := report.Migration{
+		Profile: profile.Name,
+		From:    circuitVersion(&oldM),
+		To:      circuitVersion(&newM),
+		DryRun:  *dryRun,
+	}
+	ctx := context.Background()
+	for _, name := range names {
+		rep.Batches = append(rep.Batches, migrateBatch(ctx, name, oldP, newP, s, *out))
+	}
+
+	if err := writeFile(*reportName, artifacts.WriterFunc(func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(&rep)
+	})); err != nil {
+		return err
+	}
+	fmt.Print(rep)
+	fmt.Printf("wrote %s\n", *reportName)
+	if n := rep.Failed(); n > 0 {
+		return fmt.Errorf("%d of %d batches not migrated, see %s", n, len(names), *reportName)
+	}
+	return nil
+}
+
+// migrationSetup is the new circuit version's proving and verifying side.
+type migrationSetup struct {
+	ccs         cs_bn254.R1CS
+	pk          groth16_bn254.ProvingKey
+	vk          groth16_bn254.VerifyingKey
+	circuitHash [32]byte
+	tracker     prover.Tracker
+}
+
+// loadMigrationSetup reads the ccs, pk and vk m describes from dir and checks
+// the ccs is the circuit m names.
+func loadMigrationSetup(dir string, m *artifacts.Manifest) (*migrationSetup, error) {
+	if err := circuit.CheckHintSet(m.Hints); err != nil {
+		return nil, err
+	}
+	s := new(migrationSetup)
+	r := artifacts.Resolver{Dir: dir}
+	for _, a := range []struct {
+		kind artifacts.Kind
+		dst  io.ReaderFrom
+	}{
+		{artifacts.KindCCS, &s.ccs},
+		{artifacts.KindPK, &s.pk},
+		{artifacts.KindVK, &s.vk},
+	} {
+		name, err := r.ForManifest(a.kind, m)
+		if err != nil {
+			return nil, err
+		}
+		if err := readFile(name, a.dst); err != nil {
+			return nil, err
+		}
+	}
+	if err := circuit.CheckHints(&s.ccs); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.circuitHash, err = artifacts.CircuitHash(&s.ccs); err != nil {
+		return nil, err
+	}
+	if got := hex.EncodeToString(s.circuitHash[:]); got != m.CircuitHash {
+		return nil, fmt.Errorf("%w: ccs hashes to %s, manifest says %s", errs.ErrArtifactMismatch, got, m.CircuitHash)
+	}
+	return s, nil
+}
+
+// migrateBatch derives name's public inputs under oldP and newP and, unless
+// s is nil (dry run), proves it under s and writes the proof and public
+// inputs to out. Failures are reported in the entry, not returned: one bad
+// batch does not stop the others.
+func migrateBatch(ctx context.Context, name string, oldP, newP circuit.Profile, s *migrationSetup, out string) report.MigratedBatch {
+	mb := report.MigratedBatch{Batch: name}
+	fail := func(err error) report.MigratedBatch {
+		mb.Error = err.Error()
+		return mb
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fail(err)
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fail(fmt.Errorf("%w: %w", errs.ErrInvalidInput, err))
+	}
+	if req.Profile != "" && req.Profile != newP.Name {
+		return fail(fmt.Errorf("%w: batch of profile %s, migrating %s", errs.ErrInvalidBatch, req.Profile, newP.Name))
+	}
+
+	oldPub, err := server.BatchPublic(oldP, &req)
+	if err != nil {
+		return fail(fmt.Errorf("old version: %w", err))
+	}
+	c, err := server.BatchAssignment(newP, &req)
+	if err != nil {
+		return fail(fmt.Errorf("new version: %w", err))
+	}
+	newPub, err := server.BatchPublic(newP, &req)
+	if err != nil {
+		return fail(fmt.Errorf("new version: %w", err))
+	}
+	oldID, err := circuit.BatchID(oldPub)
+	if err != nil {
+		return fail(err)
+	}
+	newID, err := circuit.BatchID(newPub)
+	if err != nil {
+		return fail(err)
+	}
+	mb.OldBatchID, mb.NewBatchID = hex.EncodeToString(oldID[:]), hex.EncodeToString(newID[:])
+	if mb.Changed, err = circuit.DiffPublic(oldPub, newPub); err != nil {
+		return fail(err)
+	}
+	if s == nil {
+		return mb
+	}
+
+	full, err := newP.Assign(c, req.Variant)
+	if err != nil {
+		return fail(err)
+	}
+	wit, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
+	if err != nil {
+		return fail(err)
+	}
+	// a batch whose signatures are over the old message format fails here
+	proof, err := s.tracker.Prove(ctx, &s.ccs, &s.pk, wit, 0, func(prover.Progress) {})
+	if err != nil {
+		return fail(fmt.Errorf("prove: %w", err))
+	}
+	if err := verifier.VerifyContext(ctx, &s.vk, proof, newPub); err != nil {
+		return fail(err)
+	}
+	hdr := artifacts.ProofHeader{
+		Version:     artifacts.ProofHeaderVersion,
+		Curve:       ecc.BN254,
+		Backend:     backend.GROTH16,
+		CircuitHash: s.circuitHash,
+		BatchID:     newID,
+		Timestamp:   time.Now(),
+		Features:    uint32(newP.Features()),
+	}
+	base := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "batch_"), ".json")
+	proofName := filepath.Join(out, "proof_"+base+".groth16")
+	publicName := filepath.Join(out, "public_"+base+".json")
+	if err := writeFile(proofName, &artifacts.Proof{Header: &hdr, Proof: proof}); err != nil {
+		return fail(err)
+	}
+	if err := writeFile(publicName, &newPub); err != nil {
+		return fail(err)
+	}
+	mb.Proof, mb.Public = proofName, publicName
+	return mb
+}
+
+func circuitVersion(m *artifacts.Manifest) report.CircuitVersion {
+	return report.CircuitVersion{CircuitHash: m.CircuitHash, DataHash: m.DataHash, Ordering: m.Ordering, Msg: m.Msg}
+}
+
+func sameDir(a, b string) (bool, error) {
+	a, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	b, err = filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return a == b, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"gnarking/circuit"
+	"gnarking/mmr"
+)
+
+const mmrUsage = "usage: ddm mmr root [-dir -leaves] | ddm mmr append [-dir -profile -public] | ddm mmr prove [-dir -leaves -out] <batch> | ddm mmr verify [-root] <proof.json> | ddm mmr check [-dir]"
+
+// runMMR maintains the Merkle mountain range of every proven batch's
+// BatchDataRoot (ddm serve -mmr appends to it), prints the root committing
+// to the settlement history, and writes and checks a batch's inclusion
+// proof.
+func runMMR(args []string) error {
+	if len(args) < 1 {
+		return errors.New(mmrUsage)
+	}
+	fs := flag.NewFlagSet("mmr "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", "./artifact/mmr", "the range's directory, as ddm serve -mmr")
+	leaves := fs.Uint64("leaves", 0, "root, prove: the range of its first N leaves, a root pinned earlier (0 for all of them)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "append: circuit profile of the batch")
+	publicFile := fs.String("public", "", "append: the batch's public inputs (default ./artifact/public_<profile>.json)")
+	out := fs.String("out", "", "prove: file to write the proof to (default stdout)")
+	root := fs.String("root", "", "verify: the root the proof must be against, decimal or 0x hex (default the proof's own)")
+	fs.Parse(args[1:])
+
+	if args[0] == "verify" {
+		if fs.NArg() != 1 {
+			return errors.New(mmrUsage)
+		}
+		b, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		var p mmr.Proof
+		if err := json.Unmarshal(b, &p); err != nil {
+			return fmt.Errorf("%s: %w", fs.Arg(0), err)
+		}
+		var want *big.Int
+		if *root != "" {
+			var f circuit.FieldJSON
+			if err := f.UnmarshalJSON([]byte(*root)); err != nil {
+				return err
+			}
+			want = (*big.Int)(&f)
+		}
+		if err := p.Verify(want); err != nil {
+			return err
+		}
+		fmt.Printf("batch %s is leaf %d of %d under root %s\n", p.Leaf.BatchID, p.Leaf.Index, p.Leaves, (*big.Int)(&p.Root))
+		return nil
+	}
+
+	m, err := mmr.Open(*dir)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	switch args[0] {
+	case "root":
+		st, err := m.State(*leaves)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (0x%x), %d batches, %d peaks\n", (*big.Int)(&st.Root), (*big.Int)(&st.Root), st.Leaves, len(st.Peaks))
+	case "append":
+		profile, err := circuit.LookupProfile(*profileName)
+		if err != nil {
+			return err
+		}
+		if *publicFile == "" {
+			*publicFile = fmt.Sprintf("./artifact/public_%s.json", profile.Name)
+		}
+		var pub circuit.SettlementCircuitPublic
+		if err := readFile(*publicFile, &pub); err != nil {
+			return err
+		}
+		l, err := m.AppendPublic(pub, profile.Name)
+		if err != nil {
+			return err
+		}
+		st, err := m.State(0)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("batch %s is leaf %d, root %s\n", l.BatchID, l.Index, (*big.Int)(&st.Root))
+	case "prove":
+		if fs.NArg() != 1 {
+			return errors.New(mmrUsage)
+		}
+		p, err := m.Prove(fs.Arg(0), *leaves)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(p, "", "\t")
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			fmt.Println(string(b))
+			return nil
+		}
+		return os.WriteFile(*out, append(b, '\n'), 0o644)
+	case "check":
+		if err := m.Check(); err != nil {
+			return err
+		}
+		fmt.Printf("%d batches, every node matches its leaves\n", m.Len())
+	default:
+		return errors.New(mmrUsage)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/escrow"
+	"gnarking/ioutilx"
+	"gnarking/keys"
+	"gnarking/publish"
+	"gnarking/retry"
+	"gnarking/server"
+	"gnarking/timestamp"
+)
+
+const publishUsage = "usage: ddm publish (-ipfs URL | -cas DIR) [-profile -dir -data -escrow -out -tsa URL -tsa-roots PEM] | ddm publish -audit receipt.json (-ipfs URL | -cas DIR) [-tsa-roots PEM] | ddm publish -stamp receipt.json -tsa URL [-tsa-roots PEM]"
+
+// runPublish pins a batch's proof_*.json, public_sol_*.json and row data to
+// content-addressed storage and writes the CIDs to receipt_<profile>.json,
+// or with -audit fetches everything a receipt lists and checks it. With
+// -tsa the receipt is timestamped by an RFC 3161 authority; -stamp does so
+// for a receipt written before.
+func runPublish(args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the artifacts")
+	data := fs.String("data", "", "batch row data to publish (default <dir>/batch_<profile>.json, skipped when missing)")
+	escrowFile := fs.String("escrow", "", "witness sealed to an arbiter (ddm escrow seal), hashed into the receipt but not published (default <dir>/escrow_<profile>.bin, skipped when missing)")
+	out := fs.String("out", "", "receipt to write (default <dir>/receipt_<profile>.json)")
+	ipfsAPI := fs.String("ipfs", "", "Kubo RPC API to add and pin to, e.g. http://127.0.0.1:5001")
+	casDir := fs.String("cas", "", "content-addressed directory to store <cid> files in instead")
+	auditFile := fs.String("audit", "", "receipt to audit: fetch every CID it lists and check the content")
+	keyPath := fs.String("key-path", "", "derivation path of the key that signed the batch, recorded in the receipt (default: the batch file's key_path)")
+	tsaURL := fs.String("tsa", "", "RFC 3161 time-stamp authority to timestamp the receipt with, e.g. http://timestamp.digicert.com")
+	tsaRoots := fs.String("tsa-roots", "", "PEM file of the roots a timestamp's signer must chain to (default: only the token's signature is checked)")
+	stampFile := fs.String("stamp", "", "receipt to timestamp (with -tsa) and rewrite, instead of publishing")
+	timeout := fs.Duration("timeout", time.Minute, "overall deadline")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of -ipfs calls: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+
+	var roots *x509.CertPool
+	if *tsaRoots != "" {
+		pem, err := os.ReadFile(*tsaRoots)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w: no certificates in %s", errs.ErrInvalidInput, *tsaRoots)
+		}
+	}
+	if *stampFile != "" {
+		if *tsaURL == "" {
+			return errors.New(publishUsage)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		var r publish.Receipt
+		if err := readFile(*stampFile, &r); err != nil {
+			return err
+		}
+		if err := stampReceipt(ctx, &r, *tsaURL, roots); err != nil {
+			return err
+		}
+		return writeFile(*stampFile, &r)
+	}
+
+	var store interface {
+		publish.Store
+		publish.Getter
+	}
+	switch {
+	case *ipfsAPI != "" && *casDir == "":
+		policy, err := retry.Parse(*retrySpec)
+		if err != nil {
+			return err
+		}
+		store = &publish.IPFS{API: *ipfsAPI, Retry: policy}
+	case *casDir != "" && *ipfsAPI == "":
+		store = publish.Dir(*casDir)
+	default:
+		return errors.New(publishUsage)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *auditFile != "" {
+		var r publish.Receipt
+		if err := readFile(*auditFile, &r); err != nil {
+			return err
+		}
+		if r.Timestamp != nil || roots != nil {
+			tok, err := r.CheckTimestamp(roots)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: timestamped %s by %q (%s)%s\n", *auditFile, tok.Time.UTC().Format(time.RFC3339), tok.Signer.Subject, r.Timestamp.TSA, trustNote(roots))
+		}
+		if err := publish.Audit(ctx, store, &r); err != nil {
+			return err
+		}
+		fmt.Printf("%s: all %d files available and intact\n", *auditFile, len(r.Files))
+		return nil
+	}
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	var pub circuit.SettlementCircuitPublic
+	if err := readFile(name("public_%s.json"), &pub); err != nil {
+		return err
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{name("proof_%s.json"), name("public_sol_%s.json")}
+	batchFile := *data
+	if batchFile == "" {
+		if _, err := os.Stat(name("batch_%s.json")); err == nil {
+			batchFile = name("batch_%s.json")
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if batchFile != "" {
+		paths = append(paths, batchFile)
+	}
+	// spot-audit commitments are pinned and timestamped with the proof
+	if _, err := os.Stat(name("commitments_%s.json")); err == nil {
+		paths = append(paths, name("commitments_%s.json"))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var files []publish.File
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, publish.File{Name: filepath.Base(p), Data: b})
+		// batches signed with a derived key say which one
+		if p == batchFile && *keyPath == "" {
+			var req server.ProveRequest
+			if json.Unmarshal(b, &req) == nil {
+				*keyPath = req.KeyPath
+			}
+		}
+	}
+	if *keyPath != "" {
+		if _, err := keys.ParsePath(*keyPath); err != nil {
+			return err
+		}
+	}
+
+	var sealed *publish.Escrow
+	if *escrowFile == "" {
+		if _, err := os.Stat(name("escrow_%s.bin")); err == nil {
+			*escrowFile = name("escrow_%s.bin")
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if *escrowFile != "" {
+		if sealed, err = escrowEntry(*escrowFile, id); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	entries, err := publish.Publish(ctx, store, files)
+	if err != nil {
+		return err
+	}
+	took := time.Since(start)
+	r := publish.Receipt{
+		Version:     publish.ReceiptVersion,
+		Profile:     profile.Name,
+		BatchID:     hex.EncodeToString(id[:]),
+		KeyPath:     *keyPath,
+		PublishedAt: time.Now().UTC(),
+		Files:       entries,
+		Escrow:      sealed,
+	}
+	if *tsaURL != "" {
+		if err := stampReceipt(ctx, &r, *tsaURL, roots); err != nil {
+			return err
+		}
+	}
+	if *out == "" {
+		*out = name("receipt_%s.json")
+	}
+	if err := writeFile(*out, &r); err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		fmt.Printf("%-24s %10s  %s\n", e.Name, ioutilx.Size(int64(e.Size)), e.CID)
+		total += int64(e.Size)
+	}
+	if sealed != nil {
+		fmt.Printf("%-24s %10s  sha256 %s (escrowed, not published)\n", filepath.Base(*escrowFile), ioutilx.Size(int64(sealed.Size)), sealed.SHA256)
+	}
+	fmt.Printf("published %s in %s (%s), wrote %s\n", ioutilx.Size(total), took.Round(time.Millisecond), ioutilx.Rate(total, took), *out)
+	return nil
+}
+
+// escrowEntry is the receipt entry of the sealed witness in fName, which
+// must hold the batch id.
+func escrowEntry(fName string, id [32]byte) (*publish.Escrow, error) {
+	b, err := os.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	h, err := escrow.ReadHeader(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fName, err)
+	}
+	if h.BatchID != id {
+		return nil, fmt.Errorf("%w: %s holds batch %x, not %x", errs.ErrArtifactMismatch, fName, h.BatchID[:8], id[:8])
+	}
+	return &publish.Escrow{Arbiter: hex.EncodeToString(h.Arbiter[:]), SHA256: escrow.Hash(b), Size: len(b)}, nil
+}
+
+// stampReceipt timestamps r at the TSA at url and checks the token, against
+// roots when given.
+func stampReceipt(ctx context.Context, r *publish.Receipt, url string, roots *x509.CertPool) error {
+	if err := r.Stamp(ctx, &timestamp.Client{URL: url}); err != nil {
+		return err
+	}
+	tok, err := r.CheckTimestamp(roots)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("timestamped %s by %q, serial %s%s\n", tok.Time.UTC().Format(time.RFC3339), tok.Signer.Subject, tok.Serial, trustNote(roots))
+	return nil
+}
+
+func trustNote(roots *x509.CertPool) string {
+	if roots == nil {
+		return " (signer not checked against -tsa-roots)"
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/redact"
+	"gnarking/server"
+)
+
+const redactUsage = "usage: ddm redact -rows 0,3 [-profile -dir -batch -out] | ddm redact -check FILE [-profile -dir -public]"
+
+// runRedact writes the batch data of a proven batch with rows withheld, or
+// checks such a file against the proven root.
+func runRedact(args []string) error {
+	fs := flag.NewFlagSet("redact", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default files")
+	dir := fs.String("dir", "./artifact", "directory of the default files and the setup manifest (its data hash must be mimc-tree)")
+	batchFile := fs.String("batch", "", "the proven batch (default <dir>/batch_<profile>.json)")
+	publicFile := fs.String("public", "", "public inputs of the proven batch (default <dir>/public_<profile>.json)")
+	rows := fs.String("rows", "", "comma-separated indices of the rows to withhold, in batch file order")
+	out := fs.String("out", "", "redacted batch to write (default <dir>/batch_redacted_<profile>.json)")
+	checkFile := fs.String("check", "", "redacted batch to check against the proven root, instead of writing one")
+	fs.Parse(args)
+	if (*rows == "") == (*checkFile == "") || fs.NArg() != 0 {
+		return errors.New(redactUsage)
+	}
+	profile, err := spotcheckProfile(*profileName, *dir)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	if *publicFile == "" {
+		*publicFile = name("public_%s.json")
+	}
+	var pub circuit.SettlementCircuitPublic
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+
+	if *checkFile != "" {
+		var b redact.Batch
+		if err := readFile(*checkFile, &b); err != nil {
+			return err
+		}
+		if err := redact.Check(profile, pub, &b); err != nil {
+			return err
+		}
+		fmt.Printf("%s: consistent with batch %s, %d of %d rows redacted\n", *checkFile, b.BatchID, len(b.Redacted()), len(b.Rows))
+		return nil
+	}
+
+	var withheld []int
+	for _, s := range strings.Split(*rows, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%w: -rows: %q is not a row index", errs.ErrInvalidInput, s)
+		}
+		withheld = append(withheld, i)
+	}
+	if *batchFile == "" {
+		*batchFile = name("batch_%s.json")
+	}
+	if *out == "" {
+		*out = name("batch_redacted_%s.json")
+	}
+	data, err := os.ReadFile(*batchFile)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, *batchFile, err)
+	}
+	b, err := redact.Redact(profile, pub, &req, withheld)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*out, b); err != nil {
+		return err
+	}
+	fmt.Printf("%s: batch %s, rows at %v (root order) withheld as leaves, root %s\n", *out, b.BatchID, b.Redacted(), b.BatchDataRoot)
+	return nil
+}
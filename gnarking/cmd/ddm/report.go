@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/events"
+	"gnarking/events/eventspb"
+	"gnarking/publish"
+	"gnarking/report"
+	"gnarking/stats"
+	"gnarking/submitter"
+)
+
+// runReport consolidates a window of operations into one report: batches
+// proven and their cost, from the statistics store; batches published,
+// from their receipts; value settled, gas and fees, from the submitter
+// state; and every failure with its reason, from the state and the event
+// log.
+func runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	since := flags.Duration("since", 24*time.Hour, "window ending now, unless -from is set")
+	from := flags.String("from", "", "window start, RFC 3339 (overrides -since)")
+	to := flags.String("to", "", "window end, RFC 3339 (default now)")
+	statsDir := flags.String("stats-dir", "./artifact/stats", "statistics store, the -stats-dir of ddm serve (skipped when missing)")
+	receipts := flags.String("receipts", "./artifact,./archive", "comma-separated directories searched for receipt_*.json, recursively (missing ones skipped)")
+	stateFile := flags.String("state", "", "submitter state file, the -state of ddm submit (empty: nothing settled is reported)")
+	eventsLog := flags.String("events", "", "event log of ddm serve -events, for proving failures")
+	ethUSD := flags.Float64("eth-usd", 0, "ETH price to convert fees to USD with (0: fees in wei only)")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	out := flags.String("out", "", "also write the JSON report to this file")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return errors.New("usage: ddm report [-since 24h | -from T -to T] [-stats-dir -receipts -state -events -eth-usd -json -out]")
+	}
+
+	d := report.Daily{From: time.Now().Add(-*since), To: time.Now()}
+	var err error
+	if *from != "" {
+		if d.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("%w: -from: %w", errs.ErrInvalidInput, err)
+		}
+	}
+	if *to != "" {
+		if d.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("%w: -to: %w", errs.ErrInvalidInput, err)
+		}
+	}
+	in := func(t time.Time) bool { return !t.Before(d.From) && t.Before(d.To) }
+
+	if _, err := os.Stat(*statsDir); err == nil {
+		st, err := stats.Open(*statsDir, stats.Retention{})
+		if err != nil {
+			return err
+		}
+		samples, err := st.Query(stats.Query{From: d.From, To: d.To})
+		st.Close()
+		if err != nil {
+			return err
+		}
+		for _, x := range samples {
+			d.AddProof(x.N, x.CostUSD)
+		}
+	}
+
+	// a batch published twice, or archived with its receipt, counts once
+	published := map[string]bool{}
+	for _, dir := range strings.Split(*receipts, ",") {
+		dir = strings.TrimSpace(dir)
+		if _, err := os.Stat(dir); dir == "" || err != nil {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			if ok, _ := filepath.Match("receipt_*.json", e.Name()); !ok {
+				return nil
+			}
+			var r publish.Receipt
+			if err := readFile(path, &r); err != nil {
+				return err
+			}
+			id := strings.ToLower(strings.TrimPrefix(r.BatchID, "0x"))
+			if in(r.PublishedAt) && !published[id] {
+				published[id] = true
+				d.AddPublished()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// a failed submission is in the state and, through the dashboard, in
+	// the event log: keep one
+	failed := map[string]bool{}
+	if *stateFile != "" {
+		st, err := submitter.FileStore(*stateFile).Load()
+		if err != nil {
+			return err
+		}
+		d.Pending = len(st.Pending)
+		for _, done := range st.Done {
+			if !in(done.Time) {
+				continue
+			}
+			if done.Error != "" {
+				d.AddSettled(nil, done.GasUsed, done.Fee)
+				d.AddFailure(report.Failure{Time: done.Time, BatchID: done.BatchID, Stage: "submit", Code: string(done.Code), Error: done.Error})
+				failed["submit/"+done.BatchID] = true
+				continue
+			}
+			total, ok := new(big.Int).SetString(done.Total, 10)
+			if !ok {
+				return fmt.Errorf("%w: %s: batch %s settled %q", errs.ErrInvalidInput, *stateFile, done.BatchID, done.Total)
+			}
+			d.AddSettled(total, done.GasUsed, done.Fee)
+		}
+	}
+	if *eventsLog != "" {
+		err := events.Scan(*eventsLog, func(e *eventspb.Event) error {
+			f := e.GetFailed()
+			if f == nil || !in(e.Time.AsTime()) {
+				return nil
+			}
+			stage := "prove"
+			if f.Stage == eventspb.Stage_STAGE_SUBMIT {
+				stage = "submit"
+			}
+			id := hex.EncodeToString(e.BatchId)
+			if failed[stage+"/"+id] {
+				return nil
+			}
+			failed[stage+"/"+id] = true
+			d.AddFailure(report.Failure{Time: e.Time.AsTime(), BatchID: id, Stage: stage, Code: f.Code, Error: f.Error})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	d.Finish(*ethUSD)
+
+	if *out != "" {
+		data, err := json.MarshalIndent(d, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(d)
+	}
+	fmt.Print(d)
+	return nil
+}
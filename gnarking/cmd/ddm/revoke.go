@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"gnarking/revocation"
+)
+
+const revokeUsage = "usage: ddm revoke (add | remove) [-list revoked.json] <pk>... | ddm revoke root [-list] | ddm revoke witness [-list -out] <pk>"
+
+// runRevoke maintains the revocation list whose tree root a deployment pins
+// (circuit.RevocationCircuit), and writes the non-membership witness a
+// prover needs for a key still in good standing.
+func runRevoke(args []string) error {
+	if len(args) < 1 {
+		return errors.New(revokeUsage)
+	}
+	fs := flag.NewFlagSet("revoke "+args[0], flag.ExitOnError)
+	listFile := fs.String("list", "./artifact/revoked.json", "revocation list, created on the first add")
+	out := fs.String("out", "", "witness: file to write the non-membership witness to (default stdout)")
+	fs.Parse(args[1:])
+
+	tree := revocation.New()
+	if err := readFile(*listFile, tree); err != nil && !(errors.Is(err, os.ErrNotExist) && args[0] == "add") {
+		return err
+	}
+	switch args[0] {
+	case "add", "remove":
+		if fs.NArg() == 0 {
+			return errors.New(revokeUsage)
+		}
+		for _, pk := range fs.Args() {
+			var err error
+			if args[0] == "add" {
+				err = tree.Revoke(pk)
+			} else {
+				err = tree.Reinstate(pk)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeFile(*listFile, tree); err != nil {
+			return err
+		}
+		fmt.Printf("%d keys revoked, root %s (0x%x); pin the new root on-chain\n", tree.Len(), tree.Root(), tree.Root())
+	case "root":
+		fmt.Printf("%s (0x%x), %d keys revoked\n", tree.Root(), tree.Root(), tree.Len())
+	case "witness":
+		if fs.NArg() != 1 {
+			return errors.New(revokeUsage)
+		}
+		nm, err := tree.NonMembership(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(nm, "", "\t")
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			fmt.Println(string(b))
+			return nil
+		}
+		return os.WriteFile(*out, append(b, '\n'), 0o644)
+	default:
+		return errors.New(revokeUsage)
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/audit"
+	"gnarking/circuit"
+	"gnarking/crash"
+	"gnarking/errs"
+	"gnarking/events"
+	"gnarking/fetch"
+	"gnarking/intake"
+	"gnarking/lint"
+	"gnarking/memwatch"
+	"gnarking/mmr"
+	"gnarking/prover"
+	"gnarking/server"
+	"gnarking/spotcheck"
+	"gnarking/stats"
+	"gnarking/verifier"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	profileNames := fs.String("profiles", circuit.DefaultProfile, "comma-separated circuit profiles to serve")
+	vkDir := fs.String("vk-dir", "./artifact", "directory holding vk_<profile>.groth16, or settlement_<profile>.ddmbundle which is read instead when present")
+	auditName := fs.String("audit", "", "append-only audit log (hash-chained JSONL), empty disables")
+	prove := fs.Bool("prove", false, "also serve POST /prove, loading ccs_<profile>.groth16 and pk_<profile>.groth16 (or the bundle's) from -vk-dir")
+	intakeName := fs.String("intake", "", "journal of intents taken on POST /intents (JSONL), deduplicated by (pk, nonce); empty disables")
+	lintName := fs.String("lint", "", "lint rules (JSON, see ddm lint) every batch to prove must pass, by profile and by the tenant of the "+lint.TenantHeader+" header; empty disables")
+	policyName := fs.String("policy", "", "JSON policy (max_total, max_row_size, recipients, chain_ids, see prover.Rules) every batch to prove must pass before its witness is built; refuses POST /prove/witness; empty disables")
+	eventsName := fs.String("events", "", "log of job lifecycle events (length-delimited protobuf, events/events.proto), streamed on GET /events; empty disables")
+	mmrDir := fs.String("mmr", "", "directory of the Merkle mountain range every proven batch root is appended to (see ddm mmr), served on GET /mmr; empty disables")
+	statsDir := fs.String("stats-dir", "", "time-series store of per-proof statistics (ddm stats queries it); empty disables")
+	statsAge := fs.Duration("stats-retention", 30*24*time.Hour, "with -stats-dir, delete statistics older than this (0 keeps them)")
+	statsMB := fs.Int64("stats-max-mb", 0, "with -stats-dir, delete the oldest statistics while the store is larger (0: no limit)")
+	cores := fs.Int("cores", 0, "cores each prove may use, 0 for all; requests may ask for fewer with ?cores=N")
+	pipelineDepth := fs.Int("pipeline-depth", prover.DefaultDepth, "with -prove, batches proven at once, so the next one's witness solving overlaps the MSMs of the one before (1: one at a time)")
+	pipelineMemMB := fs.Uint64("pipeline-mem-mb", 0, "with -prove, hold back the next batch while in-use memory is above this many MiB and another is proving (default 90% of the cgroup limit, none without one)")
+	cacheSize := fs.Int("verify-cache", verifier.DefaultCacheMax, "verification results to remember, keyed by proof, public inputs and vk (0 disables)")
+	cacheTTL := fs.Duration("verify-cache-ttl", verifier.DefaultCacheTTL, "how long a cached verification result is served")
+	preloadNames := fs.String("preload", "", "comma-separated profiles to load in the background after listening, served once loaded")
+	requireWarm := fs.Bool("require-warm", false, "GET /ready answers 503 until every -preload profile is loaded")
+	scaleAt := fs.Duration("autoscale-threshold", 0, "estimated prove backlog (GET /metrics) at which the autoscale hooks are called, on crossing it either way; 0 disables")
+	scaleWebhook := fs.String("autoscale-webhook", "", "URL the backlog event is POSTed to as JSON on each crossing")
+	scaleExec := fs.String("autoscale-exec", "", "command run with sh -c on each crossing, the backlog event JSON on stdin and DDM_EVENT, DDM_BACKLOG_SECONDS, DDM_QUEUE set")
+	scaleInterval := fs.Duration("autoscale-interval", 5*time.Second, "how often the backlog is checked against -autoscale-threshold")
+	slaSpec := fs.String("sla", "", "deadline of prove jobs from their request, for every profile and/or by profile, e.g. 5m,64=15m (requests may set their own with ?deadline=); empty disables")
+	slaWebhook := fs.String("sla-webhook", "", "URL an SLA breach event is POSTed to as JSON, when a job's deadline passes unproven")
+	slaExec := fs.String("sla-exec", "", "command run with sh -c on each SLA breach, the event JSON on stdin and DDM_EVENT, DDM_BATCH_ID, DDM_PROFILE, DDM_STATUS set")
+	spotDir := fs.String("spotcheck-dir", "", "archive of proven batches (ddm spotcheck commit -archive) to serve GET /spotcheck/{batch}?rows= openings from, auditors only; empty disables")
+	spotKey := fs.String("spotcheck-key", "", "with -spotcheck-dir, the audit key the batches were committed with")
+	crashDir := fs.String("crash-dir", cmp.Or(crash.Dir(), "./artifact/crash"), "where a prove or verify that panics leaves its diagnostics bundle (default $DDM_CRASH_DIR), empty disables")
+	fs.Parse(args)
+	crash.SetDir(*crashDir)
+
+	profiles, err := parseProfiles(*profileNames)
+	if err != nil {
+		return err
+	}
+	var preload []circuit.Profile
+	if *preloadNames != "" {
+		if preload, err = parseProfiles(*preloadNames); err != nil {
+			return err
+		}
+	}
+	for _, p := range preload {
+		if slices.ContainsFunc(profiles, func(q circuit.Profile) bool { return q.Name == p.Name }) {
+			return fmt.Errorf("profile %s is in both -profiles and -preload", p.Name)
+		}
+	}
+	// the served profiles load before listening, every file in parallel
+	loaded, err := loadProfiles(*vkDir, profiles, *prove)
+	if err != nil {
+		return err
+	}
+	vks := make(map[string]server.VK)
+	for _, l := range loaded {
+		vks[l.profile.Name] = l.served()
+		log.Printf("serving profile %s", l.profile)
+	}
+
+	var auditLog *audit.Log
+	if *auditName != "" {
+		var err error
+		if auditLog, err = audit.Open(*auditName); err != nil {
+			return err
+		}
+		defer auditLog.Close()
+	}
+
+	srv, err := server.New(vks, auditLog)
+	if err != nil {
+		return err
+	}
+	srv.LimitCores(*cores)
+	budget := *pipelineMemMB << 20
+	if budget == 0 {
+		budget = memwatch.DefaultLimit()
+	}
+	srv.EnablePipeline(prover.Pipeline{Depth: *pipelineDepth, MemBudget: budget})
+	if *intakeName != "" {
+		in, err := intake.Open(*intakeName)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		srv.EnableIntake(in)
+	}
+	if *eventsName != "" {
+		l, err := events.Open(*eventsName)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		srv.EnableEvents(l)
+	}
+	if *statsDir != "" {
+		st, err := stats.Open(*statsDir, stats.Retention{MaxAge: *statsAge, MaxBytes: *statsMB << 20})
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		if err := srv.EnableStats(st); err != nil {
+			return err
+		}
+	}
+	if *mmrDir != "" {
+		m, err := mmr.Open(*mmrDir)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		srv.EnableMMR(m)
+	}
+	if *lintName != "" {
+		l, err := lint.Load(*lintName)
+		if err != nil {
+			return err
+		}
+		srv.EnableLint(l)
+	}
+	if *policyName != "" {
+		pol, err := prover.LoadRules(*policyName)
+		if err != nil {
+			return err
+		}
+		srv.EnablePolicy(pol)
+	}
+	if *cacheSize > 0 {
+		srv.EnableCache(&verifier.Cache{TTL: *cacheTTL, Max: *cacheSize})
+	}
+	// SIGHUP swaps in the vks and manifests on disk, e.g. after a re-setup,
+	// without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			for _, p := range slices.Concat(profiles, preload) {
+				l, err := loadProfile(*vkDir, p, false)
+				if err == nil {
+					err = srv.SetVK(p.Name, l.served())
+				}
+				if err != nil {
+					log.Printf("reload vk of profile %s: %v (still serving the old one)", p.Name, err)
+					continue
+				}
+				log.Printf("reloaded vk of profile %s", p.Name)
+			}
+		}
+	}()
+	for _, l := range loaded {
+		if l.ccs == nil {
+			continue
+		}
+		if err := srv.EnableProving(l.profile, l.ccs, l.pk); err != nil {
+			return err
+		}
+		log.Printf("proving profile %s", l.profile)
+	}
+	// -preload profiles load while serving, each enabled once complete
+	for _, p := range preload {
+		if *requireWarm {
+			srv.Warming(p.Name)
+		}
+		go func() {
+			err := preloadProfile(srv, *vkDir, p, *prove)
+			if err != nil {
+				log.Printf("preload profile %s: %v", p.Name, err)
+			}
+			srv.Warmed(p.Name, err)
+		}()
+	}
+	if *slaSpec != "" {
+		sla, err := server.ParseSLA(*slaSpec)
+		if err != nil {
+			return err
+		}
+		sla.Webhook, sla.Exec = *slaWebhook, *slaExec
+		srv.EnableSLA(sla)
+	} else if *slaWebhook != "" || *slaExec != "" {
+		return fmt.Errorf("-sla-webhook and -sla-exec need -sla")
+	}
+	if *scaleAt > 0 {
+		if *scaleWebhook == "" && *scaleExec == "" {
+			return fmt.Errorf("-autoscale-threshold needs -autoscale-webhook or -autoscale-exec")
+		}
+		go srv.WatchBacklog(context.Background(), server.Autoscale{Threshold: *scaleAt, Interval: *scaleInterval, Webhook: *scaleWebhook, Exec: *scaleExec})
+	}
+
+	handler := srv.Handler()
+	if *spotDir != "" {
+		if *spotKey == "" {
+			return fmt.Errorf("-spotcheck-dir needs -spotcheck-key")
+		}
+		key, err := readAuditKey(*spotKey)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.Handle("GET /spotcheck/", spotcheck.Archive{Dir: *spotDir, Key: key}.Handler())
+		handler = mux
+		log.Printf("serving spot-audit openings from %s", *spotDir)
+	}
+
+	log.Printf("verifier listening on %s", *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+func parseProfiles(names string) ([]circuit.Profile, error) {
+	var profiles []circuit.Profile
+	for _, name := range strings.Split(names, ",") {
+		p, err := circuit.LookupProfile(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// loadedProfile is a profile's artifacts, ccs and pk only when proving.
+type loadedProfile struct {
+	profile  circuit.Profile // with the manifest's settings
+	manifest bool            // whether there was one
+	vk       *groth16_bn254.VerifyingKey
+	ccs      *cs_bn254.R1CS
+	pk       *groth16_bn254.ProvingKey
+}
+
+// served is what the server verifies l's proofs under: its vk and, when its
+// manifest was found, its features.
+func (l loadedProfile) served() server.VK {
+	return server.VK{VK: l.vk, Features: l.profile.Features(), HasFeatures: l.manifest}
+}
+
+// profileFile is <kind>_<profile>.groth16.
+type profileFile struct {
+	kind string
+	r    io.ReaderFrom
+}
+
+// loadProfiles loads profiles from dir in parallel, see loadProfile.
+func loadProfiles(dir string, profiles []circuit.Profile, prove bool) ([]loadedProfile, error) {
+	loaded := make([]loadedProfile, len(profiles))
+	errList := make([]error, len(profiles))
+	var wg sync.WaitGroup
+	for i, p := range profiles {
+		wg.Go(func() { loaded[i], errList[i] = loadProfile(dir, p, prove) })
+	}
+	wg.Wait()
+	return loaded, errors.Join(errList...)
+}
+
+// loadProfile reads p's vk from dir and, when proving, its ccs and pk, the
+// three files in parallel, logging each as it completes. The setup
+// manifest, when present, overrides the profile's data hash, message
+// version and ordering: setup may have compiled with non-default ones, and
+// proofs are verified against its features.
+// A settlement_<profile>.ddmbundle in dir is read instead, see
+// loadBundle.
+func loadProfile(dir string, p circuit.Profile, prove bool) (loadedProfile, error) {
+	if bundle, ok := bundleOf(dir, p); ok {
+		return loadBundle(bundle, p, prove)
+	}
+
+	start := time.Now()
+	l := loadedProfile{profile: p, vk: new(groth16_bn254.VerifyingKey)}
+	files := []profileFile{{"vk", l.vk}}
+	var m artifacts.Manifest
+	err := readFile(filepath.Join(dir, fmt.Sprintf("manifest_%s.json", p.Name)), &m)
+	switch {
+	case err == nil:
+		if err := useManifest(&l, &m, prove); err != nil {
+			return l, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return l, err
+	}
+	if prove {
+		l.ccs, l.pk = new(cs_bn254.R1CS), new(groth16_bn254.ProvingKey)
+		files = append(files, profileFile{"ccs", l.ccs}, profileFile{"pk", l.pk})
+	}
+
+	log.Printf("loading profile %s: %d files", p.Name, len(files))
+	errList := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Go(func() {
+			fName := filepath.Join(dir, fmt.Sprintf("%s_%s.groth16", f.kind, p.Name))
+			t := time.Now()
+			if errList[i] = readFile(fName, f.r); errList[i] == nil {
+				log.Printf("loaded %s in %s", fName, time.Since(t).Round(time.Millisecond))
+			}
+		})
+	}
+	wg.Wait()
+	if err := errors.Join(errList...); err != nil {
+		return l, err
+	}
+	log.Printf("profile %s loaded in %s", p.Name, time.Since(start).Round(time.Millisecond))
+	return l, nil
+}
+
+// loadBundle reads p's vk and, when proving, its ccs and pk from a setup
+// bundle, each checked against the hash its manifest records as it is
+// decoded (artifacts.ReadBundle). The manifest must be p's, and overrides
+// the profile's settings as the separate file does.
+func loadBundle(name string, p circuit.Profile, prove bool) (loadedProfile, error) {
+	start := time.Now()
+	l := loadedProfile{profile: p, vk: new(groth16_bn254.VerifyingKey)}
+	members := map[string]io.ReaderFrom{"vk.groth16": l.vk}
+	if prove {
+		l.ccs, l.pk = new(cs_bn254.R1CS), new(groth16_bn254.ProvingKey)
+		members["ccs.groth16"], members["pk.groth16"] = l.ccs, l.pk
+	}
+
+	log.Printf("loading profile %s from %s: %d members", p.Name, name, len(members))
+	f, err := os.Open(name)
+	if err != nil {
+		return l, err
+	}
+	defer f.Close()
+	m, err := artifacts.ReadBundle(f, members)
+	if err != nil {
+		return l, fmt.Errorf("%s: %w", name, err)
+	}
+	if (m.Profile != "" && m.Profile != p.Name) || m.N != p.N {
+		return l, fmt.Errorf("%w: %s holds the setup of profile %q (N = %d), want %s (N = %d)", errs.ErrArtifactMismatch, name, m.Profile, m.N, p.Name, p.N)
+	}
+	if err := useManifest(&l, m, prove); err != nil {
+		return l, err
+	}
+	log.Printf("profile %s loaded in %s", p.Name, time.Since(start).Round(time.Millisecond))
+	return l, nil
+}
+
+// bundleOf is p's setup bundle in dir, ok when there is one.
+func bundleOf(dir string, p circuit.Profile) (name string, ok bool) {
+	name = filepath.Join(dir, fetch.BundleName(p.Name))
+	_, err := os.Stat(name)
+	return name, err == nil
+}
+
+// useManifest sets l's profile from the setup manifest m, see
+// manifestProfile; proving also needs m's hints in this build.
+func useManifest(l *loadedProfile, m *artifacts.Manifest, prove bool) error {
+	if prove {
+		if err := circuit.CheckHintSet(m.Hints); err != nil {
+			return err
+		}
+	}
+	p, err := manifestProfile(l.profile, m)
+	if err != nil {
+		return err
+	}
+	l.profile, l.manifest = p, true
+	return nil
+}
+
+// preloadProfile loads p while srv is serving and enables it.
+func preloadProfile(srv *server.Server, dir string, p circuit.Profile, prove bool) error {
+	l, err := loadProfile(dir, p, prove)
+	if err != nil {
+		return err
+	}
+	if err := srv.SetVK(p.Name, l.served()); err != nil {
+		return err
+	}
+	if prove {
+		if err := srv.EnableProving(l.profile, l.ccs, l.pk); err != nil {
+			return err
+		}
+	}
+	log.Printf("serving preloaded profile %s", l.profile)
+	return nil
+}
+
+// manifestProfile is p with the data hash, message version, ordering and
+// bounds the setup recorded in m compiled with, and its size scale. It fails
+// with errs.ErrArtifactMismatch when m records features p can't have.
+func manifestProfile(p circuit.Profile, m *artifacts.Manifest) (circuit.Profile, error) {
+	bounds := circuit.Bounds{NonceBits: m.NonceBits, SizeBits: m.SizeBits, TotalBits: m.TotalBits, MinSize: m.MinSize}
+	p, err := (circuit.Params{Bounds: bounds, SizeScale: m.SizeScale, Cosigner: m.Cosigner}).Apply(p)
+	if err != nil {
+		return p, err
+	}
+	if p.DataHash, err = circuit.ParseDataHash(m.DataHash); err != nil {
+		return p, err
+	}
+	if p.Msg, err = circuit.ParseMsgVersion(m.Msg); err != nil {
+		return p, err
+	}
+	if p.Ordering, err = circuit.ParseOrdering(m.Ordering); err != nil {
+		return p, err
+	}
+	features, err := circuit.ParseFeatures(m.Features)
+	if err != nil {
+		return p, err
+	}
+	p = p.WithFeatures(features)
+	// a variant's setup can't be served as the settlement circuit
+	return p, verifier.CheckManifest(m, p)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gnarking/circuit"
+	"gnarking/estimate"
+)
+
+// runSimulate estimates proving and settling a batch without setup or
+// proving: constraints from fits over small compiles, prove time from an MSM
+// micro-benchmark on this host.
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile whose config (data hash, ordering, msg) to simulate")
+	n := fs.Int("n", 0, "batch size (circuit rows); default the profile's")
+	rows := fs.Int("rows", 0, "transactions the batch carries, the rest padding; default n")
+	msmSize := fs.Int("msm-size", estimate.DefaultMSMSize, "points in the MSM micro-benchmark")
+	gasPrice := fs.Float64("gas-price-gwei", 0.01, "gas price of the verify transaction")
+	ethUSD := fs.Float64("eth-usd", 3000, "ETH price in USD")
+	asJSON := fs.Bool("json", false, "print the simulation as JSON")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if *n == 0 {
+		*n = profile.N
+	}
+	if *rows == 0 {
+		*rows = *n
+	}
+	if *n <= 0 || *rows <= 0 || *rows > *n || *msmSize < 2 {
+		return fmt.Errorf("usage: ddm simulate [-profile P] [-n N] [-rows R <= N] [-msm-size S >= 2]")
+	}
+
+	m, err := estimate.BenchMSM(*msmSize)
+	if err != nil {
+		return err
+	}
+	s, err := estimate.Simulate(profile, *n, *rows, m, *gasPrice, *ethUSD)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(s)
+	}
+	fmt.Print(s)
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+	"gnarking/spotcheck"
+)
+
+const spotcheckUsage = "usage: ddm spotcheck keygen <audit.key> | ddm spotcheck commit -key <audit.key> [-profile -dir -batch -archive DIR -out] | ddm spotcheck audit (-url URL | -archive DIR -key <audit.key>) [-profile -dir -public -commitments -k 8 -json]"
+
+func runSpotcheck(args []string) error {
+	if len(args) < 1 {
+		return errors.New(spotcheckUsage)
+	}
+	switch args[0] {
+	case "keygen":
+		return runSpotcheckKeygen(args[1:])
+	case "commit":
+		return runSpotcheckCommit(args[1:])
+	case "audit":
+		return runSpotcheckAudit(args[1:])
+	default:
+		return errors.New(spotcheckUsage)
+	}
+}
+
+// runSpotcheckKeygen writes a new audit key, the operator's: salts are
+// derived from it.
+func runSpotcheckKeygen(args []string) error {
+	fs := flag.NewFlagSet("spotcheck keygen", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New(spotcheckUsage)
+	}
+	k, err := spotcheck.NewKey()
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite a key published commitments were salted with
+	f, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, k); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readAuditKey(file string) (spotcheck.Key, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return spotcheck.Key{}, err
+	}
+	return spotcheck.ParseKey(string(b))
+}
+
+// spotcheckProfile is the named profile with its setup manifest's
+// settings, when the manifest is in dir: the row messages are the setup's.
+func spotcheckProfile(name, dir string) (circuit.Profile, error) {
+	profile, err := circuit.LookupProfile(name)
+	if err != nil {
+		return profile, err
+	}
+	var m artifacts.Manifest
+	switch err := readFile(filepath.Join(dir, fmt.Sprintf("manifest_%s.json", profile.Name)), &m); {
+	case err == nil:
+		return manifestProfile(profile, &m)
+	case !errors.Is(err, os.ErrNotExist):
+		return profile, err
+	}
+	return profile, nil
+}
+
+// runSpotcheckCommit writes the commitments of a proven batch's rows, to be
+// published with it, and archives the batch for the openings.
+func runSpotcheckCommit(args []string) error {
+	fs := flag.NewFlagSet("spotcheck commit", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default files")
+	dir := fs.String("dir", "./artifact", "directory of the default files and the setup manifest")
+	batchFile := fs.String("batch", "", "the proven batch (default <dir>/batch_<profile>.json)")
+	keyFile := fs.String("key", "", "audit key file (ddm spotcheck keygen)")
+	archiveDir := fs.String("archive", "", "archive the batch here for ddm serve -spotcheck-dir; empty skips")
+	out := fs.String("out", "", "commitments to write (default <dir>/commitments_<profile>.json)")
+	fs.Parse(args)
+	if *keyFile == "" || fs.NArg() != 0 {
+		return errors.New(spotcheckUsage)
+	}
+	key, err := readAuditKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	profile, err := spotcheckProfile(*profileName, *dir)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	if *batchFile == "" {
+		*batchFile = name("batch_%s.json")
+	}
+	if *out == "" {
+		*out = name("commitments_%s.json")
+	}
+	var pub circuit.SettlementCircuitPublic
+	if err := readFile(name("public_%s.json"), &pub); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*batchFile)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, *batchFile, err)
+	}
+
+	c, err := spotcheck.Commit(profile, pub, &req, key)
+	if err != nil {
+		return err
+	}
+	if *archiveDir != "" {
+		id, err := circuit.BatchID(pub)
+		if err != nil {
+			return err
+		}
+		if err := (spotcheck.Archive{Dir: *archiveDir, Key: key}).Put(id, &req); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(*out, c); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d rows of batch %s, root %s\n", *out, len(c.Leaves), c.BatchID, c.Root)
+	return nil
+}
+
+// runSpotcheckAudit is the auditor's side: sample k rows of a proven batch
+// from its public inputs and commitments, have the operator open them and
+// check their signatures, without the batch or a re-prove.
+func runSpotcheckAudit(args []string) error {
+	fs := flag.NewFlagSet("spotcheck audit", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default files")
+	dir := fs.String("dir", "./artifact", "directory of the default files and the setup manifest")
+	publicFile := fs.String("public", "", "public inputs of the proven batch (default <dir>/public_<profile>.json)")
+	commitFile := fs.String("commitments", "", "the batch's published commitments (default <dir>/commitments_<profile>.json)")
+	k := fs.Int("k", 8, "rows to sample")
+	url := fs.String("url", "", "the operator's ddm serve -spotcheck-dir, to open the rows")
+	archiveDir := fs.String("archive", "", "open the rows from this archive instead of -url (with -key)")
+	keyFile := fs.String("key", "", "with -archive, the audit key")
+	timeout := fs.Duration("timeout", 30*time.Second, "bound on opening the rows")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	if (*url == "") == (*archiveDir == "") || fs.NArg() != 0 {
+		return errors.New(spotcheckUsage)
+	}
+	var opener spotcheck.Opener = &spotcheck.Client{URL: *url}
+	if *archiveDir != "" {
+		if *keyFile == "" {
+			return errors.New(spotcheckUsage)
+		}
+		key, err := readAuditKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		opener = spotcheck.Archive{Dir: *archiveDir, Key: key}
+	}
+	profile, err := spotcheckProfile(*profileName, *dir)
+	if err != nil {
+		return err
+	}
+	name := func(format string) string { return filepath.Join(*dir, fmt.Sprintf(format, profile.Name)) }
+	if *publicFile == "" {
+		*publicFile = name("public_%s.json")
+	}
+	if *commitFile == "" {
+		*commitFile = name("commitments_%s.json")
+	}
+	var pub circuit.SettlementCircuitPublic
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+	var c spotcheck.Commitments
+	if err := readFile(*commitFile, &c); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	r, err := spotcheck.Audit(ctx, opener, profile, pub, &c, *k)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	fmt.Printf("batch %s: rows %v of %d opened, signed and in range\n", r.BatchID, r.Rows, r.N)
+	fmt.Printf("a single unsigned row would have gone unsampled with probability %.4f\n", r.Miss1)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/stats"
+)
+
+// runStats queries the per-proof statistics a ddm serve -stats-dir
+// records: percentiles of each field by profile over a window.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dir := fs.String("dir", "./artifact/stats", "statistics store, the -stats-dir of ddm serve")
+	profile := fs.String("profile", "", "only this profile (default all)")
+	since := fs.Duration("since", 24*time.Hour, "window ending now, unless -from is set")
+	from := fs.String("from", "", "window start, RFC 3339 (overrides -since)")
+	to := fs.String("to", "", "window end, RFC 3339 (default now)")
+	fields := fs.String("field", string(stats.FieldProveTime), "comma-separated fields, or all: "+joinFields())
+	pList := fs.String("p", "50,90,95,99", "comma-separated percentiles")
+	asJSON := fs.Bool("json", false, "print the summaries as JSON")
+	prune := fs.Bool("prune", false, "apply -retention and -max-mb to the store first")
+	retention := fs.Duration("retention", 30*24*time.Hour, "with -prune, delete statistics older than this (0 keeps them)")
+	maxMB := fs.Int64("max-mb", 0, "with -prune, delete the oldest statistics while the store is larger (0: no limit)")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*dir); err != nil {
+		return err
+	}
+	q := stats.Query{Profile: *profile, From: time.Now().Add(-*since)}
+	var err error
+	if *from != "" {
+		if q.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("%w: -from: %w", errs.ErrInvalidInput, err)
+		}
+	}
+	if *to != "" {
+		if q.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("%w: -to: %w", errs.ErrInvalidInput, err)
+		}
+	}
+	var fieldList []stats.Field
+	if *fields == "all" {
+		fieldList = stats.Fields
+	} else {
+		for _, name := range strings.Split(*fields, ",") {
+			f, err := stats.ParseField(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			fieldList = append(fieldList, f)
+		}
+	}
+	var ps []float64
+	for _, s := range strings.Split(*pList, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || p < 0 || p > 100 {
+			return fmt.Errorf("%w: percentile %q", errs.ErrInvalidInput, s)
+		}
+		ps = append(ps, p)
+	}
+
+	var r stats.Retention
+	if *prune {
+		r = stats.Retention{MaxAge: *retention, MaxBytes: *maxMB << 20}
+	}
+	st, err := stats.Open(*dir, r)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	samples, err := st.Query(q)
+	if err != nil {
+		return err
+	}
+	var sums []stats.Summary
+	for _, f := range fieldList {
+		sums = append(sums, stats.Summarize(samples, f, ps)...)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(sums)
+	}
+	if len(samples) == 0 {
+		return errors.New("no proofs in the window")
+	}
+	window := "since " + q.From.UTC().Format(time.RFC3339)
+	if !q.To.IsZero() {
+		window += " until " + q.To.UTC().Format(time.RFC3339)
+	}
+	fmt.Printf("%d proofs %s (seconds, MiB, USD)\n", len(samples), window)
+	return stats.WriteTable(os.Stdout, sums)
+}
+
+func joinFields() string {
+	names := make([]string, len(stats.Fields))
+	for i, f := range stats.Fields {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
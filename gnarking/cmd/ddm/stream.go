@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/retry"
+	"gnarking/server"
+	"gnarking/stream"
+	"gnarking/submitter"
+)
+
+const streamUsage = "usage: ddm stream -server URL (-kafka PROXY -group G -topics a,b | -nats URL [-nats-ca] -stream S -consumer C) [-profile -max-queue -max-pending -rpc URL -contract 0x.. -out DIR]"
+
+// runStream proves the intents of a Kafka topic or NATS JetStream consumer
+// on a ddm serve with intake enabled, until interrupted. Each proof is
+// written to -out before its messages are acknowledged.
+func runStream(args []string) error {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	serverURL := fs.String("server", "", "ddm serve URL, with -intake enabled (required)")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile of the intents; others are dropped")
+	kafka := fs.String("kafka", "", "Confluent REST Proxy URL, e.g. http://127.0.0.1:8082")
+	group := fs.String("group", "ddm", "with -kafka, consumer group")
+	topics := fs.String("topics", "", "with -kafka, comma-separated topics")
+	natsURL := fs.String("nats", "", "NATS server URL, e.g. nats://127.0.0.1:4222; tls://[user:pass@]host:4222 for TLS, which credentials require")
+	natsCA := fs.String("nats-ca", "", "with -nats, PEM file of the roots the server's certificate must chain to (default: the system's)")
+	streamName := fs.String("stream", "", "with -nats, JetStream stream")
+	consumer := fs.String("consumer", "", "with -nats, durable pull consumer of -stream, explicit acks")
+	wait := fs.Duration("wait", time.Second, "long-poll time of a fetch")
+	maxQueue := fs.Int("max-queue", 4, "pause fetching while the server has this many batches queued (0: never)")
+	maxPending := fs.Int("max-pending", 0, "pause fetching while this many intents wait and a batch is proving (default 4N)")
+	rpcURL := fs.String("rpc", "", "JSON-RPC endpoint to read KOld from (default: KOld starts at 0)")
+	contract := fs.String("contract", "", "with -rpc, settlement contract")
+	out := fs.String("out", "./artifact/stream", "directory proofs and public inputs are written to")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of -rpc reads: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+
+	var src stream.Source
+	switch {
+	case *serverURL == "":
+		return errors.New(streamUsage)
+	case *kafka != "" && *natsURL == "" && *topics != "":
+		src = &stream.Kafka{Proxy: *kafka, Group: *group, Topics: strings.Split(*topics, ","), Wait: *wait}
+	case *natsURL != "" && *kafka == "" && *streamName != "" && *consumer != "":
+		n := &stream.NATS{URL: *natsURL, Stream: *streamName, Consumer: *consumer, Wait: *wait}
+		if *natsCA != "" {
+			pem, err := os.ReadFile(*natsCA)
+			if err != nil {
+				return err
+			}
+			n.RootCAs = x509.NewCertPool()
+			if !n.RootCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("%w: no certificates in %s", errs.ErrInvalidInput, *natsCA)
+			}
+		}
+		src = n
+	default:
+		return errors.New(streamUsage)
+	}
+	defer src.Close()
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	a := &stream.Adapter{
+		Source:     src,
+		Prover:     &server.Client{URL: *serverURL},
+		Profile:    profile,
+		MaxQueue:   *maxQueue,
+		MaxPending: *maxPending,
+		Proven: func(sub submitter.Submission) error {
+			id, err := circuit.BatchID(sub.Public)
+			if err != nil {
+				return err
+			}
+			name := hex.EncodeToString(id[:8])
+			if err := writeFile(filepath.Join(*out, "proof_"+name+".groth16"), &artifacts.Proof{Header: sub.Header, Proof: sub.Proof}); err != nil {
+				return err
+			}
+			if err := writeFile(filepath.Join(*out, "public_"+name+".json"), &sub.Public); err != nil {
+				return err
+			}
+			fmt.Printf("batch %s: recipient %#x, M %v\n", name, sub.Public.Recipient, sub.Public.M)
+			return nil
+		},
+	}
+	if *rpcURL != "" {
+		rpc, err := chainsync.NewRPC(*rpcURL, *contract)
+		if err != nil {
+			return err
+		}
+		if rpc.Retry, err = retry.Parse(*retrySpec); err != nil {
+			return err
+		}
+		a.KOld = rpc
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.Run(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/retry"
+	"gnarking/server"
+	"gnarking/submitter"
+	"gnarking/verifier"
+)
+
+// runSubmit posts a proof to the verifier contract unless it is stale.
+func runSubmit(args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default inputs")
+	vkFile := fs.String("vk", "", "verifying key (default ./artifact/vk_<profile>.groth16)")
+	proofFile := fs.String("proof", "", "framed proof (default ./artifact/proof_<profile>.groth16)")
+	publicFile := fs.String("public", "", "public inputs JSON (default ./artifact/public_<profile>.json)")
+	rpcURL := fs.String("rpc", "", "JSON-RPC endpoint holding the sender account (required)")
+	contract := fs.String("contract", "", "settlement contract to re-check KOld against before posting (default: no KOld check)")
+	verifierAddr := fs.String("verifier", "", "verifier contract address (required)")
+	from := fs.String("from", "", "sender address, an account of the RPC node (required)")
+	maxAge := fs.Duration("max-age", 0, "refuse proofs older than this when their header carries no max age (0: no limit)")
+	dashboard := fs.String("dashboard", "", "ddm serve URL to report the transaction to (POST /submitted), empty disables")
+	stateFile := fs.String("state", "", "submitter state file: manage nonces locally, replace stalled transactions with bumped fees and wait for confirmations (empty: post once)")
+	confirmations := fs.Uint64("confirmations", submitter.DefaultConfirmations, "with -state, blocks deep a transaction must be")
+	stall := fs.Duration("stall", submitter.DefaultStallAfter, "with -state, replace a transaction unmined this long")
+	maxFeeGwei := fs.Float64("max-fee-gwei", 0, "with -state, never bid a fee cap above this (0: no cap)")
+	wait := fs.Duration("wait", 15*time.Minute, "with -state, how long to follow the transaction; rerun with the same -state to resume")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of node reads and -state sends (a post without -state is never retried): off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+	if *rpcURL == "" || *verifierAddr == "" || *from == "" {
+		return fmt.Errorf("usage: ddm submit -rpc URL -verifier 0x.. -from 0x.. [-contract 0x..] [-max-age 10m]")
+	}
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		flag   *string
+		format string
+	}{
+		{vkFile, "./artifact/vk_%s.groth16"},
+		{proofFile, "./artifact/proof_%s.groth16"},
+		{publicFile, "./artifact/public_%s.json"},
+	} {
+		if *f.flag == "" {
+			*f.flag = fmt.Sprintf(f.format, profile.Name)
+		}
+	}
+
+	var (
+		vk    groth16_bn254.VerifyingKey
+		proof groth16_bn254.Proof
+		pub   circuit.SettlementCircuitPublic
+	)
+	framed := artifacts.Proof{Proof: &proof}
+	if err := readFile(*vkFile, &vk); err != nil {
+		return err
+	}
+	if err := readFile(*proofFile, &framed); err != nil {
+		return err
+	}
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+	// never pay gas for a proof that would revert
+	if err := verifier.CheckBatchID(framed.Header, pub); err != nil {
+		return err
+	}
+	if err := checkFeatures(framed.Header, profile, filepath.Dir(*vkFile)); err != nil {
+		return err
+	}
+	if err := verifier.Verify(&vk, &proof, pub); err != nil {
+		return err
+	}
+
+	policy, err := retry.Parse(*retrySpec)
+	if err != nil {
+		return err
+	}
+	rpc := &chainsync.RPC{URL: *rpcURL}
+	sub := submitter.Submitter{
+		Poster: &submitter.RPCPoster{RPC: rpc, From: *from, Verifier: *verifierAddr},
+		MaxAge: *maxAge,
+		Retry:  policy,
+		Requeue: func(s submitter.Submission, reason error) {
+			id, _ := circuit.BatchID(s.Public)
+			fmt.Printf("requeue: batch %x must be proven again against the current KOld: %v\n", id[:8], reason)
+		},
+	}
+	if *contract != "" {
+		if sub.Source, err = chainsync.NewRPC(*rpcURL, *contract); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	s := submitter.Submission{Header: framed.Header, Proof: &proof, Public: pub}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return err
+	}
+	// reports go to the dashboard's POST /submitted (and its event log); a
+	// dashboard failure is only printed, the transaction may be out
+	report := func(r server.SubmittedRequest) {
+		if *dashboard == "" {
+			return
+		}
+		r.BatchID = hex.EncodeToString(id[:])
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := reportSubmitted(ctx, *dashboard, r); err != nil {
+			fmt.Printf("dashboard: %v\n", err)
+		}
+	}
+	failed := func(err error) error {
+		report(server.SubmittedRequest{Error: err.Error(), Code: errs.CodeOf(err)})
+		return err
+	}
+	if *stateFile != "" {
+		a := &submitter.Async{
+			Submitter: sub, Chain: rpc, Store: submitter.FileStore(*stateFile),
+			From: *from, Verifier: *verifierAddr,
+			Confirmations: *confirmations, StallAfter: *stall,
+		}
+		if *maxFeeGwei > 0 {
+			a.MaxFeeCap, _ = new(big.Float).Mul(big.NewFloat(*maxFeeGwei), big.NewFloat(1e9)).Int(nil)
+		}
+		r, err := submitAsync(a, s, *wait, report)
+		if err != nil {
+			return err
+		}
+		if r.Err != nil {
+			return failed(r.Err)
+		}
+		report(server.SubmittedRequest{TxHash: r.TxHash, Block: r.Block, Confirmations: *confirmations})
+		return nil
+	}
+	hash, err := sub.Submit(ctx, s)
+	if err != nil {
+		return failed(err)
+	}
+	fmt.Printf("submitted %s\n", hash)
+	report(server.SubmittedRequest{TxHash: hash})
+	return nil
+}
+
+// submitAsync enqueues s, reports the transaction posted, and follows it
+// until it is confirmed or given up on (the Result), or wait runs out; the
+// state file keeps tracking it either way.
+func submitAsync(a *submitter.Async, s submitter.Submission, wait time.Duration, report func(server.SubmittedRequest)) (*submitter.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	p, err := a.Enqueue(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("posted batch %s at nonce %d: %s\n", p.BatchID[:16], p.Nonce, p.Hashes[len(p.Hashes)-1])
+	report(server.SubmittedRequest{TxHash: p.Hashes[len(p.Hashes)-1]})
+
+	var mine *submitter.Result
+	err = a.Run(ctx, 5*time.Second, func(r submitter.Result) {
+		if r.Err != nil {
+			fmt.Printf("batch %s: %v\n", r.BatchID[:16], r.Err)
+		} else {
+			fmt.Printf("batch %s confirmed in block %d: %s\n", r.BatchID[:16], r.Block, r.TxHash)
+		}
+		if r.BatchID == p.BatchID {
+			mine = &r
+			cancel()
+		}
+	})
+	switch {
+	case mine != nil:
+		return mine, nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, fmt.Errorf("%w: batch %s still pending after %s; rerun with the same -state to keep following it", errs.ErrUnavailable, p.BatchID[:16], wait)
+	}
+	return nil, err
+}
+
+func reportSubmitted(ctx context.Context, url string, r server.SubmittedRequest) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/submitted", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/ioutilx"
+	"gnarking/publish"
+	"gnarking/retry"
+)
+
+const syncUsage = "usage: ddm sync -push (-ipfs URL | -cas DIR) [-profile -dir] | ddm sync -index CID (-ipfs URL | -cas DIR | -mirror URL) [-dir]"
+
+// runSync moves a setup between the ceremony coordinator and the provers
+// in content-defined chunks: -push publishes every file the manifest pins
+// and the index of their chunks; -index rebuilds the setup from that index,
+// fetching only the chunks the local copies lack, e.g. after a
+// contribution changed part of the pk.
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	push := fs.Bool("push", false, "publish the setup of -profile in -dir and print the CID of its chunk index")
+	indexCID := fs.String("index", "", "CID of the chunk index to sync -dir to")
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile to push, names the artifacts")
+	dir := fs.String("dir", "./artifact", "directory holding the artifacts")
+	ipfsAPI := fs.String("ipfs", "", "Kubo RPC API, e.g. http://127.0.0.1:5001")
+	casDir := fs.String("cas", "", "content-addressed directory of <cid> files")
+	mirror := fs.String("mirror", "", "HTTP server of a content-addressed directory, <URL>/<cid> (sync only)")
+	timeout := fs.Duration("timeout", time.Hour, "overall deadline")
+	retrySpec := fs.String("retry", retry.Default.String(), "retry policy of -ipfs and -mirror calls: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	fs.Parse(args)
+	policy, err := retry.Parse(*retrySpec)
+	if err != nil {
+		return err
+	}
+
+	var store interface {
+		publish.Store
+		publish.Getter
+	}
+	var getter publish.Getter
+	switch {
+	case *ipfsAPI != "" && *casDir == "" && *mirror == "":
+		store = &publish.IPFS{API: *ipfsAPI, Retry: policy}
+		getter = store
+	case *casDir != "" && *ipfsAPI == "" && *mirror == "":
+		store = publish.Dir(*casDir)
+		getter = store
+	case *mirror != "" && *ipfsAPI == "" && *casDir == "" && !*push:
+		getter = &publish.Mirror{URL: *mirror, Retry: policy}
+	default:
+		return errors.New(syncUsage)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch {
+	case *push && *indexCID == "":
+		profile, err := circuit.LookupProfile(*profileName)
+		if err != nil {
+			return err
+		}
+		return pushSetup(ctx, store, *dir, profile.Name)
+	case *indexCID != "" && !*push:
+		return pullSetup(ctx, getter, *dir, *indexCID)
+	default:
+		return errors.New(syncUsage)
+	}
+}
+
+// memberFile is the file of a manifest member, pk.groth16 -> pk_8.groth16.
+func memberFile(dir, member, profile string) string {
+	kind, ext, _ := strings.Cut(member, ".")
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.%s", kind, profile, ext))
+}
+
+func pushSetup(ctx context.Context, s publish.Store, dir, profile string) error {
+	idx := publish.ChunkIndex{Version: publish.ChunkIndexVersion, Files: make(map[string][]publish.Chunk)}
+	if err := readFile(filepath.Join(dir, fmt.Sprintf("manifest_%s.json", profile)), &idx.Manifest); err != nil {
+		return err
+	}
+	start := time.Now()
+	var total int64
+	for _, member := range slices.Sorted(maps.Keys(idx.Manifest.Files)) {
+		fName := memberFile(dir, member, profile)
+		f, err := os.Open(fName)
+		if err != nil {
+			return err
+		}
+		// compressed files are published as the manifest pins them
+		zr, err := artifacts.NewReader(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		chunks, entry, err := publish.PutChunks(ctx, s, member, zr)
+		zr.Close()
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if want := idx.Manifest.Files[member]; entry != want {
+			return fmt.Errorf("%w: %s is %d bytes hashing to %s, the manifest pins %d bytes hashing to %s", errs.ErrArtifactMismatch, fName, entry.Size, entry.SHA256, want.Size, want.SHA256)
+		}
+		idx.Files[member] = chunks
+		total += entry.Size
+		fmt.Printf("%-24s %10s  %d chunks\n", filepath.Base(fName), ioutilx.Size(entry.Size), len(chunks))
+	}
+	var b bytes.Buffer
+	idx.WriteTo(&b)
+	entries, err := publish.Publish(ctx, s, []publish.File{{Name: fmt.Sprintf("chunks_%s.json", profile), Data: b.Bytes()}})
+	if err != nil {
+		return err
+	}
+	took := time.Since(start)
+	fmt.Printf("published %s in %s (%s), chunk index %s\n", ioutilx.Size(total), took.Round(time.Millisecond), ioutilx.Rate(total, took), entries[0].CID)
+	return nil
+}
+
+func pullSetup(ctx context.Context, g publish.Getter, dir, cid string) error {
+	data, err := g.Get(ctx, cid)
+	if err != nil {
+		return fmt.Errorf("chunk index %s: %w", cid, err)
+	}
+	if err := publish.Verify(cid, data); err != nil {
+		return fmt.Errorf("chunk index: %w", err)
+	}
+	var idx publish.ChunkIndex
+	if _, err := idx.ReadFrom(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	profile := idx.Manifest.Profile
+	if profile == "" {
+		return fmt.Errorf("%w: chunk index %s: manifest names no profile", errs.ErrArtifactMismatch, cid)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var fetched int64
+	for _, member := range slices.Sorted(maps.Keys(idx.Manifest.Files)) {
+		chunks, ok := idx.Files[member]
+		if !ok {
+			return fmt.Errorf("%w: chunk index %s has no chunks of %s", errs.ErrArtifactMismatch, cid, member)
+		}
+		fName := memberFile(dir, member, profile)
+		local, err := localCopy(fName)
+		if err != nil {
+			return err
+		}
+		var reuse io.ReaderAt // a nil *os.File is not a nil ReaderAt
+		if local != nil {
+			reuse = local
+		}
+		want := idx.Manifest.Files[member]
+		var st publish.SyncStats
+		err = writeFile(fName, artifacts.WriterFunc(func(w io.Writer) error {
+			var err error
+			st, err = publish.Assemble(ctx, g, chunks, want, reuse, w)
+			return err
+		}))
+		if local != nil {
+			local.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", fName, err)
+		}
+		fetched += st.Fetched
+		fmt.Printf("%-24s %10s  %d chunks, %d local, fetched %s\n", filepath.Base(fName), ioutilx.Size(want.Size), st.Chunks, st.Reused, ioutilx.Size(st.Fetched))
+	}
+	// the manifest last: it pins files that are all in place
+	mName := filepath.Join(dir, fmt.Sprintf("manifest_%s.json", profile))
+	if err := writeFile(mName, &idx.Manifest); err != nil {
+		return err
+	}
+	took := time.Since(start)
+	fmt.Printf("synced profile %s in %s, fetched %s (%s), wrote %s\n", profile, took.Round(time.Millisecond), ioutilx.Size(fetched), ioutilx.Rate(fetched, took), mName)
+	return nil
+}
+
+// localCopy opens fName for its chunks to be reused, nil when it is missing
+// or compressed: a compressed file shares no chunks with the raw one.
+func localCopy(fName string) (*os.File, error) {
+	f, err := os.Open(fName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var magic [len(artifacts.ZstdMagic)]byte
+	if _, err := io.ReadFull(f, magic[:]); err == nil && magic == artifacts.ZstdMagic {
+		f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
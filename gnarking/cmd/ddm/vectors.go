@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"gnarking/prover"
+	"gnarking/testvectors"
+)
+
+func runVectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	out := fs.String("out", "vectors.json", "fixture file to write")
+	seedHex := fs.String("seed", hex.EncodeToString(testvectors.DefaultSeed[:]), "hex seed (at most 32 bytes); the default reproduces testvectors/testdata/vectors.json")
+	proofs := fs.Bool("proofs", false, "also run a Groth16 setup and prove the first batch (byte-reproducible only in a -tags ddm_deterministic build)")
+	fs.Parse(args)
+
+	b, err := hex.DecodeString(*seedHex)
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+	var seed [32]byte
+	if len(b) > len(seed) {
+		return fmt.Errorf("seed is %d bytes, at most %d", len(b), len(seed))
+	}
+	copy(seed[:], b)
+	if *proofs && prover.Deterministic {
+		if err := prover.SetSeed(seed); err != nil {
+			return err
+		}
+	}
+
+	v, err := testvectors.Generate(seed, *proofs)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*out, v); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", *out)
+	return nil
+}
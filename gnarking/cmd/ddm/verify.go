@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+	"gnarking/verifier"
+)
+
+// runVerify checks a proof against its vk and public inputs, with
+// -cross-check also through the independent pairing verifier.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default inputs")
+	vkFile := fs.String("vk", "", "verifying key (default ./artifact/vk_<profile>.groth16)")
+	proofFile := fs.String("proof", "", "proof, framed or legacy (default ./artifact/proof_<profile>.groth16)")
+	publicFile := fs.String("public", "", "public inputs JSON (default ./artifact/public_<profile>.json)")
+	dir := fs.String("dir", "", "find the vk of the setup the proof header names among the manifests in dir, instead of the -vk default")
+	batchFile := fs.String("batch", "", "batch JSON the proof should be of (batch_<profile>.json); its rows, recipient, key and nonces must give exactly the public inputs")
+	summaryFile := fs.String("summary", "", "summary JSON (summary_<profile>.json) that should be of this vk, proof and public inputs")
+	crossCheck := fs.Bool("cross-check", false, "also verify with the pairing verifier built on gnark-crypto and require both to agree")
+	fs.Parse(args)
+
+	profile, err := circuit.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+	resolveVK := *vkFile == "" && *dir != ""
+	for _, f := range []struct {
+		flag   *string
+		format string
+	}{
+		{vkFile, "./artifact/vk_%s.groth16"},
+		{proofFile, "./artifact/proof_%s.groth16"},
+		{publicFile, "./artifact/public_%s.json"},
+	} {
+		if *f.flag == "" {
+			*f.flag = fmt.Sprintf(f.format, profile.Name)
+		}
+	}
+
+	var (
+		vk    groth16_bn254.VerifyingKey
+		proof groth16_bn254.Proof
+		pub   circuit.SettlementCircuitPublic
+	)
+	framed := artifacts.Proof{Proof: &proof}
+	if err := readFile(*proofFile, &framed); err != nil {
+		return err
+	}
+	if resolveVK {
+		if *vkFile, err = (artifacts.Resolver{Dir: *dir}).ForProof(artifacts.KindVK, framed.Header); err != nil {
+			return err
+		}
+		fmt.Printf("vk: %s\n", *vkFile)
+	}
+	if err := readFile(*vkFile, &vk); err != nil {
+		return err
+	}
+	if err := readFile(*publicFile, &pub); err != nil {
+		return err
+	}
+	if framed.Header != nil {
+		fmt.Printf("proof header: %s\n", framed.Header)
+	}
+	if err := verifier.CheckBatchID(framed.Header, pub); err != nil {
+		return err
+	}
+	setupDir := *dir
+	if setupDir == "" {
+		setupDir = filepath.Dir(*vkFile)
+	}
+	if err := checkFeatures(framed.Header, profile, setupDir); err != nil {
+		return err
+	}
+	if *batchFile != "" {
+		if err := checkBatchFile(*batchFile, profile, *dir, framed.Header, pub); err != nil {
+			return err
+		}
+	}
+
+	if *summaryFile != "" {
+		var s verifier.Summary
+		if err := readFile(*summaryFile, &s); err != nil {
+			return err
+		}
+		if err := verifier.CheckSummary(s, &vk, &proof, pub); err != nil {
+			return fmt.Errorf("%s: %w", *summaryFile, err)
+		}
+		fmt.Printf("summary %s matches\n", *summaryFile)
+	}
+
+	if *crossCheck {
+		if err := verifier.CrossVerify(&vk, &proof, pub); err != nil {
+			return err
+		}
+		fmt.Println("proof valid (gnark and pairing verifiers agree)")
+		return nil
+	}
+	if err := verifier.Verify(&vk, &proof, pub); err != nil {
+		return err
+	}
+	fmt.Println("proof valid")
+	return nil
+}
+
+// checkFeatures fails when hdr records other circuit.Features than the
+// setup in dir: the manifest matching hdr, else manifest_<profile>.json.
+// Without a manifest there is nothing to check against.
+func checkFeatures(hdr *artifacts.ProofHeader, profile circuit.Profile, dir string) error {
+	if hdr == nil || !hdr.HasFeatures() {
+		return nil
+	}
+	m, err := (artifacts.Resolver{Dir: dir}).Manifest(hdr)
+	if err != nil {
+		m = new(artifacts.Manifest)
+		switch err := readFile(filepath.Join(dir, fmt.Sprintf("manifest_%s.json", profile.Name)), m); {
+		case errors.Is(err, os.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+	if profile, err = manifestProfile(profile, m); err != nil {
+		return err
+	}
+	return verifier.CheckFeatures(hdr, profile.Features())
+}
+
+// checkBatchFile recomputes the public inputs, BatchDataRoot included, from
+// the raw batch in name and fails unless they are pub: the proof is then of
+// this data, not merely some valid proof. The batch's profile, else profile,
+// gives the data hash and ordering, unless the setup's manifest is found in
+// dir.
+func checkBatchFile(name string, profile circuit.Profile, dir string, hdr *artifacts.ProofHeader, pub circuit.SettlementCircuitPublic) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("%w: batch %s: %w", errs.ErrInvalidInput, name, err)
+	}
+	if req.Profile != "" {
+		if profile, err = circuit.LookupProfile(req.Profile); err != nil {
+			return err
+		}
+	}
+	if dir != "" && hdr != nil {
+		if m, err := (artifacts.Resolver{Dir: dir}).Manifest(hdr); err == nil {
+			if profile, err = manifestProfile(profile, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	batchPub, err := server.BatchPublic(profile, &req)
+	if err != nil {
+		return fmt.Errorf("batch %s: %w", name, err)
+	}
+	diff, err := circuit.DiffPublic(batchPub, pub)
+	if err != nil {
+		return fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(diff) > 0 {
+		return fmt.Errorf("%w: public inputs are not those of batch %s: %s differ", errs.ErrArtifactMismatch, name, strings.Join(diff, ", "))
+	}
+	id, err := circuit.BatchID(batchPub)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("batch %s matches: batch ID %x\n", name, id[:8])
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/circuit"
+	"gnarking/verifier"
+)
+
+const verifySolUsage = "usage: ddm verify-sol [-profile -constants-only -json] [settlement_verifier_N.sol vk_N.groth16]"
+
+// runVerifySol checks an exported Solidity verifier against the vk it
+// should embed before it is deployed: every vk constant in the source must
+// be the vk's, and the rest of the source what ddm export writes, so a
+// stale export or a manual edit fails.
+func runVerifySol(args []string) error {
+	fs := flag.NewFlagSet("verify-sol", flag.ExitOnError)
+	profileName := fs.String("profile", circuit.DefaultProfile, "circuit profile, names the default files in ./artifact")
+	constantsOnly := fs.Bool("constants-only", false, "only check the vk constants, accepting code that differs from this ddm's export (e.g. another gnark version's template)")
+	asJSON := fs.Bool("json", false, "write the check as JSON")
+	fs.Parse(args)
+
+	solFile := fmt.Sprintf("./artifact/settlement_verifier_%s.sol", *profileName)
+	vkFile := fmt.Sprintf("./artifact/vk_%s.groth16", *profileName)
+	switch fs.NArg() {
+	case 0:
+	case 2:
+		solFile, vkFile = fs.Arg(0), fs.Arg(1)
+	default:
+		return errors.New(verifySolUsage)
+	}
+	src, err := os.ReadFile(solFile)
+	if err != nil {
+		return err
+	}
+	var vk groth16_bn254.VerifyingKey
+	if err := readFile(vkFile, &vk); err != nil {
+		return err
+	}
+	c, err := verifier.CheckSolidity(src, &vk)
+	if err != nil {
+		return fmt.Errorf("%s: %w", solFile, err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%s against %s: %d vk constants, %d mismatched\n", solFile, vkFile, c.Constants, len(c.Mismatches))
+		for _, m := range c.Mismatches {
+			fmt.Printf("  %s\n", m)
+		}
+		if c.CodeMatches() {
+			fmt.Printf("code: ddm export's (fingerprint %s)\n", c.Fingerprint[:16])
+		} else {
+			fmt.Printf("code: fingerprint %s, ddm export's %s; first differs at line %d:\n  have %s\n  want %s\n",
+				c.Fingerprint[:16], c.ExportFingerprint[:16], c.FirstDiff, c.Line, c.ExportLine)
+		}
+	}
+	return c.Err(!*constantsOnly)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"gnarking/viewkey"
+)
+
+const viewUsage = "usage: ddm view keygen <key.hex> | ddm view open -key <key.hex> -commitment <0x..> <note>"
+
+func runView(args []string) error {
+	if len(args) < 1 {
+		return errors.New(viewUsage)
+	}
+	switch args[0] {
+	case "keygen":
+		return runViewKeygen(args[1:])
+	case "open":
+		return runViewOpen(args[1:])
+	default:
+		return errors.New(viewUsage)
+	}
+}
+
+func runViewKeygen(args []string) error {
+	fs := flag.NewFlagSet("view keygen", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New(viewUsage)
+	}
+	k, err := viewkey.NewKey()
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite a key notes were sealed to
+	f, err := os.OpenFile(fs.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, k); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runViewOpen(args []string) error {
+	fs := flag.NewFlagSet("view open", flag.ExitOnError)
+	keyFile := fs.String("key", "", "viewing key file (hex)")
+	commitmentHex := fs.String("commitment", "", "RecipientCommitment public input (hex)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *keyFile == "" || *commitmentHex == "" {
+		return errors.New(viewUsage)
+	}
+
+	keyData, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	k, err := viewkey.ParseKey(string(keyData))
+	if err != nil {
+		return err
+	}
+	commitment, ok := new(big.Int).SetString(strings.TrimPrefix(*commitmentHex, "0x"), 16)
+	if !ok {
+		return fmt.Errorf("invalid commitment %q", *commitmentHex)
+	}
+	note, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	o, err := viewkey.Open(k, note, commitment)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("recipient 0x%x (blinding 0x%x)\n", o.Recipient, o.Blinding)
+	return nil
+}
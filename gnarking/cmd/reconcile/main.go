@@ -0,0 +1,223 @@
+// reconcile matches the settlement contract's BatchSettled events against
+// the proofs and publish receipts on disk, by batch ID, and reports the
+// orphans: batches proven here but never settled, and batches settled that
+// were not proven here.
+//
+//	reconcile -rpc URL -contract 0x.. [-dir artifact,archive -from-block N -to-block N -grace 1h -json -out FILE]
+//
+// It exits 1 when there are orphans, so it can run from cron.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/archive"
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/publish"
+	"gnarking/report"
+	"gnarking/retry"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "reconcile:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	rpcURL := flag.String("rpc", "", "Ethereum JSON-RPC URL")
+	contract := flag.String("contract", "", "settlement contract address")
+	dirs := flag.String("dir", "./artifact", "comma-separated directories holding proof_*.groth16 and receipt_*.json, or ddm archive roots")
+	fromBlock := flag.Uint64("from-block", 0, "first block to read events from, e.g. the contract's deployment")
+	toBlock := flag.Uint64("to-block", 0, "last block to read events from (default latest)")
+	grace := flag.Duration("grace", time.Hour, "proofs younger than this are pending, not orphans")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	out := flag.String("out", "", "also write the report as JSON to this file")
+	retrySpec := flag.String("retry", retry.Default.String(), "retry policy of node reads: off, or e.g. attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	flag.Parse()
+	if *rpcURL == "" || *contract == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rpc, err := chainsync.NewRPC(*rpcURL, *contract)
+	if err != nil {
+		return err
+	}
+	if rpc.Retry, err = retry.Parse(*retrySpec); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *toBlock == 0 {
+		if *toBlock, err = rpc.BlockNumber(ctx); err != nil {
+			return err
+		}
+	}
+	events, err := rpc.BatchSettled(ctx, *fromBlock, *toBlock)
+	if err != nil {
+		return err
+	}
+	local := make(map[string]*report.ReconciledBatch)
+	for _, dir := range strings.Split(*dirs, ",") {
+		if err := scan(strings.TrimSpace(dir), local); err != nil {
+			return err
+		}
+	}
+
+	r := reconcile(events, local, time.Now(), *grace)
+	r.Contract, r.FromBlock, r.ToBlock = rpc.Contract, *fromBlock, *toBlock
+	if *out != "" {
+		err := artifacts.WriteFile(*out, artifacts.WriterFunc(func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "\t")
+			return enc.Encode(r)
+		}), false)
+		if err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(r)
+	}
+	if n := r.Orphans(); n > 0 {
+		return fmt.Errorf("%d orphaned batches", n)
+	}
+	return nil
+}
+
+// scan adds the batches of dir's framed proofs and receipts to local, by
+// hex batch ID; for a ddm archive root, those of every batch directory its
+// index lists.
+func scan(dir string, local map[string]*report.ReconciledBatch) error {
+	index, err := (&archive.Archive{Root: dir}).Index()
+	if err != nil {
+		return err
+	}
+	for _, e := range index {
+		if err := scan(filepath.Join(dir, filepath.FromSlash(e.Dir)), local); err != nil {
+			return err
+		}
+	}
+
+	batch := func(id string) *report.ReconciledBatch {
+		b, ok := local[id]
+		if !ok {
+			b = &report.ReconciledBatch{BatchID: id}
+			local[id] = b
+		}
+		return b
+	}
+
+	proofs, err := filepath.Glob(filepath.Join(dir, "proof_*.groth16"))
+	if err != nil {
+		return err
+	}
+	for _, name := range proofs {
+		framed := artifacts.Proof{Proof: new(groth16_bn254.Proof)}
+		if err := readFile(name, &framed); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if framed.Header == nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: legacy proof without a header, no batch ID\n", name)
+			continue
+		}
+		b := batch(hex.EncodeToString(framed.Header.BatchID[:]))
+		b.Proof, b.ProvedAt = name, framed.Header.Timestamp
+		if expires, ok := framed.Header.Expires(); ok && time.Now().After(expires) {
+			b.Expired = true
+		}
+	}
+
+	receipts, err := filepath.Glob(filepath.Join(dir, "receipt_*.json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range receipts {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var rc publish.Receipt
+		if err := json.Unmarshal(data, &rc); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if id, err := hex.DecodeString(rc.BatchID); err != nil || len(id) != 32 {
+			return fmt.Errorf("%s: invalid batch ID %q", name, rc.BatchID)
+		}
+		batch(strings.ToLower(rc.BatchID)).Receipt = name
+	}
+	return nil
+}
+
+// reconcile sorts events and local batches into matched and orphaned. A
+// batch only known from a receipt counts as proven here: the receipt was
+// written from its proof.
+func reconcile(events []chainsync.Settled, local map[string]*report.ReconciledBatch, now time.Time, grace time.Duration) report.Reconciliation {
+	r := report.Reconciliation{Time: now, Settled: len(events), Local: len(local)}
+	settled := make(map[string]bool)
+	for _, e := range events {
+		id := hex.EncodeToString(e.BatchID[:])
+		settled[id] = true
+		rb := report.ReconciledBatch{BatchID: id, Recipient: e.Recipient.Text(16), M: e.M.String(), Block: e.Block, TxHash: e.TxHash}
+		if b, ok := local[id]; ok {
+			rb.Proof, rb.Receipt, rb.ProvedAt, rb.Expired = b.Proof, b.Receipt, b.ProvedAt, b.Expired
+			r.Matched = append(r.Matched, rb)
+		} else {
+			r.Unproven = append(r.Unproven, rb)
+		}
+	}
+
+	ids := make([]string, 0, len(local))
+	for id := range local {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		if settled[id] {
+			continue
+		}
+		b := *local[id]
+		if !b.ProvedAt.IsZero() && now.Sub(b.ProvedAt) < grace && !b.Expired {
+			r.Pending = append(r.Pending, b)
+		} else {
+			r.Unsubmitted = append(r.Unsubmitted, b)
+		}
+	}
+	return r
+}
+
+// readFile reads a possibly compressed artifact, as ddm does.
+func readFile(name string, r io.ReaderFrom) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := artifacts.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	_, err = artifacts.Decode(r, zr)
+	return err
+}
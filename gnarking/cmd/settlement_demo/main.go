@@ -1,104 +1,117 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"crypto/rand"
 	"path/filepath"
 	// "encoding/binary"
-	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	fr_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"io"
 	"math/big"
 	"os"
-	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
-	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
 	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/signature"
 	nativeEddsa "github.com/consensys/gnark-crypto/signature/eddsa"
 
-	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend"
 	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
 	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
 	// "github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 
-	// "github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/backend/witness"
 
 	"flag"
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/chaos"
 	"gnarking/circuit"
+	"gnarking/cosign"
+	"gnarking/crash"
+	"gnarking/errs"
+	"gnarking/escrow"
+	"gnarking/hsm"
+	"gnarking/ioutilx"
+	"gnarking/keys"
+	"gnarking/memwatch"
+	"gnarking/plugins"
+	"gnarking/prover"
+	"gnarking/report"
+	"gnarking/revocation"
+	"gnarking/server"
+	"gnarking/spec"
+	"gnarking/statediff"
+	"gnarking/submitter"
+	"gnarking/tracing"
+	"gnarking/verifier"
+	"gnarking/viewkey"
 )
 
-type countingWriter struct {
-	n int64
-}
-
-func (w *countingWriter) Write(p []byte) (int, error) {
-	w.n += int64(len(p))
-	return len(p), nil
-}
-
-func reportEconomics(N int, proveTime time.Duration) {
+// reportHashes compiles the circuit once per BatchDataRoot hash and puts the
+// extra constraints next to the gas a contract pays to recompute the root,
+// then once per row message format.
+func reportHashes(n int) {
 	const (
-		cpuPricePerHour = 0.05  // $/core-hour
-		minTxUSD        = 0.005 // $ per smallest tx
-		hoursPerDay     = 24
-		daysPerYear     = 365
+		mimcRounds       = 110 // gnark-crypto MiMC BN254
+		gasPerMimcRound  = 60  // ~3 mulmod + 2 addmod + stack ops, hand-written assembly
+		keccakBaseGas    = 30
+		keccakWordGas    = 6
+		rowBytesPacked   = 16 // Size || Nonce as uint64 big-endian
+		fieldsPerRowMimc = 2  // Size, Nonce
 	)
-	cores := runtime.NumCPU()
-
-	proveSeconds := proveTime.Seconds()
-	cpuSeconds := proveSeconds * float64(cores)
-
-	// cost per proof in $
-	costPerProof := float64(cores) * cpuPricePerHour * (proveSeconds / 3600.0)
-
-	// value secured per proof
-	batchValue := float64(N) * minTxUSD
-
-	// percentage cost vs value
-	percentCost := (costPerProof / batchValue) * 100
+	width := 1 // leaves of the mimc-tree, n padded to a power of two
+	for width < n {
+		width *= 2
+	}
+	gas := map[circuit.DataHash]int{
+		circuit.DataHashMiMC:     n * fieldsPerRowMimc * mimcRounds * gasPerMimcRound,
+		circuit.DataHashKeccak:   keccakBaseGas + keccakWordGas*((n*rowBytesPacked+31)/32),
+		circuit.DataHashMiMCTree: (n*fieldsPerRowMimc + 2*(width-1)) * mimcRounds * gasPerMimcRound,
+	}
 
-	// throughput at full blast
-	proofsPerHour := 3600.0 / proveSeconds
-	usdPerHour := batchValue * proofsPerHour
-	usdPerDay := usdPerHour * hoursPerDay
-	usdPerYear := usdPerDay * daysPerYear
+	fmt.Printf("\n=== BatchDataRoot hash report (N = %d) ===\n", n)
+	for _, h := range []circuit.DataHash{circuit.DataHashMiMC, circuit.DataHashKeccak, circuit.DataHashMiMCTree} {
+		c := circuit.NewSettlementCircuit(n)
+		c.DataHash = h
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c)
+		check(err)
+		fmt.Printf("%-9s constraints: %8d, on-chain recompute: ~%d gas\n", h, ccs.GetNbConstraints(), gas[h])
+	}
+	fmt.Println("(gas figures are rough estimates for recomputing the root from posted rows, calldata excluded)")
 
-	fmt.Printf("\n=== Economics report (N = %d, cores = %d) ===\n", N, cores)
-	fmt.Printf("Prove time: %s, cores: %d → CPU-seconds: %.2f\n", proveTime, cores, cpuSeconds)
-	fmt.Printf("CPU price: $%.4f / core-hour → cost per proof: $%.6f\n", cpuPricePerHour, costPerProof)
-	fmt.Printf("Batch value (min tx $%.4f): $%.4f\n", minTxUSD, batchValue)
-	fmt.Printf("Proof cost / batch value: %.2f%%\n", percentCost)
-	fmt.Printf("Throughput at full load: $%.2f /h, $%.2f /day, $%.0f /year\n",
-		usdPerHour, usdPerDay, usdPerYear)
+	fmt.Printf("\n=== Row message hash report (N = %d) ===\n", n)
+	for _, v := range []circuit.MsgVersion{circuit.MsgV1, circuit.MsgV2, circuit.MsgSHA256} {
+		c := circuit.NewSettlementCircuit(n)
+		c.Msg = v
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c)
+		check(err)
+		fmt.Printf("%-6s constraints: %8d\n", v, ccs.GetNbConstraints())
+	}
+	fmt.Println("(sha256 is for signers without MiMC; the signature is EdDSA with MiMC whichever the message hash)")
 }
 
-// proofBytes: serialized Groth16 proof size (from proof.WriteTo)
-func reportCompression(proofBytes int64) {
-	feBytes := len(ecc.BN254.ScalarField().Bytes()) // 32 bytes on BN254
-
-	sigBytes := 3 * feBytes // R.X, R.Y, S
-	preimageFields := 4     // Recipient, Size, Nonce, ChainID
-	tuplePerTxBytes := preimageFields*feBytes + sigBytes
-
-	totalTupleBytes := int64(circuit.N) * int64(tuplePerTxBytes)
-	ratio := float64(totalTupleBytes) / float64(proofBytes)
-
-	fmt.Printf("\n=== Compression report (N = %d) ===\n", circuit.N)
-	fmt.Printf("Field element size: %d bytes (BN254 scalar field)\n", feBytes)
-	fmt.Printf("Per-tx naive payload (Recipient, Size, Nonce, ChainID, Signature):\n")
-	fmt.Printf("  preimage fields: %d × %d B = %d B\n", preimageFields, feBytes, preimageFields*feBytes)
-	fmt.Printf("  signature: %d B\n", sigBytes)
-	fmt.Printf("  → total per tx: %d bytes\n", tuplePerTxBytes)
-	fmt.Printf("Total naive calldata for %d txs: %d bytes\n", circuit.N, totalTupleBytes)
-	fmt.Printf("Groth16 proof size: %d bytes\n", proofBytes)
-	fmt.Printf("Calldata/proof ratio: %.2fx\n", ratio)
+// envBudget is the constraint budget in $DDM_MAX_CONSTRAINTS, 0 when unset.
+func envBudget() int {
+	v := os.Getenv("DDM_MAX_CONSTRAINTS")
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		check(fmt.Errorf("DDM_MAX_CONSTRAINTS %q: want a number of constraints", v))
+	}
+	return n
 }
 
 func check(e error) {
@@ -108,231 +121,971 @@ func check(e error) {
 }
 
 func dump(f string, w io.WriterTo) {
-	g, err := os.Create(f)
-	check(err)
-	defer g.Close()
-	_, err = w.WriteTo(g)
-	check(err)
+	check(artifacts.WriteFile(f, w, false))
+}
+
+// dumpZstd is dump, zstd-compressed; read decompresses it transparently.
+func dumpZstd(f string, w io.WriterTo) {
+	check(artifacts.WriteFile(f, w, true))
 }
-func read(fName string, r io.ReaderFrom) {
+
+// read returns the bytes read from disk, compressed or not.
+func read(fName string, r io.ReaderFrom) int64 {
 	f, err := os.Open(fName)
 	check(err)
 	defer f.Close()
-	_, err = r.ReadFrom(f)
+	var onDisk ioutilx.Counter
+	zr, err := artifacts.NewReader(io.TeeReader(f, &onDisk))
+	check(err)
+	defer zr.Close()
+	_, err = artifacts.Decode(r, chaos.Reader(fName, zr))
 	check(err)
+	return onDisk.N
 }
 
-type PublicInputsHex []string
+// readManifest reads the setup manifest in fName, ok false when there is
+// none.
+func readManifest(fName string) (*artifacts.Manifest, bool) {
+	if _, err := os.Stat(fName); errors.Is(err, os.ErrNotExist) {
+		return nil, false
+	}
+	var m artifacts.Manifest
+	read(fName, &m)
+	return &m, true
+}
 
-var _ io.WriterTo = (*PublicInputsHex)(nil)
+// DeleteMatchingFiles removes all files in dir matching pattern
+func DeleteMatchingFiles(dir string, patter string) error {
+	pattern := filepath.Join(dir, patter)
 
-func NewPublicInputsHexFromWitness(w witness.Witness) (PublicInputsHex, error) {
-	raw := w.Vector()
-	vec, ok := raw.(fr_bn254.Vector)
-	if !ok {
-		return nil, fmt.Errorf("unexpected witness vector type %T", raw)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
 	}
 
-	out := make([]string, len(vec))
-	for i := range vec {
-		b := vec[i].BigInt(new(big.Int))   // fr.Element -> *big.Int
-		out[i] = fmt.Sprintf("0x%064x", b) // 32-byte, 0x-prefixed
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	return out, nil
+// newBatch builds an N-row batch of size-1 rows with nonces KOld+1..KOld+N,
+// or with empty the empty batch at KOld (N rows of size 0 at nonce KOld),
+// each signed by priv. pol, if any, vets the rows before the witness is built,
+// and authorize, if any, before they are signed (the key's usage policy).
+// newBatch also returns the batch as a POST /prove body, the row data
+// published next to the proof.
+func newBatch(profile circuit.Profile, pol prover.Policy, authorize signAuthorizer, priv signature.Signer, recipient, chainID, kOld *big.Int, empty bool, dataHash circuit.DataHash, msgVersion circuit.MsgVersion) (*circuit.SettlementCircuit, *server.ProveRequest, error) {
+	if empty && !profile.EmptyBatches {
+		return nil, nil, fmt.Errorf("profile %s does not prove empty batches, set it up with --empty-batches", profile.Name)
+	}
+	sizes := make([]*big.Int, profile.N)
+	for i := range sizes {
+		sizes[i] = big.NewInt(1)
+		if empty {
+			sizes[i] = big.NewInt(0)
+		}
+	}
+	if pol != nil {
+		if err := pol.Check(prover.Batch{Recipient: recipient, ChainID: chainID, Sizes: sizes}); err != nil {
+			return nil, nil, err
+		}
+	}
+	if authorize != nil {
+		if err := authorize(chainID, sizes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	w := profile.Circuit()
+	w.P.Recipient = recipient
+	w.P.ChainID = chainID
+	w.P.KOld = kOld
+
+	total := big.NewInt(0)
+	nonces := make([]*big.Int, profile.N)
+	req := &server.ProveRequest{
+		Profile:   profile.Name,
+		Recipient: hex.EncodeToString(recipient.Bytes()),
+		ChainID:   chainID.Uint64(),
+		KOld:      kOld.Uint64(),
+		Pk:        hex.EncodeToString(priv.Public().Bytes()),
+		SizeScale: profile.SizeScale,
+	}
+	msgs, err := circuit.NewMsgHasher(msgVersion, recipient, chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := 0; i < profile.N; i++ {
+		size := sizes[i]
+		nonce := new(big.Int).Add(kOld, big.NewInt(int64(i+1))) // KOld+1,...,KOld+N
+		if profile.Ordering == circuit.OrderingPermuted {
+			// rows need not arrive sorted: send them last first
+			nonce.Add(kOld, big.NewInt(int64(profile.N-i)))
+		}
+		if empty {
+			nonce.Set(kOld)
+		}
+
+		w.Size[i] = new(big.Int).Set(size)
+		w.Nonce[i] = new(big.Int).Set(nonce)
+		nonces[i] = nonce
+
+		// msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID) (v1)
+		msgBytes := msgs.Sum(size, nonce, chainID)
+
+		// sign with EdDSA using MiMC as internal hash
+		sigBytes, err := circuit.EdDSA{}.Sign(priv, msgBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// assign signature into circuit witness
+		w.Sig[i].Assign(te.BN254, sigBytes)
+		req.Rows = append(req.Rows, server.ProveRow{Size: size.Uint64(), Nonce: nonce.Uint64(), Sig: hex.EncodeToString(sigBytes)})
+
+		total.Add(total, size)
+	}
+
+	if err := profile.Bounds.Check(kOld, total, sizes, nonces); err != nil {
+		return nil, nil, err
+	}
+	w.P.TotalSettle = total
+	w.P.M = new(big.Int).Add(kOld, big.NewInt(int64(profile.N))) // largest nonce
+	if empty {
+		w.P.M = kOld
+	}
+	w.P.Pk.Assign(te.BN254, priv.Public().Bytes())
+	w.P.BatchDataRoot, err = circuit.RowsRoot(dataHash, profile.Ordering, sizes, nonces)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, req, nil
 }
-func (p *PublicInputsHex) WriteTo(w io.Writer) (int64, error) {
-	b, err := json.MarshalIndent(p, "", "  ")
+
+// derivedKey reads a master seed file and derives the key at pathStr, or at
+// recipient's path when pathStr is empty.
+func derivedKey(seedFile, pathStr string, recipient *big.Int) (signature.Signer, keys.Path, error) {
+	data, err := os.ReadFile(seedFile)
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	return bytes.NewReader(b).WriteTo(w)
+	seed, err := keys.ParseSeed(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	path := keys.RecipientPath(recipient)
+	if pathStr != "" {
+		if path, err = keys.ParsePath(pathStr); err != nil {
+			return nil, nil, err
+		}
+	}
+	priv, err := keys.Derive(seed, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, path, nil
 }
 
-type ProofWrap [8]string
+// wrappedKey opens a key file written by ddm keys wrap with the store it
+// names (settings from hsm.ConfigFromEnv). The key stays unwrapped for hold
+// after a signature, so one batch costs one unwrap.
+func wrappedKey(ctx context.Context, file string, hold time.Duration) (*hsm.Signer, keys.Path, error) {
+	var f hsm.KeyFile
+	read(file, &f)
+	s, err := hsm.Load(ctx, hsm.ConfigFromEnv(), &f)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.Hold = hold
+	path, err := keys.ParsePath(f.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, path, nil
+}
 
-func NewProofWrap(g *groth16_bn254.Proof) (ProofWrap, error) {
-	raw := g.MarshalSolidity()
-	if len(raw) != 8*32 {
-		return ProofWrap{}, fmt.Errorf("invalid proof length: got %d", len(raw))
+// privateRecipient draws the blinding of a private-recipient batch for
+// recipient: the note sealing its opening to the viewing key in keyFile,
+// and the batch's variant inputs.
+func privateRecipient(keyFile string, recipient *big.Int) ([]byte, json.RawMessage, error) {
+	if keyFile == "" {
+		return nil, nil, fmt.Errorf("the profile hides the recipient: --view-key names the key its opening is sealed to")
 	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	k, err := viewkey.ParseKey(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	blinding, err := viewkey.NewBlinding()
+	if err != nil {
+		return nil, nil, err
+	}
+	note, err := viewkey.Seal(k, viewkey.Opening{Recipient: recipient, Blinding: blinding})
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err := json.Marshal(&circuit.PrivateInputs{Blinding: circuit.FieldJSON(*blinding)})
+	return note, in, err
+}
 
-	var w ProofWrap
-	for i := 0; i < 8; i++ {
-		w[i] = "0x" + hex.EncodeToString(raw[i*32:(i+1)*32])
+// cosigned has the co-signer whose master seed is in seedFile co-sign
+// batch with its key at pathStr, for a 2-of-2 profile (cosign-8): the
+// batch's variant inputs. With a key usage policy file the rows pass it
+// first, as the operator's do, its totals kept next to seedFile.
+func cosigned(seedFile, pathStr, policyFile string, profile circuit.Profile, batch *server.ProveRequest) (json.RawMessage, error) {
+	if seedFile == "" {
+		return nil, fmt.Errorf("the profile is 2-of-2: --cosigner-master names the co-signer's master seed")
 	}
-	return w, nil
+	data, err := os.ReadFile(seedFile)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := keys.ParseSeed(string(data))
+	if err != nil {
+		return nil, err
+	}
+	path, err := keys.ParsePath(pathStr)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := keys.Derive(seed, path)
+	if err != nil {
+		return nil, err
+	}
+	if policyFile != "" {
+		authorize, err := usageAuthorizer(policyFile, seedFile, path)
+		if err != nil {
+			return nil, err
+		}
+		sizes := make([]*big.Int, len(batch.Rows))
+		for i, row := range batch.Rows {
+			sizes[i] = new(big.Int).SetUint64(row.Size)
+		}
+		if err := authorize(new(big.Int).SetUint64(batch.ChainID), sizes); err != nil {
+			return nil, err
+		}
+	}
+	s, err := cosign.Sign(priv, profile, batch)
+	if err != nil {
+		return nil, err
+	}
+	return cosign.Inputs(profile, batch, s)
 }
 
-var _ io.WriterTo = (*ProofWrap)(nil)
-var _ io.ReaderFrom = (*ProofWrap)(nil)
+// partialRatio is the variant inputs of a batch settled at ratio, num/den,
+// for a partial settlement profile (partial-8).
+func partialRatio(ratio string) (json.RawMessage, error) {
+	num, den, ok := strings.Cut(ratio, "/")
+	if !ok {
+		return nil, fmt.Errorf("the profile settles pro rata: --settle-ratio num/den, e.g. 2/3")
+	}
+	var in circuit.PartialInputs
+	n, err := strconv.ParseUint(num, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("--settle-ratio numerator: %w", err)
+	}
+	d, err := strconv.ParseUint(den, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("--settle-ratio denominator: %w", err)
+	}
+	in.Num, in.Den = uint32(n), uint32(d)
+	return json.Marshal(&in)
+}
 
-func (p *ProofWrap) WriteTo(w io.Writer) (int64, error) {
-	b, err := json.MarshalIndent(p, "", "\t")
+// accumulated opens the recipient's accumulator from stateFile, absent
+// before its first batch, and blinds the one after a batch settling total,
+// for a profile chaining batches (accumulator-8): the batch's variant
+// inputs, and the opening to write back once it is proven.
+func accumulated(stateFile string, total *big.Int) (json.RawMessage, *circuit.AccumulatorOpening, error) {
+	if stateFile == "" {
+		return nil, nil, fmt.Errorf("the profile chains batches: --chain-state names the file holding the recipient's accumulator opening")
+	}
+	var in circuit.AccumulatorInputs
+	in.Old = new(circuit.AccumulatorOpening)
+	if ok, err := readState(stateFile, in.Old); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		in.Old = nil
+	}
+	blinding, err := viewkey.NewBlinding()
 	if err != nil {
-		return 0, err
+		return nil, nil, err
+	}
+	in.NewBlinding = circuit.FieldJSON(*blinding)
+	cumulative := new(big.Int).Set(total)
+	if in.Old != nil {
+		cumulative.Add(cumulative, (*big.Int)(&in.Old.Cumulative))
 	}
-	return bytes.NewReader(b).WriteTo(w)
+	next := &circuit.AccumulatorOpening{Cumulative: circuit.FieldJSON(*cumulative), Blinding: in.NewBlinding}
+	raw, err := json.Marshal(&in)
+	return raw, next, err
 }
 
-func (p *ProofWrap) ReadFrom(r io.Reader) (int64, error) {
-	data, err := io.ReadAll(r)
+// epochCapped opens the recipient's epoch accumulator from stateFile,
+// absent before its first batch, and blinds the one after a batch settling
+// total in epoch under epochCap, for an epoch-capped profile (epochcap-8):
+// the batch's variant inputs, and the opening to write back once it is
+// proven.
+func epochCapped(stateFile string, epoch uint64, epochCap string, total *big.Int) (json.RawMessage, *circuit.EpochOpening, error) {
+	if stateFile == "" || epochCap == "" {
+		return nil, nil, fmt.Errorf("the profile caps each epoch: --epoch-cap is the cap, --chain-state names the file holding the recipient's epoch accumulator opening")
+	}
+	in := circuit.EpochCapInputs{Epoch: epoch, Old: new(circuit.EpochOpening)}
+	if err := in.Cap.UnmarshalJSON([]byte(epochCap)); err != nil {
+		return nil, nil, fmt.Errorf("--epoch-cap: %w", err)
+	}
+	if ok, err := readState(stateFile, in.Old); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		in.Old = nil
+	}
+	prevEpoch, spent := new(big.Int), new(big.Int)
+	if in.Old != nil {
+		prevEpoch.SetUint64(in.Old.Epoch)
+		spent = (*big.Int)(&in.Old.Spent)
+	}
+	next, err := circuit.NextEpochSpent(prevEpoch, spent, new(big.Int).SetUint64(epoch), total, (*big.Int)(&in.Cap))
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	if err := json.Unmarshal(data, p); err != nil {
-		return int64(len(data)), err
+	blinding, err := viewkey.NewBlinding()
+	if err != nil {
+		return nil, nil, err
 	}
-	return int64(len(data)), nil
+	in.NewBlinding = circuit.FieldJSON(*blinding)
+	raw, err := json.Marshal(&in)
+	return raw, &circuit.EpochOpening{Epoch: epoch, Spent: circuit.FieldJSON(*next), Blinding: in.NewBlinding}, err
 }
 
-// DeleteMatchingFiles removes all files in dir matching pattern
-func DeleteMatchingFiles(dir string, patter string) error {
-	pattern := filepath.Join(dir, patter)
+// readState reads the JSON in file into v, false when there is no file
+// yet.
+func readState(file string, v any) (bool, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%s: %w", file, err)
+	}
+	return true, nil
+}
 
-	matches, err := filepath.Glob(pattern)
+// unrevoked is the non-membership witness of pk, hex, in the revocation
+// list listFile (ddm revoke), absent for an empty one, for a profile
+// refusing revoked keys (revocation-8): the batch's variant inputs. A
+// revoked pk is ErrPolicyRejected.
+func unrevoked(listFile, pk string) (json.RawMessage, error) {
+	tree := revocation.New()
+	if listFile != "" {
+		f, err := os.Open(listFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := tree.ReadFrom(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", listFile, err)
+		}
+	}
+	nm, err := tree.NonMembership(pk)
 	if err != nil {
-		return fmt.Errorf("invalid pattern: %w", err)
+		return nil, err
 	}
+	return json.Marshal(nm)
+}
 
-	for _, path := range matches {
-		info, err := os.Stat(path)
+// demoChains are the chains a cross-chain batch allows besides its
+// chain_id.
+var demoChains = []uint64{10, 42161, 8453}
+
+// crossChain re-signs batch's rows, for a cross-chain profile
+// (crosschain-8), for the allowed chains in turn, its chain_id first, then
+// demoChains: the batch's variant inputs. w gets the new signatures.
+func crossChain(priv signature.Signer, profile circuit.Profile, w *circuit.SettlementCircuit, batch *server.ProveRequest) (json.RawMessage, error) {
+	chains := append([]uint64{batch.ChainID}, demoChains...)
+	in := circuit.CrossChainInputs{ChainIDs: demoChains}
+	recipient := w.P.Recipient.(*big.Int)
+	for i := range batch.Rows {
+		row, chain := &batch.Rows[i], chains[i%len(chains)]
+		msg := circuit.MsgHash(profile.Msg, recipient, new(big.Int).SetUint64(row.Size), new(big.Int).SetUint64(row.Nonce), new(big.Int).SetUint64(chain))
+		sig, err := circuit.EdDSA{}.Sign(priv, msg)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if !info.IsDir() {
-			if err := os.Remove(path); err != nil {
-				return err
+		row.Sig = hex.EncodeToString(sig)
+		w.Sig[i].Assign(te.BN254, sig)
+		in.Rows = append(in.Rows, chain)
+	}
+	return json.Marshal(&in)
+}
+
+// signAuthorizer refuses rows priv may not sign, before it signs them.
+type signAuthorizer func(chainID *big.Int, sizes []*big.Int) error
+
+// usageAuthorizer enforces the key usage policy in file for the key at path,
+// logging refusals to stderr as JSON lines. The daily totals persist in
+// keyFile.usage.json, next to the key, so they outlast this run.
+func usageAuthorizer(file, keyFile string, path keys.Path) (signAuthorizer, error) {
+	policy, err := keys.LoadUsagePolicy(file)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(os.Stderr)
+	e := &keys.Enforcer{Policy: policy, State: keyFile + ".usage.json", Log: func(v keys.Violation) { enc.Encode(v) }}
+	return func(chainID *big.Int, sizes []*big.Int) error {
+		if !chainID.IsUint64() {
+			return fmt.Errorf("%w: chain ID %s", errs.ErrInvalidInput, chainID)
+		}
+		units := make([]uint64, len(sizes))
+		for i, s := range sizes {
+			if !s.IsUint64() {
+				return fmt.Errorf("%w: row %d size %s", errs.ErrInvalidInput, i, s)
 			}
+			units[i] = s.Uint64()
 		}
+		return e.Authorize(path, chainID.Uint64(), units...)
+	}, nil
+}
+
+// runBench proves the same run of consecutive batches sequentially and then
+// through p, and prints the bench report.
+func runBench(profile circuit.Profile, pol prover.Policy, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, batches int, p prover.Pipeline, dataHash circuit.DataHash, msgVersion circuit.MsgVersion) {
+	priv, err := nativeEddsa.New(te.BN254, rand.Reader)
+	check(err)
+	wits := make([]witness.Witness, batches)
+	for k := range wits {
+		kOld := big.NewInt(int64(k * profile.N))
+		w, _, err := newBatch(profile, pol, nil, priv, big.NewInt(42), big.NewInt(1), kOld, false, dataHash, msgVersion)
+		check(err)
+		full, err := profile.Assign(w, nil)
+		check(err)
+		wits[k], err = frontend.NewWitness(full, ecc.BN254.ScalarField())
+		check(err)
 	}
-	return nil
+
+	// the sequential run's phases: the MSMs' share is what GPUs could win
+	var phases prover.Timings
+	run := func(p prover.Pipeline) time.Duration {
+		in := make(chan witness.Witness)
+		go func() {
+			defer close(in)
+			for _, w := range wits {
+				in <- w
+			}
+		}()
+		start := time.Now()
+		for res := range p.Run(context.Background(), in) {
+			check(res.Err)
+			if p.Depth == 1 {
+				phases.Add(res.Timings)
+			}
+		}
+		return time.Since(start)
+	}
+
+	p.CCS, p.PK = ccs, pk
+	if p.Depth <= 0 {
+		p.Depth = prover.DefaultDepth
+	}
+	seq := p
+	seq.Depth = 1
+	fmt.Printf("Bench: proving %d batches sequentially\n", batches)
+	seqTime := run(seq)
+	fmt.Printf("Bench: proving %d batches with pipeline depth %d\n", batches, p.Depth)
+	pipeTime := run(p)
+	fmt.Print(report.NewBench(profile.N, batches, p.Depth, seqTime, pipeTime))
+	fmt.Printf("Bench: phases per batch (sequential) %s\n", phases.Div(batches))
+}
+
+// runMulti has the key host at client prove k independent batches, one per
+// recipient from 42 on, and writes their combined submission to name and
+// its state diff to diffName.
+func runMulti(ctx context.Context, client *server.Client, profile circuit.Profile, pol prover.Policy, authorize signAuthorizer, priv signature.Signer, k int, dataHash circuit.DataHash, msgVersion circuit.MsgVersion, name, diffName string) {
+	req := &server.MultiProveRequest{Profile: profile.Name}
+	var pubs []circuit.SettlementCircuitPublic
+	for i := range k {
+		w, batch, err := newBatch(profile, pol, authorize, priv, big.NewInt(int64(42+i)), big.NewInt(1), big.NewInt(0), false, dataHash, msgVersion)
+		check(err)
+		req.Batches = append(req.Batches, *batch)
+		pubs = append(pubs, w.P)
+	}
+	start := time.Now()
+	subs, m, err := client.ProveMulti(ctx, req)
+	check(err)
+	fmt.Printf("Remote prover %s proved %d batches in %s\n", client.URL, len(subs), time.Since(start))
+	fmt.Printf("Combined submission: %s, digest %s, %d calldata bytes\n", m.Function, m.Digest, (len(m.Calldata)-2)/2)
+	dump(name, m)
+	diff, err := statediff.New(profile, 0, pubs...)
+	check(err)
+	dump(diffName, diff)
 }
 
 func main() {
-	var (
-		pkName            = fmt.Sprintf("./artifact/pk_%d.groth16", circuit.N)
-		ccsName           = fmt.Sprintf("./artifact/ccs_%d.groth16", circuit.N)
-		vkName            = fmt.Sprintf("./artifact/vk_%d.groth16", circuit.N)
-		proofName         = fmt.Sprintf("./artifact/proof_%d.groth16", circuit.N)
-		proofJsonName     = fmt.Sprintf("./artifact/proof_%d.json", circuit.N)
-		publicName        = fmt.Sprintf("./artifact/public_%d.json", circuit.N)
-		publicSolJsonName = fmt.Sprintf("./artifact/public_sol_%d.json", circuit.N)
-		verifyName        = fmt.Sprintf("./artifact/settlement_verifier_%d.sol", circuit.N)
+	// member names inside a .ddmbundle
+	const (
+		ccsMember = "ccs.groth16"
+		pkMember  = "pk.groth16"
+		vkMember  = "vk.groth16"
 	)
 
 	setup := flag.Bool("setup", false, "run circuit setup (compile + generate keys)")
 	prove := flag.Bool("prove", false, "generate a proof using existing proving key")
 	verify := flag.Bool("verify", false, "verify an existing proof")
+	profileName := flag.String("profile", circuit.DefaultProfile, "circuit profile (batch size and config), names the artifacts")
+	dataHashName := flag.String("data-hash", "", "override the profile's BatchDataRoot hash: mimc, keccak or mimc-tree (must match between setup and prove)")
+	hashReport := flag.Bool("hash-report", false, "compile every BatchDataRoot hash and row message variant and report constraints (vs on-chain gas for the root)")
+	orderingName := flag.String("ordering", "", "override the profile's nonce constraint: monotonic (KOld < Nonce[0] < ... == M), unique (distinct row IDs, any order) or permuted (rows in any order, monotonic once sorted)")
+	emptyBatches := flag.Bool("empty-batches", false, "override the profile: also prove empty batches, heartbeats with M == KOld whose rows are all size 0 at nonce KOld (must match between setup and prove)")
+	heartbeat := flag.Bool("heartbeat", false, "prove: prove the empty batch at KOld instead of N size-1 rows (needs --empty-batches)")
+	paramsFile := flag.String("params", "", "deployment parameters file (nonce_bits, size_bits, total_bits, min_size) bounding batch values; setup records them in the manifest, prove must use the same file")
+	msgName := flag.String("msg", "", "override the profile's signed row message format: v1 (msettle1), v2 (msettle2, ChainID in the shared prefix) or sha256 (SHA-256 digest for signers without MiMC, ~70k constraints a row)")
+	maxAge := flag.Duration("max-age", 0, "prove: record a max age in the proof header, after which submitters refuse the proof (0: none)")
+	maxConstraints := flag.Int("max-constraints", envBudget(), "setup: fail before generating keys when the circuit has more constraints than this, printing them per step and the features to turn off (default $DDM_MAX_CONSTRAINTS, 0: no budget)")
+	compress := flag.Bool("compress", false, "setup: write ccs/pk/vk zstd-compressed (~2-3x smaller; every reader sniffs and decompresses them)")
+	bundle := flag.Bool("bundle", false, "setup: also write settlement_N.ddmbundle; prove/verify: load ccs/pk/vk from it instead of separate files")
+	rpcURL := flag.String("rpc", "", "prove: JSON-RPC endpoint to read the recipient's on-chain KOld from (default: KOld = 0)")
+	contract := flag.String("contract", "", "prove: settlement contract address for --rpc")
+	memLimitMB := flag.Uint64("mem-limit-mb", 0, "prove: abort when in-use memory crosses this many MiB (default 90% of the cgroup limit, none without one)")
+	bench := flag.Int("bench", 0, "prove this many batches one at a time, then through the pipeline, and report the overlap gain")
+	pipelineDepth := flag.Int("pipeline-depth", prover.DefaultDepth, "bench: batches in flight in the pipeline (witness solving of the next overlaps MSMs of the current)")
+	pipelineMemMB := flag.Uint64("pipeline-mem-mb", 0, "bench: hold back the next batch while in-use memory is above this many MiB (default: --mem-limit-mb or its default)")
+	policyFile := flag.String("policy", "", "prove/bench: JSON policy (max_total, max_row_size, recipients, chain_ids) a batch must pass before its witness is built")
+	remote := flag.String("remote", "", "prove: build the witness here and have the ddm serve -prove key host at this URL prove it; no local ccs/pk needed")
+	remoteBatch := flag.Bool("remote-batch", false, "with --remote: send the signed batch (POST /prove, binary) instead of the witness")
+	cores := flag.Int("cores", 0, "prove: cores the prove may use, 0 for all; with --remote, asked of the key host")
+	multi := flag.Int("multi", 0, "with --remote: have the key host prove this many independent batches (POST /prove/multi) and write their combined submission to multi_N.json")
+	masterKey := flag.String("master-key", "", "prove: sign with a key derived from this master seed file (hex, ddm keys new) instead of a fresh random one")
+	keyPolicy := flag.String("key-policy", "", "prove: key usage policy (keys.UsagePolicy: chain IDs, max row size, max daily total per derivation path) the --master-key key, and a 2-of-2 profile's --cosigner-master key, must pass before it signs")
+	keyPath := flag.String("key-path", "", "prove: derivation path under --master-key, e.g. m/2'/7' (default the recipient's, keys.RecipientPath)")
+	wrappedKeyFile := flag.String("wrapped-key", "", "prove: sign with this key file (ddm keys wrap), unwrapped from its KMS key or PKCS#11 token only to sign, instead of --master-key")
+	viewKeyFile := flag.String("view-key", "", "prove: for a profile hiding the recipient (private-8), the viewing key file (ddm view keygen) the recipient's opening is sealed to, into note_N.bin; ddm view open reads it")
+	cosignerMaster := flag.String("cosigner-master", "", "prove: for a 2-of-2 profile (cosign-8), the co-signer's master seed file (hex); the demo co-signs the batch with its key at --cosigner-path, which must be the params file's cosigner")
+	cosignerPath := flag.String("cosigner-path", "m/2'/1'", "prove: derivation path of the co-signing key under --cosigner-master")
+	settleRatio := flag.String("settle-ratio", "", "prove: for a partial settlement profile (partial-8), the ratio num/den the batch settles at, e.g. 2/3")
+	chainState := flag.String("chain-state", "", "prove: for a profile chaining batches (accumulator-8, epochcap-8), the file holding the opening of the recipient's accumulator after its last batch: read when present, replaced once the batch is proven")
+	epoch := flag.Uint64("epoch", uint64(time.Now().Unix()/86400), "prove: for an epoch-capped profile (epochcap-8), the epoch the batch settles in (default today, in days since 1970)")
+	epochCap := flag.String("epoch-cap", "", "prove: for an epoch-capped profile (epochcap-8), the most the recipient may settle in one epoch")
+	revokedFile := flag.String("revoked", "", "prove: for a profile refusing revoked keys (revocation-8), the revocation list (ddm revoke) the signing key must be absent from (default: nothing revoked)")
+	escrowArbiter := flag.String("escrow-arbiter", "", "prove: also seal the full witness to this arbiter's X25519 public key (hex, ddm escrow keygen) into escrow_N.bin for dispute resolution; ddm publish records its hash")
+	crashDir := flag.String("crash-dir", cmp.Or(crash.Dir(), "./artifact/crash"), "prove/bench/verify: where a panic in gnark leaves its diagnostics bundle (crash package, default $DDM_CRASH_DIR), empty disables")
+	seedHex := flag.String("seed", "", "hex seed for all randomness (setup, keys, proof blinding) so proof bytes reproduce; needs a -tags ddm_deterministic build")
 	flag.Parse()
+	crash.SetDir(*crashDir)
+
+	if *seedHex != "" {
+		b, err := hex.DecodeString(*seedHex)
+		check(err)
+		var seed [32]byte
+		if len(b) > len(seed) {
+			check(fmt.Errorf("seed is %d bytes, at most %d", len(b), len(seed)))
+		}
+		copy(seed[:], b)
+		check(prover.SetSeed(seed))
+		fmt.Println("WARNING: deterministic proving randomness, for reproducibility tests only")
+	}
+
+	// profiles registered by the plugins in DDM_PLUGINS
+	added, err := plugins.LoadEnv()
+	check(err)
+	if len(added) > 0 {
+		fmt.Printf("Plugin profiles: %s\n", strings.Join(added, ", "))
+	}
+	profile, err := circuit.LookupProfile(*profileName)
+	check(err)
+	if *dataHashName != "" {
+		profile.DataHash, err = circuit.ParseDataHash(*dataHashName)
+		check(err)
+	}
+	if *orderingName != "" {
+		profile.Ordering, err = circuit.ParseOrdering(*orderingName)
+		check(err)
+	}
+	if *msgName != "" {
+		profile.Msg, err = circuit.ParseMsgVersion(*msgName)
+		check(err)
+	}
+	if *paramsFile != "" {
+		params, err := circuit.LoadParams(*paramsFile)
+		check(err)
+		profile, err = params.Apply(profile)
+		check(err)
+	}
+	if *emptyBatches {
+		profile.EmptyBatches = true
+	}
+	dataHash, ordering, msgVersion := profile.DataHash, profile.Ordering, profile.Msg
+
+	// spans go to OTEL_EXPORTER_OTLP_ENDPOINT when it is set
+	shutdown, err := tracing.Init(context.Background(), "settlement_demo")
+	check(err)
+	defer shutdown(context.Background())
+	ctx, span := tracing.Start(context.Background(), "settlement_demo", tracing.Profile(profile.Name), tracing.N(profile.N))
+	defer span.End()
+
+	var (
+		pkName            = fmt.Sprintf("./artifact/pk_%s.groth16", profile.Name)
+		ccsName           = fmt.Sprintf("./artifact/ccs_%s.groth16", profile.Name)
+		vkName            = fmt.Sprintf("./artifact/vk_%s.groth16", profile.Name)
+		proofName         = fmt.Sprintf("./artifact/proof_%s.groth16", profile.Name)
+		proofJsonName     = fmt.Sprintf("./artifact/proof_%s.json", profile.Name)
+		publicName        = fmt.Sprintf("./artifact/public_%s.json", profile.Name)
+		publicSolJsonName = fmt.Sprintf("./artifact/public_sol_%s.json", profile.Name)
+		verifyName        = fmt.Sprintf("./artifact/settlement_verifier_%s.sol", profile.Name)
+		manifestName      = fmt.Sprintf("./artifact/manifest_%s.json", profile.Name)
+		batchName         = fmt.Sprintf("./artifact/batch_%s.json", profile.Name)
+		multiName         = fmt.Sprintf("./artifact/multi_%s.json", profile.Name)
+		diffName          = fmt.Sprintf("./artifact/state_diff_%s.json", profile.Name)
+		escrowName        = fmt.Sprintf("./artifact/escrow_%s.bin", profile.Name)
+		noteName          = fmt.Sprintf("./artifact/note_%s.bin", profile.Name)
+		bundleName        = fmt.Sprintf("./artifact/settlement_%s%s", profile.Name, artifacts.BundleExt)
+	)
+
+	if *hashReport {
+		reportHashes(profile.N)
+	}
 
 	if *setup {
 		fmt.Println("Deleting old artifacts")
-		check(DeleteMatchingFiles("./artifact", "*_8.*"))
-		fmt.Println("Setting up N = %d", circuit.N)
-		var c circuit.SettlementCircuit
-		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &c)
+		check(DeleteMatchingFiles("./artifact", fmt.Sprintf("*_%s.*", profile.Name)))
+		fmt.Printf("Setting up profile %s\n", profile)
+		ccs, err := tracing.Compile(ctx, profile.Define(), tracing.Profile(profile.Name), tracing.N(profile.N))
+		check(err)
+		// before the keys: a circuit over budget must not reach production
+		check(spec.CheckBudget(profile, ccs.GetNbConstraints(), *maxConstraints))
+		pk, vk, err := tracing.Setup(ctx, ccs, tracing.Profile(profile.Name), tracing.N(profile.N))
 		check(err)
-		pk, vk, err := groth16.Setup(ccs)
+		save := dump
+		if *compress {
+			save = dumpZstd
+		}
+		save(ccsName, ccs)
+		save(pkName, pk)
+		save(vkName, vk)
+
+		m := artifacts.Manifest{
+			Version:  artifacts.ManifestVersion,
+			Profile:  profile.Name,
+			N:        profile.N,
+			Curve:    ecc.BN254.String(),
+			Backend:  backend.GROTH16.String(),
+			DataHash: dataHash.String(),
+			Ordering: ordering.String(),
+			Msg:      msgVersion.String(),
+			Hints:    circuit.HintSet(),
+			Features: profile.Features().String(),
+			// bounds as set up: the manifest is what serve and export read
+			NonceBits: profile.Bounds.NonceBits,
+			SizeBits:  profile.Bounds.SizeBits,
+			TotalBits: profile.Bounds.TotalBits,
+			MinSize:   profile.Bounds.MinSize,
+			SizeScale: profile.SizeScale,
+			Cosigner:  profile.Cosigner(),
+		}
+		layout, err := circuit.PublicLayout(profile)
+		check(err)
+		m.PublicInputs = len(layout)
+		circuitHash, err := artifacts.CircuitHash(ccs)
+		check(err)
+		m.CircuitHash = hex.EncodeToString(circuitHash[:])
+		check(m.Add(ccsMember, ccs))
+		check(m.Add(pkMember, pk))
+		check(m.Add(vkMember, vk))
+		dump(manifestName, &m)
+		if *bundle {
+			dump(bundleName, artifacts.WriterFunc(func(w io.Writer) error {
+				return artifacts.WriteBundle(w, &m, []string{ccsMember, vkMember, pkMember}, map[string]io.WriterTo{
+					ccsMember: ccs, pkMember: pk, vkMember: vk,
+				})
+			}))
+			fmt.Printf("Artifact bundle written to %s\n", bundleName)
+		}
+		dump(verifyName, artifacts.WriterFunc(func(w io.Writer) error { return vk.ExportSolidity(w) }))
+		fmt.Println("Solidity verifier exported to settlement_verifier.sol")
+		size, err := ioutilx.SizeOf(pk)
 		check(err)
-		dump(ccsName, ccs)
-		dump(pkName, pk)
-		dump(vkName, vk)
-		{
-			vkFile, err := os.Create(verifyName)
+		fmt.Printf("Proving key size (N = %d) (serialized): %s (%d bytes)\n", profile.N, ioutilx.Size(size), size)
+	}
+	// have to init to read ...
+	var (
+		ccs cs_bn254.R1CS
+		pk  groth16_bn254.ProvingKey
+	)
+	if (*prove && *remote == "") || *bench > 0 {
+		if *bundle {
+			f, err := os.Open(bundleName)
+			check(err)
+			m, err := artifacts.ReadBundle(f, map[string]io.ReaderFrom{ccsMember: &ccs, pkMember: &pk})
+			check(err)
+			f.Close()
+			if m.N != profile.N {
+				check(fmt.Errorf("bundle %s is for N = %d, profile %s has N = %d", bundleName, m.N, profile.Name, profile.N))
+			}
+			// the bundle knows how its circuit was compiled
+			check(circuit.CheckHintSet(m.Hints))
+			dataHash, err = circuit.ParseDataHash(m.DataHash)
+			check(err)
+			msgVersion, err = circuit.ParseMsgVersion(m.Msg)
+			check(err)
+			profile.Ordering, err = circuit.ParseOrdering(m.Ordering)
+			check(err)
+			bounds := circuit.Bounds{NonceBits: m.NonceBits, SizeBits: m.SizeBits, TotalBits: m.TotalBits, MinSize: m.MinSize}
+			profile, err = (circuit.Params{Bounds: bounds, SizeScale: m.SizeScale, Cosigner: m.Cosigner}).Apply(profile)
 			check(err)
-			defer vkFile.Close()
-			check(vk.ExportSolidity(vkFile))
-			fmt.Println("Solidity verifier exported to settlement_verifier.sol")
+			profile.DataHash, profile.Msg = dataHash, msgVersion
+			features, err := circuit.ParseFeatures(m.Features)
+			check(err)
+			profile = profile.WithFeatures(features)
+			check(verifier.CheckManifest(m, profile))
+		} else {
+			start := time.Now()
+			n := read(pkName, &pk)
+			took := time.Since(start)
+			fmt.Printf("Proving key loaded from %s: %s in %s (%s)\n", pkName, ioutilx.Size(n), took.Round(time.Millisecond), ioutilx.Rate(n, took))
+			read(ccsName, &ccs)
+			// the flags must describe the circuit the keys were set up for
+			if m, ok := readManifest(manifestName); ok {
+				check(verifier.CheckManifest(m, profile))
+			}
 		}
-		cw := &countingWriter{}
-		_, err = pk.WriteTo(cw)
+		check(circuit.CheckHints(&ccs))
+	}
+	var pol prover.Policy
+	if *policyFile != "" {
+		pol, err = prover.LoadRules(*policyFile)
 		check(err)
-		fmt.Printf("Proving key size (N = %d) (serialized): %.2f MB (%d bytes)\n", circuit.N, float64(cw.n)/1024/1024, cw.n)
+	}
+	memLimit := *memLimitMB << 20
+	if memLimit == 0 {
+		memLimit = memwatch.DefaultLimit()
+	}
+
+	if *bench > 0 {
+		budget := *pipelineMemMB << 20
+		if budget == 0 {
+			budget = memLimit
+		}
+		runBench(profile, pol, &ccs, &pk, *bench, prover.Pipeline{Depth: *pipelineDepth, MemBudget: budget}, dataHash, msgVersion)
 	}
 	if *prove {
-		// have to init to read ...
+		// 3) EdDSA keypair on BN254 twisted Edwards
+		recipient := big.NewInt(42)
 		var (
-			ccs cs_bn254.R1CS
-			pk  groth16_bn254.ProvingKey
+			priv signature.Signer
+			path keys.Path
 		)
-		read(pkName, &pk)
-		read(ccsName, &ccs)
-
-		// 3) EdDSA keypair on BN254 twisted Edwards
-		priv, err := nativeEddsa.New(te.BN254, rand.Reader)
-		if err != nil {
+		if *masterKey != "" && *wrappedKeyFile != "" {
+			check(fmt.Errorf("--master-key and --wrapped-key both name the signing key"))
+		}
+		if *masterKey != "" {
+			priv, path, err = derivedKey(*masterKey, *keyPath, recipient)
+			check(err)
+			fmt.Printf("Signing with the key at %s\n", path)
+		} else if *wrappedKeyFile != "" {
+			var s *hsm.Signer
+			s, path, err = wrappedKey(ctx, *wrappedKeyFile, time.Minute)
+			check(err)
+			defer s.Close()
+			priv = s
+			fmt.Printf("Signing with the wrapped key at %s\n", path)
+		} else if priv, err = nativeEddsa.New(te.BN254, rand.Reader); err != nil {
 			panic(err)
 		}
-		pub := priv.Public()
-		pkBytes := pub.Bytes()
+		var authorize signAuthorizer
+		if *keyPolicy != "" {
+			if path == nil {
+				check(fmt.Errorf("--key-policy needs --master-key or --wrapped-key: policies name keys by derivation path"))
+			}
+			keyFile := *masterKey
+			if keyFile == "" {
+				keyFile = *wrappedKeyFile
+			}
+			authorize, err = usageAuthorizer(*keyPolicy, keyFile, path)
+			check(err)
+		}
 
-		// 4) Build a valid witness
-		var w circuit.SettlementCircuit
+		if *multi > 0 {
+			if *remote == "" {
+				check(fmt.Errorf("--multi needs --remote"))
+			}
+			runMulti(ctx, &server.Client{URL: *remote, Cores: *cores}, profile, pol, authorize, priv, *multi, dataHash, msgVersion, multiName, diffName)
+			return
+		}
 
-		recipient := big.NewInt(42)
+		// 4) Build a valid witness
 		chainID := big.NewInt(1)
 		kOld := big.NewInt(0)
+		var nonceSrc chainsync.Source
+		var head uint64 // the state diff's block target
+		if *rpcURL != "" {
+			rpc, err := chainsync.NewRPC(*rpcURL, *contract)
+			check(err)
+			nonceSrc = rpc
+			head, err = rpc.BlockNumber(context.Background())
+			check(err)
+			kOld, err = nonceSrc.KOld(context.Background(), recipient)
+			check(err)
+			fmt.Printf("On-chain KOld for recipient %s: %s\n", recipient, kOld)
+		}
 
-		w.P.Recipient = recipient
-		w.P.ChainID = chainID
-		w.P.KOld = kOld
-
-		total := big.NewInt(0)
-
-		for i := 0; i < circuit.N; i++ {
-			size := big.NewInt(1)
-			nonce := big.NewInt(int64(i + 1)) // 1,2,...,N
-
-			w.Size[i] = new(big.Int).Set(size)
-			w.Nonce[i] = new(big.Int).Set(nonce)
-
-			// msg_i = MiMC(domainSep, Recipient, Size[i], Nonce[i], ChainID)
-			msgBytes := circuit.MimcMsg(recipient, size, nonce, chainID)
-
-			// sign with EdDSA using MiMC as internal hash
-			sigBytes, err := priv.Sign(msgBytes, bnMimc.NewMiMC())
-			if err != nil {
-				panic(err)
+		w, batch, err := newBatch(profile, pol, authorize, priv, recipient, chainID, kOld, *heartbeat, dataHash, msgVersion)
+		check(err)
+		if path != nil {
+			batch.KeyPath = path.String()
+		}
+		var note []byte
+		if profile.Features()&circuit.FeaturePrivate != 0 {
+			note, batch.Variant, err = privateRecipient(*viewKeyFile, recipient)
+			check(err)
+		}
+		if profile.Features()&circuit.FeaturePartial != 0 {
+			batch.Variant, err = partialRatio(*settleRatio)
+			check(err)
+		}
+		var state any // the chained opening after the batch, for --chain-state
+		if profile.Features()&circuit.FeatureAccumulator != 0 {
+			batch.Variant, state, err = accumulated(*chainState, w.P.TotalSettle.(*big.Int))
+			check(err)
+		}
+		if profile.Features()&circuit.FeatureEpochCap != 0 {
+			batch.Variant, state, err = epochCapped(*chainState, *epoch, *epochCap, w.P.TotalSettle.(*big.Int))
+			check(err)
+		}
+		if profile.Features()&circuit.FeatureRevocation != 0 {
+			batch.Variant, err = unrevoked(*revokedFile, batch.Pk)
+			check(err)
+		}
+		if profile.Features()&circuit.FeatureCrossChain != 0 {
+			if authorize != nil {
+				check(fmt.Errorf("--key-policy authorizes rows for the batch's chain, a cross-chain batch signs them for several"))
 			}
-
-			// assign signature into circuit witness
-			w.Sig[i].Assign(te.BN254, sigBytes)
-
-			total.Add(total, size)
+			batch.Variant, err = crossChain(priv, profile, w, batch)
+			check(err)
+		}
+		if profile.Features()&circuit.FeatureCosign != 0 {
+			batch.Variant, err = cosigned(*cosignerMaster, *cosignerPath, *keyPolicy, profile, batch)
+			check(err)
 		}
-
-		w.P.TotalSettle = total
-		w.P.M = big.NewInt(int64(circuit.N)) // last nonce
-		w.P.Pk.Assign(te.BN254, pkBytes)
 
 		// 5) Build full and public witnesses
-		witness, err := frontend.NewWitness(&w, ecc.BN254.ScalarField())
+		full, err := profile.Assign(w, batch.Variant)
+		check(err)
+		witness, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
 		if err != nil {
 			panic(err)
 		}
+		// what the proof shows, which a variant may have changed
+		pub, err := circuit.PublicFromWitness(witness)
+		check(err)
 
 		// 6) Prove
-		start := time.Now()
-		proof, err := groth16_bn254.Prove(&ccs, &pk, witness)
-		if err != nil {
-			panic(err)
+		if nonceSrc != nil {
+			// the chain may have moved while the batch was being built
+			check(chainsync.CheckFresh(context.Background(), nonceSrc, recipient, kOld))
 		}
-		proveTime := time.Since(start)
-		fmt.Printf("Settlement prover took %s\n", proveTime)
+		var (
+			proof *groth16_bn254.Proof
+			hdr   *artifacts.ProofHeader
+		)
+		if *remote != "" {
+			start := time.Now()
+			client := &server.Client{URL: *remote, Cores: *cores}
+			var sub submitter.Submission
+			if *remoteBatch {
+				sub, err = client.Prove(ctx, batch)
+			} else {
+				sub, err = client.ProveWitness(ctx, profile.Name, witness)
+			}
+			check(err)
+			fmt.Printf("Remote prover %s took %s\n", *remote, time.Since(start))
+			proof, hdr = sub.Proof, sub.Header
+			// the key host read the batch back out of the witness we sent
+			if id, err := circuit.BatchID(pub); err != nil || id != hdr.BatchID {
+				check(fmt.Errorf("%w: remote proof is for batch %x, ours is %x (%v)", errs.ErrArtifactMismatch, hdr.BatchID[:8], id[:8], err))
+			}
+			hdr.MaxAge = *maxAge
+		} else {
+			guard := memwatch.Guard{Limit: memLimit}
+			start := time.Now()
+			id, err := circuit.BatchID(pub)
+			check(err)
+			span.SetAttributes(tracing.BatchID(id))
+			var timings *prover.Timings
+			memStats, err := guard.Run("prove", func() (err error) {
+				proof, err = new(prover.Tracker).Prove(ctx, &ccs, &pk, witness, *cores, func(p prover.Progress) {
+					if p.Phase == prover.PhaseDone {
+						timings = p.Timings
+					}
+				})
+				return err
+			})
+			if err != nil {
+				fmt.Print(memStats)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			proveTime := time.Since(start)
+			fmt.Printf("Settlement prover took %s (%s)\n", proveTime, timings)
+
+			fmt.Print(report.NewEconomics(profile.N, proveTime, prover.Cores(*cores)))
+			fmt.Print(memStats)
 
-		reportEconomics(circuit.N, proveTime)
+			hdr = &artifacts.ProofHeader{
+				Version:   artifacts.ProofHeaderVersion,
+				Curve:     ecc.BN254,
+				Backend:   backend.GROTH16,
+				BatchID:   id,
+				Timestamp: time.Now(),
+				MaxAge:    *maxAge,
+				Features:  uint32(profile.Features()),
+			}
+			hdr.CircuitHash, err = artifacts.CircuitHash(&ccs)
+			check(err)
+		}
 
 		wit, err := witness.Public()
 		check(err)
-		pubHex, err := NewPublicInputsHexFromWitness(wit)
+		pubHex, err := artifacts.NewPublicInputsHexFromWitness(wit)
 		check(err)
 		dump(publicSolJsonName, &pubHex)
-		var pj ProofWrap
-		pj, _ = NewProofWrap(proof)
+		var pj artifacts.ProofWrap
+		pj, _ = artifacts.NewProofWrap(proof)
 		dump(proofJsonName, &pj)
-		dump(proofName, proof)
-		dump(publicName, &w.P)
+		dump(proofName, &artifacts.Proof{Header: hdr, Proof: proof})
+		dump(publicName, &pub)
+		if note != nil {
+			dump(noteName, bytes.NewReader(note))
+			fmt.Printf("Recipient opening sealed to the viewing key in %s (commitment 0x%x)\n", noteName, pub.Recipient)
+		}
+		if state != nil {
+			dump(*chainState, artifacts.WriterFunc(func(out io.Writer) error { return json.NewEncoder(out).Encode(state) }))
+			fmt.Printf("Accumulator opening after the batch in %s; the next batch chains on it\n", *chainState)
+		}
+		diff, err := statediff.New(profile, head, pub)
+		check(err)
+		dump(diffName, diff)
+		dump(batchName, artifacts.WriterFunc(func(out io.Writer) error { return json.NewEncoder(out).Encode(batch) }))
+		if *escrowArbiter != "" {
+			arbiter, err := escrow.ParsePublicKey(*escrowArbiter)
+			check(err)
+			sealed, err := escrow.Seal(arbiter, hdr.CircuitHash, witness)
+			check(err)
+			dump(escrowName, bytes.NewReader(sealed))
+			fmt.Printf("Witness sealed to the arbiter in %s (sha256 %s)\n", escrowName, escrow.Hash(sealed))
+		}
 	}
 	if *verify {
 		var (
@@ -340,28 +1093,40 @@ func main() {
 			publicWitness circuit.SettlementCircuitPublic
 			vk            groth16_bn254.VerifyingKey
 		)
-		read(proofName, &proof)
-		read(vkName, &vk)
+		framed := artifacts.Proof{Proof: &proof}
+		read(proofName, &framed)
+		if framed.Header != nil {
+			fmt.Printf("Proof header: %s\n", framed.Header)
+		}
+		if *bundle {
+			f, err := os.Open(bundleName)
+			check(err)
+			_, err = artifacts.ReadBundle(f, map[string]io.ReaderFrom{vkMember: &vk})
+			check(err)
+			f.Close()
+		} else {
+			read(vkName, &vk)
+		}
 		read(publicName, &publicWitness)
-		// create the circuit assignment
-		assignment := &circuit.SettlementCircuit{
-			P: publicWitness,
+		check(verifier.CheckBatchID(framed.Header, publicWitness))
+		if m, ok := readManifest(manifestName); ok && m.Features != "" {
+			features, err := circuit.ParseFeatures(m.Features)
+			check(err)
+			check(verifier.CheckFeatures(framed.Header, features))
 		}
-		pubWit, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
-		check(err)
 		// 7) Verify
 		start := time.Now()
-		if err := groth16.Verify(&proof, &vk, pubWit); err != nil {
+		if err := verifier.VerifyContext(ctx, &vk, &proof, publicWitness); err != nil {
 			panic(err)
 		}
 		fmt.Printf("Settlement verifier took %s\n", time.Since(start))
 		fmt.Println("Groth16 settlement proof verified")
 
-		cwProof := &countingWriter{}
-		if _, err := proof.WriteTo(cwProof); err != nil {
+		proofBytes, err := ioutilx.SizeOf(&proof)
+		if err != nil {
 			panic(err)
 		}
-		reportCompression(cwProof.n)
+		fmt.Print(report.NewCompression(profile.N, proofBytes))
 	}
 
 }
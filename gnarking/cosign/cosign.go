@@ -0,0 +1,165 @@
+// Package cosign collects the second signature of 2-of-2 batches
+// (circuit.Cosign, profile cosign-8): a co-signer, e.g. a risk engine
+// holding its own key, checks the operator's signed batch and signs every
+// row's message again. Its signatures travel as a separate file next to
+// the batch, so the operator's batch format does not change; Inputs turns
+// them into the batch's variant inputs for POST /prove.
+package cosign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+)
+
+const Version = 1
+
+// Signatures are a co-signer's signatures over a batch's rows, in row
+// order, hex like the batch's own.
+type Signatures struct {
+	Version int      `json:"version"`
+	Pk      string   `json:"pk"` // co-signer's 32-byte compressed EdDSA public key, hex
+	Sigs    []string `json:"sigs"`
+}
+
+// batch is req's assignment and the message of every row.
+func batch(profile circuit.Profile, req *server.ProveRequest) (*circuit.SettlementCircuit, [][]byte, error) {
+	c, err := server.BatchAssignment(profile, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	chainID := new(big.Int).SetUint64(req.ChainID)
+	msgs := make([][]byte, len(req.Rows))
+	for i, row := range req.Rows {
+		msgs[i] = circuit.MsgHash(profile.Msg, c.P.Recipient.(*big.Int), new(big.Int).SetUint64(row.Size), new(big.Int).SetUint64(row.Nonce), chainID)
+	}
+	return c, msgs, nil
+}
+
+// Sign co-signs req with priv, once every row carries the operator's valid
+// signature. A batch the operator signed with priv's own key is
+// errs.ErrPolicyRejected: one key signing twice is not 2-of-2.
+func Sign(priv *bnEddsa.PrivateKey, profile circuit.Profile, req *server.ProveRequest) (*Signatures, error) {
+	_, msgs, err := batch(profile, req)
+	if err != nil {
+		return nil, err
+	}
+	pk := hex.EncodeToString(priv.PublicKey.Bytes())
+	if samePk(pk, req.Pk) {
+		return nil, fmt.Errorf("%w: the batch is signed with the co-signer's own key", errs.ErrPolicyRejected)
+	}
+	opPk, err := hex.DecodeString(strings.TrimPrefix(req.Pk, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: pk hex: %w", errs.ErrInvalidInput, err)
+	}
+	s := &Signatures{Version: Version, Pk: pk, Sigs: make([]string, len(msgs))}
+	for i, msg := range msgs {
+		sig, _ := hex.DecodeString(strings.TrimPrefix(req.Rows[i].Sig, "0x"))
+		if err := (circuit.EdDSA{}).Verify(opPk, sig, msg); err != nil {
+			return nil, fmt.Errorf("%w: row %d: operator signature: %w", errs.ErrInvalidBatch, i, err)
+		}
+		cosig, err := circuit.EdDSA{}.Sign(priv, msg)
+		if err != nil {
+			return nil, err
+		}
+		s.Sigs[i] = hex.EncodeToString(cosig)
+	}
+	return s, nil
+}
+
+// Verify checks every co-signature against req's rows.
+func (s *Signatures) Verify(profile circuit.Profile, req *server.ProveRequest) error {
+	_, msgs, err := batch(profile, req)
+	if err != nil {
+		return err
+	}
+	_, err = s.check(msgs, req.Pk)
+	return err
+}
+
+// check verifies the signatures over msgs and returns the co-signer's key.
+func (s *Signatures) check(msgs [][]byte, opPk string) ([]byte, error) {
+	if len(s.Sigs) != len(msgs) {
+		return nil, fmt.Errorf("%w: %d co-signatures for %d rows", errs.ErrInvalidBatch, len(s.Sigs), len(msgs))
+	}
+	if samePk(s.Pk, opPk) {
+		return nil, fmt.Errorf("%w: co-signer and operator share a key", errs.ErrPolicyRejected)
+	}
+	pk, err := hex.DecodeString(strings.TrimPrefix(s.Pk, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: co-signer pk hex: %w", errs.ErrInvalidInput, err)
+	}
+	if _, err := new(bnEddsa.PublicKey).SetBytes(pk); err != nil {
+		return nil, fmt.Errorf("%w: co-signer pk: %w", errs.ErrInvalidInput, err)
+	}
+	for i, msg := range msgs {
+		sig, err := hex.DecodeString(strings.TrimPrefix(s.Sigs[i], "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d co-signature hex: %w", errs.ErrInvalidInput, i, err)
+		}
+		if err := (circuit.EdDSA{}).Verify(pk, sig, msg); err != nil {
+			return nil, fmt.Errorf("%w: row %d: co-signature: %w", errs.ErrInvalidBatch, i, err)
+		}
+	}
+	return pk, nil
+}
+
+// Inputs are req's variant inputs for a proof of profile, a Cosign
+// profile: s, checked against req's rows and the profile's co-signer.
+func Inputs(profile circuit.Profile, req *server.ProveRequest, s *Signatures) (json.RawMessage, error) {
+	co := profile.Cosigner()
+	if co == "" {
+		return nil, fmt.Errorf("%w: profile %s has no co-signer", errs.ErrInvalidInput, profile.Name)
+	}
+	if !samePk(s.Pk, co) {
+		return nil, fmt.Errorf("%w: co-signed by %s, profile %s is set up for %s", errs.ErrPolicyRejected, s.Pk, profile.Name, co)
+	}
+	_, msgs, err := batch(profile, req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.check(msgs, req.Pk); err != nil {
+		return nil, err
+	}
+	return json.Marshal(circuit.CosignInputs{Sigs: s.Sigs})
+}
+
+func samePk(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "0x"), strings.TrimPrefix(b, "0x"))
+}
+
+var _ io.WriterTo = (*Signatures)(nil)
+var _ io.ReaderFrom = (*Signatures)(nil)
+
+func (s *Signatures) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (s *Signatures) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(len(data))
+	if err := json.Unmarshal(data, s); err != nil {
+		return n, fmt.Errorf("%w: co-signatures: %w", errs.ErrInvalidInput, err)
+	}
+	if s.Version != Version {
+		return n, fmt.Errorf("%w: unsupported co-signatures version %d", errs.ErrArtifactMismatch, s.Version)
+	}
+	return n, nil
+}
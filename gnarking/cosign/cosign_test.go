@@ -0,0 +1,105 @@
+package cosign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/keys"
+	"gnarking/server"
+)
+
+func key(t *testing.T, b byte) *bnEddsa.PrivateKey {
+	t.Helper()
+	priv, err := keys.Derive(keys.Seed{b}, keys.Path{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestCosign(t *testing.T) {
+	profile, err := circuit.LookupProfile("8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator, risk := key(t, 1), key(t, 2)
+	req := &server.ProveRequest{Recipient: "2a", ChainID: 1, Pk: hex.EncodeToString(operator.PublicKey.Bytes())}
+	for i := range profile.N {
+		size, nonce := uint64(10*i+1), uint64(i+1)
+		msg := circuit.MsgHash(profile.Msg, big.NewInt(42), new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(1))
+		sig, err := circuit.EdDSA{}.Sign(operator, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Rows = append(req.Rows, server.ProveRow{Size: size, Nonce: nonce, Sig: hex.EncodeToString(sig)})
+	}
+
+	s, err := Sign(risk, profile, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	s.WriteTo(&buf)
+	var read Signatures
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := read.Verify(profile, req); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := Inputs(profile, req, &read); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("inputs for profile %s: %v, want ErrInvalidInput", profile.Name, err)
+	}
+	// the batch proven through the 2-of-2 profile set up for risk's key
+	two, err := circuit.LookupProfile("cosign-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if two, err = (circuit.Params{Cosigner: s.Pk}).Apply(two); err != nil {
+		t.Fatal(err)
+	}
+	extra, err := Inputs(two, req, &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := server.BatchAssignment(two, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := two.Assign(base, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := test.IsSolved(two.Define(), c, ecc.BN254.ScalarField()); err != nil {
+		t.Fatalf("assignment does not solve: %v", err)
+	}
+	other, err := (circuit.Params{Cosigner: hex.EncodeToString(key(t, 3).PublicKey.Bytes())}).Apply(two)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inputs(other, req, &read); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Errorf("co-signatures of another co-signer: %v, want ErrPolicyRejected", err)
+	}
+
+	if _, err := Sign(operator, profile, req); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Errorf("co-signing with the operator's key: %v, want ErrPolicyRejected", err)
+	}
+	forged := *req
+	forged.Rows = append([]server.ProveRow(nil), req.Rows...)
+	forged.Rows[3].Size++
+	if _, err := Sign(risk, profile, &forged); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("co-signing a row the operator did not sign: %v, want ErrInvalidBatch", err)
+	}
+	if err := read.Verify(profile, &forged); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("co-signatures of another batch: %v, want ErrInvalidBatch", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Package crash turns panics at library boundaries into errors. gnark
+// trusts what it is given and can panic deep inside solving or proving on a
+// malformed witness or key; Guard recovers, writes a diagnostics Bundle
+// (what was being done, a batch summary, the stack and the hashes of the
+// artifacts involved) to the crash directory for support, and returns an
+// *Error naming it. Only panics on the guarded goroutine are recovered:
+// one on a goroutine gnark starts itself (the MSM and FFT workers) still
+// ends the process.
+//
+// Bundles go to the directory set with SetDir, DDM_CRASH_DIR by default;
+// none are written when it is empty.
+package crash
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/artifacts"
+	"gnarking/ioutilx"
+)
+
+// Env names the variable the crash directory defaults to.
+const Env = "DDM_CRASH_DIR"
+
+var dir atomic.Pointer[string]
+
+func init() { SetDir(os.Getenv(Env)) }
+
+// SetDir sets where bundles are written; "" writes none.
+func SetDir(d string) { dir.Store(&d) }
+
+// Dir is where bundles are written, "" when none are.
+func Dir() string { return *dir.Load() }
+
+// Report is what the caller of Guard knows about the operation, gathered
+// only after a panic.
+type Report struct {
+	Batch     *Batch
+	Artifacts []Artifact
+}
+
+// Artifact is one input of the operation, hashed into the bundle.
+type Artifact struct {
+	Name string
+	A    io.WriterTo
+}
+
+// Batch summarizes a witness without its secret part.
+type Batch struct {
+	Public   []string `json:"public,omitempty"` // 0x-hex, in verifier order
+	NbPublic int      `json:"nb_public"`
+	NbSecret int      `json:"nb_secret"`
+	Error    string   `json:"error,omitempty"` // why Public is missing
+}
+
+// Bundle is the diagnostics file of one recovered panic.
+type Bundle struct {
+	Time      time.Time         `json:"time"`
+	Op        string            `json:"op"`
+	Panic     string            `json:"panic"`
+	Stack     string            `json:"stack"`
+	Batch     *Batch            `json:"batch,omitempty"`
+	Artifacts map[string]string `json:"artifacts,omitempty"` // name → hex SHA-256, or the error hashing it
+	Go        string            `json:"go"`
+	Platform  string            `json:"platform"`
+	Deps      map[string]string `json:"deps,omitempty"` // module → version, from the build info
+}
+
+// Error is a recovered panic. It wraps no errs sentinel: to callers it is
+// an internal failure.
+type Error struct {
+	Op     string
+	Value  any
+	Bundle string // path of the bundle, "" when none was written
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s panicked: %v", e.Op, e.Value)
+	if e.Bundle != "" {
+		msg += " (diagnostics in " + e.Bundle + ")"
+	}
+	return msg
+}
+
+// Guard recovers a panic of the function that defers it, which must return
+// its error as a named result err:
+//
+//	defer crash.Guard("prove", func() crash.Report { ... }, &err)
+//
+// *err becomes an *Error; report, which may be nil, is called only then. A
+// bundle that cannot be written is noted on stderr, the panic still becomes
+// the error.
+func Guard(op string, report func() Report, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	b := Bundle{
+		Time:     time.Now().UTC(),
+		Op:       op,
+		Panic:    fmt.Sprint(p),
+		Stack:    string(debug.Stack()),
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.Deps = make(map[string]string, len(info.Deps))
+		for _, d := range info.Deps {
+			b.Deps[d.Path] = d.Version
+		}
+	}
+	if report != nil {
+		r := gather(report)
+		b.Batch = r.Batch
+		if len(r.Artifacts) > 0 {
+			b.Artifacts = make(map[string]string, len(r.Artifacts))
+			for _, a := range r.Artifacts {
+				b.Artifacts[a.Name] = hash(a.A)
+			}
+		}
+	}
+
+	e := &Error{Op: op, Value: p}
+	if name, werr := b.write(Dir()); werr != nil {
+		fmt.Fprintf(os.Stderr, "crash: %s: writing diagnostics: %v\n", op, werr)
+	} else {
+		e.Bundle = name
+	}
+	*err = e
+}
+
+// gather calls report; the state that made the operation panic may make
+// it panic too.
+func gather(report func() Report) (r Report) {
+	defer func() {
+		if p := recover(); p != nil {
+			r = Report{Batch: &Batch{Error: fmt.Sprintf("report panicked: %v", p)}}
+		}
+	}()
+	return report()
+}
+
+func hash(a io.WriterTo) (sum string) {
+	defer func() {
+		if p := recover(); p != nil {
+			sum = fmt.Sprintf("(panicked: %v)", p)
+		}
+	}()
+	_, h, err := ioutilx.HashOf(a)
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// Summarize is the public part of w and its sizes.
+func Summarize(w witness.Witness) *Batch {
+	b := new(Batch)
+	if w == nil {
+		b.Error = "no witness"
+		return b
+	}
+	pub, err := w.Public()
+	if err != nil {
+		b.Error = err.Error()
+		return b
+	}
+	vec, ok := w.Vector().(fr.Vector)
+	pubVec, pok := pub.Vector().(fr.Vector)
+	if !ok || !pok {
+		b.Error = fmt.Sprintf("witness vector %T", w.Vector())
+		return b
+	}
+	b.NbPublic, b.NbSecret = len(pubVec), len(vec)-len(pubVec)
+	for i := range pubVec {
+		b.Public = append(b.Public, fmt.Sprintf("0x%x", pubVec[i].BigInt(new(big.Int))))
+	}
+	return b
+}
+
+// write writes b to dir as crash_<time>_<op>.json and returns its path.
+func (b *Bundle) write(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("crash_%s_%s.json", b.Time.Format("20060102T150405.000000000"), strings.ReplaceAll(b.Op, "/", "-")))
+	return name, artifacts.WriteFile(name, artifacts.WriterFunc(func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(b)
+	}), false)
+}
@@ -0,0 +1,64 @@
+package crash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	dir := t.TempDir()
+	SetDir(dir)
+	defer SetDir("")
+
+	data := bytes.NewBufferString("ccs bytes")
+	sum := sha256.Sum256(data.Bytes())
+	op := func(fail bool) (err error) {
+		defer Guard("test/op", func() Report {
+			return Report{Batch: &Batch{NbPublic: 1}, Artifacts: []Artifact{{Name: "ccs", A: bytes.NewBuffer(data.Bytes())}}}
+		}, &err)
+		if fail {
+			var m map[string]int
+			m["x"] = 1 // nil map write
+		}
+		return errors.New("returned")
+	}
+
+	if err := op(false); err == nil || err.Error() != "returned" {
+		t.Fatalf("no panic: err = %v", err)
+	}
+	err := op(true)
+	var ce *Error
+	if !errors.As(err, &ce) || ce.Op != "test/op" || !strings.Contains(err.Error(), ce.Bundle) {
+		t.Fatalf("err = %v", err)
+	}
+	raw, err := os.ReadFile(ce.Bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Bundle
+	if err := json.Unmarshal(raw, &b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.Panic, "nil map") || !strings.Contains(b.Stack, "TestGuard") || b.Go == "" {
+		t.Fatalf("bundle %+v", b)
+	}
+	if b.Batch == nil || b.Batch.NbPublic != 1 || b.Artifacts["ccs"] != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bundle batch %+v, artifacts %v", b.Batch, b.Artifacts)
+	}
+
+	// no directory: the error alone; a report that panics too is noted
+	SetDir("")
+	err = func() (err error) {
+		defer Guard("test/nodir", func() Report { panic("again") }, &err)
+		panic("first")
+	}()
+	if !errors.As(err, &ce) || ce.Bundle != "" || ce.Value != "first" {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Package disclose proves a single fact about a settled batch to a third
+// party: "batch BatchID paid recipient R at least X", without the batch's
+// total or any other public input.
+//
+// The BatchID is the sha256 of the canonical JSON of the settlement public
+// inputs (circuit.BatchIDJSON). Its keys sort recipient and total_settle
+// last, so the circuit only hashes the JSON's tail: it resumes sha256 from
+// the midstate after the prefix's whole 64-byte blocks (a witness, like the
+// prefix bytes past them), parses the tail as
+//
+//	"recipient":"0x<hex>","total_settle":<decimal>}
+//
+// and checks the final hash against BatchID. The prefix stays private. Its
+// soundness rests on SHA-256's compression function: a prover would need
+// a free-start preimage of the batch's ID, not just of its JSON.
+package disclose
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/permutation/sha2"
+	"github.com/consensys/gnark/std/selector"
+)
+
+const (
+	// MaxRemainder is the most prefix bytes past its whole blocks.
+	MaxRemainder = 63
+	// MaxSuffix is the longest tail: both literals, a 32-byte recipient
+	// in hex and a 77-digit total.
+	MaxSuffix = len(recipientKey) + 64 + len(totalKey) + 77 + len(closing)
+	// TailBlocks is how many sha256 blocks the remainder, suffix and
+	// padding span at most.
+	TailBlocks = (MaxRemainder + MaxSuffix + 9 + 63) / 64
+)
+
+const (
+	recipientKey = `"recipient":"0x`
+	totalKey     = `","total_settle":`
+	closing      = `}`
+)
+
+// Public is what a disclosure reveals. BatchID is split in its high and low
+// 128 bits, big-endian.
+type Public struct {
+	BatchIDHi frontend.Variable `gnark:",public"`
+	BatchIDLo frontend.Variable `gnark:",public"`
+	Recipient frontend.Variable `gnark:",public"`
+	MinTotal  frontend.Variable `gnark:",public"`
+}
+
+// Circuit proves that the JSON whose sha256 is BatchID ends in Recipient
+// and a TotalSettle of at least MinTotal.
+type Circuit struct {
+	P Public
+
+	Midstate [8]frontend.Variable // sha256 state after the prefix's whole blocks
+	Blocks   frontend.Variable    // how many that is
+	RemLen   frontend.Variable
+	Rem      [MaxRemainder]frontend.Variable // prefix bytes past Blocks, zero after RemLen
+
+	// Suffix is the tail from recipientKey on, followed by the 0x80 that
+	// starts the padding and zeros. Digit is the value of each hex or
+	// decimal digit in it, zero elsewhere.
+	Suffix [MaxSuffix + 1]frontend.Variable
+	Digit  [MaxSuffix]frontend.Variable
+	HexLen frontend.Variable // recipient digits
+	DecLen frontend.Variable // total digits
+	Final  frontend.Variable // tail blocks hashed, 1 to TailBlocks
+}
+
+func (c *Circuit) Define(api frontend.API) error {
+	uapi, err := uints.New[uints.U32](api)
+	if err != nil {
+		return err
+	}
+
+	// 1. the suffix is recipientKey, HexLen hex digits, totalKey, DecLen
+	// decimal digits, closing, 0x80: its layout, by where each part starts
+	hexEnd := api.Add(len(recipientKey), c.HexLen)
+	decStart := api.Add(hexEnd, len(totalKey))
+	decEnd := api.Add(decStart, c.DecLen)
+	end := api.Add(decEnd, len(closing))
+	for k := range len(recipientKey) {
+		api.AssertIsEqual(c.Suffix[k], recipientKey[k])
+	}
+	for k := range len(totalKey) {
+		api.AssertIsEqual(selector.Mux(api, api.Add(hexEnd, k), c.Suffix[:]...), totalKey[k])
+	}
+	for k := range len(closing) {
+		api.AssertIsEqual(selector.Mux(api, api.Add(decEnd, k), c.Suffix[:]...), closing[k])
+	}
+	afterHex := atOrAfter(api, hexEnd, len(c.Suffix))
+	afterDec := atOrAfter(api, decEnd, len(c.Suffix))
+	afterEnd := atOrAfter(api, end, len(c.Suffix))
+	api.AssertIsEqual(afterEnd[MaxSuffix], 1) // room for the 0x80
+
+	// 2. digits: c == '0' + v, or 'a' + v - 10 in the recipient's hex;
+	// their values read big-endian are Recipient and the total
+	recipient, total := frontend.Variable(0), frontend.Variable(0)
+	for j := range MaxSuffix {
+		inHex := frontend.Variable(0)
+		if j >= len(recipientKey) {
+			inHex = api.Sub(1, afterHex[j])
+		}
+		inDec := api.Sub(atOrAfter1(afterHex, j-len(totalKey)), afterDec[j])
+		b := api.ToBinary(c.Digit[j], 4)
+		letter := api.Mul(b[3], api.Or(b[2], b[1])) // v >= 10
+		want := api.Add(c.Digit[j], '0', api.Mul(letter, 'a'-'0'-10))
+		api.AssertIsEqual(api.Mul(api.Add(inHex, inDec), api.Sub(c.Suffix[j], want)), 0)
+		api.AssertIsEqual(api.Mul(inDec, letter), 0)
+		recipient = api.Add(recipient, api.Mul(inHex, api.Add(api.Mul(recipient, 15), c.Digit[j])))
+		total = api.Add(total, api.Mul(inDec, api.Add(api.Mul(total, 9), c.Digit[j])))
+	}
+	api.AssertIsEqual(recipient, c.P.Recipient)
+	api.AssertIsLessOrEqual(c.P.MinTotal, total)
+
+	// past the closing brace: 0x80, then zeros
+	prevAfterEnd := frontend.Variable(0)
+	for j := range c.Suffix {
+		api.AssertIsEqual(api.Mul(afterEnd[j], c.Suffix[j]), api.Mul(api.Sub(afterEnd[j], prevAfterEnd), 0x80))
+		prevAfterEnd = afterEnd[j]
+	}
+
+	// 3. the tail: the remainder, the suffix shifted right by RemLen, and
+	// the message length in bits at the end of the Final block
+	afterRem := atOrAfter(api, c.RemLen, MaxRemainder+1)
+	for i := range MaxRemainder {
+		api.AssertIsEqual(api.Mul(afterRem[i], c.Rem[i]), 0)
+	}
+	api.AssertIsEqual(afterRem[MaxRemainder], 1) // RemLen <= MaxRemainder
+	tail := make([]frontend.Variable, 64*TailBlocks)
+	for i := range tail {
+		tail[i] = 0
+		if i < len(c.Suffix) {
+			tail[i] = c.Suffix[i]
+		}
+	}
+	for bit, set := range api.ToBinary(c.RemLen, 6) {
+		shift := 1 << bit
+		shifted := make([]frontend.Variable, len(tail))
+		for i := range tail {
+			if i < shift {
+				shifted[i] = api.Select(set, 0, tail[i])
+			} else {
+				shifted[i] = api.Select(set, tail[i-shift], tail[i])
+			}
+		}
+		tail = shifted
+	}
+	for i := range MaxRemainder {
+		tail[i] = api.Add(tail[i], c.Rem[i])
+	}
+	// the padding fits the Final block and would not fit the one before
+	tailLen := api.Add(c.RemLen, end)
+	api.ToBinary(api.Sub(api.Mul(c.Final, 64), tailLen, 9), 6)
+	api.ToBinary(api.Sub(c.Final, 1), 2)
+	bits := api.Add(api.Mul(c.Blocks, 512), api.Mul(tailLen, 8))
+	api.ToBinary(c.Blocks, 16)
+	lenBits := api.ToBinary(bits, 64)
+	final := make([]frontend.Variable, TailBlocks)
+	for b := range TailBlocks {
+		final[b] = api.IsZero(api.Sub(c.Final, b+1))
+		for k := range 8 {
+			// big-endian: byte k holds bits 63-8k .. 56-8k
+			byteVal := api.FromBinary(lenBits[56-8*k : 64-8*k]...)
+			i := 64*b + 56 + k
+			tail[i] = api.Add(tail[i], api.Mul(final[b], byteVal))
+		}
+	}
+
+	// 4. resume sha256 and pick the state after the Final block
+	var state [8]uints.U32
+	for w := range state {
+		state[w] = uapi.ValueOf(c.Midstate[w])
+	}
+	words := make([][]frontend.Variable, 8)
+	for b := range TailBlocks {
+		var block [64]uints.U8
+		for i := range block {
+			block[i] = uapi.ByteValueOf(tail[64*b+i])
+		}
+		state = sha2.Permute(uapi, state, block)
+		for w := range state {
+			words[w] = append(words[w], uapi.ToValue(state[w]))
+		}
+	}
+	hi, lo := frontend.Variable(0), frontend.Variable(0)
+	for w := range 8 {
+		v := selector.Mux(api, api.Sub(c.Final, 1), words[w]...)
+		if w < 4 {
+			hi = api.Add(api.Mul(hi, 1<<32), v)
+		} else {
+			lo = api.Add(api.Mul(lo, 1<<32), v)
+		}
+	}
+	api.AssertIsEqual(hi, c.P.BatchIDHi)
+	api.AssertIsEqual(lo, c.P.BatchIDLo)
+	return nil
+}
+
+// atOrAfter is, for each position j < n, 1 when j >= x and 0 before; all
+// zero when x is not below n.
+func atOrAfter(api frontend.API, x frontend.Variable, n int) []frontend.Variable {
+	flags := make([]frontend.Variable, n)
+	acc := frontend.Variable(0)
+	for j := range n {
+		acc = api.Add(acc, api.IsZero(api.Sub(x, j)))
+		flags[j] = acc
+	}
+	return flags
+}
+
+// atOrAfter1 is flags[j], 0 for j before the first.
+func atOrAfter1(flags []frontend.Variable, j int) frontend.Variable {
+	if j < 0 {
+		return 0
+	}
+	return flags[j]
+}
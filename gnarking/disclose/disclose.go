@@ -0,0 +1,214 @@
+package disclose
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/canon"
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// Compile compiles the disclosure circuit. It does not depend on the
+// settlement profile: one setup serves every batch.
+func Compile() (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, new(Circuit))
+}
+
+// Assign is the witness disclosing that the batch of pub paid at least min
+// to its recipient. A min above the batch's total is refused: there is no
+// proof of it.
+func Assign(pub circuit.SettlementCircuitPublic, min *big.Int) (*Circuit, error) {
+	js, err := circuit.BatchIDJSON(pub)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := canon.Marshal(json.RawMessage(js))
+	if err != nil {
+		return nil, err
+	}
+	at := bytes.LastIndex(msg, []byte(recipientKey))
+	if at < 0 {
+		return nil, fmt.Errorf("%w: public inputs JSON has no %s", errs.ErrInvalidInput, recipientKey)
+	}
+	suffix := msg[at:]
+	hexDigits, rest, ok := strings.Cut(string(suffix[len(recipientKey):]), totalKey)
+	decDigits, ok2 := strings.CutSuffix(rest, closing)
+	if !ok || !ok2 || len(suffix) > MaxSuffix {
+		return nil, fmt.Errorf("%w: public inputs JSON does not end in recipient and total_settle", errs.ErrInvalidInput)
+	}
+	recipient, ok := new(big.Int).SetString("0"+hexDigits, 16)
+	if !ok {
+		return nil, fmt.Errorf("%w: recipient %q is not hex", errs.ErrInvalidInput, hexDigits)
+	}
+	total, _ := new(big.Int).SetString(decDigits, 10)
+	if total == nil || min.Sign() < 0 || min.Cmp(total) > 0 {
+		return nil, fmt.Errorf("%w: batch settled %s, cannot disclose at least %s", errs.ErrInvalidInput, decDigits, min)
+	}
+
+	blocks, rem := at/64, msg[at/64*64:at]
+	h := sha256.New()
+	h.Write(msg[:blocks*64])
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(msg)
+	c := &Circuit{
+		P: Public{
+			BatchIDHi: new(big.Int).SetBytes(id[:16]),
+			BatchIDLo: new(big.Int).SetBytes(id[16:]),
+			Recipient: recipient,
+			MinTotal:  min,
+		},
+		Blocks: blocks,
+		RemLen: len(rem),
+		HexLen: len(hexDigits),
+		DecLen: len(decDigits),
+		Final:  (len(rem) + len(suffix) + 9 + 63) / 64,
+	}
+	// the marshaled state is a 4-byte magic, then the eight words
+	for w := range c.Midstate {
+		c.Midstate[w] = binary.BigEndian.Uint32(state[4+4*w:])
+	}
+	for i := range c.Rem {
+		c.Rem[i] = 0
+		if i < len(rem) {
+			c.Rem[i] = rem[i]
+		}
+	}
+	for j := range c.Suffix {
+		switch {
+		case j < len(suffix):
+			c.Suffix[j] = suffix[j]
+		case j == len(suffix):
+			c.Suffix[j] = 0x80
+		default:
+			c.Suffix[j] = 0
+		}
+	}
+	hexStart, decStart := len(recipientKey), len(recipientKey)+len(hexDigits)+len(totalKey)
+	for j := range c.Digit {
+		c.Digit[j] = 0
+		switch {
+		case j >= hexStart && j < hexStart+len(hexDigits):
+			v, _ := hex.DecodeString("0" + string(suffix[j]))
+			c.Digit[j] = v[0]
+		case j >= decStart && j < decStart+len(decDigits):
+			c.Digit[j] = suffix[j] - '0'
+		}
+	}
+	return c, nil
+}
+
+// Disclosure is a disclosure proof and the facts it proves, what a
+// counterparty is handed.
+type Disclosure struct {
+	BatchID   string `json:"batch_id"`  // hex, as circuit.BatchID
+	Recipient string `json:"recipient"` // 0x-hex, as in the public inputs JSON
+	MinTotal  string `json:"min_total"` // decimal, in the batch's size units
+	Proof     string `json:"proof"`     // hex, gnark's groth16 encoding
+}
+
+// Prove proves that the batch of pub paid at least min to its recipient.
+func Prove(ccs constraint.ConstraintSystem, pk groth16.ProvingKey, pub circuit.SettlementCircuitPublic, min *big.Int) (*Disclosure, error) {
+	c, err := Assign(pub, min)
+	if err != nil {
+		return nil, err
+	}
+	w, err := frontend.NewWitness(c, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Disclosure{
+		BatchID:   hex.EncodeToString(id[:]),
+		Recipient: "0x" + c.P.Recipient.(*big.Int).Text(16),
+		MinTotal:  min.String(),
+		Proof:     hex.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Verify checks d against the disclosure circuit's vk. Failure wraps
+// errs.ErrVerificationFailed, malformed fields errs.ErrInvalidInput.
+func Verify(vk groth16.VerifyingKey, d *Disclosure) error {
+	w, err := d.publicWitness()
+	if err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(d.Proof)
+	if err != nil {
+		return fmt.Errorf("%w: proof hex: %w", errs.ErrInvalidInput, err)
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(b)); err != nil {
+		return fmt.Errorf("%w: proof: %w", errs.ErrInvalidInput, err)
+	}
+	if err := groth16.Verify(proof, vk, w); err != nil {
+		return fmt.Errorf("%w: disclosure of batch %s: %w", errs.ErrVerificationFailed, d.BatchID, err)
+	}
+	return nil
+}
+
+func (d *Disclosure) publicWitness() (witness.Witness, error) {
+	id, err := hex.DecodeString(strings.TrimPrefix(d.BatchID, "0x"))
+	if err != nil || len(id) != 32 {
+		return nil, fmt.Errorf("%w: batch_id %q is not 32 bytes of hex", errs.ErrInvalidInput, d.BatchID)
+	}
+	// FieldJSON refuses values past the field, which would wrap
+	var recipient, min circuit.FieldJSON
+	if err := recipient.UnmarshalJSON([]byte(strconv.Quote(d.Recipient))); err != nil {
+		return nil, fmt.Errorf("recipient: %w", err)
+	}
+	if !strings.HasPrefix(d.Recipient, "0x") || strings.HasPrefix(d.MinTotal, "0x") {
+		return nil, fmt.Errorf("%w: recipient is 0x-hex, min_total decimal", errs.ErrInvalidInput)
+	}
+	if err := min.UnmarshalJSON([]byte(strconv.Quote(d.MinTotal))); err != nil {
+		return nil, fmt.Errorf("min_total: %w", err)
+	}
+	return frontend.NewWitness(&Circuit{P: Public{
+		BatchIDHi: new(big.Int).SetBytes(id[:16]),
+		BatchIDLo: new(big.Int).SetBytes(id[16:]),
+		Recipient: (*big.Int)(&recipient),
+		MinTotal:  (*big.Int)(&min),
+	}}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+}
+
+var _ io.WriterTo = (*Disclosure)(nil)
+
+// WriteTo writes d as indented JSON.
+func (d *Disclosure) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
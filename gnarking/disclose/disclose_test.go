@@ -0,0 +1,104 @@
+package disclose
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/test"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func testPublic(recipient, total int64) circuit.SettlementCircuitPublic {
+	pub := circuit.SettlementCircuitPublic{
+		Recipient:     big.NewInt(recipient),
+		KOld:          big.NewInt(0),
+		M:             big.NewInt(8),
+		TotalSettle:   big.NewInt(total),
+		ChainID:       big.NewInt(1),
+		BatchDataRoot: new(big.Int).Lsh(big.NewInt(3), 240),
+	}
+	pub.Pk.A.X, pub.Pk.A.Y = big.NewInt(1), big.NewInt(2)
+	return pub
+}
+
+func TestAssign(t *testing.T) {
+	// short and long recipients move the tail across block boundaries
+	for _, pub := range []circuit.SettlementCircuitPublic{
+		testPublic(42, 1_000_000),
+		testPublic(0x7fffffffffffffff, 5),
+	} {
+		c, err := Assign(pub, big.NewInt(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.IsSolved(new(Circuit), c, ecc.BN254.ScalarField()); err != nil {
+			t.Fatalf("recipient %v: %v", pub.Recipient, err)
+		}
+		// claiming another recipient does not solve
+		c.P.Recipient = big.NewInt(43)
+		if test.IsSolved(new(Circuit), c, ecc.BN254.ScalarField()) == nil {
+			t.Fatal("other recipient disclosed")
+		}
+	}
+
+	// nor a minimum above the total
+	pub := testPublic(42, 100)
+	if _, err := Assign(pub, big.NewInt(101)); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("min above total: %v", err)
+	}
+	c, _ := Assign(pub, big.NewInt(100))
+	c.P.MinTotal = big.NewInt(101)
+	if test.IsSolved(new(Circuit), c, ecc.BN254.ScalarField()) == nil {
+		t.Fatal("min above total disclosed")
+	}
+}
+
+func TestProveVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("groth16 setup")
+	}
+	ccs, err := Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := testPublic(42, 1_000_000)
+	d, err := Prove(ccs, pk, pub, big.NewInt(500_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := circuit.BatchID(pub)
+	if d.Recipient != "0x2a" || d.BatchID != hex.EncodeToString(id[:]) {
+		t.Fatalf("disclosure %+v", d)
+	}
+	if err := Verify(vk, d); err != nil {
+		t.Fatal(err)
+	}
+	for _, tamper := range []func(*Disclosure){
+		func(d *Disclosure) { d.MinTotal = "500001" },
+		func(d *Disclosure) { d.Recipient = "0x2b" },
+		func(d *Disclosure) { d.BatchID = strings.Repeat("01", 32) },
+	} {
+		bad := *d
+		tamper(&bad)
+		if err := Verify(vk, &bad); !errors.Is(err, errs.ErrVerificationFailed) {
+			t.Fatalf("tampered %+v: %v", bad, err)
+		}
+	}
+	// past the field, the minimum would wrap to a small one
+	bad := *d
+	bad.MinTotal = ecc.BN254.ScalarField().String()
+	if err := Verify(vk, &bad); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("min_total past the field: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package errs is the error taxonomy of the public API. Library errors wrap
+// one of the sentinels below with %w, so callers match them with errors.Is
+// and servers map them to a stable Code and status with CodeOf/HTTPStatus.
+package errs
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error class. Codes are part of the API:
+// add new ones, never rename.
+type Code string
+
+const (
+	CodeOK                 Code = "ok"
+	CodeInvalidInput       Code = "invalid_input"
+	CodeInvalidBatch       Code = "invalid_batch"
+	CodeArtifactMismatch   Code = "artifact_mismatch"
+	CodeVerificationFailed Code = "verification_failed"
+	CodeProverTimeout      Code = "prover_timeout"
+	CodeStaleNonce         Code = "stale_nonce"
+	CodeMemoryLimit        Code = "memory_limit"
+	CodeUnavailable        Code = "unavailable"
+	CodePolicyRejected     Code = "policy_rejected"
+	CodeProofExpired       Code = "proof_expired"
+	CodeDuplicate          Code = "duplicate"
+	CodeNotFound           Code = "not_found"
+	CodeInternal           Code = "internal"
+)
+
+// Error is a sentinel of one Code.
+type Error struct {
+	Code Code
+	msg  string
+}
+
+func (e *Error) Error() string { return e.msg }
+
+var (
+	// ErrInvalidInput: malformed request data (hex, JSON, lengths).
+	ErrInvalidInput = &Error{CodeInvalidInput, "invalid input"}
+	// ErrInvalidBatch: well-formed rows that do not make a settleable batch.
+	ErrInvalidBatch = &Error{CodeInvalidBatch, "invalid batch"}
+	// ErrArtifactMismatch: keys, circuits, bundles or proofs that do not
+	// belong together or fail their integrity checks.
+	ErrArtifactMismatch = &Error{CodeArtifactMismatch, "artifact mismatch"}
+	// ErrVerificationFailed: the proof does not verify for the public inputs.
+	ErrVerificationFailed = &Error{CodeVerificationFailed, "verification failed"}
+	// ErrProverTimeout: proving did not finish within its deadline.
+	ErrProverTimeout = &Error{CodeProverTimeout, "prover timeout"}
+	// ErrStaleNonce: the batch was built against outdated on-chain KOld.
+	ErrStaleNonce = &Error{CodeStaleNonce, "stale nonce state"}
+	// ErrMemoryLimit: a phase crossed its memory high-water mark.
+	ErrMemoryLimit = &Error{CodeMemoryLimit, "memory limit exceeded"}
+	// ErrUnavailable: a dependency (RPC endpoint, audit log) is down.
+	ErrUnavailable = &Error{CodeUnavailable, "unavailable"}
+	// ErrPolicyRejected: a valid batch the prover's policy refuses to prove.
+	ErrPolicyRejected = &Error{CodePolicyRejected, "rejected by policy"}
+	// ErrProofExpired: the proof is older than its max age and must be
+	// re-proven before submission.
+	ErrProofExpired = &Error{CodeProofExpired, "proof expired"}
+	// ErrDuplicate: a resubmission under a key already taken by different
+	// data, such as a second intent with the same public key and nonce.
+	ErrDuplicate = &Error{CodeDuplicate, "duplicate"}
+	// ErrNotFound: the record asked for does not exist.
+	ErrNotFound = &Error{CodeNotFound, "not found"}
+)
+
+var sentinels = []*Error{
+	ErrInvalidInput, ErrInvalidBatch, ErrArtifactMismatch, ErrVerificationFailed, ErrProverTimeout,
+	ErrStaleNonce, ErrMemoryLimit, ErrUnavailable, ErrPolicyRejected, ErrProofExpired,
+	ErrDuplicate, ErrNotFound,
+}
+
+// ForCode returns the sentinel of c, nil for CodeOK, CodeInternal and codes
+// it does not know. Clients use it to turn a server's code back into an
+// error errors.Is can match.
+func ForCode(c Code) *Error {
+	for _, e := range sentinels {
+		if e.Code == c {
+			return e
+		}
+	}
+	return nil
+}
+
+// CodeOf returns the Code of the first sentinel in err's chain, CodeOK for
+// nil and CodeInternal for errors outside the taxonomy.
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// HTTPStatus maps err's Code to an HTTP status.
+func HTTPStatus(err error) int {
+	switch CodeOf(err) {
+	case CodeOK:
+		return http.StatusOK
+	case CodeInvalidInput:
+		return http.StatusBadRequest
+	case CodeInvalidBatch, CodeVerificationFailed:
+		return http.StatusUnprocessableEntity
+	case CodeArtifactMismatch, CodeStaleNonce, CodeProofExpired, CodeDuplicate:
+		return http.StatusConflict
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodePolicyRejected:
+		return http.StatusForbidden
+	case CodeProverTimeout:
+		return http.StatusGatewayTimeout
+	case CodeUnavailable, CodeMemoryLimit:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
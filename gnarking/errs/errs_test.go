@@ -0,0 +1,49 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	wrapped := fmt.Errorf("bundle member pk: %w", fmt.Errorf("%w: sha256 mismatch", ErrArtifactMismatch))
+	if !errors.Is(wrapped, ErrArtifactMismatch) {
+		t.Fatal("errors.Is lost the sentinel")
+	}
+	for _, tc := range []struct {
+		err    error
+		code   Code
+		status int
+	}{
+		{nil, CodeOK, http.StatusOK},
+		{wrapped, CodeArtifactMismatch, http.StatusConflict},
+		{fmt.Errorf("%w: bad hex", ErrInvalidInput), CodeInvalidInput, http.StatusBadRequest},
+		{ErrProverTimeout, CodeProverTimeout, http.StatusGatewayTimeout},
+		{fmt.Errorf("%w: chain 5", ErrPolicyRejected), CodePolicyRejected, http.StatusForbidden},
+		{fmt.Errorf("%w: intent 1", ErrDuplicate), CodeDuplicate, http.StatusConflict},
+		{ErrNotFound, CodeNotFound, http.StatusNotFound},
+		{errors.New("boom"), CodeInternal, http.StatusInternalServerError},
+	} {
+		if c := CodeOf(tc.err); c != tc.code {
+			t.Errorf("CodeOf(%v) = %s, want %s", tc.err, c, tc.code)
+		}
+		if s := HTTPStatus(tc.err); s != tc.status {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tc.err, s, tc.status)
+		}
+	}
+}
+
+func TestForCode(t *testing.T) {
+	for _, e := range sentinels {
+		if got := ForCode(e.Code); got != e {
+			t.Errorf("ForCode(%s) = %v", e.Code, got)
+		}
+	}
+	for _, c := range []Code{CodeOK, CodeInternal, "nope"} {
+		if got := ForCode(c); got != nil {
+			t.Errorf("ForCode(%s) = %v, want nil", c, got)
+		}
+	}
+}
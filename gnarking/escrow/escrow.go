@@ -0,0 +1,143 @@
+// Package escrow seals a batch's full witness to an arbiter for dispute
+// resolution. Normal operation reveals nothing: the prover keeps the sealed
+// file and the batch's receipt records only its SHA-256 (publish.Escrow).
+// In a dispute the file is handed to the arbiter, who opens it with their
+// key, checks it against the receipt and re-derives what was proven.
+//
+// A sealed witness is
+//
+//	magic (8) || arbiter X25519 key (32) || circuit hash (32) || batch ID (32) ||
+//	sealbox of the witness to the arbiter's key
+//
+// with the header as the box's additional data: the header in the clear
+// names who can open the file and which batch of which circuit it holds,
+// and cannot be changed without the arbiter noticing.
+package escrow
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/internal/sealbox"
+)
+
+const (
+	magic     = "DDMESCW1"
+	info      = "ddm escrow witness v1"
+	headerLen = len(magic) + 3*32
+)
+
+// Header is the clear part of a sealed witness.
+type Header struct {
+	Arbiter     [32]byte // X25519 public key the witness is sealed to
+	CircuitHash [32]byte // artifacts.CircuitHash of the ccs the witness is for
+	BatchID     [32]byte // circuit.BatchID of its public inputs
+}
+
+func (h Header) String() string {
+	return fmt.Sprintf("batch %x of circuit %x, sealed to arbiter %x", h.BatchID[:8], h.CircuitHash[:8], h.Arbiter[:8])
+}
+
+func (h Header) bytes() []byte {
+	b := append([]byte(magic), h.Arbiter[:]...)
+	b = append(b, h.CircuitHash[:]...)
+	return append(b, h.BatchID[:]...)
+}
+
+// NewKey generates an arbiter's key.
+func NewKey() (*ecdh.PrivateKey, error) { return sealbox.NewKey() }
+
+// ParseKey reads an arbiter's hex X25519 private key, 0x prefix optional.
+func ParseKey(s string) (*ecdh.PrivateKey, error) { return sealbox.ParseKey(s) }
+
+// ParsePublicKey reads an arbiter's hex X25519 public key, 0x prefix
+// optional.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) { return sealbox.ParsePublicKey(s) }
+
+// Seal encrypts the full witness w of a proof of circuitHash to arbiter.
+// The batch ID in the header is read from w's public part.
+func Seal(arbiter *ecdh.PublicKey, circuitHash [32]byte, w witness.Witness) ([]byte, error) {
+	pub, err := circuit.PublicFromWitness(w)
+	if err != nil {
+		return nil, err
+	}
+	h := Header{CircuitHash: circuitHash}
+	if h.BatchID, err = circuit.BatchID(pub); err != nil {
+		return nil, err
+	}
+	copy(h.Arbiter[:], arbiter.Bytes())
+	plain, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	header := h.bytes()
+	box, err := sealbox.Seal(arbiter, info, header, plain)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, box...), nil
+}
+
+// ReadHeader reads the clear header of a sealed witness; anyone can, only
+// the arbiter can check it was not altered (Open).
+func ReadHeader(sealed []byte) (Header, error) {
+	var h Header
+	if len(sealed) < headerLen+sealbox.KeyLen || string(sealed[:len(magic)]) != magic {
+		return h, fmt.Errorf("%w: not a sealed witness", errs.ErrInvalidInput)
+	}
+	b := sealed[len(magic):]
+	copy(h.Arbiter[:], b[0:32])
+	copy(h.CircuitHash[:], b[32:64])
+	copy(h.BatchID[:], b[64:96])
+	return h, nil
+}
+
+// Open decrypts a sealed witness with the arbiter's key. It fails with
+// ErrArtifactMismatch when the file was sealed to another key or altered,
+// or when the witness's public inputs are not the batch the header names.
+func Open(key *ecdh.PrivateKey, sealed []byte) (Header, witness.Witness, error) {
+	h, err := ReadHeader(sealed)
+	if err != nil {
+		return h, nil, err
+	}
+	if !bytes.Equal(h.Arbiter[:], key.PublicKey().Bytes()) {
+		return h, nil, fmt.Errorf("%w: witness sealed to arbiter %x, not this key", errs.ErrArtifactMismatch, h.Arbiter[:8])
+	}
+	plain, err := sealbox.Open(key, info, sealed[:headerLen], sealed[headerLen:])
+	if errors.Is(err, errs.ErrArtifactMismatch) {
+		return h, nil, fmt.Errorf("%w: sealed witness altered or not sealed to this key", errs.ErrArtifactMismatch)
+	}
+	if err != nil {
+		return h, nil, err
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return h, nil, err
+	}
+	if err := w.UnmarshalBinary(plain); err != nil {
+		return h, nil, fmt.Errorf("%w: witness: %w", errs.ErrInvalidInput, err)
+	}
+	pub, err := circuit.PublicFromWitness(w)
+	if err != nil {
+		return h, nil, err
+	}
+	if id, err := circuit.BatchID(pub); err != nil || id != h.BatchID {
+		return h, nil, fmt.Errorf("%w: witness is batch %x, header says %x", errs.ErrArtifactMismatch, id[:8], h.BatchID[:8])
+	}
+	return h, w, nil
+}
+
+// Hash is the hex SHA-256 of a sealed witness, what receipts record.
+func Hash(sealed []byte) string {
+	sum := sha256.Sum256(sealed)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package escrow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/internal/testcircuit"
+)
+
+func newWitness(t *testing.T, x int64) witness.Witness {
+	t.Helper()
+	w, err := testcircuit.Witness(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWitness(t, 7)
+	ccsHash := [32]byte{1, 2, 3}
+	sealed, err := Seal(key.PublicKey(), ccsHash, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := circuit.PublicFromWitness(w)
+	id, _ := circuit.BatchID(pub)
+	if h.BatchID != id || h.CircuitHash != ccsHash || !bytes.Equal(h.Arbiter[:], key.PublicKey().Bytes()) {
+		t.Fatalf("header %s", h)
+	}
+	plain, _ := w.MarshalBinary()
+	if bytes.Contains(sealed, plain[len(plain)-32:]) {
+		t.Fatal("secret part of the witness in the clear")
+	}
+
+	_, got, err := Open(key, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := got.MarshalBinary(); !bytes.Equal(b, plain) {
+		t.Fatal("opened witness differs")
+	}
+
+	other, _ := NewKey()
+	if _, _, err := Open(other, sealed); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("other key: %v", err)
+	}
+	// the header is authenticated: pointing it at another batch fails
+	tampered := bytes.Clone(sealed)
+	tampered[len(magic)+64] ^= 1
+	if _, _, err := Open(key, tampered); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("tampered header: %v", err)
+	}
+	tampered = bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, err := Open(key, tampered); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("tampered ciphertext: %v", err)
+	}
+	if _, err := ReadHeader(sealed[:40]); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("truncated: %v", err)
+	}
+	if Hash(sealed) == Hash(tampered) {
+		t.Fatal("hash ignores content")
+	}
+}
@@ -0,0 +1,210 @@
+// Package estimate predicts what proving a batch costs without proving it:
+// circuit size from linear fits over small compiles, prove time from a
+// micro-benchmark of this host's MSM throughput, memory and gas from fixed
+// models. The results feed report.Simulation.
+package estimate
+
+import (
+	"io"
+	"math"
+	"math/bits"
+	"runtime"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/report"
+)
+
+// Line is y = Base + PerRow * n.
+type Line struct {
+	Base   float64 `json:"base"`
+	PerRow float64 `json:"per_row"`
+}
+
+func (l Line) At(n int) int { return int(math.Round(l.Base + l.PerRow*float64(n))) }
+
+// Fit is a circuit's size as a function of its batch size.
+type Fit struct {
+	Constraints Line `json:"constraints"`
+	Wires       Line `json:"wires"`  // public + secret + internal variables
+	Public      int  `json:"public"` // public inputs, the same for every N
+}
+
+// fitSizes are the batch sizes FitProfile compiles. Every step of Define is
+// per row or a hash over all rows, so two points pin the lines exactly
+// (N = 2, 4 predict the N = 8 circuit to the constraint).
+var fitSizes = [2]int{2, 4}
+
+// FitProfile compiles p's circuit config at two small batch sizes and fits
+// its constraints and wires linearly in N.
+func FitProfile(p circuit.Profile) (Fit, error) {
+	var (
+		c, w [2]float64
+		pub  int
+	)
+	for i, n := range fitSizes {
+		p.N = n
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Define())
+		if err != nil {
+			return Fit{}, err
+		}
+		c[i] = float64(ccs.GetNbConstraints())
+		w[i] = float64(ccs.GetNbInternalVariables() + ccs.GetNbSecretVariables() + ccs.GetNbPublicVariables())
+		pub = ccs.GetNbPublicVariables() - 1 // less the constant wire
+	}
+	line := func(y [2]float64) Line {
+		per := (y[1] - y[0]) / float64(fitSizes[1]-fitSizes[0])
+		return Line{Base: y[0] - per*float64(fitSizes[0]), PerRow: per}
+	}
+	return Fit{Constraints: line(c), Wires: line(w), Public: pub}, nil
+}
+
+// MSM is this host's multi-scalar multiplication throughput, per point, at
+// Size points with every core.
+type MSM struct {
+	Size int           `json:"size"`
+	G1   time.Duration `json:"g1_per_point_ns"`
+	G2   time.Duration `json:"g2_per_point_ns"`
+}
+
+// DefaultMSMSize is large enough for Pippenger's windows to behave as in a
+// real prove, small enough to run in a second or two.
+const DefaultMSMSize = 1 << 14
+
+// BenchMSM times G1 and G2 MSMs of size points.
+func BenchMSM(size int) (MSM, error) {
+	_, _, g1, g2 := bn254.Generators()
+	// consecutive multiples of the generators: cheap to make, and an MSM
+	// does not care where its points come from
+	j1 := make([]bn254.G1Jac, size)
+	j2 := make([]bn254.G2Jac, size)
+	j1[0].FromAffine(&g1)
+	j2[0].FromAffine(&g2)
+	for i := 1; i < size; i++ {
+		j1[i].Set(&j1[i-1]).AddMixed(&g1)
+		j2[i].Set(&j2[i-1]).AddMixed(&g2)
+	}
+	p1 := bn254.BatchJacobianToAffineG1(j1)
+	p2 := make([]bn254.G2Affine, size)
+	for i := range j2 {
+		p2[i].FromJacobian(&j2[i])
+	}
+	scalars := make([]fr.Element, size)
+	for i := range scalars {
+		if _, err := scalars[i].SetRandom(); err != nil {
+			return MSM{}, err
+		}
+	}
+
+	// best of a few runs: the throughput the host has, not its noise
+	const runs = 3
+	cfg := ecc.MultiExpConfig{NbTasks: runtime.NumCPU()}
+	m := MSM{Size: size, G1: math.MaxInt64, G2: math.MaxInt64}
+	for range runs {
+		start := time.Now()
+		if _, err := new(bn254.G1Jac).MultiExp(p1, scalars, cfg); err != nil {
+			return m, err
+		}
+		m.G1 = min(m.G1, time.Since(start)/time.Duration(size))
+		start = time.Now()
+		if _, err := new(bn254.G2Jac).MultiExp(p2, scalars, cfg); err != nil {
+			return m, err
+		}
+		m.G2 = min(m.G2, time.Since(start)/time.Duration(size))
+	}
+	return m, nil
+}
+
+// proveFactor scales the MSM work model to measured Groth16 proves: below 1
+// because most wire values are 0, 1 or small (cheap to skip or bucket) and
+// above what that alone gives because solving and the FFTs are left out.
+// Fitted on N = 8 and N = 64 proves on one host; expect +-20% elsewhere,
+// more where the MSM benchmark and the prove see different load.
+const proveFactor = 0.75
+
+// ProveTime estimates a Groth16 prove with the given constraints and wires
+// from m. The prover runs G1 MSMs over A, B and K (about one point per
+// wire each) and Z (the FFT domain), and a G2 MSM over B; Pippenger's cost
+// per point falls as 1/log2 of the MSM size.
+func ProveTime(constraints, wires int, m MSM) time.Duration {
+	domain := 1 << bits.Len(uint(constraints)) // next power of two above
+	scale := math.Log2(float64(m.Size)) / math.Log2(float64(wires))
+	g1 := float64(m.G1) * scale * float64(3*wires+domain)
+	g2 := float64(m.G2) * scale * float64(wires)
+	return time.Duration(proveFactor * (g1 + g2))
+}
+
+// bytesPerConstraint is the peak in-use memory of a prove per constraint
+// (pk, ccs, solver and FFT vectors, MSM buckets), fitted on measured
+// N = 8 and N = 64 proves (memwatch peak in use).
+const bytesPerConstraint = 2800
+
+// PeakMemory estimates the peak in-use memory of proving constraints.
+func PeakMemory(constraints int) uint64 { return uint64(constraints) * bytesPerConstraint }
+
+// Gas of the generated Groth16 verifier, EIP-1108 precompile prices.
+const (
+	txBaseGas       = 21000
+	pairingGas      = 45000 + 4*34000 // one 4-pair check
+	ecMulGas        = 6000            // per public input
+	ecAddGas        = 150             // per public input
+	calldataByteGas = 16
+	verifierExecGas = 10000 // field range checks, memory, dispatch
+)
+
+// VerifyGas estimates the gas of one verifyProof(uint256[8], uint256[n])
+// transaction with nPublic public inputs.
+func VerifyGas(nPublic int) int {
+	calldata := 4 + 32*(8+nPublic)
+	return txBaseGas + pairingGas + nPublic*(ecMulGas+ecAddGas) + calldata*calldataByteGas + verifierExecGas
+}
+
+// ProofBytes is the size of a framed proof file: the header and a
+// compressed Groth16 proof, both fixed-size.
+func ProofBytes() (int64, error) {
+	p := artifacts.Proof{
+		Header: &artifacts.ProofHeader{Version: artifacts.ProofHeaderVersion, Curve: ecc.BN254, Backend: backend.GROTH16},
+		Proof:  new(groth16_bn254.Proof),
+	}
+	return p.WriteTo(io.Discard)
+}
+
+// Simulate estimates proving an n-row circuit of p's config carrying rows
+// transactions, with the on-chain cost at gasPriceGwei and ethUSD.
+func Simulate(p circuit.Profile, n, rows int, m MSM, gasPriceGwei, ethUSD float64) (report.Simulation, error) {
+	fit, err := FitProfile(p)
+	if err != nil {
+		return report.Simulation{}, err
+	}
+	proofBytes, err := ProofBytes()
+	if err != nil {
+		return report.Simulation{}, err
+	}
+	constraints, wires := fit.Constraints.At(n), fit.Wires.At(n)
+	return report.NewSimulation(report.Simulation{
+		N:                 n,
+		Rows:              rows,
+		Cores:             runtime.NumCPU(),
+		Constraints:       constraints,
+		ConstraintsPerRow: fit.Constraints.PerRow,
+		Wires:             wires,
+		MSMSize:           m.Size,
+		G1PerPoint:        m.G1,
+		G2PerPoint:        m.G2,
+		ProveTime:         ProveTime(constraints, wires, m),
+		PeakMemory:        PeakMemory(constraints),
+		ProofBytes:        proofBytes,
+		VerifyGas:         VerifyGas(fit.Public),
+		GasPriceGwei:      gasPriceGwei,
+		ETHUSD:            ethUSD,
+	}), nil
+}
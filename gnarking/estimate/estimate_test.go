@@ -0,0 +1,49 @@
+package estimate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/circuit"
+)
+
+func TestFitProfile(t *testing.T) {
+	for _, o := range []circuit.Ordering{circuit.OrderingMonotonic, circuit.OrderingPermuted} {
+		p := circuit.Profile{Name: "fit", N: 8, Ordering: o}
+		fit, err := FitProfile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Circuit())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wires := ccs.GetNbInternalVariables() + ccs.GetNbSecretVariables() + ccs.GetNbPublicVariables()
+		if got := fit.Constraints.At(8); got != ccs.GetNbConstraints() {
+			t.Errorf("%s: fitted %d constraints at N = 8, compiled %d", o, got, ccs.GetNbConstraints())
+		}
+		if got := fit.Wires.At(8); got != wires {
+			t.Errorf("%s: fitted %d wires at N = 8, compiled %d", o, got, wires)
+		}
+		if fit.Public != 8 {
+			t.Errorf("%s: %d public inputs", o, fit.Public)
+		}
+	}
+}
+
+func TestProveTime(t *testing.T) {
+	m := MSM{Size: DefaultMSMSize, G1: 7 * time.Microsecond, G2: 15 * time.Microsecond}
+	small := ProveTime(97793, 91347, m)
+	large := ProveTime(790681, 738349, m)
+	// measured on the host proveFactor was fitted on: 2.9s and 19s
+	if small < 2*time.Second || small > 4*time.Second || large < 14*time.Second || large > 25*time.Second {
+		t.Fatalf("N = 8: %s, N = 64: %s", small, large)
+	}
+	if g := VerifyGas(8); g != 269456 {
+		t.Fatalf("VerifyGas(8) = %d", g)
+	}
+}
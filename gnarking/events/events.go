@@ -0,0 +1,266 @@
+// Package events is the job lifecycle log of a ddm serve: JobSubmitted,
+// ProofReady, Submitted, Confirmed and Failed (events.proto, generated
+// into eventspb), appended to a file of length-delimited messages and
+// streamed to followers, so workflow engines can drive the pipeline from
+// it instead of polling GET /status.
+package events
+
+//go:generate protoc -I .. --go_out=.. --go_opt=module=gnarking events/events.proto
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gnarking/errs"
+	"gnarking/events/eventspb"
+)
+
+// ContentType is GET /events in the log's own framing.
+const ContentType = "application/x-ddm-events+protobuf"
+
+// MaxEvent bounds one event, checked before it is allocated; a ProofReady,
+// the largest, is under 1 KiB.
+const MaxEvent = 1 << 20
+
+// readBatch is how many events Follow reads at a time.
+const readBatch = 1024
+
+// Log is an append-only event log. Events are numbered from 1 in the order
+// they are appended; Open replays the file to continue the numbering.
+type Log struct {
+	mu      sync.Mutex
+	f       *os.File
+	offsets []int64 // of event seq i+1
+	size    int64
+	wake    chan struct{} // closed and replaced on every append
+}
+
+// Open opens the log at path, creating it if missing. An event cut short
+// by a crash mid-append is dropped; any other damage is an error.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f, wake: make(chan struct{})}
+	if err := l.replay(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("event log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *Log) replay() error {
+	r := NewReader(l.f)
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// a torn append: the event was never acknowledged
+			if err := l.f.Truncate(l.size); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("event %d: %w", len(l.offsets)+1, err)
+		}
+		if e.Seq != uint64(len(l.offsets))+1 {
+			return fmt.Errorf("%w: event %d has seq %d", errs.ErrInvalidInput, len(l.offsets)+1, e.Seq)
+		}
+		l.offsets = append(l.offsets, l.size)
+		l.size = r.n
+	}
+	_, err := l.f.Seek(l.size, io.SeekStart)
+	return err
+}
+
+// Append numbers e, stamps it with the current time unless it has one, and
+// writes it, synced, before returning it.
+func (l *Log) Append(e *eventspb.Event) (*eventspb.Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Seq = uint64(len(l.offsets)) + 1
+	if e.Time == nil {
+		e.Time = timestamppb.Now()
+	}
+	msg, err := proto.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	b := protowire.AppendBytes(nil, msg)
+	if _, err := l.f.Write(b); err != nil {
+		// whatever part was written is dropped by the next Open
+		l.f.Truncate(l.size)
+		l.f.Seek(l.size, io.SeekStart)
+		return nil, fmt.Errorf("%w: event log: %w", errs.ErrUnavailable, err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return nil, fmt.Errorf("%w: event log: %w", errs.ErrUnavailable, err)
+	}
+	l.offsets = append(l.offsets, l.size)
+	l.size += int64(len(b))
+	close(l.wake)
+	l.wake = make(chan struct{})
+	return e, nil
+}
+
+// Last is the seq of the newest event, 0 for an empty log.
+func (l *Log) Last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return uint64(len(l.offsets))
+}
+
+// Read returns up to max events after seq since, oldest first.
+func (l *Log) Read(since uint64, max int) ([]*eventspb.Event, error) {
+	l.mu.Lock()
+	n := uint64(len(l.offsets))
+	if since >= n || max <= 0 {
+		l.mu.Unlock()
+		return nil, nil
+	}
+	last := min(n, since+uint64(max))
+	start, end := l.offsets[since], l.size
+	if last < n {
+		end = l.offsets[last]
+	}
+	l.mu.Unlock()
+
+	// appends only ever write past end
+	r := NewReader(io.NewSectionReader(l.f, start, end-start))
+	evs := make([]*eventspb.Event, 0, last-since)
+	for range last - since {
+		e, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("event log: %w", err)
+		}
+		evs = append(evs, e)
+	}
+	return evs, nil
+}
+
+// Follow calls fn with every event after seq since, then with each one
+// appended, until ctx is done or fn fails.
+func (l *Log) Follow(ctx context.Context, since uint64, fn func(*eventspb.Event) error) error {
+	for {
+		l.mu.Lock()
+		n, wake := uint64(len(l.offsets)), l.wake
+		l.mu.Unlock()
+		for since < n {
+			evs, err := l.Read(since, readBatch)
+			if err != nil {
+				return err
+			}
+			for _, e := range evs {
+				if err := fn(e); err != nil {
+					return err
+				}
+				since = e.Seq
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+func (l *Log) Close() error { return l.f.Close() }
+
+// Scan calls fn with each event of the log file at path, read only: it may
+// be the log of a running server, whose last event may still be being
+// written and is then skipped.
+func Scan(path string, fn func(*eventspb.Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := NewReader(f)
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("event log %s: %w", path, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Reader reads length-delimited events: the log file, or a GET /events
+// stream.
+type Reader struct {
+	r *bufio.Reader
+	n int64 // bytes consumed by the events read
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: bufio.NewReader(r)} }
+
+// Next is the next event; io.EOF at a clean end, io.ErrUnexpectedEOF within
+// an event.
+func (r *Reader) Next() (*eventspb.Event, error) {
+	var head [binary.MaxVarintLen64]byte
+	n := 0
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			if n > 0 && errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if n == len(head) {
+			return nil, fmt.Errorf("%w: event length is not a varint", errs.ErrInvalidInput)
+		}
+		head[n] = c
+		n++
+		if c < 0x80 {
+			break
+		}
+	}
+	size, m := protowire.ConsumeVarint(head[:n])
+	if m < 0 || size > MaxEvent {
+		return nil, fmt.Errorf("%w: event of %d bytes, at most %d", errs.ErrInvalidInput, size, MaxEvent)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r.r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	e := new(eventspb.Event)
+	if err := proto.Unmarshal(msg, e); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	r.n += int64(n) + int64(size)
+	return e, nil
+}
+
+// Write writes e in the log's framing.
+func Write(w io.Writer, e *eventspb.Event) error {
+	msg, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(protowire.AppendBytes(nil, msg))
+	return err
+}
@@ -0,0 +1,178 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"gnarking/events/eventspb"
+)
+
+func submitted(tx string) *eventspb.Event {
+	return &eventspb.Event{BatchId: bytes.Repeat([]byte{1}, 32), Kind: &eventspb.Event_Submitted{Submitted: &eventspb.Submitted{TxHash: tx}}}
+}
+
+func TestLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "events.log")
+	l, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []string{"0x01", "0x02", "0x03"} {
+		if _, err := l.Append(submitted(tx)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// a crash mid-append leaves a torn event, which reopening drops
+	f, _ := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte{40, 1, 2})
+	f.Close()
+	n := 0
+	if err := Scan(name, func(*eventspb.Event) error { n++; return nil }); err != nil || n != 3 {
+		t.Fatalf("scanned %d events: %v, want 3", n, err)
+	}
+	if l, err = Open(name); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	e, err := l.Append(submitted("0x04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 4 || l.Last() != 4 {
+		t.Fatalf("seq %d, last %d after reopening, want 4", e.Seq, l.Last())
+	}
+	evs, err := l.Read(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 2 || evs[0].Seq != 2 || evs[1].GetSubmitted().GetTxHash() != "0x03" {
+		t.Fatalf("read after 1: %v", evs)
+	}
+
+	// a follower gets the backlog, then what is appended
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var seen []uint64
+	done := make(chan error)
+	go func() {
+		done <- l.Follow(ctx, 2, func(e *eventspb.Event) error {
+			seen = append(seen, e.Seq)
+			if e.Seq == 5 {
+				return errors.New("stop")
+			}
+			return nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.Append(submitted("0x05"))
+	if err := <-done; err == nil || err.Error() != "stop" {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 || seen[0] != 3 || seen[2] != 5 {
+		t.Fatalf("followed %v, want 3 4 5", seen)
+	}
+
+	// a log with a gap does not open
+	data, _ := os.ReadFile(name)
+	var gap bytes.Buffer
+	Write(&gap, &eventspb.Event{Seq: 9})
+	bad := filepath.Join(t.TempDir(), "bad.log")
+	os.WriteFile(bad, append(data, gap.Bytes()...), 0o644)
+	if _, err := Open(bad); err == nil || !strings.Contains(err.Error(), "event 6 has seq 9") {
+		t.Fatalf("a log with a gap: %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, tx := range []string{"0x01", "0x02"} {
+		l.Append(submitted(tx))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { Serve(w, r, l) }))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// without following, the stream ends at the newest event
+	var got []*eventspb.Event
+	c := &Client{URL: srv.URL}
+	if err := c.Follow(ctx, 0, false, func(e *eventspb.Event) error { got = append(got, e); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !proto.Equal(got[1], mustRead(t, l, 1)) {
+		t.Fatalf("stream %v", got)
+	}
+
+	got = nil
+	if err := c.Tail(ctx, 1, false, func(e *eventspb.Event) error { got = append(got, e); return nil }); err != nil || len(got) != 1 || got[0].Seq != 2 {
+		t.Fatalf("tail 1: %v %v", got, err)
+	}
+
+	// following, appended events arrive as they are appended
+	next := make(chan *eventspb.Event)
+	go c.Follow(ctx, 2, true, func(e *eventspb.Event) error { next <- e; return nil })
+	time.Sleep(10 * time.Millisecond)
+	l.Append(submitted("0x03"))
+	if e := <-next; e.Seq != 3 || e.GetSubmitted().GetTxHash() != "0x03" {
+		t.Fatalf("followed %v", e)
+	}
+
+	// server-sent events carry the JSON mapping, resumable by id
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events?follow=0", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var lines []string
+	for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) < 3 || lines[0] != "id: 3" || lines[1] != "event: submitted" {
+		t.Fatalf("event stream %q", lines)
+	}
+	var e eventspb.Event
+	if err := protojson.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &e); err != nil || e.GetSubmitted().GetTxHash() != "0x03" {
+		t.Fatalf("event data %q: %v", lines[2], err)
+	}
+
+	for _, q := range []string{"?since=x", "?follow=maybe", "?tail=-1"} {
+		resp, err := http.Get(srv.URL + "/events" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %s, want 400", q, resp.Status)
+		}
+	}
+}
+
+func mustRead(t *testing.T, l *Log, since uint64) *eventspb.Event {
+	t.Helper()
+	evs, err := l.Read(since, 1)
+	if err != nil || len(evs) != 1 {
+		t.Fatalf("read after %d: %v %v", since, evs, err)
+	}
+	return evs[0]
+}
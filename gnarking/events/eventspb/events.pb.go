@@ -0,0 +1,700 @@
+// Job lifecycle events of a ddm serve: a batch is taken for proving
+// (JobSubmitted), proven (ProofReady) or not (Failed), and its proof goes
+// on-chain (Submitted) and settles (Confirmed) or does not (Failed).
+//
+// The server appends every event to its log (ddm serve -events), a file of
+// length-delimited Event messages (varint byte length, then the message),
+// and streams them in the same framing on GET /events?since=SEQ
+// (Content-Type application/x-ddm-events+protobuf), or as server-sent
+// events with the protobuf JSON mapping when the client accepts
+// text/event-stream. ddm events tail follows either.
+//
+// Go code in eventspb is generated from this file with protoc and
+// protoc-gen-go: go generate ./events after a change.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v3.21.12
+// source: events/events.proto
+
+package eventspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Stage is where a job failed.
+type Stage int32
+
+const (
+	Stage_STAGE_UNSPECIFIED Stage = 0
+	Stage_STAGE_PROVE       Stage = 1
+	Stage_STAGE_SUBMIT      Stage = 2
+)
+
+// Enum value maps for Stage.
+var (
+	Stage_name = map[int32]string{
+		0: "STAGE_UNSPECIFIED",
+		1: "STAGE_PROVE",
+		2: "STAGE_SUBMIT",
+	}
+	Stage_value = map[string]int32{
+		"STAGE_UNSPECIFIED": 0,
+		"STAGE_PROVE":       1,
+		"STAGE_SUBMIT":      2,
+	}
+)
+
+func (x Stage) Enum() *Stage {
+	p := new(Stage)
+	*p = x
+	return p
+}
+
+func (x Stage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Stage) Descriptor() protoreflect.EnumDescriptor {
+	return file_events_events_proto_enumTypes[0].Descriptor()
+}
+
+func (Stage) Type() protoreflect.EnumType {
+	return &file_events_events_proto_enumTypes[0]
+}
+
+func (x Stage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Stage.Descriptor instead.
+func (Stage) EnumDescriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{0}
+}
+
+// Event is one entry of the log.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Position in the log, from 1, without gaps.
+	Seq  uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Time *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// circuit.BatchID of the batch's public inputs, 32 bytes.
+	BatchId []byte `protobuf:"bytes,3,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	// Circuit profile; empty for submissions of proofs made elsewhere.
+	Profile string `protobuf:"bytes,4,opt,name=profile,proto3" json:"profile,omitempty"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*Event_JobSubmitted
+	//	*Event_ProofReady
+	//	*Event_Submitted
+	//	*Event_Confirmed
+	//	*Event_Failed
+	Kind          isEvent_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_events_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Event) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetBatchId() []byte {
+	if x != nil {
+		return x.BatchId
+	}
+	return nil
+}
+
+func (x *Event) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Event) GetKind() isEvent_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *Event) GetJobSubmitted() *JobSubmitted {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_JobSubmitted); ok {
+			return x.JobSubmitted
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetProofReady() *ProofReady {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_ProofReady); ok {
+			return x.ProofReady
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetSubmitted() *Submitted {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_Submitted); ok {
+			return x.Submitted
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetConfirmed() *Confirmed {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_Confirmed); ok {
+			return x.Confirmed
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetFailed() *Failed {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_Failed); ok {
+			return x.Failed
+		}
+	}
+	return nil
+}
+
+type isEvent_Kind interface {
+	isEvent_Kind()
+}
+
+type Event_JobSubmitted struct {
+	JobSubmitted *JobSubmitted `protobuf:"bytes,10,opt,name=job_submitted,json=jobSubmitted,proto3,oneof"`
+}
+
+type Event_ProofReady struct {
+	ProofReady *ProofReady `protobuf:"bytes,11,opt,name=proof_ready,json=proofReady,proto3,oneof"`
+}
+
+type Event_Submitted struct {
+	Submitted *Submitted `protobuf:"bytes,12,opt,name=submitted,proto3,oneof"`
+}
+
+type Event_Confirmed struct {
+	Confirmed *Confirmed `protobuf:"bytes,13,opt,name=confirmed,proto3,oneof"`
+}
+
+type Event_Failed struct {
+	Failed *Failed `protobuf:"bytes,14,opt,name=failed,proto3,oneof"`
+}
+
+func (*Event_JobSubmitted) isEvent_Kind() {}
+
+func (*Event_ProofReady) isEvent_Kind() {}
+
+func (*Event_Submitted) isEvent_Kind() {}
+
+func (*Event_Confirmed) isEvent_Kind() {}
+
+func (*Event_Failed) isEvent_Kind() {}
+
+// JobSubmitted is a batch queued for the prover, with its public inputs.
+// Field values are decimal strings and hex as in public_N.json.
+type JobSubmitted struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rows  uint32                 `protobuf:"varint,1,opt,name=rows,proto3" json:"rows,omitempty"`
+	// Core budget of the prove.
+	Cores         uint32 `protobuf:"varint,2,opt,name=cores,proto3" json:"cores,omitempty"`
+	Recipient     string `protobuf:"bytes,3,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	KOld          string `protobuf:"bytes,4,opt,name=k_old,json=kOld,proto3" json:"k_old,omitempty"`
+	M             string `protobuf:"bytes,5,opt,name=m,proto3" json:"m,omitempty"`
+	TotalSettle   string `protobuf:"bytes,6,opt,name=total_settle,json=totalSettle,proto3" json:"total_settle,omitempty"`
+	ChainId       string `protobuf:"bytes,7,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobSubmitted) Reset() {
+	*x = JobSubmitted{}
+	mi := &file_events_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobSubmitted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobSubmitted) ProtoMessage() {}
+
+func (x *JobSubmitted) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobSubmitted.ProtoReflect.Descriptor instead.
+func (*JobSubmitted) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JobSubmitted) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+func (x *JobSubmitted) GetCores() uint32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *JobSubmitted) GetRecipient() string {
+	if x != nil {
+		return x.Recipient
+	}
+	return ""
+}
+
+func (x *JobSubmitted) GetKOld() string {
+	if x != nil {
+		return x.KOld
+	}
+	return ""
+}
+
+func (x *JobSubmitted) GetM() string {
+	if x != nil {
+		return x.M
+	}
+	return ""
+}
+
+func (x *JobSubmitted) GetTotalSettle() string {
+	if x != nil {
+		return x.TotalSettle
+	}
+	return ""
+}
+
+func (x *JobSubmitted) GetChainId() string {
+	if x != nil {
+		return x.ChainId
+	}
+	return ""
+}
+
+// ProofReady is the receipt of a proof made: the framed proof file, what
+// ddm submit takes.
+type ProofReady struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proof         []byte                 `protobuf:"bytes,1,opt,name=proof,proto3" json:"proof,omitempty"`
+	ProveTime     *durationpb.Duration   `protobuf:"bytes,2,opt,name=prove_time,json=proveTime,proto3" json:"prove_time,omitempty"`
+	Cores         uint32                 `protobuf:"varint,3,opt,name=cores,proto3" json:"cores,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProofReady) Reset() {
+	*x = ProofReady{}
+	mi := &file_events_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProofReady) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProofReady) ProtoMessage() {}
+
+func (x *ProofReady) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProofReady.ProtoReflect.Descriptor instead.
+func (*ProofReady) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ProofReady) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+func (x *ProofReady) GetProveTime() *durationpb.Duration {
+	if x != nil {
+		return x.ProveTime
+	}
+	return nil
+}
+
+func (x *ProofReady) GetCores() uint32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+// Submitted is a proof's transaction posted to the verifier contract.
+type Submitted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxHash        string                 `protobuf:"bytes,1,opt,name=tx_hash,json=txHash,proto3" json:"tx_hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Submitted) Reset() {
+	*x = Submitted{}
+	mi := &file_events_events_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Submitted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Submitted) ProtoMessage() {}
+
+func (x *Submitted) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Submitted.ProtoReflect.Descriptor instead.
+func (*Submitted) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Submitted) GetTxHash() string {
+	if x != nil {
+		return x.TxHash
+	}
+	return ""
+}
+
+// Confirmed is the receipt of a settled batch: the transaction mined, and
+// confirmations deep when reported.
+type Confirmed struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxHash        string                 `protobuf:"bytes,1,opt,name=tx_hash,json=txHash,proto3" json:"tx_hash,omitempty"`
+	Block         uint64                 `protobuf:"varint,2,opt,name=block,proto3" json:"block,omitempty"`
+	Confirmations uint64                 `protobuf:"varint,3,opt,name=confirmations,proto3" json:"confirmations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Confirmed) Reset() {
+	*x = Confirmed{}
+	mi := &file_events_events_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Confirmed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Confirmed) ProtoMessage() {}
+
+func (x *Confirmed) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Confirmed.ProtoReflect.Descriptor instead.
+func (*Confirmed) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Confirmed) GetTxHash() string {
+	if x != nil {
+		return x.TxHash
+	}
+	return ""
+}
+
+func (x *Confirmed) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *Confirmed) GetConfirmations() uint64 {
+	if x != nil {
+		return x.Confirmations
+	}
+	return 0
+}
+
+// Failed ends a job: proving failed, or its submission was given up on.
+type Failed struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Stage Stage                  `protobuf:"varint,1,opt,name=stage,proto3,enum=ddm.events.v1.Stage" json:"stage,omitempty"`
+	// errs.Code of the error.
+	Code          string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Failed) Reset() {
+	*x = Failed{}
+	mi := &file_events_events_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Failed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Failed) ProtoMessage() {}
+
+func (x *Failed) ProtoReflect() protoreflect.Message {
+	mi := &file_events_events_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Failed.ProtoReflect.Descriptor instead.
+func (*Failed) Descriptor() ([]byte, []int) {
+	return file_events_events_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Failed) GetStage() Stage {
+	if x != nil {
+		return x.Stage
+	}
+	return Stage_STAGE_UNSPECIFIED
+}
+
+func (x *Failed) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Failed) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_events_events_proto protoreflect.FileDescriptor
+
+const file_events_events_proto_rawDesc = "" +
+	"\n" +
+	"\x13events/events.proto\x12\rddm.events.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xad\x03\n" +
+	"\x05Event\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x19\n" +
+	"\bbatch_id\x18\x03 \x01(\fR\abatchId\x12\x18\n" +
+	"\aprofile\x18\x04 \x01(\tR\aprofile\x12B\n" +
+	"\rjob_submitted\x18\n" +
+	" \x01(\v2\x1b.ddm.events.v1.JobSubmittedH\x00R\fjobSubmitted\x12<\n" +
+	"\vproof_ready\x18\v \x01(\v2\x19.ddm.events.v1.ProofReadyH\x00R\n" +
+	"proofReady\x128\n" +
+	"\tsubmitted\x18\f \x01(\v2\x18.ddm.events.v1.SubmittedH\x00R\tsubmitted\x128\n" +
+	"\tconfirmed\x18\r \x01(\v2\x18.ddm.events.v1.ConfirmedH\x00R\tconfirmed\x12/\n" +
+	"\x06failed\x18\x0e \x01(\v2\x15.ddm.events.v1.FailedH\x00R\x06failedB\x06\n" +
+	"\x04kind\"\xb7\x01\n" +
+	"\fJobSubmitted\x12\x12\n" +
+	"\x04rows\x18\x01 \x01(\rR\x04rows\x12\x14\n" +
+	"\x05cores\x18\x02 \x01(\rR\x05cores\x12\x1c\n" +
+	"\trecipient\x18\x03 \x01(\tR\trecipient\x12\x13\n" +
+	"\x05k_old\x18\x04 \x01(\tR\x04kOld\x12\f\n" +
+	"\x01m\x18\x05 \x01(\tR\x01m\x12!\n" +
+	"\ftotal_settle\x18\x06 \x01(\tR\vtotalSettle\x12\x19\n" +
+	"\bchain_id\x18\a \x01(\tR\achainId\"r\n" +
+	"\n" +
+	"ProofReady\x12\x14\n" +
+	"\x05proof\x18\x01 \x01(\fR\x05proof\x128\n" +
+	"\n" +
+	"prove_time\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\tproveTime\x12\x14\n" +
+	"\x05cores\x18\x03 \x01(\rR\x05cores\"$\n" +
+	"\tSubmitted\x12\x17\n" +
+	"\atx_hash\x18\x01 \x01(\tR\x06txHash\"`\n" +
+	"\tConfirmed\x12\x17\n" +
+	"\atx_hash\x18\x01 \x01(\tR\x06txHash\x12\x14\n" +
+	"\x05block\x18\x02 \x01(\x04R\x05block\x12$\n" +
+	"\rconfirmations\x18\x03 \x01(\x04R\rconfirmations\"^\n" +
+	"\x06Failed\x12*\n" +
+	"\x05stage\x18\x01 \x01(\x0e2\x14.ddm.events.v1.StageR\x05stage\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error*A\n" +
+	"\x05Stage\x12\x15\n" +
+	"\x11STAGE_UNSPECIFIED\x10\x00\x12\x0f\n" +
+	"\vSTAGE_PROVE\x10\x01\x12\x10\n" +
+	"\fSTAGE_SUBMIT\x10\x02B\x1aZ\x18gnarking/events/eventspbb\x06proto3"
+
+var (
+	file_events_events_proto_rawDescOnce sync.Once
+	file_events_events_proto_rawDescData []byte
+)
+
+func file_events_events_proto_rawDescGZIP() []byte {
+	file_events_events_proto_rawDescOnce.Do(func() {
+		file_events_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_events_events_proto_rawDesc), len(file_events_events_proto_rawDesc)))
+	})
+	return file_events_events_proto_rawDescData
+}
+
+var file_events_events_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_events_events_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_events_events_proto_goTypes = []any{
+	(Stage)(0),                    // 0: ddm.events.v1.Stage
+	(*Event)(nil),                 // 1: ddm.events.v1.Event
+	(*JobSubmitted)(nil),          // 2: ddm.events.v1.JobSubmitted
+	(*ProofReady)(nil),            // 3: ddm.events.v1.ProofReady
+	(*Submitted)(nil),             // 4: ddm.events.v1.Submitted
+	(*Confirmed)(nil),             // 5: ddm.events.v1.Confirmed
+	(*Failed)(nil),                // 6: ddm.events.v1.Failed
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 8: google.protobuf.Duration
+}
+var file_events_events_proto_depIdxs = []int32{
+	7, // 0: ddm.events.v1.Event.time:type_name -> google.protobuf.Timestamp
+	2, // 1: ddm.events.v1.Event.job_submitted:type_name -> ddm.events.v1.JobSubmitted
+	3, // 2: ddm.events.v1.Event.proof_ready:type_name -> ddm.events.v1.ProofReady
+	4, // 3: ddm.events.v1.Event.submitted:type_name -> ddm.events.v1.Submitted
+	5, // 4: ddm.events.v1.Event.confirmed:type_name -> ddm.events.v1.Confirmed
+	6, // 5: ddm.events.v1.Event.failed:type_name -> ddm.events.v1.Failed
+	8, // 6: ddm.events.v1.ProofReady.prove_time:type_name -> google.protobuf.Duration
+	0, // 7: ddm.events.v1.Failed.stage:type_name -> ddm.events.v1.Stage
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_events_events_proto_init() }
+func file_events_events_proto_init() {
+	if File_events_events_proto != nil {
+		return
+	}
+	file_events_events_proto_msgTypes[0].OneofWrappers = []any{
+		(*Event_JobSubmitted)(nil),
+		(*Event_ProofReady)(nil),
+		(*Event_Submitted)(nil),
+		(*Event_Confirmed)(nil),
+		(*Event_Failed)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_events_events_proto_rawDesc), len(file_events_events_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_events_events_proto_goTypes,
+		DependencyIndexes: file_events_events_proto_depIdxs,
+		EnumInfos:         file_events_events_proto_enumTypes,
+		MessageInfos:      file_events_events_proto_msgTypes,
+	}.Build()
+	File_events_events_proto = out.File
+	file_events_events_proto_goTypes = nil
+	file_events_events_proto_depIdxs = nil
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"gnarking/errs"
+	"gnarking/events/eventspb"
+)
+
+// Kind names e's kind as its field in the oneof, e.g. "proof_ready"; ""
+// when it has none.
+func Kind(e *eventspb.Event) string {
+	m := e.ProtoReflect()
+	f := m.WhichOneof(m.Descriptor().Oneofs().ByName("kind"))
+	if f == nil {
+		return ""
+	}
+	return string(f.Name())
+}
+
+// Serve answers GET /events?since=SEQ&tail=N&follow=0|1 from l: the events
+// after since (0, everything, by default; the Last-Event-ID header for
+// server-sent events), or the last n with tail=n, then, unless follow=0,
+// each one appended until the client goes away. The reply is
+// length-delimited protobuf (ContentType), or server-sent events of the
+// protobuf JSON mapping named by Kind when the client accepts
+// text/event-stream.
+func Serve(w http.ResponseWriter, r *http.Request, l *Log) {
+	q := r.URL.Query()
+	since := cmp.Or(q.Get("since"), r.Header.Get("Last-Event-ID"), "0")
+	from, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("since %q is not a seq", since), http.StatusBadRequest)
+		return
+	}
+	if t := q.Get("tail"); t != "" {
+		n, err := strconv.ParseUint(t, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("tail %q is not a count", t), http.StatusBadRequest)
+			return
+		}
+		last := l.Last()
+		from = last - min(n, last)
+	}
+	follow, err := strconv.ParseBool(cmp.Or(q.Get("follow"), "1"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("follow %q is not a bool", q.Get("follow")), http.StatusBadRequest)
+		return
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", ContentType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e *eventspb.Event) error {
+		var err error
+		if sse {
+			var data []byte
+			if data, err = protojson.Marshal(e); err == nil {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, Kind(e), data)
+			}
+		} else {
+			err = Write(w, e)
+		}
+		if err == nil && flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	}
+	if !follow {
+		for {
+			evs, err := l.Read(from, readBatch)
+			if err != nil || len(evs) == 0 {
+				return
+			}
+			for _, e := range evs {
+				if send(e) != nil {
+					return
+				}
+				from = e.Seq
+			}
+		}
+	}
+	l.Follow(r.Context(), from, send)
+}
+
+// Client follows the event stream of a ddm serve -events.
+type Client struct {
+	URL  string
+	HTTP *http.Client // default http.DefaultClient
+}
+
+// Follow calls fn with every event after seq since, then, when follow is
+// set, with each one the server appends, until ctx is done, fn fails or
+// the stream ends.
+func (c *Client) Follow(ctx context.Context, since uint64, follow bool, fn func(*eventspb.Event) error) error {
+	return c.stream(ctx, url.Values{"since": {strconv.FormatUint(since, 10)}}, follow, fn)
+}
+
+// Tail is Follow from the server's last n events.
+func (c *Client) Tail(ctx context.Context, n uint64, follow bool, fn func(*eventspb.Event) error) error {
+	return c.stream(ctx, url.Values{"tail": {strconv.FormatUint(n, 10)}}, follow, fn)
+}
+
+func (c *Client) stream(ctx context.Context, q url.Values, follow bool, fn func(*eventspb.Event) error) error {
+	q.Set("follow", strconv.FormatBool(follow))
+	u := strings.TrimSuffix(c.URL, "/") + "/events?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	req.Header.Set("Accept", ContentType)
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s serves no events (ddm serve -events)", errs.ErrNotFound, c.URL)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+	}
+	r := NewReader(resp.Body)
+	for {
+		e, err := r.Next()
+		switch {
+		case errors.Is(err, io.EOF) && !follow:
+			return nil
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return fmt.Errorf("%w: %s: %w", errs.ErrUnavailable, c.URL, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package evmlog bridges an existing escrow contract into the proving
+// pipeline: it reads the contract's deposit and authorization events over
+// JSON-RPC and turns each into a settlement row, an intake.Intent, whose
+// signature is checked under the profile's message version. The events
+// are described by their Solidity declaration (ParseEvent); parameters
+// named after a row's fields supply them, the rest are ignored.
+//
+// Rows that cannot be proven are kept, flagged with the reason: no
+// signature (a plain deposit), a signature that does not check, a value
+// out of range, or a (pk, nonce) already taken by an earlier event. Valid
+// rows go to a ddm serve's intake (POST /intents), or to a topic ddm
+// stream consumes, like any other intent.
+package evmlog
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/intake"
+)
+
+// Parameter is one parameter of an event.
+type Parameter struct {
+	Name    string
+	Type    string // canonical: uint256, not uint
+	Indexed bool
+}
+
+// Event is an event's declaration.
+type Event struct {
+	Name   string
+	Inputs []Parameter
+}
+
+// Row fields an event parameter may supply, by its name, compared without
+// case or underscores.
+var fieldNames = map[string]string{
+	"pk": "pk", "signer": "pk",
+	"recipient": "recipient", "payee": "recipient",
+	"size": "size", "amount": "size", "value": "size",
+	"nonce":   "nonce",
+	"chainid": "chain_id",
+	"sig":     "sig", "signature": "sig",
+}
+
+func field(name string) string {
+	return fieldNames[strings.ToLower(strings.ReplaceAll(name, "_", ""))]
+}
+
+// ParseEvent parses a Solidity event declaration, e.g.
+// "Authorized(bytes32 indexed pk, address indexed recipient, uint256
+// amount, uint64 nonce, bytes sig)", with or without the "event" keyword.
+// It supports static types (uintN, intN, address, bool, bytesN) and bytes.
+// An event must supply a recipient, size and nonce; a sig must be a bytes
+// parameter that is not indexed, since an indexed one is only its hash.
+func ParseEvent(decl string) (Event, error) {
+	decl = strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(decl), "event ")), ";")
+	name, rest, ok := strings.Cut(decl, "(")
+	params, ok2 := strings.CutSuffix(strings.TrimSpace(rest), ")")
+	e := Event{Name: strings.TrimSpace(name)}
+	if !ok || !ok2 || e.Name == "" {
+		return Event{}, fmt.Errorf("%w: event %q: want Name(type [indexed] name, ...)", errs.ErrInvalidInput, decl)
+	}
+	has := map[string]bool{}
+	for p := range strings.SplitSeq(params, ",") {
+		if strings.TrimSpace(params) == "" {
+			break
+		}
+		words := strings.Fields(p)
+		var in Parameter
+		switch {
+		case len(words) == 2:
+		case len(words) == 3 && words[1] == "indexed":
+			in.Indexed = true
+		default:
+			return Event{}, fmt.Errorf("%w: event %s: parameter %q: want type [indexed] name", errs.ErrInvalidInput, e.Name, strings.TrimSpace(p))
+		}
+		in.Name = words[len(words)-1]
+		t, err := canonicalType(words[0])
+		if err != nil {
+			return Event{}, fmt.Errorf("%w: event %s: parameter %s: %w", errs.ErrInvalidInput, e.Name, in.Name, err)
+		}
+		in.Type = t
+		if f := field(in.Name); f != "" {
+			if has[f] {
+				return Event{}, fmt.Errorf("%w: event %s: two parameters for %s", errs.ErrInvalidInput, e.Name, f)
+			}
+			has[f] = true
+			if f == "sig" && (t != "bytes" || in.Indexed) {
+				return Event{}, fmt.Errorf("%w: event %s: %s must be bytes, not indexed", errs.ErrInvalidInput, e.Name, in.Name)
+			}
+			if f != "sig" && t == "bytes" {
+				return Event{}, fmt.Errorf("%w: event %s: %s of type bytes", errs.ErrInvalidInput, e.Name, in.Name)
+			}
+		}
+		e.Inputs = append(e.Inputs, in)
+	}
+	for _, f := range []string{"recipient", "size", "nonce"} {
+		if !has[f] {
+			return Event{}, fmt.Errorf("%w: event %s has no %s parameter", errs.ErrInvalidInput, e.Name, f)
+		}
+	}
+	return e, nil
+}
+
+func canonicalType(t string) (string, error) {
+	switch t {
+	case "uint", "int":
+		return t + "256", nil
+	case "address", "bool", "bytes":
+		return t, nil
+	}
+	for _, prefix := range []string{"uint", "int", "bytes"} {
+		bits, ok := strings.CutPrefix(t, prefix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(bits)
+		if prefix == "bytes" && err == nil && n >= 1 && n <= 32 || prefix != "bytes" && err == nil && n >= 8 && n <= 256 && n%8 == 0 {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %q", t)
+}
+
+// Signature is e's canonical signature, e.g.
+// "Authorized(bytes32,address,uint256,uint64,bytes)".
+func (e Event) Signature() string {
+	types := make([]string, len(e.Inputs))
+	for i, in := range e.Inputs {
+		types[i] = in.Type
+	}
+	return e.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+// Topic is the first topic of e's logs, the keccak256 of its signature.
+func (e Event) Topic() []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(e.Signature()))
+	return h.Sum(nil)
+}
+
+// Flag is why a row cannot be proven.
+type Flag string
+
+const (
+	FlagUnsigned     Flag = "unsigned"      // the event carries no signature
+	FlagBadSignature Flag = "bad_signature" // malformed, or not the signer's over the row message
+	FlagInvalid      Flag = "invalid"       // a value out of range, or no signer
+	FlagDuplicate    Flag = "duplicate"     // an earlier event took its (pk, nonce)
+)
+
+// Row is a settlement row read from one log.
+type Row struct {
+	intake.Intent
+	Event    string `json:"event"`
+	Block    uint64 `json:"block"`
+	TxHash   string `json:"tx_hash"`
+	LogIndex uint64 `json:"log_index"`
+	Flag     Flag   `json:"flag,omitempty"` // empty for a row ready to prove
+	Reason   string `json:"reason,omitempty"`
+}
+
+// LogSource reads a contract's logs; *chainsync.RPC is one.
+type LogSource interface {
+	Logs(ctx context.Context, from, to uint64, topics ...[]byte) ([]chainsync.Log, error)
+}
+
+var _ LogSource = (*chainsync.RPC)(nil)
+
+// Reader reads rows from the events Events of the contract behind Logs.
+type Reader struct {
+	Logs    LogSource
+	Events  []Event
+	Profile string             // of the intents
+	Msg     circuit.MsgVersion // signatures are checked over this row message
+	ChainID uint64             // of events with no chain ID parameter
+	Pk      string             // hex, signer of events with no pk parameter
+}
+
+// Read returns a row for every event in blocks [from, to], in log order.
+// A log that does not decode as its event fails the read: the declaration
+// does not match the contract.
+func (r *Reader) Read(ctx context.Context, from, to uint64) ([]Row, error) {
+	if len(r.Events) == 0 {
+		return nil, fmt.Errorf("%w: no events to read", errs.ErrInvalidInput)
+	}
+	byTopic := map[string]Event{}
+	topics := make([][]byte, len(r.Events))
+	for i, e := range r.Events {
+		topics[i] = e.Topic()
+		byTopic[string(topics[i])] = e
+	}
+	logs, err := r.Logs.Logs(ctx, from, to, topics...)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[intake.Key]string{}
+	rows := make([]Row, 0, len(logs))
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		e, ok := byTopic[string(l.Topics[0])]
+		if !ok {
+			continue
+		}
+		values, err := e.decode(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s log %d in tx %s: %w", errs.ErrInvalidInput, e.Name, l.LogIndex, l.TxHash, err)
+		}
+		row := r.row(e, values)
+		row.Event, row.Block, row.TxHash, row.LogIndex = e.Name, l.Block, l.TxHash, l.LogIndex
+		if row.Flag == "" {
+			k := intake.Key{Pk: row.Pk, Nonce: row.Nonce}
+			if first, ok := seen[k]; ok {
+				row.Flag, row.Reason = FlagDuplicate, "nonce taken by the event in tx "+first
+			} else {
+				seen[k] = l.TxHash
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// row converts an event's values, by row field, to a checked row.
+func (r *Reader) row(e Event, values map[string][]byte) Row {
+	row := Row{Intent: intake.Intent{Profile: r.Profile, Pk: r.Pk, ChainID: r.ChainID}}
+	flag := func(f Flag, format string, args ...any) Row {
+		row.Flag, row.Reason = f, fmt.Sprintf(format, args...)
+		return row
+	}
+	row.Recipient = "0x" + new(big.Int).SetBytes(values["recipient"]).Text(16)
+	if pk, ok := values["pk"]; ok {
+		row.Pk = hex.EncodeToString(pk)
+	}
+	for _, f := range []struct {
+		name string
+		dst  *uint64
+	}{{"size", &row.Size}, {"nonce", &row.Nonce}, {"chain_id", &row.ChainID}} {
+		v, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		x := new(big.Int).SetBytes(v)
+		if !x.IsUint64() {
+			return flag(FlagInvalid, "%s %s is over 64 bits", f.name, x)
+		}
+		*f.dst = x.Uint64()
+	}
+	sig, ok := values["sig"]
+	if !ok || len(sig) == 0 {
+		return flag(FlagUnsigned, "event %s carries no signature", e.Name)
+	}
+	if row.Pk == "" {
+		return flag(FlagInvalid, "event %s has no pk parameter and no signer is set", e.Name)
+	}
+	row.Sig = hex.EncodeToString(sig)
+	in, err := row.Intent.Check(r.Msg)
+	if err != nil {
+		return flag(FlagBadSignature, "%v", err)
+	}
+	row.Intent = in
+	return row
+}
+
+// decode reads the values of e's row fields from l: indexed parameters
+// from its topics, the rest from its ABI-encoded data.
+func (e Event) decode(l chainsync.Log) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	topic, head := 1, 0
+	for _, in := range e.Inputs {
+		var word []byte
+		if in.Indexed {
+			if topic >= len(l.Topics) {
+				return nil, fmt.Errorf("%d topics, %s is indexed", len(l.Topics), in.Name)
+			}
+			word, topic = l.Topics[topic], topic+1
+		} else {
+			if head+32 > len(l.Data) {
+				return nil, fmt.Errorf("%d data bytes, short of %s", len(l.Data), in.Name)
+			}
+			word, head = l.Data[head:head+32], head+32
+		}
+		f := field(in.Name)
+		if f == "" {
+			continue
+		}
+		if in.Type != "bytes" {
+			values[f] = word
+			continue
+		}
+		// a dynamic bytes: the head word is the offset of its length
+		// word, the bytes follow
+		offset := new(big.Int).SetBytes(word)
+		if !offset.IsInt64() || offset.Int64()+32 > int64(len(l.Data)) {
+			return nil, fmt.Errorf("%s at offset %s, past %d data bytes", in.Name, offset, len(l.Data))
+		}
+		at := int(offset.Int64())
+		n := new(big.Int).SetBytes(l.Data[at : at+32])
+		if !n.IsInt64() || int64(at+32)+n.Int64() > int64(len(l.Data)) {
+			return nil, fmt.Errorf("%s of %s bytes, past %d data bytes", in.Name, n, len(l.Data))
+		}
+		values[f] = l.Data[at+32 : at+32+int(n.Int64())]
+	}
+	return values, nil
+}
+
+// Valid is the intents of the rows ready to prove.
+func Valid(rows []Row) []intake.Intent {
+	var out []intake.Intent
+	for _, r := range rows {
+		if r.Flag == "" {
+			out = append(out, r.Intent)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package evmlog
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/keys"
+)
+
+type fakeLogs []chainsync.Log
+
+func (f fakeLogs) Logs(ctx context.Context, from, to uint64, topics ...[]byte) ([]chainsync.Log, error) {
+	return f, nil
+}
+
+func word(v uint64) []byte { return new(big.Int).SetUint64(v).FillBytes(make([]byte, 32)) }
+
+func TestRead(t *testing.T) {
+	auth, err := ParseEvent("event Authorized(bytes32 indexed pk, address indexed recipient, uint256 amount, uint64 nonce, bytes sig);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.Signature(); got != "Authorized(bytes32,address,uint256,uint64,bytes)" {
+		t.Fatalf("signature %s", got)
+	}
+	deposit, err := ParseEvent("Deposited(address indexed recipient, uint amount, uint nonce, address payer)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operator, err := keys.Derive(keys.Seed{1}, keys.Path{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := operator.PublicKey.Bytes()
+	sign := func(size, nonce uint64) []byte {
+		msg := circuit.MsgHash(circuit.MsgV1, big.NewInt(0x2a), new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(1))
+		sig, err := circuit.EdDSA{}.Sign(operator, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	authLog := func(tx string, size, nonce uint64, sig []byte) chainsync.Log {
+		data := append(append(append(word(size), word(nonce)...), word(3*32)...), word(uint64(len(sig)))...)
+		data = append(data, sig...)
+		data = append(data, make([]byte, (32-len(sig)%32)%32)...)
+		return chainsync.Log{Topics: [][]byte{auth.Topic(), pk[:], word(0x2a)}, Data: data, TxHash: tx}
+	}
+	logs := fakeLogs{
+		authLog("0x1", 10, 1, sign(10, 1)),
+		authLog("0x2", 20, 2, sign(21, 2)), // signed another size
+		{Topics: [][]byte{deposit.Topic(), word(0x2a)}, Data: append(append(word(30), word(3)...), word(7)...), TxHash: "0x3"},
+		authLog("0x4", 10, 1, sign(10, 1)), // replayed
+		authLog("0x5", 40, 4, sign(40, 4)),
+	}
+	r := &Reader{Logs: logs, Events: []Event{auth, deposit}, Msg: circuit.MsgV1, ChainID: 1}
+	rows, err := r.Read(context.Background(), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Flag{"", FlagBadSignature, FlagUnsigned, FlagDuplicate, ""}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rows", len(rows))
+	}
+	for i, row := range rows {
+		if row.Flag != want[i] {
+			t.Errorf("row %d (%s): flag %q (%s), want %q", i, row.TxHash, row.Flag, row.Reason, want[i])
+		}
+	}
+	// the deposit has no pk parameter, and the reader no signer
+	if rows[2].Pk != "" || rows[2].Size != 30 || rows[2].Nonce != 3 {
+		t.Errorf("deposit %+v", rows[2])
+	}
+	valid := Valid(rows)
+	if len(valid) != 2 || valid[1].Size != 40 || valid[1].Nonce != 4 || valid[1].Recipient != "0x2a" || valid[1].Pk != hex.EncodeToString(pk[:]) {
+		t.Fatalf("valid %+v", valid)
+	}
+
+	// a declaration that does not match the contract's logs
+	short := fakeLogs{{Topics: [][]byte{auth.Topic(), pk[:], word(0x2a)}, Data: word(1), TxHash: "0x6"}}
+	if _, err := (&Reader{Logs: short, Events: []Event{auth}}).Read(context.Background(), 0, 1); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("short data: %v", err)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	for _, bad := range []string{
+		"Authorized",
+		"Authorized(uint256 amount, uint256 nonce)",                                 // no recipient
+		"Authorized(address recipient, uint256 amount, uint256 nonce, bytes32 sig)", // sig not bytes
+		"Authorized(address recipient, uint256 amount, uint256 nonce, bytes indexed sig)",
+		"Authorized(address recipient, uint7 amount, uint256 nonce)",
+		"Authorized(address recipient, uint256 amount, uint256 value, uint256 nonce)", // two sizes
+		"Authorized(address recipient, uint256 amount, uint256)",
+	} {
+		if _, err := ParseEvent(bad); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package fetch bootstraps a prover host: it downloads the bundle of a
+// profile's setup (settlement_<profile>.ddmbundle) from a bucket, web
+// server or directory, checks every member against the manifest, the
+// manifest against a pinned digest or the release keys' signature
+// (manifest_<profile>.sig), and only then installs ccs, pk, vk and manifest
+// into the local artifact layout, the manifest last.
+package fetch
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+	"gnarking/hsm"
+	"gnarking/ioutilx"
+	"gnarking/retry"
+)
+
+// Source serves the files of a published setup by name.
+type Source interface {
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// Parse reads a -from location: s3://bucket/prefix, http(s)://host/path,
+// or a directory (file:///path or a plain path). S3 is signed with the
+// AWS_* credentials when they are set, region and endpoint from
+// AWS_REGION and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL, path-style, for
+// S3-compatible stores).
+func Parse(from string, policy retry.Policy) (Source, error) {
+	u, err := url.Parse(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: -from %q: %w", errs.ErrInvalidInput, from, err)
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%w: -from %q: no bucket", errs.ErrInvalidInput, from)
+		}
+		return &S3{
+			Bucket:      u.Host,
+			Prefix:      strings.Trim(u.Path, "/"),
+			Region:      cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+			Endpoint:    cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+			Credentials: hsm.EnvCredentials(),
+			Retry:       policy,
+		}, nil
+	case "http", "https":
+		return &HTTP{URL: from, Retry: policy}, nil
+	case "file":
+		return Dir(u.Path), nil
+	case "":
+		return Dir(from), nil
+	}
+	return nil, fmt.Errorf("%w: -from %q: want s3://, http(s)://, file:// or a directory", errs.ErrInvalidInput, from)
+}
+
+// Dir is a local directory, e.g. a mounted volume.
+type Dir string
+
+func (d Dir) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(string(d), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s in %s", errs.ErrNotFound, name, d)
+	}
+	return f, err
+}
+
+// HTTP is a web server holding the files under URL.
+type HTTP struct {
+	URL   string
+	HTTP  *http.Client // http.DefaultClient when nil
+	Retry retry.Policy // of each request, not of the body's transfer
+}
+
+func (h *HTTP) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return get(ctx, h.HTTP, h.Retry, strings.TrimSuffix(h.URL, "/")+"/"+url.PathEscape(name), nil)
+}
+
+// S3 is a bucket, read with GetObject.
+type S3 struct {
+	Bucket      string
+	Prefix      string // key prefix, no slashes around
+	Region      string
+	Endpoint    string // path-style base URL, default virtual-hosted AWS
+	Credentials hsm.Credentials
+	HTTP        *http.Client // http.DefaultClient when nil
+	Retry       retry.Policy
+
+	now func() time.Time // tests
+}
+
+func (s *S3) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	key := url.PathEscape(name)
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + key
+	}
+	endpoint := "https://" + s.Bucket + ".s3." + s.Region + ".amazonaws.com/" + key
+	if s.Endpoint != "" {
+		endpoint = strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + key
+	}
+	return get(ctx, s.HTTP, s.Retry, endpoint, func(req *http.Request) {
+		if s.Credentials.AccessKeyID == "" {
+			return // a public bucket
+		}
+		now := time.Now
+		if s.now != nil {
+			now = s.now
+		}
+		// the hash of the empty body GET sends
+		req.Header.Set("X-Amz-Content-Sha256", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		hsm.SignV4(req, nil, s.Credentials, s.Region, "s3", now().UTC())
+	})
+}
+
+// get GETs endpoint, signed by sign (per attempt: a signature is dated),
+// and returns the body of a 200.
+func get(ctx context.Context, client *http.Client, policy retry.Policy, endpoint string, sign func(*http.Request)) (io.ReadCloser, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return retry.Get(ctx, policy, func(ctx context.Context) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+		}
+		if sign != nil {
+			sign(req)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		err = errs.ErrUnavailable
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			err = errs.ErrNotFound
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+			err = errs.ErrPolicyRejected
+		case resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+			err = errs.ErrInvalidInput
+		}
+		return nil, fmt.Errorf("%w: GET %s: %s: %s", err, endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	})
+}
+
+// BundleName is the published bundle of profile's setup.
+func BundleName(profile string) string {
+	return fmt.Sprintf("settlement_%s%s", profile, artifacts.BundleExt)
+}
+
+// SigName is the release signature of profile's manifest, hex.
+func SigName(profile string) string { return fmt.Sprintf("manifest_%s.sig", profile) }
+
+// Trust is what a fetched manifest must match: its digest (Pin), or a
+// signature by one of Keys. Both set, both must hold.
+type Trust struct {
+	Pin  string // hex artifacts.ManifestDigest
+	Keys []ed25519.PublicKey
+}
+
+// Check checks m against t, sig being the release signature (nil when
+// none was published).
+func (t Trust) Check(m *artifacts.Manifest, sig []byte) error {
+	if err := t.valid(); err != nil {
+		return err
+	}
+	if t.Pin != "" {
+		d, err := artifacts.ManifestDigest(m)
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(d[:]); !strings.EqualFold(strings.TrimPrefix(t.Pin, "0x"), got) {
+			return fmt.Errorf("%w: manifest digest %s, pinned %s", errs.ErrArtifactMismatch, got, t.Pin)
+		}
+	}
+	if len(t.Keys) > 0 {
+		if sig == nil {
+			return fmt.Errorf("%w: no release signature %s published", errs.ErrVerificationFailed, SigName(m.Profile))
+		}
+		return artifacts.VerifyManifest(m, sig, t.Keys)
+	}
+	return nil
+}
+
+func (t Trust) valid() error {
+	if t.Pin == "" && len(t.Keys) == 0 {
+		return fmt.Errorf("%w: nothing to trust the manifest by: pin its digest or name the release keys", errs.ErrInvalidInput)
+	}
+	return nil
+}
+
+// Installed is one file Install wrote.
+type Installed struct {
+	Name string
+	Size int64
+}
+
+// Install fetches profile's bundle and signature from src, checks them
+// against trust and check (nil: none; ddm fetch checks the manifest
+// against the profile), and installs the members the manifest pins into
+// dir as member files (pk.groth16 is pk_<profile>.groth16) and the manifest
+// as manifest_<profile>.json. Members are staged in dir and renamed into
+// place only once all are in and checked, so a failed fetch leaves the old
+// setup whole.
+func Install(ctx context.Context, src Source, profile, dir string, trust Trust, check func(*artifacts.Manifest) error) ([]Installed, error) {
+	// before a pk's worth of download
+	if err := trust.valid(); err != nil {
+		return nil, err
+	}
+	var sig []byte
+	if len(trust.Keys) > 0 {
+		r, err := src.Open(ctx, SigName(profile))
+		if err != nil && !errors.Is(err, errs.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			b, err := io.ReadAll(io.LimitReader(r, 1<<10))
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errs.ErrUnavailable, SigName(profile), err)
+			}
+			if sig, err = hex.DecodeString(strings.TrimSpace(string(b))); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errs.ErrInvalidInput, SigName(profile), err)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	stage, err := os.MkdirTemp(dir, ".fetch-"+profile+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	r, err := src.Open(ctx, BundleName(profile))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// a setup bundle holds ccs, pk and vk; ReadBundle checks each against
+	// the manifest's hash as it is staged
+	members := map[string]io.ReaderFrom{}
+	for _, name := range []string{"ccs.groth16", "pk.groth16", "vk.groth16"} {
+		members[name] = stagedFile(filepath.Join(stage, name))
+	}
+	m, err := artifacts.ReadBundle(r, members)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", BundleName(profile), err)
+	}
+	if m.Profile != profile {
+		return nil, fmt.Errorf("%w: %s holds the setup of profile %q", errs.ErrArtifactMismatch, BundleName(profile), m.Profile)
+	}
+	if err := trust.Check(m, sig); err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(m); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []Installed
+	for _, member := range slices.Sorted(maps.Keys(members)) {
+		kind, ext, _ := strings.Cut(member, ".")
+		name := filepath.Join(dir, fmt.Sprintf("%s_%s.%s", kind, profile, ext))
+		if err := os.Rename(filepath.Join(stage, member), name); err != nil {
+			return out, err
+		}
+		out = append(out, Installed{name, m.Files[member].Size})
+	}
+	// the manifest last: it pins files that are all in place
+	name := filepath.Join(dir, fmt.Sprintf("manifest_%s.json", profile))
+	if err := artifacts.WriteFile(name, m, false); err != nil {
+		return out, err
+	}
+	size, err := ioutilx.SizeOf(m)
+	return append(out, Installed{name, size}), err
+}
+
+// stagedFile writes what it reads to a file, fsynced.
+type stagedFile string
+
+func (s stagedFile) ReadFrom(r io.Reader) (int64, error) {
+	f, err := os.OpenFile(string(s), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
@@ -0,0 +1,134 @@
+package fetch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+	"gnarking/hsm"
+	"gnarking/retry"
+)
+
+// publishSetup writes a bundle of fake members for profile 8 to dir, with
+// its release signature by key, and returns the manifest.
+func publishSetup(t *testing.T, dir string, key ed25519.PrivateKey) *artifacts.Manifest {
+	t.Helper()
+	members := map[string]io.WriterTo{}
+	m := &artifacts.Manifest{Version: artifacts.ManifestVersion, Profile: "8", N: 8}
+	for _, name := range []string{"ccs.groth16", "pk.groth16", "vk.groth16"} {
+		members[name] = artifacts.WriterFunc(func(w io.Writer) error {
+			_, err := io.WriteString(w, strings.Repeat(name, 100))
+			return err
+		})
+		if err := m.Add(name, members[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Create(filepath.Join(dir, BundleName("8")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := artifacts.WriteBundle(f, m, []string{"ccs.groth16", "pk.groth16", "vk.groth16"}, members); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := artifacts.SignManifest(key, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, SigName("8")), []byte(hex.EncodeToString(sig)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestInstall(t *testing.T) {
+	ctx := context.Background()
+	pub, key, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+	src := t.TempDir()
+	m := publishSetup(t, src, key)
+	digest, err := artifacts.ManifestDigest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := t.TempDir()
+	for name, trust := range map[string]Trust{
+		"nothing":   {},
+		"wrong key": {Keys: []ed25519.PublicKey{other}},
+		"wrong pin": {Pin: strings.Repeat("00", 32), Keys: []ed25519.PublicKey{pub}},
+	} {
+		if _, err := Install(ctx, Dir(src), "8", host, trust, nil); err == nil {
+			t.Errorf("%s: installed", name)
+		}
+	}
+	if entries, _ := os.ReadDir(host); len(entries) != 0 {
+		t.Fatalf("a refused fetch left %d files", len(entries))
+	}
+
+	installed, err := Install(ctx, Dir(src), "8", host, Trust{Pin: hex.EncodeToString(digest[:]), Keys: []ed25519.PublicKey{other, pub}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 4 || filepath.Base(installed[3].Name) != "manifest_8.json" {
+		t.Fatalf("installed %+v", installed)
+	}
+	pk, err := os.ReadFile(filepath.Join(host, "pk_8.groth16"))
+	if err != nil || string(pk) != strings.Repeat("pk.groth16", 100) {
+		t.Fatalf("pk %q, %v", pk, err)
+	}
+
+	// a signature that does not check
+	os.WriteFile(filepath.Join(src, SigName("8")), []byte("00"), 0o644)
+	if _, err := Install(ctx, Dir(src), "8", t.TempDir(), Trust{Keys: []ed25519.PublicKey{pub}}, nil); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Errorf("bad signature: %v", err)
+	}
+	if _, err := Install(ctx, Dir(t.TempDir()), "8", t.TempDir(), Trust{Keys: []ed25519.PublicKey{pub}}, nil); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("nothing published: %v", err)
+	}
+}
+
+func TestS3(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		if r.URL.Path != "/bucket/setups/v2/"+SigName("8") {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "00")
+	}))
+	defer srv.Close()
+
+	src, err := Parse("s3://bucket/setups/v2/", retry.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := src.(*S3)
+	s.Endpoint, s.Region = srv.URL, "eu-west-1"
+	s.Credentials = hsm.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	s.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	r, err := s.Open(context.Background(), SigName("8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if auth := got.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260102/eu-west-1/s3/aws4_request") || !strings.Contains(auth, "x-amz-content-sha256") {
+		t.Errorf("authorization %q", auth)
+	}
+	if _, err := s.Open(context.Background(), BundleName("8")); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("missing object: %v", err)
+	}
+}
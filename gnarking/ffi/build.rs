@@ -0,0 +1,21 @@
+//! Links libddm, built into gnarking/ by default:
+//!
+//!     go build -tags cshared -buildmode=c-shared -o libddm.so ./cmd/ddm
+//!
+//! DDM_LIB_DIR overrides where it is looked for.
+
+use std::env;
+use std::path::PathBuf;
+
+fn main() {
+    let dir = match env::var("DDM_LIB_DIR") {
+        Ok(dir) => PathBuf::from(dir),
+        Err(_) => PathBuf::from(env::var("CARGO_MANIFEST_DIR").unwrap()).join(".."),
+    };
+    println!("cargo:rerun-if-env-changed=DDM_LIB_DIR");
+    println!("cargo:rustc-link-search=native={}", dir.display());
+    println!("cargo:rustc-link-lib=dylib=ddm");
+    // this crate's tests find it without LD_LIBRARY_PATH; dependents
+    // set it, or an rpath of their own
+    println!("cargo:rustc-link-arg=-Wl,-rpath,{}", dir.display());
+}
@@ -0,0 +1,45 @@
+/*
+ * libddm: the ddm prover and verifier in-process, for non-Go hosts.
+ *
+ * Build it from gnarking/ with
+ *
+ *     go build -tags cshared -buildmode=c-shared -o libddm.so ./cmd/ddm
+ *
+ * Every call but ddm_abi_version and ddm_free returns an HTTP status, 200
+ * on success, and sets *out to a NUL-terminated JSON body the caller frees
+ * with ddm_free. ddm_prove and ddm_verify answer exactly what ddm serve's
+ * POST /prove and POST /verify would; errors are {"code", "error"} with
+ * the codes of errs. Calls are safe from any thread.
+ */
+#ifndef DDM_H
+#define DDM_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define DDM_ABI_VERSION 1
+
+/* The ABI version the library implements; refuse it unless it is
+ * DDM_ABI_VERSION. */
+int ddm_abi_version(void);
+
+/* Loads the prover and verifier. config_json is
+ * {"dir": "./artifact", "profiles": ["8"], "prove": true, "verify_cache": 0},
+ * as ddm serve's -vk-dir, -profiles, -prove and -verify-cache. Calling it
+ * again replaces the loaded profiles. */
+int ddm_init(const char *config_json, char **out);
+
+/* POST /prove: batch_json is a prove request, *out the proof reply. */
+int ddm_prove(const char *batch_json, char **out);
+
+/* POST /verify: request_json is {"profile", "proof", "public"}. */
+int ddm_verify(const char *request_json, char **out);
+
+void ddm_free(char *s);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,114 @@
+//! The ddm prover and verifier in-process, over libddm's C ABI (`ddm.h`).
+//!
+//! Requests and replies are the JSON of ddm serve's POST /prove and
+//! POST /verify, unparsed: this crate only moves strings across the
+//! boundary and frees what the library allocated.
+//!
+//! ```no_run
+//! ddm_ffi::init(r#"{"dir": "./artifact", "profiles": ["8"], "prove": true}"#)?;
+//! let proof = ddm_ffi::prove(r#"{"profile": "8", "recipient": "...", "rows": []}"#)?;
+//! # Ok::<(), ddm_ffi::Error>(())
+//! ```
+
+use std::ffi::{CStr, CString, c_char, c_int};
+use std::fmt;
+
+/// The libddm ABI this crate is written against.
+pub const ABI_VERSION: i32 = 1;
+
+unsafe extern "C" {
+    fn ddm_abi_version() -> c_int;
+    fn ddm_init(config_json: *const c_char, out: *mut *mut c_char) -> c_int;
+    fn ddm_prove(batch_json: *const c_char, out: *mut *mut c_char) -> c_int;
+    fn ddm_verify(request_json: *const c_char, out: *mut *mut c_char) -> c_int;
+    fn ddm_free(s: *mut c_char);
+}
+
+type Call = unsafe extern "C" fn(*const c_char, *mut *mut c_char) -> c_int;
+
+/// A call that did not answer 200: the HTTP status the server would have
+/// answered and its JSON body, `{"code", "error"}` or a failed verification.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Error {
+    pub status: i32,
+    pub body: String,
+}
+
+impl fmt::Display for Error {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "ddm: status {}: {}", self.status, self.body.trim_end())
+    }
+}
+
+impl std::error::Error for Error {}
+
+/// The ABI version of the linked libddm.
+pub fn abi_version() -> i32 {
+    unsafe { ddm_abi_version() }
+}
+
+/// Loads the prover and verifier, see `ddm_init` in `ddm.h`. Refuses a
+/// libddm of another ABI version.
+pub fn init(config_json: &str) -> Result<String, Error> {
+    let version = abi_version();
+    if version != ABI_VERSION {
+        return Err(Error {
+            status: 500,
+            body: format!(
+                r#"{{"code":"artifact_mismatch","error":"libddm ABI {version}, want {ABI_VERSION}"}}"#
+            ),
+        });
+    }
+    call(ddm_init, config_json)
+}
+
+/// Proves a batch: `batch_json` is a POST /prove request.
+pub fn prove(batch_json: &str) -> Result<String, Error> {
+    call(ddm_prove, batch_json)
+}
+
+/// Verifies a proof: `request_json` is a POST /verify request.
+pub fn verify(request_json: &str) -> Result<String, Error> {
+    call(ddm_verify, request_json)
+}
+
+fn call(f: Call, arg: &str) -> Result<String, Error> {
+    let arg = CString::new(arg).map_err(|_| Error {
+        status: 400,
+        body: r#"{"code":"invalid_input","error":"invalid_input: NUL byte in request"}"#.into(),
+    })?;
+    let mut out: *mut c_char = std::ptr::null_mut();
+    let status = unsafe { f(arg.as_ptr(), &mut out) };
+    let body = if out.is_null() {
+        String::new()
+    } else {
+        let body = unsafe { CStr::from_ptr(out) }.to_string_lossy().into_owned();
+        unsafe { ddm_free(out) };
+        body
+    };
+    if status == 200 {
+        Ok(body)
+    } else {
+        Err(Error { status, body })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn abi() {
+        assert_eq!(abi_version(), ABI_VERSION);
+    }
+
+    #[test]
+    fn errors() {
+        // a config that is not JSON, and a call without a successful init
+        let err = init("{").unwrap_err();
+        assert_eq!(err.status, 400, "{err}");
+        assert!(err.body.contains(r#""code":"invalid_input""#), "{err}");
+        let err = prove("{}").unwrap_err();
+        assert_eq!(err.status, 503, "{err}");
+    }
+}
@@ -0,0 +1,325 @@
+// Package gas measures what settling a batch costs on-chain: it runs the
+// exported Solidity verifier's runtime bytecode in go-ethereum's in-process
+// EVM with the batch's calldata, and prices each submission format the
+// exporter can produce with exact execution gas and EIP-2028/EIP-7623
+// calldata gas, so a deployment picks a format on measurements rather than
+// on estimate.VerifyGas.
+package gas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/params"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+)
+
+// Option is a submission format.
+type Option string
+
+const (
+	// OptionCalldata calls verifyProof(uint256[8], uint256[n]), the
+	// calldata ddm export writes.
+	OptionCalldata Option = "calldata"
+	// OptionCompressed calls verifyCompressedProof(uint256[4], uint256[n])
+	// with the proof the verifier's own compressProof returns: half the
+	// proof words for the point decompression the verifier then does.
+	// The public inputs stay uint256[n]; the verifier's ABI fixes them.
+	OptionCompressed Option = "compressed"
+	// OptionKeccakRows posts the rows with the proof, as a bytes argument,
+	// and the contract recomputes a keccak BatchDataRoot from them.
+	OptionKeccakRows Option = "keccak-rows"
+	// OptionBlob posts the rows in EIP-4844 blobs; the contract checks each
+	// blob's versioned hash and opens it at one point with the
+	// point-evaluation precompile.
+	OptionBlob Option = "blob"
+)
+
+// Options lists every Option.
+var Options = []Option{OptionCalldata, OptionCompressed, OptionKeccakRows, OptionBlob}
+
+// ParseOption reads an Option by name.
+func ParseOption(s string) (Option, error) {
+	if o := Option(s); slices.Contains(Options, o) {
+		return o, nil
+	}
+	return "", fmt.Errorf("%w: unknown option %q, want one of %v", errs.ErrInvalidInput, s, Options)
+}
+
+// dataOption reports whether o carries the rows.
+func (o Option) dataOption() bool { return o == OptionKeccakRows || o == OptionBlob }
+
+// Batch is what Measure prices.
+type Batch struct {
+	Proof  artifacts.ProofWrap
+	Inputs artifacts.PublicInputsHex
+	// Rows are the batch rows packed as the keccak BatchDataRoot absorbs
+	// them (PackRows); without them the data options are skipped.
+	Rows []byte
+	// KeccakRoot, when set, is the BatchDataRoot input of a keccak setup:
+	// OptionKeccakRows then checks the root it recomputes against it.
+	KeccakRoot *big.Int
+}
+
+// PackRows packs rows as the keccak BatchDataRoot absorbs them: Size and
+// Nonce of each row, 8 bytes big-endian each, in root order.
+func PackRows(sizes, nonces []uint64) ([]byte, error) {
+	if len(sizes) != len(nonces) {
+		return nil, fmt.Errorf("%w: %d sizes, %d nonces", errs.ErrInvalidBatch, len(sizes), len(nonces))
+	}
+	out := make([]byte, 0, 16*len(sizes))
+	for i := range sizes {
+		out = binary.BigEndian.AppendUint64(out, sizes[i])
+		out = binary.BigEndian.AppendUint64(out, nonces[i])
+	}
+	return out, nil
+}
+
+// Measurement is the gas of one submission.
+type Measurement struct {
+	Option        Option `json:"option"`
+	CalldataBytes int    `json:"calldata_bytes"`
+	// Intrinsic is the 21000 base plus EIP-2028 calldata gas.
+	Intrinsic uint64 `json:"intrinsic_gas"`
+	// Execution is what the EVM ran: the verifier, plus the data check
+	// for the data options, as one contract would run both.
+	Execution uint64 `json:"execution_gas"`
+	// Total is Intrinsic + Execution, or the EIP-7623 calldata floor
+	// when that is higher.
+	Total   uint64 `json:"total_gas"`
+	Blobs   int    `json:"blobs,omitempty"`
+	BlobGas uint64 `json:"blob_gas,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+// CostUSD prices m at a gas price and blob gas price in gwei.
+func (m Measurement) CostUSD(gasPriceGwei, blobGasPriceGwei, ethUSD float64) float64 {
+	return (float64(m.Total)*gasPriceGwei + float64(m.BlobGas)*blobGasPriceGwei) * 1e-9 * ethUSD
+}
+
+// callGas bounds one call; a verification uses a few hundred thousand.
+const callGas = 30_000_000
+
+// Measure runs each option against code, the runtime bytecode of the
+// verifier ExportSolidity writes for the proof's vk. The verifier must
+// accept the proof in every option: a revert is errs.ErrVerificationFailed,
+// usually bytecode of another vk.
+func Measure(code []byte, b Batch, opts []Option) ([]Measurement, error) {
+	var out []Measurement
+	for _, o := range opts {
+		if o.dataOption() && len(b.Rows) == 0 {
+			continue
+		}
+		m, err := measure(code, b, o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o, err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func measure(code []byte, b Batch, o Option) (Measurement, error) {
+	words, err := hexWords(append(b.Proof[:], b.Inputs...))
+	if err != nil {
+		return Measurement{}, err
+	}
+	proof, inputs := words[:8], words[8:]
+	verifySig := fmt.Sprintf("verifyProof(uint256[8],uint256[%d])", len(inputs))
+	call := abiCall(verifySig, words...)
+
+	m := Measurement{Option: o}
+	if o == OptionCompressed {
+		ret, _, err := run(code, abiCall("compressProof(uint256[8])", proof...), nil)
+		if err != nil || len(ret) != 4*32 {
+			return m, fmt.Errorf("%w: compressProof: %d bytes, %v", errs.ErrVerificationFailed, len(ret), err)
+		}
+		compressed := make([][]byte, 4)
+		for i := range compressed {
+			compressed[i] = ret[32*i : 32*(i+1)]
+		}
+		call = abiCall(fmt.Sprintf("verifyCompressedProof(uint256[4],uint256[%d])", len(inputs)), append(compressed, inputs...)...)
+	}
+	if _, m.Execution, err = run(code, call, nil); err != nil {
+		return m, fmt.Errorf("%w: the verifier reverts (bytecode of another vk?): %v", errs.ErrVerificationFailed, err)
+	}
+	data := call
+
+	switch o {
+	case OptionKeccakRows:
+		ret, used, err := run(keccakCode, b.Rows, nil)
+		if err != nil || len(ret) != 32 {
+			return m, fmt.Errorf("keccak: %d bytes, %v", len(ret), err)
+		}
+		m.Execution += used
+		data = append(data, bytesArg(len(words), b.Rows)...)
+		if b.KeccakRoot != nil {
+			if root := new(big.Int).SetBytes(ret[1:]); root.Cmp(b.KeccakRoot) != 0 {
+				return m, fmt.Errorf("%w: the rows hash to %#x, BatchDataRoot is %#x", errs.ErrInvalidBatch, root, b.KeccakRoot)
+			}
+			m.Note = "root matches BatchDataRoot"
+		} else {
+			m.Note = "needs a keccak setup (--data-hash keccak)"
+		}
+	case OptionBlob:
+		blobs := toBlobs(b.Rows)
+		for _, blob := range blobs {
+			opening, vh, err := openBlob(blob, crypto.Keccak256(call))
+			if err != nil {
+				return m, err
+			}
+			_, used, err := run(blobCode, opening, []common.Hash{vh})
+			if err != nil {
+				return m, fmt.Errorf("%w: point evaluation: %v", errs.ErrVerificationFailed, err)
+			}
+			m.Execution += used
+			data = append(data, opening...)
+		}
+		m.Blobs = len(blobs)
+		m.BlobGas = uint64(len(blobs)) * params.BlobTxBlobGasPerBlob
+		m.Note = fmt.Sprintf("%d rows per blob", rowsPerBlob)
+	}
+
+	m.CalldataBytes = len(data)
+	if m.Intrinsic, err = core.IntrinsicGas(data, nil, nil, false, true, true, true); err != nil {
+		return m, err
+	}
+	floor, err := core.FloorDataGas(data)
+	if err != nil {
+		return m, err
+	}
+	m.Total = max(m.Intrinsic+m.Execution, floor)
+	return m, nil
+}
+
+// run calls code with input in a fresh state and returns what it used.
+func run(code, input []byte, blobHashes []common.Hash) (ret []byte, used uint64, err error) {
+	st, err := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if err != nil {
+		return nil, 0, err
+	}
+	addr := common.BytesToAddress([]byte("verifier"))
+	st.CreateAccount(addr)
+	st.SetCode(addr, code)
+	ret, left, err := runtime.Call(addr, input, &runtime.Config{State: st, GasLimit: callGas, BlobHashes: blobHashes})
+	return ret, callGas - left, err
+}
+
+// keccakCode returns keccak256 of its calldata:
+//
+//	CALLDATASIZE PUSH0 PUSH0 CALLDATACOPY
+//	CALLDATASIZE PUSH0 KECCAK256 PUSH0 MSTORE
+//	PUSH1 32 PUSH0 RETURN
+var keccakCode = common.FromHex("365f5f37" + "365f205f52" + "60205ff3")
+
+// blobCode takes z, y, commitment and proof of blob 0 as calldata, and
+// reverts unless the point-evaluation precompile accepts them with the
+// blob's versioned hash:
+//
+//	PUSH0 BLOBHASH PUSH0 MSTORE
+//	CALLDATASIZE PUSH0 PUSH1 32 CALLDATACOPY
+//	PUSH1 64 PUSH0 PUSH1 192 PUSH0 PUSH1 0x0a GAS STATICCALL
+//	PUSH1 25 JUMPI PUSH0 PUSH0 REVERT JUMPDEST STOP
+var blobCode = common.FromHex("5f495f52" + "365f602037" + "60405f60c05f600a5afa" + "6019575f5ffd5b00")
+
+// Blobs hold 31 bytes in each 32-byte field element, keeping every
+// element below the BLS12-381 scalar modulus.
+const (
+	blobChunk   = 31
+	blobBytes   = params.BlobTxFieldElementsPerBlob * blobChunk
+	rowsPerBlob = blobBytes / 16
+)
+
+func toBlobs(rows []byte) []*kzg4844.Blob {
+	var out []*kzg4844.Blob
+	for len(rows) > 0 {
+		part := rows[:min(len(rows), rowsPerBlob*16)]
+		rows = rows[len(part):]
+		blob := new(kzg4844.Blob)
+		for i := 0; len(part) > 0; i++ {
+			n := copy(blob[32*i+1:32*(i+1)], part)
+			part = part[n:]
+		}
+		out = append(out, blob)
+	}
+	return out
+}
+
+// openBlob commits to blob and opens it at a point derived from seed, as
+// a contract would from the batch: the calldata blobCode takes and the
+// blob's versioned hash.
+func openBlob(blob *kzg4844.Blob, seed []byte) ([]byte, common.Hash, error) {
+	commitment, err := kzg4844.BlobToCommitment(blob)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	var z kzg4844.Point
+	copy(z[:], seed)
+	z[0] &= 0x3f // below the scalar modulus
+	proof, y, err := kzg4844.ComputeProof(blob, z)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	vh := kzg4844.CalcBlobHashV1(sha256.New(), &commitment)
+	return slices.Concat(z[:], y[:], commitment[:], proof[:]), vh, nil
+}
+
+// abiCall encodes a call of sig with static uint256 arguments.
+func abiCall(sig string, words ...[]byte) []byte {
+	out := crypto.Keccak256([]byte(sig))[:4]
+	for _, w := range words {
+		out = append(out, common.LeftPadBytes(w, 32)...)
+	}
+	return out
+}
+
+// bytesArg is data as a trailing ABI bytes argument after head static
+// words: its offset, length and contents padded to words.
+func bytesArg(head int, data []byte) []byte {
+	out := make([]byte, 64, 64+len(data)+31)
+	binary.BigEndian.PutUint64(out[24:], uint64(32*(head+1)))
+	binary.BigEndian.PutUint64(out[56:], uint64(len(data)))
+	out = append(out, data...)
+	return append(out, make([]byte, (32-len(data)%32)%32)...)
+}
+
+func hexWords(ws []string) ([][]byte, error) {
+	out := make([][]byte, len(ws))
+	for i, w := range ws {
+		b, err := hex.DecodeString(strings.TrimPrefix(w, "0x"))
+		if err != nil || len(b) > 32 {
+			return nil, fmt.Errorf("%w: word %d: %q", errs.ErrInvalidInput, i, w)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
+
+// WriteTable writes ms as an aligned table, with each row's cost at the
+// given prices.
+func WriteTable(w io.Writer, ms []Measurement, gasPriceGwei, blobGasPriceGwei, ethUSD float64) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-12s %9s %10s %10s %10s %9s %12s  %s\n", "option", "calldata", "intrinsic", "execution", "total", "blob gas", "USD", "")
+	for _, m := range ms {
+		fmt.Fprintf(&b, "%-12s %8dB %10d %10d %10d %9d %12.6f  %s\n",
+			m.Option, m.CalldataBytes, m.Intrinsic, m.Execution, m.Total, m.BlobGas, m.CostUSD(gasPriceGwei, blobGasPriceGwei, ethUSD), m.Note)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,120 @@
+package gas
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// the profile 8 setup, proof and verifier bytecode of the EVM parity test
+const evmDir = "../verifier/testdata/evm/"
+
+func readTestdata(t *testing.T, name string, r io.ReaderFrom) {
+	t.Helper()
+	f, err := os.Open(evmDir + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := r.ReadFrom(f); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	var proof groth16_bn254.Proof
+	var pub circuit.SettlementCircuitPublic
+	readTestdata(t, "proof_8.groth16", &artifacts.Proof{Proof: &proof})
+	readTestdata(t, "public_8.json", &pub)
+	code, err := os.ReadFile(evmDir + "settlement_verifier_8.bin-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err = hex.DecodeString(strings.TrimSpace(string(code))); err != nil {
+		t.Fatal(err)
+	}
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Batch
+	if b.Inputs, err = artifacts.NewPublicInputsHexFromWitness(wit); err != nil {
+		t.Fatal(err)
+	}
+	if b.Proof, err = artifacts.NewProofWrap(&proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// no rows: the data options are skipped
+	ms, err := Measure(code, b, Options)
+	if err != nil || len(ms) != 2 {
+		t.Fatalf("Measure: %d measurements, %v", len(ms), err)
+	}
+	plain, compressed := ms[0], ms[1]
+	if n := 4 + 32*(8+len(b.Inputs)); plain.CalldataBytes != n || compressed.CalldataBytes != n-4*32 {
+		t.Errorf("calldata %d and %d bytes, want %d and %d", plain.CalldataBytes, compressed.CalldataBytes, n, n-4*32)
+	}
+	// a pairing check alone is 181000
+	if plain.Execution < 181_000 || plain.Execution > 400_000 || plain.Total != plain.Intrinsic+plain.Execution {
+		t.Errorf("calldata: %+v", plain)
+	}
+	if compressed.Execution <= plain.Execution {
+		t.Errorf("compressed proof executes in %d gas, uncompressed in %d", compressed.Execution, plain.Execution)
+	}
+
+	sizes, nonces := make([]uint64, 8), make([]uint64, 8)
+	for i := range sizes {
+		sizes[i], nonces[i] = uint64(100*i+1), uint64(i+1)
+	}
+	if b.Rows, err = PackRows(sizes, nonces); err != nil {
+		t.Fatal(err)
+	}
+	ms, err = Measure(code, b, []Option{OptionKeccakRows, OptionBlob})
+	if err != nil || len(ms) != 2 {
+		t.Fatalf("Measure: %d measurements, %v", len(ms), err)
+	}
+	rows, blob := ms[0], ms[1]
+	if rows.CalldataBytes != plain.CalldataBytes+64+128 || rows.Execution <= plain.Execution {
+		t.Errorf("keccak-rows: %+v", rows)
+	}
+	// the point evaluation precompile is 50000
+	if blob.Blobs != 1 || blob.BlobGas != 1<<17 || blob.Execution < plain.Execution+50_000 {
+		t.Errorf("blob: %+v", blob)
+	}
+
+	root, err := circuit.BatchDataRoot(circuit.DataHashKeccak, bigs(sizes), bigs(nonces))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.KeccakRoot = root
+	if _, err := Measure(code, b, []Option{OptionKeccakRows}); err != nil {
+		t.Errorf("keccak root of the rows: %v", err)
+	}
+	b.KeccakRoot = new(big.Int).Add(root, big.NewInt(1))
+	if _, err := Measure(code, b, []Option{OptionKeccakRows}); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Errorf("another root: %v, want ErrInvalidBatch", err)
+	}
+
+	b.Proof[0] = "0x01"
+	if _, err := Measure(code, b, []Option{OptionCalldata}); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Errorf("tampered proof: %v, want ErrVerificationFailed", err)
+	}
+}
+
+func bigs(vs []uint64) []*big.Int {
+	out := make([]*big.Int, len(vs))
+	for i, v := range vs {
+		out[i] = new(big.Int).SetUint64(v)
+	}
+	return out
+}
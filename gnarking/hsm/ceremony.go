@@ -0,0 +1,164 @@
+package hsm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Ceremony is the key ceremony for backend as markdown, written from the
+// constants the code wraps and unwraps with, so the published procedure
+// cannot drift from what the signer does.
+func Ceremony(backend string) ([]byte, error) {
+	if err := checkBackend(backend); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	p := func(format string, args ...any) { fmt.Fprintf(&b, format+"\n", args...) }
+	binding := []string{
+		fmt.Sprintf("`%s` = `%s`", BindPurpose, Purpose),
+		fmt.Sprintf("`%s` = the derivation path, e.g. `m/1'/7'`", BindPath),
+		fmt.Sprintf("`%s` = the hex compressed public key", BindPk),
+	}
+
+	p("# Key ceremony: EdDSA signing keys wrapped by %s", backendTitle(backend))
+	p("")
+	p("Generated by `ddm keys ceremony -backend %s` from package hsm; do not edit.", backend)
+	p("")
+	p("## What is protected")
+	p("")
+	p("Settlement batches are signed with EdDSA on the BN254 twisted Edwards")
+	p("curve. No key store implements that curve, so the store holds a wrapping")
+	p("key instead: each signing key's 32-byte seed is encrypted under it, and")
+	p("the signer decrypts the seed only to sign (for one signature, or for")
+	p("`Signer.Hold`), then wipes it. The MiMC digest and the scalar arithmetic")
+	p("run in the signing process.")
+	p("")
+	p("Every wrapped seed is bound to:")
+	p("")
+	for _, l := range binding {
+		p("- %s", l)
+	}
+	p("")
+	switch backend {
+	case "kms":
+		p("The binding is the KMS encryption context of every Encrypt and Decrypt")
+		p("call: it is logged by CloudTrail and key policies can require it.")
+	case "pkcs11":
+		p("The binding is the additional authenticated data of %s, one", PKCS11Mechanism)
+		p("`key=value` line per entry, sorted by key; a seed unwraps only with the")
+		p("binding it was wrapped with.")
+	}
+	p("")
+	p("## Roles")
+	p("")
+	p("- **Key custodians** (at least two): hold the master seed for the time of")
+	p("  the ceremony and witness its destruction.")
+	p("- **Store administrator**: creates the wrapping key and its policy.")
+	p("- **Signing hosts**: unwrap to sign; they never see the master seed.")
+	p("")
+	p("## 1. Create the wrapping key")
+	p("")
+	switch backend {
+	case "kms":
+		p("Create a symmetric encryption key (`SYMMETRIC_DEFAULT`, key usage")
+		p("`ENCRYPT_DECRYPT`) in the region the signing hosts run in. Use the key")
+		p("ARN, not an alias, as the key id: key files pin it.")
+		p("")
+		p("Grant the signing hosts' role `kms:Decrypt` only, conditioned on the")
+		p("binding:")
+		p("")
+		p("```json")
+		p("{")
+		p("  \"Effect\": \"Allow\",")
+		p("  \"Principal\": {\"AWS\": \"arn:aws:iam::<account>:role/<signer>\"},")
+		p("  \"Action\": \"kms:Decrypt\",")
+		p("  \"Resource\": \"*\",")
+		p("  \"Condition\": {\"StringEquals\": {\"kms:EncryptionContext:%s\": \"%s\"}}", BindPurpose, Purpose)
+		p("}")
+		p("```")
+		p("")
+		p("Grant `kms:Encrypt` and `kms:Decrypt` to the ceremony role only, for the")
+		p("time of the ceremony.")
+	case "pkcs11":
+		p("On the token, generate an AES-256 secret key (`CKK_AES`, `CKA_VALUE_LEN`")
+		p("32) with a unique `CKA_LABEL`, `CKA_SENSITIVE` and `CKA_TOKEN` true,")
+		p("`CKA_EXTRACTABLE` false, `CKA_ENCRYPT` and `CKA_DECRYPT` true. The token")
+		p("must support `%s` with a %d-byte IV and a %d-bit tag.", PKCS11Mechanism, PKCS11IVBytes, PKCS11TagBits)
+		p("")
+		p("The key id is `%s`, e.g. `%s`.", PKCS11KeyID(0, "<label>"), PKCS11KeyID(0, "ddm-settlement"))
+		p("Give the signing hosts a user PIN on that token, through")
+		p("`DDM_PKCS11_PIN`, and the module path through `DDM_PKCS11_MODULE`.")
+		p("Builds need `-tags pkcs11` (and cgo) to load the module.")
+	}
+	p("")
+	p("## 2. Generate the master seed")
+	p("")
+	p("On an offline machine, with the custodians present:")
+	p("")
+	p("```")
+	p("ddm keys new master.hex")
+	p("```")
+	p("")
+	p("Keep `master.hex` on removable media only; derived keys cannot be")
+	p("re-derived without it.")
+	p("")
+	p("## 3. Wrap each signing key")
+	p("")
+	p("For each recipient, epoch or path that signs:")
+	p("")
+	p("```")
+	switch backend {
+	case "kms":
+		p("ddm keys wrap -master master.hex -recipient 0x.. \\")
+		p("    -backend kms -key-id arn:aws:kms:<region>:<account>:key/<id> -out key.json")
+	case "pkcs11":
+		p("DDM_PKCS11_MODULE=/path/to/module.so DDM_PKCS11_PIN=... \\")
+		p("ddm keys wrap -master master.hex -recipient 0x.. \\")
+		p("    -backend pkcs11 -key-id '%s' -out key.json", PKCS11KeyID(0, "ddm-settlement"))
+	}
+	p("```")
+	p("")
+	p("`ddm keys wrap` unwraps the new key file once and checks it against the")
+	p("public key before writing it. Register the public key as before with")
+	p("`ddm keys export`; it equals the key file's `pk`.")
+	p("")
+	p("## 4. Retire the master seed")
+	p("")
+	p("Once every key file has signed a test batch on a signing host, destroy")
+	p("or escrow `master.hex` under the custodians' split control. Key files")
+	p("(`key.json`) hold no secret and can be copied to the signing hosts.")
+	p("")
+	p("## Signing")
+	p("")
+	p("```")
+	p("settlement_demo prove --wrapped-key key.json ...")
+	p("```")
+	p("")
+	p("Each unwrap is bounded by `DefaultTimeout` (%s) and logged by the store.", DefaultTimeout)
+	p("A key file whose store, key id or public key does not match what unwraps")
+	p("is refused.")
+	p("")
+	p("## Revocation")
+	p("")
+	switch backend {
+	case "kms":
+		p("Disable the KMS key, or remove the signer role's grant: every key file it")
+		p("wraps stops signing at the next unwrap.")
+	case "pkcs11":
+		p("Destroy the AES key on the token, or change the user PIN: every key file")
+		p("it wraps stops signing at the next unwrap.")
+	}
+	p("Revoke the registered public keys on chain as for any compromised key.")
+	return []byte(strings.TrimRight(b.String(), "\n") + "\n"), nil
+}
+
+func backendTitle(backend string) string {
+	switch backend {
+	case "kms":
+		return "AWS KMS"
+	case "pkcs11":
+		return "a PKCS#11 token"
+	}
+	return backend
+}
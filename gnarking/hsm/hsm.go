@@ -0,0 +1,330 @@
+// Package hsm keeps the EdDSA signing keys in a key store instead of in
+// files: an AWS KMS key or a PKCS#11 token's AES key wraps each key's seed
+// (keys.Node.KeySeed), and a Signer unwraps it only to sign.
+//
+// Neither KMS nor PKCS#11 tokens implement EdDSA on babyjubjub, so the curve
+// arithmetic cannot be delegated: the MiMC digest of the row message and the
+// scalar operations run in this process, with the seed unwrapped for one
+// signature (or for Signer.Hold) and wiped after. What the store adds is
+// that the key is never at rest in the clear, that every unwrap is
+// authorized and logged by the store (IAM and CloudTrail, the token's PIN),
+// and that disabling the wrapping key disables every key it wraps. Each
+// wrapped seed is bound to its derivation path and public key (the KMS
+// encryption context, the AES-GCM additional data on a token), so wrapped
+// seeds cannot be swapped between key files.
+//
+// Ceremony writes the key ceremony for a backend from the same constants;
+// testdata/ceremony_<backend>.md are the published ones.
+package hsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+
+	"gnarking/errs"
+	"gnarking/keys"
+)
+
+// Backend is a key store that wraps seeds under a key it never releases.
+// binding must be given again, unchanged, to unwrap.
+type Backend interface {
+	Name() string  // "kms" or "pkcs11", as in KeyFile.Backend
+	KeyID() string // the wrapping key, as in KeyFile.KeyID
+	Wrap(ctx context.Context, plaintext []byte, binding map[string]string) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte, binding map[string]string) ([]byte, error)
+}
+
+// Binding keys: what a wrapped seed is bound to. They are also the KMS
+// encryption context keys a key policy can put conditions on.
+const (
+	BindPurpose = "ddm:purpose"
+	BindPath    = "ddm:path"
+	BindPk      = "ddm:pk"
+	// Purpose is BindPurpose's value for EdDSA key seeds.
+	Purpose = "eddsa-key-seed"
+)
+
+// DefaultTimeout bounds one unwrap when Signer.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+const KeyFileVersion = 1
+
+// KeyFile is a wrapped signing key: safe to copy to the signing hosts, as
+// only the store can open it.
+type KeyFile struct {
+	Version int    `json:"version"`
+	Backend string `json:"backend"` // kms or pkcs11
+	KeyID   string `json:"key_id"`  // KMS key ARN, or slot=<id>;label=<label> of the token's AES key
+	Path    string `json:"path"`    // keys.Path the seed was derived at
+	Pk      string `json:"pk"`      // hex, 32-byte compressed EdDSA public key
+	Wrapped []byte `json:"wrapped"` // base64 in JSON
+}
+
+// Binding is what f's seed is bound to.
+func (f *KeyFile) Binding() map[string]string {
+	return map[string]string{BindPurpose: Purpose, BindPath: f.Path, BindPk: f.Pk}
+}
+
+// AAD is binding as AES-GCM additional data: "key=value\n" lines, sorted.
+func AAD(binding map[string]string) []byte {
+	names := make([]string, 0, len(binding))
+	for k := range binding {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for _, k := range names {
+		fmt.Fprintf(&b, "%s=%s\n", k, binding[k])
+	}
+	return b.Bytes()
+}
+
+var _ io.WriterTo = (*KeyFile)(nil)
+var _ io.ReaderFrom = (*KeyFile)(nil)
+
+func (f *KeyFile) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (f *KeyFile) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: key file: %w", errs.ErrInvalidInput, err)
+	}
+	if f.Version != KeyFileVersion {
+		return int64(len(data)), fmt.Errorf("%w: unsupported key file version %d", errs.ErrArtifactMismatch, f.Version)
+	}
+	if _, err := keys.ParsePath(f.Path); err != nil {
+		return int64(len(data)), fmt.Errorf("key file: %w", err)
+	}
+	if len(f.Wrapped) == 0 {
+		return int64(len(data)), fmt.Errorf("%w: key file holds no wrapped seed", errs.ErrInvalidInput)
+	}
+	return int64(len(data)), nil
+}
+
+// Wrap wraps n's seed with b into a key file, then opens the file once: a
+// key file the store cannot open must not replace the master seed.
+func Wrap(ctx context.Context, b Backend, n keys.Node) (*KeyFile, error) {
+	seed := n.KeySeed()
+	defer clear(seed[:])
+	priv, err := n.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	f := &KeyFile{Version: KeyFileVersion, Backend: b.Name(), KeyID: b.KeyID(), Path: n.Path.String(), Pk: hex.EncodeToString(priv.PublicKey.Bytes())}
+	*priv = bnEddsa.PrivateKey{}
+	if f.Wrapped, err = b.Wrap(ctx, seed[:], f.Binding()); err != nil {
+		return nil, fmt.Errorf("wrap %s: %w", f.Path, err)
+	}
+	s, err := Open(ctx, b, f)
+	if err != nil {
+		return nil, fmt.Errorf("wrapped %s does not open: %w", f.Path, err)
+	}
+	s.Close()
+	return f, nil
+}
+
+// Signer signs with a wrapped key, unwrapping it from its store for every
+// signature, or once per Hold.
+type Signer struct {
+	// Hold keeps the unwrapped key in memory this long after a signature,
+	// so a batch's rows cost one unwrap; 0 unwraps for every signature.
+	Hold time.Duration
+	// Timeout bounds one unwrap, DefaultTimeout when 0.
+	Timeout time.Duration
+
+	b    Backend
+	f    *KeyFile
+	pub  bnEddsa.PublicKey
+	mu   sync.Mutex
+	priv *bnEddsa.PrivateKey // while held
+	wipe *time.Timer
+	n    int // unwraps
+}
+
+var _ signature.Signer = (*Signer)(nil)
+
+// Open is a signer for f, whose wrapping key b must be. The key is
+// unwrapped once to check it is f's public key.
+func Open(ctx context.Context, b Backend, f *KeyFile) (*Signer, error) {
+	if b.Name() != f.Backend || b.KeyID() != f.KeyID {
+		return nil, fmt.Errorf("%w: key file is wrapped by %s %s, not %s %s", errs.ErrArtifactMismatch, f.Backend, f.KeyID, b.Name(), b.KeyID())
+	}
+	s := &Signer{b: b, f: f}
+	pk, err := hex.DecodeString(f.Pk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key file pk: %w", errs.ErrInvalidInput, err)
+	}
+	if _, err := s.pub.SetBytes(pk); err != nil {
+		return nil, fmt.Errorf("%w: key file pk: %w", errs.ErrInvalidInput, err)
+	}
+	priv, err := s.unwrap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	*priv = bnEddsa.PrivateKey{}
+	return s, nil
+}
+
+// unwrap is the key, checked against the key file's public key.
+func (s *Signer) unwrap(ctx context.Context) (*bnEddsa.PrivateKey, error) {
+	seed, err := s.b.Unwrap(ctx, s.f.Wrapped, s.f.Binding())
+	if err != nil {
+		return nil, fmt.Errorf("unwrap %s: %w", s.f.Path, err)
+	}
+	defer clear(seed)
+	s.n++
+	if len(seed) != 32 {
+		return nil, fmt.Errorf("%w: unwrapped %d bytes, a key seed is 32", errs.ErrVerificationFailed, len(seed))
+	}
+	priv, err := bnEddsa.GenerateKey(bytes.NewReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	if !priv.PublicKey.Equal(&s.pub) {
+		*priv = bnEddsa.PrivateKey{}
+		return nil, fmt.Errorf("%w: %s unwraps to another key than the key file's pk", errs.ErrVerificationFailed, s.f.Path)
+	}
+	return priv, nil
+}
+
+func (s *Signer) Public() signature.PublicKey { return &s.pub }
+
+// Path is the derivation path the key file records.
+func (s *Signer) Path() string { return s.f.Path }
+
+// Sign signs message as bnEddsa.PrivateKey.Sign does.
+func (s *Signer) Sign(message []byte, hFunc hash.Hash) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	priv := s.priv
+	if priv == nil {
+		timeout := s.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var err error
+		if priv, err = s.unwrap(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sig, err := priv.Sign(message, hFunc)
+	if s.Hold <= 0 {
+		*priv = bnEddsa.PrivateKey{}
+		return sig, err
+	}
+	s.priv = priv
+	if s.wipe == nil {
+		s.wipe = time.AfterFunc(s.Hold, func() { s.Close() })
+	} else {
+		s.wipe.Reset(s.Hold)
+	}
+	return sig, err
+}
+
+// Close wipes a held key; the next signature unwraps again.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.priv != nil {
+		*s.priv = bnEddsa.PrivateKey{}
+		s.priv = nil
+	}
+	return nil
+}
+
+// Bytes is the public key only: the private key does not leave the
+// signer.
+func (s *Signer) Bytes() []byte { return s.pub.Bytes() }
+
+func (s *Signer) SetBytes([]byte) (int, error) {
+	return 0, fmt.Errorf("%w: a wrapped key is opened from its key file, not set from bytes", errs.ErrInvalidInput)
+}
+
+// Config holds what opening a backend needs besides the key file: the
+// PKCS#11 module and PIN of this host, the KMS endpoint and credentials.
+type Config struct {
+	PKCS11Module string // path of the token's PKCS#11 library
+	PKCS11PIN    string // user PIN
+	KMSEndpoint  string // default https://kms.<region>.amazonaws.com
+	KMSRegion    string // for key ids that are not ARNs
+	Credentials  Credentials
+}
+
+// ConfigFromEnv reads DDM_PKCS11_MODULE, DDM_PKCS11_PIN, DDM_KMS_ENDPOINT,
+// AWS_REGION and the AWS credential variables.
+func ConfigFromEnv() Config {
+	return Config{
+		PKCS11Module: os.Getenv("DDM_PKCS11_MODULE"),
+		PKCS11PIN:    os.Getenv("DDM_PKCS11_PIN"),
+		KMSEndpoint:  os.Getenv("DDM_KMS_ENDPOINT"),
+		KMSRegion:    os.Getenv("AWS_REGION"),
+		Credentials:  EnvCredentials(),
+	}
+}
+
+// Backend is the backend name for keyID under c.
+func (c Config) Backend(name, keyID string) (Backend, error) {
+	switch name {
+	case "kms":
+		k := &KMS{Key: keyID, Region: c.KMSRegion, Endpoint: c.KMSEndpoint, Credentials: c.Credentials}
+		if err := k.check(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	case "pkcs11":
+		slot, label, err := ParsePKCS11KeyID(keyID)
+		if err != nil {
+			return nil, err
+		}
+		if c.PKCS11Module == "" {
+			return nil, fmt.Errorf("%w: no PKCS#11 module given", errs.ErrInvalidInput)
+		}
+		return &PKCS11{Module: c.PKCS11Module, Slot: slot, Label: label, PIN: c.PKCS11PIN}, nil
+	}
+	return nil, checkBackend(name)
+}
+
+// Load opens f with its backend under c.
+func Load(ctx context.Context, c Config, f *KeyFile) (*Signer, error) {
+	b, err := c.Backend(f.Backend, f.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return Open(ctx, b, f)
+}
+
+// backends are the Backend names, in the order the docs list them.
+var backends = []string{"kms", "pkcs11"}
+
+func checkBackend(name string) error {
+	for _, b := range backends {
+		if b == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: key store %q, want %s", errs.ErrInvalidInput, name, strings.Join(backends, " or "))
+}
@@ -0,0 +1,346 @@
+package hsm
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark-crypto/hash"
+
+	"gnarking/errs"
+	"gnarking/keys"
+)
+
+// aesStore is a Backend holding its AES key in memory, as a token would.
+type aesStore struct {
+	name, id string
+	aead     cipher.AEAD
+	unwraps  int
+}
+
+func newAESStore(t *testing.T, name, id string) *aesStore {
+	t.Helper()
+	key := make([]byte, 32)
+	rand.Read(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &aesStore{name: name, id: id, aead: aead}
+}
+
+func (s *aesStore) Name() string  { return s.name }
+func (s *aesStore) KeyID() string { return s.id }
+
+func (s *aesStore) Wrap(_ context.Context, plain []byte, binding map[string]string) ([]byte, error) {
+	iv := make([]byte, s.aead.NonceSize())
+	rand.Read(iv)
+	return s.aead.Seal(iv, iv, plain, AAD(binding)), nil
+}
+
+func (s *aesStore) Unwrap(_ context.Context, wrapped []byte, binding map[string]string) ([]byte, error) {
+	s.unwraps++
+	n := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, wrapped[:n], wrapped[n:], AAD(binding))
+	if err != nil {
+		return nil, errs.ErrVerificationFailed
+	}
+	return plain, nil
+}
+
+func testNode(t *testing.T, path string) keys.Node {
+	t.Helper()
+	var seed keys.Seed
+	seed[31] = 1
+	p, err := keys.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := keys.Master(seed).Derive(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSigner(t *testing.T) {
+	ctx := context.Background()
+	store := newAESStore(t, "pkcs11", PKCS11KeyID(0, "test"))
+	n := testNode(t, "m/1'/2'")
+	f, err := Wrap(ctx, store, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key file is the derived key's, not the master's
+	want, err := n.PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Pk != hex.EncodeToString(want.PublicKey.Bytes()) || f.Path != "m/1'/2'" {
+		t.Fatalf("key file pk %s path %s", f.Pk, f.Path)
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte(hex.EncodeToString(func() []byte { s := n.KeySeed(); return s[:] }()))) {
+		t.Fatal("key file holds the seed in the clear")
+	}
+	var read KeyFile
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(ctx, store, &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("row message")
+	sig, err := s.Sign(msg, hash.MIMC_BN254.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, _ := want.Sign(msg, hash.MIMC_BN254.New())
+	if !bytes.Equal(sig, direct) {
+		t.Fatal("wrapped key signs differently from the derived key")
+	}
+	if ok, err := s.Public().Verify(sig, msg, hash.MIMC_BN254.New()); !ok || err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	if !bytes.Equal(s.Bytes(), want.PublicKey.Bytes()) {
+		t.Fatal("Bytes is not the public key")
+	}
+	if _, err := s.SetBytes(nil); err == nil {
+		t.Fatal("SetBytes accepted")
+	}
+
+	// one unwrap per signature, or per Hold
+	before := store.unwraps
+	s.Sign(msg, hash.MIMC_BN254.New())
+	s.Sign(msg, hash.MIMC_BN254.New())
+	if store.unwraps-before != 2 {
+		t.Fatalf("%d unwraps for 2 signatures", store.unwraps-before)
+	}
+	s.Hold = time.Hour
+	before = store.unwraps
+	for range 3 {
+		if _, err := s.Sign(msg, hash.MIMC_BN254.New()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.unwraps-before != 1 {
+		t.Fatalf("%d unwraps for 3 held signatures", store.unwraps-before)
+	}
+	s.Close()
+	s.Sign(msg, hash.MIMC_BN254.New())
+	if store.unwraps-before != 2 {
+		t.Fatal("Close did not drop the held key")
+	}
+	s.Close()
+
+	// the binding: another path or pk does not unwrap, another store is
+	// refused before asking it
+	moved := read
+	moved.Path = "m/1'/3'"
+	if _, err := Open(ctx, store, &moved); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("moved path: %v, want ErrVerificationFailed", err)
+	}
+	other, err := Wrap(ctx, store, testNode(t, "m/1'/3'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := read
+	swapped.Wrapped = other.Wrapped
+	if _, err := Open(ctx, store, &swapped); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("swapped seed: %v, want ErrVerificationFailed", err)
+	}
+	if _, err := Open(ctx, newAESStore(t, "pkcs11", PKCS11KeyID(1, "test")), &read); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("other key id: %v, want ErrArtifactMismatch", err)
+	}
+	// a store that unwraps to another key than the file names
+	lying := read
+	lying.Pk = other.Pk
+	lying.Wrapped, _ = store.Wrap(ctx, func() []byte { s := n.KeySeed(); return s[:] }(), lying.Binding())
+	if _, err := Open(ctx, store, &lying); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("pk mismatch: %v, want ErrVerificationFailed", err)
+	}
+}
+
+func TestPKCS11KeyID(t *testing.T) {
+	slot, label, err := ParsePKCS11KeyID(PKCS11KeyID(7, "ddm;settlement"))
+	if err != nil || slot != 7 || label != "ddm;settlement" {
+		t.Fatalf("round trip: %d %q %v", slot, label, err)
+	}
+	for _, id := range []string{"", "slot=1", "label=x", "slot=x;label=y", "slot=1;label="} {
+		if _, _, err := ParsePKCS11KeyID(id); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%q: %v, want ErrInvalidInput", id, err)
+		}
+	}
+}
+
+// TestSigV4 is the IAM ListUsers example of the AWS Signature Version 4
+// documentation.
+func TestSigV4(t *testing.T) {
+	const secret = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	if got := hex.EncodeToString(signingKey(secret, "20150830", "us-east-1", "iam")); got != "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9" {
+		t.Fatalf("signing key %s", got)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	SignV4(req, nil, Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: secret}, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	const want = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("Authorization %s\nwant %s", got, want)
+	}
+}
+
+// fakeKMS answers Encrypt and Decrypt as KMS does, with the encryption
+// context as additional data.
+type fakeKMS struct {
+	t      *testing.T
+	store  *aesStore
+	deny   bool
+	target []string
+}
+
+func (k *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("Content-Type") != "application/x-amz-json-1.1" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"IncompleteSignatureException"}`))
+		return
+	}
+	var in struct {
+		KeyId             string
+		Plaintext         []byte
+		CiphertextBlob    []byte
+		EncryptionContext map[string]string
+	}
+	json.Unmarshal(body, &in)
+	fail := func(kind string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.kms#" + kind, "message": "no"})
+	}
+	target := r.Header.Get("X-Amz-Target")
+	k.target = append(k.target, target)
+	switch {
+	case k.deny:
+		fail("AccessDeniedException")
+	case in.KeyId != k.store.id:
+		fail("NotFoundException")
+	case target == "TrentService.Encrypt":
+		blob, _ := k.store.Wrap(r.Context(), in.Plaintext, in.EncryptionContext)
+		json.NewEncoder(w).Encode(map[string]any{"CiphertextBlob": blob, "KeyId": in.KeyId})
+	case target == "TrentService.Decrypt":
+		plain, err := k.store.Unwrap(r.Context(), in.CiphertextBlob, in.EncryptionContext)
+		if err != nil {
+			fail("InvalidCiphertextException")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Plaintext": plain, "KeyId": in.KeyId})
+	default:
+		fail("UnknownOperationException")
+	}
+}
+
+func TestKMS(t *testing.T) {
+	ctx := context.Background()
+	const arn = "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	fake := &fakeKMS{t: t, store: newAESStore(t, "kms", arn)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := Config{KMSEndpoint: srv.URL, Credentials: Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}}
+	b, err := c.Backend("kms", arn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := b.(*KMS).region(); r != "eu-west-1" {
+		t.Fatalf("region %q from the ARN", r)
+	}
+	f, err := Wrap(ctx, b, testNode(t, "m/1'/2'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(ctx, c, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("row message")
+	sig, err := s.Sign(msg, hash.MIMC_BN254.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Public().Verify(sig, msg, hash.MIMC_BN254.New()); !ok {
+		t.Fatal("signature does not verify")
+	}
+	if strings.Join(fake.target, ",") != "TrentService.Encrypt,TrentService.Decrypt,TrentService.Decrypt,TrentService.Decrypt" {
+		t.Fatalf("calls %v", fake.target)
+	}
+
+	moved := *f
+	moved.Path = "m/1'/3'"
+	if _, err := Load(ctx, c, &moved); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("moved path: %v, want ErrVerificationFailed", err)
+	}
+	fake.deny = true
+	if _, err := s.Sign(msg, hash.MIMC_BN254.New()); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("denied: %v, want ErrPolicyRejected", err)
+	}
+	if _, err := (Config{}).Backend("kms", arn); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("no credentials: %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestPKCS11Refused(t *testing.T) {
+	// without a token (or without -tags pkcs11) every failure is an error
+	// the caller can tell apart from a bad key file
+	b, err := Config{PKCS11Module: "/nonexistent/module.so"}.Backend("pkcs11", PKCS11KeyID(0, "ddm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Wrap(context.Background(), b, testNode(t, "m/1'")); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("no module: %v, want ErrUnavailable", err)
+	}
+	if _, err := (Config{}).Backend("pkcs11", PKCS11KeyID(0, "ddm")); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("no module given: %v, want ErrInvalidInput", err)
+	}
+	if _, err := (Config{}).Backend("vault", "x"); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("unknown store: %v, want ErrInvalidInput", err)
+	}
+}
+
+// TestCeremonyUpToDate pins the published ceremonies to the code; after a
+// change, regenerate with ddm keys ceremony -backend <b> -out
+// hsm/testdata/ceremony_<b>.md.
+func TestCeremonyUpToDate(t *testing.T) {
+	for _, b := range backends {
+		want, err := os.ReadFile("testdata/ceremony_" + b + ".md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Ceremony(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("key ceremony differs from testdata/ceremony_%s.md", b)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package hsm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+)
+
+// Credentials sign KMS requests (AWS Signature Version 4).
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // for temporary credentials
+}
+
+// EnvCredentials are the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN variables, as every AWS tool reads them.
+func EnvCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// KMS wraps with an AWS KMS symmetric key: Encrypt and Decrypt with the
+// binding as encryption context, so the key policy can require it
+// (kms:EncryptionContext:ddm:purpose) and CloudTrail logs the path of every
+// unwrap.
+type KMS struct {
+	Key         string // key ARN; an alias ARN works, but pins less
+	Region      string // when Key is not an ARN
+	Endpoint    string // default https://kms.<region>.amazonaws.com
+	Credentials Credentials
+	HTTP        *http.Client // default http.DefaultClient
+
+	now func() time.Time // tests
+}
+
+// MaxKMSResponse bounds a KMS reply; a wrapped seed is a few hundred bytes.
+const MaxKMSResponse = 64 << 10
+
+func (k *KMS) Name() string  { return "kms" }
+func (k *KMS) KeyID() string { return k.Key }
+
+func (k *KMS) check() error {
+	if k.Key == "" {
+		return fmt.Errorf("%w: no KMS key given", errs.ErrInvalidInput)
+	}
+	if k.region() == "" {
+		return fmt.Errorf("%w: KMS key %q is not an ARN and no region is set", errs.ErrInvalidInput, k.Key)
+	}
+	if k.Credentials.AccessKeyID == "" || k.Credentials.SecretAccessKey == "" {
+		return fmt.Errorf("%w: no AWS credentials (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY)", errs.ErrInvalidInput)
+	}
+	return nil
+}
+
+// region is the ARN's, arn:aws:kms:<region>:<account>:key/<id>, else
+// k.Region.
+func (k *KMS) region() string {
+	if parts := strings.Split(k.Key, ":"); len(parts) >= 6 && parts[0] == "arn" && parts[2] == "kms" {
+		return parts[3]
+	}
+	return k.Region
+}
+
+func (k *KMS) Wrap(ctx context.Context, plaintext []byte, binding map[string]string) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+		KeyId          string
+	}
+	err := k.call(ctx, "Encrypt", map[string]any{
+		"KeyId":             k.Key,
+		"Plaintext":         plaintext,
+		"EncryptionContext": binding,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (k *KMS) Unwrap(ctx context.Context, wrapped []byte, binding map[string]string) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+		KeyId     string
+	}
+	// KeyId pins the key: KMS would otherwise decrypt with whatever key the
+	// blob names, if the caller may use it
+	err := k.call(ctx, "Decrypt", map[string]any{
+		"KeyId":             k.Key,
+		"CiphertextBlob":    wrapped,
+		"EncryptionContext": binding,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// call posts one KMS JSON API request.
+func (k *KMS) call(ctx context.Context, action string, in, out any) error {
+	if err := k.check(); err != nil {
+		return err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint := k.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + k.region() + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	now := time.Now
+	if k.now != nil {
+		now = k.now
+	}
+	SignV4(req, body, k.Credentials, k.region(), "kms", now().UTC())
+
+	client := k.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: kms %s: %w", errs.ErrUnavailable, action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxKMSResponse))
+	if err != nil {
+		return fmt.Errorf("%w: kms %s: %w", errs.ErrUnavailable, action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &e)
+		// __type may carry a namespace: "com.amazonaws.kms#AccessDeniedException"
+		kind := e.Type[strings.LastIndex(e.Type, "#")+1:]
+		if kind == "" {
+			kind = resp.Status
+		}
+		return fmt.Errorf("%w: kms %s: %s: %s", kmsError(kind), action, kind, e.Message)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: kms %s reply: %w", errs.ErrUnavailable, action, err)
+	}
+	return nil
+}
+
+// kmsError is the errs sentinel for a KMS error type: refusals are policy,
+// a blob that does not decrypt under the key and context is a verification
+// failure, the rest is the store being unavailable.
+func kmsError(kind string) error {
+	switch kind {
+	case "AccessDeniedException", "DisabledException", "KMSInvalidStateException", "IncorrectKeyException", "UnrecognizedClientException":
+		return errs.ErrPolicyRejected
+	case "InvalidCiphertextException":
+		return errs.ErrVerificationFailed
+	case "NotFoundException":
+		return errs.ErrNotFound
+	}
+	return errs.ErrUnavailable
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req, whose body is
+// body.
+func SignV4(req *http.Request, body []byte, c Credentials, region, service string, now time.Time) {
+	stamp := now.Format("20060102T150405Z")
+	day := stamp[:8]
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", stamp)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": req.Host}
+	for name, v := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, canonicalQuery(req.URL.Query()), canonHeaders.String(), signed, hex.EncodeToString(payload[:])}, "\n")
+	canonSum := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonSum[:])
+	sig := hex.EncodeToString(hmacSHA256(signingKey(c.SecretAccessKey, day, region, service), []byte(toSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.AccessKeyID, scope, signed, sig))
+}
+
+func signingKey(secret, day, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), []byte(day))
+	k = hmacSHA256(k, []byte(region))
+	k = hmacSHA256(k, []byte(service))
+	return hmacSHA256(k, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// canonicalQuery is q sorted by key then value, RFC 3986 escaped.
+func canonicalQuery(q url.Values) string {
+	var pairs []string
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,72 @@
+package hsm
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// PKCS11 wraps with an AES key on a PKCS#11 token (an HSM, a YubiHSM, a
+// cloud HSM's client library) under CKM_AES_GCM: the blob is the 12-byte IV
+// then the ciphertext and 16-byte tag, with AAD(binding) as additional
+// data. The key never leaves the token; the module is loaded at run time,
+// in builds with -tags pkcs11.
+type PKCS11 struct {
+	Module string // the token's PKCS#11 library
+	Slot   uint   // slot ID
+	Label  string // CKA_LABEL of the AES key
+	PIN    string // user PIN
+}
+
+// PKCS#11 constants the wrapping uses, as the ceremony names them.
+const (
+	PKCS11Mechanism = "CKM_AES_GCM"
+	PKCS11IVBytes   = 12
+	PKCS11TagBits   = 128
+)
+
+func (p *PKCS11) Name() string  { return "pkcs11" }
+func (p *PKCS11) KeyID() string { return PKCS11KeyID(p.Slot, p.Label) }
+
+// PKCS11KeyID is the KeyFile.KeyID of the key labelled label in slot.
+func PKCS11KeyID(slot uint, label string) string {
+	return fmt.Sprintf("slot=%d;label=%s", slot, label)
+}
+
+// ParsePKCS11KeyID parses PKCS11KeyID's form.
+func ParsePKCS11KeyID(id string) (slot uint, label string, err error) {
+	s, l, ok := strings.Cut(id, ";")
+	sv, sok := strings.CutPrefix(s, "slot=")
+	lv, lok := strings.CutPrefix(l, "label=")
+	if !ok || !sok || !lok || lv == "" {
+		return 0, "", fmt.Errorf("%w: PKCS#11 key id %q, want slot=<id>;label=<label>", errs.ErrInvalidInput, id)
+	}
+	n, err := strconv.ParseUint(sv, 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: PKCS#11 key id %q: %w", errs.ErrInvalidInput, id, err)
+	}
+	return uint(n), lv, nil
+}
+
+func (p *PKCS11) Wrap(ctx context.Context, plaintext []byte, binding map[string]string) ([]byte, error) {
+	iv := make([]byte, PKCS11IVBytes)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ct, err := p.crypt(ctx, true, iv, AAD(binding), plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, ct...), nil
+}
+
+func (p *PKCS11) Unwrap(ctx context.Context, wrapped []byte, binding map[string]string) ([]byte, error) {
+	if len(wrapped) < PKCS11IVBytes+PKCS11TagBits/8 {
+		return nil, fmt.Errorf("%w: wrapped seed of %d bytes is too short", errs.ErrVerificationFailed, len(wrapped))
+	}
+	return p.crypt(ctx, false, wrapped[:PKCS11IVBytes], AAD(binding), wrapped[PKCS11IVBytes:])
+}
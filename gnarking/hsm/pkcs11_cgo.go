@@ -0,0 +1,161 @@
+//go:build pkcs11 && cgo
+
+package hsm
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The PKCS#11 v2.40 ABI, as far as ddm_crypt needs it: the function list up
+// to C_Decrypt, in the standard's order, and the structures it passes.
+typedef unsigned long ck_rv;
+typedef unsigned long ck_ulong;
+typedef struct { unsigned char major, minor; } ck_version;
+typedef struct { ck_ulong type; void *value; ck_ulong len; } ck_attribute;
+typedef struct { ck_ulong mechanism; void *param; ck_ulong len; } ck_mechanism;
+typedef struct { unsigned char *iv; ck_ulong iv_len, iv_bits; unsigned char *aad; ck_ulong aad_len, tag_bits; } ck_gcm_params;
+
+typedef ck_rv (*fn_initialize)(void *);
+typedef ck_rv (*fn_open_session)(ck_ulong, ck_ulong, void *, void *, ck_ulong *);
+typedef ck_rv (*fn_close_session)(ck_ulong);
+typedef ck_rv (*fn_login)(ck_ulong, ck_ulong, unsigned char *, ck_ulong);
+typedef ck_rv (*fn_find_init)(ck_ulong, ck_attribute *, ck_ulong);
+typedef ck_rv (*fn_find)(ck_ulong, ck_ulong *, ck_ulong, ck_ulong *);
+typedef ck_rv (*fn_find_final)(ck_ulong);
+typedef ck_rv (*fn_crypt_init)(ck_ulong, ck_mechanism *, ck_ulong);
+typedef ck_rv (*fn_crypt)(ck_ulong, unsigned char *, ck_ulong, unsigned char *, ck_ulong *);
+
+enum {
+	F_INITIALIZE = 0, F_OPEN_SESSION = 12, F_CLOSE_SESSION = 13, F_LOGIN = 18,
+	F_FIND_INIT = 26, F_FIND = 27, F_FIND_FINAL = 28,
+	F_ENCRYPT_INIT = 29, F_ENCRYPT = 30, F_DECRYPT_INIT = 33, F_DECRYPT = 34,
+};
+typedef struct { ck_version version; void *fn[35]; } ck_function_list;
+
+// stages, for the error message
+enum { S_LOAD = 1, S_INITIALIZE, S_OPEN_SESSION, S_LOGIN, S_FIND_KEY, S_CRYPT_INIT, S_CRYPT };
+
+static ck_rv ddm_crypt(const char *module, ck_ulong slot, unsigned char *pin, ck_ulong pin_len,
+		unsigned char *label, ck_ulong label_len, int encrypt,
+		unsigned char *iv, ck_ulong iv_len, unsigned char *aad, ck_ulong aad_len, ck_ulong tag_bits,
+		unsigned char *in, ck_ulong in_len, unsigned char *out, ck_ulong *out_len, int *stage) {
+	*stage = S_LOAD;
+	void *lib = dlopen(module, RTLD_NOW | RTLD_LOCAL);
+	if (!lib) return (ck_rv)-1;
+	ck_rv (*get_list)(ck_function_list **) = (ck_rv (*)(ck_function_list **))dlsym(lib, "C_GetFunctionList");
+	ck_function_list *f = NULL;
+	if (!get_list || get_list(&f) != 0 || !f) return (ck_rv)-1;
+
+	*stage = S_INITIALIZE;
+	ck_rv rv = ((fn_initialize)f->fn[F_INITIALIZE])(NULL);
+	if (rv != 0 && rv != 0x191) return rv; // CKR_CRYPTOKI_ALREADY_INITIALIZED
+
+	*stage = S_OPEN_SESSION;
+	ck_ulong session;
+	rv = ((fn_open_session)f->fn[F_OPEN_SESSION])(slot, 0x4, NULL, NULL, &session); // CKF_SERIAL_SESSION
+	if (rv != 0) return rv;
+
+	*stage = S_LOGIN;
+	rv = ((fn_login)f->fn[F_LOGIN])(session, 1, pin, pin_len); // CKU_USER
+	if (rv != 0 && rv != 0x100) goto done; // CKR_USER_ALREADY_LOGGED_IN
+
+	*stage = S_FIND_KEY;
+	ck_ulong class = 4, key_type = 0x1f; // CKO_SECRET_KEY, CKK_AES
+	ck_attribute tmpl[] = {
+		{0x0, &class, sizeof class},      // CKA_CLASS
+		{0x100, &key_type, sizeof key_type}, // CKA_KEY_TYPE
+		{0x3, label, label_len},           // CKA_LABEL
+	};
+	rv = ((fn_find_init)f->fn[F_FIND_INIT])(session, tmpl, 3);
+	if (rv != 0) goto done;
+	ck_ulong keys[2], found = 0;
+	rv = ((fn_find)f->fn[F_FIND])(session, keys, 2, &found);
+	((fn_find_final)f->fn[F_FIND_FINAL])(session);
+	if (rv != 0) goto done;
+	if (found != 1) {
+		rv = found == 0 ? 0x60 : 0x82; // CKR_KEY_HANDLE_INVALID, CKR_OBJECT_HANDLE_INVALID
+		goto done;
+	}
+
+	*stage = S_CRYPT_INIT;
+	ck_gcm_params gcm = {iv, iv_len, iv_len * 8, aad, aad_len, tag_bits};
+	ck_mechanism mech = {0x1087, &gcm, sizeof gcm}; // CKM_AES_GCM
+	rv = ((fn_crypt_init)f->fn[encrypt ? F_ENCRYPT_INIT : F_DECRYPT_INIT])(session, &mech, keys[0]);
+	if (rv != 0) goto done;
+	*stage = S_CRYPT;
+	rv = ((fn_crypt)f->fn[encrypt ? F_ENCRYPT : F_DECRYPT])(session, in, in_len, out, out_len);
+done:
+	((fn_close_session)f->fn[F_CLOSE_SESSION])(session);
+	return rv;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"unsafe"
+
+	"gnarking/errs"
+)
+
+var pkcs11Stages = [...]string{"", "load module", "C_Initialize", "C_OpenSession", "C_Login", "find key", "C_EncryptInit/C_DecryptInit", "C_Encrypt/C_Decrypt"}
+
+// crypt runs one AES-GCM operation with the token's key, in a session of
+// its own. Plaintext crossing into C memory is wiped before it is freed.
+func (p *PKCS11) crypt(ctx context.Context, encrypt bool, iv, aad, in []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	module := C.CString(p.Module)
+	defer C.free(unsafe.Pointer(module))
+	cbytes := func(b []byte) *C.uchar {
+		// never a nil pointer: some modules reject it for empty input
+		return (*C.uchar)(C.CBytes(append(b[:len(b):len(b)], 0)))
+	}
+	wipeFree := func(c *C.uchar, n int) {
+		C.memset(unsafe.Pointer(c), 0, C.size_t(n))
+		C.free(unsafe.Pointer(c))
+	}
+	pin, label := cbytes([]byte(p.PIN)), cbytes([]byte(p.Label))
+	defer wipeFree(pin, len(p.PIN)+1)
+	defer C.free(unsafe.Pointer(label))
+	civ, caad, cin := cbytes(iv), cbytes(aad), cbytes(in)
+	defer C.free(unsafe.Pointer(civ))
+	defer C.free(unsafe.Pointer(caad))
+	defer wipeFree(cin, len(in)+1)
+	outCap := len(in) + PKCS11TagBits/8
+	out := (*C.uchar)(C.calloc(C.size_t(outCap), 1))
+	defer wipeFree(out, outCap)
+	outLen := C.ck_ulong(outCap)
+
+	enc := C.int(0)
+	if encrypt {
+		enc = 1
+	}
+	var stage C.int
+	rv := C.ddm_crypt(module, C.ck_ulong(p.Slot), pin, C.ck_ulong(len(p.PIN)), label, C.ck_ulong(len(p.Label)), enc,
+		civ, C.ck_ulong(len(iv)), caad, C.ck_ulong(len(aad)), PKCS11TagBits, cin, C.ck_ulong(len(in)), out, &outLen, &stage)
+	if rv != 0 {
+		if stage == 1 {
+			return nil, fmt.Errorf("%w: pkcs11: cannot load %s", errs.ErrUnavailable, p.Module)
+		}
+		return nil, fmt.Errorf("%w: pkcs11 slot %d key %q: %s: CKR 0x%x", pkcs11Error(uint64(rv)), p.Slot, p.Label, pkcs11Stages[stage], uint64(rv))
+	}
+	return C.GoBytes(unsafe.Pointer(out), C.int(outLen)), nil
+}
+
+// pkcs11Error is the errs sentinel for a CKR_ value.
+func pkcs11Error(rv uint64) error {
+	switch rv {
+	case 0x40, 0x41: // CKR_ENCRYPTED_DATA_INVALID, CKR_ENCRYPTED_DATA_LEN_RANGE
+		return errs.ErrVerificationFailed
+	case 0xa0, 0xa4, 0x101, 0x68: // CKR_PIN_INCORRECT, CKR_PIN_LOCKED, CKR_USER_NOT_LOGGED_IN, CKR_KEY_FUNCTION_NOT_PERMITTED
+		return errs.ErrPolicyRejected
+	case 0x60, 0x82, 0x3: // CKR_KEY_HANDLE_INVALID, CKR_OBJECT_HANDLE_INVALID, CKR_SLOT_ID_INVALID
+		return errs.ErrNotFound
+	}
+	return errs.ErrUnavailable
+}
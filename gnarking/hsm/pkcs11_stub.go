@@ -0,0 +1,14 @@
+//go:build !pkcs11 || !cgo
+
+package hsm
+
+import (
+	"context"
+	"fmt"
+
+	"gnarking/errs"
+)
+
+func (p *PKCS11) crypt(context.Context, bool, []byte, []byte, []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: pkcs11: built without -tags pkcs11 (and cgo)", errs.ErrUnavailable)
+}
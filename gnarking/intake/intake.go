@@ -0,0 +1,361 @@
+// Package intake takes signed intents, each a row of a batch to come, and
+// follows them through their lifecycle: received, batched, proven, settled.
+// An intent is keyed by its signer's public key and nonce. A second intent
+// under a taken key is refused whatever its payload, so no row is settled
+// twice. Every change is an event appended to a JSONL journal, which Open
+// replays into the indexes.
+package intake
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// Status is where an intent is in its lifecycle.
+type Status string
+
+const (
+	StatusReceived Status = "received" // accepted, in no batch yet
+	StatusBatched  Status = "batched"  // in a batch queued for proving
+	StatusProven   Status = "proven"   // its batch is proven
+	StatusSettled  Status = "settled"  // its batch's proof went on-chain
+)
+
+// Intent is one signed row as its signer submits it.
+type Intent struct {
+	Profile   string `json:"profile,omitempty"` // circuit.DefaultProfile when empty
+	Pk        string `json:"pk"`                // hex, 32-byte compressed EdDSA public key
+	Recipient string `json:"recipient"`         // hex
+	ChainID   uint64 `json:"chain_id"`
+	Size      uint64 `json:"size"` // base units, what the row signs
+	Nonce     uint64 `json:"nonce"`
+	Sig       string `json:"sig"` // hex, 64-byte EdDSA signature of the row message
+}
+
+// Key identifies an intent: its signer and nonce.
+type Key struct {
+	Pk    string `json:"pk"` // lowercase hex, no 0x
+	Nonce uint64 `json:"nonce"`
+}
+
+// ParseKey is the Key of pk, hex with or without 0x, and nonce.
+func ParseKey(pk string, nonce uint64) (Key, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(pk, "0x"))
+	if err != nil || len(b) != 32 {
+		return Key{}, fmt.Errorf("%w: pk %q is not 32 bytes of hex", errs.ErrInvalidInput, pk)
+	}
+	return Key{Pk: hex.EncodeToString(b), Nonce: nonce}, nil
+}
+
+// canonical is in with its hex fields in one form, so that equal payloads
+// compare equal.
+func (in Intent) canonical() (Intent, error) {
+	if in.Profile == "" {
+		in.Profile = circuit.DefaultProfile
+	}
+	k, err := ParseKey(in.Pk, in.Nonce)
+	if err != nil {
+		return in, err
+	}
+	in.Pk = k.Pk
+	recipient, ok := new(big.Int).SetString(strings.TrimPrefix(in.Recipient, "0x"), 16)
+	if !ok || recipient.Sign() < 0 {
+		return in, fmt.Errorf("%w: recipient hex %q", errs.ErrInvalidInput, in.Recipient)
+	}
+	in.Recipient = "0x" + recipient.Text(16)
+	sig, err := hex.DecodeString(strings.TrimPrefix(in.Sig, "0x"))
+	if err != nil || len(sig) != 64 {
+		return in, fmt.Errorf("%w: sig %q is not 64 bytes of hex", errs.ErrInvalidInput, in.Sig)
+	}
+	in.Sig = hex.EncodeToString(sig)
+	return in, nil
+}
+
+// verify checks in's signature of its row message under version v; in is
+// canonical.
+func (in Intent) verify(v circuit.MsgVersion) error {
+	pk, _ := hex.DecodeString(in.Pk)
+	if _, err := new(bnEddsa.PublicKey).SetBytes(pk); err != nil {
+		return fmt.Errorf("%w: pk: %w", errs.ErrInvalidInput, err)
+	}
+	sig, _ := hex.DecodeString(in.Sig)
+	recipient, _ := new(big.Int).SetString(in.Recipient[2:], 16)
+	msg := circuit.MsgHash(v, recipient, new(big.Int).SetUint64(in.Size), new(big.Int).SetUint64(in.Nonce), new(big.Int).SetUint64(in.ChainID))
+	if err := (circuit.EdDSA{}).Verify(pk, sig, msg); err != nil {
+		return fmt.Errorf("%w: intent %s/%d: %w", errs.ErrInvalidBatch, in.Pk, in.Nonce, err)
+	}
+	return nil
+}
+
+// Check is in in canonical form once its signature of the row message
+// under version v checks, as Submit takes it.
+func (in Intent) Check(v circuit.MsgVersion) (Intent, error) {
+	in, err := in.canonical()
+	if err != nil {
+		return in, err
+	}
+	return in, in.verify(v)
+}
+
+// Transition is one step of an intent's lifecycle.
+type Transition struct {
+	Status  Status    `json:"status"`
+	BatchID string    `json:"batch_id,omitempty"` // hex, from batched on
+	TxHash  string    `json:"tx_hash,omitempty"`  // when settled
+	Time    time.Time `json:"time"`
+}
+
+// Record is an intent and where it is: Status, BatchID and TxHash are those
+// of the last of its History.
+type Record struct {
+	Intent
+	Status  Status       `json:"status"`
+	BatchID string       `json:"batch_id,omitempty"`
+	TxHash  string       `json:"tx_hash,omitempty"`
+	History []Transition `json:"history"`
+}
+
+func (r *Record) step(t Transition) {
+	r.Status, r.BatchID, r.TxHash = t.Status, t.BatchID, t.TxHash
+	r.History = append(r.History, t)
+}
+
+// event is a journal line. A received event carries its intent, a batched
+// one the keys of the intents batched; proven and settled ones name the
+// batch, and apply to the intents last batched in it.
+type event struct {
+	Transition
+	Intent *Intent `json:"intent,omitempty"`
+	Keys   []Key   `json:"keys,omitempty"`
+}
+
+// Log is the intake journal and its indexes. It is safe for concurrent use.
+type Log struct {
+	mu      sync.Mutex
+	f       *os.File
+	records map[Key]*Record
+	batches map[string][]Key // by batch ID, the intents batched in it
+}
+
+// Open opens (or creates) the journal at path and replays it.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f, records: make(map[Key]*Record), batches: make(map[string][]Key)}
+	if err := l.replay(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("intake journal %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *Log) replay(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		var e event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := l.check(e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		l.apply(e)
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// check refuses an event apply cannot take: a second intent under a key,
+// or a batch of unknown ones.
+func (l *Log) check(e event) error {
+	switch e.Status {
+	case StatusReceived:
+		if e.Intent == nil {
+			return errors.New("received event without an intent")
+		}
+		k := Key{Pk: e.Intent.Pk, Nonce: e.Intent.Nonce}
+		if _, ok := l.records[k]; ok {
+			return fmt.Errorf("intent %s/%d received twice", k.Pk, k.Nonce)
+		}
+	case StatusBatched:
+		for _, k := range e.Keys {
+			if _, ok := l.records[k]; !ok {
+				return fmt.Errorf("batched unknown intent %s/%d", k.Pk, k.Nonce)
+			}
+		}
+	case StatusProven, StatusSettled:
+	default:
+		return fmt.Errorf("unknown status %q", e.Status)
+	}
+	return nil
+}
+
+func (l *Log) apply(e event) {
+	switch e.Status {
+	case StatusReceived:
+		r := &Record{Intent: *e.Intent}
+		r.step(e.Transition)
+		l.records[Key{Pk: r.Pk, Nonce: r.Nonce}] = r
+	case StatusBatched:
+		for _, k := range e.Keys {
+			l.records[k].step(e.Transition)
+		}
+		l.batches[e.BatchID] = append(l.batches[e.BatchID], e.Keys...)
+	case StatusProven, StatusSettled:
+		for _, r := range l.members(e.BatchID, e.Status) {
+			r.step(e.Transition)
+		}
+	}
+}
+
+// members are the intents of batchID that may move to status: those still
+// in it, not already there or past it.
+func (l *Log) members(batchID string, status Status) []*Record {
+	var out []*Record
+	for _, k := range l.batches[batchID] {
+		r := l.records[k]
+		if r.BatchID != batchID || slices.Contains(out, r) {
+			continue
+		}
+		if r.Status == StatusBatched || (status == StatusSettled && r.Status == StatusProven) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// append journals e, synced to disk, then applies it.
+func (l *Log) append(e event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: intake journal: %w", errs.ErrUnavailable, err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("%w: intake journal: %w", errs.ErrUnavailable, err)
+	}
+	l.apply(e)
+	return nil
+}
+
+// Submit takes in once its signature of the row message under version v
+// checks. Intake is idempotent by (pk, nonce): when the key is taken Submit
+// records nothing and returns the original's record with dup set, and,
+// when in's payload differs from the original's, an error wrapping
+// errs.ErrDuplicate.
+func (l *Log) Submit(in Intent, v circuit.MsgVersion) (rec Record, dup bool, err error) {
+	if in, err = in.canonical(); err != nil {
+		return Record{}, false, err
+	}
+	// before the lookup, so no one squats a key they cannot sign for
+	if err := in.verify(v); err != nil {
+		return Record{}, false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.records[Key{Pk: in.Pk, Nonce: in.Nonce}]; ok {
+		if r.Intent != in {
+			err = fmt.Errorf("%w: intent %s/%d was received with another payload", errs.ErrDuplicate, in.Pk, in.Nonce)
+		}
+		return r.clone(), true, err
+	}
+	e := event{Transition: Transition{Status: StatusReceived, Time: time.Now()}, Intent: &in}
+	if err := l.append(e); err != nil {
+		return Record{}, false, err
+	}
+	return l.records[Key{Pk: in.Pk, Nonce: in.Nonce}].clone(), false, nil
+}
+
+// Get is the record of the intent k, false when intake never received it.
+func (l *Log) Get(k Key) (Record, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.records[k]
+	if !ok {
+		return Record{}, false
+	}
+	return r.clone(), true
+}
+
+// Batched marks the received intents among rows as batched in batchID, hex,
+// and returns how many there were. Rows intake did not receive, or received
+// with another payload, are not its to track and are skipped, as are
+// settled intents. An intent batched again, its batch re-proven or its rows
+// rebatched, moves to the new batch.
+func (l *Log) Batched(batchID string, rows []Intent) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var keys []Key
+	for _, in := range rows {
+		in, err := in.canonical()
+		if err != nil {
+			continue
+		}
+		k := Key{Pk: in.Pk, Nonce: in.Nonce}
+		if r, ok := l.records[k]; ok && r.Intent == in && r.Status != StatusSettled && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	e := event{Transition: Transition{Status: StatusBatched, BatchID: batchID, Time: time.Now()}, Keys: keys}
+	return len(keys), l.append(e)
+}
+
+// Proven marks the intents batched in batchID as proven and returns how
+// many there were.
+func (l *Log) Proven(batchID string) (int, error) {
+	return l.advance(Transition{Status: StatusProven, BatchID: batchID})
+}
+
+// Settled marks the intents batched in batchID as settled by txHash and
+// returns how many there were.
+func (l *Log) Settled(batchID, txHash string) (int, error) {
+	return l.advance(Transition{Status: StatusSettled, BatchID: batchID, TxHash: txHash})
+}
+
+func (l *Log) advance(t Transition) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(l.members(t.BatchID, t.Status))
+	if n == 0 {
+		return 0, nil
+	}
+	t.Time = time.Now()
+	return n, l.append(event{Transition: t})
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+func (r *Record) clone() Record {
+	c := *r
+	c.History = slices.Clone(r.History)
+	return c
+}
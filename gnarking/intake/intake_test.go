@@ -0,0 +1,108 @@
+package intake
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func signed(t *testing.T, priv *bnEddsa.PrivateKey, size, nonce uint64) Intent {
+	t.Helper()
+	recipient := big.NewInt(0xbeef)
+	msg := circuit.MsgHash(circuit.MsgV1, recipient, new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(1))
+	sig, err := (circuit.EdDSA{}).Sign(priv, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Intent{
+		Pk:        "0x" + hex.EncodeToString(priv.PublicKey.Bytes()),
+		Recipient: "0xBEEF",
+		ChainID:   1,
+		Size:      size,
+		Nonce:     nonce,
+		Sig:       hex.EncodeToString(sig),
+	}
+}
+
+func TestIntakeLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intake.jsonl")
+	priv, err := bnEddsa.GenerateKey(bytes.NewReader(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := signed(t, priv, 5, 1), signed(t, priv, 7, 2)
+	for _, in := range []Intent{a, b} {
+		if _, dup, err := l.Submit(in, circuit.MsgV1); err != nil || dup {
+			t.Fatalf("submit: dup %v, %v", dup, err)
+		}
+	}
+
+	// the same intent again is idempotent, whatever its hex spelling
+	again := a
+	again.Pk = again.Pk[2:]
+	rec, dup, err := l.Submit(again, circuit.MsgV1)
+	if err != nil || !dup || rec.Status != StatusReceived {
+		t.Fatalf("resubmit: dup %v, status %s, %v", dup, rec.Status, err)
+	}
+	// another payload under the key is refused, with the original's record
+	other := signed(t, priv, 6, 1)
+	rec, dup, err = l.Submit(other, circuit.MsgV1)
+	if !errors.Is(err, errs.ErrDuplicate) || !dup || rec.Size != 5 {
+		t.Fatalf("conflicting resubmit: dup %v, size %d, %v", dup, rec.Size, err)
+	}
+	// and so is one its signer did not sign
+	forged := signed(t, priv, 5, 3)
+	forged.Size = 9
+	if _, _, err := l.Submit(forged, circuit.MsgV1); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("forged intent: %v", err)
+	}
+
+	// a batch of a and a row intake does not know
+	if n, err := l.Batched("b1", []Intent{a, signed(t, priv, 1, 9)}); err != nil || n != 1 {
+		t.Fatalf("batched: %d, %v", n, err)
+	}
+	if n, err := l.Proven("b1"); err != nil || n != 1 {
+		t.Fatalf("proven: %d, %v", n, err)
+	}
+	if n, err := l.Settled("b1", "0xtx"); err != nil || n != 1 {
+		t.Fatalf("settled: %d, %v", n, err)
+	}
+	// settled intents stay settled
+	if n, err := l.Batched("b2", []Intent{a, b}); err != nil || n != 1 {
+		t.Fatalf("rebatched: %d, %v", n, err)
+	}
+	l.Close()
+
+	// the journal replays to the same records
+	if l, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ka, _ := ParseKey(a.Pk, a.Nonce)
+	ra, ok := l.Get(ka)
+	if !ok || ra.Status != StatusSettled || ra.BatchID != "b1" || ra.TxHash != "0xtx" || len(ra.History) != 4 {
+		t.Fatalf("a after replay: %+v", ra)
+	}
+	kb, _ := ParseKey(b.Pk, b.Nonce)
+	if rb, _ := l.Get(kb); rb.Status != StatusBatched || rb.BatchID != "b2" {
+		t.Fatalf("b after replay: %+v", rb)
+	}
+	if _, dup, err := l.Submit(other, circuit.MsgV1); !dup || !errors.Is(err, errs.ErrDuplicate) {
+		t.Fatalf("conflicting resubmit after replay: dup %v, %v", dup, err)
+	}
+	if _, ok := l.Get(Key{Pk: ka.Pk, Nonce: 3}); ok {
+		t.Fatal("found an intent never received")
+	}
+}
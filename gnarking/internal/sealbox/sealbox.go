@@ -0,0 +1,121 @@
+// Package sealbox encrypts to an X25519 key, for the market's and the
+// escrow's sealed witnesses. A box is
+//
+//	ephemeral X25519 key (32) || nonce (12) || AES-256-GCM(plaintext)
+//
+// keyed by HKDF-SHA256 of the ECDH secret between the ephemeral key and the
+// recipient's, salted with both public keys, under the caller's info string,
+// with the caller's additional data followed by the ephemeral key as
+// additional data. What the additional data binds, and any header in front
+// of the box, is the caller's format.
+package sealbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// KeyLen is the length of an X25519 key, private or public.
+const KeyLen = 32
+
+// NewKey generates a recipient's key.
+func NewKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// ParseKey reads a hex X25519 private key, 0x prefix optional.
+func ParseKey(s string) (*ecdh.PrivateKey, error) {
+	b, err := hex.DecodeString(trimHex(s))
+	if err == nil {
+		var k *ecdh.PrivateKey
+		if k, err = ecdh.X25519().NewPrivateKey(b); err == nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: X25519 key must be 32 hex bytes", errs.ErrInvalidInput)
+}
+
+// ParsePublicKey reads a hex X25519 public key, 0x prefix optional.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	b, err := hex.DecodeString(trimHex(s))
+	if err == nil {
+		var k *ecdh.PublicKey
+		if k, err = ecdh.X25519().NewPublicKey(b); err == nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: X25519 public key must be 32 hex bytes", errs.ErrInvalidInput)
+}
+
+func trimHex(s string) string { return strings.TrimPrefix(strings.TrimSpace(s), "0x") }
+
+// Seal encrypts plain to the key to, bound to ad.
+func Seal(to *ecdh.PublicKey, info string, ad, plain []byte) ([]byte, error) {
+	eph, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(eph, to, eph.PublicKey(), to, info)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), eph.PublicKey().Bytes()...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(append(out, nonce...), nonce, plain, append(append([]byte(nil), ad...), out...)), nil
+}
+
+// Open decrypts a box with the recipient's key, failing with
+// ErrArtifactMismatch when it was sealed to another key, under another info
+// or ad, or altered.
+func Open(key *ecdh.PrivateKey, info string, ad, box []byte) ([]byte, error) {
+	if len(box) < KeyLen {
+		return nil, fmt.Errorf("%w: sealed box too short", errs.ErrInvalidInput)
+	}
+	eph, err := ecdh.X25519().NewPublicKey(box[:KeyLen])
+	if err != nil {
+		return nil, fmt.Errorf("%w: sealed box key: %w", errs.ErrInvalidInput, err)
+	}
+	aead, err := newAEAD(key, eph, eph, key.PublicKey(), info)
+	if err != nil {
+		return nil, err
+	}
+	rest := box[KeyLen:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: sealed box too short", errs.ErrInvalidInput)
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], append(append([]byte(nil), ad...), box[:KeyLen]...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not sealed to this key, or altered", errs.ErrArtifactMismatch)
+	}
+	return plain, nil
+}
+
+// newAEAD keys AES-256-GCM from the ECDH secret of priv and pub, salted with
+// the ephemeral and recipient public keys.
+func newAEAD(priv *ecdh.PrivateKey, pub, eph, recipient *ecdh.PublicKey, info string) (cipher.AEAD, error) {
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	key, err := hkdf.Key(sha256.New, secret, append(eph.Bytes(), recipient.Bytes()...), info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,58 @@
+package sealbox
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both spellings of the recipient's key parse to it
+	for _, s := range []string{hex.EncodeToString(key.PublicKey().Bytes()), " 0x" + hex.EncodeToString(key.PublicKey().Bytes()) + "\n"} {
+		if pub, err := ParsePublicKey(s); err != nil || !pub.Equal(key.PublicKey()) {
+			t.Fatalf("ParsePublicKey(%q) = %v, %v", s, pub, err)
+		}
+	}
+	if k, err := ParseKey("0x" + hex.EncodeToString(key.Bytes())); err != nil || !k.Equal(key) {
+		t.Fatalf("ParseKey = %v, %v", k, err)
+	}
+	if _, err := ParsePublicKey("0x1234"); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("short key: %v", err)
+	}
+
+	plain, ad := []byte("witness"), []byte("header")
+	box, err := Seal(key.PublicKey(), "test v1", ad, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Open(key, "test v1", ad, box); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+
+	other, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), box...)
+	flipped[len(flipped)-1] ^= 1
+	for name, open := range map[string]func() ([]byte, error){
+		"other key":  func() ([]byte, error) { return Open(other, "test v1", ad, box) },
+		"other info": func() ([]byte, error) { return Open(key, "test v2", ad, box) },
+		"other ad":   func() ([]byte, error) { return Open(key, "test v1", []byte("headed"), box) },
+		"altered":    func() ([]byte, error) { return Open(key, "test v1", ad, flipped) },
+	} {
+		if _, err := open(); !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s: %v, want ErrArtifactMismatch", name, err)
+		}
+	}
+	if _, err := Open(key, "test v1", ad, box[:KeyLen+4]); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("truncated: %v, want ErrInvalidInput", err)
+	}
+}
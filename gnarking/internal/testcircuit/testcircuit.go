@@ -0,0 +1,45 @@
+// Package testcircuit is a small circuit with the settlement public inputs,
+// for tests of what handles settlement proofs (verifiers, markets, escrow)
+// that do not need the settlement circuit itself.
+package testcircuit
+
+import (
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/circuit"
+)
+
+// SettlementShaped has the settlement public inputs, X*X == TotalSettle, and
+// Sum binding the rest.
+type SettlementShaped struct {
+	P   circuit.SettlementCircuitPublic
+	X   frontend.Variable
+	Sum frontend.Variable
+}
+
+func (c *SettlementShaped) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.P.TotalSettle)
+	api.AssertIsEqual(c.Sum, api.Add(c.P.Recipient, c.P.KOld, c.P.M, c.P.ChainID, c.P.Pk.A.X, c.P.Pk.A.Y, c.P.BatchDataRoot))
+	return nil
+}
+
+// Public is the public inputs Witness(x) proves: recipient 42, nonces 0 to
+// 8, chain 1, key (1, 2), data root 3 and a total of x*x, as *big.Int so
+// they marshal and hash as a batch's do.
+func Public(x int64) circuit.SettlementCircuitPublic {
+	pub := circuit.SettlementCircuitPublic{
+		Recipient: big.NewInt(42), KOld: big.NewInt(0), M: big.NewInt(8), TotalSettle: big.NewInt(x * x),
+		ChainID: big.NewInt(1), BatchDataRoot: big.NewInt(3),
+	}
+	pub.Pk.A.X, pub.Pk.A.Y = big.NewInt(1), big.NewInt(2)
+	return pub
+}
+
+// Witness is the full witness of knowing x, a root of Public(x)'s total.
+func Witness(x int64) (witness.Witness, error) {
+	return frontend.NewWitness(&SettlementShaped{P: Public(x), X: x, Sum: 57}, ecc.BN254.ScalarField())
+}
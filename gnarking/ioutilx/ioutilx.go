@@ -0,0 +1,104 @@
+// Package ioutilx holds the io helpers artifact IO, the uploaders and the
+// bench share: writers that count or hash what passes through them, and the
+// one way sizes and rates are printed.
+package ioutilx
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// Counter is an io.Writer that discards what it is given and counts it, to
+// size a serialization without holding it.
+type Counter struct {
+	N int64
+}
+
+func (c *Counter) Write(p []byte) (int, error) {
+	c.N += int64(len(p))
+	return len(p), nil
+}
+
+// CountingWriter passes writes to W and counts the bytes W accepted.
+type CountingWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.W.Write(p)
+	c.N += int64(n)
+	return n, err
+}
+
+// HashWriter passes writes to an underlying writer, if any, and hashes and
+// counts the bytes it accepted with SHA-256.
+type HashWriter struct {
+	w io.Writer
+	h hash.Hash
+	N int64
+}
+
+// NewHashWriter hashes what is written through to w; w may be nil to only
+// hash.
+func NewHashWriter(w io.Writer) *HashWriter {
+	return &HashWriter{w: w, h: sha256.New()}
+}
+
+func (h *HashWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var err error
+	if h.w != nil {
+		n, err = h.w.Write(p)
+	}
+	h.h.Write(p[:n])
+	h.N += int64(n)
+	return n, err
+}
+
+// Sum is the SHA-256 of everything written so far.
+func (h *HashWriter) Sum() [32]byte {
+	var out [32]byte
+	h.h.Sum(out[:0])
+	return out
+}
+
+// SizeOf is the serialized size of a.
+func SizeOf(a io.WriterTo) (int64, error) {
+	var c Counter
+	_, err := a.WriteTo(&c)
+	return c.N, err
+}
+
+// HashOf is the serialized size and SHA-256 of a.
+func HashOf(a io.WriterTo) (int64, [32]byte, error) {
+	h := NewHashWriter(nil)
+	if _, err := a.WriteTo(h); err != nil {
+		return h.N, [32]byte{}, err
+	}
+	return h.N, h.Sum(), nil
+}
+
+// Size prints n bytes in binary units: "812 B", "1.50 KiB", "3.21 MiB".
+func Size(n int64) string {
+	const unit = 1 << 10
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, i := float64(n)/unit, 0
+	for ; (v >= unit || v <= -unit) && i < 4; i++ {
+		v /= unit
+	}
+	return fmt.Sprintf("%.2f %ciB", v, "KMGTP"[i])
+}
+
+// Rate prints n bytes moved in d as a rate, e.g. "12.40 MiB/s".
+func Rate(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "- B/s"
+	}
+	return Size(int64(float64(n)/d.Seconds())) + "/s"
+}
@@ -0,0 +1,75 @@
+package ioutilx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// shortWriter accepts at most n bytes in all.
+type shortWriter struct{ n int }
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		k := w.n
+		w.n = 0
+		return k, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriters(t *testing.T) {
+	data := bytes.Repeat([]byte("ddm"), 1000)
+
+	var buf bytes.Buffer
+	h := NewHashWriter(&buf)
+	if _, err := io.Copy(h, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if h.Sum() != sha256.Sum256(data) || h.N != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("hash writer: %d bytes", h.N)
+	}
+	if n, sum, err := HashOf(bytes.NewReader(data)); err != nil || n != int64(len(data)) || sum != sha256.Sum256(data) {
+		t.Fatalf("HashOf: %d, %v", n, err)
+	}
+	if n, err := SizeOf(bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("SizeOf: %d, %v", n, err)
+	}
+
+	// only what the underlying writer took is counted and hashed
+	h = NewHashWriter(&shortWriter{10})
+	c := &CountingWriter{W: h}
+	if _, err := c.Write(data); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatal(err)
+	}
+	if c.N != 10 || h.N != 10 || h.Sum() != sha256.Sum256(data[:10]) {
+		t.Fatalf("short write: counted %d, hashed %d", c.N, h.N)
+	}
+}
+
+func TestSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1536:              "1.50 KiB",
+		3 << 20:           "3.00 MiB",
+		5<<30 + 1<<29:     "5.50 GiB",
+		-2048:             "-2.00 KiB",
+		1 << 62:           "4096.00 PiB",
+		1<<40 + (1<<40)/4: "1.25 TiB",
+	} {
+		if got := Size(n); got != want {
+			t.Errorf("Size(%d) = %s, want %s", n, got, want)
+		}
+	}
+	if got := Rate(10<<20, 2*time.Second); got != "5.00 MiB/s" {
+		t.Errorf("Rate = %s", got)
+	}
+	if got := Rate(1, 0); got != "- B/s" {
+		t.Errorf("Rate over no time = %s", got)
+	}
+}
@@ -0,0 +1,212 @@
+// Package keys derives the operator's EdDSA signing keys (babyjubjub, the
+// BN254 twisted Edwards curve the circuit verifies) from one master seed, so
+// per-recipient or per-epoch keys need no key store of their own: a key is
+// the seed plus its derivation path.
+//
+// Derivation follows SLIP-0010 as used for ed25519: a node is a 32-byte key
+// seed and a 32-byte chain code, the master node is HMAC-SHA512 of the seed
+// under "ddm babyjubjub seed", and child i is HMAC-SHA512(chain code,
+// 0x00 || key seed || ser32(i + 2^31)). Only hardened children exist: with
+// hashed EdDSA keys there is no public derivation, and a leaked child key
+// reveals nothing about its parent. A node's key seed is what gnark-crypto's
+// eddsa.GenerateKey reads.
+package keys
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/errs"
+)
+
+// Hardened is added to every index before it is hashed.
+const Hardened = 1 << 31
+
+// masterKey is the HMAC key of the master node, fixed forever: a different
+// one derives different keys from the same seed.
+var masterKey = []byte("ddm babyjubjub seed")
+
+// Seed is a master seed.
+type Seed [32]byte
+
+func NewSeed() (Seed, error) {
+	var s Seed
+	_, err := rand.Read(s[:])
+	return s, err
+}
+
+func (s Seed) String() string { return hex.EncodeToString(s[:]) }
+
+func ParseSeed(str string) (Seed, error) {
+	var s Seed
+	b, err := hex.DecodeString(strings.TrimSpace(str))
+	if err != nil || len(b) != len(s) {
+		return s, fmt.Errorf("%w: master seed must be %d hex bytes", errs.ErrInvalidInput, len(s))
+	}
+	copy(s[:], b)
+	return s, nil
+}
+
+// Path is a derivation path from the master node: child indices, each below
+// Hardened and hardened when derived. It prints as m/1'/42'.
+type Path []uint32
+
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range p {
+		fmt.Fprintf(&b, "/%d'", i)
+	}
+	return b.String()
+}
+
+// ParsePath reads m/1'/42' (or m/1h/42h). Unhardened indices are refused
+// rather than silently hardened: the path recorded in a receipt must be the
+// one that derives the key.
+func ParsePath(s string) (Path, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: path %q does not start at m", errs.ErrInvalidInput, s)
+	}
+	p := make(Path, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		idx, ok := strings.CutSuffix(part, "'")
+		if !ok {
+			idx, ok = strings.CutSuffix(part, "h")
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: path %q: index %q is not hardened, only hardened derivation exists", errs.ErrInvalidInput, s, part)
+		}
+		i, err := strconv.ParseUint(idx, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: path %q: index %q", errs.ErrInvalidInput, s, part)
+		}
+		p = append(p, uint32(i))
+	}
+	return p, nil
+}
+
+// Purposes, the first index of the conventional paths.
+const (
+	PurposeRecipient = 1
+	PurposeEpoch     = 2
+)
+
+// RecipientPath is the path of recipient's key: m/1'/a'/b' with a and b the
+// first two 31-bit words of sha256 of the recipient's 32-byte big-endian
+// form. 62 bits keep distinct recipients on distinct keys in practice; the
+// path, not the recipient, is what a receipt records.
+func RecipientPath(recipient *big.Int) Path {
+	var buf [32]byte
+	h := sha256.Sum256(recipient.FillBytes(buf[:]))
+	return Path{
+		PurposeRecipient,
+		binary.BigEndian.Uint32(h[0:4]) &^ Hardened,
+		binary.BigEndian.Uint32(h[4:8]) &^ Hardened,
+	}
+}
+
+// EpochPath is the path of the key of epoch: m/2'/epoch'.
+func EpochPath(epoch uint32) (Path, error) {
+	if epoch >= Hardened {
+		return nil, fmt.Errorf("%w: epoch %d past 2^31", errs.ErrInvalidInput, epoch)
+	}
+	return Path{PurposeEpoch, epoch}, nil
+}
+
+// Node is a private node of the derivation tree.
+type Node struct {
+	Path  Path
+	key   [32]byte
+	chain [32]byte
+}
+
+// Master is the root node of seed.
+func Master(seed Seed) Node {
+	return newNode(nil, masterKey, seed[:])
+}
+
+// newNode splits HMAC-SHA512(key, data...) into key seed and chain code.
+func newNode(p Path, key []byte, data ...[]byte) Node {
+	mac := hmac.New(sha512.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	sum := mac.Sum(nil)
+	n := Node{Path: p}
+	copy(n.key[:], sum[:32])
+	copy(n.chain[:], sum[32:])
+	return n
+}
+
+// Child is n's hardened child i.
+func (n Node) Child(i uint32) (Node, error) {
+	if i >= Hardened {
+		return Node{}, fmt.Errorf("%w: index %d past 2^31", errs.ErrInvalidInput, i)
+	}
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], i+Hardened)
+	return newNode(append(append(Path{}, n.Path...), i), n.chain[:], []byte{0}, n.key[:], idx[:]), nil
+}
+
+// Derive walks p down from n.
+func (n Node) Derive(p Path) (Node, error) {
+	var err error
+	for _, i := range p {
+		if n, err = n.Child(i); err != nil {
+			return Node{}, err
+		}
+	}
+	return n, nil
+}
+
+// PrivateKey is n's EdDSA key.
+func (n Node) PrivateKey() (*bnEddsa.PrivateKey, error) {
+	return bnEddsa.GenerateKey(bytes.NewReader(n.key[:]))
+}
+
+// KeySeed is the 32 bytes PrivateKey expands into n's EdDSA key: what a
+// key store wraps instead of the master seed (package hsm).
+func (n Node) KeySeed() [32]byte { return n.key }
+
+// Derive is the key at p under seed.
+func Derive(seed Seed, p Path) (*bnEddsa.PrivateKey, error) {
+	n, err := Master(seed).Derive(p)
+	if err != nil {
+		return nil, err
+	}
+	return n.PrivateKey()
+}
+
+// Export is a derived public key in the forms it is registered with: the
+// compressed key batches carry (server.ProveRequest.Pk) and the coordinates
+// the contract pins as the pk_x and pk_y public inputs.
+type Export struct {
+	Path string `json:"path"`
+	Pk   string `json:"pk"`   // hex, 32-byte compressed
+	PkX  string `json:"pk_x"` // 0x-hex, 32 bytes
+	PkY  string `json:"pk_y"`
+}
+
+func ExportKey(p Path, pub *bnEddsa.PublicKey) Export {
+	var x, y big.Int
+	pub.A.X.BigInt(&x)
+	pub.A.Y.BigInt(&y)
+	return Export{
+		Path: p.String(),
+		Pk:   hex.EncodeToString(pub.Bytes()),
+		PkX:  fmt.Sprintf("0x%064x", &x),
+		PkY:  fmt.Sprintf("0x%064x", &y),
+	}
+}
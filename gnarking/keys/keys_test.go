@@ -0,0 +1,93 @@
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	_ "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark-crypto/hash"
+
+	"gnarking/errs"
+)
+
+func TestDerive(t *testing.T) {
+	var seed Seed
+	seed[31] = 1
+	p, err := ParsePath("m/1'/2h")
+	if err != nil || p.String() != "m/1'/2'" {
+		t.Fatalf("ParsePath: %v, %v", p, err)
+	}
+
+	priv, err := Derive(seed, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pinned: a change here re-keys every operator
+	const want = "6ab26e00c0101880ceeff84430dcd56d14bcf5c715d95d442a190d54f5868ca6"
+	if got := hex.EncodeToString(priv.PublicKey.Bytes()); got != want {
+		t.Errorf("m/1'/2' pk %s, want %s", got, want)
+	}
+
+	// walking one step at a time lands on the same key
+	n, err := Master(seed).Child(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err = n.Derive(Path{2}); err != nil || n.Path.String() != p.String() {
+		t.Fatalf("stepwise: %v, %v", n.Path, err)
+	}
+	stepped, err := n.PrivateKey()
+	if err != nil || !stepped.PublicKey.Equal(&priv.PublicKey) {
+		t.Fatal("stepwise derivation differs")
+	}
+
+	// siblings, other seeds and the parent are other keys
+	others := map[string]Path{"sibling": {1, 3}, "parent": {1}, "master": {}}
+	for name, q := range others {
+		k, err := Derive(seed, q)
+		if err != nil || k.PublicKey.Equal(&priv.PublicKey) {
+			t.Errorf("%s shares the key (%v)", name, err)
+		}
+	}
+	seed[0] = 1
+	if k, _ := Derive(seed, p); k.PublicKey.Equal(&priv.PublicKey) {
+		t.Error("other seed shares the key")
+	}
+
+	// a derived key signs like any other
+	msg := []byte("msettle1")
+	sig, err := priv.Sign(msg, hash.MIMC_BN254.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := priv.PublicKey.Verify(sig, msg, hash.MIMC_BN254.New()); !ok || err != nil {
+		t.Fatalf("signature of a derived key: %v", err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	for _, bad := range []string{"", "1'/2'", "m/1", "m/1'/x'", "m/2147483648'", "m/-1'", "m//1'"} {
+		if _, err := ParsePath(bad); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("ParsePath(%q): %v", bad, err)
+		}
+	}
+	if _, err := Master(Seed{}).Child(Hardened); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("child past 2^31: %v", err)
+	}
+
+	a, b := RecipientPath(big.NewInt(42)), RecipientPath(big.NewInt(43))
+	if len(a) != 3 || a[0] != PurposeRecipient || a.String() == b.String() {
+		t.Errorf("recipient paths %s, %s", a, b)
+	}
+	if again, err := ParsePath(a.String()); err != nil || again.String() != a.String() {
+		t.Errorf("round trip of %s: %v, %v", a, again, err)
+	}
+	if p, err := EpochPath(7); err != nil || p.String() != "m/2'/7'" {
+		t.Errorf("EpochPath(7) = %v, %v", p, err)
+	}
+	if _, err := EpochPath(Hardened); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("EpochPath(2^31): %v", err)
+	}
+}
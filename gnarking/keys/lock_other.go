@@ -0,0 +1,14 @@
+//go:build !unix
+
+package keys
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile has no portable implementation here, so a persisted Enforcer
+// refuses to sign rather than share totals unlocked.
+func lockFile(*os.File) error {
+	return errors.New("file locking not supported on this platform")
+}
@@ -0,0 +1,269 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gnarking/errs"
+)
+
+// Usage restricts what one key may sign. It is checked per row before the
+// signature is made, so whoever feeds rows to the signer (a compromised
+// batch builder) cannot get arbitrary ones signed. Zero fields do not
+// restrict.
+type Usage struct {
+	ChainIDs      []uint64 `json:"chain_ids,omitempty"` // allowlist
+	MaxRowSize    uint64   `json:"max_row_size,omitempty"`
+	MaxDailyTotal uint64   `json:"max_daily_total,omitempty"` // sum of the row sizes signed per UTC day
+}
+
+// UsagePolicy is a key usage policy file: the Usage of each key by
+// derivation path, and Default for the keys it does not list. Without a
+// default, unlisted keys sign nothing.
+type UsagePolicy struct {
+	Default *Usage           `json:"default,omitempty"`
+	Keys    map[string]Usage `json:"keys,omitempty"` // by Path, m/1'/42'
+}
+
+// LoadUsagePolicy reads a JSON UsagePolicy; unknown fields and paths that
+// do not parse are an error so a typo does not silently lift a limit.
+func LoadUsagePolicy(path string) (*UsagePolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var p UsagePolicy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: key policy %s: %w", errs.ErrInvalidInput, path, err)
+	}
+	// keyed by the canonical form, so m/1h/42h finds m/1'/42'
+	keys := make(map[string]Usage, len(p.Keys))
+	for s, u := range p.Keys {
+		kp, err := ParsePath(s)
+		if err != nil {
+			return nil, fmt.Errorf("key policy %s: %w", path, err)
+		}
+		keys[kp.String()] = u
+	}
+	p.Keys = keys
+	return &p, nil
+}
+
+// For is the usage of the key at path, false when it may not sign at all.
+func (p *UsagePolicy) For(path Path) (Usage, bool) {
+	if u, ok := p.Keys[path.String()]; ok {
+		return u, true
+	}
+	if p.Default != nil {
+		return *p.Default, true
+	}
+	return Usage{}, false
+}
+
+// Violation is one refused signature.
+type Violation struct {
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path"`
+	ChainID uint64    `json:"chain_id"`
+	Size    uint64    `json:"size"` // the offending row's, or the rows' total
+	Reason  string    `json:"reason"`
+}
+
+// MaxViolations is how many recent violations an Enforcer keeps.
+const MaxViolations = 100
+
+// Enforcer applies a UsagePolicy at signing time and keeps each key's
+// totals of the day and its recent refusals. With State empty they live in
+// memory and a signer that restarts starts the day over; with State set
+// every Authorize reads and rewrites them there under an exclusive file
+// lock, so they survive restarts, every signer sharing the file shares the
+// limit, and the refusals can be read back from it (ddm keys violations).
+type Enforcer struct {
+	Policy *UsagePolicy
+	State  string           // file the day's totals persist in, e.g. next to the key; memory only when empty
+	Log    func(Violation)  // called for every refusal, may be nil
+	Now    func() time.Time // time.Now when nil
+
+	mu         sync.Mutex
+	day        string
+	spent      map[string]uint64 // by path, for day
+	violations []Violation
+}
+
+// Authorize checks that the key at path may sign rows of sizes for
+// chainID and counts them toward the key's daily total, all or none: a
+// batch refused halfway spends nothing. Refusals wrap
+// errs.ErrPolicyRejected and are logged and kept (Violations), in State
+// when set, where one that cannot be saved is joined to the refusal; a State
+// file that cannot be locked or written refuses every batch with
+// errs.ErrUnavailable, one that does not parse with errs.ErrInvalidInput.
+func (e *Enforcer) Authorize(path Path, chainID uint64, sizes ...uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.today()
+	key := path.String()
+	state, err := e.lockState()
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		defer state.Close()
+	}
+	refuse := func(size uint64, format string, args ...any) error {
+		v := Violation{Time: t, Path: key, ChainID: chainID, Size: size, Reason: fmt.Sprintf(format, args...)}
+		e.violations = append(e.violations, v)
+		if len(e.violations) > MaxViolations {
+			e.violations = slices.Delete(e.violations, 0, len(e.violations)-MaxViolations)
+		}
+		if e.Log != nil {
+			e.Log(v)
+		}
+		err := fmt.Errorf("%w: key %s: %s", errs.ErrPolicyRejected, key, v.Reason)
+		if state != nil {
+			if serr := e.saveState(state); serr != nil {
+				return errors.Join(err, serr)
+			}
+		}
+		return err
+	}
+
+	var total uint64
+	for _, size := range sizes {
+		if total+size < total {
+			return refuse(size, "rows total past uint64")
+		}
+		total += size
+	}
+	u, ok := e.Policy.For(path)
+	switch {
+	case !ok:
+		return refuse(total, "key not in the policy")
+	case len(u.ChainIDs) > 0 && !slices.Contains(u.ChainIDs, chainID):
+		return refuse(total, "chain ID %d not allowed", chainID)
+	}
+	for i, size := range sizes {
+		if u.MaxRowSize > 0 && size > u.MaxRowSize {
+			return refuse(size, "row %d size %d over %d", i, size, u.MaxRowSize)
+		}
+	}
+	spent := e.spent[key]
+	if u.MaxDailyTotal > 0 && (total > u.MaxDailyTotal || spent > u.MaxDailyTotal-total) {
+		return refuse(total, "daily total %d + %d over %d", spent, total, u.MaxDailyTotal)
+	}
+	e.spent[key] = spent + total
+	if state != nil {
+		if err := e.saveState(state); err != nil {
+			e.spent[key] = spent
+			return err
+		}
+	}
+	return nil
+}
+
+// usageState is the State file: the totals of Day by path, and the last
+// MaxViolations refusals of any day.
+type usageState struct {
+	Day        string            `json:"day"`
+	Spent      map[string]uint64 `json:"spent"`
+	Violations []Violation       `json:"violations,omitempty"`
+}
+
+// lockState opens and exclusively locks the State file, nil without one,
+// and takes the day's totals and the refusals from it; closing the file
+// unlocks it.
+func (e *Enforcer) lockState() (*os.File, error) {
+	if e.State == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(e.State, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key usage state: %w", errs.ErrUnavailable, err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: lock key usage state %s: %w", errs.ErrUnavailable, e.State, err)
+	}
+	var s usageState
+	if err := json.NewDecoder(f).Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		f.Close()
+		return nil, fmt.Errorf("%w: key usage state %s: %w", errs.ErrInvalidInput, e.State, err)
+	}
+	e.spent, e.violations = make(map[string]uint64), s.Violations
+	if s.Day == e.day {
+		for path, spent := range s.Spent {
+			e.spent[path] = spent
+		}
+	}
+	return f, nil
+}
+
+// saveState rewrites the locked State file with the day's totals.
+func (e *Enforcer) saveState(f *os.File) error {
+	b, err := json.Marshal(usageState{Day: e.day, Spent: e.spent, Violations: e.violations})
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err == nil {
+		if _, err = f.WriteAt(b, 0); err == nil {
+			err = f.Sync()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: write key usage state %s: %w", errs.ErrUnavailable, e.State, err)
+	}
+	return nil
+}
+
+// today is the time now, starting the day's totals over at UTC midnight.
+func (e *Enforcer) today() time.Time {
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	t := now().UTC()
+	if day := t.Format(time.DateOnly); day != e.day {
+		e.day, e.spent = day, make(map[string]uint64)
+	}
+	return t
+}
+
+// Violations are the most recent refusals, oldest first, read from State
+// when set: those of every signer sharing it.
+func (e *Enforcer) Violations() ([]Violation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.today()
+	state, err := e.lockState()
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		state.Close()
+	}
+	return slices.Clone(e.violations), nil
+}
+
+// Spent is what the key at path has signed today, read from State when
+// set.
+func (e *Enforcer) Spent(path Path) (uint64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.today()
+	state, err := e.lockState()
+	if err != nil {
+		return 0, err
+	}
+	if state != nil {
+		state.Close()
+	}
+	return e.spent[path.String()], nil
+}
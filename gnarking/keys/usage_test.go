@@ -0,0 +1,122 @@
+package keys
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+func TestEnforcer(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(file, []byte(`{
+		"default": {"chain_ids": [1], "max_row_size": 10},
+		"keys": {"m/1h/42h": {"chain_ids": [1, 8453], "max_row_size": 100, "max_daily_total": 250}}
+	}`), 0o644)
+	policy, err := LoadUsagePolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	var logged []Violation
+	e := &Enforcer{Policy: policy, Now: func() time.Time { return now }, Log: func(v Violation) { logged = append(logged, v) }}
+	listed, other := Path{1, 42}, Path{2, 7}
+
+	if err := e.Authorize(listed, 8453, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path    Path
+		chainID uint64
+		sizes   []uint64
+	}{
+		{listed, 10, []uint64{1}},     // chain not allowed
+		{listed, 1, []uint64{1, 101}}, // row over the key's max
+		{listed, 1, []uint64{30, 30}}, // 200 + 60 over the daily 250
+		{other, 8453, []uint64{1}},    // default: chain 1 only
+		{other, 1, []uint64{11}},      // default row max
+	} {
+		if err := e.Authorize(tc.path, tc.chainID, tc.sizes...); !errors.Is(err, errs.ErrPolicyRejected) {
+			t.Errorf("%s chain %d sizes %v: %v", tc.path, tc.chainID, tc.sizes, err)
+		}
+	}
+	// refused batches spend nothing
+	if got, err := e.Spent(listed); err != nil || got != 200 {
+		t.Fatalf("spent %d, want 200: %v", got, err)
+	}
+	if vs, err := e.Violations(); err != nil || len(logged) != 5 || len(vs) != 5 || logged[1].Size != 101 {
+		t.Fatalf("violations %+v: %v", logged, err)
+	}
+
+	// the daily total starts over at UTC midnight
+	now = now.Add(2 * time.Hour)
+	if err := e.Authorize(listed, 1, 100, 100, 50); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+	if got, _ := e.Spent(listed); got != 250 {
+		t.Fatalf("next day: spent %d", got)
+	}
+
+	// without a default, unlisted keys sign nothing
+	policy.Default = nil
+	if err := e.Authorize(other, 1, 1); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("unlisted key: %v", err)
+	}
+
+	os.WriteFile(file, []byte(`{"keys": {"m/1/42": {}}}`), 0o644)
+	if _, err := LoadUsagePolicy(file); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("unhardened path: %v", err)
+	}
+}
+
+func TestEnforcerState(t *testing.T) {
+	dir := t.TempDir()
+	policy := &UsagePolicy{Default: &Usage{MaxDailyTotal: 100}}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := filepath.Join(dir, "key.usage.json")
+	signer := func() *Enforcer {
+		return &Enforcer{Policy: policy, State: state, Now: func() time.Time { return now }}
+	}
+	key := Path{1, 42}
+
+	// a restarted signer, and a second one on the same file, see the total
+	if err := signer().Authorize(key, 1, 60); err != nil {
+		t.Fatal(err)
+	}
+	a, b := signer(), signer()
+	if err := a.Authorize(key, 1, 50); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("after a restart: %v", err)
+	}
+	if err := b.Authorize(key, 1, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Authorize(key, 1, 1); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("after another signer: %v", err)
+	}
+	if got, err := a.Spent(key); err != nil || got != 100 {
+		t.Fatalf("spent %d: %v", got, err)
+	}
+	// both signers' refusals, read back by a third
+	if vs, err := signer().Violations(); err != nil || len(vs) != 2 || vs[0].Size != 50 || vs[1].Size != 1 {
+		t.Fatalf("violations %+v: %v", vs, err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if err := signer().Authorize(key, 1, 100); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+	if vs, err := signer().Violations(); err != nil || len(vs) != 2 {
+		t.Fatalf("next day's violations %+v: %v", vs, err)
+	}
+
+	os.WriteFile(state, []byte("{"), 0o600)
+	if err := signer().Authorize(key, 1, 1); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("corrupt state: %v", err)
+	}
+	if err := (&Enforcer{Policy: policy, State: filepath.Join(dir, "missing", "state")}).Authorize(key, 1, 1); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("unwritable state: %v", err)
+	}
+}
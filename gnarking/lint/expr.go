@@ -0,0 +1,370 @@
+package lint
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gnarking/errs"
+)
+
+// An expression is a rule's condition, in a small language over integers,
+// strings, booleans and lists:
+//
+//	size % 1000 == 0
+//	recipient in allowed_recipients && chain_id in [1, 10]
+//	!(tenant == "acme") || total <= 5000000
+//
+// Operators, loosest first: ||, &&, !, the comparisons == != < <= > >= and
+// in, + -, * / %, unary -. Integers are arbitrary-precision, decimal or
+// 0x hex; strings are double-quoted; lists are [a, b, ...]. A name is a
+// variable of the batch or row, or a list of the configuration.
+type expr interface {
+	eval(env *env) (any, error)
+}
+
+type (
+	literal struct{ v any }
+	ident   struct{ name string }
+	list    []expr
+	unary   struct {
+		op string
+		x  expr
+	}
+	binary struct {
+		op   string
+		x, y expr
+	}
+)
+
+// compile parses src, every name in it one of names.
+func compile(src string, names []string) (expr, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, names: names}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("%w: %q: unexpected %q", errs.ErrInvalidInput, src, p.toks[p.pos])
+	}
+	return e, nil
+}
+
+func tokenize(src string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := strings.IndexByte(src[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("%w: %q: unterminated string", errs.ErrInvalidInput, src)
+			}
+			toks = append(toks, src[i:i+j+2])
+			i += j + 2
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		default:
+			if i+1 < len(src) && slices.Contains([]string{"||", "&&", "==", "!=", "<=", ">="}, src[i:i+2]) {
+				toks = append(toks, src[i:i+2])
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("!<>+-*/%()[],", c) {
+				return nil, fmt.Errorf("%w: %q: unexpected %q", errs.ErrInvalidInput, src, c)
+			}
+			toks = append(toks, string(c))
+			i++
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks  []string
+	pos   int
+	names []string
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// binaries parses operands of sub joined by any of ops, left-associative.
+func (p *parser) binaries(sub func() (expr, error), ops ...string) (expr, error) {
+	x, err := sub()
+	if err != nil {
+		return nil, err
+	}
+	for slices.Contains(ops, p.peek()) {
+		op := p.next()
+		y, err := sub()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) or() (expr, error)  { return p.binaries(p.and, "||") }
+func (p *parser) and() (expr, error) { return p.binaries(p.not, "&&") }
+
+func (p *parser) not() (expr, error) {
+	if p.peek() == "!" {
+		p.next()
+		x, err := p.not()
+		return unary{"!", x}, err
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	x, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); slices.Contains([]string{"==", "!=", "<", "<=", ">", ">=", "in"}, op) {
+		p.next()
+		y, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op, x, y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) sum() (expr, error)     { return p.binaries(p.product, "+", "-") }
+func (p *parser) product() (expr, error) { return p.binaries(p.negation, "*", "/", "%") }
+
+func (p *parser) negation() (expr, error) {
+	if p.peek() == "-" {
+		p.next()
+		x, err := p.negation()
+		return unary{"-", x}, err
+	}
+	return p.operand()
+}
+
+func (p *parser) operand() (expr, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("%w: expression ends early", errs.ErrInvalidInput)
+	case t == "(":
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing )", errs.ErrInvalidInput)
+		}
+		return x, nil
+	case t == "[":
+		var l list
+		for p.peek() != "]" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, x)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if p.next() != "]" {
+			return nil, fmt.Errorf("%w: missing ]", errs.ErrInvalidInput)
+		}
+		return l, nil
+	case t[0] == '"':
+		return literal{t[1 : len(t)-1]}, nil
+	case unicode.IsDigit(rune(t[0])):
+		v, ok := new(big.Int).SetString(t, 0)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a number", errs.ErrInvalidInput, t)
+		}
+		return literal{v}, nil
+	case t == "true" || t == "false":
+		return literal{t == "true"}, nil
+	case t[0] == '_' || unicode.IsLetter(rune(t[0])):
+		if !slices.Contains(p.names, t) {
+			return nil, fmt.Errorf("%w: unknown name %q (have %s)", errs.ErrInvalidInput, t, strings.Join(p.names, ", "))
+		}
+		return ident{t}, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", errs.ErrInvalidInput, t)
+}
+
+// env is what names evaluate to.
+type env struct {
+	vars  map[string]any
+	lists map[string][]any
+}
+
+func (l literal) eval(*env) (any, error) { return l.v, nil }
+
+func (i ident) eval(e *env) (any, error) {
+	if v, ok := e.vars[i.name]; ok {
+		return v, nil
+	}
+	if l, ok := e.lists[i.name]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("%w: %s is not set", errs.ErrInvalidInput, i.name)
+}
+
+func (l list) eval(e *env) (any, error) {
+	out := make([]any, len(l))
+	for i, x := range l {
+		v, err := x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (u unary) eval(e *env) (any, error) {
+	v, err := u.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if u.op == "!" {
+			return !v, nil
+		}
+	case *big.Int:
+		if u.op == "-" {
+			return new(big.Int).Neg(v), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s of %s", errs.ErrInvalidInput, u.op, typeName(v))
+}
+
+func (b binary) eval(e *env) (any, error) {
+	x, err := b.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	// && and || short-circuit, so a guard can keep the other side from
+	// failing
+	if b.op == "&&" || b.op == "||" {
+		xb, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s of %s", errs.ErrInvalidInput, b.op, typeName(x))
+		}
+		if xb == (b.op == "||") {
+			return xb, nil
+		}
+		y, err := b.y.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if yb, ok := y.(bool); ok {
+			return yb, nil
+		}
+		return nil, fmt.Errorf("%w: %s of %s", errs.ErrInvalidInput, b.op, typeName(y))
+	}
+	y, err := b.y.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "in":
+		l, ok := y.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: in %s, want a list", errs.ErrInvalidInput, typeName(y))
+		}
+		return slices.ContainsFunc(l, func(v any) bool { return equal(x, v) }), nil
+	}
+	xi, xok := x.(*big.Int)
+	yi, yok := y.(*big.Int)
+	if !xok || !yok {
+		return nil, fmt.Errorf("%w: %s %s %s", errs.ErrInvalidInput, typeName(x), b.op, typeName(y))
+	}
+	switch b.op {
+	case "<":
+		return xi.Cmp(yi) < 0, nil
+	case "<=":
+		return xi.Cmp(yi) <= 0, nil
+	case ">":
+		return xi.Cmp(yi) > 0, nil
+	case ">=":
+		return xi.Cmp(yi) >= 0, nil
+	case "+":
+		return new(big.Int).Add(xi, yi), nil
+	case "-":
+		return new(big.Int).Sub(xi, yi), nil
+	case "*":
+		return new(big.Int).Mul(xi, yi), nil
+	}
+	if yi.Sign() == 0 {
+		return nil, fmt.Errorf("%w: %s by zero", errs.ErrInvalidInput, b.op)
+	}
+	if b.op == "/" {
+		return new(big.Int).Quo(xi, yi), nil
+	}
+	return new(big.Int).Rem(xi, yi), nil
+}
+
+func equal(x, y any) bool {
+	switch x := x.(type) {
+	case *big.Int:
+		y, ok := y.(*big.Int)
+		return ok && x.Cmp(y) == 0
+	case string:
+		y, ok := y.(string)
+		return ok && x == y
+	case bool:
+		y, ok := y.(bool)
+		return ok && x == y
+	case []any:
+		y, ok := y.([]any)
+		return ok && slices.EqualFunc(x, y, equal)
+	}
+	return false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case *big.Int:
+		return "integer"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []any:
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
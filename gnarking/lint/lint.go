@@ -0,0 +1,369 @@
+// Package lint checks batches against operator rules before they are
+// proven: "sizes are multiples of 1000", "the recipient is on the
+// allowlist", and whatever else a deployment wants to refuse early, with a
+// report of every rule a batch breaks and the rows that break it. Rules are
+// expressions in a JSON file (see Config) or Go code a plugin registers
+// (see Register), and apply to every batch, to a profile's or to a
+// tenant's.
+package lint
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"gnarking/errs"
+)
+
+// TenantHeader names the tenant of a request to the server, for the
+// tenant's rules.
+const TenantHeader = "X-Ddm-Tenant"
+
+// Batch is what rules see of a batch: the rows as received, before any
+// witness is built.
+type Batch struct {
+	Profile   string
+	Tenant    string // empty when the request names none
+	Recipient *big.Int
+	ChainID   uint64
+	KOld      uint64
+	Rows      []Row
+}
+
+type Row struct {
+	Size  uint64
+	Nonce uint64
+}
+
+// Violation is one rule a batch breaks. Rows are the indices of the rows
+// breaking a row rule, none for a batch rule.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Rows    []int  `json:"rows,omitempty"`
+}
+
+func (v Violation) String() string {
+	if len(v.Rows) == 0 {
+		return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+	}
+	rows := make([]string, 0, maxListed)
+	for _, i := range v.Rows[:min(len(v.Rows), maxListed)] {
+		rows = append(rows, fmt.Sprint(i))
+	}
+	if len(v.Rows) > maxListed {
+		rows = append(rows, fmt.Sprintf("and %d more", len(v.Rows)-maxListed))
+	}
+	return fmt.Sprintf("%s (rows %s): %s", v.Rule, strings.Join(rows, ", "), v.Message)
+}
+
+// maxListed is how many rows of a violation its String names.
+const maxListed = 8
+
+// Report is the error of a batch breaking rules; it wraps
+// errs.ErrPolicyRejected.
+type Report struct {
+	Profile    string      `json:"profile"`
+	Tenant     string      `json:"tenant,omitempty"`
+	Violations []Violation `json:"violations"`
+}
+
+func (r *Report) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: batch of profile %s", errs.ErrPolicyRejected, r.Profile)
+	if r.Tenant != "" {
+		fmt.Fprintf(&b, " for tenant %s", r.Tenant)
+	}
+	fmt.Fprintf(&b, " breaks %d lint rules", len(r.Violations))
+	for _, v := range r.Violations {
+		b.WriteString("; ")
+		b.WriteString(v.String())
+	}
+	return b.String()
+}
+
+func (r *Report) Unwrap() error { return errs.ErrPolicyRejected }
+
+// Rule is a check written in Go, for what an expression cannot say, e.g. a
+// lookup in a sanctions list.
+type Rule interface {
+	Check(b *Batch) []Violation
+}
+
+// RuleFunc is a Rule of a function.
+type RuleFunc func(b *Batch) []Violation
+
+func (f RuleFunc) Check(b *Batch) []Violation { return f(b) }
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Rule{}
+)
+
+// Register adds a Go rule under name, for configurations to use as
+// {"plugin": name}; names are unique. A plugin (see package plugins) calls
+// it from its init.
+func Register(name string, r Rule) error {
+	if name == "" || r == nil {
+		return fmt.Errorf("%w: lint rule %q", errs.ErrInvalidInput, name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: lint rule %q already registered", errs.ErrDuplicate, name)
+	}
+	registry[name] = r
+	return nil
+}
+
+func registered(name string) (Rule, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// RuleConfig is one rule of a Config: exactly one of Row, an expression
+// every row must satisfy, Batch, one the batch must, or Plugin, a
+// registered Go rule.
+type RuleConfig struct {
+	Name    string `json:"name"` // the plugin, or the scope and index, when empty
+	Row     string `json:"row,omitempty"`
+	Batch   string `json:"batch,omitempty"`
+	Plugin  string `json:"plugin,omitempty"`
+	Message string `json:"message,omitempty"` // what a violation says, the expression when empty
+}
+
+// Config is a rules file. Rules apply to every batch, Profiles' to the
+// batches of a profile and Tenants' to a tenant's, all of them checked.
+// Lists are named lists for expressions, e.g. {"allowed": ["0x2a"]} for
+// "recipient in allowed"; a value that parses as a decimal or 0x hex
+// integer is one.
+type Config struct {
+	Lists    map[string][]string     `json:"lists,omitempty"`
+	Rules    []RuleConfig            `json:"rules,omitempty"`
+	Profiles map[string][]RuleConfig `json:"profiles,omitempty"`
+	Tenants  map[string][]RuleConfig `json:"tenants,omitempty"`
+}
+
+// The names expressions may use besides Lists: a batch rule has
+// batchVars, a row rule those and rowVars.
+var (
+	batchVars = []string{"profile", "tenant", "recipient", "chain_id", "k_old", "n", "total", "min_size", "max_size"}
+	rowVars   = []string{"size", "nonce", "index"}
+)
+
+// Linter is a compiled Config.
+type Linter struct {
+	lists    map[string][]any
+	all      []rule
+	profiles map[string][]rule
+	tenants  map[string][]rule
+}
+
+type rule struct {
+	name, message string
+	row           bool
+	expr          expr
+	plugin        Rule
+}
+
+// Load reads a JSON Config file; unknown fields are an error so a typo
+// does not silently disable a rule.
+func Load(path string) (*Linter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: lint rules %s: %w", errs.ErrInvalidInput, path, err)
+	}
+	l, err := New(c)
+	if err != nil {
+		return nil, fmt.Errorf("lint rules %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// New compiles c, the plugin rules it names registered by now.
+func New(c Config) (*Linter, error) {
+	l := &Linter{lists: make(map[string][]any, len(c.Lists)), profiles: map[string][]rule{}, tenants: map[string][]rule{}}
+	names := slices.Concat(batchVars, rowVars)
+	for name, values := range c.Lists {
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("%w: list %q shadows a variable", errs.ErrInvalidInput, name)
+		}
+		list := make([]any, len(values))
+		for i, v := range values {
+			list[i] = listValue(v)
+		}
+		l.lists[name] = list
+	}
+	var err error
+	if l.all, err = l.compile("rules", c.Rules); err != nil {
+		return nil, err
+	}
+	for name, rules := range c.Profiles {
+		if l.profiles[name], err = l.compile("profile "+name, rules); err != nil {
+			return nil, err
+		}
+	}
+	for name, rules := range c.Tenants {
+		if l.tenants[name], err = l.compile("tenant "+name, rules); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// listValue is v as an expression sees it.
+func listValue(v string) any {
+	s := strings.TrimSpace(v)
+	if i, ok := new(big.Int).SetString(s, 0); ok && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		return i
+	}
+	return v
+}
+
+func (l *Linter) compile(scope string, configs []RuleConfig) ([]rule, error) {
+	var out []rule
+	names := slices.Concat(batchVars, slices.Collect(maps.Keys(l.lists)))
+	for i, c := range configs {
+		r := rule{name: cmp.Or(c.Name, c.Plugin, fmt.Sprintf("%s[%d]", scope, i)), message: c.Message}
+		set := 0
+		for _, s := range []string{c.Row, c.Batch, c.Plugin} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("%w: %s rule %s: want one of row, batch and plugin", errs.ErrInvalidInput, scope, r.name)
+		}
+		var err error
+		switch {
+		case c.Plugin != "":
+			var ok bool
+			if r.plugin, ok = registered(c.Plugin); !ok {
+				return nil, fmt.Errorf("%w: %s rule %s: no plugin rule %q registered", errs.ErrNotFound, scope, r.name, c.Plugin)
+			}
+		case c.Row != "":
+			r.row = true
+			r.message = cmp.Or(r.message, c.Row+" does not hold")
+			r.expr, err = compile(c.Row, slices.Concat(names, rowVars))
+		default:
+			r.message = cmp.Or(r.message, c.Batch+" does not hold")
+			r.expr, err = compile(c.Batch, names)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s rule %s: %w", scope, r.name, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Rules is how many rules apply to a batch of profile for tenant.
+func (l *Linter) Rules(profile, tenant string) int {
+	return len(l.all) + len(l.profiles[profile]) + len(l.tenants[tenant])
+}
+
+// Check runs the rules of b's profile and tenant over b: nil when it
+// breaks none, a *Report of every violation otherwise. A rule that cannot
+// be evaluated on b, e.g. dividing by a zero k_old, counts as broken.
+func (l *Linter) Check(b *Batch) error {
+	rep := &Report{Profile: b.Profile, Tenant: b.Tenant}
+	e := &env{vars: batchEnv(b), lists: l.lists}
+	for _, r := range slices.Concat(l.all, l.profiles[b.Profile], l.tenants[b.Tenant]) {
+		switch {
+		case r.plugin != nil:
+			for _, v := range r.plugin.Check(b) {
+				v.Rule = cmp.Or(v.Rule, r.name)
+				rep.Violations = append(rep.Violations, v)
+			}
+		case r.row:
+			var rows []int
+			var failed error
+			for i, row := range b.Rows {
+				e.vars["size"], e.vars["nonce"], e.vars["index"] = new(big.Int).SetUint64(row.Size), new(big.Int).SetUint64(row.Nonce), big.NewInt(int64(i))
+				ok, err := holds(r.expr, e)
+				if err != nil && failed == nil {
+					failed = err
+				}
+				if !ok {
+					rows = append(rows, i)
+				}
+			}
+			if len(rows) > 0 {
+				rep.Violations = append(rep.Violations, violation(r, rows, failed))
+			}
+		default:
+			if ok, err := holds(r.expr, e); !ok {
+				rep.Violations = append(rep.Violations, violation(r, nil, err))
+			}
+		}
+	}
+	if len(rep.Violations) == 0 {
+		return nil
+	}
+	return rep
+}
+
+func violation(r rule, rows []int, err error) Violation {
+	v := Violation{Rule: r.name, Message: r.message, Rows: rows}
+	if err != nil {
+		v.Message = fmt.Sprintf("cannot be evaluated: %v", err)
+	}
+	return v
+}
+
+// holds evaluates x to a boolean, false on an error.
+func holds(x expr, e *env) (bool, error) {
+	v, err := x.eval(e)
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := v.(bool)
+	if !isBool {
+		return false, fmt.Errorf("%w: a rule is %s, not a boolean", errs.ErrInvalidInput, typeName(v))
+	}
+	return ok, nil
+}
+
+func batchEnv(b *Batch) map[string]any {
+	total, lo, hi := new(big.Int), new(big.Int), new(big.Int)
+	for i, r := range b.Rows {
+		s := new(big.Int).SetUint64(r.Size)
+		total.Add(total, s)
+		if i == 0 || s.Cmp(lo) < 0 {
+			lo = s
+		}
+		if s.Cmp(hi) > 0 {
+			hi = s
+		}
+	}
+	recipient := b.Recipient
+	if recipient == nil {
+		recipient = new(big.Int)
+	}
+	return map[string]any{
+		"profile":   b.Profile,
+		"tenant":    b.Tenant,
+		"recipient": recipient,
+		"chain_id":  new(big.Int).SetUint64(b.ChainID),
+		"k_old":     new(big.Int).SetUint64(b.KOld),
+		"n":         big.NewInt(int64(len(b.Rows))),
+		"total":     total,
+		"min_size":  lo,
+		"max_size":  hi,
+	}
+}
@@ -0,0 +1,133 @@
+package lint
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestCheck(t *testing.T) {
+	if err := Register("test_no_zero_nonce", RuleFunc(func(b *Batch) []Violation {
+		for i, r := range b.Rows {
+			if r.Nonce == 0 {
+				return []Violation{{Message: "nonce 0", Rows: []int{i}}}
+			}
+		}
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register("test_no_zero_nonce", RuleFunc(func(*Batch) []Violation { return nil })); !errors.Is(err, errs.ErrDuplicate) {
+		t.Fatalf("second registration: %v", err)
+	}
+	l, err := New(Config{
+		Lists: map[string][]string{"allowed": {"0x2a", "43"}},
+		Rules: []RuleConfig{
+			{Name: "round", Row: "size % 1000 == 0", Message: "size must be a multiple of 1000"},
+			{Name: "allowlist", Batch: "recipient in allowed"},
+			{Plugin: "test_no_zero_nonce"},
+		},
+		Profiles: map[string][]RuleConfig{"8": {{Name: "small", Batch: "total <= 10000"}}},
+		Tenants:  map[string][]RuleConfig{"acme": {{Name: "chains", Batch: `chain_id in [1, 10] && tenant == "acme"`}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Batch{Profile: "8", Recipient: big.NewInt(42), ChainID: 1, Rows: []Row{{1000, 1}, {2000, 2}, {3000, 3}}}
+	if err := l.Check(b); err != nil {
+		t.Fatalf("clean batch: %v", err)
+	}
+	b.Tenant, b.ChainID = "acme", 5
+	b.Recipient = big.NewInt(7)
+	b.Rows = []Row{{1000, 0}, {2500, 2}, {9999, 3}}
+	err = l.Check(b)
+	var rep *Report
+	if !errors.As(err, &rep) || !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("got %v", err)
+	}
+	got := map[string]Violation{}
+	for _, v := range rep.Violations {
+		got[v.Rule] = v
+	}
+	if len(got) != 5 {
+		t.Fatalf("violations %+v", rep.Violations)
+	}
+	if v := got["round"]; len(v.Rows) != 2 || v.Rows[0] != 1 || v.Rows[1] != 2 || v.Message != "size must be a multiple of 1000" {
+		t.Errorf("round: %+v", v)
+	}
+	if v := got["test_no_zero_nonce"]; len(v.Rows) != 1 || v.Rows[0] != 0 {
+		t.Errorf("plugin: %+v", v)
+	}
+	if !strings.Contains(err.Error(), "round (rows 1, 2): size must be a multiple of 1000") {
+		t.Errorf("report %q", err)
+	}
+	// profile and tenant rules only apply to theirs
+	b.Profile, b.Tenant = "64", "other"
+	if err := l.Check(b); !errors.As(err, &rep) || len(rep.Violations) != 3 {
+		t.Errorf("other profile and tenant: %v", err)
+	}
+}
+
+func TestExpr(t *testing.T) {
+	e := &env{vars: map[string]any{"size": big.NewInt(1500), "tenant": "acme"}, lists: map[string][]any{}}
+	names := []string{"size", "tenant"}
+	for src, want := range map[string]bool{
+		"size % 1000 == 500":                 true,
+		"size / 1000 * 1000 + 500 == size":   true,
+		"-size < 0 && !(size >= 2000)":       true,
+		`tenant in ["a", "acme"]`:            true,
+		"size in [0x5dc]":                    true,
+		"size > 1 || size / 0 == 1":          true, // short-circuits
+		`tenant == "acme" && size != 1500`:   false,
+		"(size - 1500) * 2 == 0 && 1 <= 0x1": true,
+	} {
+		x, err := compile(src, names)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got, err := holds(x, e); err != nil || got != want {
+			t.Errorf("%s = %v, %v; want %v", src, got, err, want)
+		}
+	}
+	for _, src := range []string{"size ==", "nonce > 0", "(size", `"open`, "size # 2", "size 1"} {
+		if _, err := compile(src, names); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%s compiled: %v", src, err)
+		}
+	}
+	for _, src := range []string{"size / 0 == 1", "size + tenant > 0", "size"} {
+		x, err := compile(src, names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := holds(x, e); err == nil {
+			t.Errorf("%s evaluated", src)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for body, ok := range map[string]bool{
+		`{"rules": [{"name": "r", "row": "size > 0"}]}`:                                true,
+		`{"rules": [{"name": "r", "rows": "size > 0"}]}`:                               false, // typo
+		`{"rules": [{"name": "r", "batch": "size > 0"}]}`:                              false, // a row variable
+		`{"rules": [{"name": "r", "row": "size > 0", "batch": "n > 0"}]}`:              false,
+		`{"rules": [{"name": "r", "plugin": "nope"}]}`:                                 false,
+		`{"lists": {"size": ["1"]}}`:                                                   false,
+		`{"tenants": {"t": [{"batch": "recipient in ok"}]}, "lists": {"ok": ["0x1"]}}`: true,
+	} {
+		name := filepath.Join(dir, "rules.json")
+		if err := os.WriteFile(name, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(name); (err == nil) != ok {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+}
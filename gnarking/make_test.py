@@ -18,7 +18,7 @@ contract VerifierTest is Test {
     function test_Verify() public {
         // generated with `make_test.py`
         uint256[8] memory proof = <PROOF>;
-        uint256[7] memory input = <INPUT>;
+        uint256[<NINPUT>] memory input = <INPUT>;
         uint256[4] memory compressed = ver.compressProof(proof);
         ver.verifyCompressedProof(compressed, input);
     }
@@ -52,6 +52,7 @@ def arr_u256(v):
 res = (TEMPLATE
        .replace("<PROOF>", arr_u256(proof))
        .replace("<INPUT>", arr_u256(input))
+       .replace("<NINPUT>", str(len(input)))
 )
 
 with open(TEST_TGT_PATH, "w") as f:
@@ -0,0 +1,108 @@
+package market
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+	"gnarking/retry"
+	"gnarking/tracing"
+)
+
+// MaxProofBytes bounds a provider's reply; a framed BN254 proof is a few
+// hundred bytes.
+const MaxProofBytes = 1 << 16
+
+// Client is the reference Service, speaking
+//
+//	POST {URL}/v1/prove?ccs=<hex ccs hash>
+//	Content-Type: application/octet-stream
+//	<sealed witness>
+//
+// to which a provider answers 200 with the framed proof file, or an error
+// status with {"code": errs.Code, "error": message}.
+type Client struct {
+	URL  string          // provider base URL
+	Key  *ecdh.PublicKey // provider's witness key, pinned out of band
+	HTTP *http.Client    // http.DefaultClient when nil
+	// Retry resends the sealed witness while the provider is unreachable
+	// or answers with code unavailable; other codes are final.
+	Retry retry.Policy
+}
+
+var _ Service = (*Client)(nil)
+
+// ErrorReply is a provider's error body.
+type ErrorReply struct {
+	Code  errs.Code `json:"code"`
+	Error string    `json:"error"`
+}
+
+func (c *Client) Prove(ctx context.Context, job Job) (*artifacts.ProofHeader, *groth16_bn254.Proof, error) {
+	if c.Key == nil {
+		return nil, nil, fmt.Errorf("%w: no provider key", errs.ErrInvalidInput)
+	}
+	sealed, err := Seal(c.Key, job.CCSHash, job.Witness)
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoint := strings.TrimSuffix(c.URL, "/") + "/v1/prove?ccs=" + hex.EncodeToString(job.CCSHash[:])
+	var (
+		header *artifacts.ProofHeader
+		proof  *groth16_bn254.Proof
+	)
+	err = c.Retry.Do(ctx, func(ctx context.Context) (err error) {
+		header, proof, err = c.post(ctx, endpoint, sealed)
+		return err
+	})
+	return header, proof, err
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, sealed []byte) (*artifacts.ProofHeader, *groth16_bn254.Proof, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	tracing.Inject(ctx, tracing.Carrier(req.Header))
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxProofBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %w", errs.ErrUnavailable, c.URL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var reply ErrorReply
+		if json.Unmarshal(body, &reply) != nil || reply.Code == "" {
+			return nil, nil, fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+		}
+		if e := errs.ForCode(reply.Code); e != nil {
+			return nil, nil, fmt.Errorf("%s: %w: %s", c.URL, e, reply.Error)
+		}
+		return nil, nil, fmt.Errorf("%w: %s: %s: %s", errs.ErrUnavailable, c.URL, reply.Code, reply.Error)
+	}
+	proof := new(groth16_bn254.Proof)
+	framed := artifacts.Proof{Proof: proof}
+	if _, err := artifacts.Decode(&framed, bytes.NewReader(body)); err != nil {
+		return nil, nil, fmt.Errorf("provider proof: %w", err)
+	}
+	return framed.Header, proof, nil
+}
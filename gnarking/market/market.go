@@ -0,0 +1,64 @@
+// Package market outsources proving to external provers, e.g. rented GPUs an
+// operator bursts to under load. A job is a prepared (ccs hash, witness)
+// pair; the witness travels sealed to the provider's key, and the proof that
+// comes back is untrusted until it verifies here against our own vk and the
+// public inputs of our own witness.
+package market
+
+import (
+	"context"
+	"fmt"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/submitter"
+	"gnarking/tracing"
+	"gnarking/verifier"
+)
+
+// Job is a prepared proving job: the circuit, by artifacts.CircuitHash of its
+// constraint system, and a full settlement witness for it.
+type Job struct {
+	CCSHash [32]byte
+	Witness witness.Witness
+}
+
+// Service proves jobs somewhere else. What it returns is not trusted: Prove
+// checks it.
+type Service interface {
+	Prove(ctx context.Context, job Job) (*artifacts.ProofHeader, *groth16_bn254.Proof, error)
+}
+
+// Prove has svc prove job and accepts the proof only if its header names the
+// job's circuit and batch and it verifies under vk for the public inputs of
+// job.Witness; a provider can't substitute a proof of another batch.
+func Prove(ctx context.Context, svc Service, vk *groth16_bn254.VerifyingKey, job Job) (sub submitter.Submission, err error) {
+	ctx, span := tracing.Start(ctx, "outsource")
+	defer func() { tracing.End(span, err) }()
+
+	pub, err := circuit.PublicFromWitness(job.Witness)
+	if err != nil {
+		return sub, err
+	}
+	hdr, proof, err := svc.Prove(ctx, job)
+	if err != nil {
+		return sub, err
+	}
+	if hdr == nil {
+		return sub, fmt.Errorf("%w: provider returned an unframed proof", errs.ErrArtifactMismatch)
+	}
+	if hdr.CircuitHash != job.CCSHash {
+		return sub, fmt.Errorf("%w: provider proved circuit %x, job is for %x", errs.ErrArtifactMismatch, hdr.CircuitHash[:8], job.CCSHash[:8])
+	}
+	if err := verifier.CheckBatchID(hdr, pub); err != nil {
+		return sub, err
+	}
+	if err := verifier.VerifyContext(ctx, vk, proof, pub); err != nil {
+		return sub, fmt.Errorf("provider proof: %w", err)
+	}
+	return submitter.Submission{Header: hdr, Proof: proof, Public: pub}, nil
+}
@@ -0,0 +1,172 @@
+package market
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/internal/testcircuit"
+)
+
+// provider is a reference provider: it opens the witness, proves it, and then
+// misbehaves as told.
+type provider struct {
+	ccs       *cs_bn254.R1CS
+	pk        *groth16_bn254.ProvingKey
+	open      func(ccs [32]byte, sealed []byte) (witness.Witness, error)
+	misbehave string // "", "other batch", "other proof", "other circuit", "timeout"
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, err error) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorReply{Code: errs.CodeOf(err), Error: err.Error()})
+	}
+	if p.misbehave == "timeout" {
+		fail(http.StatusGatewayTimeout, errs.ErrProverTimeout)
+		return
+	}
+	var ccs [32]byte
+	b, err := hex.DecodeString(r.URL.Query().Get("ccs"))
+	if err != nil || len(b) != len(ccs) {
+		fail(http.StatusBadRequest, errs.ErrInvalidInput)
+		return
+	}
+	copy(ccs[:], b)
+	sealed, _ := io.ReadAll(r.Body)
+	wit, err := p.open(ccs, sealed)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	pub, err := circuit.PublicFromWitness(wit)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	hdr := &artifacts.ProofHeader{Version: artifacts.ProofHeaderVersion, Curve: ecc.BN254, Backend: backend.GROTH16, CircuitHash: ccs, Timestamp: time.Now()}
+	hdr.BatchID, _ = circuit.BatchID(pub)
+	switch p.misbehave {
+	case "other batch":
+		hdr.BatchID[0] ^= 1
+	case "other circuit":
+		hdr.CircuitHash[0] ^= 1
+	case "other proof":
+		if wit, err = testcircuit.Witness(9); err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	proof, err := groth16_bn254.Prove(p.ccs, p.pk, wit)
+	if err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	(&artifacts.Proof{Header: hdr, Proof: proof}).WriteTo(w)
+}
+
+func TestProve(t *testing.T) {
+	ccsAny, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &testcircuit.SettlementShaped{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkAny, vkAny, err := groth16.Setup(ccsAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := vkAny.(*groth16_bn254.VerifyingKey)
+	ccsHash, err := artifacts.CircuitHash(ccsAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{
+		ccs: ccsAny.(*cs_bn254.R1CS), pk: pkAny.(*groth16_bn254.ProvingKey),
+		open: func(ccs [32]byte, sealed []byte) (witness.Witness, error) { return Open(key, ccs, sealed) },
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	providerKey, err := ParsePublicKey(hex.EncodeToString(key.PublicKey().Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{URL: srv.URL, Key: providerKey}
+	wit, err := testcircuit.Witness(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{CCSHash: ccsHash, Witness: wit}
+	ctx := context.Background()
+
+	sub, err := Prove(ctx, client, vk, job)
+	if err != nil {
+		t.Fatalf("honest provider: %v", err)
+	}
+	if sub.Header.CircuitHash != ccsHash || sub.Public.TotalSettle.(*big.Int).Int64() != 49 {
+		t.Fatalf("submission %v, public %+v", sub.Header, sub.Public)
+	}
+
+	for _, tc := range []struct {
+		misbehave string
+		want      error
+	}{
+		{"other batch", errs.ErrArtifactMismatch},
+		{"other circuit", errs.ErrArtifactMismatch},
+		{"other proof", errs.ErrVerificationFailed},
+		{"timeout", errs.ErrProverTimeout},
+	} {
+		p.misbehave = tc.misbehave
+		if _, err := Prove(ctx, client, vk, job); !errors.Is(err, tc.want) {
+			t.Errorf("provider returning %s: %v, want %v", tc.misbehave, err, tc.want)
+		}
+	}
+	p.misbehave = ""
+
+	// sealed to another key, or for another circuit: the provider can't open it
+	other, _ := NewKey()
+	if _, err := Prove(ctx, &Client{URL: srv.URL, Key: other.PublicKey()}, vk, job); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Errorf("witness sealed to another key: %v", err)
+	}
+	sealed, err := Seal(providerKey, ccsHash, job.Witness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(key, [32]byte{1}, sealed); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Errorf("opened for another circuit: %v", err)
+	}
+	if bytes.Contains(sealed, mustMarshal(t, job.Witness)[12:44]) {
+		t.Error("sealed witness contains the plaintext")
+	}
+}
+
+func mustMarshal(t *testing.T, w witness.Witness) []byte {
+	b, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
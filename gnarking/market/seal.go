@@ -0,0 +1,54 @@
+package market
+
+import (
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/errs"
+	"gnarking/internal/sealbox"
+)
+
+// A sealed witness is a sealbox to the provider's key with the ccs hash as
+// additional data: the provider can only open it as a witness of the
+// circuit it was sealed for.
+const info = "ddm market witness v2"
+
+// NewKey generates a provider's witness key.
+func NewKey() (*ecdh.PrivateKey, error) { return sealbox.NewKey() }
+
+// ParsePublicKey reads a provider's hex X25519 public key, 0x prefix
+// optional.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) { return sealbox.ParsePublicKey(s) }
+
+// Seal encrypts w to the provider key to, for the circuit ccsHash.
+func Seal(to *ecdh.PublicKey, ccsHash [32]byte, w witness.Witness) ([]byte, error) {
+	plain, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return sealbox.Seal(to, info, ccsHash[:], plain)
+}
+
+// Open decrypts a sealed witness with the provider key, failing with
+// ErrArtifactMismatch when it was sealed to another key or circuit.
+func Open(key *ecdh.PrivateKey, ccsHash [32]byte, sealed []byte) (witness.Witness, error) {
+	plain, err := sealbox.Open(key, info, ccsHash[:], sealed)
+	if errors.Is(err, errs.ErrArtifactMismatch) {
+		return nil, fmt.Errorf("%w: witness not sealed to this key for circuit %x", errs.ErrArtifactMismatch, ccsHash[:8])
+	}
+	if err != nil {
+		return nil, err
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(plain); err != nil {
+		return nil, fmt.Errorf("%w: witness: %w", errs.ErrInvalidInput, err)
+	}
+	return w, nil
+}
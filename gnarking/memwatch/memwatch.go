@@ -0,0 +1,154 @@
+// Package memwatch samples process memory while a prove phase runs and
+// aborts it with a clear error when a high-water mark is crossed, instead of
+// letting the kernel OOM-kill the host process mid-proof.
+package memwatch
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+)
+
+const DefaultInterval = 100 * time.Millisecond
+
+// cgroup v2 and v1 memory limit files
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// Guard watches one phase. A zero Limit only samples.
+type Guard struct {
+	Limit    uint64        // bytes of Go-managed memory (Sys - HeapReleased)
+	Interval time.Duration // DefaultInterval when zero
+}
+
+// Stats are the memory figures of a watched phase.
+type Stats struct {
+	Phase       string `json:"phase"`
+	Limit       uint64 `json:"limit_bytes,omitempty"`
+	PeakInUse   uint64 `json:"peak_in_use_bytes"` // Sys - HeapReleased, ~RSS of the Go heap
+	PeakHeap    uint64 `json:"peak_heap_bytes"`   // HeapAlloc
+	NumGC       uint32 `json:"num_gc"`
+	Samples     int    `json:"samples"`
+	Aborted     bool   `json:"aborted"`
+	DurationNS  int64  `json:"duration_ns"`
+	CgroupLimit uint64 `json:"cgroup_limit_bytes,omitempty"`
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Memory report (%s) ===\n", s.Phase)
+	fmt.Fprintf(&b, "Peak in use: %.1f MiB, peak heap: %.1f MiB, GCs: %d, samples: %d\n",
+		mib(s.PeakInUse), mib(s.PeakHeap), s.NumGC, s.Samples)
+	if s.Limit > 0 {
+		fmt.Fprintf(&b, "High-water mark: %.1f MiB (%.0f%% used)\n", mib(s.Limit), 100*float64(s.PeakInUse)/float64(s.Limit))
+	}
+	if s.CgroupLimit > 0 {
+		fmt.Fprintf(&b, "cgroup limit: %.1f MiB\n", mib(s.CgroupLimit))
+	}
+	if s.Aborted {
+		fmt.Fprintf(&b, "Aborted: high-water mark crossed\n")
+	}
+	return b.String()
+}
+
+func mib(n uint64) float64 { return float64(n) / (1 << 20) }
+
+// CgroupLimit returns the memory limit of the process' cgroup, if any.
+func CgroupLimit() (uint64, bool) {
+	for _, f := range cgroupLimitFiles {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		v := strings.TrimSpace(string(data))
+		if v == "max" {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		// v1 reports "no limit" as a huge page-rounded number
+		if err != nil || n >= 1<<62 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// DefaultLimit is 90% of the cgroup limit, or 0 (no guard) without one.
+func DefaultLimit() uint64 {
+	if l, ok := CgroupLimit(); ok {
+		return l / 10 * 9
+	}
+	return 0
+}
+
+// InUse returns the Go-managed memory in use (Sys - HeapReleased), the
+// figure Guard limits.
+func InUse() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys - ms.HeapReleased
+}
+
+// Run runs fn as the named phase while sampling memory.
+//
+// When in-use memory crosses g.Limit, Run returns an error wrapping
+// errs.ErrMemoryLimit right away. fn cannot be interrupted (groth16.Prove
+// takes no context) and keeps running in the background, so callers are
+// expected to give up on the phase, typically by exiting. While fn runs the
+// GC soft limit is set to g.Limit so the heap is collected harder first.
+func (g Guard) Run(phase string, fn func() error) (Stats, error) {
+	interval := g.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	st := Stats{Phase: phase, Limit: g.Limit}
+	st.CgroupLimit, _ = CgroupLimit()
+
+	if g.Limit > 0 {
+		prev := debug.SetMemoryLimit(int64(g.Limit))
+		defer debug.SetMemoryLimit(prev)
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gc0 := ms.NumGC
+	sample := func() bool {
+		runtime.ReadMemStats(&ms)
+		st.Samples++
+		st.PeakInUse = max(st.PeakInUse, ms.Sys-ms.HeapReleased)
+		st.PeakHeap = max(st.PeakHeap, ms.HeapAlloc)
+		st.NumGC = ms.NumGC - gc0
+		return g.Limit > 0 && ms.Sys-ms.HeapReleased > g.Limit
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			sample()
+			st.DurationNS = time.Since(start).Nanoseconds()
+			return st, err
+		case <-ticker.C:
+			if sample() {
+				st.Aborted = true
+				st.DurationNS = time.Since(start).Nanoseconds()
+				return st, fmt.Errorf("%w: %s: %.1f MiB in use, high-water mark %.1f MiB",
+					errs.ErrMemoryLimit, phase, mib(ms.Sys-ms.HeapReleased), mib(g.Limit))
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package memwatch
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+var sink []byte
+
+func TestGuard(t *testing.T) {
+	// no limit: only samples
+	st, err := Guard{Interval: time.Millisecond}.Run("alloc", func() error {
+		sink = make([]byte, 16<<20)
+		for i := range sink {
+			sink[i] = 1
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Aborted || st.Samples == 0 || st.PeakHeap < 16<<20 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// a mark below what the phase needs aborts it
+	sink = nil
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	release := make(chan struct{})
+	defer close(release)
+	st, err = Guard{Limit: ms.Sys - ms.HeapReleased + 8<<20, Interval: time.Millisecond}.Run("alloc", func() error {
+		buf := make([]byte, 64<<20)
+		for i := range buf {
+			buf[i] = 1
+		}
+		<-release
+		runtime.KeepAlive(buf)
+		return nil
+	})
+	if !errors.Is(err, errs.ErrMemoryLimit) || !st.Aborted {
+		t.Fatalf("want memory limit abort, got %v %+v", err, st)
+	}
+}
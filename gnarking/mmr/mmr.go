@@ -0,0 +1,536 @@
+// Package mmr keeps a Merkle mountain range over the BatchDataRoot of every
+// proven batch, in the order they were proven: one root (Root, in
+// State) commits to the whole settlement history and grows by appending,
+// without rewriting, and any past batch has an inclusion proof against it,
+// or against any earlier root. Nodes are MiMC over BN254 like the
+// circuits', so a circuit can check a proof as cheaply as a contract.
+//
+// A range is a directory: nodes.bin, every node as 32 bytes in post-order
+// position; leaves.jsonl, one Leaf a line; and peaks.json, the State,
+// rewritten on each append for readers that want the commitment alone.
+package mmr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+const (
+	nodesName  = "nodes.bin"
+	leavesName = "leaves.jsonl"
+	peaksName  = "peaks.json"
+	nodeSize   = fr.Bytes
+)
+
+// StateVersion is the version of peaks.json.
+const StateVersion = 1
+
+// hash is MiMC(a, b), a node over its children.
+func hash(a, b *big.Int) *big.Int {
+	h := bnMimc.NewMiMC()
+	for _, x := range []*big.Int{a, b} {
+		var e fr.Element
+		e.SetBigInt(x)
+		b := e.Bytes()
+		h.Write(b[:])
+	}
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// LeafHash is the leaf of the index-th batch, of BatchDataRoot root:
+// MiMC(index, root), so two batches of one root are two leaves.
+func LeafHash(index uint64, root *big.Int) *big.Int {
+	return hash(new(big.Int).SetUint64(index), root)
+}
+
+// Bag is the root of a range of leaves leaves with peaks peaks, left to
+// right: MiMC(leaves, MiMC(peak₀, MiMC(peak₁, …))), 0 when empty.
+func Bag(leaves uint64, peaks []*big.Int) *big.Int {
+	if len(peaks) == 0 {
+		return new(big.Int)
+	}
+	acc := peaks[len(peaks)-1]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		acc = hash(peaks[i], acc)
+	}
+	return hash(new(big.Int).SetUint64(leaves), acc)
+}
+
+// size is the number of nodes of a range of n leaves.
+func size(n uint64) uint64 { return 2*n - uint64(bits.OnesCount64(n)) }
+
+// leafPos is the position of the i-th leaf.
+func leafPos(i uint64) uint64 { return size(i) }
+
+// mountain is one perfect tree of a range.
+type mountain struct {
+	height int
+	leaf   uint64 // index of its first leaf
+	peak   uint64 // position of its peak
+}
+
+// mountains are those of a range of n leaves, left (highest) to right.
+func mountains(n uint64) []mountain {
+	var out []mountain
+	var leaf, pos uint64
+	for h := 63; h >= 0; h-- {
+		if n>>h&1 == 0 {
+			continue
+		}
+		pos += 1<<(h+1) - 1
+		out = append(out, mountain{height: h, leaf: leaf, peak: pos - 1})
+		leaf += 1 << h
+	}
+	return out
+}
+
+// Leaf is one appended batch.
+type Leaf struct {
+	Index   uint64            `json:"index"`
+	BatchID string            `json:"batch_id"` // hex, circuit.BatchID
+	Root    circuit.FieldJSON `json:"batch_data_root"`
+	Profile string            `json:"profile,omitempty"`
+	Time    time.Time         `json:"time"` // when it was appended
+}
+
+// State is the commitment to a range: its peaks and their Bag.
+type State struct {
+	Version int                 `json:"version"`
+	Leaves  uint64              `json:"leaves"`
+	Peaks   []circuit.FieldJSON `json:"peaks"` // left to right
+	Root    circuit.FieldJSON   `json:"root"`
+}
+
+// MMR is a range open for appends and proofs. It is safe for concurrent
+// use.
+type MMR struct {
+	dir string
+
+	mu     sync.Mutex
+	nodes  *os.File
+	leaves *os.File
+	list   []Leaf
+	index  map[string]uint64 // batch ID hex -> leaf index
+}
+
+// Open opens the range in dir, creating it when missing. An append cut
+// short by a crash is rolled back: nodes and leaves past the last whole
+// leaf are dropped, and nodes a leaf lacks are recomputed.
+func Open(dir string) (*MMR, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &MMR{dir: dir, index: make(map[string]uint64)}
+	leaves, err := m.readLeaves()
+	if err != nil {
+		return nil, err
+	}
+	if m.leaves, err = os.OpenFile(filepath.Join(dir, leavesName), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if err := m.leaves.Truncate(leaves); err != nil {
+		m.Close()
+		return nil, err
+	}
+	if _, err := m.leaves.Seek(leaves, io.SeekStart); err != nil {
+		m.Close()
+		return nil, err
+	}
+	if m.nodes, err = os.OpenFile(filepath.Join(dir, nodesName), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		m.Close()
+		return nil, err
+	}
+	if err := m.recover(); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// readLeaves loads leaves.jsonl and returns the length of its whole lines.
+func (m *MMR) readLeaves() (int64, error) {
+	f, err := os.Open(filepath.Join(m.dir, leavesName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return good, nil // a torn last line is an append cut short
+		}
+		if err != nil {
+			return 0, err
+		}
+		var l Leaf
+		if err := json.Unmarshal(line, &l); err != nil || l.Index != uint64(len(m.list)) {
+			return 0, fmt.Errorf("%w: %s line %d: not leaf %d", errs.ErrArtifactMismatch, leavesName, len(m.list)+1, len(m.list))
+		}
+		m.index[l.BatchID] = l.Index
+		m.list = append(m.list, l)
+		good += int64(len(line))
+	}
+}
+
+// recover makes nodes.bin hold exactly the nodes of the leaves.
+func (m *MMR) recover() error {
+	st, err := m.nodes.Stat()
+	if err != nil {
+		return err
+	}
+	have, leaves := uint64(st.Size())/nodeSize, uint64(len(m.list))
+	// back to the last leaf whose nodes are all written, then forward
+	var n uint64
+	for n < leaves && size(n+1) <= have {
+		n++
+	}
+	if err := m.nodes.Truncate(int64(size(n) * nodeSize)); err != nil {
+		return err
+	}
+	if n < leaves {
+		for ; n < leaves; n++ {
+			if err := m.appendNodes(n, m.list[n].root()); err != nil {
+				return err
+			}
+		}
+		if err := m.nodes.Sync(); err != nil {
+			return err
+		}
+	}
+	return m.writeState()
+}
+
+// node is the node at pos.
+func (m *MMR) node(pos uint64) (*big.Int, error) {
+	var b [nodeSize]byte
+	if _, err := m.nodes.ReadAt(b[:], int64(pos*nodeSize)); err != nil {
+		return nil, fmt.Errorf("%s: node %d: %w", nodesName, pos, err)
+	}
+	return new(big.Int).SetBytes(b[:]), nil
+}
+
+// appendNodes writes the nodes the i-th leaf, of batch data root root,
+// adds: the leaf, and a parent for each mountain it completes.
+func (m *MMR) appendNodes(i uint64, root *big.Int) error {
+	pos := leafPos(i)
+	cur := LeafHash(i, root)
+	var buf bytes.Buffer
+	write := func(x *big.Int) {
+		var b [nodeSize]byte
+		x.FillBytes(b[:])
+		buf.Write(b[:])
+	}
+	write(cur)
+	// a leaf with k trailing ones completes k mountains, each merged with
+	// the peak left of it, which precedes the leaf
+	for h := 0; i>>h&1 == 1; h++ {
+		left, err := m.node(pos - (1<<(h+1) - 1))
+		if err != nil {
+			return err
+		}
+		cur = hash(left, cur)
+		pos++
+		write(cur)
+	}
+	_, err := m.nodes.WriteAt(buf.Bytes(), int64(leafPos(i)*nodeSize))
+	return err
+}
+
+// Append adds the batch batchID of profile, whose BatchDataRoot is root,
+// as the next leaf: ErrDuplicate when it already is one. The leaf is
+// durable when Append returns.
+func (m *MMR) Append(batchID [32]byte, profile string, root *big.Int) (Leaf, error) {
+	if root == nil || root.Sign() < 0 || root.Cmp(fr.Modulus()) >= 0 {
+		return Leaf{}, fmt.Errorf("%w: batch data root %v is not a field element", errs.ErrInvalidInput, root)
+	}
+	id := hex.EncodeToString(batchID[:])
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i, ok := m.index[id]; ok {
+		return Leaf{}, fmt.Errorf("%w: batch %s is leaf %d", errs.ErrDuplicate, id, i)
+	}
+	n := uint64(len(m.list))
+	l := Leaf{Index: n, BatchID: id, Root: circuit.FieldJSON(*root), Profile: profile, Time: time.Now().UTC()}
+	// nodes first: a crash before the leaf line leaves nodes Open drops
+	if err := m.appendNodes(n, root); err != nil {
+		return Leaf{}, err
+	}
+	if err := m.nodes.Sync(); err != nil {
+		return Leaf{}, err
+	}
+	line, err := json.Marshal(&l)
+	if err != nil {
+		return Leaf{}, err
+	}
+	if _, err := m.leaves.Write(append(line, '\n')); err != nil {
+		return Leaf{}, err
+	}
+	if err := m.leaves.Sync(); err != nil {
+		return Leaf{}, err
+	}
+	m.index[id] = n
+	m.list = append(m.list, l)
+	return l, m.writeState()
+}
+
+// AppendPublic appends the batch of profile whose public inputs are pub,
+// by its circuit.BatchID and BatchDataRoot.
+func (m *MMR) AppendPublic(pub circuit.SettlementCircuitPublic, profile string) (Leaf, error) {
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return Leaf{}, err
+	}
+	b, err := json.Marshal(pub)
+	if err != nil {
+		return Leaf{}, err
+	}
+	var fields circuit.SettlementCircuitPublicJSON
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return Leaf{}, err
+	}
+	root, ok := new(big.Int).SetString(strings.TrimPrefix(fields.BatchDataRoot, "0x"), 16)
+	if !ok {
+		return Leaf{}, fmt.Errorf("%w: batch data root %q", errs.ErrInvalidInput, fields.BatchDataRoot)
+	}
+	return m.Append(id, profile, root)
+}
+
+// Len is the number of leaves.
+func (m *MMR) Len() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return uint64(len(m.list))
+}
+
+// Leaf is the leaf of batch batchID, hex: ErrNotFound when it is not one.
+func (m *MMR) Leaf(batchID string) (Leaf, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.index[batchID]
+	if !ok {
+		return Leaf{}, fmt.Errorf("%w: batch %s is not in the range", errs.ErrNotFound, batchID)
+	}
+	return m.list[i], nil
+}
+
+func (l *Leaf) root() *big.Int { return (*big.Int)(&l.Root) }
+
+// State is the commitment to the first leaves leaves, 0 for all of them:
+// what a downstream system pins.
+func (m *MMR) State(leaves uint64) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state(leaves)
+}
+
+func (m *MMR) state(leaves uint64) (State, error) {
+	n := uint64(len(m.list))
+	if leaves == 0 {
+		leaves = n
+	}
+	if leaves > n {
+		return State{}, fmt.Errorf("%w: %d leaves, the range has %d", errs.ErrNotFound, leaves, n)
+	}
+	peaks, err := m.peaks(leaves)
+	if err != nil {
+		return State{}, err
+	}
+	st := State{Version: StateVersion, Leaves: leaves, Peaks: make([]circuit.FieldJSON, len(peaks)), Root: circuit.FieldJSON(*Bag(leaves, peaks))}
+	for i, p := range peaks {
+		st.Peaks[i] = circuit.FieldJSON(*p)
+	}
+	return st, nil
+}
+
+func (m *MMR) peaks(leaves uint64) ([]*big.Int, error) {
+	var out []*big.Int
+	for _, mt := range mountains(leaves) {
+		p, err := m.node(mt.peak)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// writeState replaces peaks.json with the current State.
+func (m *MMR) writeState() error {
+	st, err := m.state(0)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(&st, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.dir, peaksName+".tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.dir, peaksName))
+}
+
+// Proof is the inclusion of one batch in the range of Leaves leaves: the
+// path from its leaf up to its mountain's peak, and every peak, which bag
+// to Root.
+type Proof struct {
+	Leaf   Leaf                `json:"leaf"`
+	Leaves uint64              `json:"leaves"`
+	Path   []circuit.FieldJSON `json:"path"` // siblings, the leaf's first
+	Peaks  []circuit.FieldJSON `json:"peaks"`
+	Root   circuit.FieldJSON   `json:"root"`
+}
+
+// Prove is the proof of batch batchID, hex, in the range of its first
+// leaves leaves (0 for all of them), so a batch can be proven against a
+// root pinned before later batches were appended.
+func (m *MMR) Prove(batchID string, leaves uint64) (*Proof, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.index[batchID]
+	if !ok {
+		return nil, fmt.Errorf("%w: batch %s is not in the range", errs.ErrNotFound, batchID)
+	}
+	st, err := m.state(leaves)
+	if err != nil {
+		return nil, err
+	}
+	if i >= st.Leaves {
+		return nil, fmt.Errorf("%w: batch %s is leaf %d, after the first %d", errs.ErrNotFound, batchID, i, st.Leaves)
+	}
+	p := &Proof{Leaf: m.list[i], Leaves: st.Leaves, Peaks: st.Peaks, Root: st.Root}
+	mt, _ := mountainOf(i, st.Leaves)
+	pos, j := leafPos(i), i-mt.leaf
+	for h := range mt.height {
+		step := uint64(1)<<(h+1) - 1
+		sibling := pos + step
+		if j>>h&1 == 1 {
+			sibling = pos - step
+		}
+		s, err := m.node(sibling)
+		if err != nil {
+			return nil, err
+		}
+		p.Path = append(p.Path, circuit.FieldJSON(*s))
+		pos = max(pos, sibling) + 1
+	}
+	return p, nil
+}
+
+// mountainOf is the mountain of leaf i in a range of n leaves and its
+// place among them.
+func mountainOf(i, n uint64) (mountain, int) {
+	for k, mt := range mountains(n) {
+		if i < mt.leaf+1<<mt.height {
+			return mt, k
+		}
+	}
+	return mountain{}, -1
+}
+
+// Verify checks p: its leaf's path opens to its peak, and the peaks bag to
+// its root, which must be root unless root is nil.
+func (p *Proof) Verify(root *big.Int) error {
+	i := p.Leaf.Index
+	if i >= p.Leaves {
+		return fmt.Errorf("%w: leaf %d of %d", errs.ErrInvalidInput, i, p.Leaves)
+	}
+	mt, k := mountainOf(i, p.Leaves)
+	if len(p.Peaks) != len(mountains(p.Leaves)) || len(p.Path) != mt.height {
+		return fmt.Errorf("%w: %d peaks and a path of %d for leaf %d of %d", errs.ErrInvalidInput, len(p.Peaks), len(p.Path), i, p.Leaves)
+	}
+	cur, j := LeafHash(i, p.Leaf.root()), i-mt.leaf
+	for h, s := range p.Path {
+		if j>>h&1 == 0 {
+			cur = hash(cur, (*big.Int)(&s))
+		} else {
+			cur = hash((*big.Int)(&s), cur)
+		}
+	}
+	if cur.Cmp((*big.Int)(&p.Peaks[k])) != 0 {
+		return fmt.Errorf("%w: leaf %d opens to %s, not peak %d", errs.ErrVerificationFailed, i, cur, k)
+	}
+	peaks := make([]*big.Int, len(p.Peaks))
+	for k := range p.Peaks {
+		peaks[k] = (*big.Int)(&p.Peaks[k])
+	}
+	if got := Bag(p.Leaves, peaks); got.Cmp((*big.Int)(&p.Root)) != 0 {
+		return fmt.Errorf("%w: peaks bag to %s, not the root %s", errs.ErrVerificationFailed, got, (*big.Int)(&p.Root))
+	}
+	if root != nil && root.Cmp((*big.Int)(&p.Root)) != 0 {
+		return fmt.Errorf("%w: proof is against root %s, not %s", errs.ErrVerificationFailed, (*big.Int)(&p.Root), root)
+	}
+	return nil
+}
+
+// Check recomputes every node from the leaves and compares it to
+// nodes.bin: ErrArtifactMismatch at the first that differs.
+func (m *MMR) Check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stack []*big.Int // the peaks so far
+	var pos uint64
+	check := func(want *big.Int) error {
+		got, err := m.node(pos)
+		if err != nil {
+			return err
+		}
+		if got.Cmp(want) != 0 {
+			return fmt.Errorf("%w: %s node %d is %s, its leaves hash to %s", errs.ErrArtifactMismatch, nodesName, pos, got, want)
+		}
+		pos++
+		return nil
+	}
+	for i := range m.list {
+		cur := LeafHash(uint64(i), m.list[i].root())
+		if err := check(cur); err != nil {
+			return err
+		}
+		for h := 0; uint64(i)>>h&1 == 1; h++ {
+			cur = hash(stack[len(stack)-1], cur)
+			stack = stack[:len(stack)-1]
+			if err := check(cur); err != nil {
+				return err
+			}
+		}
+		stack = append(stack, cur)
+	}
+	return nil
+}
+
+// Close closes the range's files.
+func (m *MMR) Close() error {
+	var err error
+	for _, f := range []*os.File{m.nodes, m.leaves} {
+		if f != nil {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
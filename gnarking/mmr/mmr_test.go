@@ -0,0 +1,187 @@
+package mmr
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+
+	"gnarking/errs"
+)
+
+func batch(i int) ([32]byte, string) {
+	var id [32]byte
+	id[0], id[31] = byte(i>>8), byte(i)
+	return id, hex.EncodeToString(id[:])
+}
+
+// naive is the root of the leaves of roots, bagging a tree built level by
+// level for each power of two of the count.
+func naive(roots []*big.Int) *big.Int {
+	var peaks []*big.Int
+	start := 0
+	for h := 63; h >= 0; h-- {
+		if len(roots)>>h&1 == 0 {
+			continue
+		}
+		level := make([]*big.Int, 1<<h)
+		for j := range level {
+			level[j] = LeafHash(uint64(start+j), roots[start+j])
+		}
+		for len(level) > 1 {
+			next := make([]*big.Int, len(level)/2)
+			for j := range next {
+				next[j] = hash(level[2*j], level[2*j+1])
+			}
+			level = next
+		}
+		peaks = append(peaks, level[0])
+		start += 1 << h
+	}
+	return Bag(uint64(len(roots)), peaks)
+}
+
+func TestAppendProve(t *testing.T) {
+	m, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	var roots []*big.Int
+	states := map[uint64]State{}
+	for i := range 21 {
+		id, _ := batch(i)
+		root := big.NewInt(int64(1000 + i))
+		if _, err := m.Append(id, "8", root); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+		st, err := m.State(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := naive(roots); (*big.Int)(&st.Root).Cmp(want) != 0 {
+			t.Fatalf("%d leaves: root %s, want %s", i+1, (*big.Int)(&st.Root), want)
+		}
+		states[st.Leaves] = st
+	}
+	if err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	// every leaf against every root since it was appended
+	for n, st := range states {
+		for i := range n {
+			_, id := batch(int(i))
+			p, err := m.Prove(id, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Verify((*big.Int)(&st.Root)); err != nil {
+				t.Fatalf("leaf %d of %d: %v", i, n, err)
+			}
+		}
+	}
+	_, id := batch(3)
+	p, err := m.Prove(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Leaf.root().Add(p.Leaf.root(), big.NewInt(1))
+	if err := p.Verify(nil); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Errorf("tampered leaf: %v", err)
+	}
+	if err := p.Verify(big.NewInt(1)); err == nil {
+		t.Error("verified against another root")
+	}
+	if _, err := m.Prove(id, 3); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("leaf 3 of the first 3: %v", err)
+	}
+	first, _ := batch(0)
+	if _, err := m.Append(first, "8", big.NewInt(1)); !errors.Is(err, errs.ErrDuplicate) {
+		t.Errorf("duplicate: %v", err)
+	}
+	if _, err := m.Append([32]byte{0xff}, "8", fr.Modulus()); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("out of field: %v", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 7 {
+		id, _ := batch(i)
+		if _, err := m.Append(id, "8", big.NewInt(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, _ := m.State(0)
+	m.Close()
+
+	// a torn leaf line and nodes of an eighth leaf, then lost nodes
+	leaves, nodes := filepath.Join(dir, leavesName), filepath.Join(dir, nodesName)
+	f, err := os.OpenFile(leaves, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"index":7,"batch_id":"`)
+	f.Close()
+	f, err = os.OpenFile(nodes, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 4*nodeSize))
+	f.Close()
+	for _, cut := range []int64{-1, 3 * nodeSize} {
+		if cut >= 0 {
+			if err := os.Truncate(nodes, cut); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := m.State(0)
+		if got.Leaves != 7 || (*big.Int)(&got.Root).Cmp((*big.Int)(&want.Root)) != 0 {
+			t.Errorf("reopened: %+v, want %+v", got, want)
+		}
+		if err := m.Check(); err != nil {
+			t.Error(err)
+		}
+		m.Close()
+	}
+	var st State
+	b, err := os.ReadFile(filepath.Join(dir, peaksName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &st); err != nil || st.Leaves != 7 || len(st.Peaks) != 3 {
+		t.Errorf("peaks.json %+v: %v", st, err)
+	}
+
+	// a node that does not match its leaves
+	b, err = os.ReadFile(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[nodeSize+5] ^= 1
+	if err := os.WriteFile(nodes, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Check(); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Errorf("tampered nodes: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Package plugins loads Go plugins (go build -buildmode=plugin) into ddm
+// and settlement_demo, so a program outside this module adds circuit
+// profiles, circuit.Variant ones included, to the stock binaries: a
+// plugin's init calls circuit.RegisterProfile, and from then on the
+// profile is set up, served, proven, verified and exported like a
+// built-in. A plugin registers batch lint rules the same way, with
+// lint.Register. A plugin must be built with the same Go toolchain and
+// module versions as the binary loading it.
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"slices"
+
+	"gnarking/circuit"
+)
+
+// EnvVar lists the plugins the binaries load at start, separated as PATH
+// is.
+const EnvVar = "DDM_PLUGINS"
+
+// Load opens the plugins at paths, in order, running their init functions,
+// and returns the names of the profiles they registered.
+func Load(paths ...string) ([]string, error) {
+	before := names()
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if _, err := plugin.Open(p); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p, err)
+		}
+	}
+	var added []string
+	for _, name := range names() {
+		if !slices.Contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	return added, nil
+}
+
+// LoadEnv loads the plugins EnvVar lists, none when it is unset.
+func LoadEnv() ([]string, error) {
+	v := os.Getenv(EnvVar)
+	if v == "" {
+		return nil, nil
+	}
+	added, err := Load(filepath.SplitList(v)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", EnvVar, err)
+	}
+	return added, nil
+}
+
+func names() []string {
+	var out []string
+	for _, p := range circuit.Profiles() {
+		out = append(out, p.Name)
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package prover
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/constraint/solver"
+	"golang.org/x/sync/semaphore"
+)
+
+// Cores is the core budget of a prove asked for n cores: n, capped at the
+// host's, or all of them when n <= 0.
+func Cores(n int) int {
+	all := runtime.NumCPU()
+	if n <= 0 || n > all {
+		return all
+	}
+	return n
+}
+
+// pool is the host's cores, shared out to capped proves by WithCores.
+var pool = semaphore.NewWeighted(int64(runtime.NumCPU()))
+
+// WithCores runs fn, a prove, once Cores(n) of the host's cores are free in
+// a process-wide pool, and holds them until fn returns: capped proves run
+// side by side only while their budgets add up to the host's cores, and
+// wait their turn beyond that, or until ctx is done. Nothing process-wide
+// is changed, so the rest of the process is unaffected. Within it the prove
+// keeps to the budget: the solver runs Cores(n) workers (SolverOptions) and
+// proveSolved Cores(n) FFT and MSM tasks, so prove time × budget is the CPU
+// time it billed.
+//
+// Without a cap fn just runs, taking nothing from the pool: an uncapped
+// prove is billed every core whatever else runs, and the pipeline's
+// overlapping proves (one solving, one in its MSMs) are uncapped, so
+// holding the whole pool would run them in turn. Capped proves beside
+// uncapped ones share the host without a guarantee.
+func WithCores(ctx context.Context, n int, fn func() error) error {
+	cores := Cores(n)
+	if cores == runtime.NumCPU() {
+		return fn()
+	}
+	if err := pool.Acquire(ctx, int64(cores)); err != nil {
+		return err
+	}
+	defer pool.Release(int64(cores))
+	return fn()
+}
+
+// SolverOptions has the witness solver use Cores(n) workers.
+func SolverOptions(n int) solver.Option { return solver.WithNbTasks(Cores(n)) }
+
+// ProverOptions is SolverOptions for groth16.Prove.
+func ProverOptions(n int) backend.ProverOption {
+	return backend.WithSolverOptions(SolverOptions(n))
+}
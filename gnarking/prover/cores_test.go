@@ -0,0 +1,56 @@
+package prover
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithCores(t *testing.T) {
+	all := runtime.NumCPU()
+	for _, tc := range []struct{ n, want int }{{0, all}, {-1, all}, {1, 1}, {all + 1, all}} {
+		if got := Cores(tc.n); got != tc.want {
+			t.Errorf("Cores(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+	if all < 2 {
+		t.Skip("one core: every budget is uncapped")
+	}
+
+	// a prove holding all but one core keeps a 2-core one waiting, and
+	// neither touches GOMAXPROCS
+	before := runtime.GOMAXPROCS(0)
+	release, held := make(chan struct{}), make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- WithCores(context.Background(), all-1, func() error { close(held); <-release; return nil })
+	}()
+	<-held
+	ran := make(chan int, 1)
+	second := make(chan error, 1)
+	go func() {
+		second <- WithCores(context.Background(), 2, func() error { ran <- runtime.GOMAXPROCS(0); return nil })
+	}()
+	select {
+	case <-ran:
+		t.Fatal("2-core prove ran while another held all but one core")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// one whose request is gone stops waiting, without running
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WithCores(ctx, 2, func() error { t.Error("ran after its ctx was done"); return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("WithCores with a done ctx = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if during := <-ran; during != before {
+		t.Errorf("GOMAXPROCS %d during a capped prove, want %d", during, before)
+	}
+	for _, err := range []error{<-first, <-second} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build ddm_deterministic
+
+package prover
+
+import (
+	"crypto/rand"
+	mrand "math/rand/v2"
+	"sync"
+)
+
+// Deterministic reports whether this binary was built with the
+// ddm_deterministic tag. Never ship such a build: its proofs are not zero
+// knowledge to anyone who knows the seed.
+const Deterministic = true
+
+// SetSeed replaces crypto/rand.Reader with a ChaCha8 stream seeded with seed,
+// so the Groth16 blinding scalars r and s, and every other random draw of the
+// process (keys, signatures), are reproducible and CI can diff proof bytes
+// across refactors. Draws must happen in a fixed order for that to hold: prove
+// one batch at a time (pipeline depth 1).
+func SetSeed(seed [32]byte) error {
+	rand.Reader = &seededReader{src: mrand.NewChaCha8(seed)}
+	return nil
+}
+
+type seededReader struct {
+	mu  sync.Mutex
+	src *mrand.ChaCha8
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.src.Read(p)
+}
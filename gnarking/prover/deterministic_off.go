@@ -0,0 +1,15 @@
+//go:build !ddm_deterministic
+
+package prover
+
+import "errors"
+
+// Deterministic reports whether this binary was built with the
+// ddm_deterministic tag.
+const Deterministic = false
+
+// SetSeed fails: seeded proving randomness exists only in test builds
+// (go build -tags ddm_deterministic).
+func SetSeed(seed [32]byte) error {
+	return errors.New("deterministic proofs need a build with -tags ddm_deterministic")
+}
@@ -0,0 +1,376 @@
+package prover
+
+import (
+	"math/big"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/fft"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/hash_to_field"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/constraint/solver"
+	fcs "github.com/consensys/gnark/frontend/cs"
+)
+
+// groth16_bn254.Prove (gnark v0.14.0) solves the witness and proves from
+// the solution in one call. solveWitness and proveSolved are that call cut
+// in two at the solve, step for step, so each half can be timed and the
+// witness is solved once: the same solve, the same draws of r and s in the
+// same order and the same MSMs, so a deterministic build still reproduces
+// gnark's proof bytes. Unlike gnark's, the prove keeps to a core budget
+// (see WithCores). Keep them in step with gnark on upgrades;
+// TestProveSolved checks them against gnark's verifier.
+
+// solution is a solved witness with the BSB22 commitments made while
+// solving it, what proveSolved takes.
+type solution struct {
+	*cs_bn254.R1CSSolution
+	proof     *groth16_bn254.Proof // its Commitments set
+	committed [][]fr.Element       // each commitment's private committed values
+}
+
+// solveWitness is ccs.Solve with the BSB22 commitments made as gnark makes
+// them, through the commitment hint.
+func solveWitness(r1cs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, fullWitness witness.Witness, opts ...solver.Option) (*solution, error) {
+	commitmentInfo := r1cs.CommitmentInfo.(constraint.Groth16Commitments)
+	s := &solution{
+		proof:     &groth16_bn254.Proof{Commitments: make([]curve.G1Affine, len(commitmentInfo))},
+		committed: make([][]fr.Element, len(commitmentInfo)),
+	}
+	hashToField := hash_to_field.New([]byte(constraint.CommitmentDst))
+
+	bsb22ID := solver.GetHintID(fcs.Bsb22CommitmentComputePlaceholder)
+	opts = append(opts[:len(opts):len(opts)], solver.OverrideHint(bsb22ID, func(_ *big.Int, in []*big.Int, out []*big.Int) error {
+		i := int(in[0].Int64())
+		in = in[1:]
+		s.committed[i] = make([]fr.Element, len(commitmentInfo[i].PrivateCommitted))
+		hashed := in[:len(commitmentInfo[i].PublicAndCommitmentCommitted)]
+		committed := in[len(hashed):]
+		for j, inJ := range committed {
+			s.committed[i][j].SetBigInt(inJ)
+		}
+		var err error
+		if s.proof.Commitments[i], err = pk.CommitmentKeys[i].Commit(s.committed[i]); err != nil {
+			return err
+		}
+		hashToField.Write(constraint.SerializeCommitment(s.proof.Commitments[i].Marshal(), hashed, (fr.Bits-1)/8+1))
+		hashBts := hashToField.Sum(nil)
+		hashToField.Reset()
+		nbBuf := min(fr.Bytes, hashToField.Size())
+		var res fr.Element
+		res.SetBytes(hashBts[:nbBuf])
+		res.BigInt(out[0])
+		return nil
+	}))
+
+	_solution, err := r1cs.Solve(fullWitness, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.R1CSSolution = _solution.(*cs_bn254.R1CSSolution)
+	return s, nil
+}
+
+// proveSolved is the rest of the prove from sol: the commitments' folded
+// proof of knowledge, the quotient's FFTs and the MSMs, on Cores(cores)
+// cores, each step timed into the Timings returned (Solve and Total are
+// the caller's). With every core the MSMs run side by side as gnark runs
+// them; on fewer they run one after the other, each on the whole budget,
+// so they never take more cores than it between them. sol is consumed.
+func proveSolved(r1cs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, sol *solution, cores int) (*groth16_bn254.Proof, Timings, error) {
+	var t Timings
+	start := time.Now()
+	n := Cores(cores)
+	capped := n < runtime.NumCPU()
+	commitmentInfo := r1cs.CommitmentInfo.(constraint.Groth16Commitments)
+	proof := sol.proof
+	wireValues := []fr.Element(sol.W)
+
+	poks := make([]curve.G1Affine, len(pk.CommitmentKeys))
+	for i := range pk.CommitmentKeys {
+		var err error
+		if poks[i], err = pk.CommitmentKeys[i].ProveKnowledge(sol.committed[i]); err != nil {
+			return nil, t, err
+		}
+	}
+	// the challenge folding the PoKs, from the commitments
+	commitmentsSerialized := make([]byte, fr.Bytes*len(commitmentInfo))
+	for i := range commitmentInfo {
+		copy(commitmentsSerialized[fr.Bytes*i:], wireValues[commitmentInfo[i].CommitmentIndex].Marshal())
+	}
+	challenge, err := fr.Hash(commitmentsSerialized, []byte("G16-BSB22"), 1)
+	if err != nil {
+		return nil, t, err
+	}
+	if _, err = proof.CommitmentPok.Fold(poks, challenge[0], ecc.MultiExpConfig{NbTasks: 1}); err != nil {
+		return nil, t, err
+	}
+	t.Commit = time.Since(start)
+
+	// H, while the wire values are filtered and r, s drawn
+	start = time.Now()
+	var h []fr.Element
+	chHDone := make(chan struct{}, 1)
+	go func() {
+		h = computeH(sol.A, sol.B, sol.C, &pk.Domain, n)
+		sol.A, sol.B, sol.C = nil, nil, nil
+		t.FFT = time.Since(start)
+		chHDone <- struct{}{}
+	}()
+
+	// pk.G1.A, pk.G1.B and pk.G2.B may have many points at infinity, the
+	// MSMs skip their wires
+	var wireValuesA, wireValuesB []fr.Element
+	chWireValuesA, chWireValuesB := make(chan struct{}), make(chan struct{})
+	go func() {
+		wireValuesA = withoutInfinity(wireValues, pk.InfinityA, pk.NbInfinityA)
+		close(chWireValuesA)
+	}()
+	go func() {
+		wireValuesB = withoutInfinity(wireValues, pk.InfinityB, pk.NbInfinityB)
+		close(chWireValuesB)
+	}()
+
+	var r, s big.Int
+	var _r, _s, _kr fr.Element
+	if _, err := _r.SetRandom(); err != nil {
+		return nil, t, err
+	}
+	if _, err := _s.SetRandom(); err != nil {
+		return nil, t, err
+	}
+	_kr.Mul(&_r, &_s).Neg(&_kr)
+	_r.BigInt(&r)
+	_s.BigInt(&s)
+	// r[δ], s[δ], kr[δ]
+	deltas := curve.BatchScalarMultiplicationG1(&pk.G1.Delta, []fr.Element{_r, _s, _kr})
+
+	var bs1, ar curve.G1Jac
+	// [A]₁ and [B]₁ share the cores side by side, or have them all in turn
+	g1Tasks := max(1, n/2)
+	if capped {
+		g1Tasks = n
+	}
+
+	chBs1Done := make(chan error, 1)
+	computeBS1 := func() {
+		<-chWireValuesB
+		start := time.Now()
+		if _, err := bs1.MultiExp(pk.G1.B, wireValuesB, ecc.MultiExpConfig{NbTasks: g1Tasks}); err != nil {
+			chBs1Done <- err
+			return
+		}
+		t.MSMB1 = time.Since(start)
+		bs1.AddMixed(&pk.G1.Beta)
+		bs1.AddMixed(&deltas[1])
+		chBs1Done <- nil
+	}
+
+	chArDone := make(chan error, 1)
+	computeAR1 := func() {
+		<-chWireValuesA
+		start := time.Now()
+		if _, err := ar.MultiExp(pk.G1.A, wireValuesA, ecc.MultiExpConfig{NbTasks: g1Tasks}); err != nil {
+			chArDone <- err
+			return
+		}
+		t.MSMA = time.Since(start)
+		ar.AddMixed(&pk.G1.Alpha)
+		ar.AddMixed(&deltas[0])
+		proof.Ar.FromJacobian(&ar)
+		chArDone <- nil
+	}
+
+	chKrsDone := make(chan error, 1)
+	computeKRS := func() {
+		// K and Z as two MSMs of similar lengths, for parallelism
+		var krs, krs2, p1 curve.G1Jac
+		chKrs2Done := make(chan error, 1)
+		sizeH := int(pk.Domain.Cardinality - 1) // deg(H) = (n-1) + (n-1) - n = n-2
+		go func() {
+			start := time.Now()
+			_, err := krs2.MultiExp(pk.G1.Z, h[:sizeH], ecc.MultiExpConfig{NbTasks: max(1, n/2)})
+			t.MSMZ = time.Since(start)
+			chKrs2Done <- err
+		}()
+
+		var toRemove []int
+		for _, c := range commitmentInfo.GetPrivateCommitted() {
+			toRemove = append(toRemove, c...)
+		}
+		toRemove = append(toRemove, commitmentInfo.CommitmentIndexes()...)
+		_wireValues := without(wireValues[r1cs.GetNbPublicVariables():], r1cs.GetNbPublicVariables(), toRemove)
+
+		start := time.Now()
+		if _, err := krs.MultiExp(pk.G1.K, _wireValues, ecc.MultiExpConfig{NbTasks: max(1, n/2)}); err != nil {
+			chKrsDone <- err
+			return
+		}
+		t.MSMK = time.Since(start)
+		krs.AddMixed(&deltas[2])
+		for range 3 {
+			select {
+			case err := <-chKrs2Done:
+				if err != nil {
+					chKrsDone <- err
+					return
+				}
+				krs.AddAssign(&krs2)
+			case err := <-chArDone:
+				if err != nil {
+					chKrsDone <- err
+					return
+				}
+				p1.ScalarMultiplication(&ar, &s)
+				krs.AddAssign(&p1)
+			case err := <-chBs1Done:
+				if err != nil {
+					chKrsDone <- err
+					return
+				}
+				p1.ScalarMultiplication(&bs1, &r)
+				krs.AddAssign(&p1)
+			}
+		}
+		proof.Krs.FromJacobian(&krs)
+		chKrsDone <- nil
+	}
+
+	computeBS2 := func() error {
+		var Bs, deltaS curve.G2Jac
+		nbTasks := n
+		if nbTasks <= 16 && !capped {
+			// few CPUs: split the MSM more than there are
+			nbTasks *= 2
+		}
+		<-chWireValuesB
+		start := time.Now()
+		if _, err := Bs.MultiExp(pk.G2.B, wireValuesB, ecc.MultiExpConfig{NbTasks: nbTasks}); err != nil {
+			return err
+		}
+		t.MSMB2 = time.Since(start)
+		deltaS.FromAffine(&pk.G2.Delta)
+		deltaS.ScalarMultiplication(&deltaS, &s)
+		Bs.AddAssign(&deltaS)
+		Bs.AddMixed(&pk.G2.Beta)
+		proof.Bs.FromJacobian(&Bs)
+		return nil
+	}
+
+	// the FFTs use every core of the budget, the MSMs start after them
+	<-chHDone
+	start = time.Now()
+	if capped {
+		computeAR1()
+		computeBS1()
+		computeKRS()
+	} else {
+		go computeKRS()
+		go computeAR1()
+		go computeBS1()
+	}
+	if err := computeBS2(); err != nil {
+		return nil, t, err
+	}
+	if err := <-chKrsDone; err != nil {
+		return nil, t, err
+	}
+	t.MSM = time.Since(start)
+	return proof, t, nil
+}
+
+// withoutInfinity is values without those of the nbInfinity points at
+// infinity.
+func withoutInfinity(values []fr.Element, infinity []bool, nbInfinity uint64) []fr.Element {
+	out := make([]fr.Element, len(values)-int(nbInfinity))
+	for i, j := 0, 0; j < len(out); i++ {
+		if infinity[i] {
+			continue
+		}
+		out[j] = values[i]
+		j++
+	}
+	return out
+}
+
+// without is values, the first at index first, without those at the
+// indices in remove; values itself when there are none.
+func without(values []fr.Element, first int, remove []int) []fr.Element {
+	if len(remove) == 0 {
+		return values
+	}
+	slices.Sort(remove)
+	out := make([]fr.Element, 0, len(values))
+	k := 0
+	for i := range values {
+		for k < len(remove) && remove[k] < i+first {
+			k++
+		}
+		if k < len(remove) && remove[k] == i+first {
+			continue
+		}
+		out = append(out, values[i])
+	}
+	return out
+}
+
+// computeH is the quotient H of a·b − c by the vanishing polynomial
+// x^n − 1 of domain: a, b, c interpolated (inverse FFTs), evaluated on a
+// coset (FFTs), combined there and interpolated back (inverse coset FFT),
+// on nbTasks cores.
+func computeH(a, b, c []fr.Element, domain *fft.Domain, nbTasks int) []fr.Element {
+	padding := make([]fr.Element, int(domain.Cardinality)-len(a))
+	a = append(a, padding...)
+	b = append(b, padding...)
+	c = append(c, padding...)
+
+	tasks := fft.WithNbTasks(nbTasks)
+	domain.FFTInverse(a, fft.DIF, tasks)
+	domain.FFTInverse(b, fft.DIF, tasks)
+	domain.FFTInverse(c, fft.DIF, tasks)
+
+	domain.FFT(a, fft.DIT, fft.OnCoset(), tasks)
+	domain.FFT(b, fft.DIT, fft.OnCoset(), tasks)
+	domain.FFT(c, fft.DIT, fft.OnCoset(), tasks)
+
+	var den, one fr.Element
+	one.SetOne()
+	den.Exp(domain.FrMultiplicativeGen, big.NewInt(int64(domain.Cardinality)))
+	den.Sub(&den, &one).Inverse(&den)
+
+	// h = ifft_coset(ca ∘ cb − cc), into a
+	parallelize(len(a), nbTasks, func(start, end int) {
+		for i := start; i < end; i++ {
+			a[i].Mul(&a[i], &b[i]).Sub(&a[i], &c[i]).Mul(&a[i], &den)
+		}
+	})
+	domain.FFTInverse(a, fft.DIF, fft.OnCoset(), tasks)
+	return a
+}
+
+// parallelize runs work over [0, n) in nbTasks chunks at once.
+func parallelize(n, nbTasks int, work func(start, end int)) {
+	tasks := min(nbTasks, n)
+	if tasks <= 1 {
+		work(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	per := (n + tasks - 1) / tasks
+	for start := 0; start < n; start += per {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(start, min(start+per, n))
+		}()
+	}
+	wg.Wait()
+}
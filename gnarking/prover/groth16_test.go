@@ -0,0 +1,99 @@
+package prover
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// committedCircuit is squareCircuit with a BSB22 commitment, as range
+// checks make them.
+type committedCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *committedCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	cm, err := api.(frontend.Committer).Commit(c.X)
+	if err != nil {
+		return err
+	}
+	api.AssertIsDifferent(cm, 0)
+	return nil
+}
+
+// TestProveSolved checks proofs from a solution against gnark's verifier,
+// with and without commitments, on every core and on a budget of one.
+func TestProveSolved(t *testing.T) {
+	for name, c := range map[string][2]frontend.Circuit{
+		"plain":     {&squareCircuit{}, &squareCircuit{X: 3, Y: 9}},
+		"committed": {&committedCircuit{}, &committedCircuit{X: 3, Y: 9}},
+	} {
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := frontend.NewWitness(c[1], ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sol, err := solveWitness(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		proof, tm, err := proveSolved(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), sol, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, p := range tm.Phases() {
+			if p.Duration <= 0 && p.Phase != "solve" && (p.Phase != "commit" || name == "committed") {
+				t.Errorf("%s: %s not timed: %+v", name, p.Phase, tm)
+			}
+		}
+		pw, _ := w.Public()
+		if err := groth16.Verify(proof, vk, pw); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(proof.Commitments) != map[string]int{"plain": 0, "committed": 1}[name] {
+			t.Errorf("%s: %d commitments", name, len(proof.Commitments))
+		}
+		// on one core, the MSMs one after the other
+		sol, err = solveWitness(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w, SolverOptions(1))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if proof, _, err = proveSolved(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), sol, 1); err != nil {
+			t.Fatalf("%s on one core: %v", name, err)
+		}
+		if err := groth16.Verify(proof, vk, pw); err != nil {
+			t.Fatalf("%s on one core: %v", name, err)
+		}
+	}
+}
+
+// TestForkedVersions fails on a gnark or gnark-crypto upgrade: solveWitness
+// and proveSolved are gnark v0.14.0's prover over gnark-crypto v0.19.0 and
+// are re-synced with the new release's before these are bumped.
+func TestForkedVersions(t *testing.T) {
+	mod, err := os.ReadFile("../go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"github.com/consensys/gnark v0.14.0", "github.com/consensys/gnark-crypto v0.19.0"} {
+		if !strings.Contains(string(mod), "\t"+want+"\n") {
+			t.Errorf("go.mod no longer requires %s: re-sync prover/groth16.go with the new gnark prover, then update this test", want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package prover
+
+import (
+	"context"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+
+	"gnarking/crash"
+	"gnarking/tracing"
+)
+
+// prove is groth16_bn254.Prove on a budget of cores (see WithCores) with a
+// panic returned as a *crash.Error: solve, then proveFrom, timed, each a
+// span ("solve", "msm") under ctx's.
+func prove(ctx context.Context, op string, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, w witness.Witness, cores int) (proof *groth16_bn254.Proof, t Timings, err error) {
+	err = WithCores(ctx, cores, func() (err error) {
+		start := time.Now()
+		_, span := tracing.Start(ctx, string(PhaseSolve))
+		sol, err := solve(op, ccs, pk, w, cores)
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+		solved := time.Since(start)
+		_, span = tracing.Start(ctx, string(PhaseMSM))
+		proof, t, err = proveFrom(op, ccs, pk, w, sol, cores)
+		tracing.End(span, err)
+		t.Solve, t.Total = solved, time.Since(start)
+		return err
+	})
+	return proof, t, err
+}
+
+// solve solves w on Cores(cores) workers, with a panic returned as a
+// *crash.Error.
+func solve(op string, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, w witness.Witness, cores int) (sol *solution, err error) {
+	defer crash.Guard(op, crashReport(ccs, pk, w), &err)
+	return solveWitness(ccs, pk, w, SolverOptions(cores))
+}
+
+// proveFrom proves from sol, w's solution, on Cores(cores) cores, timed
+// (see proveSolved), with a panic returned as a *crash.Error.
+func proveFrom(op string, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, w witness.Witness, sol *solution, cores int) (proof *groth16_bn254.Proof, t Timings, err error) {
+	defer crash.Guard(op, crashReport(ccs, pk, w), &err)
+	return proveSolved(ccs, pk, sol, cores)
+}
+
+// crashReport is what the bundle of a crashed prove records: the witness's
+// public part and the hashes of ccs and pk.
+func crashReport(ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, w witness.Witness) func() crash.Report {
+	return func() crash.Report {
+		r := crash.Report{Batch: crash.Summarize(w), Artifacts: []crash.Artifact{{Name: "ccs", A: ccs}}}
+		if pk != nil {
+			r.Artifacts = append(r.Artifacts, crash.Artifact{Name: "pk", A: pk})
+		}
+		return r
+	}
+}
@@ -0,0 +1,153 @@
+// Package prover runs the daemon's proving loop. groth16.Prove first solves
+// the witness (mostly single-threaded) and then runs the MSMs (all cores), so
+// keeping more than one batch in flight lets batch k+1 solve while batch k's
+// MSMs run, and sustained throughput goes up.
+package prover
+
+import (
+	"context"
+	"time"
+
+	"github.com/consensys/gnark/backend/witness"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+
+	"gnarking/memwatch"
+	"gnarking/tracing"
+)
+
+const (
+	DefaultDepth          = 2
+	DefaultBudgetInterval = 50 * time.Millisecond
+)
+
+// Pipeline proves a stream of full witnesses for one circuit.
+type Pipeline struct {
+	CCS *cs_bn254.R1CS
+	PK  *groth16_bn254.ProvingKey
+
+	// Depth is the number of batches in flight, 1 proves one after the
+	// other. DefaultDepth when zero.
+	Depth int
+	// MemBudget holds back the next batch while memwatch.InUse is above it
+	// and another batch is still in flight, so the overlap never costs more
+	// than one batch of memory over budget. Zero means no budget.
+	MemBudget uint64
+	// Interval between memory checks while held back, DefaultBudgetInterval
+	// when zero.
+	Interval time.Duration
+}
+
+// Result is the outcome of the Index-th witness.
+type Result struct {
+	Index   int
+	Proof   *groth16_bn254.Proof
+	Err     error
+	Elapsed time.Duration // from the batch's start to its proof
+	Timings Timings       // of the prove's phases, Elapsed broken down
+}
+
+// Run proves every witness received from in and sends the results in input
+// order. The returned channel is closed once in is closed (or ctx is done)
+// and every started batch has finished; batches already proving are not
+// interrupted since groth16.Prove takes no context.
+func (p Pipeline) Run(ctx context.Context, in <-chan witness.Witness) <-chan Result {
+	slots := p.Slots()
+	out := make(chan Result, slots.Depth())
+	// pending keeps started batches in input order for the emitter
+	pending := make(chan chan Result, slots.Depth())
+
+	go func() {
+		defer close(pending)
+		for i := 0; ; i++ {
+			var w witness.Witness
+			select {
+			case <-ctx.Done():
+				return
+			case wit, ok := <-in:
+				if !ok {
+					return
+				}
+				w = wit
+			}
+			if slots.Acquire(ctx) != nil {
+				return
+			}
+
+			res := make(chan Result, 1)
+			pending <- res
+			go func(i int, w witness.Witness) {
+				defer slots.Release()
+				ctx, span := tracing.Start(ctx, "prove", tracing.Constraints(p.CCS.GetNbConstraints()))
+				start := time.Now()
+				proof, timings, err := prove(ctx, "pipeline/prove", p.CCS, p.PK, w, 0)
+				tracing.End(span, err)
+				res <- Result{Index: i, Proof: proof, Err: err, Elapsed: time.Since(start), Timings: timings}
+			}(i, w)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range pending {
+			out <- <-res
+		}
+	}()
+	return out
+}
+
+// Slots admits proves as a Pipeline does: up to its Depth at once, the next
+// held back while memwatch.InUse is over its MemBudget and another is still
+// in flight. Run takes one per stream; a server proving batches as requests
+// bring them shares one between the requests.
+type Slots struct {
+	sem      chan struct{}
+	budget   uint64
+	interval time.Duration
+}
+
+// Slots is the admission of p's Depth and MemBudget, for proves run
+// outside Run.
+func (p Pipeline) Slots() *Slots {
+	depth := p.Depth
+	if depth <= 0 {
+		depth = DefaultDepth
+	}
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultBudgetInterval
+	}
+	return &Slots{sem: make(chan struct{}, depth), budget: p.MemBudget, interval: interval}
+}
+
+// Depth is the number of proves admitted at once.
+func (s *Slots) Depth() int { return cap(s.sem) }
+
+// Acquire blocks until a prove may start, or fails with ctx's error. A
+// prove with nothing else in flight always starts. Each successful Acquire
+// must be followed by a Release once the prove is done.
+func (s *Slots) Acquire(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.sem <- struct{}{}:
+	}
+	if s.budget == 0 {
+		return nil
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for len(s.sem) > 1 && memwatch.InUse() > s.budget {
+		select {
+		case <-ctx.Done():
+			<-s.sem
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Release frees the slot of a finished prove.
+func (s *Slots) Release() { <-s.sem }
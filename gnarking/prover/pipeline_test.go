@@ -0,0 +1,131 @@
+package prover
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// squareCircuit proves knowledge of X with X*X == Y.
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+func TestPipeline(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 6
+	wits := make([]witness.Witness, n)
+	for j := range wits {
+		y := (j + 2) * (j + 2)
+		if j == 4 {
+			y++ // unsatisfiable, must fail alone
+		}
+		if wits[j], err = frontend.NewWitness(&squareCircuit{X: j + 2, Y: y}, ecc.BN254.ScalarField()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []Pipeline{
+		{Depth: 1},
+		{Depth: 3},
+		{Depth: 3, MemBudget: 1}, // always over budget: one batch at a time
+	} {
+		p.CCS, p.PK = ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey)
+		in := make(chan witness.Witness)
+		go func() {
+			defer close(in)
+			for _, w := range wits {
+				in <- w
+			}
+		}()
+
+		i := 0
+		for res := range p.Run(context.Background(), in) {
+			if res.Index != i {
+				t.Fatalf("depth %d: result %d out of order, want %d", p.Depth, res.Index, i)
+			}
+			if i == 4 {
+				if res.Err == nil {
+					t.Fatalf("depth %d: unsatisfiable witness proved", p.Depth)
+				}
+			} else {
+				if res.Err != nil {
+					t.Fatalf("depth %d: batch %d: %v", p.Depth, i, res.Err)
+				}
+				pw, _ := wits[i].Public()
+				if err := groth16.Verify(res.Proof, vk, pw); err != nil {
+					t.Fatalf("depth %d: batch %d: %v", p.Depth, i, err)
+				}
+			}
+			i++
+		}
+		if i != n {
+			t.Fatalf("depth %d: %d results, want %d", p.Depth, i, n)
+		}
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in := make(chan witness.Witness) // never sends
+	for range (Pipeline{}).Run(ctx, in) {
+		t.Fatal("result from a cancelled pipeline")
+	}
+}
+
+func TestSlots(t *testing.T) {
+	ctx := context.Background()
+	short := func() context.Context {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	s := Pipeline{Depth: 2}.Slots()
+	if s.Acquire(ctx) != nil || s.Acquire(ctx) != nil {
+		t.Fatal("two proves at depth 2")
+	}
+	if s.Acquire(short()) == nil {
+		t.Fatal("a third prove at depth 2")
+	}
+	s.Release()
+	if s.Acquire(ctx) != nil {
+		t.Fatal("no slot after a release")
+	}
+
+	// always over budget: the first starts, the second waits for it
+	s = Pipeline{Depth: 2, MemBudget: 1, Interval: time.Millisecond}.Slots()
+	if s.Acquire(ctx) != nil {
+		t.Fatal("nothing in flight, over budget")
+	}
+	if s.Acquire(short()) == nil {
+		t.Fatal("a second prove over budget")
+	}
+	s.Release()
+	if s.Acquire(ctx) != nil {
+		t.Fatal("the slot given back by a cancelled wait")
+	}
+}
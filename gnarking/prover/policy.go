@@ -0,0 +1,93 @@
+package prover
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"gnarking/errs"
+)
+
+// Batch is what a Policy sees of a batch: the rows as received from
+// upstream, before any witness is built.
+type Batch struct {
+	Recipient *big.Int
+	ChainID   *big.Int
+	Sizes     []*big.Int
+}
+
+// Policy decides whether a batch may be proven at all, so a compromised
+// upstream cannot get arbitrary (valid, signed) batches proven. Check returns
+// an error wrapping errs.ErrPolicyRejected to refuse.
+type Policy interface {
+	Check(b Batch) error
+}
+
+// Rules is the file-configured Policy. Zero fields do not restrict.
+type Rules struct {
+	MaxTotal   uint64   `json:"max_total,omitempty"`
+	MaxRowSize uint64   `json:"max_row_size,omitempty"`
+	Recipients []string `json:"recipients,omitempty"` // hex allowlist
+	ChainIDs   []uint64 `json:"chain_ids,omitempty"`  // allowlist
+}
+
+var _ Policy = (*Rules)(nil)
+
+// LoadRules reads a JSON Rules file; unknown fields are an error so a typo
+// does not silently disable a rule.
+func LoadRules(path string) (*Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	var r Rules
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%w: policy %s: %w", errs.ErrInvalidInput, path, err)
+	}
+	if _, err := r.recipients(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+func (r *Rules) recipients() ([]*big.Int, error) {
+	out := make([]*big.Int, len(r.Recipients))
+	for i, h := range r.Recipients {
+		v, ok := new(big.Int).SetString(strings.TrimPrefix(strings.TrimPrefix(h, "0x"), "0X"), 16)
+		if !ok {
+			return nil, fmt.Errorf("%w: recipient %q is not hex", errs.ErrInvalidInput, h)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (r *Rules) Check(b Batch) error {
+	allowed, err := r.recipients()
+	if err != nil {
+		return err
+	}
+	if len(allowed) > 0 && !slices.ContainsFunc(allowed, func(v *big.Int) bool { return v.Cmp(b.Recipient) == 0 }) {
+		return fmt.Errorf("%w: recipient 0x%x not allowed", errs.ErrPolicyRejected, b.Recipient)
+	}
+	if len(r.ChainIDs) > 0 && !(b.ChainID.IsUint64() && slices.Contains(r.ChainIDs, b.ChainID.Uint64())) {
+		return fmt.Errorf("%w: chain ID %s not allowed", errs.ErrPolicyRejected, b.ChainID)
+	}
+	total := new(big.Int)
+	for i, s := range b.Sizes {
+		if r.MaxRowSize > 0 && s.Cmp(new(big.Int).SetUint64(r.MaxRowSize)) > 0 {
+			return fmt.Errorf("%w: row %d size %s over %d", errs.ErrPolicyRejected, i, s, r.MaxRowSize)
+		}
+		total.Add(total, s)
+	}
+	if r.MaxTotal > 0 && total.Cmp(new(big.Int).SetUint64(r.MaxTotal)) > 0 {
+		return fmt.Errorf("%w: batch total %s over %d", errs.ErrPolicyRejected, total, r.MaxTotal)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package prover
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"max_total": 10, "max_row_size": 4, "recipients": ["0x2a"], "chain_ids": [1, 42161]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := func(s ...int64) []*big.Int {
+		out := make([]*big.Int, len(s))
+		for i, v := range s {
+			out[i] = big.NewInt(v)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		b    Batch
+		ok   bool
+	}{
+		{"allowed", Batch{big.NewInt(42), big.NewInt(42161), sizes(4, 4, 2)}, true},
+		{"recipient", Batch{big.NewInt(43), big.NewInt(1), sizes(1)}, false},
+		{"chain", Batch{big.NewInt(42), big.NewInt(5), sizes(1)}, false},
+		{"row size", Batch{big.NewInt(42), big.NewInt(1), sizes(1, 5)}, false},
+		{"total", Batch{big.NewInt(42), big.NewInt(1), sizes(4, 4, 3)}, false},
+	} {
+		err := r.Check(tc.b)
+		if tc.ok != (err == nil) {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if err != nil && !errors.Is(err, errs.ErrPolicyRejected) {
+			t.Errorf("%s: want ErrPolicyRejected, got %v", tc.name, err)
+		}
+	}
+
+	// zero rules allow anything
+	if err := (&Rules{}).Check(Batch{big.NewInt(7), big.NewInt(9), sizes(1 << 40)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a misspelled rule is an error, not a disabled rule
+	if err := os.WriteFile(path, []byte(`{"max_totl": 10}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(path); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("want ErrInvalidInput, got %v", err)
+	}
+}
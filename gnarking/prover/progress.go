@@ -0,0 +1,155 @@
+package prover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+
+	"gnarking/chaos"
+	"gnarking/crash"
+	"gnarking/errs"
+	"gnarking/tracing"
+)
+
+// Phase is a step of proving one batch.
+type Phase string
+
+const (
+	PhaseSolve Phase = "solve" // witness solving (mostly single-threaded)
+	PhaseMSM   Phase = "msm"   // the rest of the prove from the solution, the MSMs most of it (all cores); Timings breaks it down
+	PhaseDone  Phase = "done"
+)
+
+// Progress is one progress event. Percent is the estimated completion of
+// Phase, it only reaches 100 when the phase has actually ended.
+type Progress struct {
+	Phase   Phase         `json:"phase"`
+	Percent float64       `json:"percent"`
+	Elapsed time.Duration `json:"elapsed_ns"` // since the phase started, since proving started for PhaseDone
+	// Timings are the prove's phases, on PhaseDone only
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// Per-constraint priors for a phase nothing was measured for yet (one core,
+// N = 8 settlement circuit).
+var phasePriors = map[Phase]time.Duration{
+	PhaseSolve: time.Microsecond,
+	PhaseMSM:   30 * time.Microsecond,
+}
+
+// Tracker proves with progress events. Neither phase reports anything while
+// it runs, so within a phase Percent is elapsed time against the phase's
+// last measured duration, scaled to the prove's core budget. A Tracker is
+// safe for concurrent use.
+type Tracker struct {
+	Interval time.Duration // between events within a phase, DefaultProgressInterval when zero
+
+	mu   sync.Mutex
+	last map[Phase]time.Duration // times the cores it ran on
+}
+
+const DefaultProgressInterval = 250 * time.Millisecond
+
+// Prove solves w, PhaseSolve, then proves from the solution, PhaseMSM,
+// both on Cores(cores) cores: w is solved once, each phase is timed on its
+// own and the second step by step. A witness that does not solve fails
+// with errs.ErrInvalidBatch. report gets every event, from the calling
+// goroutine's point of view in order; it must not block for long. The
+// PhaseDone event carries the prove's Timings. The prove is a span under
+// ctx's, each phase a span under it.
+func (t *Tracker) Prove(ctx context.Context, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey, w witness.Witness, cores int, report func(Progress)) (proof *groth16_bn254.Proof, err error) {
+	nbConstraints := ccs.GetNbConstraints()
+	ctx, span := tracing.Start(ctx, "prove", tracing.Constraints(nbConstraints))
+	defer func() { tracing.End(span, err) }()
+
+	cores = Cores(cores)
+	var tm Timings
+	err = WithCores(ctx, cores, func() (err error) {
+		var sol *solution
+		solved, err := t.phase(ctx, PhaseSolve, nbConstraints, cores, report, func() (err error) {
+			sol, err = solve("prove", ccs, pk, w, cores)
+			if err != nil && !errors.As(err, new(*crash.Error)) {
+				return fmt.Errorf("%w: unsatisfiable witness: %w", errs.ErrInvalidBatch, err)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// the prove times its own steps, the phase all of it
+		proved, err := t.phase(ctx, PhaseMSM, nbConstraints, cores, report, func() (err error) {
+			proof, tm, err = proveFrom("prove", ccs, pk, w, sol, cores)
+			return err
+		})
+		tm.Solve, tm.Total = solved, solved+proved
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	report(Progress{Phase: PhaseDone, Percent: 100, Elapsed: tm.Total, Timings: &tm})
+	return proof, nil
+}
+
+func (t *Tracker) phase(ctx context.Context, p Phase, nbConstraints, cores int, report func(Progress), fn func() error) (_ time.Duration, err error) {
+	_, span := tracing.Start(ctx, string(p))
+	defer func() { tracing.End(span, err) }()
+	expected := t.expected(p, nbConstraints, cores)
+	interval := t.Interval
+	if interval == 0 {
+		interval = DefaultProgressInterval
+	}
+
+	start := time.Now()
+	report(Progress{Phase: p})
+	done := make(chan error, 1)
+	go func() {
+		if err := chaos.Kill(string(p)); err != nil {
+			done <- err
+			return
+		}
+		done <- fn()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			elapsed := time.Since(start)
+			if err != nil {
+				return elapsed, err
+			}
+			t.record(p, elapsed, cores)
+			report(Progress{Phase: p, Percent: 100, Elapsed: elapsed})
+			return elapsed, nil
+		case <-ticker.C:
+			elapsed := time.Since(start)
+			report(Progress{Phase: p, Percent: min(99, 100*elapsed.Seconds()/expected.Seconds()), Elapsed: elapsed})
+		}
+	}
+}
+
+func (t *Tracker) expected(p Phase, nbConstraints, cores int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d, ok := t.last[p]; ok {
+		return max(d/time.Duration(cores), time.Millisecond)
+	}
+	return max(time.Duration(nbConstraints)*phasePriors[p], time.Millisecond)
+}
+
+func (t *Tracker) record(p Phase, d time.Duration, cores int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		t.last = make(map[Phase]time.Duration)
+	}
+	t.last[p] = d * time.Duration(cores)
+}
@@ -0,0 +1,126 @@
+package prover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/crash"
+	"gnarking/errs"
+)
+
+func TestTracker(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &Tracker{Interval: time.Millisecond}
+
+	w, _ := frontend.NewWitness(&squareCircuit{X: 3, Y: 9}, ecc.BN254.ScalarField())
+	var events []Progress
+	proof, err := tr.Prove(context.Background(), ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w, 0, func(p Progress) { events = append(events, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, _ := w.Public()
+	if err := groth16.Verify(proof, vk, pw); err != nil {
+		t.Fatal(err)
+	}
+
+	// phases in order, each from 0 to 100, percent never going back
+	order := map[Phase]int{PhaseSolve: 0, PhaseMSM: 1, PhaseDone: 2}
+	prev := events[0]
+	if prev.Phase != PhaseSolve || prev.Percent != 0 {
+		t.Fatalf("first event %+v", prev)
+	}
+	for _, e := range events[1:] {
+		if order[e.Phase] < order[prev.Phase] || (e.Phase == prev.Phase && e.Percent < prev.Percent) {
+			t.Fatalf("event %+v after %+v", e, prev)
+		}
+		if e.Phase != prev.Phase && prev.Percent != 100 {
+			t.Fatalf("phase %s left at %.0f%%", prev.Phase, prev.Percent)
+		}
+		prev = e
+	}
+	if prev.Phase != PhaseDone || prev.Percent != 100 {
+		t.Fatalf("last event %+v", prev)
+	}
+	// and carries the prove's timings
+	if tm := prev.Timings; tm == nil || tm.Solve <= 0 || tm.MSM <= 0 || tm.Total != prev.Elapsed {
+		t.Fatalf("done with timings %+v", tm)
+	}
+	// solve, then msm, each timed as its own end event says, msm's steps
+	// within it, and measured for the next prove's percents
+	ended := make(map[Phase]time.Duration)
+	for _, e := range events {
+		if e.Percent == 100 && e.Phase != PhaseDone {
+			ended[e.Phase] = e.Elapsed
+		}
+	}
+	if tm := prev.Timings; len(ended) != 2 || ended[PhaseSolve] != tm.Solve || ended[PhaseMSM] != tm.Total-tm.Solve ||
+		tm.FFT <= 0 || tm.Commit+tm.FFT+tm.MSM > ended[PhaseMSM] {
+		t.Fatalf("phases ended after %v, timings %+v", ended, tm)
+	}
+	if tr.last[PhaseSolve] <= 0 || tr.last[PhaseMSM] <= 0 {
+		t.Fatalf("measured %v", tr.last)
+	}
+
+	// an unsatisfiable witness fails as an invalid batch, never done
+	bad, _ := frontend.NewWitness(&squareCircuit{X: 3, Y: 10}, ecc.BN254.ScalarField())
+	events = nil
+	if _, err := tr.Prove(context.Background(), ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), bad, 0, func(p Progress) { events = append(events, p) }); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("unsatisfiable witness: %v, want ErrInvalidBatch", err)
+	}
+	// the solve fails, so the prove never reaches msm
+	for _, e := range events {
+		if e.Phase != PhaseSolve || e.Percent == 100 {
+			t.Fatalf("event %+v after a failed prove", e)
+		}
+	}
+}
+
+// TestTrackerPanic solves a nil witness, on which gnark panics: the prove
+// fails with a *crash.Error and leaves a bundle instead of taking the
+// process down.
+func TestTrackerPanic(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crash.SetDir(t.TempDir())
+	defer crash.SetDir("")
+
+	_, err = new(Tracker).Prove(context.Background(), ccs.(*cs_bn254.R1CS), new(groth16_bn254.ProvingKey), nil, 0, func(Progress) {})
+	var ce *crash.Error
+	if !errors.As(err, &ce) || ce.Op != "prove" {
+		t.Fatalf("err = %v, want a crash.Error of prove", err)
+	}
+	if errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("panic reported as an unsatisfiable witness: %v", err)
+	}
+	data, err := os.ReadFile(ce.Bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b crash.Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Op != "prove" || b.Stack == "" || b.Batch == nil || b.Batch.Error == "" || len(b.Artifacts["ccs"]) != 64 {
+		t.Fatalf("bundle %+v", b)
+	}
+}
@@ -0,0 +1,81 @@
+package prover
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timings is where one prove's time went: the witness solve, then the
+// prove from its solution step by step, the commitments' proof of
+// knowledge, the quotient's FFTs and the MSMs. On every core the MSMs run
+// concurrently, [A]₁, [B]₁ and the two of [C]₁ on half the cores each and
+// [B]₂ on all of them, so their durations overlap: they add up to more
+// than MSM, the wall time from the FFTs' end to the proof. Each is what
+// its own MSM took competing with the rest, which is what a faster MSM
+// (e.g. on a GPU) would win back. On a capped budget they run in turn,
+// but for the two of [C]₁.
+type Timings struct {
+	Solve  time.Duration `json:"solve_ns"`  // witness solving, the BSB22 commitments included
+	Commit time.Duration `json:"commit_ns"` // the commitments' folded proof of knowledge
+	FFT    time.Duration `json:"fft_ns"`    // the quotient H: 3 inverse FFTs, 3 coset FFTs and 1 inverse coset FFT
+	MSM    time.Duration `json:"msm_ns"`
+	MSMA   time.Duration `json:"msm_a_ns"`  // [A]₁ over the wires
+	MSMB1  time.Duration `json:"msm_b1_ns"` // [B]₁ over the wires
+	MSMB2  time.Duration `json:"msm_b2_ns"` // [B]₂ over the wires, in G2
+	MSMK   time.Duration `json:"msm_k_ns"`  // [C]₁'s part over the private wires
+	MSMZ   time.Duration `json:"msm_z_ns"`  // [C]₁'s part over H
+	Total  time.Duration `json:"total_ns"`
+}
+
+// PhaseTiming is one named duration of a Timings.
+type PhaseTiming struct {
+	Phase    string
+	Duration time.Duration
+}
+
+// Phases lists t's durations in proving order, named as their JSON fields
+// without the _ns suffix; metrics and reports label them so.
+func (t Timings) Phases() []PhaseTiming {
+	return []PhaseTiming{
+		{"solve", t.Solve}, {"commit", t.Commit}, {"fft", t.FFT}, {"msm", t.MSM},
+		{"msm_a", t.MSMA}, {"msm_b1", t.MSMB1}, {"msm_b2", t.MSMB2}, {"msm_k", t.MSMK}, {"msm_z", t.MSMZ},
+	}
+}
+
+// Add sums u into t, e.g. to average the timings of a run.
+func (t *Timings) Add(u Timings) {
+	t.Solve += u.Solve
+	t.Commit += u.Commit
+	t.FFT += u.FFT
+	t.MSM += u.MSM
+	t.MSMA += u.MSMA
+	t.MSMB1 += u.MSMB1
+	t.MSMB2 += u.MSMB2
+	t.MSMK += u.MSMK
+	t.MSMZ += u.MSMZ
+	t.Total += u.Total
+}
+
+// Div is t with every duration divided by n, for an average of n.
+func (t Timings) Div(n int) Timings {
+	if n <= 0 {
+		return t
+	}
+	d := time.Duration(n)
+	return Timings{t.Solve / d, t.Commit / d, t.FFT / d, t.MSM / d, t.MSMA / d, t.MSMB1 / d, t.MSMB2 / d, t.MSMK / d, t.MSMZ / d, t.Total / d}
+}
+
+// String is the breakdown on one line, each phase with its share of Total.
+func (t Timings) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "total %s:", t.Total.Round(time.Microsecond))
+	for _, p := range t.Phases() {
+		share := 0.0
+		if t.Total > 0 {
+			share = 100 * p.Duration.Seconds() / t.Total.Seconds()
+		}
+		fmt.Fprintf(&b, " %s %s (%.0f%%)", p.Phase, p.Duration.Round(time.Microsecond), share)
+	}
+	return b.String()
+}
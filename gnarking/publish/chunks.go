@@ -0,0 +1,258 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+	"gnarking/ioutilx"
+	"gnarking/retry"
+)
+
+// Artifacts too large for one block, keys and circuits, are published as
+// content-defined chunks: boundaries fall where a rolling hash of the
+// content says, not at fixed offsets, so the chunks of a region that did
+// not change keep their CIDs when bytes before it change. A ceremony
+// contribution rewrites the pk's K and Z points but not its A and B ones,
+// and a prover syncing the new pk fetches only the chunks it lacks.
+
+// Chunk sizes: no cut before minChunk, one every 1<<chunkBits bytes on
+// average after it, a forced one at MaxSize.
+const (
+	minChunk  = 256 << 10
+	chunkBits = 19
+)
+
+// chunkMask takes the gear hash's top bits, which depend on the last 64
+// bytes; the low ones only on the last few.
+const chunkMask = (1<<chunkBits - 1) << (64 - chunkBits)
+
+// gear maps each byte to a fixed random word. It is part of the chunk
+// format: changing it moves every boundary.
+var gear = func() (t [256]uint64) {
+	for i := range t {
+		sum := sha256.Sum256([]byte{'d', 'd', 'm', 'c', 'd', 'c', byte(i)})
+		t[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return t
+}()
+
+// cut is the length of the chunk opening b, all of b when it is the end of
+// the stream and holds no boundary.
+func cut(b []byte) int {
+	if len(b) <= minChunk {
+		return len(b)
+	}
+	var h uint64
+	for i := minChunk; i < len(b); i++ {
+		h = h<<1 + gear[b[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+// Split cuts r into content-defined chunks of at most MaxSize bytes and
+// calls fn with each in order. The slice is only valid during the call.
+func Split(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, MaxSize)
+	n, eof := 0, false
+	for {
+		if !eof {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				eof = true
+			default:
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		c := cut(buf[:n])
+		if err := fn(buf[:c]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[c:n])
+	}
+}
+
+// Chunk is one chunk of an artifact.
+type Chunk struct {
+	CID  string `json:"cid"`
+	Size int    `json:"size"`
+}
+
+const ChunkIndexVersion = 1
+
+// ChunkIndex is a setup published in chunks: its manifest, and the chunks of
+// each of the manifest's files in order. It is published as one block
+// itself, its CID naming the whole setup.
+type ChunkIndex struct {
+	Version  int                `json:"version"`
+	Manifest artifacts.Manifest `json:"manifest"`
+	Files    map[string][]Chunk `json:"files"` // by manifest member, e.g. pk.groth16
+}
+
+var _ io.WriterTo = (*ChunkIndex)(nil)
+var _ io.ReaderFrom = (*ChunkIndex)(nil)
+
+func (x *ChunkIndex) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(x, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (x *ChunkIndex) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, x); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: chunk index: %w", errs.ErrInvalidInput, err)
+	}
+	if x.Version != ChunkIndexVersion {
+		return int64(len(data)), fmt.Errorf("%w: unsupported chunk index version %d", errs.ErrArtifactMismatch, x.Version)
+	}
+	for member := range x.Files {
+		if _, ok := x.Manifest.Files[member]; !ok {
+			return int64(len(data)), fmt.Errorf("%w: chunk index lists %s, its manifest does not", errs.ErrArtifactMismatch, member)
+		}
+	}
+	return int64(len(data)), nil
+}
+
+// PutChunks splits r, the artifact name, and puts every chunk into s. The
+// entry is r's size and hash, for the caller to check against the
+// manifest.
+func PutChunks(ctx context.Context, s Store, name string, r io.Reader) ([]Chunk, artifacts.FileEntry, error) {
+	var chunks []Chunk
+	h := ioutilx.NewHashWriter(nil)
+	err := Split(r, func(data []byte) error {
+		h.Write(data)
+		cid, err := s.Put(ctx, fmt.Sprintf("%s.%d", name, len(chunks)), data)
+		if err != nil {
+			return fmt.Errorf("publish %s chunk %d: %w", name, len(chunks), err)
+		}
+		if err := Verify(cid, data); err != nil {
+			return fmt.Errorf("publish %s chunk %d: store returned %s: %w", name, len(chunks), cid, err)
+		}
+		chunks = append(chunks, Chunk{CID: cid, Size: len(data)})
+		return nil
+	})
+	sum := h.Sum()
+	return chunks, artifacts.FileEntry{Size: h.N, SHA256: hex.EncodeToString(sum[:])}, err
+}
+
+// SyncStats is what Assemble took from where.
+type SyncStats struct {
+	Chunks  int   `json:"chunks"`
+	Reused  int   `json:"reused"`  // chunks found in the local copy
+	Fetched int64 `json:"fetched"` // bytes fetched from the store
+}
+
+// Assemble writes the artifact of chunks to w, taking every chunk the local
+// copy (nil for none) holds from it and fetching the others from g, each
+// checked against its CID. What was written must be want, the manifest's
+// entry for the artifact: on a mismatch the caller discards w.
+func Assemble(ctx context.Context, g Getter, chunks []Chunk, want artifacts.FileEntry, local io.ReaderAt, w io.Writer) (SyncStats, error) {
+	st := SyncStats{Chunks: len(chunks)}
+	have := make(map[string]int64) // chunk offsets in local
+	if local != nil {
+		var off int64
+		err := Split(io.NewSectionReader(local, 0, math.MaxInt64), func(data []byte) error {
+			have[CID(data)] = off
+			off += int64(len(data))
+			return nil
+		})
+		if err != nil {
+			return st, fmt.Errorf("local copy: %w", err)
+		}
+	}
+	out := ioutilx.NewHashWriter(w)
+	buf := make([]byte, MaxSize)
+	for i, c := range chunks {
+		if c.Size < 0 || c.Size > MaxSize {
+			return st, fmt.Errorf("%w: chunk %d is %d bytes", errs.ErrArtifactMismatch, i, c.Size)
+		}
+		var data []byte
+		if off, ok := have[c.CID]; ok {
+			data = buf[:c.Size]
+			if _, err := local.ReadAt(data, off); err != nil {
+				return st, fmt.Errorf("local copy: %w", err)
+			}
+			st.Reused++
+		} else {
+			var err error
+			if data, err = g.Get(ctx, c.CID); err != nil {
+				return st, fmt.Errorf("chunk %d (%s): %w", i, c.CID, err)
+			}
+			st.Fetched += int64(len(data))
+		}
+		if err := Verify(c.CID, data); err != nil {
+			return st, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if _, err := out.Write(data); err != nil {
+			return st, err
+		}
+	}
+	if sum := out.Sum(); out.N != want.Size || hex.EncodeToString(sum[:]) != want.SHA256 {
+		return st, fmt.Errorf("%w: assembled %d bytes hashing to %x, the manifest pins %d bytes hashing to %s", errs.ErrArtifactMismatch, out.N, sum, want.Size, want.SHA256)
+	}
+	return st, nil
+}
+
+// Mirror is a content-addressed directory (Dir) served over HTTP, e.g. a
+// static file server or a bucket synced from one: Get fetches <URL>/<cid>.
+type Mirror struct {
+	URL   string
+	HTTP  *http.Client // http.DefaultClient when nil
+	Retry retry.Policy
+}
+
+var _ Getter = (*Mirror)(nil)
+
+func (m *Mirror) Get(ctx context.Context, cid string) ([]byte, error) {
+	if strings.ContainsAny(cid, `/\?#`) {
+		return nil, fmt.Errorf("%w: cid %q", errs.ErrInvalidInput, cid)
+	}
+	return retry.Get(ctx, m.Retry, func(ctx context.Context) ([]byte, error) {
+		return m.get(ctx, cid)
+	})
+}
+
+func (m *Mirror) get(ctx context.Context, cid string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(m.URL, "/")+"/"+cid, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := m.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s/%s: %s", errs.ErrUnavailable, m.URL, cid, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+}
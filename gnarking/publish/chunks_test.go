@@ -0,0 +1,66 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gnarking/errs"
+)
+
+func TestChunks(t *testing.T) {
+	ctx := context.Background()
+	old := make([]byte, 6<<20)
+	rand.NewChaCha8([32]byte{1}).Read(old)
+	// a contribution rewrites a region in the middle
+	updated := bytes.Clone(old)
+	rand.NewChaCha8([32]byte{2}).Read(updated[3<<20 : 3<<20+200<<10])
+
+	dir := Dir(t.TempDir())
+	oldChunks, _, err := PutChunks(ctx, dir, "pk.groth16", bytes.NewReader(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, entry, err := PutChunks(ctx, dir, "pk.groth16", bytes.NewReader(updated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Size != int64(len(updated)) || len(chunks) < 6 {
+		t.Fatalf("%d chunks, entry %+v", len(chunks), entry)
+	}
+	for _, c := range chunks {
+		if c.Size > MaxSize {
+			t.Fatalf("chunk of %d bytes", c.Size)
+		}
+	}
+
+	mirror := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer mirror.Close()
+	var out bytes.Buffer
+	st, err := Assemble(ctx, &Mirror{URL: mirror.URL}, chunks, entry, bytes.NewReader(old), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), updated) {
+		t.Fatal("assembled artifact differs")
+	}
+	// only the chunks around the rewritten region are fetched
+	if st.Reused < len(oldChunks)-3 || st.Fetched > 3<<20/2 {
+		t.Fatalf("stats %+v of %d old chunks", st, len(oldChunks))
+	}
+
+	// without a local copy everything is fetched
+	out.Reset()
+	if st, err := Assemble(ctx, dir, chunks, entry, nil, &out); err != nil || st.Fetched != int64(len(updated)) {
+		t.Fatalf("fresh sync: %+v, %v", st, err)
+	}
+	// the result must be what the manifest pins
+	entry.SHA256 = CID(nil)
+	if _, err := Assemble(ctx, dir, chunks, entry, bytes.NewReader(old), &out); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("manifest mismatch: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package publish pins proof artifacts to content-addressed storage and
+// records where they went in a receipt, so third parties can fetch a batch's
+// proof, public inputs and row data by CID and check what they got.
+//
+// CIDs are CIDv1, raw codec, sha2-256, base32: the CID IPFS assigns a file
+// stored as a single raw block. Stores are asked for exactly that (IPFS adds
+// with raw leaves and a chunk size above MaxSize), so a CID can be checked
+// against the content without a node (Verify).
+//
+// A receipt can carry an RFC 3161 timestamp over its CIDs (Receipt.Stamp),
+// so the operator can later show the proof existed before a given time.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/timestamp"
+)
+
+// MaxSize is the largest file a single raw block holds (IPFS's chunker
+// limit); larger files would get a DAG CID Verify cannot check.
+const MaxSize = 1 << 20
+
+// Store is content-addressed storage: Put stores data and returns its CID.
+type Store interface {
+	Put(ctx context.Context, name string, data []byte) (cid string, err error)
+}
+
+// cidPrefix is CIDv1 (0x01), raw codec (0x55), sha2-256 (0x12) of 32 bytes.
+var cidPrefix = []byte{0x01, 0x55, 0x12, 0x20}
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CID is data's CIDv1 (raw, sha2-256) in multibase base32 ("b...").
+func CID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "b" + strings.ToLower(b32.EncodeToString(append(append([]byte{}, cidPrefix...), sum[:]...)))
+}
+
+// Verify checks that data is the content of cid.
+func Verify(cid string, data []byte) error {
+	if got := CID(data); got != cid {
+		return fmt.Errorf("%w: content hashes to %s, want %s", errs.ErrArtifactMismatch, got, cid)
+	}
+	return nil
+}
+
+// File is one artifact to publish.
+type File struct {
+	Name string // artifact name, e.g. proof_8.json
+	Data []byte
+}
+
+// Entry records where one artifact was published.
+type Entry struct {
+	Name string `json:"name"`
+	CID  string `json:"cid"`
+	Size int    `json:"size"`
+}
+
+const ReceiptVersion = 1
+
+// Receipt lists the CIDs of one batch's published artifacts.
+type Receipt struct {
+	Version     int       `json:"version"`
+	Profile     string    `json:"profile,omitempty"`
+	BatchID     string    `json:"batch_id"`           // hex circuit.BatchID
+	KeyPath     string    `json:"key_path,omitempty"` // keys.Path of the signing key under the operator's master seed
+	PublishedAt time.Time `json:"published_at"`
+	Files       []Entry   `json:"files"`
+	Escrow      *Escrow   `json:"escrow,omitempty"`
+	// Timestamp is an RFC 3161 token over Digest, when the publisher asked
+	// a TSA for one.
+	Timestamp *Timestamp `json:"timestamp,omitempty"`
+}
+
+// Escrow records a witness sealed to an arbiter (package escrow) that was
+// kept, not published: the hash binds the receipt to the file handed over
+// in a dispute.
+type Escrow struct {
+	Arbiter string `json:"arbiter"` // hex X25519 public key
+	SHA256  string `json:"sha256"`  // hex, of the sealed file
+	Size    int    `json:"size"`
+}
+
+// Timestamp is a trusted timestamp of a receipt: a TSA's signature that
+// the receipt's Digest, and so every CID it lists, existed at Time.
+type Timestamp struct {
+	TSA    string    `json:"tsa"`    // URL it was requested from
+	Time   time.Time `json:"time"`   // the token's genTime
+	Serial string    `json:"serial"` // the token's serial number, decimal
+	Token  []byte    `json:"token"`  // DER TimeStampToken, base64 in JSON
+}
+
+// Digest is what a receipt's timestamp covers: SHA-256 over one line per
+// field that identifies the published artifacts (the batch, every file's
+// name, CID and size, the escrowed witness's hash), in order. PublishedAt
+// and the timestamp itself are left out.
+func (r *Receipt) Digest() [32]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "ddm receipt v%d\nprofile %s\nbatch %s\nkey_path %s\n", r.Version, r.Profile, r.BatchID, r.KeyPath)
+	for _, e := range r.Files {
+		fmt.Fprintf(h, "file %q %s %d\n", e.Name, e.CID, e.Size)
+	}
+	if r.Escrow != nil {
+		fmt.Fprintf(h, "escrow %s %s %d\n", r.Escrow.Arbiter, r.Escrow.SHA256, r.Escrow.Size)
+	}
+	var d [32]byte
+	h.Sum(d[:0])
+	return d
+}
+
+// Stamp gets a timestamp of r from c and records it.
+func (r *Receipt) Stamp(ctx context.Context, c *timestamp.Client) error {
+	tok, err := c.Stamp(ctx, r.Digest())
+	if err != nil {
+		return fmt.Errorf("timestamp: %w", err)
+	}
+	r.Timestamp = &Timestamp{TSA: c.URL, Time: tok.Time.UTC(), Serial: tok.Serial.String(), Token: tok.DER}
+	return nil
+}
+
+// CheckTimestamp checks r's timestamp token covers r as it is now and
+// agrees with the time and serial recorded next to it; with roots, that its
+// signer chains to one of them (see timestamp.Token.Verify). A receipt
+// without a timestamp is errs.ErrNotFound.
+func (r *Receipt) CheckTimestamp(roots *x509.CertPool) (*timestamp.Token, error) {
+	if r.Timestamp == nil {
+		return nil, fmt.Errorf("%w: receipt has no timestamp", errs.ErrNotFound)
+	}
+	tok, err := timestamp.Parse(r.Timestamp.Token)
+	if err != nil {
+		return nil, err
+	}
+	if d := r.Digest(); tok.Digest != d {
+		return nil, fmt.Errorf("%w: timestamp covers %x, the receipt digests to %x: changed since it was stamped", errs.ErrVerificationFailed, tok.Digest, d)
+	}
+	if err := tok.Verify(r.Digest(), roots); err != nil {
+		return nil, err
+	}
+	if !tok.Time.Equal(r.Timestamp.Time) || tok.Serial.String() != r.Timestamp.Serial {
+		return nil, fmt.Errorf("%w: receipt records timestamp %s serial %s, the token says %s serial %s", errs.ErrVerificationFailed, r.Timestamp.Time, r.Timestamp.Serial, tok.Time, tok.Serial)
+	}
+	return tok, nil
+}
+
+// Publish puts every file into s and returns their entries in order. A
+// store answering with another CID than the content's is an error: the
+// receipt would point auditors at the wrong data.
+func Publish(ctx context.Context, s Store, files []File) ([]Entry, error) {
+	entries := make([]Entry, 0, len(files))
+	for _, f := range files {
+		if len(f.Data) > MaxSize {
+			return nil, fmt.Errorf("%w: %s is %d bytes, more than the %d a single block holds", errs.ErrInvalidInput, f.Name, len(f.Data), MaxSize)
+		}
+		cid, err := s.Put(ctx, f.Name, f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("publish %s: %w", f.Name, err)
+		}
+		if err := Verify(cid, f.Data); err != nil {
+			return nil, fmt.Errorf("publish %s: store returned %s: %w", f.Name, cid, err)
+		}
+		entries = append(entries, Entry{Name: f.Name, CID: cid, Size: len(f.Data)})
+	}
+	return entries, nil
+}
+
+var _ io.WriterTo = (*Receipt)(nil)
+var _ io.ReaderFrom = (*Receipt)(nil)
+
+func (r *Receipt) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (r *Receipt) ReadFrom(rd io.Reader) (int64, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: receipt: %w", errs.ErrInvalidInput, err)
+	}
+	if r.Version != ReceiptVersion {
+		return int64(len(data)), fmt.Errorf("%w: unsupported receipt version %d", errs.ErrArtifactMismatch, r.Version)
+	}
+	return int64(len(data)), nil
+}
+
+// Entry returns the entry published under name.
+func (r *Receipt) Entry(name string) (Entry, bool) {
+	for _, e := range r.Files {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
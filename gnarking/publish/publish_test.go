@@ -0,0 +1,151 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+func TestCID(t *testing.T) {
+	// what `ipfs add --cid-version=1 --raw-leaves` prints for an empty file
+	if got, want := CID(nil), "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"; got != want {
+		t.Fatalf("CID(empty) = %s, want %s", got, want)
+	}
+	if err := Verify(CID([]byte("a")), []byte("b")); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+// kubo fakes the two Kubo RPC commands IPFS uses.
+func kubo(t *testing.T, lie bool) *httptest.Server {
+	var (
+		mu     sync.Mutex
+		blocks = map[string][]byte{}
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("raw-leaves") != "true" || q.Get("cid-version") != "1" || q.Get("pin") != "true" {
+			t.Errorf("add query %s", r.URL.RawQuery)
+		}
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		cid := CID(data)
+		if lie {
+			cid = CID(append(data, '!'))
+		}
+		mu.Lock()
+		blocks[cid] = data
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"Name": hdr.Filename, "Hash": cid, "Size": len(data)})
+	})
+	mux.HandleFunc("POST /api/v0/cat", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		data, ok := blocks[r.URL.Query().Get("arg")]
+		mu.Unlock()
+		if !ok {
+			http.Error(w, `{"Message":"block not found"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	files := []File{
+		{Name: "proof_8.json", Data: []byte(`["0x01","0x02"]`)},
+		{Name: "public_sol_8.json", Data: []byte(`["0x2a"]`)},
+		{Name: "batch_8.json", Data: bytes.Repeat([]byte("row "), 1000)},
+	}
+
+	node := &IPFS{API: kubo(t, false).URL}
+	dir := Dir(t.TempDir())
+	for _, s := range []interface {
+		Store
+		Getter
+	}{node, dir} {
+		entries, err := Publish(ctx, s, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := Receipt{Version: ReceiptVersion, Files: entries}
+		if err := Audit(ctx, s, &r); err != nil {
+			t.Fatalf("%T: %v", s, err)
+		}
+		var buf bytes.Buffer
+		r.WriteTo(&buf)
+		var back Receipt
+		if _, err := back.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := back.Entry("batch_8.json"); !ok || e.CID != CID(files[2].Data) || e.Size != 4000 {
+			t.Fatalf("batch entry %+v", e)
+		}
+	}
+
+	// a node answering with someone else's CID
+	if _, err := Publish(ctx, &IPFS{API: kubo(t, true).URL}, files); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("lying node: %v", err)
+	}
+
+	// tampered mirror fails the audit
+	cid := CID(files[0].Data)
+	if err := os.WriteFile(filepath.Join(string(dir), cid), []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := Receipt{Version: ReceiptVersion, Files: []Entry{{Name: files[0].Name, CID: cid}}}
+	if err := Audit(ctx, dir, &r); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("tampered mirror: %v", err)
+	}
+	// and so does a missing one
+	r.Files[0].CID = CID([]byte("never published"))
+	if err := Audit(ctx, node, &r); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("missing block: %v", err)
+	}
+}
+
+func TestReceiptDigest(t *testing.T) {
+	r := Receipt{Version: ReceiptVersion, Profile: "8", BatchID: "ab", Files: []Entry{{Name: "proof_8.json", CID: CID([]byte("p")), Size: 1}}}
+	d := r.Digest()
+	// when it was written and its own timestamp are not part of it
+	r.PublishedAt = time.Now()
+	r.Timestamp = &Timestamp{TSA: "http://tsa"}
+	if r.Digest() != d {
+		t.Fatal("digest covers PublishedAt or Timestamp")
+	}
+	for _, change := range []func(r *Receipt){
+		func(r *Receipt) { r.BatchID = "ac" },
+		func(r *Receipt) { r.Files[0].CID = CID([]byte("q")) },
+		func(r *Receipt) { r.Files[0].Name = "proof_64.json" },
+		func(r *Receipt) { r.Files = append(r.Files, Entry{Name: "batch_8.json"}) },
+		func(r *Receipt) { r.Escrow = &Escrow{SHA256: "00"} },
+	} {
+		c := r
+		c.Files = append([]Entry{}, r.Files...)
+		change(&c)
+		if c.Digest() == d {
+			t.Errorf("digest unchanged by %+v", c)
+		}
+	}
+	if _, err := (&Receipt{}).CheckTimestamp(nil); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("no timestamp: %v, want ErrNotFound", err)
+	}
+}
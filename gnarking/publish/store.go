@@ -0,0 +1,150 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gnarking/artifacts"
+	"gnarking/errs"
+	"gnarking/retry"
+)
+
+// Getter fetches content by CID, for audits.
+type Getter interface {
+	Get(ctx context.Context, cid string) ([]byte, error)
+}
+
+// Audit fetches every file of r from g and checks it against its CID: the
+// data availability check a third party runs on a receipt.
+func Audit(ctx context.Context, g Getter, r *Receipt) error {
+	for _, e := range r.Files {
+		data, err := g.Get(ctx, e.CID)
+		if err != nil {
+			return fmt.Errorf("%s (%s): %w", e.Name, e.CID, err)
+		}
+		if err := Verify(e.CID, data); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// IPFS is a Kubo node's RPC API, e.g. http://127.0.0.1:5001. Put adds and
+// pins.
+type IPFS struct {
+	API   string
+	HTTP  *http.Client // http.DefaultClient when nil
+	Retry retry.Policy // applied to Put and Get; adding the same data twice pins one CID
+}
+
+var _ Store = (*IPFS)(nil)
+var _ Getter = (*IPFS)(nil)
+
+func (n *IPFS) Put(ctx context.Context, name string, data []byte) (string, error) {
+	return retry.Get(ctx, n.Retry, func(ctx context.Context) (string, error) {
+		return n.put(ctx, name, data)
+	})
+}
+
+func (n *IPFS) put(ctx context.Context, name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	// one raw block per file, so the CID is CID(data)
+	q := url.Values{"pin": {"true"}, "cid-version": {"1"}, "raw-leaves": {"true"}, "chunker": {fmt.Sprintf("size-%d", MaxSize)}}
+	resp, err := n.call(ctx, "add", q, &body, mw.FormDataContentType())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var added struct{ Hash string }
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return "", fmt.Errorf("%w: %s add: %w", errs.ErrUnavailable, n.API, err)
+	}
+	return added.Hash, nil
+}
+
+func (n *IPFS) Get(ctx context.Context, cid string) ([]byte, error) {
+	return retry.Get(ctx, n.Retry, func(ctx context.Context) ([]byte, error) {
+		return n.get(ctx, cid)
+	})
+}
+
+func (n *IPFS) get(ctx context.Context, cid string) ([]byte, error) {
+	resp, err := n.call(ctx, "cat", url.Values{"arg": {cid}}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+}
+
+// call POSTs to /api/v0/<cmd>, as Kubo requires for every command.
+func (n *IPFS) call(ctx context.Context, cmd string, q url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	endpoint := strings.TrimSuffix(n.API, "/") + "/api/v0/" + cmd + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	client := n.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s %s: %s: %s", errs.ErrUnavailable, n.API, cmd, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// Dir is a content-addressed directory: each file is stored as <dir>/<cid>.
+// Any static file server or bucket synced from it serves the same CIDs.
+type Dir string
+
+var _ Store = Dir("")
+var _ Getter = Dir("")
+
+func (d Dir) Put(_ context.Context, _ string, data []byte) (string, error) {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return "", err
+	}
+	cid := CID(data)
+	err := artifacts.WriteFile(filepath.Join(string(d), cid), bytes.NewReader(data), false)
+	return cid, err
+}
+
+func (d Dir) Get(_ context.Context, cid string) ([]byte, error) {
+	if strings.ContainsAny(cid, `/\`) {
+		return nil, fmt.Errorf("%w: cid %q", errs.ErrInvalidInput, cid)
+	}
+	data, err := os.ReadFile(filepath.Join(string(d), cid))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s not in %s", errs.ErrUnavailable, cid, d)
+	}
+	return data, err
+}
@@ -0,0 +1,237 @@
+// Package redact exports a proven batch's row data with some rows withheld,
+// for publication where compliance forbids publishing every row.
+//
+// It needs a profile whose BatchDataRoot is a circuit.DataHashMiMCTree: a
+// redacted row is replaced by its leaf, circuit.DataLeaf(size, nonce), so
+// anyone holding the redacted file recomputes the proven root from the
+// clear rows and the leaves alone (Check) and learns that the clear rows
+// are rows of the proven batch, at their positions. A leaf is an unsalted
+// hash of two 64-bit values: it hides a row only as far as its size and
+// nonce are hard to guess, and the nonce of a monotonic batch rarely is.
+// Signatures of redacted rows are withheld with them.
+package redact
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+)
+
+const Version = 1
+
+// Batch is the redacted export of a proven batch, its rows in the order the
+// root is over: as proven, sorted by nonce for circuit.OrderingPermuted.
+type Batch struct {
+	Version       int    `json:"version"`
+	Profile       string `json:"profile"`
+	BatchID       string `json:"batch_id"`        // hex, circuit.BatchID of the proven public inputs
+	BatchDataRoot string `json:"batch_data_root"` // hex, the proven root
+	Rows          []Row  `json:"rows"`
+}
+
+// Row is a row in clear, or Leaf alone when it is redacted.
+type Row struct {
+	*server.ProveRow        // nil when redacted
+	Leaf             string `json:"leaf,omitempty"` // hex, circuit.DataLeaf of the redacted row
+}
+
+// Redacted reports whether r is withheld.
+func (r Row) Redacted() bool { return r.ProveRow == nil }
+
+// Redact exports req, which must be the batch proven with pub under
+// profile, with the rows at the indices in redacted (batch order, as in
+// req.Rows) replaced by their leaves.
+func Redact(profile circuit.Profile, pub circuit.SettlementCircuitPublic, req *server.ProveRequest, redacted []int) (*Batch, error) {
+	if err := checkProfile(profile); err != nil {
+		return nil, err
+	}
+	for _, i := range redacted {
+		if i < 0 || i >= len(req.Rows) {
+			return nil, fmt.Errorf("%w: row %d to redact, the batch has %d", errs.ErrInvalidInput, i, len(req.Rows))
+		}
+	}
+	batchPub, err := server.BatchPublic(profile, req)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := circuit.DiffPublic(batchPub, pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(diff) > 0 {
+		return nil, fmt.Errorf("%w: the batch is not the proven one: %s differ", errs.ErrArtifactMismatch, strings.Join(diff, ", "))
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return nil, err
+	}
+	root, err := field(pub.BatchDataRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(req.Rows))
+	for i := range order {
+		order[i] = i
+	}
+	if profile.Ordering == circuit.OrderingPermuted {
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmpUint64(req.Rows[a].Nonce, req.Rows[b].Nonce)
+		})
+	}
+	b := &Batch{
+		Version:       Version,
+		Profile:       profile.Name,
+		BatchID:       hex.EncodeToString(id[:]),
+		BatchDataRoot: hex.EncodeToString(root.Bytes()),
+		Rows:          make([]Row, len(order)),
+	}
+	for k, i := range order {
+		row := req.Rows[i]
+		if slices.Contains(redacted, i) {
+			b.Rows[k].Leaf = hex.EncodeToString(leaf(row).Bytes())
+			continue
+		}
+		b.Rows[k].ProveRow = &row
+	}
+	return b, nil
+}
+
+// Check recomputes b's root from its clear rows and leaves and fails with
+// errs.ErrArtifactMismatch unless it is the root proven with pub, and b
+// names pub's batch.
+func Check(profile circuit.Profile, pub circuit.SettlementCircuitPublic, b *Batch) error {
+	if err := checkProfile(profile); err != nil {
+		return err
+	}
+	if b.Version != Version {
+		return fmt.Errorf("%w: unsupported redacted batch version %d", errs.ErrArtifactMismatch, b.Version)
+	}
+	if b.Profile != profile.Name {
+		return fmt.Errorf("%w: redacted batch of profile %q, want %q", errs.ErrArtifactMismatch, b.Profile, profile.Name)
+	}
+	if len(b.Rows) != profile.N {
+		return fmt.Errorf("%w: %d rows, profile %s has %d", errs.ErrArtifactMismatch, len(b.Rows), profile.Name, profile.N)
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimPrefix(b.BatchID, "0x"), hex.EncodeToString(id[:])) {
+		return fmt.Errorf("%w: redacted batch %s, the proof is of %x", errs.ErrArtifactMismatch, b.BatchID, id)
+	}
+	proven, err := field(pub.BatchDataRoot)
+	if err != nil {
+		return err
+	}
+	leaves, err := b.leaves()
+	if err != nil {
+		return err
+	}
+	root, err := circuit.DataTreeRoot(leaves)
+	if err != nil {
+		return err
+	}
+	if root.Cmp(proven) != 0 {
+		return fmt.Errorf("%w: rows and leaves give root %x, the proven root is %x", errs.ErrArtifactMismatch, root, proven)
+	}
+	return nil
+}
+
+// Redacted is the positions of b's withheld rows, in root order.
+func (b *Batch) Redacted() []int {
+	var out []int
+	for i, r := range b.Rows {
+		if r.Redacted() {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// leaves is every row's leaf, recomputed for the clear ones.
+func (b *Batch) leaves() ([]*big.Int, error) {
+	leaves := make([]*big.Int, len(b.Rows))
+	for i, r := range b.Rows {
+		switch {
+		case r.Redacted():
+			l, ok := new(big.Int).SetString(strings.TrimPrefix(r.Leaf, "0x"), 16)
+			if !ok || l.Cmp(ecc.BN254.ScalarField()) >= 0 {
+				return nil, fmt.Errorf("%w: row %d: leaf %q is not a field element in hex", errs.ErrInvalidInput, i, r.Leaf)
+			}
+			leaves[i] = l
+		case r.Leaf != "":
+			return nil, fmt.Errorf("%w: row %d is both in clear and a leaf", errs.ErrInvalidInput, i)
+		default:
+			leaves[i] = leaf(*r.ProveRow)
+		}
+	}
+	return leaves, nil
+}
+
+func leaf(row server.ProveRow) *big.Int {
+	return circuit.DataLeaf(new(big.Int).SetUint64(row.Size), new(big.Int).SetUint64(row.Nonce))
+}
+
+func checkProfile(profile circuit.Profile) error {
+	if profile.DataHash != circuit.DataHashMiMCTree {
+		return fmt.Errorf("%w: profile %s roots its rows with %s, a hash chain no leaf stands in for; redaction needs data hash %s",
+			errs.ErrInvalidInput, profile.Name, profile.DataHash, circuit.DataHashMiMCTree)
+	}
+	return nil
+}
+
+func cmpUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func field(v any) (*big.Int, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case []byte:
+		return new(big.Int).SetBytes(v), nil
+	}
+	return nil, fmt.Errorf("%w: unexpected public input type %T", errs.ErrInvalidInput, v)
+}
+
+var _ io.WriterTo = (*Batch)(nil)
+var _ io.ReaderFrom = (*Batch)(nil)
+
+func (b *Batch) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+func (b *Batch) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: redacted batch: %w", errs.ErrInvalidInput, err)
+	}
+	return int64(len(data)), nil
+}
@@ -0,0 +1,105 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/keys"
+	"gnarking/server"
+)
+
+// batch is a signed 5-row batch of a mimc-tree profile, nonces out of order,
+// and its public inputs.
+func batch(t *testing.T, o circuit.Ordering) (circuit.Profile, circuit.SettlementCircuitPublic, *server.ProveRequest) {
+	t.Helper()
+	profile := circuit.Profile{Name: "tree-5", N: 5, DataHash: circuit.DataHashMiMCTree, Ordering: o}
+	operator, err := keys.Derive(keys.Seed{1}, keys.Path{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &server.ProveRequest{Recipient: "2a", ChainID: 1, Pk: hex.EncodeToString(operator.PublicKey.Bytes())}
+	for i, nonce := range []uint64{3, 1, 5, 2, 4} {
+		if o == circuit.OrderingMonotonic {
+			nonce = uint64(i + 1)
+		}
+		size := uint64(10*i + 1)
+		msg := circuit.MsgHash(profile.Msg, big.NewInt(42), new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(1))
+		sig, err := circuit.EdDSA{}.Sign(operator, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Rows = append(req.Rows, server.ProveRow{Size: size, Nonce: nonce, Sig: hex.EncodeToString(sig)})
+	}
+	pub, err := server.BatchPublic(profile, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile, pub, req
+}
+
+func TestRedact(t *testing.T) {
+	for _, o := range []circuit.Ordering{circuit.OrderingMonotonic, circuit.OrderingPermuted} {
+		profile, pub, req := batch(t, o)
+		b, err := Redact(profile, pub, req, []int{0, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		b.WriteTo(&buf)
+		if bytes.Contains(buf.Bytes(), []byte(req.Rows[0].Sig)) {
+			t.Fatalf("%s: a redacted row's signature is published", o)
+		}
+		var read Batch
+		if _, err := read.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := Check(profile, pub, &read); err != nil {
+			t.Fatalf("%s: %v", o, err)
+		}
+		// rows are in root order: batch order, or by nonce when permuted
+		want := []int{0, 3}
+		if o == circuit.OrderingPermuted {
+			want = []int{1, 2} // nonces 3 and 2
+		}
+		if got := read.Redacted(); !slices.Equal(got, want) {
+			t.Fatalf("%s: redacted %v, want %v", o, got, want)
+		}
+
+		// a clear row changed, or a leaf swapped for another row's
+		changed := read
+		changed.Rows = slices.Clone(read.Rows)
+		row := *read.Rows[4].ProveRow
+		row.Size++
+		changed.Rows[4].ProveRow = &row
+		if err := Check(profile, pub, &changed); !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s: changed row: %v", o, err)
+		}
+		changed.Rows = slices.Clone(read.Rows)
+		changed.Rows[want[0]].Leaf = read.Rows[want[1]].Leaf
+		if err := Check(profile, pub, &changed); !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s: swapped leaf: %v", o, err)
+		}
+	}
+
+	profile, pub, req := batch(t, circuit.OrderingMonotonic)
+	if _, err := Redact(profile, pub, req, []int{5}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("row out of range: %v", err)
+	}
+	other := *req
+	other.Rows = slices.Clone(req.Rows)
+	other.Rows[0].Size++
+	if _, err := Redact(profile, pub, &other, nil); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Errorf("not the proven batch: %v", err)
+	}
+	chain := profile
+	chain.DataHash = circuit.DataHashMiMC
+	if _, err := Redact(chain, pub, req, []int{0}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("hash chain root: %v", err)
+	}
+}
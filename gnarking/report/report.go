@@ -0,0 +1,460 @@
+// Package report computes the economics and compression figures of a proof.
+// Reports are plain JSON-serializable structs; String renders the text form.
+package report
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"gnarking/ioutilx"
+)
+
+const (
+	CPUPricePerHour = 0.05  // $/core-hour
+	MinTxUSD        = 0.005 // $ per smallest tx
+	hoursPerDay     = 24
+	daysPerYear     = 365
+)
+
+// Economics is the cost of one proof against the value it settles.
+type Economics struct {
+	N               int           `json:"n"`
+	Cores           int           `json:"cores"`
+	ProveTime       time.Duration `json:"prove_time_ns"`
+	CPUSeconds      float64       `json:"cpu_seconds"`
+	CPUPricePerHour float64       `json:"cpu_price_per_hour"`
+	CostPerProof    float64       `json:"cost_per_proof_usd"`
+	MinTxUSD        float64       `json:"min_tx_usd"`
+	BatchValue      float64       `json:"batch_value_usd"`
+	PercentCost     float64       `json:"percent_cost"`
+	USDPerHour      float64       `json:"usd_per_hour"`
+	USDPerDay       float64       `json:"usd_per_day"`
+	USDPerYear      float64       `json:"usd_per_year"`
+}
+
+func NewEconomics(n int, proveTime time.Duration, cores int) Economics {
+	proveSeconds := proveTime.Seconds()
+	e := Economics{
+		N:               n,
+		Cores:           cores,
+		ProveTime:       proveTime,
+		CPUSeconds:      proveSeconds * float64(cores),
+		CPUPricePerHour: CPUPricePerHour,
+		MinTxUSD:        MinTxUSD,
+	}
+
+	// cost per proof in $
+	e.CostPerProof = float64(cores) * CPUPricePerHour * (proveSeconds / 3600.0)
+
+	// value secured per proof
+	e.BatchValue = float64(n) * MinTxUSD
+
+	// percentage cost vs value
+	e.PercentCost = (e.CostPerProof / e.BatchValue) * 100
+
+	// throughput at full blast
+	proofsPerHour := 3600.0 / proveSeconds
+	e.USDPerHour = e.BatchValue * proofsPerHour
+	e.USDPerDay = e.USDPerHour * hoursPerDay
+	e.USDPerYear = e.USDPerDay * daysPerYear
+	return e
+}
+
+func (e Economics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Economics report (N = %d, cores = %d) ===\n", e.N, e.Cores)
+	fmt.Fprintf(&b, "Prove time: %s, cores: %d → CPU-seconds: %.2f\n", e.ProveTime, e.Cores, e.CPUSeconds)
+	fmt.Fprintf(&b, "CPU price: $%.4f / core-hour → cost per proof: $%.6f\n", e.CPUPricePerHour, e.CostPerProof)
+	fmt.Fprintf(&b, "Batch value (min tx $%.4f): $%.4f\n", e.MinTxUSD, e.BatchValue)
+	fmt.Fprintf(&b, "Proof cost / batch value: %.2f%%\n", e.PercentCost)
+	fmt.Fprintf(&b, "Throughput at full load: $%.2f /h, $%.2f /day, $%.0f /year\n",
+		e.USDPerHour, e.USDPerDay, e.USDPerYear)
+	return b.String()
+}
+
+// Compression compares a proof with the naive per-tx calldata it replaces.
+type Compression struct {
+	N                 int     `json:"n"`
+	FieldElementBytes int     `json:"field_element_bytes"`
+	PreimageFields    int     `json:"preimage_fields"`
+	SignatureBytes    int     `json:"signature_bytes"`
+	PerTxBytes        int     `json:"per_tx_bytes"`
+	NaiveBytes        int64   `json:"naive_bytes"`
+	ProofBytes        int64   `json:"proof_bytes"`
+	Ratio             float64 `json:"ratio"`
+}
+
+// NewCompression takes the serialized Groth16 proof size (from proof.WriteTo).
+func NewCompression(n int, proofBytes int64) Compression {
+	feBytes := len(ecc.BN254.ScalarField().Bytes()) // 32 bytes on BN254
+
+	c := Compression{
+		N:                 n,
+		FieldElementBytes: feBytes,
+		PreimageFields:    4,           // Recipient, Size, Nonce, ChainID
+		SignatureBytes:    3 * feBytes, // R.X, R.Y, S
+		ProofBytes:        proofBytes,
+	}
+	c.PerTxBytes = c.PreimageFields*feBytes + c.SignatureBytes
+	c.NaiveBytes = int64(n) * int64(c.PerTxBytes)
+	c.Ratio = float64(c.NaiveBytes) / float64(proofBytes)
+	return c
+}
+
+func (c Compression) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Compression report (N = %d) ===\n", c.N)
+	fmt.Fprintf(&b, "Field element size: %d bytes (BN254 scalar field)\n", c.FieldElementBytes)
+	fmt.Fprintf(&b, "Per-tx naive payload (Recipient, Size, Nonce, ChainID, Signature):\n")
+	fmt.Fprintf(&b, "  preimage fields: %d × %d B = %d B\n", c.PreimageFields, c.FieldElementBytes, c.PreimageFields*c.FieldElementBytes)
+	fmt.Fprintf(&b, "  signature: %d B\n", c.SignatureBytes)
+	fmt.Fprintf(&b, "  → total per tx: %d bytes\n", c.PerTxBytes)
+	fmt.Fprintf(&b, "Total naive calldata for %d txs: %d bytes\n", c.N, c.NaiveBytes)
+	fmt.Fprintf(&b, "Groth16 proof size: %d bytes\n", c.ProofBytes)
+	fmt.Fprintf(&b, "Calldata/proof ratio: %.2fx\n", c.Ratio)
+	return b.String()
+}
+
+// Bench compares proving a run of batches one at a time with proving them
+// through the pipeline (prover.Pipeline), where a batch's witness solving
+// overlaps the previous batch's MSMs.
+type Bench struct {
+	N                 int           `json:"n"`
+	Batches           int           `json:"batches"`
+	Depth             int           `json:"depth"`
+	Sequential        time.Duration `json:"sequential_ns"`
+	Pipelined         time.Duration `json:"pipelined_ns"`
+	SequentialPerHour float64       `json:"sequential_proofs_per_hour"`
+	PipelinedPerHour  float64       `json:"pipelined_proofs_per_hour"`
+	OverlapGain       float64       `json:"overlap_gain"` // sequential / pipelined wall time
+}
+
+func NewBench(n, batches, depth int, sequential, pipelined time.Duration) Bench {
+	b := Bench{
+		N:          n,
+		Batches:    batches,
+		Depth:      depth,
+		Sequential: sequential,
+		Pipelined:  pipelined,
+	}
+	b.SequentialPerHour = float64(batches) * 3600 / sequential.Seconds()
+	b.PipelinedPerHour = float64(batches) * 3600 / pipelined.Seconds()
+	b.OverlapGain = sequential.Seconds() / pipelined.Seconds()
+	return b
+}
+
+func (b Bench) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "\n=== Bench report (N = %d, %d batches) ===\n", b.N, b.Batches)
+	fmt.Fprintf(&s, "Sequential: %s (%s / proof) → %.0f proofs/h\n",
+		b.Sequential, b.Sequential/time.Duration(b.Batches), b.SequentialPerHour)
+	fmt.Fprintf(&s, "Pipelined (depth %d): %s (%s / proof) → %.0f proofs/h\n",
+		b.Depth, b.Pipelined, b.Pipelined/time.Duration(b.Batches), b.PipelinedPerHour)
+	fmt.Fprintf(&s, "Overlap gain: %.2fx\n", b.OverlapGain)
+	return s.String()
+}
+
+// Simulation is an estimate of proving and settling one batch, made without
+// proving (see package estimate). The caller fills in the circuit and host
+// figures, NewSimulation derives the costs.
+type Simulation struct {
+	N                 int           `json:"n"`
+	Rows              int           `json:"rows"` // transactions carried, <= N
+	Cores             int           `json:"cores"`
+	Constraints       int           `json:"constraints"`
+	ConstraintsPerRow float64       `json:"constraints_per_row"`
+	Wires             int           `json:"wires"`
+	MSMSize           int           `json:"msm_bench_size"`
+	G1PerPoint        time.Duration `json:"g1_msm_per_point_ns"`
+	G2PerPoint        time.Duration `json:"g2_msm_per_point_ns"`
+	ProveTime         time.Duration `json:"prove_time_ns"`
+	PeakMemory        uint64        `json:"peak_memory_bytes"`
+	ProofBytes        int64         `json:"proof_bytes"` // framed proof file
+	VerifyGas         int           `json:"verify_gas"`
+	GasPriceGwei      float64       `json:"gas_price_gwei"`
+	ETHUSD            float64       `json:"eth_usd"`
+
+	Economics   Economics `json:"economics"` // over Rows transactions
+	VerifyUSD   float64   `json:"verify_usd"`
+	CostPerTx   float64   `json:"cost_per_tx_usd"` // (proof + verify) / Rows
+	PercentCost float64   `json:"percent_cost"`    // of the Rows' minimum value
+}
+
+func NewSimulation(s Simulation) Simulation {
+	s.Economics = NewEconomics(s.Rows, s.ProveTime, s.Cores)
+	s.VerifyUSD = float64(s.VerifyGas) * s.GasPriceGwei * 1e-9 * s.ETHUSD
+	s.CostPerTx = (s.Economics.CostPerProof + s.VerifyUSD) / float64(s.Rows)
+	s.PercentCost = s.CostPerTx / MinTxUSD * 100
+	return s
+}
+
+func (s Simulation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Simulation (N = %d, %d rows, cores = %d) ===\n", s.N, s.Rows, s.Cores)
+	fmt.Fprintf(&b, "Constraints: %d (%.0f per row), wires: %d\n", s.Constraints, s.ConstraintsPerRow, s.Wires)
+	fmt.Fprintf(&b, "MSM on this host (%d points): G1 %s / point, G2 %s / point\n", s.MSMSize, s.G1PerPoint, s.G2PerPoint)
+	fmt.Fprintf(&b, "Prove time: ~%s, peak memory: ~%s\n", s.ProveTime.Round(time.Millisecond), ioutilx.Size(int64(s.PeakMemory)))
+	fmt.Fprintf(&b, "Proof size: %d bytes (framed)\n", s.ProofBytes)
+	fmt.Fprintf(&b, "On-chain verify: ~%d gas at %g gwei, ETH $%.0f → $%.6f\n", s.VerifyGas, s.GasPriceGwei, s.ETHUSD, s.VerifyUSD)
+	fmt.Fprintf(&b, "Proving: $%.6f / proof\n", s.Economics.CostPerProof)
+	fmt.Fprintf(&b, "Cost per tx: $%.8f (%.2f%% of a $%.4f tx)\n", s.CostPerTx, s.PercentCost, MinTxUSD)
+	return b.String()
+}
+
+// Migration maps batches proven under one circuit version to their proofs
+// under another (ddm migrate): the old and new batch ID of each, the public
+// inputs that changed, and where the new proof went.
+type Migration struct {
+	Profile string          `json:"profile"`
+	From    CircuitVersion  `json:"from"`
+	To      CircuitVersion  `json:"to"`
+	DryRun  bool            `json:"dry_run,omitempty"` // public inputs only, nothing proven
+	Batches []MigratedBatch `json:"batches"`
+}
+
+// CircuitVersion is what a setup manifest says a circuit was compiled as.
+type CircuitVersion struct {
+	CircuitHash string `json:"circuit_hash"` // hex sha256 of the ccs
+	DataHash    string `json:"data_hash"`
+	Ordering    string `json:"ordering"`
+	Msg         string `json:"msg"`
+}
+
+// MigratedBatch is one archived batch. Error is set, and the proof fields
+// empty, when it could not be re-proven.
+type MigratedBatch struct {
+	Batch      string   `json:"batch"` // archived batch file
+	OldBatchID string   `json:"old_batch_id,omitempty"`
+	NewBatchID string   `json:"new_batch_id,omitempty"`
+	Changed    []string `json:"changed,omitempty"` // public inputs that differ between the versions
+	Proof      string   `json:"proof,omitempty"`
+	Public     string   `json:"public,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Failed is the number of batches not migrated.
+func (m Migration) Failed() int {
+	n := 0
+	for _, b := range m.Batches {
+		if b.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (m Migration) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Migration (%s, %d batches) ===\n", m.Profile, len(m.Batches))
+	fmt.Fprintf(&b, "From: circuit %.16s (%s, %s, %s)\n", m.From.CircuitHash, m.From.DataHash, m.From.Ordering, m.From.Msg)
+	fmt.Fprintf(&b, "To:   circuit %.16s (%s, %s, %s)\n", m.To.CircuitHash, m.To.DataHash, m.To.Ordering, m.To.Msg)
+	for _, mb := range m.Batches {
+		if mb.Error != "" {
+			fmt.Fprintf(&b, "%s: FAILED: %s\n", mb.Batch, mb.Error)
+			continue
+		}
+		if len(mb.Changed) == 0 {
+			fmt.Fprintf(&b, "%s: %.16s, public inputs unchanged", mb.Batch, mb.OldBatchID)
+		} else {
+			fmt.Fprintf(&b, "%s: %.16s → %.16s (%s changed)", mb.Batch, mb.OldBatchID, mb.NewBatchID, strings.Join(mb.Changed, ", "))
+		}
+		if mb.Proof != "" {
+			fmt.Fprintf(&b, ", proof %s", mb.Proof)
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "Migrated: %d, failed: %d\n", len(m.Batches)-m.Failed(), m.Failed())
+	return b.String()
+}
+
+// Reconciliation matches a settlement contract's BatchSettled events against
+// the batches proven locally (cmd/reconcile), by batch ID. Unsubmitted and
+// Unproven are the orphans an operator has to look at.
+type Reconciliation struct {
+	Contract  string            `json:"contract"`
+	FromBlock uint64            `json:"from_block"`
+	ToBlock   uint64            `json:"to_block"`
+	Time      time.Time         `json:"time"`
+	Settled   int               `json:"settled"` // events in the range
+	Local     int               `json:"local"`   // batches found locally
+	Matched   []ReconciledBatch `json:"matched,omitempty"`
+	// proven locally, no event: the proof was never submitted, failed, or
+	// settled outside the range
+	Unsubmitted []ReconciledBatch `json:"unsubmitted,omitempty"`
+	// as Unsubmitted, but proven within the grace period: likely in flight
+	Pending []ReconciledBatch `json:"pending,omitempty"`
+	// settled on-chain, no local proof or receipt: proven elsewhere, or the
+	// artifacts are lost
+	Unproven []ReconciledBatch `json:"unproven,omitempty"`
+}
+
+// ReconciledBatch is one batch ID with what is known of it on each side.
+type ReconciledBatch struct {
+	BatchID  string    `json:"batch_id"`
+	Proof    string    `json:"proof,omitempty"`   // local proof file
+	Receipt  string    `json:"receipt,omitempty"` // local publish receipt
+	ProvedAt time.Time `json:"proved_at,omitzero"`
+	Expired  bool      `json:"expired,omitempty"` // past the proof's MaxAge, no longer submittable
+	// from the event
+	Recipient string `json:"recipient,omitempty"` // hex
+	M         string `json:"m,omitempty"`
+	Block     uint64 `json:"block,omitempty"`
+	TxHash    string `json:"tx_hash,omitempty"`
+}
+
+// Orphans is the number of batches on one side only, pending ones aside.
+func (r Reconciliation) Orphans() int { return len(r.Unsubmitted) + len(r.Unproven) }
+
+func (r Reconciliation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Reconciliation (%s, blocks %d-%d) ===\n", r.Contract, r.FromBlock, r.ToBlock)
+	fmt.Fprintf(&b, "Settled on-chain: %d, proven locally: %d, matched: %d\n", r.Settled, r.Local, len(r.Matched))
+	for _, s := range []struct {
+		title   string
+		batches []ReconciledBatch
+	}{
+		{"Proven, not submitted", r.Unsubmitted},
+		{"Proven, pending submission", r.Pending},
+		{"Settled, not proven locally", r.Unproven},
+	} {
+		if len(s.batches) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s (%d):\n", s.title, len(s.batches))
+		for _, rb := range s.batches {
+			fmt.Fprintf(&b, "  %.16s", rb.BatchID)
+			if rb.Proof != "" {
+				fmt.Fprintf(&b, " proof %s, proven %s", rb.Proof, rb.ProvedAt.Format(time.RFC3339))
+			} else if rb.Receipt != "" {
+				fmt.Fprintf(&b, " receipt %s", rb.Receipt)
+			}
+			if rb.Expired {
+				b.WriteString(" (expired)")
+			}
+			if rb.TxHash != "" {
+				fmt.Fprintf(&b, " block %d tx %s recipient 0x%s m %s", rb.Block, rb.TxHash, rb.Recipient, rb.M)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	fmt.Fprintf(&b, "Orphans: %d\n", r.Orphans())
+	return b.String()
+}
+
+// Daily consolidates a window of operations (ddm report): the proofs made,
+// from the statistics store; the batches published, from their receipts;
+// and the submissions that became final, from the submitter state. The
+// caller adds what falls in the window, then calls Finish.
+type Daily struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Proven    int       `json:"proven"`
+	TxSlots   int       `json:"tx_slots"` // N of each proof: the transactions its batch can carry
+	ProveUSD  float64   `json:"prove_cost_usd"`
+	Published int       `json:"published"`
+	Settled   int       `json:"settled"`
+	Value     string    `json:"value_settled"` // sum of TotalSettle, decimal
+	GasUsed   uint64    `json:"gas_used"`      // by every transaction mined, reverted ones included
+	FeeWei    string    `json:"fee_wei"`
+	ETHUSD    float64   `json:"eth_usd,omitempty"`
+	FeeUSD    float64   `json:"fee_usd,omitempty"` // when ETHUSD is known
+	// (proving + fees) / TxSlots: batches short of N rows cost more per
+	// transaction than this
+	CostPerTx float64        `json:"cost_per_tx_usd"`
+	Pending   int            `json:"pending"` // submissions in flight at the end
+	Failures  []Failure      `json:"failures,omitempty"`
+	ByCode    map[string]int `json:"failures_by_code,omitempty"`
+
+	value, fee big.Int
+}
+
+// Failure is a batch that failed to prove or to settle.
+type Failure struct {
+	Time    time.Time `json:"time"`
+	BatchID string    `json:"batch_id,omitempty"` // hex
+	Stage   string    `json:"stage"`              // prove or submit
+	Code    string    `json:"code,omitempty"`     // errs.Code
+	Error   string    `json:"error"`
+}
+
+// AddProof counts a proof of N slots that cost costUSD to make.
+func (d *Daily) AddProof(n int, costUSD float64) {
+	d.Proven++
+	d.TxSlots += n
+	d.ProveUSD += costUSD
+}
+
+// AddPublished counts a published batch.
+func (d *Daily) AddPublished() { d.Published++ }
+
+// AddSettled counts a settled submission of total, and charges gasUsed and
+// fee (wei, nil when unknown) to the window; pass a nil total for a failed
+// submission, whose gas was spent all the same.
+func (d *Daily) AddSettled(total *big.Int, gasUsed uint64, fee *big.Int) {
+	if total != nil {
+		d.Settled++
+		d.value.Add(&d.value, total)
+	}
+	d.GasUsed += gasUsed
+	if fee != nil {
+		d.fee.Add(&d.fee, fee)
+	}
+}
+
+// AddFailure lists f.
+func (d *Daily) AddFailure(f Failure) { d.Failures = append(d.Failures, f) }
+
+// Finish derives the totals, pricing fees at ethUSD when it is not 0.
+func (d *Daily) Finish(ethUSD float64) {
+	d.Value, d.FeeWei = d.value.String(), d.fee.String()
+	d.ETHUSD = ethUSD
+	if ethUSD > 0 {
+		eth, _ := new(big.Float).Quo(new(big.Float).SetInt(&d.fee), big.NewFloat(1e18)).Float64()
+		d.FeeUSD = eth * ethUSD
+	}
+	if d.TxSlots > 0 {
+		d.CostPerTx = (d.ProveUSD + d.FeeUSD) / float64(d.TxSlots)
+	}
+	slices.SortStableFunc(d.Failures, func(a, b Failure) int { return a.Time.Compare(b.Time) })
+	d.ByCode = nil
+	for _, f := range d.Failures {
+		if d.ByCode == nil {
+			d.ByCode = map[string]int{}
+		}
+		d.ByCode[cmp.Or(f.Code, "UNKNOWN")]++
+	}
+}
+
+func (d Daily) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n=== Report %s to %s ===\n", d.From.UTC().Format(time.RFC3339), d.To.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Proven: %d batches, %d tx slots, $%.6f proving\n", d.Proven, d.TxSlots, d.ProveUSD)
+	fmt.Fprintf(&b, "Published: %d batches\n", d.Published)
+	fmt.Fprintf(&b, "Settled: %d batches, value %s, %d pending\n", d.Settled, d.Value, d.Pending)
+	fmt.Fprintf(&b, "On-chain: %d gas, %s wei", d.GasUsed, d.FeeWei)
+	if d.ETHUSD > 0 {
+		fmt.Fprintf(&b, " (ETH $%.0f → $%.6f)", d.ETHUSD, d.FeeUSD)
+	}
+	b.WriteByte('\n')
+	fmt.Fprintf(&b, "Cost per tx: $%.8f", d.CostPerTx)
+	if d.ETHUSD == 0 && d.GasUsed > 0 {
+		b.WriteString(" (proving only, fees unpriced without an ETH price)")
+	}
+	b.WriteByte('\n')
+	fmt.Fprintf(&b, "Failures: %d", len(d.Failures))
+	for _, code := range slices.Sorted(maps.Keys(d.ByCode)) {
+		fmt.Fprintf(&b, ", %s %d", code, d.ByCode[code])
+	}
+	b.WriteByte('\n')
+	for _, f := range d.Failures {
+		fmt.Fprintf(&b, "  %s %.16s %-6s %s: %s\n", f.Time.UTC().Format(time.RFC3339), cmp.Or(f.BatchID, "-"), f.Stage, f.Code, f.Error)
+	}
+	return b.String()
+}
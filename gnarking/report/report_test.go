@@ -0,0 +1,133 @@
+package report
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b)) }
+
+func TestEconomics(t *testing.T) {
+	// 8 cores for 90s: 720 CPU-seconds, $0.01 at $0.05 a core-hour
+	e := NewEconomics(64, 90*time.Second, 8)
+	if e.CPUSeconds != 720 || !near(e.CostPerProof, 0.01) {
+		t.Errorf("cost: %v CPU-s, $%v", e.CPUSeconds, e.CostPerProof)
+	}
+	// 64 txs of $0.005
+	if !near(e.BatchValue, 0.32) || !near(e.PercentCost, 0.01/0.32*100) {
+		t.Errorf("value: $%v, %v%%", e.BatchValue, e.PercentCost)
+	}
+	// 40 proofs an hour
+	if !near(e.USDPerHour, 12.8) || !near(e.USDPerDay, 12.8*24) || !near(e.USDPerYear, 12.8*24*365) {
+		t.Errorf("throughput: %v /h, %v /day, %v /year", e.USDPerHour, e.USDPerDay, e.USDPerYear)
+	}
+	if !strings.Contains(e.String(), "N = 64, cores = 8") {
+		t.Errorf("String:\n%s", e)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	c := NewCompression(8, 256)
+	// 4 fields and a 3-field signature, 32 bytes each
+	if c.FieldElementBytes != 32 || c.PerTxBytes != 224 || c.NaiveBytes != 8*224 {
+		t.Fatalf("%+v", c)
+	}
+	if c.Ratio != 7 {
+		t.Errorf("ratio %v, want 7", c.Ratio)
+	}
+}
+
+func TestBench(t *testing.T) {
+	b := NewBench(8, 10, 2, 20*time.Second, 16*time.Second)
+	if b.SequentialPerHour != 1800 || b.PipelinedPerHour != 2250 || b.OverlapGain != 1.25 {
+		t.Errorf("%+v", b)
+	}
+	if !strings.Contains(b.String(), "Pipelined (depth 2): 16s (1.6s / proof)") {
+		t.Errorf("String:\n%s", b)
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	s := NewSimulation(Simulation{
+		N: 64, Rows: 32, Cores: 8, ProveTime: 90 * time.Second,
+		VerifyGas: 250_000, GasPriceGwei: 2, ETHUSD: 3000,
+	})
+	// the proof is charged to the rows carried, not N
+	if s.Economics.N != 32 || !near(s.Economics.CostPerProof, 0.01) {
+		t.Errorf("economics %+v", s.Economics)
+	}
+	// 250k gas at 2 gwei is 0.0005 ETH
+	if !near(s.VerifyUSD, 1.5) || !near(s.CostPerTx, 1.51/32) || !near(s.PercentCost, 1.51/32/MinTxUSD*100) {
+		t.Errorf("verify $%v, per tx $%v, %v%%", s.VerifyUSD, s.CostPerTx, s.PercentCost)
+	}
+}
+
+func TestMigrationAndReconciliation(t *testing.T) {
+	m := Migration{Profile: "8", Batches: []MigratedBatch{
+		{Batch: "a", OldBatchID: "01", NewBatchID: "01"},
+		{Batch: "b", Error: "no pk"},
+		{Batch: "c", OldBatchID: "02", NewBatchID: "03", Changed: []string{"BatchDataRoot"}},
+	}}
+	if m.Failed() != 1 {
+		t.Errorf("failed %d", m.Failed())
+	}
+	out := m.String()
+	for _, want := range []string{"b: FAILED: no pk", "a: 01, public inputs unchanged", "(BatchDataRoot changed)", "Migrated: 2, failed: 1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	r := Reconciliation{
+		Matched:     make([]ReconciledBatch, 3),
+		Unsubmitted: make([]ReconciledBatch, 2),
+		Pending:     make([]ReconciledBatch, 4),
+		Unproven:    make([]ReconciledBatch, 1),
+	}
+	// pending batches are in flight, not orphans
+	if r.Orphans() != 3 {
+		t.Errorf("orphans %d, want 3", r.Orphans())
+	}
+}
+
+func TestDaily(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	d := Daily{From: day, To: day.Add(24 * time.Hour)}
+	d.AddProof(8, 0.001)
+	d.AddProof(64, 0.003)
+	d.AddPublished()
+	d.AddSettled(big.NewInt(1000), 300_000, big.NewInt(6e14))
+	d.AddSettled(big.NewInt(24), 200_000, big.NewInt(4e14))
+	// a reverted submission spends gas, settles nothing
+	d.AddSettled(nil, 50_000, nil)
+	d.AddFailure(Failure{Time: day.Add(2 * time.Hour), Stage: "submit", Code: "REVERTED", Error: "reverted"})
+	d.AddFailure(Failure{Time: day.Add(time.Hour), Stage: "prove", Error: "killed"})
+	d.AddFailure(Failure{Time: day.Add(3 * time.Hour), Stage: "submit", Code: "REVERTED", Error: "reverted"})
+
+	d.Finish(0)
+	if d.Proven != 2 || d.TxSlots != 72 || d.Published != 1 || d.Settled != 2 {
+		t.Fatalf("counts %+v", d)
+	}
+	if d.Value != "1024" || d.GasUsed != 550_000 || d.FeeWei != "1000000000000000" {
+		t.Errorf("value %s, gas %d, fee %s wei", d.Value, d.GasUsed, d.FeeWei)
+	}
+	// without an ETH price only proving is charged
+	if d.FeeUSD != 0 || !near(d.CostPerTx, 0.004/72) {
+		t.Errorf("unpriced: fee $%v, per tx $%v", d.FeeUSD, d.CostPerTx)
+	}
+	if !strings.Contains(d.String(), "proving only") {
+		t.Errorf("String:\n%s", d)
+	}
+	if d.Failures[0].Stage != "prove" || d.ByCode["UNKNOWN"] != 1 || d.ByCode["REVERTED"] != 2 {
+		t.Errorf("failures %+v, by code %v", d.Failures, d.ByCode)
+	}
+
+	// Finish again with a price: 0.001 ETH at $3000
+	d.Finish(3000)
+	if !near(d.FeeUSD, 3) || !near(d.CostPerTx, 3.004/72) || len(d.ByCode) != 2 {
+		t.Errorf("priced: fee $%v, per tx $%v, by code %v", d.FeeUSD, d.CostPerTx, d.ByCode)
+	}
+}
@@ -0,0 +1,277 @@
+// Package retry is the retry policy shared by every component that talks
+// to another process over the network: the submitter, chainsync, the
+// publish stores and the marketplace client. A Policy retries an operation
+// with jittered exponential backoff while its error is transient
+// (errs.ErrUnavailable by default), never past the caller's context
+// deadline, its own time budget or, when several components share one, a
+// Budget of retries relative to successes, so a failing node is not
+// hammered by every caller at once.
+//
+// The zero Policy tries once: components with a Policy field behave as
+// before until one is set.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/errs"
+)
+
+// Policy is how an operation is retried.
+type Policy struct {
+	Attempts   int           // tries in all, the first included; 0 or 1 is no retry
+	Initial    time.Duration // wait before the first retry; 100ms when zero
+	Max        time.Duration // longest wait; 10s when zero
+	Multiplier float64       // growth of the wait per retry; 2 when zero
+	Jitter     float64       // fraction of each wait drawn at random, in [0, 1]
+	// Elapsed bounds the time from the first try: no retry starts whose
+	// wait would end past it. Zero is no bound but the context's.
+	Elapsed time.Duration
+	// Budget, when set, is drawn from by every retry and refilled by
+	// successes; shared by components, it caps their retries together.
+	Budget *Budget
+	// Retryable reports whether an error is transient;
+	// errors.Is(err, errs.ErrUnavailable) when nil.
+	Retryable func(error) bool
+}
+
+// Default is what the ddm commands retry network calls with unless told
+// otherwise: 4 tries over at most a minute.
+var Default = Policy{Attempts: 4, Initial: 250 * time.Millisecond, Max: 5 * time.Second, Jitter: 0.2, Elapsed: time.Minute}
+
+// Do runs op until it succeeds, fails with an error that is not
+// transient, or the policy gives up, and returns op's last error. op gets
+// ctx; Do returns early when ctx ends while it waits.
+func (p Policy) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	start := time.Now()
+	for n := 1; ; n++ {
+		err := op(ctx)
+		if err == nil {
+			p.Budget.success()
+			return nil
+		}
+		if n >= p.Attempts || !p.retryable(err) || ctx.Err() != nil {
+			return tried(n, err)
+		}
+		wait := p.Wait(n)
+		if p.Elapsed > 0 && time.Since(start)+wait > p.Elapsed {
+			return tried(n, err)
+		}
+		if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+			return tried(n, err)
+		}
+		if !p.Budget.withdraw() {
+			return fmt.Errorf("retry budget exhausted after %d attempts: %w", n, err)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return tried(n, err)
+		case <-t.C:
+		}
+	}
+}
+
+// Get is Do for an operation with a result.
+func Get[T any](ctx context.Context, p Policy, op func(ctx context.Context) (T, error)) (T, error) {
+	var out T
+	err := p.Do(ctx, func(ctx context.Context) error {
+		v, err := op(ctx)
+		if err == nil {
+			out = v
+		}
+		return err
+	})
+	return out, err
+}
+
+// Wait is the backoff before retry n, the first being 1, jitter included.
+func (p Policy) Wait(n int) time.Duration {
+	initial, ceiling, mult := p.Initial, p.Max, p.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if ceiling <= 0 {
+		ceiling = 10 * time.Second
+	}
+	if mult < 1 {
+		mult = 2
+	}
+	d := float64(initial)
+	for i := 1; i < n && d < float64(ceiling); i++ {
+		d *= mult
+	}
+	d = min(d, float64(ceiling))
+	if j := min(max(p.Jitter, 0), 1); j > 0 {
+		// spread over [d(1-j), d]: never longer than the ceiling
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func (p Policy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return errors.Is(err, errs.ErrUnavailable)
+}
+
+func tried(n int, err error) error {
+	if n == 1 {
+		return err
+	}
+	return fmt.Errorf("after %d attempts: %w", n, err)
+}
+
+// String is p as Parse reads it.
+func (p Policy) String() string {
+	if p.Attempts <= 1 {
+		return "off"
+	}
+	parts := []string{"attempts=" + strconv.Itoa(p.Attempts)}
+	for _, f := range []struct {
+		name string
+		d    time.Duration
+	}{{"initial", p.Initial}, {"max", p.Max}, {"elapsed", p.Elapsed}} {
+		if f.d > 0 {
+			parts = append(parts, f.name+"="+f.d.String())
+		}
+	}
+	if p.Multiplier > 0 {
+		parts = append(parts, "multiplier="+strconv.FormatFloat(p.Multiplier, 'g', -1, 64))
+	}
+	if p.Jitter > 0 {
+		parts = append(parts, "jitter="+strconv.FormatFloat(p.Jitter, 'g', -1, 64))
+	}
+	if p.Budget != nil {
+		parts = append(parts, "budget="+strconv.FormatFloat(p.Budget.Ratio, 'g', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse reads a policy as the ddm -retry flags take it: "off", or
+// comma-separated settings, e.g. "attempts=5,initial=200ms,max=10s,
+// elapsed=1m,jitter=0.2,budget=0.1". budget=R gives the policy a Budget
+// of ratio R of its own; share one between policies by setting Budget.
+func Parse(s string) (Policy, error) {
+	var p Policy
+	if s = strings.TrimSpace(s); s == "" || s == "off" {
+		return p, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		name, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch name {
+		case "attempts":
+			p.Attempts, err = strconv.Atoi(v)
+			if err == nil && p.Attempts < 1 {
+				err = errors.New("below 1")
+			}
+		case "initial":
+			p.Initial, err = positive(v)
+		case "max":
+			p.Max, err = positive(v)
+		case "elapsed":
+			p.Elapsed, err = positive(v)
+		case "multiplier":
+			p.Multiplier, err = strconv.ParseFloat(v, 64)
+			if err == nil && p.Multiplier < 1 {
+				err = errors.New("below 1")
+			}
+		case "jitter":
+			p.Jitter, err = strconv.ParseFloat(v, 64)
+			if err == nil && (p.Jitter < 0 || p.Jitter > 1) {
+				err = errors.New("outside [0, 1]")
+			}
+		case "budget":
+			var ratio float64
+			ratio, err = strconv.ParseFloat(v, 64)
+			if err == nil && ratio <= 0 {
+				err = errors.New("not positive")
+			}
+			p.Budget = NewBudget(ratio, 0)
+		default:
+			return Policy{}, fmt.Errorf("%w: retry policy %q: unknown setting %q", errs.ErrInvalidInput, s, name)
+		}
+		if err != nil {
+			return Policy{}, fmt.Errorf("%w: retry policy %q: %s=%q: %v", errs.ErrInvalidInput, s, name, v, err)
+		}
+	}
+	return p, nil
+}
+
+func positive(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = errors.New("not positive")
+	}
+	return d, err
+}
+
+// Budget caps retries relative to successes, shared by every Policy
+// pointing at it: each retry takes a token, each success adds Ratio of
+// one, up to Burst. A node down for everyone then sees Burst retries in
+// all rather than a storm from every caller.
+type Budget struct {
+	Ratio float64 // tokens a success adds
+	Burst float64 // tokens held at most, and at first
+
+	mu     sync.Mutex
+	tokens float64
+	used   bool
+}
+
+// NewBudget is a full Budget; burst 0 is 10 retries.
+func NewBudget(ratio, burst float64) *Budget {
+	if burst <= 0 {
+		burst = 10
+	}
+	return &Budget{Ratio: ratio, Burst: burst}
+}
+
+// Tokens is the number of retries b allows now.
+func (b *Budget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	return b.tokens
+}
+
+func (b *Budget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *Budget) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	b.tokens = min(b.tokens+b.Ratio, b.Burst)
+}
+
+// fill starts b full, so a Budget literal works too.
+func (b *Budget) fill() {
+	if !b.used {
+		b.tokens, b.used = b.Burst, true
+	}
+}
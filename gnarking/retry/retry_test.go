@@ -0,0 +1,131 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+func TestDo(t *testing.T) {
+	down := fmt.Errorf("%w: node down", errs.ErrUnavailable)
+	p := Policy{Attempts: 4, Initial: time.Millisecond, Max: 2 * time.Millisecond}
+
+	// transient failures are retried until success
+	n := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		if n++; n < 3 {
+			return down
+		}
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("%d tries: %v", n, err)
+	}
+
+	// up to Attempts, the last error kept
+	n = 0
+	err = p.Do(context.Background(), func(context.Context) error { n++; return down })
+	if !errors.Is(err, errs.ErrUnavailable) || n != 4 {
+		t.Fatalf("%d tries: %v", n, err)
+	}
+
+	// other errors are final
+	n = 0
+	err = p.Do(context.Background(), func(context.Context) error { n++; return errs.ErrInvalidInput })
+	if !errors.Is(err, errs.ErrInvalidInput) || n != 1 {
+		t.Fatalf("%d tries: %v", n, err)
+	}
+
+	// the zero Policy tries once
+	n = 0
+	if err := (Policy{}).Do(context.Background(), func(context.Context) error { n++; return down }); err != down || n != 1 {
+		t.Fatalf("%d tries: %v", n, err)
+	}
+
+	// no wait outlasts the context's deadline
+	slow := Policy{Attempts: 10, Initial: time.Hour, Max: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := slow.Do(ctx, func(context.Context) error { return down }); !errors.Is(err, errs.ErrUnavailable) || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("after %s: %v", time.Since(start), err)
+	}
+
+	// nor the time budget
+	slow.Elapsed = time.Minute
+	start = time.Now()
+	if err := slow.Do(context.Background(), func(context.Context) error { return down }); !errors.Is(err, errs.ErrUnavailable) || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("after %s: %v", time.Since(start), err)
+	}
+
+	v, err := Get(context.Background(), p, func(context.Context) (int, error) { return 7, nil })
+	if v != 7 || err != nil {
+		t.Fatalf("Get: %d %v", v, err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	down := fmt.Errorf("%w: node down", errs.ErrUnavailable)
+	b := NewBudget(0.5, 3)
+	a := Policy{Attempts: 10, Initial: time.Microsecond, Budget: b}
+	c := a
+
+	// two components share 3 retries
+	n := 0
+	fail := func(context.Context) error { n++; return down }
+	a.Do(context.Background(), fail)
+	c.Do(context.Background(), fail)
+	if n != 5 || b.Tokens() != 0 {
+		t.Fatalf("%d tries, %g tokens left", n, b.Tokens())
+	}
+	// two successes earn one back
+	ok := func(context.Context) error { return nil }
+	a.Do(context.Background(), ok)
+	c.Do(context.Background(), ok)
+	if b.Tokens() != 1 {
+		t.Fatalf("%g tokens", b.Tokens())
+	}
+}
+
+func TestWait(t *testing.T) {
+	p := Policy{Initial: 100 * time.Millisecond, Max: time.Second}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 60: time.Second} {
+		if got := p.Wait(n); got != want {
+			t.Errorf("Wait(%d) = %s, want %s", n, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.Wait(5); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("jittered Wait(5) = %s", got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse("attempts=5,initial=200ms,max=10s,elapsed=1m,jitter=0.2,budget=0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Attempts != 5 || p.Initial != 200*time.Millisecond || p.Max != 10*time.Second || p.Elapsed != time.Minute || p.Jitter != 0.2 || p.Budget == nil || p.Budget.Ratio != 0.1 {
+		t.Fatalf("%+v", p)
+	}
+	if q, err := Parse(p.String()); err != nil || q.String() != p.String() {
+		t.Fatalf("round trip %q: %q %v", p, q, err)
+	}
+	if q, err := Parse(Default.String()); err != nil || q.String() != Default.String() || q.Elapsed != time.Minute {
+		t.Fatalf("Default: %+v %v", q, err)
+	}
+	if p, err := Parse("off"); err != nil || p.Attempts != 0 {
+		t.Fatalf("off: %+v %v", p, err)
+	}
+	for _, bad := range []string{"attempts=0", "initial=-1s", "jitter=2", "multiplier=0.5", "budget=0", "tries=3"} {
+		if _, err := Parse(bad); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package revocation maintains the revocation tree of operator keys: a
+// sparse Merkle tree of depth circuit.RevocationDepth over MiMC, each key at
+// the slot its own RevocationKey names, whose root
+// a deployment pins so that batches signed by a revoked key cannot settle
+// even with valid signatures (circuit.RevocationCircuit). The tree is kept
+// as the list of revoked keys and rebuilt on load.
+package revocation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+const depth = circuit.RevocationDepth
+
+// zero[i] is the root of an empty subtree of height i.
+var zero = func() (z [depth + 1]*big.Int) {
+	z[0] = new(big.Int)
+	for i := range depth {
+		z[i+1] = circuit.RevocationNode(z[i], z[i])
+	}
+	return z
+}()
+
+// EmptyRoot is the root of a tree revoking no key.
+func EmptyRoot() *big.Int { return new(big.Int).Set(zero[depth]) }
+
+// Tree is the revocation tree. Only the nodes off the empty subtrees are
+// held, RevocationDepth per revoked key.
+type Tree struct {
+	revoked map[string]*big.Int            // pk hex -> key, its slot
+	nodes   [depth + 1]map[string]*big.Int // by height, then index (hex); leaves at 0
+}
+
+// New is an empty tree.
+func New() *Tree {
+	t := &Tree{revoked: make(map[string]*big.Int)}
+	for i := range t.nodes {
+		t.nodes[i] = make(map[string]*big.Int)
+	}
+	return t
+}
+
+// ParsePk reads a 32-byte compressed EdDSA public key, hex with or without
+// 0x, and returns it with its canonical hex.
+func ParsePk(s string) (bnEddsa.PublicKey, string, error) {
+	var pk bnEddsa.PublicKey
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err == nil && len(b) != 32 {
+		err = fmt.Errorf("%d bytes", len(b))
+	}
+	if err == nil {
+		_, err = pk.SetBytes(b)
+	}
+	if err != nil {
+		return pk, "", fmt.Errorf("%w: pk %q: %w", errs.ErrInvalidInput, s, err)
+	}
+	return pk, hex.EncodeToString(b), nil
+}
+
+// key is pk's leaf.
+func key(pk bnEddsa.PublicKey) *big.Int {
+	return circuit.RevocationKey(pk.A.X.BigInt(new(big.Int)), pk.A.Y.BigInt(new(big.Int)))
+}
+
+func (t *Tree) node(height int, index *big.Int) *big.Int {
+	if n, ok := t.nodes[height][index.Text(16)]; ok {
+		return n
+	}
+	return zero[height]
+}
+
+// ancestor is the index at height of the node above slot.
+func ancestor(slot *big.Int, height int) *big.Int {
+	return new(big.Int).Rsh(slot, uint(height))
+}
+
+// sibling is the index at height of the node next to the one above slot.
+func sibling(slot *big.Int, height int) *big.Int {
+	index := ancestor(slot, height)
+	return index.SetBit(index, 0, index.Bit(0)^1)
+}
+
+// set puts leaf at slot and rehashes its path.
+func (t *Tree) set(slot, leaf *big.Int) {
+	n := leaf
+	for h := 0; ; h++ {
+		index := ancestor(slot, h).Text(16)
+		if n.Cmp(zero[h]) == 0 {
+			delete(t.nodes[h], index)
+		} else {
+			t.nodes[h][index] = n
+		}
+		if h == depth {
+			return
+		}
+		if slot.Bit(h) == 0 {
+			n = circuit.RevocationNode(n, t.node(h, sibling(slot, h)))
+		} else {
+			n = circuit.RevocationNode(t.node(h, sibling(slot, h)), n)
+		}
+	}
+}
+
+// Root is the root the contract pins.
+func (t *Tree) Root() *big.Int { return new(big.Int).Set(t.node(depth, new(big.Int))) }
+
+// Len is the number of revoked keys.
+func (t *Tree) Len() int { return len(t.revoked) }
+
+// Revoked lists the revoked keys, hex, sorted.
+func (t *Tree) Revoked() []string {
+	out := make([]string, 0, len(t.revoked))
+	for pk := range t.revoked {
+		out = append(out, pk)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// IsRevoked reports whether pk, hex, is revoked.
+func (t *Tree) IsRevoked(pk string) (bool, error) {
+	_, canon, err := ParsePk(pk)
+	if err != nil {
+		return false, err
+	}
+	_, ok := t.revoked[canon]
+	return ok, nil
+}
+
+// Revoke adds pk, hex. Revoking a revoked key is ErrDuplicate.
+func (t *Tree) Revoke(pk string) error {
+	p, canon, err := ParsePk(pk)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.revoked[canon]; ok {
+		return fmt.Errorf("%w: %s is already revoked", errs.ErrDuplicate, canon)
+	}
+	k := key(p)
+	t.revoked[canon] = k
+	t.set(k, k)
+	return nil
+}
+
+// Reinstate removes pk, hex, from the tree: ErrNotFound unless revoked.
+func (t *Tree) Reinstate(pk string) error {
+	_, canon, err := ParsePk(pk)
+	if err != nil {
+		return err
+	}
+	slot, ok := t.revoked[canon]
+	if !ok {
+		return fmt.Errorf("%w: %s is not revoked", errs.ErrNotFound, canon)
+	}
+	delete(t.revoked, canon)
+	t.set(slot, zero[0])
+	return nil
+}
+
+// NonMembership is the witness that a key is not revoked under Root: the
+// path from its empty slot, as RevocationCircuit takes it. Its JSON is a
+// revocation-8 batch's variant inputs (circuit.Revocation). Field elements
+// are decimal.
+type NonMembership struct {
+	Root     string   `json:"root"`
+	Siblings []string `json:"siblings"` // leaf level first
+}
+
+// NonMembership proves pk, hex, is not revoked; a revoked key is
+// ErrPolicyRejected.
+func (t *Tree) NonMembership(pk string) (*NonMembership, error) {
+	p, canon, err := ParsePk(pk)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.revoked[canon]; ok {
+		return nil, fmt.Errorf("%w: %s is revoked", errs.ErrPolicyRejected, canon)
+	}
+	slot := key(p)
+	nm := &NonMembership{Root: t.Root().String(), Siblings: make([]string, depth)}
+	for h := range depth {
+		nm.Siblings[h] = t.node(h, sibling(slot, h)).String()
+	}
+	return nm, nil
+}
+
+// Verify is the native check of what RevocationCircuit proves: an empty
+// leaf at pk's slot opens along nm to its root.
+func (nm *NonMembership) Verify(pk bnEddsa.PublicKey) error {
+	fields, err := nm.fields()
+	if err != nil {
+		return err
+	}
+	slot := key(pk)
+	n := zero[0]
+	for h, sibling := range fields[1:] {
+		if slot.Bit(h) == 0 {
+			n = circuit.RevocationNode(n, sibling)
+		} else {
+			n = circuit.RevocationNode(sibling, n)
+		}
+	}
+	if n.Cmp(fields[0]) != 0 {
+		return fmt.Errorf("%w: path from an empty slot opens to %s, not the root %s", errs.ErrPolicyRejected, n, fields[0])
+	}
+	return nil
+}
+
+// Assign sets c's revocation root and path from nm.
+func (nm *NonMembership) Assign(c *circuit.RevocationCircuit) error {
+	fields, err := nm.fields()
+	if err != nil {
+		return err
+	}
+	c.X.RevocationRoot = fields[0]
+	for i, s := range fields[1:] {
+		c.Siblings[i] = s
+	}
+	return nil
+}
+
+// fields is the root, then the siblings.
+func (nm *NonMembership) fields() ([]*big.Int, error) {
+	if len(nm.Siblings) != depth {
+		return nil, fmt.Errorf("%w: %d siblings, want %d", errs.ErrInvalidInput, len(nm.Siblings), depth)
+	}
+	out := make([]*big.Int, 0, depth+1)
+	for _, s := range slices.Concat([]string{nm.Root}, nm.Siblings) {
+		var f circuit.FieldJSON
+		if err := f.UnmarshalJSON([]byte(s)); err != nil {
+			return nil, err
+		}
+		out = append(out, (*big.Int)(&f))
+	}
+	return out, nil
+}
+
+// ListVersion 2: the tree is full width (circuit.RevocationDepth), so a
+// version 1 list's root, over 64-bit slots, is no longer its keys'.
+const ListVersion = 2
+
+// list is a tree on disk: its revoked keys, and the root for readers that
+// do not rebuild it.
+type list struct {
+	Version int      `json:"version"`
+	Root    string   `json:"root"` // decimal
+	Revoked []string `json:"revoked"`
+}
+
+var _ io.WriterTo = (*Tree)(nil)
+var _ io.ReaderFrom = (*Tree)(nil)
+
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(list{Version: ListVersion, Root: t.Root().String(), Revoked: t.Revoked()}, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+// ReadFrom rebuilds the tree from its list, checking the root it records.
+func (t *Tree) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(len(data))
+	var l list
+	if err := json.Unmarshal(data, &l); err != nil {
+		return n, fmt.Errorf("%w: revocation list: %w", errs.ErrInvalidInput, err)
+	}
+	if l.Version != ListVersion {
+		return n, fmt.Errorf("%w: unsupported revocation list version %d", errs.ErrArtifactMismatch, l.Version)
+	}
+	*t = *New()
+	for _, pk := range l.Revoked {
+		if err := t.Revoke(pk); err != nil {
+			return n, err
+		}
+	}
+	if root := t.Root().String(); root != l.Root {
+		return n, fmt.Errorf("%w: revocation list rebuilds to root %s, it records %s", errs.ErrArtifactMismatch, root, l.Root)
+	}
+	return n, nil
+}
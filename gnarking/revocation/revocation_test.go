@@ -0,0 +1,105 @@
+package revocation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func pk(t *testing.T, seed byte) (bnEddsa.PublicKey, string) {
+	t.Helper()
+	priv, err := bnEddsa.GenerateKey(bytes.NewReader(bytes.Repeat([]byte{seed}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv.PublicKey, hex.EncodeToString(priv.PublicKey.Bytes())
+}
+
+func TestTree(t *testing.T) {
+	a, aHex := pk(t, 1)
+	_, bHex := pk(t, 2)
+	c, cHex := pk(t, 3)
+
+	tr := New()
+	if tr.Root().Cmp(EmptyRoot()) != 0 {
+		t.Fatal("new tree is not empty")
+	}
+	for _, k := range []string{aHex, "0x" + bHex} {
+		if err := tr.Revoke(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Revoke(strings.ToUpper(aHex)); !errors.Is(err, errs.ErrDuplicate) {
+		t.Fatalf("revoked twice: %v", err)
+	}
+
+	nm, err := tr.NonMembership(cHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm.Root != tr.Root().String() {
+		t.Fatal("non-membership under another root")
+	}
+	if err := nm.Verify(c); err != nil {
+		t.Fatal(err)
+	}
+	// the path does not clear another key, nor a revoked one
+	if err := nm.Verify(a); err == nil {
+		t.Fatal("c's path verified for a")
+	}
+	if _, err := tr.NonMembership(aHex); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("revoked key: %v", err)
+	}
+
+	// the list rebuilds the tree, and refuses one whose root was edited
+	var buf bytes.Buffer
+	if _, err := tr.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.String()
+	back := New()
+	if _, err := back.ReadFrom(strings.NewReader(saved)); err != nil || back.Root().Cmp(tr.Root()) != 0 || back.Len() != 2 {
+		t.Fatalf("reloaded: %d keys, %v", back.Len(), err)
+	}
+	tampered := strings.Replace(saved, `"root": "`, `"root": "1`, 1)
+	if _, err := back.ReadFrom(strings.NewReader(tampered)); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("tampered list: %v", err)
+	}
+	// a list of the 64-bit tree records a root its keys no longer build
+	v1 := strings.Replace(saved, `"version": 2`, `"version": 1`, 1)
+	if _, err := back.ReadFrom(strings.NewReader(v1)); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("version 1 list: %v", err)
+	}
+
+	// once c is revoked its old path does not open to the new root
+	if err := tr.Revoke(cHex); err != nil {
+		t.Fatal(err)
+	}
+	stale := *nm
+	stale.Root = tr.Root().String()
+	if err := stale.Verify(c); !errors.Is(err, errs.ErrPolicyRejected) {
+		t.Fatalf("revoked key's old witness: %v", err)
+	}
+	if len(nm.Siblings) != circuit.RevocationDepth {
+		t.Fatalf("%d siblings", len(nm.Siblings))
+	}
+
+	for _, k := range []string{aHex, bHex, cHex} {
+		if err := tr.Reinstate(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tr.Root().Cmp(EmptyRoot()) != 0 {
+		t.Fatal("reinstating every key does not empty the tree")
+	}
+	if err := tr.Reinstate(aHex); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("reinstated twice: %v", err)
+	}
+}
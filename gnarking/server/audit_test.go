@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gnarking/audit"
+)
+
+// TestAuditRejected checks requests refused before verification are
+// audited too.
+func TestAuditRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	al, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	s, err := New(nil, al)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+	for _, body := range []string{`{"proof":`, `{"profile":"nope","proof":"00"}`} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/verify", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, rec.Code, rec.Body)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	head, err := audit.VerifyChain(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head == nil || head.Seq != 1 || head.Valid || head.Profile != "nope" || !strings.Contains(head.Error, "not served") {
+		t.Fatalf("head %+v", head)
+	}
+}
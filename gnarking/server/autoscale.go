@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Backlog is the prover's outstanding work and how long it should take:
+// every queued batch at its profile's expected prove time, plus what is
+// left of the one proving. Batches of a POST /prove/multi count as they
+// reach the queue, one after the other.
+type Backlog struct {
+	Queue    int              `json:"queue"` // batches waiting for the prover
+	Proving  int              `json:"proving"`
+	Estimate time.Duration    `json:"estimate_ns"` // until every batch is proven
+	Profiles []ProfileBacklog `json:"profiles,omitempty"`
+}
+
+// ProfileBacklog is one profile's part of the backlog.
+type ProfileBacklog struct {
+	Profile  string        `json:"profile"`
+	Queue    int           `json:"queue"`
+	Expected time.Duration `json:"expected_ns"` // one prove, 0 until anything was proven
+}
+
+// ewmaWeight is the weight of the newest prove time in the averages.
+const ewmaWeight = 0.3
+
+func ewma(avg, sample time.Duration) time.Duration {
+	if avg == 0 {
+		return sample
+	}
+	return avg + time.Duration(ewmaWeight*float64(sample-avg))
+}
+
+// observe folds a prove of n rows of profile into the expected times.
+func (b *board) observe(profile string, n int, proveTime time.Duration) {
+	if b.expected == nil {
+		b.expected = make(map[string]time.Duration)
+	}
+	b.expected[profile] = ewma(b.expected[profile], proveTime)
+	if n > 0 {
+		b.perRow = ewma(b.perRow, proveTime/time.Duration(n))
+	}
+}
+
+// expect is the expected prove time of a batch of n rows of profile: the
+// profile's average, else the per-row one scaled to n.
+func (b *board) expect(profile string, n int) time.Duration {
+	if d, ok := b.expected[profile]; ok {
+		return d
+	}
+	return b.perRow * time.Duration(n)
+}
+
+func (b *board) backlog(now time.Time) Backlog {
+	var bl Backlog
+	byProfile := make(map[string]*ProfileBacklog)
+	for _, r := range b.recent {
+		if r.Status != StatusQueued && r.Status != StatusProving {
+			continue
+		}
+		p, ok := byProfile[r.Profile]
+		if !ok {
+			p = &ProfileBacklog{Profile: r.Profile, Expected: b.expect(r.Profile, r.N)}
+			byProfile[r.Profile] = p
+		}
+		want := b.expect(r.Profile, r.N)
+		if r.Status == StatusProving {
+			bl.Proving++
+			bl.Estimate += max(want-now.Sub(r.started), 0)
+			continue
+		}
+		bl.Queue++
+		p.Queue++
+		bl.Estimate += want
+	}
+	for _, name := range slices.Sorted(maps.Keys(byProfile)) {
+		bl.Profiles = append(bl.Profiles, *byProfile[name])
+	}
+	return bl
+}
+
+// handleMetrics exports the queue and backlog in the Prometheus text
+// format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	st := s.board.status()
+	var b bytes.Buffer
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	seconds := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) }
+	gauge("ddm_prove_queue_depth", "Batches waiting for the prover.")
+	fmt.Fprintf(&b, "ddm_prove_queue_depth %d\n", st.Backlog.Queue)
+	gauge("ddm_prove_in_progress", "Batches being proven.")
+	fmt.Fprintf(&b, "ddm_prove_in_progress %d\n", st.Backlog.Proving)
+	gauge("ddm_prove_backlog_seconds", "Estimated seconds until every accepted batch is proven.")
+	fmt.Fprintf(&b, "ddm_prove_backlog_seconds %s\n", seconds(st.Backlog.Estimate))
+	gauge("ddm_prove_queue_depth_by_profile", "Batches waiting for the prover, by profile.")
+	for _, p := range st.Backlog.Profiles {
+		fmt.Fprintf(&b, "ddm_prove_queue_depth_by_profile{profile=%q} %d\n", p.Profile, p.Queue)
+	}
+	gauge("ddm_prove_expected_seconds", "Expected prove time of one batch, by profile.")
+	for _, p := range st.Backlog.Profiles {
+		fmt.Fprintf(&b, "ddm_prove_expected_seconds{profile=%q} %s\n", p.Profile, seconds(p.Expected))
+	}
+	s.phases.writeMetrics(&b)
+	if s.sla != nil {
+		s.sla.writeMetrics(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+// Autoscale calls a hook when the backlog estimate crosses Threshold, up
+// ("above") and back down ("below"), so orchestration can add prover
+// replicas before requests start missing their deadlines, and remove them.
+type Autoscale struct {
+	Threshold time.Duration
+	Interval  time.Duration // how often the backlog is checked, default 5s
+	Webhook   string        // URL the BacklogEvent is POSTed to as JSON
+	// Exec is a command run with sh -c, the BacklogEvent JSON on stdin and
+	// DDM_EVENT, DDM_BACKLOG_SECONDS and DDM_QUEUE set
+	Exec string
+}
+
+// BacklogEvent is what an Autoscale hook is called with.
+type BacklogEvent struct {
+	Event     string        `json:"event"` // "above" or "below"
+	Threshold time.Duration `json:"threshold_ns"`
+	Time      time.Time     `json:"time"`
+	Backlog   Backlog       `json:"backlog"`
+}
+
+// hookTimeout bounds one webhook call or command.
+const hookTimeout = 30 * time.Second
+
+// WatchBacklog checks the backlog against a.Threshold until ctx is done,
+// calling a's hooks on every crossing. Hook failures are logged.
+func (s *Server) WatchBacklog(ctx context.Context, a Autoscale) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	above := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.board.mu.Lock()
+			bl := s.board.backlog(now)
+			s.board.mu.Unlock()
+			if over := bl.Estimate > a.Threshold; over != above {
+				above = over
+				e := BacklogEvent{Event: "below", Threshold: a.Threshold, Time: now, Backlog: bl}
+				if over {
+					e.Event = "above"
+				}
+				a.fire(ctx, e)
+			}
+		}
+	}
+}
+
+func (a Autoscale) fire(ctx context.Context, e BacklogEvent) {
+	body, _ := json.Marshal(e)
+	callHooks(ctx, "autoscale", a.Webhook, a.Exec, body,
+		"DDM_EVENT="+e.Event,
+		"DDM_BACKLOG_SECONDS="+strconv.FormatFloat(e.Backlog.Estimate.Seconds(), 'f', -1, 64),
+		"DDM_QUEUE="+strconv.Itoa(e.Backlog.Queue))
+}
+
+// callHooks POSTs body to webhook and runs command with sh -c, body on its
+// stdin and env added to its environment, for those set, within
+// hookTimeout. Failures are logged under name.
+func callHooks(ctx context.Context, name, webhook, command string, body []byte, env ...string) {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	if webhook != "" {
+		if err := postHook(ctx, webhook, body); err != nil {
+			log.Printf("%s webhook: %v", name, err)
+		}
+	}
+	if command != "" {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		cmd.Env = append(os.Environ(), env...)
+		if err := cmd.Run(); err != nil {
+			log.Printf("%s exec: %v", name, err)
+		}
+	}
+}
+
+func postHook(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gnarking/prover"
+)
+
+func TestBacklog(t *testing.T) {
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan BacklogEvent, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e BacklogEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		events <- e
+	}))
+	defer hook.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.WatchBacklog(ctx, Autoscale{Threshold: 5 * time.Second, Interval: time.Millisecond, Webhook: hook.URL})
+
+	// a profile never proven is expected to take the per-row average
+	b := &s.board
+	b.done(b.add(ProofRecord{Profile: "8", N: 8, Status: StatusProving}), 2*time.Second, nil)
+	q := []*ProofRecord{
+		b.add(ProofRecord{Profile: "8", N: 8, Status: StatusQueued}),
+		b.add(ProofRecord{Profile: "8", N: 8, Status: StatusQueued}),
+		b.add(ProofRecord{Profile: "64", N: 64, Status: StatusQueued}),
+	}
+	st := b.status()
+	if st.Backlog.Queue != 3 || st.Backlog.Estimate != 20*time.Second || len(st.Backlog.Profiles) != 2 || st.Backlog.Profiles[0].Profile != "64" {
+		t.Fatalf("backlog %+v", st.Backlog)
+	}
+	if e := <-events; e.Event != "above" || e.Backlog.Queue != 3 {
+		t.Fatalf("rising event %+v", e)
+	}
+
+	s.phases.observe("8", &prover.Timings{Solve: time.Second, FFT: time.Second / 4, MSM: time.Second, MSMA: time.Second, Total: 2 * time.Second})
+	s.phases.observe("8", &prover.Timings{Solve: time.Second / 2, FFT: time.Second / 4, MSM: time.Second / 2, MSMA: time.Second / 2, Total: time.Second})
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{"ddm_prove_queue_depth 3", "ddm_prove_backlog_seconds 20", `ddm_prove_expected_seconds{profile="64"} 16`,
+		`ddm_prove_phase_seconds_sum{profile="8",phase="solve"} 1.5`, `ddm_prove_phase_seconds_sum{profile="8",phase="fft"} 0.5`,
+		`ddm_prove_phase_seconds_sum{profile="8",phase="msm"} 1.5`, `ddm_prove_phase_seconds_sum{profile="8",phase="msm_a"} 1.5`, `ddm_prove_phase_seconds_count{profile="8",phase="msm"} 2`} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Fatalf("metrics without %q:\n%s", line, rec.Body)
+		}
+	}
+
+	for _, r := range q {
+		b.done(r, time.Second, nil)
+	}
+	if e := <-events; e.Event != "below" || e.Backlog.Estimate != 0 {
+		t.Fatalf("falling event %+v", e)
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/intake"
+	"gnarking/submitter"
+	"gnarking/tracing"
+)
+
+// Client calls a ddm serve instance.
+type Client struct {
+	URL   string       // base URL, e.g. http://keyhost:8080
+	HTTP  *http.Client // http.DefaultClient when nil
+	Cores int          // core budget asked for each prove, the server's cap when zero
+}
+
+// endpoint is the URL of path with query q, and the core budget asked for.
+func (c *Client) endpoint(path string, q url.Values) string {
+	if c.Cores > 0 {
+		if q == nil {
+			q = url.Values{}
+		}
+		q.Set("cores", strconv.Itoa(c.Cores))
+	}
+	u := strings.TrimSuffix(c.URL, "/") + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// Prove has the server prove one signed batch (POST /prove), streamed up in
+// the binary form of prove.proto as it is encoded. It returns as
+// ProveWitness does.
+func (c *Client) Prove(ctx context.Context, batch *ProveRequest) (submitter.Submission, error) {
+	return c.prove(ctx, c.endpoint("/prove", nil), ContentTypeBatch, func(w io.Writer) error {
+		return WriteBatch(w, batch, DefaultChunkRows)
+	})
+}
+
+// ProveWitness has the server prove wit with its proving key (POST
+// /prove/witness): the witness is built here and streamed up as it is
+// serialized, the pk never leaves the server. It returns the proof with its
+// header and the public inputs the server read from wit; errors carry the
+// server's code (errs.ForCode).
+func (c *Client) ProveWitness(ctx context.Context, profile string, wit witness.Witness) (submitter.Submission, error) {
+	return c.prove(ctx, c.endpoint("/prove/witness", url.Values{"profile": {profile}}), "application/octet-stream", func(w io.Writer) error {
+		_, err := wit.WriteTo(w)
+		return err
+	})
+}
+
+// prove posts the body write streams to endpoint and reads the
+// ProveResponse.
+func (c *Client) prove(ctx context.Context, endpoint, contentType string, write func(io.Writer) error) (submitter.Submission, error) {
+	var sub submitter.Submission
+	body, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+	defer body.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return sub, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	tracing.Inject(ctx, tracing.Carrier(req.Header))
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return sub, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var pr ProveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return sub, fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+	}
+	if pr.Code != errs.CodeOK {
+		return sub, &remoteError{url: c.URL, msg: pr.Error, err: errs.ForCode(pr.Code)}
+	}
+	return submission(pr)
+}
+
+// ProveMulti has the server prove req's batches (POST /prove/multi) and
+// returns their submissions in order and the combined submission, checked
+// against its batches.
+func (c *Client) ProveMulti(ctx context.Context, req *MultiProveRequest) ([]submitter.Submission, *artifacts.Multi, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/prove/multi", nil), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, tracing.Carrier(hreq.Header))
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var mr MultiProveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&mr); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+	}
+	if mr.Code != errs.CodeOK {
+		return nil, nil, &remoteError{url: c.URL, msg: mr.Error, err: errs.ForCode(mr.Code)}
+	}
+	if mr.Multi == nil || len(mr.Proofs) != len(req.Batches) || len(mr.Multi.Batches) != len(req.Batches) {
+		return nil, nil, fmt.Errorf("%w: %s: %d proofs for %d batches", errs.ErrInvalidInput, c.URL, len(mr.Proofs), len(req.Batches))
+	}
+	if err := mr.Multi.Check(); err != nil {
+		return nil, nil, err
+	}
+	subs := make([]submitter.Submission, len(mr.Proofs))
+	for i, pr := range mr.Proofs {
+		if subs[i], err = submission(pr); err != nil {
+			return nil, nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+		if err := multiMatches(mr.Multi.Batches[i], subs[i]); err != nil {
+			return nil, nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+	}
+	return subs, mr.Multi, nil
+}
+
+// Session is a session open on the server (POST /sessions): its batches
+// send only their KOld and rows.
+type Session struct {
+	ID        string
+	Profile   string
+	c         *Client
+	sizeScale int
+}
+
+// OpenSession registers tmpl for the batches to come.
+func (c *Client) OpenSession(ctx context.Context, tmpl SessionTemplate) (*Session, error) {
+	body, err := json.Marshal(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var sr SessionResponse
+	if err := c.call(ctx, http.MethodPost, c.endpoint("/sessions", nil), body, &sr); err != nil {
+		return nil, err
+	}
+	if sr.Code != errs.CodeOK {
+		return nil, &remoteError{url: c.URL, msg: sr.Error, err: errs.ForCode(sr.Code)}
+	}
+	return &Session{ID: sr.ID, Profile: sr.Profile, c: c, sizeScale: tmpl.SizeScale}, nil
+}
+
+// Prove has the server prove one batch of the session (POST
+// /sessions/{id}/prove). It returns as Client.Prove does.
+func (s *Session) Prove(ctx context.Context, kOld uint64, rows []ProveRow) (submitter.Submission, error) {
+	req := ProveRequest{KOld: kOld, SizeScale: s.sizeScale, Rows: rows}
+	return s.c.prove(ctx, s.c.endpoint("/sessions/"+s.ID+"/prove", nil), "application/json", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(req)
+	})
+}
+
+// Close drops the session on the server.
+func (s *Session) Close(ctx context.Context) error {
+	var sr SessionResponse
+	if err := s.c.call(ctx, http.MethodDelete, strings.TrimSuffix(s.c.URL, "/")+"/sessions/"+s.ID, nil, &sr); err != nil {
+		return err
+	}
+	if sr.Code != errs.CodeOK {
+		return &remoteError{url: s.c.URL, msg: sr.Error, err: errs.ForCode(sr.Code)}
+	}
+	return nil
+}
+
+// Intent submits one signed intent (POST /intents) and returns its record,
+// dup set when the server had it already. A different intent under its key
+// is errs.ErrDuplicate, with the original's record.
+func (c *Client) Intent(ctx context.Context, in intake.Intent) (intake.Record, bool, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return intake.Record{}, false, err
+	}
+	var ir IntentResponse
+	if err := c.call(ctx, http.MethodPost, c.endpoint("/intents", nil), body, &ir); err != nil {
+		return intake.Record{}, false, err
+	}
+	var rec intake.Record
+	if ir.Intent != nil {
+		rec = *ir.Intent
+	}
+	if ir.Code != errs.CodeOK {
+		return rec, ir.Duplicate, &remoteError{url: c.URL, msg: ir.Error, err: errs.ForCode(ir.Code)}
+	}
+	return rec, ir.Duplicate, nil
+}
+
+// Status is the server's GET /status: its queue and backlog.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var st Status
+	err := c.call(ctx, http.MethodGet, strings.TrimSuffix(c.URL, "/")+"/status", nil, &st)
+	return st, err
+}
+
+// call sends body, if any, to endpoint and decodes the JSON reply into out,
+// whatever the status: replies carry their own code.
+func (c *Client) call(ctx context.Context, method, endpoint string, body []byte, out any) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+	}
+	return nil
+}
+
+// multiMatches checks that b is the batch of sub: same batch ID, and input
+// words those of sub's public inputs.
+func multiMatches(b artifacts.MultiBatch, sub submitter.Submission) error {
+	wit, err := circuit.PublicWitness(sub.Public)
+	if err != nil {
+		return err
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		return err
+	}
+	if sub.Header == nil || hex.EncodeToString(sub.Header.BatchID[:]) != b.BatchID || !slices.Equal(inputs, b.Inputs) {
+		return fmt.Errorf("%w: combined submission entry differs from the proof", errs.ErrArtifactMismatch)
+	}
+	return nil
+}
+
+// submission decodes a successful ProveResponse.
+func submission(pr ProveResponse) (submitter.Submission, error) {
+	var sub submitter.Submission
+	proofBytes, err := hex.DecodeString(pr.Proof)
+	if err != nil {
+		return sub, fmt.Errorf("%w: proof hex: %w", errs.ErrInvalidInput, err)
+	}
+	sub.Proof = new(groth16_bn254.Proof)
+	framed := artifacts.Proof{Proof: sub.Proof}
+	if _, err := framed.ReadFrom(bytes.NewReader(proofBytes)); err != nil {
+		return sub, err
+	}
+	sub.Header = framed.Header
+	if err := sub.Public.UnmarshalJSON(pr.Public); err != nil {
+		return sub, err
+	}
+	return sub, nil
+}
+
+// remoteError is an error reply, matching the sentinel of its code.
+type remoteError struct {
+	url, msg string
+	err      *errs.Error // nil for codes outside the taxonomy
+}
+
+func (e *remoteError) Error() string { return e.url + ": " + e.msg }
+
+func (e *remoteError) Unwrap() error {
+	if e.err == nil {
+		return nil
+	}
+	return e.err
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/report"
+	"gnarking/stats"
+	"gnarking/verifier"
+)
+
+// Proof statuses, in the order a proof goes through them.
+const (
+	StatusQueued    = "queued"
+	StatusProving   = "proving"
+	StatusProven    = "proven"
+	StatusFailed    = "failed"
+	StatusSubmitted = "submitted"
+)
+
+// recentProofs is how many proofs the dashboard lists.
+const recentProofs = 100
+
+// ProofRecord is one proof request the server has seen.
+type ProofRecord struct {
+	BatchID   string        `json:"batch_id"` // hex
+	Profile   string        `json:"profile,omitempty"`
+	N         int           `json:"n,omitempty"`
+	Cores     int           `json:"cores,omitempty"` // the prove's core budget
+	Time      time.Time     `json:"time"`            // when the request came in
+	ProveTime time.Duration `json:"prove_time_ns,omitempty"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	TxHash    string        `json:"tx_hash,omitempty"`
+	Deadline  time.Time     `json:"deadline,omitzero"`  // with an SLA
+	Breached  bool          `json:"breached,omitempty"` // not proven by Deadline
+
+	started time.Time // when proving started
+}
+
+// Totals are the cumulative figures since the server started. Cost and
+// value add up report.Economics of every proof made.
+type Totals struct {
+	Proofs      int           `json:"proofs"`
+	Failed      int           `json:"failed"`
+	Submitted   int           `json:"submitted"`
+	Rows        int           `json:"rows"`
+	ProveTime   time.Duration `json:"prove_time_ns"`
+	CostUSD     float64       `json:"cost_usd"`
+	ValueUSD    float64       `json:"value_usd"`
+	PercentCost float64       `json:"percent_cost"`
+}
+
+// Status is the reply of GET /status.
+type Status struct {
+	Queue  int           `json:"queue"`  // proofs waiting for the prover
+	Recent []ProofRecord `json:"recent"` // newest first
+	Totals Totals        `json:"totals"`
+	// Backlog is the queue's estimated prove time, what autoscaling acts on
+	Backlog Backlog `json:"backlog"`
+	// ProveStats are the prove time percentiles of the last day, by
+	// profile, then those of its solve, FFT and MSM phases, when stats are
+	// enabled
+	ProveStats []stats.Summary `json:"prove_stats,omitempty"`
+	// SLA is each profile's record against its deadlines, when enabled
+	SLA []SLAStats `json:"sla,omitempty"`
+
+	VerifyCache *verifier.CacheStats `json:"verify_cache,omitempty"` // when caching is enabled
+}
+
+// SubmittedRequest is the body of POST /submitted: a proof went on-chain,
+// settled once Block is set, or was given up on when Error is.
+type SubmittedRequest struct {
+	BatchID string `json:"batch_id"` // hex
+	TxHash  string `json:"tx_hash"`  // may be empty with Error
+	// Block is where the transaction was mined, Confirmations deep
+	Block         uint64    `json:"block,omitempty"`
+	Confirmations uint64    `json:"confirmations,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Code          errs.Code `json:"code,omitempty"` // of Error
+}
+
+// board keeps what the dashboard shows.
+type board struct {
+	mu     sync.Mutex
+	recent []*ProofRecord // oldest first, at most recentProofs
+	totals Totals
+	// expected prove times, moving averages: by profile, and per row over
+	// all profiles for those not proven yet
+	expected map[string]time.Duration
+	perRow   time.Duration
+}
+
+// add records a new proof request and returns its record; update it
+// through the board only.
+func (b *board) add(r ProofRecord) *ProofRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.recent) == recentProofs {
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	rec := &r
+	b.recent = append(b.recent, rec)
+	return rec
+}
+
+func (b *board) setStatus(r *ProofRecord, status string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r.Status = status
+	if status == StatusProving {
+		r.started = time.Now()
+	}
+}
+
+// done closes a proof request, err nil when a proof was made.
+func (b *board) done(r *ProofRecord, proveTime time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r.ProveTime = proveTime
+	if err != nil {
+		r.Status, r.Error = StatusFailed, err.Error()
+		b.totals.Failed++
+		return
+	}
+	r.Status = StatusProven
+	e := report.NewEconomics(r.N, proveTime, r.Cores)
+	b.totals.Proofs++
+	b.totals.Rows += r.N
+	b.totals.ProveTime += proveTime
+	b.totals.CostUSD += e.CostPerProof
+	b.totals.ValueUSD += e.BatchValue
+	b.totals.PercentCost = b.totals.CostUSD / b.totals.ValueUSD * 100
+	b.observe(r.Profile, r.N, proveTime)
+}
+
+// submitted marks the newest record of batchID as submitted, adding one for
+// proofs made elsewhere. A second report of the same transaction, e.g. its
+// confirmation, is counted once.
+func (b *board) submitted(batchID, txHash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.recent) - 1; i >= 0; i-- {
+		if r := b.recent[i]; r.BatchID == batchID {
+			if r.Status != StatusSubmitted || r.TxHash != txHash {
+				b.totals.Submitted++
+			}
+			r.Status, r.TxHash = StatusSubmitted, txHash
+			return
+		}
+	}
+	b.totals.Submitted++
+	if len(b.recent) == recentProofs {
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	b.recent = append(b.recent, &ProofRecord{BatchID: batchID, Time: time.Now(), Status: StatusSubmitted, TxHash: txHash})
+}
+
+func (b *board) status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := Status{Recent: make([]ProofRecord, 0, len(b.recent)), Totals: b.totals, Backlog: b.backlog(time.Now())}
+	for i := len(b.recent) - 1; i >= 0; i-- {
+		r := *b.recent[i]
+		if r.Status == StatusQueued {
+			st.Queue++
+		}
+		st.Recent = append(st.Recent, r)
+	}
+	return st
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := s.board.status()
+	st.ProveStats = s.proveStats()
+	if s.sla != nil {
+		st.SLA = s.sla.stats()
+	}
+	if s.cache != nil {
+		cs := s.cache.Stats()
+		st.VerifyCache = &cs
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleSubmitted(w http.ResponseWriter, r *http.Request) {
+	var req SubmittedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err))
+		return
+	}
+	id := strings.TrimPrefix(req.BatchID, "0x")
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != 32 || (req.TxHash == "" && req.Error == "") {
+		writeError(w, fmt.Errorf("%w: want a 32-byte hex batch_id and a tx_hash or an error", errs.ErrInvalidInput))
+		return
+	}
+	s.emitSubmitted([32]byte(b), req)
+	if req.Error == "" {
+		s.board.submitted(strings.ToLower(id), req.TxHash)
+		s.intakeAdvance(strings.ToLower(id), req.TxHash)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTmpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"short": func(s string) string {
+		if len(s) > 16 {
+			return s[:16] + "…"
+		}
+		return s
+	},
+	"ms": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"seconds": func(s float64) string {
+		return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+	},
+}).Parse(dashboardHTML))
+
+// handleDashboard renders the operator page: recent proofs, queue depth and
+// cumulative economics. It reloads itself; GET /status has the same data.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	st := s.board.status()
+	st.ProveStats = s.proveStats()
+	if s.sla != nil {
+		st.SLA = s.sla.stats()
+	}
+	if err := dashboardTmpl.Execute(w, st); err != nil {
+		log.Printf("dashboard: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/events"
+	"gnarking/events/eventspb"
+)
+
+// EnableEvents appends the lifecycle of every job to l (queued, proven or
+// failed, submitted, confirmed) and serves it on GET /events. Call it
+// before serving.
+func (s *Server) EnableEvents(l *events.Log) { s.events = l }
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, fmt.Errorf("%w: events are not enabled", errs.ErrNotFound))
+		return
+	}
+	events.Serve(w, r, s.events)
+}
+
+// emit appends e to the event log when there is one. The log follows jobs,
+// it does not gate them: an append error is logged.
+func (s *Server) emit(batchID [32]byte, profile string, e *eventspb.Event) {
+	if s.events == nil {
+		return
+	}
+	e.BatchId, e.Profile = batchID[:], profile
+	if _, err := s.events.Append(e); err != nil {
+		log.Printf("events: batch %x: %v", batchID[:8], err)
+	}
+}
+
+func (s *Server) emitJobSubmitted(p *proving, pub circuit.SettlementCircuitPublic, batchID [32]byte, cores int) {
+	if s.events == nil {
+		return
+	}
+	var fields circuit.SettlementCircuitPublicJSON
+	if b, err := json.Marshal(pub); err == nil {
+		json.Unmarshal(b, &fields)
+	}
+	s.emit(batchID, p.profile.Name, &eventspb.Event{Kind: &eventspb.Event_JobSubmitted{JobSubmitted: &eventspb.JobSubmitted{
+		Rows:        uint32(p.profile.N),
+		Cores:       uint32(cores),
+		Recipient:   fields.Recipient,
+		KOld:        fieldString(fields.KOld),
+		M:           fieldString(fields.M),
+		TotalSettle: fieldString(fields.TotalSettle),
+		ChainId:     fieldString(fields.ChainID),
+	}}})
+}
+
+func fieldString(f circuit.FieldJSON) string { return (*big.Int)(&f).String() }
+
+// emitProven is ProofReady for resp, or Failed at the prove stage for err.
+func (s *Server) emitProven(p *proving, batchID [32]byte, resp ProveResponse, proveTime time.Duration, err error) {
+	if s.events == nil {
+		return
+	}
+	if err != nil {
+		s.emit(batchID, p.profile.Name, failedEvent(eventspb.Stage_STAGE_PROVE, err.Error(), errs.CodeOf(err)))
+		return
+	}
+	proof, _ := hex.DecodeString(resp.Proof)
+	s.emit(batchID, p.profile.Name, &eventspb.Event{Kind: &eventspb.Event_ProofReady{ProofReady: &eventspb.ProofReady{
+		Proof:     proof,
+		ProveTime: durationpb.New(proveTime),
+		Cores:     uint32(resp.Cores),
+	}}})
+}
+
+// emitSubmitted is the event of a POST /submitted report.
+func (s *Server) emitSubmitted(batchID [32]byte, req SubmittedRequest) {
+	var e *eventspb.Event
+	switch {
+	case req.Error != "":
+		e = failedEvent(eventspb.Stage_STAGE_SUBMIT, req.Error, req.Code)
+	case req.Block != 0:
+		e = &eventspb.Event{Kind: &eventspb.Event_Confirmed{Confirmed: &eventspb.Confirmed{TxHash: req.TxHash, Block: req.Block, Confirmations: req.Confirmations}}}
+	default:
+		e = &eventspb.Event{Kind: &eventspb.Event_Submitted{Submitted: &eventspb.Submitted{TxHash: req.TxHash}}}
+	}
+	s.emit(batchID, "", e)
+}
+
+func failedEvent(stage eventspb.Stage, msg string, code errs.Code) *eventspb.Event {
+	return &eventspb.Event{Kind: &eventspb.Event_Failed{Failed: &eventspb.Failed{Stage: stage, Code: string(code), Error: msg}}}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gnarking/errs"
+	"gnarking/events"
+	"gnarking/events/eventspb"
+)
+
+func TestSubmittedEvents(t *testing.T) {
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+	if w := get(h, "/events"); w.Code != http.StatusNotFound {
+		t.Fatalf("GET /events without a log: %d, want 404", w.Code)
+	}
+	l, err := events.Open(filepath.Join(t.TempDir(), "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s.EnableEvents(l)
+
+	id := strings.Repeat("ab", 32)
+	for _, req := range []SubmittedRequest{
+		{BatchID: id, TxHash: "0x01"},
+		{BatchID: id, TxHash: "0x01", Block: 7, Confirmations: 3},
+		{BatchID: id, Error: "reverted", Code: errs.CodeOf(errs.ErrStaleNonce)},
+	} {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/submitted", bytes.NewReader(body)))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("POST /submitted %+v: %d %s", req, w.Code, w.Body)
+		}
+	}
+	// the confirmation of a reported transaction is not a second submission
+	if st := s.board.status(); st.Totals.Submitted != 1 {
+		t.Errorf("%d submitted, want 1", st.Totals.Submitted)
+	}
+
+	w := get(h, "/events?follow=0")
+	if ct := w.Header().Get("Content-Type"); ct != events.ContentType {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	r := events.NewReader(w.Body)
+	var kinds []string
+	for {
+		e, err := r.Next()
+		if err != nil {
+			break
+		}
+		if b := e.BatchId; len(b) != 32 || b[0] != 0xab {
+			t.Fatalf("event %d: batch ID %x", e.Seq, b)
+		}
+		kinds = append(kinds, events.Kind(e))
+		if f := e.GetFailed(); f != nil && (f.Stage != eventspb.Stage_STAGE_SUBMIT || f.Code != string(errs.CodeOf(errs.ErrStaleNonce))) {
+			t.Errorf("failed event %v", f)
+		}
+	}
+	if strings.Join(kinds, ",") != "submitted,confirmed,failed" {
+		t.Fatalf("events %v", kinds)
+	}
+}
+
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
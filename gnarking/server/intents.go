@@ -0,0 +1,118 @@
+package server
+
+import (
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/intake"
+)
+
+// IntentResponse is the reply of POST /intents and GET /intents/{pk}/{nonce}.
+type IntentResponse struct {
+	Code      errs.Code      `json:"code"`
+	Error     string         `json:"error,omitempty"`
+	Duplicate bool           `json:"duplicate,omitempty"` // the key was taken; Intent is the original
+	Intent    *intake.Record `json:"intent,omitempty"`
+}
+
+// handleIntent takes one signed intent, checked against the message version
+// of its profile, which must be proven here. Resubmitting an intent is
+// idempotent: the reply is 200 with duplicate set and the original's
+// record. A different intent under the same (pk, nonce) is 409 duplicate,
+// also with the original's record. A profile not proven here is 404: the
+// server is wrong for the intent, not the intent.
+func (s *Server) handleIntent(w http.ResponseWriter, r *http.Request) {
+	if s.intake == nil {
+		writeIntentError(w, fmt.Errorf("%w: intake is not enabled", errs.ErrNotFound))
+		return
+	}
+	var in intake.Intent
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeIntentError(w, decodeError(err))
+		return
+	}
+	p, err := s.prover(in.Profile)
+	if err != nil {
+		// not the intent's fault: another server may take it
+		writeIntentError(w, fmt.Errorf("%w: profile %q is not proven here", errs.ErrNotFound, cmp.Or(in.Profile, circuit.DefaultProfile)))
+		return
+	}
+	in.Profile = p.profile.Name
+	rec, dup, err := s.intake.Submit(in, p.profile.Msg)
+	if !dup && err != nil {
+		writeIntentError(w, err)
+		return
+	}
+	resp := IntentResponse{Code: errs.CodeOf(err), Duplicate: dup, Intent: &rec}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	writeJSON(w, errs.HTTPStatus(err), resp)
+}
+
+// handleGetIntent is the record of an intent, its lifecycle so far.
+func (s *Server) handleGetIntent(w http.ResponseWriter, r *http.Request) {
+	if s.intake == nil {
+		writeIntentError(w, fmt.Errorf("%w: intake is not enabled", errs.ErrNotFound))
+		return
+	}
+	nonce, err := strconv.ParseUint(r.PathValue("nonce"), 10, 64)
+	if err != nil {
+		writeIntentError(w, fmt.Errorf("%w: nonce %q", errs.ErrInvalidInput, r.PathValue("nonce")))
+		return
+	}
+	k, err := intake.ParseKey(r.PathValue("pk"), nonce)
+	if err != nil {
+		writeIntentError(w, err)
+		return
+	}
+	rec, ok := s.intake.Get(k)
+	if !ok {
+		writeIntentError(w, fmt.Errorf("%w: no intent %s/%d", errs.ErrNotFound, k.Pk, k.Nonce))
+		return
+	}
+	writeJSON(w, http.StatusOK, IntentResponse{Code: errs.CodeOK, Intent: &rec})
+}
+
+// intakeBatched marks the intents among req's rows as batched in batchID.
+// Intake follows batches, it does not gate them: a journal error is logged.
+func (s *Server) intakeBatched(profile string, req *ProveRequest, batchID [32]byte) {
+	if s.intake == nil {
+		return
+	}
+	rows := make([]intake.Intent, len(req.Rows))
+	for i, row := range req.Rows {
+		rows[i] = intake.Intent{Profile: profile, Pk: req.Pk, Recipient: req.Recipient, ChainID: req.ChainID, Size: row.Size, Nonce: row.Nonce, Sig: row.Sig}
+	}
+	if _, err := s.intake.Batched(hex.EncodeToString(batchID[:]), rows); err != nil {
+		log.Printf("intake: batch %x: %v", batchID, err)
+	}
+}
+
+// intakeAdvance moves the intents of batchID, hex, on to proven, or to
+// settled when txHash is set.
+func (s *Server) intakeAdvance(batchID, txHash string) {
+	if s.intake == nil {
+		return
+	}
+	var err error
+	if txHash == "" {
+		_, err = s.intake.Proven(batchID)
+	} else {
+		_, err = s.intake.Settled(batchID, txHash)
+	}
+	if err != nil {
+		log.Printf("intake: batch %s: %v", batchID, err)
+	}
+}
+
+func writeIntentError(w http.ResponseWriter, err error) {
+	writeJSON(w, errs.HTTPStatus(err), IntentResponse{Code: errs.CodeOf(err), Error: err.Error()})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"gnarking/errs"
+	"gnarking/lint"
+)
+
+// EnableLint checks every batch of POST /prove, /prove/multi and the
+// sessions against l before building its witness, the rules of the
+// batch's profile and of the tenant the request's lint.TenantHeader names
+// included. A batch breaking any is refused with ErrPolicyRejected and the
+// violations in the response. POST /prove/witness, whose rows the server
+// never sees, is refused whenever rules apply to it. Call it before
+// serving.
+func (s *Server) EnableLint(l *lint.Linter) { s.lint = l }
+
+// lintBatch checks req, a batch of profile, against the lint rules.
+func (s *Server) lintBatch(r *http.Request, profile string, req *ProveRequest) error {
+	if s.lint == nil {
+		return nil
+	}
+	b, err := LintBatch(profile, r.Header.Get(lint.TenantHeader), req)
+	if err != nil {
+		return err
+	}
+	return s.lint.Check(b)
+}
+
+// LintBatch is what lint rules see of req, a batch of profile for tenant.
+func LintBatch(profile, tenant string, req *ProveRequest) (*lint.Batch, error) {
+	recipient, ok := new(big.Int).SetString(strings.TrimPrefix(req.Recipient, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("%w: recipient hex %q", errs.ErrInvalidInput, req.Recipient)
+	}
+	b := &lint.Batch{
+		Profile:   profile,
+		Tenant:    tenant,
+		Recipient: recipient,
+		ChainID:   req.ChainID,
+		KOld:      req.KOld,
+		Rows:      make([]lint.Row, len(req.Rows)),
+	}
+	for i, row := range req.Rows {
+		b.Rows[i] = lint.Row{Size: row.Size, Nonce: row.Nonce}
+	}
+	return b, nil
+}
+
+// violations are the lint violations err reports, if any.
+func violations(err error) []lint.Violation {
+	var rep *lint.Report
+	if errors.As(err, &rep) {
+		return rep.Violations
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/lint"
+)
+
+// TestLintWitness checks a client-built witness, whose rows lint cannot see,
+// is refused while rules apply to its profile or tenant, and let through to
+// be read otherwise.
+func TestLintWitness(t *testing.T) {
+	profile, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := lint.New(lint.Config{
+		Profiles: map[string][]lint.RuleConfig{"other": {{Batch: "n > 0"}}},
+		Tenants:  map[string][]lint.RuleConfig{"acme": {{Row: "size < 100"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// never proven: admission or the empty witness stops it first
+	s.provers[profile.Name] = &proving{profile: profile}
+	s.EnableLint(l)
+	h := s.Handler()
+
+	for _, tc := range []struct {
+		tenant string
+		status int
+		code   errs.Code
+	}{
+		{"acme", http.StatusForbidden, errs.CodePolicyRejected},
+		{"", http.StatusBadRequest, errs.CodeInvalidInput},
+	} {
+		req := httptest.NewRequest("POST", "/prove/witness", strings.NewReader(""))
+		if tc.tenant != "" {
+			req.Header.Set(lint.TenantHeader, tc.tenant)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp ProveResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("tenant %q: %v: %s", tc.tenant, err, rec.Body)
+		}
+		if rec.Code != tc.status || resp.Code != tc.code {
+			t.Errorf("tenant %q: %d %s, want %d %s", tc.tenant, rec.Code, rec.Body, tc.status, tc.code)
+		}
+	}
+}
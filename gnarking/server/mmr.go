@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/mmr"
+)
+
+// EnableMMR appends the BatchDataRoot of every batch proven from now on to
+// m, and serves its commitment on GET /mmr and inclusion proofs on GET
+// /mmr/{batch}. Call it before serving.
+func (s *Server) EnableMMR(m *mmr.MMR) { s.mmr = m }
+
+// mmrAppend adds a proven batch to the range when there is one. The range
+// records proofs, it does not gate them: an append error is logged, and a
+// batch proven again is already a leaf.
+func (s *Server) mmrAppend(p *proving, pub circuit.SettlementCircuitPublic) {
+	if s.mmr == nil {
+		return
+	}
+	if _, err := s.mmr.AppendPublic(pub, p.profile.Name); err != nil && !errors.Is(err, errs.ErrDuplicate) {
+		log.Printf("mmr: %v", err)
+	}
+}
+
+// handleMMR serves the range's State, of its first ?leaves= leaves when
+// given.
+func (s *Server) handleMMR(w http.ResponseWriter, r *http.Request) {
+	if s.mmr == nil {
+		writeError(w, fmt.Errorf("%w: the batch root range is not enabled", errs.ErrNotFound))
+		return
+	}
+	leaves, err := leavesParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	st, err := s.mmr.State(leaves)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &st)
+}
+
+// handleMMRProof serves the inclusion proof of a batch, by its hex ID,
+// against the range's root, or that of its first ?leaves= leaves.
+func (s *Server) handleMMRProof(w http.ResponseWriter, r *http.Request) {
+	if s.mmr == nil {
+		writeError(w, fmt.Errorf("%w: the batch root range is not enabled", errs.ErrNotFound))
+		return
+	}
+	leaves, err := leavesParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	p, err := s.mmr.Prove(r.PathValue("batch"), leaves)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func leavesParam(r *http.Request) (uint64, error) {
+	q := r.URL.Query().Get("leaves")
+	if q == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(q, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: leaves %q", errs.ErrInvalidInput, q)
+	}
+	return n, nil
+}
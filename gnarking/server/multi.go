@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/lint"
+	"gnarking/prover"
+	"gnarking/statediff"
+	"gnarking/tracing"
+)
+
+// MaxMultiBatches caps the batches of one POST /prove/multi: they are
+// proven one after the other while the client waits.
+const MaxMultiBatches = 64
+
+// MultiProveRequest is the body of POST /prove/multi: independent signed
+// batches of one profile, proven in order and submitted together.
+type MultiProveRequest struct {
+	Profile string         `json:"profile,omitempty"` // circuit.DefaultProfile when empty; batches leave theirs empty or the same
+	Batches []ProveRequest `json:"batches"`
+}
+
+// MultiProveResponse is the reply of POST /prove/multi, or the data of the
+// final "result" event when streamed.
+type MultiProveResponse struct {
+	Code   errs.Code        `json:"code"`
+	Error  string           `json:"error,omitempty"`
+	Proofs []ProveResponse  `json:"proofs,omitempty"` // per batch, in order
+	Multi  *artifacts.Multi `json:"multi,omitempty"`  // the combined submission
+	// StateDiff is what settling Multi does, as for POST /prove
+	StateDiff *statediff.Diff `json:"state_diff,omitempty"`
+	// Violations are the lint rules the refused batch breaks, as for POST /prove
+	Violations []lint.Violation `json:"violations,omitempty"`
+}
+
+// MultiProgress is a "progress" event of POST /prove/multi.
+type MultiProgress struct {
+	Batch int `json:"batch"` // index into the request's batches
+	prover.Progress
+}
+
+type multiBatch struct {
+	wit     witness.Witness
+	pub     circuit.SettlementCircuitPublic
+	batchID [32]byte
+}
+
+// handleProveMulti proves up to MaxMultiBatches batches and replies with
+// their proofs and one artifacts.Multi, so a multicall contract verifies
+// them in one transaction. Every batch is built and checked before the
+// first is proven; a batch failing to prove fails the whole request.
+// Streaming is as for POST /prove, progress events carrying MultiProgress.
+func (s *Server) handleProveMulti(w http.ResponseWriter, r *http.Request) {
+	var req MultiProveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMultiError(w, decodeError(err))
+		return
+	}
+	if len(req.Batches) == 0 || len(req.Batches) > MaxMultiBatches {
+		writeMultiError(w, fmt.Errorf("%w: %d batches, want 1 to %d", errs.ErrInvalidInput, len(req.Batches), MaxMultiBatches))
+		return
+	}
+	p, err := s.prover(req.Profile)
+	if err != nil {
+		writeMultiError(w, err)
+		return
+	}
+	cores, err := s.jobCores(r)
+	if err != nil {
+		writeMultiError(w, err)
+		return
+	}
+	block, err := blockTarget(r)
+	if err != nil {
+		writeMultiError(w, err)
+		return
+	}
+	// the deadline is the request's, shared by its batches
+	deadline, err := s.jobDeadline(r, p.profile.Name, time.Now())
+	if err != nil {
+		writeMultiError(w, err)
+		return
+	}
+
+	batches := make([]multiBatch, len(req.Batches))
+	seen := make(map[[32]byte]int, len(batches))
+	for i := range req.Batches {
+		if err := s.admitBatch(r, p.profile.Name, &req.Batches[i]); err != nil {
+			writeMultiError(w, fmt.Errorf("batch %d: %w", i, err))
+			return
+		}
+		b, err := newMultiBatch(p, &req.Batches[i])
+		if err != nil {
+			writeMultiError(w, fmt.Errorf("batch %d: %w", i, err))
+			return
+		}
+		// the contract settles a batch once, the second copy would revert the call
+		if j, ok := seen[b.batchID]; ok {
+			writeMultiError(w, fmt.Errorf("%w: batch %d repeats batch %d", errs.ErrInvalidBatch, i, j))
+			return
+		}
+		seen[b.batchID] = i
+		batches[i] = b
+	}
+	// a recipient's batches must chain KOld, or the call would revert
+	pubs := make([]circuit.SettlementCircuitPublic, len(batches))
+	for i, b := range batches {
+		pubs[i] = b.pub
+	}
+	diff, err := statediff.New(p.profile, block, pubs...)
+	if err != nil {
+		writeMultiError(w, err)
+		return
+	}
+	for i, b := range batches {
+		s.intakeBatched(p.profile.Name, &req.Batches[i], b.batchID)
+	}
+
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), tracing.Carrier(r.Header)), "POST "+r.URL.Path,
+		tracing.Profile(p.profile.Name), tracing.N(p.profile.N))
+	defer span.End()
+
+	event, stream := eventStream(w, r)
+	resp, err := func() (MultiProveResponse, error) {
+		resp := MultiProveResponse{Code: errs.CodeOK, Proofs: make([]ProveResponse, len(batches))}
+		entries := make([]artifacts.MultiBatch, len(batches))
+		for i, b := range batches {
+			pr, proof, err := s.queued(ctx, p, b.wit, b.pub, b.batchID, cores, deadline, func(pr prover.Progress) {
+				event("progress", MultiProgress{Batch: i, Progress: pr})
+			})
+			if err != nil {
+				return resp, fmt.Errorf("batch %d: %w", i, err)
+			}
+			resp.Proofs[i] = pr
+			if entries[i], err = multiEntry(b, proof); err != nil {
+				return resp, fmt.Errorf("batch %d: %w", i, err)
+			}
+		}
+		resp.Multi, err = artifacts.NewMulti(p.profile.Name, entries)
+		resp.StateDiff = diff
+		return resp, err
+	}()
+	if err != nil {
+		resp = MultiProveResponse{Code: errs.CodeOf(err), Error: err.Error()}
+	}
+	if stream {
+		event("result", resp)
+		return
+	}
+	writeJSON(w, errs.HTTPStatus(err), resp)
+}
+
+// newMultiBatch builds one batch of a multi request for p.
+func newMultiBatch(p *proving, req *ProveRequest) (multiBatch, error) {
+	if req.Profile != "" && req.Profile != p.profile.Name {
+		return multiBatch{}, fmt.Errorf("%w: profile %q in a request for %q", errs.ErrInvalidInput, req.Profile, p.profile.Name)
+	}
+	assignment, err := buildBatch(p.profile, req)
+	if err != nil {
+		return multiBatch{}, err
+	}
+	wit, pub, err := batchWitness(p.profile, assignment, req.Variant)
+	if err != nil {
+		return multiBatch{}, err
+	}
+	batchID, err := circuit.BatchID(pub)
+	if err != nil {
+		return multiBatch{}, err
+	}
+	return multiBatch{wit: wit, pub: pub, batchID: batchID}, nil
+}
+
+// multiEntry is b, proven by proof, as the contract takes it.
+func multiEntry(b multiBatch, proof *groth16_bn254.Proof) (artifacts.MultiBatch, error) {
+	words, err := artifacts.NewProofWrap(proof)
+	if err != nil {
+		return artifacts.MultiBatch{}, err
+	}
+	pubWit, err := b.wit.Public()
+	if err != nil {
+		return artifacts.MultiBatch{}, err
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(pubWit)
+	if err != nil {
+		return artifacts.MultiBatch{}, err
+	}
+	return artifacts.MultiBatch{BatchID: hex.EncodeToString(b.batchID[:]), Proof: words, Inputs: inputs}, nil
+}
+
+func writeMultiError(w http.ResponseWriter, err error) {
+	writeJSON(w, errs.HTTPStatus(err), MultiProveResponse{Code: errs.CodeOf(err), Error: err.Error(), Violations: violations(err)})
+}
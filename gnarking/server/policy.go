@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"gnarking/errs"
+	"gnarking/lint"
+	"gnarking/prover"
+)
+
+// EnablePolicy refuses every batch of POST /prove, /prove/multi and the
+// sessions that p refuses, checked on the rows as received, before lint
+// and before its witness is built; ddm stream's batches come in through
+// POST /prove. POST /prove/witness, whose rows the server never sees, is
+// refused altogether while a policy is set. Call it before serving.
+func (s *Server) EnablePolicy(p prover.Policy) { s.policy = p }
+
+// admitBatch checks req, a batch of profile, against the policy and then
+// the lint rules, whichever are enabled.
+func (s *Server) admitBatch(r *http.Request, profile string, req *ProveRequest) error {
+	if s.policy != nil {
+		b, err := PolicyBatch(req)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.Check(b); err != nil {
+			return err
+		}
+	}
+	return s.lintBatch(r, profile, req)
+}
+
+// admitWitness is admitBatch for POST /prove/witness, a client-built witness
+// of profile: its rows are never seen, so it is refused while a policy is
+// set or lint rules apply to the profile or the request's tenant.
+func (s *Server) admitWitness(r *http.Request, profile string) error {
+	if s.policy != nil {
+		return fmt.Errorf("%w: a client-built witness cannot be checked against the prover's policy", errs.ErrPolicyRejected)
+	}
+	if s.lint == nil {
+		return nil
+	}
+	if n := s.lint.Rules(profile, r.Header.Get(lint.TenantHeader)); n > 0 {
+		return fmt.Errorf("%w: a client-built witness cannot be checked against %d lint rules", errs.ErrPolicyRejected, n)
+	}
+	return nil
+}
+
+// PolicyBatch is what a prover.Policy sees of req.
+func PolicyBatch(req *ProveRequest) (prover.Batch, error) {
+	recipient, ok := new(big.Int).SetString(strings.TrimPrefix(req.Recipient, "0x"), 16)
+	if !ok {
+		return prover.Batch{}, fmt.Errorf("%w: recipient hex %q", errs.ErrInvalidInput, req.Recipient)
+	}
+	b := prover.Batch{Recipient: recipient, ChainID: new(big.Int).SetUint64(req.ChainID), Sizes: make([]*big.Int, len(req.Rows))}
+	for i, row := range req.Rows {
+		b.Sizes[i] = new(big.Int).SetUint64(row.Size)
+	}
+	return b, nil
+}
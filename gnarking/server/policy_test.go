@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/prover"
+)
+
+// TestPolicyRefused checks a batch the policy refuses is refused on every
+// intake path, before its rows are even parsed into a witness.
+func TestPolicyRefused(t *testing.T) {
+	profile, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// never proven: the policy refuses first
+	s.provers[profile.Name] = &proving{profile: profile}
+	s.EnablePolicy(&prover.Rules{ChainIDs: []uint64{1}})
+	h := s.Handler()
+
+	// on chain 8453, which the policy does not allow; the signatures are
+	// never looked at
+	batch := ProveRequest{Recipient: "2a", ChainID: 8453, Pk: strings.Repeat("00", 32), Rows: make([]ProveRow, profile.N)}
+	for i := range batch.Rows {
+		batch.Rows[i] = ProveRow{Size: 1, Nonce: uint64(i + 1), Sig: strings.Repeat("00", 64)}
+	}
+	post := func(path string, body any) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", path, bytes.NewReader(data)))
+		return rec
+	}
+	refused := func(path string, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		var resp struct {
+			Code errs.Code `json:"code"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, rec.Body)
+		}
+		if rec.Code != http.StatusForbidden || resp.Code != errs.CodePolicyRejected {
+			t.Fatalf("%s: %d %s, want 403 %s", path, rec.Code, rec.Body, errs.CodePolicyRejected)
+		}
+	}
+
+	refused("/prove", post("/prove", batch))
+	refused("/prove/multi", post("/prove/multi", MultiProveRequest{Batches: []ProveRequest{batch}}))
+
+	rec := post("/sessions", SessionTemplate{Recipient: batch.Recipient, ChainID: batch.ChainID, Pk: batch.Pk})
+	var sess SessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &sess); err != nil || sess.ID == "" {
+		t.Fatalf("open session: %v: %s", err, rec.Body)
+	}
+	refused("/sessions/{id}/prove", post("/sessions/"+sess.ID+"/prove", ProveRequest{Rows: batch.Rows}))
+
+	// a client-built witness hides its rows from the policy
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/prove/witness", strings.NewReader("")))
+	refused("/prove/witness", rec)
+}
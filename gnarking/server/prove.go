@@ -0,0 +1,608 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	stdEddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/lint"
+	"gnarking/prover"
+	"gnarking/statediff"
+	"gnarking/tracing"
+)
+
+// ProveRequest is the body of POST /prove: one signed batch of the profile's
+// size. M, TotalSettle and BatchDataRoot are derived from the rows.
+// Sizes are base units, what rows sign; a deployment with a size scale
+// (circuit.Params) has them written as decimals in JSON ("1.25"), and its
+// requests say so with a matching SizeScale.
+type ProveRequest struct {
+	Profile   string     `json:"profile,omitempty"` // circuit.DefaultProfile when empty
+	Recipient string     `json:"recipient"`         // hex
+	ChainID   uint64     `json:"chain_id"`
+	KOld      uint64     `json:"k_old"`
+	Pk        string     `json:"pk"`                   // hex, 32-byte compressed EdDSA public key
+	KeyPath   string     `json:"key_path,omitempty"`   // keys.Path Pk was derived at, recorded only
+	SizeScale int        `json:"size_scale,omitempty"` // decimal places of the sizes in JSON, the deployment's
+	Rows      []ProveRow `json:"rows"`
+	// Variant is the inputs of the profile's circuit.Variant beyond the
+	// rows, in whatever form it reads them
+	Variant json.RawMessage `json:"variant,omitempty"`
+}
+
+type ProveRow struct {
+	Size  uint64 `json:"size"` // base units; in JSON a decimal at the request's SizeScale
+	Nonce uint64 `json:"nonce"`
+	Sig   string `json:"sig"` // hex, 64-byte EdDSA signature of the row message
+}
+
+// jsonRow is a ProveRow as JSON has it, the size a number or a decimal
+// string.
+type jsonRow struct {
+	Size  json.RawMessage `json:"size"`
+	Nonce uint64          `json:"nonce"`
+	Sig   string          `json:"sig"`
+}
+
+// MarshalJSON writes the sizes as decimal strings when r has a SizeScale,
+// so "1.25" at scale 6 round-trips as 1250000 base units.
+func (r ProveRequest) MarshalJSON() ([]byte, error) {
+	type plain ProveRequest
+	var rows []jsonRow
+	if r.Rows != nil {
+		rows = make([]jsonRow, len(r.Rows))
+	}
+	for i, row := range r.Rows {
+		size := circuit.FormatDecimal(new(big.Int).SetUint64(row.Size), r.SizeScale)
+		if r.SizeScale > 0 {
+			size = strconv.Quote(size)
+		}
+		rows[i] = jsonRow{Size: json.RawMessage(size), Nonce: row.Nonce, Sig: row.Sig}
+	}
+	return json.Marshal(struct {
+		plain
+		Rows []jsonRow `json:"rows"`
+	}{plain(r), rows})
+}
+
+// UnmarshalJSON reads each size, a number or a string, as a decimal at the
+// request's SizeScale (circuit.ParseDecimal): without one only integers
+// parse. A size past uint64 in base units is ErrInvalidInput.
+func (r *ProveRequest) UnmarshalJSON(b []byte) error {
+	type plain ProveRequest
+	v := struct {
+		*plain
+		Rows []jsonRow `json:"rows"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.Rows = nil
+	if v.Rows != nil {
+		r.Rows = make([]ProveRow, len(v.Rows))
+	}
+	for i, row := range v.Rows {
+		size, err := parseSize(row.Size, r.SizeScale)
+		if err != nil {
+			return fmt.Errorf("row %d size: %w", i, err)
+		}
+		r.Rows[i] = ProveRow{Size: size, Nonce: row.Nonce, Sig: row.Sig}
+	}
+	return nil
+}
+
+// decodeError is a JSON body's decoding error as ErrInvalidInput, which
+// the sizes' already are.
+func decodeError(err error) error {
+	if err == nil || errors.Is(err, errs.ErrInvalidInput) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+}
+
+// parseSize is the base units of a JSON size literal at scale; missing or
+// null is 0, as for any JSON number.
+func parseSize(raw json.RawMessage, scale int) (uint64, error) {
+	s := string(raw)
+	if len(raw) == 0 || s == "null" {
+		return 0, nil
+	}
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+		}
+	}
+	v, err := circuit.ParseDecimal(s, scale)
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsUint64() {
+		return 0, fmt.Errorf("%w: %s at %d decimals is %s base units, past uint64", errs.ErrInvalidInput, s, scale, v)
+	}
+	return v.Uint64(), nil
+}
+
+// ProveResponse is the reply of POST /prove, or the data of the final
+// "result" event when streamed.
+type ProveResponse struct {
+	Code   errs.Code       `json:"code"`
+	Error  string          `json:"error,omitempty"`
+	Proof  string          `json:"proof,omitempty"`  // hex of the framed proof file
+	Public json.RawMessage `json:"public,omitempty"` // public_N.json content
+	Cores  int             `json:"cores,omitempty"`  // the prove's core budget
+	// StateDiff is what settling the proof does, for indexers; the "block"
+	// query parameter sets its BlockTarget
+	StateDiff *statediff.Diff `json:"state_diff,omitempty"`
+	// Timings break the prove time down by phase
+	Timings *prover.Timings `json:"timings,omitempty"`
+	// Violations are the lint rules a refused batch breaks, see EnableLint
+	Violations []lint.Violation `json:"violations,omitempty"`
+}
+
+type proving struct {
+	profile     circuit.Profile
+	ccs         *cs_bn254.R1CS
+	pk          *groth16_bn254.ProvingKey
+	circuitHash [32]byte
+}
+
+// EnableProving serves POST /prove for profile.Name with the given ccs and
+// pk. profile must carry the settings the ccs was compiled with (see the
+// setup manifest). Safe to call while serving, for profiles loaded in the
+// background.
+func (s *Server) EnableProving(profile circuit.Profile, ccs *cs_bn254.R1CS, pk *groth16_bn254.ProvingKey) error {
+	if ccs.GetNbPublicVariables() == 0 || profile.N <= 0 {
+		return fmt.Errorf("%w: profile %s: empty circuit", errs.ErrArtifactMismatch, profile.Name)
+	}
+	if err := circuit.CheckHints(ccs); err != nil {
+		return fmt.Errorf("profile %s: %w", profile.Name, err)
+	}
+	h, err := artifacts.CircuitHash(ccs)
+	if err != nil {
+		return err
+	}
+	s.proveMu.Lock()
+	s.provers[profile.Name] = &proving{profile: profile, ccs: ccs, pk: pk, circuitHash: h}
+	s.proveMu.Unlock()
+	return nil
+}
+
+// handleProve proves one batch, sent as JSON or, with Content-Type
+// ContentTypeBatch, in the streamed binary form of prove.proto. With
+// "Accept: text/event-stream" the reply is a server-sent event stream:
+// "progress" events carrying prover.Progress (phases solve, msm, done) and a
+// final "result" event carrying the ProveResponse; otherwise it is the
+// ProveResponse alone.
+func (s *Server) handleProve(w http.ResponseWriter, r *http.Request) {
+	var req *ProveRequest
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), ContentTypeBatch) {
+		req, err = ReadBatch(r.Body, func(profile string) (int, error) {
+			p, err := s.prover(profile)
+			if err != nil {
+				return 0, err
+			}
+			return p.profile.N, nil
+		})
+	} else {
+		req = new(ProveRequest)
+		err = decodeError(json.NewDecoder(r.Body).Decode(req))
+	}
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if req.Profile == "" {
+		req.Profile = circuit.DefaultProfile
+	}
+	p, err := s.prover(req.Profile)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if err := s.admitBatch(r, p.profile.Name, req); err != nil {
+		writeProveError(w, err)
+		return
+	}
+	assignment, err := buildBatch(p.profile, req)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	wit, pub, err := batchWitness(p.profile, assignment, req.Variant)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if batchID, err := circuit.BatchID(pub); err == nil {
+		s.intakeBatched(p.profile.Name, req, batchID)
+	}
+	s.serveProof(w, r, p, wit, pub)
+}
+
+// handleProveWitness proves a witness built by the client, for a key host
+// whose pk must stay where it is: the body is the full witness in gnark's
+// binary form (witness.WriteTo), streamed, for the profile in the "profile"
+// query parameter. The reply is as for POST /prove. A server with a
+// policy refuses it: the rows are not there to check (EnablePolicy).
+func (s *Server) handleProveWitness(w http.ResponseWriter, r *http.Request) {
+	profile := cmp.Or(r.URL.Query().Get("profile"), circuit.DefaultProfile)
+	if err := s.admitWitness(r, profile); err != nil {
+		writeProveError(w, err)
+		return
+	}
+	p, err := s.prover(profile)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	wit, err := readWitness(r.Body, p.ccs)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	pub, err := circuit.PublicFromWitness(wit)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	s.serveProof(w, r, p, wit, pub)
+}
+
+// prover is the proving setup of profile, circuit.DefaultProfile when empty.
+func (s *Server) prover(profile string) (*proving, error) {
+	if profile == "" {
+		profile = circuit.DefaultProfile
+	}
+	s.proveMu.RLock()
+	p, ok := s.provers[profile]
+	s.proveMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: profile %q not proven here", errs.ErrInvalidInput, profile)
+	}
+	return p, nil
+}
+
+// readWitness reads a binary full witness for ccs. The header is checked
+// before the vector is read: its declared length is allocated as is.
+func readWitness(r io.Reader, ccs *cs_bn254.R1CS) (witness.Witness, error) {
+	var hdr [12]byte // nbPublic, nbSecret, vector length
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%w: witness header: %w", errs.ErrInvalidInput, err)
+	}
+	nbPublic, nbSecret := binary.BigEndian.Uint32(hdr[0:]), binary.BigEndian.Uint32(hdr[4:])
+	n := binary.BigEndian.Uint32(hdr[8:])
+	// the ccs counts the constant one wire as public, the witness does not
+	if int(nbPublic) != ccs.GetNbPublicVariables()-1 || int(nbSecret) != ccs.GetNbSecretVariables() || n != nbPublic+nbSecret {
+		return nil, fmt.Errorf("%w: witness of %d public and %d secret values, circuit takes %d and %d",
+			errs.ErrInvalidInput, nbPublic, nbSecret, ccs.GetNbPublicVariables()-1, ccs.GetNbSecretVariables())
+	}
+	wit, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := wit.ReadFrom(io.MultiReader(bytes.NewReader(hdr[:]), r)); err != nil {
+		return nil, fmt.Errorf("%w: witness: %w", errs.ErrInvalidInput, err)
+	}
+	return wit, nil
+}
+
+// serveProof queues wit for the prover and replies, streaming progress when
+// the client accepts it.
+func (s *Server) serveProof(w http.ResponseWriter, r *http.Request, p *proving, wit witness.Witness, pub circuit.SettlementCircuitPublic) {
+	batchID, err := circuit.BatchID(pub)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	cores, err := s.jobCores(r)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	block, err := blockTarget(r)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), tracing.Carrier(r.Header)), "POST "+r.URL.Path,
+		tracing.Profile(p.profile.Name), tracing.N(p.profile.N), tracing.BatchID(batchID))
+	defer span.End()
+
+	deadline, err := s.jobDeadline(r, p.profile.Name, time.Now())
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	event, stream := eventStream(w, r)
+	resp, _, err := s.queued(ctx, p, wit, pub, batchID, cores, deadline, func(pr prover.Progress) { event("progress", pr) })
+	if err == nil {
+		resp.StateDiff, err = statediff.New(p.profile, block, pub)
+	}
+	if err != nil {
+		resp = ProveResponse{Code: errs.CodeOf(err), Error: err.Error()}
+	}
+	if stream {
+		event("result", resp)
+		return
+	}
+	writeJSON(w, errs.HTTPStatus(err), resp)
+}
+
+// eventStream starts a server-sent event reply when the client accepts one;
+// event is a no-op otherwise.
+func eventStream(w http.ResponseWriter, r *http.Request) (event func(name string, v any), stream bool) {
+	flusher, stream := w.(http.Flusher)
+	stream = stream && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if !stream {
+		return func(string, any) {}, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return func(name string, v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		flusher.Flush()
+	}, true
+}
+
+// jobCores is the core budget of the prove r asks for: its "cores" query
+// parameter within the server's cap, the cap when absent.
+func (s *Server) jobCores(r *http.Request) (int, error) {
+	cores := prover.Cores(s.cores)
+	q := r.URL.Query().Get("cores")
+	if q == "" {
+		return cores, nil
+	}
+	n, err := strconv.Atoi(q)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w: cores %q is not a positive integer", errs.ErrInvalidInput, q)
+	}
+	return min(n, cores), nil
+}
+
+// blockTarget is the "block" query parameter of r, the chain head its batch
+// was built at, 0 when absent.
+func blockTarget(r *http.Request) (uint64, error) {
+	q := r.URL.Query().Get("block")
+	if q == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(q, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: block %q is not a block number", errs.ErrInvalidInput, q)
+	}
+	return n, nil
+}
+
+// queued proves wit on cores once the prover is free, recording it on the
+// dashboard, in the event log and against its deadline (zero for none)
+// and, when proven, in intake.
+func (s *Server) queued(ctx context.Context, p *proving, wit witness.Witness, pub circuit.SettlementCircuitPublic, batchID [32]byte, cores int, deadline time.Time, report func(prover.Progress)) (ProveResponse, *groth16_bn254.Proof, error) {
+	rec := s.board.add(ProofRecord{
+		BatchID:  hex.EncodeToString(batchID[:]),
+		Profile:  p.profile.Name,
+		N:        p.profile.N,
+		Cores:    cores,
+		Time:     time.Now(),
+		Status:   StatusQueued,
+		Deadline: deadline,
+	})
+	slaDone := s.watchDeadline(rec)
+	s.emitJobSubmitted(p, pub, batchID, cores)
+	// one proof at a time unless pipelined: past the depth another would
+	// only slow the rest down
+	if err := s.slots.Acquire(ctx); err != nil {
+		s.board.done(rec, 0, err)
+		slaDone(err)
+		s.emitProven(p, batchID, ProveResponse{}, 0, err)
+		return ProveResponse{}, nil, err
+	}
+	s.board.setStatus(rec, StatusProving)
+	start := time.Now()
+	resp, proof, err := s.proveRecorded(ctx, p, wit, pub, batchID, cores, report)
+	s.board.done(rec, time.Since(start), err)
+	slaDone(err)
+	s.emitProven(p, batchID, resp, time.Since(start), err)
+	s.slots.Release()
+	if err == nil {
+		s.intakeAdvance(hex.EncodeToString(batchID[:]), "")
+		s.mmrAppend(p, pub)
+	}
+	return resp, proof, err
+}
+
+func (s *Server) prove(ctx context.Context, p *proving, wit witness.Witness, pub circuit.SettlementCircuitPublic, batchID [32]byte, cores int, report func(prover.Progress)) (ProveResponse, *groth16_bn254.Proof, error) {
+	var timings *prover.Timings
+	proof, err := s.tracker.Prove(ctx, p.ccs, p.pk, wit, cores, func(pr prover.Progress) {
+		if pr.Phase == prover.PhaseDone {
+			timings = pr.Timings
+		}
+		report(pr)
+	})
+	if err != nil {
+		return ProveResponse{}, nil, err
+	}
+	s.phases.observe(p.profile.Name, timings)
+
+	hdr := artifacts.ProofHeader{
+		Version:     artifacts.ProofHeaderVersion,
+		Curve:       ecc.BN254,
+		Backend:     backend.GROTH16,
+		CircuitHash: p.circuitHash,
+		BatchID:     batchID,
+		Timestamp:   time.Now(),
+		Features:    uint32(p.profile.Features()),
+	}
+	var proofFile bytes.Buffer
+	if _, err := (&artifacts.Proof{Header: &hdr, Proof: proof}).WriteTo(&proofFile); err != nil {
+		return ProveResponse{}, nil, err
+	}
+	public, err := json.Marshal(pub)
+	if err != nil {
+		return ProveResponse{}, nil, err
+	}
+	return ProveResponse{Code: errs.CodeOK, Proof: hex.EncodeToString(proofFile.Bytes()), Public: public, Cores: cores, Timings: timings}, proof, nil
+}
+
+// BatchPublic is the public inputs of a proof of req under profile, derived
+// from its rows, and its variant inputs, as POST /prove derives them.
+func BatchPublic(profile circuit.Profile, req *ProveRequest) (circuit.SettlementCircuitPublic, error) {
+	c, err := buildBatch(profile, req)
+	if err != nil {
+		return circuit.SettlementCircuitPublic{}, err
+	}
+	if profile.Variant == nil {
+		return c.P, nil
+	}
+	_, pub, err := batchWitness(profile, c, req.Variant)
+	return pub, err
+}
+
+// BatchAssignment is the full assignment POST /prove would prove for req
+// under profile: public inputs derived from the rows, rows and signatures.
+func BatchAssignment(profile circuit.Profile, req *ProveRequest) (*circuit.SettlementCircuit, error) {
+	return buildBatch(profile, req)
+}
+
+// batchWitness is the witness of a batch of profile: assignment, its
+// settlement assignment, completed by the profile's variant from extra,
+// and the public inputs read back out of it, which a variant may have
+// changed (circuit.PrivateRecipient commits to the recipient).
+func batchWitness(profile circuit.Profile, assignment *circuit.SettlementCircuit, extra json.RawMessage) (witness.Witness, circuit.SettlementCircuitPublic, error) {
+	full, err := profile.Assign(assignment, extra)
+	if err != nil {
+		return nil, circuit.SettlementCircuitPublic{}, err
+	}
+	wit, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, circuit.SettlementCircuitPublic{}, fmt.Errorf("%w: %w", errs.ErrInvalidBatch, err)
+	}
+	pub, err := circuit.PublicFromWitness(wit)
+	if err != nil {
+		return nil, circuit.SettlementCircuitPublic{}, err
+	}
+	return wit, pub, nil
+}
+
+// buildBatch turns a request into a full assignment for profile.
+func buildBatch(profile circuit.Profile, req *ProveRequest) (*circuit.SettlementCircuit, error) {
+	if len(req.Rows) != profile.N {
+		return nil, fmt.Errorf("%w: %d rows, profile %s takes %d", errs.ErrInvalidBatch, len(req.Rows), profile.Name, profile.N)
+	}
+	t, err := newBatchTemplate(profile, req)
+	if err != nil {
+		return nil, err
+	}
+	return t.assign(req.KOld, req.Rows)
+}
+
+// batchTemplate is the part of an assignment every batch of one recipient,
+// chain and key shares, parsed and checked once: buildBatch makes one per
+// request, a session (POST /sessions) one for all its batches.
+type batchTemplate struct {
+	profile   circuit.Profile
+	recipient *big.Int
+	chainID   *big.Int
+	pk        stdEddsa.PublicKey // assigned, the point decompressed
+}
+
+// newBatchTemplate checks and parses req's batch-wide fields; its rows and
+// KOld are left to assign.
+func newBatchTemplate(profile circuit.Profile, req *ProveRequest) (*batchTemplate, error) {
+	// "2" means 2 whole units to a decimal deployment, 2 base units to others
+	if req.SizeScale != profile.SizeScale {
+		return nil, fmt.Errorf("%w: sizes at %d decimals, the deployment's are at %d", errs.ErrInvalidBatch, req.SizeScale, profile.SizeScale)
+	}
+	recipient, ok := new(big.Int).SetString(strings.TrimPrefix(req.Recipient, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("%w: recipient hex %q", errs.ErrInvalidInput, req.Recipient)
+	}
+	pkBytes, err := hex.DecodeString(strings.TrimPrefix(req.Pk, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: pk hex: %w", errs.ErrInvalidInput, err)
+	}
+	// Assign panics on malformed points, check them first
+	if _, err := new(bnEddsa.PublicKey).SetBytes(pkBytes); err != nil {
+		return nil, fmt.Errorf("%w: pk: %w", errs.ErrInvalidInput, err)
+	}
+	t := &batchTemplate{profile: profile, recipient: recipient, chainID: new(big.Int).SetUint64(req.ChainID)}
+	t.pk.Assign(te.BN254, pkBytes)
+	return t, nil
+}
+
+// assign is the full assignment of one batch of t: public inputs derived
+// from the rows, rows and signatures.
+func (t *batchTemplate) assign(kOld uint64, rows []ProveRow) (*circuit.SettlementCircuit, error) {
+	profile := t.profile
+	if len(rows) != profile.N {
+		return nil, fmt.Errorf("%w: %d rows, profile %s takes %d", errs.ErrInvalidBatch, len(rows), profile.Name, profile.N)
+	}
+	c := profile.Circuit()
+	c.P.Recipient = t.recipient
+	c.P.ChainID = t.chainID
+	c.P.KOld = new(big.Int).SetUint64(kOld)
+	c.P.Pk = t.pk
+
+	sizes := make([]*big.Int, profile.N)
+	nonces := make([]*big.Int, profile.N)
+	total, m := new(big.Int), new(big.Int)
+	for i, row := range rows {
+		sig, err := hex.DecodeString(strings.TrimPrefix(row.Sig, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d sig hex: %w", errs.ErrInvalidInput, i, err)
+		}
+		if _, err := new(bnEddsa.Signature).SetBytes(sig); err != nil {
+			return nil, fmt.Errorf("%w: row %d sig: %w", errs.ErrInvalidInput, i, err)
+		}
+		sizes[i] = new(big.Int).SetUint64(row.Size)
+		nonces[i] = new(big.Int).SetUint64(row.Nonce)
+		c.Size[i], c.Nonce[i] = sizes[i], nonces[i]
+		c.Sig[i].Assign(te.BN254, sig)
+		total.Add(total, sizes[i])
+		// the last nonce for monotonic batches, the largest row ID for unique ones
+		if nonces[i].Cmp(m) > 0 {
+			m = nonces[i]
+		}
+	}
+	// refused here rather than as an unsatisfied constraint after solving
+	if err := profile.Bounds.Check(c.P.KOld.(*big.Int), total, sizes, nonces); err != nil {
+		return nil, err
+	}
+	c.P.TotalSettle = total
+	c.P.M = m
+	var err error
+	if c.P.BatchDataRoot, err = circuit.RowsRoot(profile.DataHash, profile.Ordering, sizes, nonces); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func writeProveError(w http.ResponseWriter, err error) {
+	writeJSON(w, errs.HTTPStatus(err), ProveResponse{Code: errs.CodeOf(err), Error: err.Error(), Violations: violations(err)})
+}
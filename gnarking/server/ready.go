@@ -0,0 +1,61 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// ReadyResponse is the GET /ready reply: 200 when Ready, 503 while
+// profiles the server waits for are loading or after one failed to load.
+type ReadyResponse struct {
+	Ready   bool              `json:"ready"`
+	Loading []string          `json:"loading,omitempty"` // profile names
+	Failed  map[string]string `json:"failed,omitempty"`  // profile name to error
+}
+
+// warmth is the profiles readiness waits for.
+type warmth struct {
+	mu      sync.Mutex
+	loading map[string]bool
+	failed  map[string]string
+}
+
+// Warming holds back readiness until Warmed(profile) is called, for a
+// profile loaded in the background. Profiles that are not waited for can
+// be loaded in the background all the same; they are served once enabled.
+func (s *Server) Warming(profile string) {
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+	if s.warm.loading == nil {
+		s.warm.loading = make(map[string]bool)
+	}
+	s.warm.loading[profile] = true
+}
+
+// Warmed ends Warming(profile). With a non-nil err the server stays
+// unready, reporting it: what it was to wait for will not come.
+func (s *Server) Warmed(profile string, err error) {
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+	delete(s.warm.loading, profile)
+	if err != nil {
+		if s.warm.failed == nil {
+			s.warm.failed = make(map[string]string)
+		}
+		s.warm.failed[profile] = err.Error()
+	}
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.warm.mu.Lock()
+	resp := ReadyResponse{Loading: slices.Sorted(maps.Keys(s.warm.loading)), Failed: maps.Clone(s.warm.failed)}
+	s.warm.mu.Unlock()
+	resp.Ready = len(resp.Loading) == 0 && len(resp.Failed) == 0
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+	ready := func() (int, ReadyResponse) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+		var resp ReadyResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := ready(); code != http.StatusOK || !resp.Ready {
+		t.Fatalf("nothing to wait for: %d %+v", code, resp)
+	}
+	s.Warming("64")
+	s.Warming("512")
+	if code, resp := ready(); code != http.StatusServiceUnavailable || len(resp.Loading) != 2 {
+		t.Fatalf("loading: %d %+v", code, resp)
+	}
+	s.Warmed("64", nil)
+	s.Warmed("512", errors.New("no pk"))
+	if code, resp := ready(); code != http.StatusServiceUnavailable || len(resp.Loading) != 0 || resp.Failed["512"] != "no pk" {
+		t.Fatalf("failed: %d %+v", code, resp)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"gnarking/circuit"
+)
+
+// Schema is a JSON Schema (draft 2020-12) document.
+type Schema map[string]any
+
+func (s Schema) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// RequestSchema is the JSON Schema of p's POST /prove body (ProveRequest):
+// exactly N rows, hex encodings, and the maxima and row size floor of p's
+// Bounds, the same ones buildBatch checks. The bound on the total is not
+// expressible in JSON Schema and is only named in its description; neither
+// is the maximum of decimal sizes, given in whole units in theirs.
+func RequestSchema(p circuit.Profile) Schema {
+	bound := func(bits int) *big.Int {
+		hi := circuit.BoundMax(bits)
+		if hi == nil || bits > 64 {
+			// JSON numbers are read into uint64 whatever the bound
+			hi = new(big.Int).SetUint64(math.MaxUint64)
+		}
+		return hi
+	}
+	integer := func(bits int, desc string) Schema {
+		return Schema{"type": "integer", "minimum": 0, "maximum": json.Number(bound(bits).String()), "description": desc}
+	}
+	hex := func(pattern, desc string) Schema {
+		return Schema{"type": "string", "pattern": pattern, "description": desc}
+	}
+	desc := fmt.Sprintf("One signed batch of %d rows (bounds: %s).", p.N, p.Bounds)
+	if p.Bounds.TotalBits > 0 {
+		desc += fmt.Sprintf(" The sum of the row sizes must be below 2^%d base units.", p.Bounds.TotalBits)
+	}
+	required := []string{"recipient", "chain_id", "k_old", "pk", "rows"}
+	size := integer(p.Bounds.SizeBits, "row size")
+	if p.SizeScale > 0 {
+		required = append(required, "size_scale")
+		size = Schema{
+			"type":        []string{"string", "number"},
+			"pattern":     fmt.Sprintf(`^[0-9]+(\.[0-9]{1,%d})?$`, p.SizeScale),
+			"description": fmt.Sprintf("row size, a decimal of at most %d places, at most %s", p.SizeScale, circuit.FormatDecimal(bound(p.Bounds.SizeBits), p.SizeScale)),
+		}
+	}
+	if floor := p.Bounds.MinSize; floor > 0 {
+		desc += fmt.Sprintf(" Every row of a batch that is not empty settles at least %s.", circuit.FormatDecimal(new(big.Int).SetUint64(floor), p.SizeScale))
+		// an empty batch's rows are 0 whatever the floor
+		if p.SizeScale == 0 && !p.EmptyBatches {
+			size["minimum"] = floor
+		}
+	}
+	return Schema{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                fmt.Sprintf("POST /prove body, profile %s", p.Name),
+		"description":          desc,
+		"type":                 "object",
+		"required":             required,
+		"additionalProperties": false,
+		"properties": Schema{
+			"profile":    Schema{"const": p.Name},
+			"recipient":  hex("^(0x)?[0-9a-fA-F]{1,64}$", "recipient, hex"),
+			"chain_id":   integer(0, "chain the rows were signed for"),
+			"k_old":      integer(p.Bounds.NonceBits, "nonce settled up to before the batch"),
+			"pk":         hex("^(0x)?[0-9a-fA-F]{64}$", "32-byte compressed EdDSA public key, hex"),
+			"key_path":   Schema{"type": "string", "description": "keys.Path pk was derived at, recorded only"},
+			"size_scale": Schema{"const": p.SizeScale, "description": "decimal places of the row sizes, the deployment's"},
+			"rows": Schema{
+				"type":     "array",
+				"minItems": p.N,
+				"maxItems": p.N,
+				"items": Schema{
+					"type":                 "object",
+					"required":             []string{"size", "nonce", "sig"},
+					"additionalProperties": false,
+					"properties": Schema{
+						"size":  size,
+						"nonce": integer(p.Bounds.NonceBits, "row nonce"),
+						"sig":   hex("^(0x)?[0-9a-fA-F]{128}$", "64-byte EdDSA signature of the row message, hex"),
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,293 @@
+// Package server exposes settlement proof verification, and optionally
+// proving, over HTTP.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/audit"
+	"gnarking/chaos"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/events"
+	"gnarking/intake"
+	"gnarking/lint"
+	"gnarking/mmr"
+	"gnarking/prover"
+	"gnarking/report"
+	"gnarking/stats"
+	"gnarking/tracing"
+	"gnarking/verifier"
+)
+
+// VerifyRequest is the body of POST /verify.
+type VerifyRequest struct {
+	Profile string          `json:"profile,omitempty"` // circuit profile, circuit.DefaultProfile when empty
+	Proof   string          `json:"proof"`             // hex of a proof file, framed or legacy
+	Public  json.RawMessage `json:"public"`            // public_N.json content
+}
+
+// VerifyResponse is the reply of POST /verify.
+type VerifyResponse struct {
+	Valid       bool                `json:"valid"`
+	Code        errs.Code           `json:"code"`
+	Error       string              `json:"error,omitempty"`
+	Compression *report.Compression `json:"compression,omitempty"` // set when valid
+	Cached      bool                `json:"cached,omitempty"`      // answered from the verification cache
+}
+
+// Server verifies proofs of every profile it has a verifying key for, and
+// proves batches of the profiles proving was enabled for.
+type Server struct {
+	vkMu   sync.RWMutex
+	vks    map[string]servedVK // by profile name, swapped by SetVK
+	cache  *verifier.Cache     // nil disables result caching, see EnableCache
+	audit  *audit.Log          // nil disables audit logging
+	intake *intake.Log         // nil disables POST /intents, see EnableIntake
+	stats  *stats.Store        // nil records no proof statistics, see EnableStats
+	events *events.Log         // nil disables GET /events, see EnableEvents
+	sla    *slaTracker         // nil gives jobs no deadlines, see EnableSLA
+	lint   *lint.Linter        // nil checks no lint rules, see EnableLint
+	policy prover.Policy       // nil refuses no batch, see EnablePolicy
+	mmr    *mmr.MMR            // nil disables GET /mmr, see EnableMMR
+
+	proveMu  sync.RWMutex
+	provers  map[string]*proving // by profile name, see EnableProving
+	sessions sessions            // POST /sessions templates
+	tracker  prover.Tracker
+	phases   phaseMetrics  // GET /metrics
+	slots    *prover.Slots // proves in flight, one unless EnablePipeline
+	cores    int           // per prove, every core when zero; see LimitCores
+	board    board         // what GET /dashboard shows
+	warm     warmth
+}
+
+// VK is a served profile's verifying key and what its setup manifest
+// records of the circuit, read with it.
+type VK struct {
+	VK *groth16_bn254.VerifyingKey
+	// Features are the setup's circuit.Features, the only ones a proof
+	// verified under VK may carry; unchecked unless HasFeatures, when no
+	// manifest was found with VK
+	Features    circuit.Features
+	HasFeatures bool
+}
+
+type servedVK struct {
+	VK
+	hash [32]byte // verifier.VKHash, the cache key part
+}
+
+// New serves the given profiles; vks is keyed by circuit.Profile name.
+func New(vks map[string]VK, auditLog *audit.Log) (*Server, error) {
+	s := &Server{
+		vks:     make(map[string]servedVK, len(vks)),
+		audit:   auditLog,
+		provers: make(map[string]*proving),
+		slots:   prover.Pipeline{Depth: 1}.Slots(),
+	}
+	for name, vk := range vks {
+		if err := s.SetVK(name, vk); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// EnableCache answers repeated POST /verify requests from c. Call it before
+// serving.
+func (s *Server) EnableCache(c *verifier.Cache) { s.cache = c }
+
+// EnableIntake takes intents on POST /intents into l and follows those
+// batched by POST /prove and /prove/multi through proving and POST
+// /submitted. Call it before serving.
+func (s *Server) EnableIntake(l *intake.Log) { s.intake = l }
+
+// EnablePipeline proves up to p.Depth batches at once, admitted as
+// p.Run admits them, so a batch's witness solving overlaps the MSMs of the
+// one before it; the next is held back while memory in use is over
+// p.MemBudget. Without it batches are proven one at a time. Call it before
+// serving.
+func (s *Server) EnablePipeline(p prover.Pipeline) { s.slots = p.Slots() }
+
+// LimitCores caps every prove at n cores (prover.WithCores); requests may
+// ask for fewer with the "cores" query parameter. Call it before serving.
+func (s *Server) LimitCores(n int) { s.cores = n }
+
+// SetVK serves profile with vk from now on, replacing its verifying key and
+// features if it had them; results cached under the old key are dropped.
+// Safe to call while serving.
+func (s *Server) SetVK(profile string, vk VK) error {
+	hash, err := verifier.VKHash(vk.VK)
+	if err != nil {
+		return err
+	}
+	s.vkMu.Lock()
+	old, ok := s.vks[profile]
+	s.vks[profile] = servedVK{VK: vk, hash: hash}
+	s.vkMu.Unlock()
+	if ok && old.hash != hash && s.cache != nil {
+		s.cache.Invalidate(old.hash)
+	}
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /verify", s.handleVerify)
+	mux.HandleFunc("POST /prove", s.handleProve)
+	mux.HandleFunc("POST /prove/witness", s.handleProveWitness)
+	mux.HandleFunc("POST /prove/multi", s.handleProveMulti)
+	mux.HandleFunc("POST /sessions", s.handleOpenSession)
+	mux.HandleFunc("POST /sessions/{id}/prove", s.handleSessionProve)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleCloseSession)
+	mux.HandleFunc("POST /submitted", s.handleSubmitted)
+	mux.HandleFunc("POST /intents", s.handleIntent)
+	mux.HandleFunc("GET /intents/{pk}/{nonce}", s.handleGetIntent)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /dashboard", s.handleDashboard)
+	mux.HandleFunc("GET /ready", s.handleReady)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /mmr", s.handleMMR)
+	mux.HandleFunc("GET /mmr/{batch}", s.handleMMRProof)
+	return mux
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.rejectVerify(w, r, start, &req, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err))
+		return
+	}
+
+	if req.Profile == "" {
+		req.Profile = circuit.DefaultProfile
+	}
+	profile, err := circuit.LookupProfile(req.Profile)
+	s.vkMu.RLock()
+	vk, ok := s.vks[req.Profile]
+	s.vkMu.RUnlock()
+	if err != nil || !ok {
+		s.rejectVerify(w, r, start, &req, fmt.Errorf("%w: profile %q not served", errs.ErrInvalidInput, req.Profile))
+		return
+	}
+
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), tracing.Carrier(r.Header)), "POST /verify", tracing.Profile(profile.Name), tracing.N(profile.N))
+	defer span.End()
+	var cached bool
+	proofBytes, err := hex.DecodeString(req.Proof)
+	if err != nil {
+		err = fmt.Errorf("%w: proof hex: %w", errs.ErrInvalidInput, err)
+	} else {
+		cached, err = s.verify(ctx, vk, proofBytes, req.Public)
+	}
+	latency := time.Since(start)
+	span.SetAttributes(tracing.CacheHit(cached))
+
+	resp := VerifyResponse{Valid: err == nil, Code: errs.CodeOf(err), Cached: cached}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		c := report.NewCompression(profile.N, int64(len(proofBytes)))
+		resp.Compression = &c
+	}
+
+	if !s.auditVerify(w, r, start, latency, &req, proofBytes, resp) {
+		return
+	}
+	writeJSON(w, errs.HTTPStatus(err), resp)
+}
+
+// rejectVerify replies err to a request refused before its proof was
+// checked, a body that does not decode or a profile not served, once it is
+// audited as invalid like any other.
+func (s *Server) rejectVerify(w http.ResponseWriter, r *http.Request, start time.Time, req *VerifyRequest, err error) {
+	proofBytes, _ := hex.DecodeString(req.Proof)
+	resp := VerifyResponse{Code: errs.CodeOf(err), Error: err.Error()}
+	if s.auditVerify(w, r, start, time.Since(start), req, proofBytes, resp) {
+		writeError(w, err)
+	}
+}
+
+// auditVerify appends the audit entry of a verification, when auditing;
+// false means it could not and a 503 was written instead.
+func (s *Server) auditVerify(w http.ResponseWriter, r *http.Request, start time.Time, latency time.Duration, req *VerifyRequest, proofBytes []byte, resp VerifyResponse) bool {
+	if s.audit == nil {
+		return true
+	}
+	sum := sha256.Sum256(proofBytes)
+	_, err := s.audit.Append(audit.Entry{
+		Time:      start.UTC(),
+		Caller:    r.RemoteAddr,
+		Profile:   req.Profile,
+		ProofHash: hex.EncodeToString(sum[:]),
+		Public:    req.Public,
+		Valid:     resp.Valid,
+		Error:     resp.Error,
+		LatencyNS: latency.Nanoseconds(),
+	})
+	if err != nil {
+		// an unaudited verification must not be reported
+		log.Printf("audit append: %v", err)
+		writeError(w, fmt.Errorf("%w: audit log", errs.ErrUnavailable))
+		return false
+	}
+	return true
+}
+
+// verify checks the proof file proofBytes against public under vk, and its
+// header against vk's features, through the cache when there is one; cached
+// reports a cache hit.
+func (s *Server) verify(ctx context.Context, vk servedVK, proofBytes []byte, public json.RawMessage) (cached bool, err error) {
+	var proof groth16_bn254.Proof
+	framed := artifacts.Proof{Proof: &proof}
+	if _, err := framed.ReadFrom(chaos.Reader("proof", bytes.NewReader(proofBytes))); err != nil {
+		return false, err
+	}
+	var pub circuit.SettlementCircuitPublic
+	if err := pub.UnmarshalJSON(public); err != nil {
+		return false, err
+	}
+	if err := verifier.CheckBatchID(framed.Header, pub); err != nil {
+		return false, err
+	}
+	if vk.HasFeatures {
+		if err := verifier.CheckFeatures(framed.Header, vk.Features); err != nil {
+			return false, err
+		}
+	}
+	verify := func() error { return verifier.VerifyContext(ctx, vk.VK.VK, &proof, pub) }
+	if s.cache == nil {
+		return false, verify()
+	}
+	key, err := verifier.KeyOf(proofBytes, pub, vk.hash)
+	if err != nil {
+		return false, err
+	}
+	return s.cache.Do(key, verify)
+}
+
+// writeError replies with err's code and HTTP status.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, errs.HTTPStatus(err), VerifyResponse{Code: errs.CodeOf(err), Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
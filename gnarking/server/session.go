@@ -0,0 +1,239 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+const (
+	// MaxSessions caps the open sessions; POST /sessions past it is
+	// errs.ErrUnavailable until one closes or expires.
+	MaxSessions = 1024
+	// SessionTTL is how long a session stays open unused.
+	SessionTTL = time.Hour
+)
+
+// SessionTemplate is the body of POST /sessions: what every batch of a
+// session shares. Its batches (POST /sessions/{id}/prove) then send only
+// their KOld and rows.
+type SessionTemplate struct {
+	Profile   string `json:"profile,omitempty"` // circuit.DefaultProfile when empty
+	Recipient string `json:"recipient"`         // hex
+	ChainID   uint64 `json:"chain_id"`
+	Pk        string `json:"pk"`                   // hex, 32-byte compressed EdDSA public key
+	KeyPath   string `json:"key_path,omitempty"`   // keys.Path Pk was derived at, recorded only
+	SizeScale int    `json:"size_scale,omitempty"` // decimal places of the sizes in JSON, the deployment's
+}
+
+// SessionResponse is the reply of POST /sessions and DELETE
+// /sessions/{id}.
+type SessionResponse struct {
+	Code    errs.Code `json:"code"`
+	Error   string    `json:"error,omitempty"`
+	ID      string    `json:"id,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	Expires time.Time `json:"expires,omitzero"` // unless used again before
+}
+
+// session is one open template: the parsed batch-wide assignment, and the
+// template itself for the batches' intake records.
+type session struct {
+	tmpl     SessionTemplate
+	batch    *batchTemplate
+	p        *proving // the setup it was opened against
+	lastUsed time.Time
+}
+
+// sessions are the open sessions by ID, expired lazily.
+type sessions struct {
+	mu   sync.Mutex
+	byID map[string]*session
+}
+
+// open stores sess under a new ID, after dropping the expired sessions.
+func (ss *sessions) open(sess *session, now time.Time) (string, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for id, s := range ss.byID {
+		if now.Sub(s.lastUsed) > SessionTTL {
+			delete(ss.byID, id)
+		}
+	}
+	if len(ss.byID) >= MaxSessions {
+		return "", fmt.Errorf("%w: %d sessions open", errs.ErrUnavailable, len(ss.byID))
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	if ss.byID == nil {
+		ss.byID = make(map[string]*session)
+	}
+	sess.lastUsed = now
+	ss.byID[id] = sess
+	return id, nil
+}
+
+// use is the session id, its expiry pushed back.
+func (ss *sessions) use(id string, now time.Time) (*session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.byID[id]
+	if ok && now.Sub(s.lastUsed) > SessionTTL {
+		delete(ss.byID, id)
+		ok = false
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: no session %q", errs.ErrNotFound, id)
+	}
+	s.lastUsed = now
+	return s, nil
+}
+
+func (ss *sessions) close(id string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, ok := ss.byID[id]
+	delete(ss.byID, id)
+	return ok
+}
+
+// handleOpenSession registers a SessionTemplate for a profile proven here:
+// the recipient, chain ID and key are parsed and checked, and the key's
+// point decompressed, once for every batch of the session.
+func (s *Server) handleOpenSession(w http.ResponseWriter, r *http.Request) {
+	var tmpl SessionTemplate
+	if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+		writeSessionError(w, decodeError(err))
+		return
+	}
+	p, err := s.prover(tmpl.Profile)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	tmpl.Profile = p.profile.Name
+	batch, err := newBatchTemplate(p.profile, tmpl.request())
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	now := time.Now()
+	id, err := s.sessions.open(&session{tmpl: tmpl, batch: batch, p: p}, now)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionResponse{Code: errs.CodeOK, ID: id, Profile: tmpl.Profile, Expires: now.Add(SessionTTL)})
+}
+
+// handleSessionProve proves one batch of a session: the body is a JSON
+// ProveRequest of which only k_old, size_scale, rows and variant are read,
+// the rest coming from the template; a batch-wide field that is set must be
+// the template's. The reply is as for POST /prove.
+func (s *Server) handleSessionProve(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.sessions.use(r.PathValue("id"), time.Now())
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	req := new(ProveRequest)
+	if err := decodeError(json.NewDecoder(r.Body).Decode(req)); err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if err := sess.fill(req); err != nil {
+		writeProveError(w, err)
+		return
+	}
+	// a setup loaded again since may be another circuit
+	p, err := s.prover(sess.tmpl.Profile)
+	if err == nil && p != sess.p && p.profile != sess.p.profile {
+		err = fmt.Errorf("%w: profile %s was reloaded with other settings, open a new session", errs.ErrArtifactMismatch, p.profile.Name)
+	}
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if req.SizeScale != p.profile.SizeScale {
+		writeProveError(w, fmt.Errorf("%w: sizes at %d decimals, the deployment's are at %d", errs.ErrInvalidBatch, req.SizeScale, p.profile.SizeScale))
+		return
+	}
+	if err := s.admitBatch(r, p.profile.Name, req); err != nil {
+		writeProveError(w, err)
+		return
+	}
+	assignment, err := sess.batch.assign(req.KOld, req.Rows)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	wit, pub, err := batchWitness(p.profile, assignment, req.Variant)
+	if err != nil {
+		writeProveError(w, err)
+		return
+	}
+	if batchID, err := circuit.BatchID(pub); err == nil {
+		s.intakeBatched(p.profile.Name, req, batchID)
+	}
+	s.serveProof(w, r, p, wit, pub)
+}
+
+// handleCloseSession drops a session before it expires.
+func (s *Server) handleCloseSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.sessions.close(id) {
+		writeSessionError(w, fmt.Errorf("%w: no session %q", errs.ErrNotFound, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionResponse{Code: errs.CodeOK, ID: id})
+}
+
+// request is the ProveRequest of t, without rows.
+func (t SessionTemplate) request() *ProveRequest {
+	return &ProveRequest{Profile: t.Profile, Recipient: t.Recipient, ChainID: t.ChainID, Pk: t.Pk, KeyPath: t.KeyPath, SizeScale: t.SizeScale}
+}
+
+// fill completes req, a session batch, from the template; a batch-wide
+// field req sets to something else is errs.ErrInvalidBatch.
+func (sess *session) fill(req *ProveRequest) error {
+	t := sess.tmpl
+	var differ []string
+	if req.Profile != "" && req.Profile != t.Profile {
+		differ = append(differ, "profile")
+	}
+	if req.Recipient != "" {
+		if r, ok := new(big.Int).SetString(strings.TrimPrefix(req.Recipient, "0x"), 16); !ok || r.Cmp(sess.batch.recipient) != 0 {
+			differ = append(differ, "recipient")
+		}
+	}
+	if req.ChainID != 0 && req.ChainID != t.ChainID {
+		differ = append(differ, "chain_id")
+	}
+	if req.Pk != "" && !strings.EqualFold(strings.TrimPrefix(req.Pk, "0x"), strings.TrimPrefix(t.Pk, "0x")) {
+		differ = append(differ, "pk")
+	}
+	if len(differ) > 0 {
+		return fmt.Errorf("%w: %s not the session's", errs.ErrInvalidBatch, strings.Join(differ, ", "))
+	}
+	req.Profile, req.Recipient, req.ChainID, req.Pk = t.Profile, t.Recipient, t.ChainID, t.Pk
+	if req.KeyPath == "" {
+		req.KeyPath = t.KeyPath
+	}
+	return nil
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	writeJSON(w, errs.HTTPStatus(err), SessionResponse{Code: errs.CodeOf(err), Error: err.Error()})
+}
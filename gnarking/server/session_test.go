@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func TestSessionTemplate(t *testing.T) {
+	profile, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := bnEddsa.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := SessionTemplate{Profile: profile.Name, Recipient: "2a", ChainID: 8453, Pk: hex.EncodeToString(priv.PublicKey.Bytes())}
+	batch, err := newBatchTemplate(profile, tmpl.request())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &session{tmpl: tmpl, batch: batch}
+
+	for k := range uint64(3) {
+		req := &ProveRequest{KOld: k * uint64(profile.N)}
+		for i := range profile.N {
+			size, nonce := uint64(7*i+1), req.KOld+uint64(i)+1
+			msg := circuit.MsgHash(profile.Msg, big.NewInt(42), new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(8453))
+			sig, err := circuit.EdDSA{}.Sign(priv, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Rows = append(req.Rows, ProveRow{Size: size, Nonce: nonce, Sig: hex.EncodeToString(sig)})
+		}
+		got, err := batch.assign(req.KOld, req.Rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the session's batch is the batch POST /prove would prove
+		if err := sess.fill(req); err != nil {
+			t.Fatal(err)
+		}
+		want, err := buildBatch(profile, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotID, _ := circuit.BatchID(got.P)
+		wantID, _ := circuit.BatchID(want.P)
+		if gotID != wantID || !reflect.DeepEqual(got.Size, want.Size) || !reflect.DeepEqual(got.Nonce, want.Nonce) {
+			t.Fatalf("batch %d: session assignment differs from POST /prove's", k)
+		}
+	}
+
+	for _, req := range []*ProveRequest{
+		{Recipient: "2b"},
+		{ChainID: 1},
+		{Profile: "64"},
+		{Pk: hex.EncodeToString(make([]byte, 32))},
+	} {
+		if err := sess.fill(req); !errors.Is(err, errs.ErrInvalidBatch) {
+			t.Errorf("batch-wide field other than the session's: %v, want ErrInvalidBatch", err)
+		}
+	}
+	// set, but to the template's
+	if err := sess.fill(&ProveRequest{Recipient: "0x2A", ChainID: 8453, Pk: "0x" + tmpl.Pk}); err != nil {
+		t.Errorf("batch-wide fields equal to the session's: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	var ss sessions
+	now := time.Unix(1700000000, 0)
+	id, err := ss.open(&session{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.use(id, now.Add(SessionTTL/2)); err != nil {
+		t.Fatal(err)
+	}
+	// using it pushed the expiry back
+	if _, err := ss.use(id, now.Add(SessionTTL)); err != nil {
+		t.Fatalf("used session expired: %v", err)
+	}
+	if _, err := ss.use(id, now.Add(3*SessionTTL)); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("expired session: %v, want ErrNotFound", err)
+	}
+	if _, err := ss.use("nope", now); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("unknown session: %v, want ErrNotFound", err)
+	}
+
+	for range MaxSessions {
+		if _, err := ss.open(&session{}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ss.open(&session{}, now); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("past MaxSessions: %v, want ErrUnavailable", err)
+	}
+	// expired sessions make room
+	id, err = ss.open(&session{}, now.Add(2*SessionTTL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ss.close(id) || ss.close(id) {
+		t.Fatal("close")
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/stats"
+)
+
+// SLA gives prove jobs a deadline, counted from when the request came in:
+// Profiles' for their profile, else Default (0: none). A request's
+// "deadline" query parameter overrides it. A job not proven by its
+// deadline is a breach: counted on GET /status and /metrics and reported to
+// the hooks as soon as the deadline passes, not when the job ends, so the
+// alert goes out while the withdrawal behind it is still waiting.
+type SLA struct {
+	Default  time.Duration
+	Profiles map[string]time.Duration
+	Webhook  string // URL the SLAEvent is POSTed to as JSON
+	// Exec is a command run with sh -c, the SLAEvent JSON on stdin and
+	// DDM_EVENT, DDM_BATCH_ID, DDM_PROFILE and DDM_STATUS set
+	Exec string
+}
+
+// ParseSLA parses deadlines as ddm serve -sla takes them: comma-separated
+// durations, for every profile or for one as profile=duration, e.g.
+// "5m,64=15m".
+func ParseSLA(s string) (SLA, error) {
+	var a SLA
+	for _, part := range strings.Split(s, ",") {
+		profile, d, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			profile, d = "", profile
+		}
+		target, err := time.ParseDuration(d)
+		if err != nil || target <= 0 {
+			return SLA{}, fmt.Errorf("%w: SLA %q: %q is not a positive duration", errs.ErrInvalidInput, s, d)
+		}
+		if !ok {
+			a.Default = target
+			continue
+		}
+		if a.Profiles == nil {
+			a.Profiles = make(map[string]time.Duration)
+		}
+		a.Profiles[profile] = target
+	}
+	return a, nil
+}
+
+// Target is the deadline of a job of profile after its request, 0 for
+// none.
+func (a SLA) Target(profile string) time.Duration {
+	if d, ok := a.Profiles[profile]; ok {
+		return d
+	}
+	return a.Default
+}
+
+// SLAEvent is what an SLA hook is called with.
+type SLAEvent struct {
+	Event    string    `json:"event"` // "breach"
+	BatchID  string    `json:"batch_id"`
+	Profile  string    `json:"profile"`
+	Accepted time.Time `json:"accepted"` // when the request came in
+	Deadline time.Time `json:"deadline"`
+	Time     time.Time `json:"time"`
+	// Status is the job's at the breach: queued or proving when the
+	// deadline passed first, proven or failed when it ended after it
+	Status string `json:"status"`
+}
+
+// SLAStats is one profile's record against its deadlines since the server
+// started.
+type SLAStats struct {
+	Profile  string        `json:"profile"`
+	Target   time.Duration `json:"target_ns,omitempty"`
+	Jobs     int           `json:"jobs"`     // ended, with a deadline
+	Met      int           `json:"met"`      // proven by it
+	Breached int           `json:"breached"` // not proven by it
+	Failed   int           `json:"failed"`   // failed before it
+	// Latency is the percentiles, in seconds, of request to proof over the
+	// last slaSamples jobs proven, with a deadline or not
+	Latency []stats.Percentile `json:"latency_s,omitempty"`
+}
+
+// slaSamples bounds the latencies kept per profile.
+const slaSamples = 1000
+
+// slaPercentiles are those of the latency reported.
+var slaPercentiles = []float64{50, 90, 99}
+
+type slaTracker struct {
+	SLA
+
+	mu       sync.Mutex
+	profiles map[string]*slaProfile
+}
+
+type slaProfile struct {
+	SLAStats
+	latency []float64 // seconds, a ring of the last slaSamples
+	next    int
+}
+
+// EnableSLA tracks prove jobs against a's deadlines. Call it before
+// serving.
+func (s *Server) EnableSLA(a SLA) {
+	s.sla = &slaTracker{SLA: a, profiles: make(map[string]*slaProfile)}
+}
+
+// jobDeadline is the deadline of the job r asks for, accepted at now: its
+// "deadline" query parameter, a duration from now or an RFC 3339 time,
+// else the SLA's for profile; zero for none, and without an SLA.
+func (s *Server) jobDeadline(r *http.Request, profile string, now time.Time) (time.Time, error) {
+	if s.sla == nil {
+		return time.Time{}, nil
+	}
+	q := r.URL.Query().Get("deadline")
+	if q == "" {
+		if d := s.sla.Target(profile); d > 0 {
+			return now.Add(d), nil
+		}
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(q); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, q); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: deadline %q is not a positive duration or an RFC 3339 time", errs.ErrInvalidInput, q)
+}
+
+// watchDeadline follows rec, just added to the board, against its
+// deadline: a breach is reported when the deadline passes first. Call done
+// with the job's outcome when it ends.
+func (s *Server) watchDeadline(rec *ProofRecord) (done func(err error)) {
+	t := s.sla
+	if t == nil {
+		return func(error) {}
+	}
+	var (
+		mu               sync.Mutex
+		ended, late      bool
+		timer            *time.Timer
+		deadline         = rec.Deadline
+		profile, batchID = rec.Profile, rec.BatchID
+	)
+	breach := func(now time.Time) {
+		s.board.mu.Lock()
+		rec.Breached = true
+		e := SLAEvent{Event: "breach", BatchID: batchID, Profile: profile, Accepted: rec.Time, Deadline: deadline, Time: now, Status: rec.Status}
+		s.board.mu.Unlock()
+		late = true
+		go t.fire(e)
+	}
+	if !deadline.IsZero() {
+		timer = time.AfterFunc(time.Until(deadline), func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !ended {
+				breach(time.Now())
+			}
+		})
+	}
+	return func(err error) {
+		if timer != nil {
+			timer.Stop()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ended = true
+		now := time.Now()
+		if !deadline.IsZero() && !late && now.After(deadline) {
+			breach(now)
+		}
+		t.ended(profile, t.Target(profile), !deadline.IsZero(), late, now.Sub(rec.Time), err)
+	}
+}
+
+// ended counts a job of profile that took latency to end with err.
+func (t *slaTracker) ended(profile string, target time.Duration, hasDeadline, late bool, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.profiles[profile]
+	if !ok {
+		p = &slaProfile{SLAStats: SLAStats{Profile: profile}}
+		t.profiles[profile] = p
+	}
+	p.Target = target
+	if hasDeadline {
+		p.Jobs++
+		switch {
+		case late:
+			p.Breached++
+		case err != nil:
+			p.Failed++
+		default:
+			p.Met++
+		}
+	}
+	if err != nil {
+		return
+	}
+	if len(p.latency) < slaSamples {
+		p.latency = append(p.latency, latency.Seconds())
+	} else {
+		p.latency[p.next] = latency.Seconds()
+		p.next = (p.next + 1) % slaSamples
+	}
+}
+
+func (t *slaTracker) fire(e SLAEvent) {
+	body, _ := json.Marshal(e)
+	callHooks(context.Background(), "sla", t.Webhook, t.Exec, body,
+		"DDM_EVENT="+e.Event, "DDM_BATCH_ID="+e.BatchID, "DDM_PROFILE="+e.Profile, "DDM_STATUS="+e.Status)
+}
+
+// stats is every profile's SLAStats, sorted by name.
+func (t *slaTracker) stats() []SLAStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []SLAStats
+	for _, name := range slices.Sorted(maps.Keys(t.profiles)) {
+		p := t.profiles[name]
+		st := p.SLAStats
+		if len(p.latency) > 0 {
+			sorted := slices.Sorted(slices.Values(p.latency))
+			st.Latency = stats.Percentiles(sorted, slaPercentiles)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// writeMetrics adds the SLA counters and latency summaries to a GET
+// /metrics reply.
+func (t *slaTracker) writeMetrics(b *bytes.Buffer) {
+	sts := t.stats()
+	counter := func(name, help string, v func(SLAStats) int) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, st := range sts {
+			fmt.Fprintf(b, "%s{profile=%q} %d\n", name, st.Profile, v(st))
+		}
+	}
+	counter("ddm_sla_jobs_total", "Prove jobs ended with a deadline, by profile.", func(st SLAStats) int { return st.Jobs })
+	counter("ddm_sla_breaches_total", "Prove jobs not proven by their deadline, by profile.", func(st SLAStats) int { return st.Breached })
+	fmt.Fprintf(b, "# HELP ddm_sla_latency_seconds Request to proof, quantiles over the last %d proofs, by profile.\n# TYPE ddm_sla_latency_seconds gauge\n", slaSamples)
+	for _, st := range sts {
+		for _, p := range st.Latency {
+			fmt.Fprintf(b, "ddm_sla_latency_seconds{profile=%q,quantile=\"%s\"} %s\n", st.Profile,
+				strconv.FormatFloat(p.P/100, 'f', -1, 64), strconv.FormatFloat(p.Value, 'f', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+func TestParseSLA(t *testing.T) {
+	a, err := ParseSLA("5m, 64=15m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Target("8") != 5*time.Minute || a.Target("64") != 15*time.Minute {
+		t.Fatalf("targets %v, %v", a.Target("8"), a.Target("64"))
+	}
+	if a, _ := ParseSLA("64=1m"); a.Target("8") != 0 {
+		t.Errorf("profile without a deadline: %v", a.Target("8"))
+	}
+	for _, s := range []string{"", "soon", "8=", "8=-1m", "0s"} {
+		if _, err := ParseSLA(s); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%q: %v, want ErrInvalidInput", s, err)
+		}
+	}
+}
+
+func TestJobDeadline(t *testing.T) {
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	req := func(q string) *http.Request { return httptest.NewRequest(http.MethodPost, "/prove"+q, nil) }
+	if d, err := s.jobDeadline(req("?deadline=1m"), "8", now); err != nil || !d.IsZero() {
+		t.Fatalf("without an SLA: %v %v", d, err)
+	}
+	s.EnableSLA(SLA{Profiles: map[string]time.Duration{"8": time.Minute}})
+	for _, tc := range []struct {
+		q, profile string
+		want       time.Time
+	}{
+		{"", "8", now.Add(time.Minute)},
+		{"", "64", time.Time{}},
+		{"?deadline=90s", "64", now.Add(90 * time.Second)},
+		{"?deadline=2025-01-15T12:30:00Z", "8", now.Add(30 * time.Minute)},
+	} {
+		if d, err := s.jobDeadline(req(tc.q), tc.profile, now); err != nil || !d.Equal(tc.want) {
+			t.Errorf("%s %s: %v %v, want %v", tc.profile, tc.q, d, err, tc.want)
+		}
+	}
+	if _, err := s.jobDeadline(req("?deadline=-1s"), "8", now); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("negative deadline: %v", err)
+	}
+}
+
+func TestSLA(t *testing.T) {
+	s, err := New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaches := make(chan SLAEvent, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e SLAEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		breaches <- e
+	}))
+	defer hook.Close()
+	s.EnableSLA(SLA{Default: time.Hour, Webhook: hook.URL})
+
+	b := &s.board
+	job := func(deadline time.Time) (*ProofRecord, func(error)) {
+		rec := b.add(ProofRecord{BatchID: "ab", Profile: "8", N: 8, Time: time.Now(), Status: StatusQueued, Deadline: deadline})
+		return rec, s.watchDeadline(rec)
+	}
+
+	// the breach is reported when the deadline passes, before the job ends
+	late, lateDone := job(time.Now().Add(20 * time.Millisecond))
+	select {
+	case e := <-breaches:
+		if e.Event != "breach" || e.Status != StatusQueued || e.BatchID != "ab" {
+			t.Fatalf("breach %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no breach reported")
+	}
+	b.done(late, time.Millisecond, nil)
+	lateDone(nil)
+
+	hour := time.Now().Add(time.Hour)
+	_, met := job(hour)
+	met(nil)
+	_, failed := job(hour)
+	failed(errors.New("out of memory"))
+	_, none := job(time.Time{})
+	none(nil)
+
+	st := s.board.status()
+	if !st.Recent[len(st.Recent)-1].Breached {
+		t.Errorf("late job not marked breached: %+v", st.Recent[len(st.Recent)-1])
+	}
+	sts := s.sla.stats()
+	if len(sts) != 1 {
+		t.Fatalf("sla stats %+v", sts)
+	}
+	if got := sts[0]; got.Jobs != 3 || got.Met != 1 || got.Breached != 1 || got.Failed != 1 || len(got.Latency) != 3 || got.Target != time.Hour {
+		t.Fatalf("sla stats %+v", got)
+	}
+	select {
+	case e := <-breaches:
+		t.Fatalf("breach reported twice: %+v", e)
+	default:
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{`ddm_sla_jobs_total{profile="8"} 3`, `ddm_sla_breaches_total{profile="8"} 1`, `ddm_sla_latency_seconds{profile="8",quantile="0.99"}`} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Fatalf("metrics without %q:\n%s", line, rec.Body)
+		}
+	}
+	if w := get(s.Handler(), "/status"); !strings.Contains(w.Body.String(), `"breached":1`) {
+		t.Fatalf("status without the SLA: %s", w.Body)
+	}
+	if w := get(s.Handler(), "/dashboard"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "(late)") {
+		t.Fatalf("dashboard %d without the breach:\n%s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+
+	"gnarking/circuit"
+	"gnarking/memwatch"
+	"gnarking/prover"
+	"gnarking/report"
+	"gnarking/stats"
+)
+
+// statsWindow is the history GET /status summarizes and EnableStats seeds
+// the backlog estimates from.
+const statsWindow = 24 * time.Hour
+
+// statsPercentiles are those of the prove time GET /status reports.
+var statsPercentiles = []float64{50, 90, 99}
+
+// EnableStats records every proof made in st, and seeds the expected prove
+// times of the backlog estimate (GET /metrics, autoscaling) from its last
+// day, so a restarted server does not start cold. Call it before serving.
+func (s *Server) EnableStats(st *stats.Store) error {
+	samples, err := st.Query(stats.Query{From: time.Now().Add(-statsWindow)})
+	if err != nil {
+		return err
+	}
+	s.board.mu.Lock()
+	for _, x := range samples {
+		s.board.observe(x.Profile, x.N, x.ProveTime)
+	}
+	s.board.mu.Unlock()
+	s.stats = st
+	return nil
+}
+
+// proveRecorded is prove, recording the proof's statistics when stats are
+// enabled: its phase timings, from the prover's Timings, and its peak
+// memory.
+func (s *Server) proveRecorded(ctx context.Context, p *proving, wit witness.Witness, pub circuit.SettlementCircuitPublic, batchID [32]byte, cores int, progress func(prover.Progress)) (ProveResponse, *groth16_bn254.Proof, error) {
+	if s.stats == nil {
+		return s.prove(ctx, p, wit, pub, batchID, cores, progress)
+	}
+	x := stats.Sample{
+		BatchID:     hex.EncodeToString(batchID[:]),
+		Profile:     p.profile.Name,
+		N:           p.profile.N,
+		Constraints: p.ccs.GetNbConstraints(),
+		Cores:       prover.Cores(cores),
+	}
+	var (
+		resp  ProveResponse
+		proof *groth16_bn254.Proof
+	)
+	start := time.Now()
+	mem, err := memwatch.Guard{}.Run("prove", func() (err error) {
+		resp, proof, err = s.prove(ctx, p, wit, pub, batchID, cores, progress)
+		x.Timings = resp.Timings
+		return err
+	})
+	if err != nil {
+		return resp, proof, err
+	}
+	x.Time = time.Now()
+	x.ProveTime, x.PeakMemory = x.Time.Sub(start), mem.PeakInUse
+	x.CostUSD = report.NewEconomics(x.N, x.ProveTime, x.Cores).CostPerProof
+	if err := s.stats.Append(x); err != nil {
+		log.Printf("stats: %v", err)
+	}
+	return resp, proof, nil
+}
+
+// proveStats summarizes the prove times of the last statsWindow, then its
+// solve, FFT and MSM phases, nil when stats are not enabled.
+func (s *Server) proveStats() []stats.Summary {
+	if s.stats == nil {
+		return nil
+	}
+	samples, err := s.stats.Query(stats.Query{From: time.Now().Add(-statsWindow)})
+	if err != nil {
+		log.Printf("stats: %v", err)
+		return nil
+	}
+	var out []stats.Summary
+	for _, f := range []stats.Field{stats.FieldProveTime, stats.FieldSolve, stats.FieldFFT, stats.FieldMSM} {
+		out = append(out, stats.Summarize(samples, f, statsPercentiles)...)
+	}
+	return out
+}
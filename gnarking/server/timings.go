@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+
+	"gnarking/prover"
+)
+
+// phaseMetrics adds up the phase timings of every proof made, by profile,
+// for GET /metrics: a regression in one phase shows in its rate even when
+// the prove time hides it.
+type phaseMetrics struct {
+	mu       sync.Mutex
+	profiles map[string]*phaseSums
+}
+
+type phaseSums struct {
+	count int
+	sum   prover.Timings
+}
+
+func (m *phaseMetrics) observe(profile string, t *prover.Timings) {
+	if t == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.profiles == nil {
+		m.profiles = make(map[string]*phaseSums)
+	}
+	ps := m.profiles[profile]
+	if ps == nil {
+		ps = new(phaseSums)
+		m.profiles[profile] = ps
+	}
+	ps.count++
+	ps.sum.Add(*t)
+}
+
+func (m *phaseMetrics) writeMetrics(b *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	const name = "ddm_prove_phase_seconds"
+	fmt.Fprintf(b, "# HELP %s Time proofs spent in each prove phase (prover.Timings; the msm_ ones overlap), by profile.\n# TYPE %s summary\n", name, name)
+	for _, profile := range slices.Sorted(maps.Keys(m.profiles)) {
+		ps := m.profiles[profile]
+		for _, p := range ps.sum.Phases() {
+			fmt.Fprintf(b, "%s_sum{profile=%q,phase=%q} %s\n", name, profile, p.Phase, strconv.FormatFloat(p.Duration.Seconds(), 'f', -1, 64))
+			fmt.Fprintf(b, "%s_count{profile=%q,phase=%q} %d\n", name, profile, p.Phase, ps.count)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/internal/testcircuit"
+)
+
+// TestVerifyFeatures checks a verify-only server refuses a proof whose
+// header records other features than the served vk's setup, and leaves
+// proofs alone when no manifest was found with the vk.
+func TestVerifyFeatures(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &testcircuit.SettlementShaped{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := testcircuit.Public(7)
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := json.Marshal(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := artifacts.ProofHeader{
+		Version: artifacts.ProofHeaderVersion, Curve: ecc.BN254, Backend: backend.GROTH16,
+		BatchID: id, Timestamp: time.Now(), Features: uint32(circuit.FeatureKeccakRoot),
+	}
+	var proof bytes.Buffer
+	if _, err := (&artifacts.Proof{Header: &hdr, Proof: new(groth16_bn254.Proof)}).WriteTo(&proof); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(VerifyRequest{Profile: circuit.DefaultProfile, Proof: hex.EncodeToString(proof.Bytes()), Public: public})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		vk   VK
+		want errs.Code
+	}{
+		{"other features", VK{HasFeatures: true}, errs.CodeArtifactMismatch},
+		// the zero proof then fails the pairing check
+		{"same features", VK{Features: circuit.FeatureKeccakRoot, HasFeatures: true}, errs.CodeVerificationFailed},
+		{"no manifest", VK{}, errs.CodeVerificationFailed},
+	} {
+		tc.vk.VK = vk.(*groth16_bn254.VerifyingKey)
+		s, err := New(map[string]VK{circuit.DefaultProfile: tc.vk}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/verify", strings.NewReader(string(body))))
+		var resp VerifyResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v: %s", tc.name, err, rec.Body)
+		}
+		if resp.Valid || resp.Code != tc.want {
+			t.Errorf("%s: %+v, want %s", tc.name, resp, tc.want)
+		}
+	}
+}
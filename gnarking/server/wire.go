@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// ContentTypeBatch is the binary POST /prove body, see prove.proto.
+const ContentTypeBatch = "application/x-ddm-batch+protobuf"
+
+const (
+	// DefaultChunkRows is how many rows WriteBatch puts in a RowChunk.
+	DefaultChunkRows = 256
+	// MaxWireMessage bounds one length-delimited message, checked before
+	// it is allocated. A chunk of DefaultChunkRows rows is ~20 KiB.
+	MaxWireMessage = 1 << 20
+	sigBytes       = 64
+)
+
+// field numbers, as in prove.proto
+const (
+	hdrProfile   = 1
+	hdrRecipient = 2
+	hdrChainID   = 3
+	hdrKOld      = 4
+	hdrPk        = 5
+	hdrRows      = 6
+	hdrKeyPath   = 7
+	hdrSizeScale = 8
+
+	rowSize       = 1
+	rowNonceDelta = 2
+	rowSig        = 3
+
+	chunkRow = 1
+)
+
+// WriteBatch writes req in the binary form, chunkRows rows per RowChunk
+// (DefaultChunkRows when <= 0).
+func WriteBatch(w io.Writer, req *ProveRequest, chunkRows int) error {
+	if chunkRows <= 0 {
+		chunkRows = DefaultChunkRows
+	}
+	recipient, ok := new(big.Int).SetString(strings.TrimPrefix(req.Recipient, "0x"), 16)
+	if !ok || recipient.Sign() < 0 {
+		return fmt.Errorf("%w: recipient hex %q", errs.ErrInvalidInput, req.Recipient)
+	}
+	pk, err := hex.DecodeString(strings.TrimPrefix(req.Pk, "0x"))
+	if err != nil {
+		return fmt.Errorf("%w: pk hex: %w", errs.ErrInvalidInput, err)
+	}
+
+	var hdr []byte
+	if req.Profile != "" {
+		hdr = protowire.AppendTag(hdr, hdrProfile, protowire.BytesType)
+		hdr = protowire.AppendString(hdr, req.Profile)
+	}
+	hdr = protowire.AppendTag(hdr, hdrRecipient, protowire.BytesType)
+	hdr = protowire.AppendBytes(hdr, recipient.Bytes())
+	hdr = protowire.AppendTag(hdr, hdrChainID, protowire.VarintType)
+	hdr = protowire.AppendVarint(hdr, req.ChainID)
+	hdr = protowire.AppendTag(hdr, hdrKOld, protowire.VarintType)
+	hdr = protowire.AppendVarint(hdr, req.KOld)
+	hdr = protowire.AppendTag(hdr, hdrPk, protowire.BytesType)
+	hdr = protowire.AppendBytes(hdr, pk)
+	hdr = protowire.AppendTag(hdr, hdrRows, protowire.VarintType)
+	hdr = protowire.AppendVarint(hdr, uint64(len(req.Rows)))
+	if req.KeyPath != "" {
+		hdr = protowire.AppendTag(hdr, hdrKeyPath, protowire.BytesType)
+		hdr = protowire.AppendString(hdr, req.KeyPath)
+	}
+	if req.SizeScale > 0 {
+		hdr = protowire.AppendTag(hdr, hdrSizeScale, protowire.VarintType)
+		hdr = protowire.AppendVarint(hdr, uint64(req.SizeScale))
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeDelimited(bw, hdr); err != nil {
+		return err
+	}
+
+	prev := req.KOld
+	var chunk, row []byte
+	for start := 0; start < len(req.Rows); start += chunkRows {
+		chunk = chunk[:0]
+		for i := start; i < min(start+chunkRows, len(req.Rows)); i++ {
+			r := req.Rows[i]
+			sig, err := hex.DecodeString(strings.TrimPrefix(r.Sig, "0x"))
+			if err != nil {
+				return fmt.Errorf("%w: row %d sig hex: %w", errs.ErrInvalidInput, i, err)
+			}
+			row = row[:0]
+			row = protowire.AppendTag(row, rowSize, protowire.VarintType)
+			row = protowire.AppendVarint(row, r.Size)
+			row = protowire.AppendTag(row, rowNonceDelta, protowire.VarintType)
+			row = protowire.AppendVarint(row, protowire.EncodeZigZag(int64(r.Nonce-prev)))
+			row = protowire.AppendTag(row, rowSig, protowire.BytesType)
+			row = protowire.AppendBytes(row, sig)
+			prev = r.Nonce
+
+			chunk = protowire.AppendTag(chunk, chunkRow, protowire.BytesType)
+			chunk = protowire.AppendBytes(chunk, row)
+		}
+		if err := writeDelimited(bw, chunk); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func writeDelimited(w io.Writer, msg []byte) error {
+	if len(msg) > MaxWireMessage {
+		return fmt.Errorf("%w: %d-byte message, at most %d", errs.ErrInvalidInput, len(msg), MaxWireMessage)
+	}
+	if _, err := w.Write(protowire.AppendVarint(nil, uint64(len(msg)))); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadBatch reads a binary batch. maxRows is asked for the row limit of the
+// header's profile (and may refuse the profile) before any row is read.
+func ReadBatch(r io.Reader, maxRows func(profile string) (int, error)) (*ProveRequest, error) {
+	br := bufio.NewReader(r)
+	msg, err := readDelimited(br)
+	if err != nil {
+		return nil, fmt.Errorf("batch header: %w", err)
+	}
+	req := new(ProveRequest)
+	var rows uint64
+	err = eachField(msg, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch {
+		case num == hdrProfile && typ == protowire.BytesType:
+			req.Profile = string(b)
+		case num == hdrRecipient && typ == protowire.BytesType:
+			req.Recipient = new(big.Int).SetBytes(b).Text(16)
+		case num == hdrChainID && typ == protowire.VarintType:
+			req.ChainID = v
+		case num == hdrKOld && typ == protowire.VarintType:
+			req.KOld = v
+		case num == hdrPk && typ == protowire.BytesType:
+			req.Pk = hex.EncodeToString(b)
+		case num == hdrRows && typ == protowire.VarintType:
+			rows = v
+		case num == hdrKeyPath && typ == protowire.BytesType:
+			req.KeyPath = string(b)
+		case num == hdrSizeScale && typ == protowire.VarintType:
+			if v > circuit.MaxSizeScale {
+				return fmt.Errorf("%w: size scale %d", errs.ErrInvalidInput, v)
+			}
+			req.SizeScale = int(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch header: %w", err)
+	}
+	limit, err := maxRows(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if rows > uint64(limit) {
+		return nil, fmt.Errorf("%w: %d rows, profile %q takes %d", errs.ErrInvalidBatch, rows, req.Profile, limit)
+	}
+
+	req.Rows = make([]ProveRow, 0, rows)
+	prev := req.KOld
+	for uint64(len(req.Rows)) < rows {
+		msg, err := readDelimited(br)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", len(req.Rows), err)
+		}
+		err = eachField(msg, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+			if num != chunkRow || typ != protowire.BytesType {
+				return nil
+			}
+			if uint64(len(req.Rows)) == rows {
+				return fmt.Errorf("%w: more rows than the header's %d", errs.ErrInvalidInput, rows)
+			}
+			var row ProveRow
+			var sig []byte
+			err := eachField(b, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+				switch {
+				case num == rowSize && typ == protowire.VarintType:
+					row.Size = v
+				case num == rowNonceDelta && typ == protowire.VarintType:
+					row.Nonce = prev + uint64(protowire.DecodeZigZag(v))
+				case num == rowSig && typ == protowire.BytesType:
+					sig = b
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(sig) != sigBytes {
+				return fmt.Errorf("%w: row %d: %d-byte signature, want %d", errs.ErrInvalidInput, len(req.Rows), len(sig), sigBytes)
+			}
+			row.Sig = hex.EncodeToString(sig)
+			prev = row.Nonce
+			req.Rows = append(req.Rows, row)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func readDelimited(br *bufio.Reader) ([]byte, error) {
+	var n uint64
+	for shift := 0; ; shift += 7 {
+		c, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && shift > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+		}
+		if shift > 28 {
+			return nil, fmt.Errorf("%w: message length overflows", errs.ErrInvalidInput)
+		}
+		n |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			break
+		}
+	}
+	if n > MaxWireMessage {
+		return nil, fmt.Errorf("%w: %d-byte message, at most %d", errs.ErrInvalidInput, n, MaxWireMessage)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(br, msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	return msg, nil
+}
+
+// eachField calls fn with every field of msg: v for varints, b for
+// length-delimited fields. Other wire types are skipped, as unknown fields
+// are.
+func eachField(msg []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return fmt.Errorf("%w: %w", errs.ErrInvalidInput, protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		var (
+			v uint64
+			b []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(msg)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(msg)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: field %d: %w", errs.ErrInvalidInput, num, protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		if err := fn(num, typ, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func testBatch(n int) *ProveRequest {
+	rng := rand.New(rand.NewPCG(1, 2))
+	req := &ProveRequest{
+		Profile:   "n512",
+		Recipient: "1f9840a85d5af5bf1d1762f925bdaddc4201f984",
+		ChainID:   8453,
+		KOld:      1000,
+		Pk:        hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32)),
+		KeyPath:   "m/1'/7'",
+	}
+	nonce := req.KOld
+	for range n {
+		nonce += 1 + uint64(rng.IntN(2))
+		sig := make([]byte, sigBytes)
+		for j := range sig {
+			sig[j] = byte(rng.Uint32())
+		}
+		req.Rows = append(req.Rows, ProveRow{Size: rng.Uint64N(1 << 20), Nonce: nonce, Sig: hex.EncodeToString(sig)})
+	}
+	return req
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	allow := func(string) (int, error) { return 512, nil }
+	for _, chunk := range []int{1, 7, DefaultChunkRows, 1000} {
+		want := testBatch(300)
+		// nonces are deltas on the wire: going backwards must survive too
+		want.Rows[5].Nonce = 3
+		var buf bytes.Buffer
+		if err := WriteBatch(&buf, want, chunk); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadBatch(&buf, allow)
+		if err != nil {
+			t.Fatalf("chunks of %d: %v", chunk, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("chunks of %d: round trip differs", chunk)
+		}
+	}
+
+	var buf bytes.Buffer
+	WriteBatch(&buf, testBatch(10), 4)
+	full := buf.Bytes()
+	if _, err := ReadBatch(bytes.NewReader(full), func(string) (int, error) { return 8, nil }); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("over the profile's N: %v", err)
+	}
+	if _, err := ReadBatch(bytes.NewReader(full[:len(full)-1]), allow); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("truncated: %v", err)
+	}
+	short := testBatch(1)
+	short.Rows[0].Sig = "abcd"
+	buf.Reset()
+	WriteBatch(&buf, short, 0)
+	if _, err := ReadBatch(&buf, allow); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("short signature: %v", err)
+	}
+}
+
+func TestProveRequestDecimal(t *testing.T) {
+	want := testBatch(3)
+	want.SizeScale = 6
+	want.Rows[0].Size, want.Rows[1].Size, want.Rows[2].Size = 1250000, 7000000, 1
+	body, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []string{`"size":"1.25"`, `"size":"7"`, `"size":"0.000001"`, `"size_scale":6`} {
+		if !bytes.Contains(body, []byte(size)) {
+			t.Fatalf("%s not in %s", size, body)
+		}
+	}
+	var got ProveRequest
+	if err := json.Unmarshal(body, &got); err != nil || !reflect.DeepEqual(&got, want) {
+		t.Fatalf("JSON round trip: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteBatch(&buf, want, 0); err != nil {
+		t.Fatal(err)
+	}
+	if back, err := ReadBatch(&buf, func(string) (int, error) { return 512, nil }); err != nil || !reflect.DeepEqual(back, want) {
+		t.Fatalf("wire round trip: %v", err)
+	}
+
+	// numbers are decimals too; without a scale only integers parse
+	if err := json.Unmarshal([]byte(`{"size_scale":2,"rows":[{"size":1.5},{"size":"2"}]}`), &got); err != nil || got.Rows[0].Size != 150 || got.Rows[1].Size != 200 {
+		t.Fatalf("scale 2: %+v, %v", got.Rows, err)
+	}
+	if body, _ := json.Marshal(testBatch(1)); !bytes.Contains(body, []byte(`"size":`)) || bytes.Contains(body, []byte(`"size":"`)) {
+		t.Fatalf("integer sizes quoted: %s", body)
+	}
+	for _, body := range []string{
+		`{"rows":[{"size":"1.25"}]}`,
+		`{"size_scale":2,"rows":[{"size":"1.255"}]}`,
+		`{"size_scale":2,"rows":[{"size":-1}]}`,
+		`{"size_scale":18,"rows":[{"size":"19"}]}`, // past uint64 in base units
+	} {
+		var req ProveRequest
+		if err := json.Unmarshal([]byte(body), &req); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+
+	// a batch must be at the deployment's scale
+	p, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := testBatch(p.N)
+	req.SizeScale = 2
+	if _, err := BatchAssignment(p, req); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("scale 2 batch for an integer deployment: %v", err)
+	}
+}
+
+// BenchmarkMarshal compares the JSON and binary POST /prove bodies of a
+// 512-row batch, encoding and decoding.
+func BenchmarkMarshal(b *testing.B) {
+	req := testBatch(512)
+	allow := func(string) (int, error) { return 512, nil }
+	jsonBody, _ := json.Marshal(req)
+	var wire bytes.Buffer
+	WriteBatch(&wire, req, DefaultChunkRows)
+	wireBody := wire.Bytes()
+
+	b.Run("json/encode", func(b *testing.B) {
+		b.SetBytes(int64(len(jsonBody)))
+		for b.Loop() {
+			if _, err := json.Marshal(req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json/decode", func(b *testing.B) {
+		b.SetBytes(int64(len(jsonBody)))
+		for b.Loop() {
+			var got ProveRequest
+			if err := json.Unmarshal(jsonBody, &got); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("proto/encode", func(b *testing.B) {
+		b.SetBytes(int64(len(wireBody)))
+		var buf bytes.Buffer
+		for b.Loop() {
+			buf.Reset()
+			if err := WriteBatch(&buf, req, DefaultChunkRows); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("proto/decode", func(b *testing.B) {
+		b.SetBytes(int64(len(wireBody)))
+		for b.Loop() {
+			if _, err := ReadBatch(bytes.NewReader(wireBody), allow); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gnarking/circuit"
+	"gnarking/estimate"
+)
+
+// Candidate is one feature of a circuit over budget that could be turned
+// off, and the circuit's size without it.
+type Candidate struct {
+	Feature     string `json:"feature"` // circuit.Features name, e.g. keccak_root
+	Setting     string `json:"setting"` // what to change, e.g. --data-hash mimc
+	Constraints int    `json:"constraints"`
+	Saves       int    `json:"saves"`
+	Fits        bool   `json:"fits"` // within the budget on its own
+}
+
+// Overrun is the error of a circuit over its constraint budget: what each
+// step of Define costs, and what turning each of its features off would
+// save, most first.
+type Overrun struct {
+	Profile     string      `json:"profile"`
+	Constraints int         `json:"constraints"`
+	Max         int         `json:"max"`
+	Categories  []Category  `json:"categories"`
+	Candidates  []Candidate `json:"candidates"`
+}
+
+func (o *Overrun) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile %s: %d constraints, over the budget of %d by %d (%.1fx)\n", o.Profile, o.Constraints, o.Max, o.Constraints-o.Max, float64(o.Constraints)/float64(o.Max))
+	b.WriteString("constraints by step:\n")
+	for _, c := range o.Categories {
+		fmt.Fprintf(&b, "  %-40s %10d  %5.1f%%\n", c.Name, c.Constraints, 100*float64(c.Constraints)/float64(o.Constraints))
+	}
+	if len(o.Candidates) == 0 {
+		b.WriteString("no feature to turn off: raise the budget or lower N")
+		return b.String()
+	}
+	b.WriteString("features to turn off:\n")
+	for _, c := range o.Candidates {
+		fits := ""
+		if c.Fits {
+			fits = "  fits"
+		}
+		fmt.Fprintf(&b, "  %-14s %-32s %10d constraints, saves %d%s\n", c.Feature, c.Setting, c.Constraints, c.Saves, fits)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// alternatives are p without each of its features that cost constraints,
+// with the setting that turns it off.
+func alternatives(p circuit.Profile) []struct {
+	feature circuit.Features
+	setting string
+	p       circuit.Profile
+} {
+	type alt = struct {
+		feature circuit.Features
+		setting string
+		p       circuit.Profile
+	}
+	var out []alt
+	add := func(setting string, q circuit.Profile) {
+		if f := p.Features() &^ q.Features(); f != 0 {
+			out = append(out, alt{f, setting, q})
+		}
+	}
+	q := p
+	q.DataHash = circuit.DataHashMiMC
+	add("--data-hash mimc", q)
+	q = p
+	q.Ordering = circuit.OrderingMonotonic
+	add("--ordering monotonic", q)
+	q = p
+	q.Msg = circuit.MsgV1
+	add("--msg v1", q)
+	q = p
+	q.Bounds = circuit.Bounds{}
+	add("no bounds in --params", q)
+	q = p
+	q.EmptyBatches = false
+	add("no --empty-batches", q)
+	if p.Variant != nil {
+		q = p
+		q.Variant = nil
+		add(fmt.Sprintf("a profile without variant %T", p.Variant), q)
+	}
+	return out
+}
+
+// CheckBudget checks p's circuit, of constraints constraints as compiled,
+// against a budget of max (0: none). Over it, it compiles the circuit again
+// with profiling for the per-step breakdown, and each circuit without one
+// of p's features at small N for its size (estimate.FitProfile), and
+// returns them as an *Overrun.
+func CheckBudget(p circuit.Profile, constraints, max int) error {
+	if max <= 0 || constraints <= max {
+		return nil
+	}
+	o := &Overrun{Profile: p.Name, Constraints: constraints, Max: max}
+	var err error
+	if _, o.Categories, err = compileProfiled(p); err != nil {
+		return err
+	}
+	for _, a := range alternatives(p) {
+		fit, err := estimate.FitProfile(a.p)
+		if err != nil {
+			return fmt.Errorf("spec: sizing %s without %s: %w", p.Name, a.feature, err)
+		}
+		n := fit.Constraints.At(p.N)
+		if n >= constraints {
+			continue
+		}
+		o.Candidates = append(o.Candidates, Candidate{Feature: a.feature.String(), Setting: a.setting, Constraints: n, Saves: constraints - n, Fits: n <= max})
+	}
+	sort.SliceStable(o.Candidates, func(i, j int) bool { return o.Candidates[i].Saves > o.Candidates[j].Saves })
+	return o
+}
@@ -0,0 +1,43 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gnarking/circuit"
+)
+
+func TestCheckBudget(t *testing.T) {
+	p := circuit.Profile{Name: "budget", N: 2, DataHash: circuit.DataHashKeccak, Ordering: circuit.OrderingPermuted}
+	if err := CheckBudget(p, 1000, 0); err != nil {
+		t.Fatalf("no budget: %v", err)
+	}
+	if err := CheckBudget(p, 1000, 1000); err != nil {
+		t.Fatalf("at the budget: %v", err)
+	}
+
+	full, _, err := compileProfiled(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckBudget(p, full.GetNbConstraints(), full.GetNbConstraints()-1)
+	var o *Overrun
+	if !errors.As(err, &o) {
+		t.Fatalf("over budget: %v", err)
+	}
+	if len(o.Categories) == 0 || len(o.Candidates) != 2 {
+		t.Fatalf("overrun %+v", o)
+	}
+	for i, c := range o.Candidates {
+		if !c.Fits || c.Saves <= 0 || c.Constraints+c.Saves != full.GetNbConstraints() {
+			t.Errorf("candidate %+v", c)
+		}
+		if i > 0 && c.Saves > o.Candidates[i-1].Saves {
+			t.Error("candidates not by savings")
+		}
+	}
+	if !strings.Contains(err.Error(), "--data-hash mimc") || !strings.Contains(err.Error(), "--ordering monotonic") {
+		t.Errorf("error %s", err)
+	}
+}
@@ -0,0 +1,195 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/consensys/gnark/constraint"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+)
+
+// Wire is how many constraints reference a named input, per-row wires
+// folded into one entry like Input.
+type Wire struct {
+	Name        string `json:"name"` // P_KOld is P.KOld, Size_3 is Size[]
+	Public      bool   `json:"public"`
+	Count       int    `json:"count"`       // wires folded
+	Constraints int    `json:"constraints"` // referencing any of them
+}
+
+// Line is one constraint, (L) ⋅ (R) == O, wires by their witness names
+// and internal ones as v<n>.
+type Line struct {
+	Index      int    `json:"index"`
+	Constraint string `json:"constraint"`
+}
+
+// Dump is what a compiled constraint system enforces, for auditing the
+// deployed ccs rather than the code it was compiled from.
+type Dump struct {
+	Profile     string `json:"profile"`
+	CircuitHash string `json:"circuit_hash"`
+	Constraints int    `json:"constraints"`
+	Public      int    `json:"public_wires"` // with the constant 1 wire
+	Secret      int    `json:"secret_wires"`
+	Internal    int    `json:"internal_wires"`
+	Terms       int    `json:"terms"` // linear terms over all of L, R and O
+	// Reproduced is whether compiling the profile gives this exact ccs;
+	// only then are Categories reported, attributed to the steps of Define.
+	Reproduced bool       `json:"reproduced"`
+	Categories []Category `json:"categories,omitempty"`
+	Wires      []Wire     `json:"wires"`   // in witness order, public first
+	Matched    int        `json:"matched"` // constraints Match selected, listed or not
+	Lines      []Line     `json:"lines"`
+}
+
+// DumpOptions selects the constraints a Dump lists.
+type DumpOptions struct {
+	Match  string // substring of the formatted constraint; empty matches all
+	Offset int    // matched constraints to skip
+	Limit  int    // most to list, 0 for none
+}
+
+// DumpCCS summarizes ccs and lists the constraints opts selects. p is the
+// profile ccs was set up from (with the manifest's parameters): it is
+// recompiled with profiling for the per-step counts, which, like Describe,
+// must not run concurrently with other compiles.
+func DumpCCS(ccs *cs_bn254.R1CS, p circuit.Profile, opts DumpOptions) (*Dump, error) {
+	hash, err := artifacts.CircuitHash(ccs)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dump{
+		Profile:     p.Name,
+		CircuitHash: hex.EncodeToString(hash[:]),
+		Constraints: ccs.GetNbConstraints(),
+		Public:      len(ccs.Public),
+		Secret:      len(ccs.Secret),
+		Internal:    ccs.GetNbInternalVariables(),
+		Lines:       []Line{},
+	}
+
+	recompiled, cats, err := compileProfiled(p)
+	if err != nil {
+		return nil, err
+	}
+	if got, err := artifacts.CircuitHash(recompiled); err == nil && got == hash {
+		d.Reproduced, d.Categories = true, cats
+	}
+
+	// named wires come first in the witness: the constant 1, public, secret
+	names := append(append([]string(nil), ccs.Public[1:]...), ccs.Secret...)
+	wires, byID, byName := make([]Wire, 0), make([]int, len(names)), make(map[string]int)
+	for i, name := range names {
+		name := foldName(name)
+		j, ok := byName[name]
+		if !ok {
+			j = len(wires)
+			byName[name] = j
+			wires = append(wires, Wire{Name: name, Public: i < len(ccs.Public)-1})
+		}
+		wires[j].Count++
+		byID[i] = j
+	}
+
+	seen := make([]int, len(wires)) // last constraint counted, +1
+	it := ccs.GetR1CIterator()
+	for i, r := 0, it.Next(); r != nil; i, r = i+1, it.Next() {
+		for _, l := range []constraint.LinearExpression{r.L, r.R, r.O} {
+			d.Terms += len(l)
+			for _, t := range l {
+				if t.IsConstant() || t.VID == 0 || int(t.VID) > len(names) {
+					continue
+				}
+				if w := byID[t.VID-1]; seen[w] != i+1 {
+					seen[w] = i + 1
+					wires[w].Constraints++
+				}
+			}
+		}
+		if opts.Match == "" && (d.Matched < opts.Offset || len(d.Lines) >= opts.Limit) {
+			d.Matched++ // skip formatting what is not listed
+			continue
+		}
+		s := formatR1C(r, ccs)
+		if !strings.Contains(s, opts.Match) {
+			continue
+		}
+		if d.Matched >= opts.Offset && len(d.Lines) < opts.Limit {
+			d.Lines = append(d.Lines, Line{Index: i, Constraint: s})
+		}
+		d.Matched++
+	}
+	d.Wires = wires
+	return d, nil
+}
+
+// formatR1C is r.String with multi-term sides parenthesized: gnark prints
+// a + b ⋅ c for (a + b) ⋅ c.
+func formatR1C(r *constraint.R1C, res constraint.Resolver) string {
+	side := func(l constraint.LinearExpression) string {
+		if len(l) > 1 {
+			return "(" + l.String(res) + ")"
+		}
+		return l.String(res)
+	}
+	return side(r.L) + " ⋅ " + side(r.R) + " == " + r.O.String(res)
+}
+
+// WriteTo writes d as indented JSON.
+func (d *Dump) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Text is an io.WriterTo rendering a Dump as plain text.
+type Text Dump
+
+func (t *Text) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "circuit %s, profile %s\n", t.CircuitHash, t.Profile)
+	fmt.Fprintf(&b, "%d constraints, %d terms; wires: %d public (with the constant 1), %d secret, %d internal\n\n",
+		t.Constraints, t.Terms, t.Public, t.Secret, t.Internal)
+
+	if t.Reproduced {
+		b.WriteString("constraints per step (recompiled from the profile, same circuit hash):\n")
+		for _, c := range t.Categories {
+			fmt.Fprintf(&b, "  %8d  %5.1f%%  %s\n", c.Constraints, 100*float64(c.Constraints)/float64(t.Constraints), c.Name)
+		}
+	} else {
+		b.WriteString("per-step counts omitted: the profile recompiles to a different circuit than this ccs\n")
+	}
+
+	b.WriteString("\nconstraints referencing each input:\n")
+	for _, wire := range t.Wires {
+		vis := "secret"
+		if wire.Public {
+			vis = "public"
+		}
+		fmt.Fprintf(&b, "  %8d  %-6s %s", wire.Constraints, vis, wire.Name)
+		if wire.Count > 1 {
+			fmt.Fprintf(&b, " (%d wires)", wire.Count)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "\n%d constraints matched, %d listed:\n", t.Matched, len(t.Lines))
+	for _, l := range t.Lines {
+		fmt.Fprintf(&b, "[%d] %s\n", l.Index, l.Constraint)
+	}
+	return b.WriteTo(w)
+}
+
+// Text renders d as plain text.
+func (d *Dump) Text() *Text { return (*Text)(d) }
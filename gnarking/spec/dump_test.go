@@ -0,0 +1,65 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/circuit"
+)
+
+func TestDumpCCS(t *testing.T) {
+	p, err := circuit.LookupProfile("8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccs := compiled.(*cs_bn254.R1CS)
+
+	d, err := DumpCCS(ccs, p, DumpOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Reproduced || d.Matched != d.Constraints || len(d.Lines) != 1 {
+		t.Fatalf("reproduced %v, matched %d of %d, %d listed", d.Reproduced, d.Matched, d.Constraints, len(d.Lines))
+	}
+	// constraint 0 is the totals equality, wires by name
+	if want := "1 ⋅ (Size_0 + Size_1 + Size_2 + Size_3 + Size_4 + Size_5 + Size_6 + Size_7) == P_TotalSettle"; d.Lines[0].Constraint != want {
+		t.Fatalf("constraint 0 is %q", d.Lines[0].Constraint)
+	}
+	total := 0
+	for _, c := range d.Categories {
+		total += c.Constraints
+	}
+	if total != d.Constraints {
+		t.Fatalf("categories add up to %d constraints, circuit has %d", total, d.Constraints)
+	}
+	if w := d.Wires[3]; w.Name != "P.TotalSettle" || !w.Public || w.Constraints != 1 {
+		t.Fatalf("wire 3 %+v", w)
+	}
+	if w := d.Wires[len(d.Wires)-1]; w.Name != "Sig[].S" || w.Public || w.Count != p.N {
+		t.Fatalf("last wire %+v", w)
+	}
+
+	d, err = DumpCCS(ccs, p, DumpOptions{Match: "P_ChainID", Offset: 2, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Matched != d.Wires[4].Constraints || len(d.Lines) != 3 || !strings.Contains(d.Lines[0].Constraint, "P_ChainID") {
+		t.Fatalf("matched %d, chain ID in %d, %d listed", d.Matched, d.Wires[4].Constraints, len(d.Lines))
+	}
+
+	// under the other message version the profile is another circuit: no
+	// per-step counts
+	p.Msg = 1 - p.Msg
+	if d, err = DumpCCS(ccs, p, DumpOptions{}); err != nil || d.Reproduced || d.Categories != nil || len(d.Lines) != 0 {
+		t.Fatalf("other profile: %v, reproduced %v", err, d.Reproduced)
+	}
+}
@@ -0,0 +1,311 @@
+// Package spec describes the statement a settlement circuit proves, taken
+// from the circuit itself: inputs come from walking the circuit struct, the
+// constraint breakdown from profiling its compilation, attributed to the step
+// of Define that created each constraint. The checked-in
+// testdata/spec_<profile>.md is compared against it, so the document cannot
+// drift from the code.
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/schema"
+	gnarkProfile "github.com/consensys/gnark/profile"
+	"github.com/google/pprof/profile"
+
+	"gnarking/circuit"
+)
+
+// Input is one circuit input, per-row fields folded into one entry.
+type Input struct {
+	Name  string `json:"name"`  // Go path, "[]" for row indices: P.Recipient, Sig[].R.X
+	Count int    `json:"count"` // field elements
+}
+
+// Category is the constraints one step of Define creates.
+type Category struct {
+	Name        string `json:"name"`
+	Constraints int    `json:"constraints"`
+}
+
+// Spec is the statement a profile's circuit proves.
+type Spec struct {
+	Profile     string     `json:"profile"`
+	N           int        `json:"n"`
+	Curve       string     `json:"curve"`
+	Backend     string     `json:"backend"`
+	DataHash    string     `json:"data_hash"`
+	Ordering    string     `json:"ordering"`
+	Msg         string     `json:"msg"`
+	Statement   []string   `json:"statement"`
+	Public      []Input    `json:"public"` // in public witness (and verifier contract) order
+	Secret      []Input    `json:"secret"`
+	Constraints int        `json:"constraints"`
+	Internal    int        `json:"internal_variables"`
+	Categories  []Category `json:"categories"` // most constraints first
+}
+
+// steps names the functions Define calls; constraints are attributed to the
+// one their call stack passes through. A new step shows up under its Go name
+// until it is named here.
+var steps = map[string]string{
+	"circuit.(*SettlementCircuit).Define": "totals and public input equalities",
+	"circuit.assertNonceOrder":            "nonce ordering",
+	"circuit.assertUniqueIDs":             "nonce ordering",
+	"circuit.assertBounds":                "value bounds",
+	"circuit.assertMinSize":               "value bounds",
+	"circuit.sortedRows":                  "row sorting (permutation argument)",
+	"circuit.assertEmptyRows":             "empty batches",
+	"circuit.placeholderNonces":           "empty batches",
+	"circuit.batchDataRoot":               "batch data root",
+	"circuit.newMsgHasher":                "row messages",
+	"circuit.(*msgHasher).sum":            "row messages",
+	"circuit.EdDSA.AssertRows":            "signatures",
+}
+
+const define = "circuit.(*SettlementCircuit).Define"
+
+// Describe compiles p's circuit with constraint profiling on. The profiler is
+// process-global: do not compile other circuits concurrently.
+func Describe(p circuit.Profile) (*Spec, error) {
+	statement, err := Statement(p)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spec{
+		Profile:   p.Name,
+		N:         p.N,
+		Curve:     ecc.BN254.String(),
+		Backend:   backend.GROTH16.String(),
+		DataHash:  p.DataHash.String(),
+		Ordering:  p.Ordering.String(),
+		Msg:       p.Msg.String(),
+		Statement: statement,
+	}
+	if s.Public, s.Secret, err = inputs(p.Circuit()); err != nil {
+		return nil, err
+	}
+
+	ccs, cats, err := compileProfiled(p)
+	if err != nil {
+		return nil, err
+	}
+	s.Constraints = ccs.GetNbConstraints()
+	s.Internal = ccs.GetNbInternalVariables()
+	s.Categories = cats
+	return s, nil
+}
+
+// compileProfiled compiles p's circuit and attributes its constraints to the
+// steps of Define.
+func compileProfiled(p circuit.Profile) (constraint.ConstraintSystem, []Category, error) {
+	dir, err := os.MkdirTemp("", "ddm-spec")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+	pprofName := filepath.Join(dir, "constraints.pprof")
+	prof := gnarkProfile.Start(gnarkProfile.WithPath(pprofName))
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, p.Define())
+	prof.Stop()
+	if err != nil {
+		return nil, nil, err
+	}
+	cats, err := categories(pprofName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ccs, cats, nil
+}
+
+// gnark names leaves P_Pk_A_X, Sig_3_R_X
+var rowIndex = regexp.MustCompile(`_\d+`)
+
+// foldName is a gnark leaf name as a Go path with row indices folded:
+// Sig_3_R_X is Sig[].R.X.
+func foldName(name string) string {
+	return strings.ReplaceAll(rowIndex.ReplaceAllString(name, "[]"), "_", ".")
+}
+
+// inputs walks c's leaves in witness order.
+func inputs(c *circuit.SettlementCircuit) (public, secret []Input, err error) {
+	add := func(list []Input, name string) []Input {
+		name = foldName(name)
+		for i := range list {
+			if list[i].Name == name {
+				list[i].Count++
+				return list
+			}
+		}
+		return append(list, Input{Name: name, Count: 1})
+	}
+	tVariable := reflect.TypeOf((*frontend.Variable)(nil)).Elem()
+	_, err = schema.Walk(ecc.BN254.ScalarField(), c, tVariable, func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility == schema.Public {
+			public = add(public, leaf.FullName())
+		} else {
+			secret = add(secret, leaf.FullName())
+		}
+		return nil
+	})
+	return public, secret, err
+}
+
+func categories(pprofName string) ([]Category, error) {
+	f, err := os.Open(pprofName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, sample := range prof.Sample {
+		// frames run leaf first; the category is the circuit function right
+		// below Define, gnark API calls made by Define itself count as Define
+		var frames []string
+		for _, loc := range sample.Location {
+			for _, line := range loc.Line {
+				frames = append(frames, line.Function.Name)
+			}
+		}
+		name := "outside Define"
+		for i, fn := range frames {
+			if fn == define {
+				name = define
+				if i > 0 && strings.HasPrefix(frames[i-1], "circuit.") {
+					name = frames[i-1]
+				}
+				break
+			}
+		}
+		if label, ok := steps[name]; ok {
+			name = label
+		}
+		counts[name] += int(sample.Value[0])
+	}
+
+	cats := make([]Category, 0, len(counts))
+	for name, n := range counts {
+		cats = append(cats, Category{Name: name, Constraints: n})
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		if cats[i].Constraints != cats[j].Constraints {
+			return cats[i].Constraints > cats[j].Constraints
+		}
+		return cats[i].Name < cats[j].Name
+	})
+	return cats, nil
+}
+
+// Statement is the relation p's circuit enforces, one line per check.
+func Statement(p circuit.Profile) ([]string, error) {
+	last := p.N - 1
+	lines := []string{fmt.Sprintf("TotalSettle == Size[0] + ... + Size[%d]", last)}
+
+	rows := "the rows"
+	switch p.Ordering {
+	case circuit.OrderingMonotonic:
+		lines = append(lines, fmt.Sprintf("KOld < Nonce[0] < ... < Nonce[%d] == M", last))
+	case circuit.OrderingUnique:
+		lines = append(lines, "Nonce[i] pairwise distinct, in any order; KOld == 0; M == max(Nonce)")
+	case circuit.OrderingPermuted:
+		lines = append(lines, fmt.Sprintf("rows in any order; sorted by nonce (a permutation, grand-product checked): KOld < Nonce'[0] < ... < Nonce'[%d] == M", last))
+		rows = "the rows sorted by nonce"
+	default:
+		return nil, fmt.Errorf("spec: no statement for ordering %s", p.Ordering)
+	}
+	if p.EmptyBatches {
+		lines = append(lines, fmt.Sprintf("if M == KOld (an empty batch): Size[i] == 0 and Nonce[i] == KOld for every row i, and the ordering above is checked over Nonce[i] = i+1, KOld = 0, M = %d instead", p.N))
+	}
+
+	switch p.DataHash {
+	case circuit.DataHashMiMC:
+		lines = append(lines, fmt.Sprintf("BatchDataRoot == MiMC(Size[0], Nonce[0], ..., Size[%d], Nonce[%d]) over %s", last, last, rows))
+	case circuit.DataHashKeccak:
+		lines = append(lines, fmt.Sprintf("BatchDataRoot == keccak256(uint64 Size[0] || uint64 Nonce[0] || ... || uint64 Nonce[%d]) mod 2^248 over %s", last, rows))
+	case circuit.DataHashMiMCTree:
+		lines = append(lines, fmt.Sprintf("BatchDataRoot == root of the MiMC(left, right) tree over leaves MiMC(Size[i], Nonce[i]), i <= %d, zero-padded to a power of two, over %s", last, rows))
+	default:
+		return nil, fmt.Errorf("spec: no statement for data hash %s", p.DataHash)
+	}
+
+	switch p.Msg {
+	case circuit.MsgV1:
+		lines = append(lines, `msg[i] == MiMC("msettle1", Recipient, Size[i], Nonce[i], ChainID)`)
+	case circuit.MsgV2:
+		lines = append(lines, `msg[i] == MiMC("msettle2", Recipient, ChainID, Size[i], Nonce[i])`)
+	case circuit.MsgSHA256:
+		lines = append(lines, `msg[i] == SHA-256(Recipient || ChainID || "msettle3" || Size[i] || Nonce[i]) mod r, each value uint256 big-endian`)
+	default:
+		return nil, fmt.Errorf("spec: no statement for message version %s", p.Msg)
+	}
+	lines = append(lines, fmt.Sprintf("Sig[i] is a valid %s signature of msg[i] under Pk, for every row i", circuit.EdDSA{}))
+	return lines, nil
+}
+
+var _ io.WriterTo = (*Spec)(nil)
+
+// WriteTo writes s as indented JSON.
+func (s *Spec) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Markdown is an io.WriterTo rendering s as a markdown document.
+type Markdown Spec
+
+func (m *Markdown) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Settlement circuit, profile %s\n\n", m.Profile)
+	fmt.Fprintf(&b, "Generated by `ddm describe -profile %s`; do not edit.\n\n", m.Profile)
+	fmt.Fprintf(&b, "%s/%s, N = %d rows, data hash %s, ordering %s, message format %s.\n\n",
+		m.Curve, m.Backend, m.N, m.DataHash, m.Ordering, m.Msg)
+
+	b.WriteString("## Statement\n\nFor the public inputs, the prover knows rows (Size, Nonce, Sig) such that:\n\n")
+	for i, line := range m.Statement {
+		fmt.Fprintf(&b, "%d. `%s`\n", i+1, line)
+	}
+
+	// the public order is the verifier's input order; secret row fields
+	// interleave per row, so only their totals are listed
+	b.WriteString("\n## Public inputs\n\n| # | name |\n|---|---|\n")
+	for i, in := range m.Public {
+		fmt.Fprintf(&b, "| %d | `%s` |\n", i, in.Name)
+	}
+	b.WriteString("\n## Secret inputs\n\n| name | field elements |\n|---|---|\n")
+	for _, in := range m.Secret {
+		fmt.Fprintf(&b, "| `%s` | %d |\n", in.Name, in.Count)
+	}
+
+	fmt.Fprintf(&b, "\n## Constraints\n\n%d R1CS constraints, %d internal variables.\n\n", m.Constraints, m.Internal)
+	b.WriteString("| step | constraints | share |\n|---|---|---|\n")
+	for _, c := range m.Categories {
+		fmt.Fprintf(&b, "| %s | %d | %.1f%% |\n", c.Name, c.Constraints, 100*float64(c.Constraints)/float64(m.Constraints))
+	}
+	return b.WriteTo(w)
+}
+
+// Markdown renders s as a markdown document.
+func (s *Spec) Markdown() *Markdown { return (*Markdown)(s) }
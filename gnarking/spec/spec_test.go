@@ -0,0 +1,58 @@
+package spec
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"gnarking/circuit"
+)
+
+// testdata/spec_8.md is the published circuit specification. A diff here
+// means the circuit changed: regenerate with `ddm describe -profile 8 -out
+// spec/testdata/spec_8.md` and review the new statement and counts.
+func TestSpecUpToDate(t *testing.T) {
+	want, err := os.ReadFile("testdata/spec_8.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := circuit.LookupProfile("8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Describe(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if _, err := s.Markdown().WriteTo(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatal("circuit differs from testdata/spec_8.md")
+	}
+
+	total := 0
+	for _, c := range s.Categories {
+		total += c.Constraints
+	}
+	if total != s.Constraints {
+		t.Fatalf("categories add up to %d constraints, circuit has %d", total, s.Constraints)
+	}
+}
+
+func TestStatement(t *testing.T) {
+	for _, o := range []circuit.Ordering{circuit.OrderingMonotonic, circuit.OrderingUnique, circuit.OrderingPermuted} {
+		for _, h := range []circuit.DataHash{circuit.DataHashMiMC, circuit.DataHashKeccak} {
+			for _, m := range []circuit.MsgVersion{circuit.MsgV1, circuit.MsgV2, circuit.MsgSHA256} {
+				p := circuit.Profile{Name: "t", N: 4, DataHash: h, Ordering: o, Msg: m}
+				if lines, err := Statement(p); err != nil || len(lines) != 5 {
+					t.Fatalf("%s: %d lines, %v", p, len(lines), err)
+				}
+			}
+		}
+	}
+	if _, err := Statement(circuit.Profile{Name: "t", N: 4, Ordering: circuit.Ordering(99)}); err == nil {
+		t.Fatal("unknown ordering described")
+	}
+}
@@ -0,0 +1,176 @@
+package spotcheck
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+)
+
+// Opener answers an audit's request for rows of a batch.
+type Opener interface {
+	Open(ctx context.Context, batchID [32]byte, rows []int) (*Openings, error)
+}
+
+// Audit samples k rows of the batch pub commits to, has opener open them
+// and checks the openings.
+func Audit(ctx context.Context, opener Opener, profile circuit.Profile, pub circuit.SettlementCircuitPublic, c *Commitments, k int) (*Report, error) {
+	rows, err := Sample(pub, len(c.Leaves), k)
+	if err != nil {
+		return nil, err
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return nil, err
+	}
+	o, err := opener.Open(ctx, id, rows)
+	if err != nil {
+		return nil, err
+	}
+	return Check(profile, pub, c, k, o)
+}
+
+// Archive is the operator's side: proven batches as Put stores them,
+// <dir>/<batch ID hex>.json, opened with the audit key.
+type Archive struct {
+	Dir string
+	Key Key
+}
+
+// Put archives req, the batch of batchID (Commit checks it is).
+func (a Archive) Put(batchID [32]byte, req *server.ProveRequest) error {
+	b, err := json.MarshalIndent(req, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.Dir, 0o700); err != nil {
+		return err
+	}
+	name := a.path(batchID)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (a Archive) path(batchID [32]byte) string {
+	return filepath.Join(a.Dir, hex.EncodeToString(batchID[:])+".json")
+}
+
+func (a Archive) Open(_ context.Context, batchID [32]byte, rows []int) (*Openings, error) {
+	data, err := os.ReadFile(a.path(batchID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: batch %x is not archived", errs.ErrNotFound, batchID[:8])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	var req server.ProveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: archived batch %x: %w", errs.ErrArtifactMismatch, batchID[:8], err)
+	}
+	return Open(batchID, &req, a.Key, rows)
+}
+
+// MaxRows bounds the rows one request may open: an audit samples a few,
+// and a request for all of them is a request for the batch.
+const MaxRows = 64
+
+// OpeningsResponse is the reply of GET /spotcheck/{batch}?rows=.
+type OpeningsResponse struct {
+	Code     errs.Code `json:"code"`
+	Error    string    `json:"error,omitempty"`
+	Openings *Openings `json:"openings,omitempty"`
+}
+
+// Handler serves GET /spotcheck/{batch}?rows=3,17,40 from a. Whoever can
+// reach it can read archived rows, up to MaxRows a request: serve it to
+// auditors only.
+func (a Archive) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /spotcheck/{batch}", func(w http.ResponseWriter, r *http.Request) {
+		o, err := a.serve(r)
+		status := errs.HTTPStatus(err)
+		resp := OpeningsResponse{Code: errs.CodeOf(err), Openings: o}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	})
+	return mux
+}
+
+func (a Archive) serve(r *http.Request) (*Openings, error) {
+	var id [32]byte
+	b, err := hex.DecodeString(r.PathValue("batch"))
+	if err != nil || len(b) != len(id) {
+		return nil, fmt.Errorf("%w: batch ID %q", errs.ErrInvalidInput, r.PathValue("batch"))
+	}
+	copy(id[:], b)
+	var rows []int
+	for _, s := range strings.Split(r.URL.Query().Get("rows"), ",") {
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("%w: rows %q", errs.ErrInvalidInput, r.URL.Query().Get("rows"))
+		}
+		rows = append(rows, i)
+	}
+	if len(rows) > MaxRows {
+		return nil, fmt.Errorf("%w: %d rows asked, at most %d per audit", errs.ErrPolicyRejected, len(rows), MaxRows)
+	}
+	return a.Open(r.Context(), id, rows)
+}
+
+// Client requests openings from an operator serving Archive.Handler.
+type Client struct {
+	URL  string
+	HTTP *http.Client // default http.DefaultClient
+}
+
+func (c *Client) Open(ctx context.Context, batchID [32]byte, rows []int) (*Openings, error) {
+	list := make([]string, len(rows))
+	for i, r := range rows {
+		list[i] = strconv.Itoa(r)
+	}
+	u := strings.TrimSuffix(c.URL, "/") + "/spotcheck/" + hex.EncodeToString(batchID[:]) + "?" + url.Values{"rows": {strings.Join(list, ",")}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	var or OpeningsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&or); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", errs.ErrUnavailable, c.URL, resp.Status)
+	}
+	if or.Code != errs.CodeOK {
+		if e := errs.ForCode(or.Code); e != nil {
+			return nil, fmt.Errorf("%w: %s: %s", e, c.URL, or.Error)
+		}
+		return nil, fmt.Errorf("%s: %s", c.URL, or.Error)
+	}
+	if or.Openings == nil {
+		return nil, fmt.Errorf("%w: %s sent no openings", errs.ErrVerificationFailed, c.URL)
+	}
+	return or.Openings, nil
+}
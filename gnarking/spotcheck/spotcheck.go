@@ -0,0 +1,500 @@
+// Package spotcheck audits a proven batch by sampling: instead of re-proving
+// or reading every row, an auditor opens k rows and checks their signatures
+// natively.
+//
+// After proving, the operator commits to the batch's rows (Commit): one
+// salted SHA-256 leaf per row, published with the proof as
+// commitments_<profile>.json. The salts come from the operator's audit key,
+// so the leaves reveal nothing about the rows left closed. The rows to open
+// are not the operator's choice: Sample derives them, Fiat–Shamir style,
+// from the batch ID and BatchDataRoot alone, both fixed by the proof, so no
+// choice of key or salts moves the sample. The operator answers with
+// Openings (row, signature, salt, and the row's path in the proven data
+// tree), and Check recomputes each leaf, checks the row's size and nonce
+// open to BatchDataRoot at its position, verifies each signature under the
+// batch's public key for its recipient and chain, and checks the row
+// against the proven nonce range and total. The path binds an opened row to
+// the proven batch, so the operator cannot answer a sampled unsigned row
+// with another; audits therefore need a profile whose data hash is
+// circuit.DataHashMiMCTree, its rows in batch order (not
+// circuit.OrderingPermuted, whose tree is in nonce order). Its sibling leaves are unsalted MiMC(size,
+// nonce): they hide a closed row only as far as its values are hard to
+// guess (see package redact).
+//
+// A batch with b rows the key did not sign passes a k-row audit with
+// probability Miss(n, k, b).
+package spotcheck
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/server"
+)
+
+const Version = 1
+
+// Domain separators of the hashes below; changing one breaks every archived
+// commitment.
+const (
+	leafDomain   = "ddm spotcheck leaf v1"
+	rootDomain   = "ddm spotcheck root v1"
+	saltDomain   = "ddm spotcheck salt v1"
+	sampleDomain = "ddm spotcheck sample v2"
+)
+
+// Key is the operator's audit key: every salt is derived from it, so it
+// must stay as private as the rows.
+type Key [32]byte
+
+func (k Key) String() string { return hex.EncodeToString(k[:]) }
+
+// NewKey is a random audit key.
+func NewKey() (Key, error) {
+	var k Key
+	_, err := crand.Read(k[:])
+	return k, err
+}
+
+// ParseKey reads a hex audit key.
+func ParseKey(s string) (Key, error) {
+	var k Key
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != len(k) {
+		return k, fmt.Errorf("%w: audit key is not 32 bytes of hex", errs.ErrInvalidInput)
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// Salt is the salt of row i of batchID's leaf.
+func (k Key) Salt(batchID [32]byte, i int) [32]byte {
+	m := hmac.New(sha256.New, k[:])
+	m.Write([]byte(saltDomain))
+	m.Write(batchID[:])
+	binary.Write(m, binary.BigEndian, uint32(i))
+	var s [32]byte
+	copy(s[:], m.Sum(nil))
+	return s
+}
+
+// Commitments are the public archive of a batch's rows, one leaf per row in
+// batch order.
+type Commitments struct {
+	Version int      `json:"version"`
+	BatchID string   `json:"batch_id"` // hex, circuit.BatchID of the proven public inputs
+	Leaves  []string `json:"leaves"`   // hex, Leaf of each row
+	Root    string   `json:"root"`     // hex, Root(Leaves)
+}
+
+// Leaf is SHA-256(leafDomain || salt || index || size || nonce || sig), index
+// as 4 bytes, size and nonce as 8, big-endian, sig the 64 compressed bytes.
+func Leaf(salt [32]byte, i int, row server.ProveRow) ([32]byte, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(row.Sig, "0x"))
+	if err != nil || len(sig) != 64 {
+		return [32]byte{}, fmt.Errorf("%w: row %d sig is not 64 bytes of hex", errs.ErrInvalidInput, i)
+	}
+	h := sha256.New()
+	h.Write([]byte(leafDomain))
+	h.Write(salt[:])
+	binary.Write(h, binary.BigEndian, uint32(i))
+	binary.Write(h, binary.BigEndian, row.Size)
+	binary.Write(h, binary.BigEndian, row.Nonce)
+	h.Write(sig)
+	var l [32]byte
+	copy(l[:], h.Sum(nil))
+	return l, nil
+}
+
+// Root is SHA-256(rootDomain || n || leaves...), n as 4 bytes.
+func Root(leaves [][32]byte) [32]byte {
+	h := sha256.New()
+	h.Write([]byte(rootDomain))
+	binary.Write(h, binary.BigEndian, uint32(len(leaves)))
+	for _, l := range leaves {
+		h.Write(l[:])
+	}
+	var r [32]byte
+	copy(r[:], h.Sum(nil))
+	return r
+}
+
+// Commit commits to req's rows, which must be the batch proven with pub
+// under profile.
+func Commit(profile circuit.Profile, pub circuit.SettlementCircuitPublic, req *server.ProveRequest, key Key) (*Commitments, error) {
+	if err := checkProfile(profile); err != nil {
+		return nil, err
+	}
+	id, err := checkBatch(profile, pub, req)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([][32]byte, len(req.Rows))
+	c := &Commitments{Version: Version, BatchID: hex.EncodeToString(id[:])}
+	for i, row := range req.Rows {
+		if leaves[i], err = Leaf(key.Salt(id, i), i, row); err != nil {
+			return nil, err
+		}
+		c.Leaves = append(c.Leaves, hex.EncodeToString(leaves[i][:]))
+	}
+	root := Root(leaves)
+	c.Root = hex.EncodeToString(root[:])
+	return c, nil
+}
+
+// checkProfile refuses a profile whose BatchDataRoot no opened row can be
+// checked against at its index.
+func checkProfile(profile circuit.Profile) error {
+	if profile.DataHash != circuit.DataHashMiMCTree {
+		return fmt.Errorf("%w: profile %s roots its rows with %s, a hash chain no single row opens to; spot audits need data hash %s",
+			errs.ErrInvalidInput, profile.Name, profile.DataHash, circuit.DataHashMiMCTree)
+	}
+	if profile.Ordering == circuit.OrderingPermuted {
+		return fmt.Errorf("%w: profile %s roots its rows in nonce order, not the order they are committed in; spot audits need ordering other than %s",
+			errs.ErrInvalidInput, profile.Name, circuit.OrderingPermuted)
+	}
+	return nil
+}
+
+// checkBatch is the batch ID of pub, once req is known to be its batch.
+func checkBatch(profile circuit.Profile, pub circuit.SettlementCircuitPublic, req *server.ProveRequest) ([32]byte, error) {
+	batchPub, err := server.BatchPublic(profile, req)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	diff, err := circuit.DiffPublic(batchPub, pub)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if len(diff) > 0 {
+		return [32]byte{}, fmt.Errorf("%w: the batch is not the proven one: %s differ", errs.ErrArtifactMismatch, strings.Join(diff, ", "))
+	}
+	return circuit.BatchID(pub)
+}
+
+// leaves decodes c, checking its root.
+func (c *Commitments) leaves() ([][32]byte, [32]byte, error) {
+	var root [32]byte
+	if c.Version != Version {
+		return nil, root, fmt.Errorf("%w: unsupported commitments version %d", errs.ErrArtifactMismatch, c.Version)
+	}
+	leaves := make([][32]byte, len(c.Leaves))
+	for i, l := range c.Leaves {
+		b, err := hex.DecodeString(l)
+		if err != nil || len(b) != 32 {
+			return nil, root, fmt.Errorf("%w: leaf %d is not 32 bytes of hex", errs.ErrInvalidInput, i)
+		}
+		copy(leaves[i][:], b)
+	}
+	root = Root(leaves)
+	if hex.EncodeToString(root[:]) != c.Root {
+		return nil, root, fmt.Errorf("%w: commitments root %s, its leaves give %x", errs.ErrArtifactMismatch, c.Root, root)
+	}
+	return leaves, root, nil
+}
+
+var _ io.WriterTo = (*Commitments)(nil)
+var _ io.ReaderFrom = (*Commitments)(nil)
+
+func (c *Commitments) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+func (c *Commitments) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: commitments: %w", errs.ErrInvalidInput, err)
+	}
+	_, _, err = c.leaves()
+	return int64(len(data)), err
+}
+
+// Sample is the k rows of pub's n-row batch an audit opens, ascending: a
+// partial Fisher–Yates shuffle of 0..n-1 driven by ChaCha8 seeded with
+// SHA-256(sampleDomain || batch ID || BatchDataRoot || n || k),
+// BatchDataRoot as 32 bytes big-endian, n and k as 4. Nothing the operator
+// picks after proving enters the seed.
+func Sample(pub circuit.SettlementCircuitPublic, n, k int) ([]int, error) {
+	if k < 1 || k > n {
+		return nil, fmt.Errorf("%w: %d rows to sample from %d", errs.ErrInvalidInput, k, n)
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return nil, err
+	}
+	dataRoot, err := field(pub.BatchDataRoot)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(sampleDomain))
+	h.Write(id[:])
+	h.Write(dataRoot.FillBytes(make([]byte, 32)))
+	binary.Write(h, binary.BigEndian, uint32(n))
+	binary.Write(h, binary.BigEndian, uint32(k))
+	var seed [32]byte
+	copy(seed[:], h.Sum(nil))
+
+	rng := rand.New(rand.NewChaCha8(seed))
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	for i := range k {
+		j := i + rng.IntN(n-i)
+		idx[i], idx[j] = idx[j], idx[i]
+	}
+	rows := idx[:k]
+	slices.Sort(rows)
+	return rows, nil
+}
+
+// Opening is one committed row as the operator reveals it.
+type Opening struct {
+	Index int    `json:"index"`
+	Size  uint64 `json:"size"` // base units
+	Nonce uint64 `json:"nonce"`
+	Sig   string `json:"sig"`  // hex, 64-byte EdDSA signature of the row message
+	Salt  string `json:"salt"` // hex, the leaf's salt
+	// Path is the siblings of the row's leaf in the data tree up to
+	// BatchDataRoot, hex, leaf level first
+	Path []string `json:"path"`
+}
+
+// Openings answer one audit.
+type Openings struct {
+	BatchID string    `json:"batch_id"` // hex
+	Rows    []Opening `json:"rows"`
+}
+
+// Open reveals req's rows at indices, each with its path in the data
+// tree; the caller has checked req is the batch batchID names (Commit does).
+func Open(batchID [32]byte, req *server.ProveRequest, key Key, indices []int) (*Openings, error) {
+	level := make([]*big.Int, treeWidth(len(req.Rows)))
+	for i := range level {
+		level[i] = new(big.Int)
+		if i < len(req.Rows) {
+			level[i] = dataLeaf(req.Rows[i].Size, req.Rows[i].Nonce)
+		}
+	}
+	// levels[h] holds the tree's nodes at height h, below the root
+	var levels [][]*big.Int
+	for len(level) > 1 {
+		up := make([]*big.Int, len(level)/2)
+		for i := range up {
+			up[i] = circuit.DataLeaf(level[2*i], level[2*i+1])
+		}
+		levels, level = append(levels, level), up
+	}
+
+	o := &Openings{BatchID: hex.EncodeToString(batchID[:])}
+	for _, i := range indices {
+		if i < 0 || i >= len(req.Rows) {
+			return nil, fmt.Errorf("%w: row %d of %d", errs.ErrInvalidInput, i, len(req.Rows))
+		}
+		salt := key.Salt(batchID, i)
+		row := req.Rows[i]
+		op := Opening{Index: i, Size: row.Size, Nonce: row.Nonce, Sig: row.Sig, Salt: hex.EncodeToString(salt[:])}
+		for h, nodes := range levels {
+			op.Path = append(op.Path, hex.EncodeToString(nodes[i>>h^1].Bytes()))
+		}
+		o.Rows = append(o.Rows, op)
+	}
+	return o, nil
+}
+
+// dataLeaf is a row's leaf in the data tree.
+func dataLeaf(size, nonce uint64) *big.Int {
+	return circuit.DataLeaf(new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce))
+}
+
+// treeWidth is the number of leaves of the data tree over n rows.
+func treeWidth(n int) int {
+	w := 1
+	for w < n {
+		w *= 2
+	}
+	return w
+}
+
+// opensTo reports whether r's size and nonce sit at its index of a data
+// tree of width leaves rooted at root.
+func (r Opening) opensTo(root *big.Int, width int) (bool, error) {
+	if 1<<len(r.Path) != width {
+		return false, nil
+	}
+	n := dataLeaf(r.Size, r.Nonce)
+	for h, s := range r.Path {
+		sibling, ok := new(big.Int).SetString(s, 16)
+		if !ok || sibling.Cmp(ecc.BN254.ScalarField()) >= 0 {
+			return false, fmt.Errorf("%w: row %d path node %d is not a field element in hex", errs.ErrInvalidInput, r.Index, h)
+		}
+		if r.Index>>h&1 == 0 {
+			n = circuit.DataLeaf(n, sibling)
+		} else {
+			n = circuit.DataLeaf(sibling, n)
+		}
+	}
+	return n.Cmp(root) == 0, nil
+}
+
+// Report is a passed audit.
+type Report struct {
+	BatchID string `json:"batch_id"`
+	N       int    `json:"n"`
+	Rows    []int  `json:"rows"` // opened, each leaf and signature checked
+	// Miss1 is the chance a batch with one unsigned row passes this audit,
+	// Miss(N, len(Rows), 1).
+	Miss1 float64 `json:"miss_1"`
+}
+
+// Check checks o against the commitments and the proven public inputs:
+// o opens exactly Sample(pub, N, k), each opening is its leaf and opens to
+// BatchDataRoot at its index, each row is signed under pub's key for
+// pub's recipient and chain with profile's message version, and each lies
+// within the proven nonce range and total.
+func Check(profile circuit.Profile, pub circuit.SettlementCircuitPublic, c *Commitments, k int, o *Openings) (*Report, error) {
+	if err := checkProfile(profile); err != nil {
+		return nil, err
+	}
+	leaves, _, err := c.leaves()
+	if err != nil {
+		return nil, err
+	}
+	if len(leaves) != profile.N {
+		return nil, fmt.Errorf("%w: %d commitments, profile %s batches have %d rows", errs.ErrArtifactMismatch, len(leaves), profile.Name, profile.N)
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return nil, err
+	}
+	if c.BatchID != hex.EncodeToString(id[:]) {
+		return nil, fmt.Errorf("%w: commitments are of batch %.16s, the public inputs of %x", errs.ErrArtifactMismatch, c.BatchID, id[:8])
+	}
+	if o.BatchID != c.BatchID {
+		return nil, fmt.Errorf("%w: openings are of batch %.16s, not %.16s", errs.ErrVerificationFailed, o.BatchID, c.BatchID)
+	}
+	rows, err := Sample(pub, len(leaves), k)
+	if err != nil {
+		return nil, err
+	}
+	dataRoot, err := field(pub.BatchDataRoot)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]int, len(o.Rows))
+	for i, r := range o.Rows {
+		opened[i] = r.Index
+	}
+	if !slices.Equal(opened, rows) {
+		return nil, fmt.Errorf("%w: opened rows %v, the sample is %v", errs.ErrVerificationFailed, opened, rows)
+	}
+
+	var vals struct{ recipient, kOld, m, total, chainID, x, y *big.Int }
+	for _, f := range []struct {
+		dst **big.Int
+		v   any
+	}{{&vals.recipient, pub.Recipient}, {&vals.kOld, pub.KOld}, {&vals.m, pub.M}, {&vals.total, pub.TotalSettle}, {&vals.chainID, pub.ChainID}, {&vals.x, pub.Pk.A.X}, {&vals.y, pub.Pk.A.Y}} {
+		if *f.dst, err = field(f.v); err != nil {
+			return nil, err
+		}
+	}
+	var pk bnEddsa.PublicKey
+	pk.A.X.SetBigInt(vals.x)
+	pk.A.Y.SetBigInt(vals.y)
+	if !pk.A.IsOnCurve() {
+		return nil, fmt.Errorf("%w: pk_x, pk_y is not a curve point", errs.ErrInvalidInput)
+	}
+	pkBytes := pk.Bytes()
+
+	sum := new(big.Int)
+	prevNonce := int64(-1)
+	for _, r := range o.Rows {
+		saltBytes, err := hex.DecodeString(r.Salt)
+		if err != nil || len(saltBytes) != 32 {
+			return nil, fmt.Errorf("%w: row %d salt is not 32 bytes of hex", errs.ErrInvalidInput, r.Index)
+		}
+		row := server.ProveRow{Size: r.Size, Nonce: r.Nonce, Sig: r.Sig}
+		leaf, err := Leaf([32]byte(saltBytes), r.Index, row)
+		if err != nil {
+			return nil, err
+		}
+		if leaf != leaves[r.Index] {
+			return nil, fmt.Errorf("%w: row %d does not open its commitment", errs.ErrVerificationFailed, r.Index)
+		}
+		if ok, err := r.opensTo(dataRoot, treeWidth(len(leaves))); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("%w: row %d is not in the proven batch data", errs.ErrVerificationFailed, r.Index)
+		}
+		size, nonce := new(big.Int).SetUint64(r.Size), new(big.Int).SetUint64(r.Nonce)
+		msg := circuit.MsgHash(profile.Msg, vals.recipient, size, nonce, vals.chainID)
+		sig, _ := hex.DecodeString(strings.TrimPrefix(r.Sig, "0x"))
+		if err := (circuit.EdDSA{}).Verify(pkBytes, sig, msg); err != nil {
+			return nil, fmt.Errorf("%w: row %d: %w", errs.ErrVerificationFailed, r.Index, err)
+		}
+		if nonce.Cmp(vals.m) > 0 || (profile.Ordering != circuit.OrderingUnique && nonce.Cmp(vals.kOld) <= 0) {
+			return nil, fmt.Errorf("%w: row %d nonce %d outside the proven range (%s, %s]", errs.ErrVerificationFailed, r.Index, r.Nonce, vals.kOld, vals.m)
+		}
+		// monotonic batches are in nonce order, the last row's nonce is M
+		if profile.Ordering == circuit.OrderingMonotonic {
+			if int64(r.Nonce) <= prevNonce || (r.Index == profile.N-1 && nonce.Cmp(vals.m) != 0) {
+				return nil, fmt.Errorf("%w: row %d nonce %d out of order", errs.ErrVerificationFailed, r.Index, r.Nonce)
+			}
+			prevNonce = int64(r.Nonce)
+		}
+		if sum.Add(sum, size).Cmp(vals.total) > 0 {
+			return nil, fmt.Errorf("%w: opened sizes sum past total_settle %s", errs.ErrVerificationFailed, vals.total)
+		}
+	}
+	return &Report{BatchID: c.BatchID, N: len(leaves), Rows: rows, Miss1: Miss(len(leaves), len(rows), 1)}, nil
+}
+
+// Miss is the chance k rows sampled without replacement from n miss all b
+// bad ones: C(n-b, k) / C(n, k).
+func Miss(n, k, b int) float64 {
+	p := 1.0
+	for i := range k {
+		if n-b-i <= 0 {
+			return 0
+		}
+		p *= float64(n-b-i) / float64(n-i)
+	}
+	return p
+}
+
+// field is a public input as the JSON decoder leaves it.
+func field(v any) (*big.Int, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case []byte:
+		return new(big.Int).SetBytes(v), nil
+	}
+	return nil, fmt.Errorf("%w: unexpected public input type %T", errs.ErrInvalidInput, v)
+}
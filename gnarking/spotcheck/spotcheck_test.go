@@ -0,0 +1,203 @@
+package spotcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/keys"
+	"gnarking/server"
+)
+
+// batch is a signed 8-row batch of a mimc-tree profile and its public
+// inputs; row forged, when not negative, carries a signature by another key.
+func batch(t *testing.T, forged int) (circuit.Profile, circuit.SettlementCircuitPublic, *server.ProveRequest) {
+	t.Helper()
+	profile := circuit.Profile{Name: "tree-8", N: 8, DataHash: circuit.DataHashMiMCTree}
+	operator, err := keys.Derive(keys.Seed{1}, keys.Path{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keys.Derive(keys.Seed{2}, keys.Path{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &server.ProveRequest{Recipient: "2a", ChainID: 1, Pk: hex.EncodeToString(operator.PublicKey.Bytes())}
+	for i := range profile.N {
+		size, nonce := uint64(10*i+1), uint64(i+1)
+		msg := circuit.MsgHash(profile.Msg, big.NewInt(42), new(big.Int).SetUint64(size), new(big.Int).SetUint64(nonce), big.NewInt(1))
+		signer := operator
+		if i == forged {
+			signer = other
+		}
+		sig, err := circuit.EdDSA{}.Sign(signer, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Rows = append(req.Rows, server.ProveRow{Size: size, Nonce: nonce, Sig: hex.EncodeToString(sig)})
+	}
+	pub, err := server.BatchPublic(profile, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile, pub, req
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	profile, pub, req := batch(t, -1)
+	key := Key{7}
+	c, err := Commit(profile, pub, req, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	var read Commitments
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sample is a function of the batch alone
+	rows, err := Sample(pub, len(read.Leaves), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := Sample(pub, 8, 3)
+	if len(rows) != 3 || !slices.IsSorted(rows) || !slices.Equal(rows, again) {
+		t.Fatalf("sample %v, again %v", rows, again)
+	}
+	if all, _ := Sample(pub, profile.N, profile.N); !slices.Equal(all, []int{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("sampling all rows gives %v", all)
+	}
+	if _, err := Sample(pub, profile.N, profile.N+1); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("k > n: %v, want ErrInvalidInput", err)
+	}
+
+	dir := t.TempDir()
+	archive := Archive{Dir: dir, Key: key}
+	id, _ := circuit.BatchID(pub)
+	if err := archive.Put(id, req); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(archive.Handler())
+	defer srv.Close()
+	client := &Client{URL: srv.URL}
+	r, err := Audit(ctx, client, profile, pub, &read, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(r.Rows, rows) || r.N != 8 || math.Abs(r.Miss1-5.0/8) > 1e-9 {
+		t.Fatalf("report %+v", r)
+	}
+
+	// what an operator could send instead of the sampled rows
+	o, err := client.Open(ctx, id, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(name string, f func(o *Openings)) {
+		t.Helper()
+		bad := *o
+		bad.Rows = slices.Clone(o.Rows)
+		f(&bad)
+		if _, err := Check(profile, pub, c, 3, &bad); !errors.Is(err, errs.ErrVerificationFailed) {
+			t.Errorf("%s: %v, want ErrVerificationFailed", name, err)
+		}
+	}
+	tamper("other rows", func(o *Openings) { o.Rows[0].Index = (o.Rows[0].Index + 1) % 8 })
+	tamper("a row left out", func(o *Openings) { o.Rows = o.Rows[1:] })
+	tamper("size changed", func(o *Openings) { o.Rows[1].Size++ })
+	tamper("salt changed", func(o *Openings) { o.Rows[2].Salt = hex.EncodeToString(make([]byte, 32)) })
+	tamper("other batch", func(o *Openings) { o.BatchID = hex.EncodeToString(make([]byte, 32)) })
+	tamper("path changed", func(o *Openings) {
+		o.Rows[0].Path = slices.Clone(o.Rows[0].Path)
+		o.Rows[0].Path[1] = "01"
+	})
+
+	// an unsigned row passes only when it is not sampled
+	profile, forgedPub, forgedReq := batch(t, 5)
+	fc, err := Commit(profile, forgedPub, forgedReq, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fid, _ := circuit.BatchID(forgedPub)
+	if err := archive.Put(fid, forgedReq); err != nil {
+		t.Fatal(err)
+	}
+	for k := 1; k <= profile.N; k++ {
+		sample, _ := Sample(forgedPub, len(fc.Leaves), k)
+		_, err := Audit(ctx, archive, profile, forgedPub, fc, k)
+		if slices.Contains(sample, 5) != errors.Is(err, errs.ErrVerificationFailed) {
+			t.Fatalf("k %d samples %v: %v", k, sample, err)
+		}
+	}
+	// nor when the operator, knowing the sample, commits to a signed row
+	// in its place: it is not the proven row
+	swapped := *forgedReq
+	swapped.Rows = slices.Clone(forgedReq.Rows)
+	swapped.Rows[5] = forgedReq.Rows[7]
+	sc := &Commitments{Version: Version, BatchID: hex.EncodeToString(fid[:])}
+	leaves := make([][32]byte, len(swapped.Rows))
+	for i, row := range swapped.Rows {
+		leaves[i], _ = Leaf(key.Salt(fid, i), i, row)
+		sc.Leaves = append(sc.Leaves, hex.EncodeToString(leaves[i][:]))
+	}
+	root := Root(leaves)
+	sc.Root = hex.EncodeToString(root[:])
+	sample, _ := Sample(forgedPub, profile.N, profile.N)
+	so, err := Open(fid, &swapped, key, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Check(profile, forgedPub, sc, profile.N, so); !errors.Is(err, errs.ErrVerificationFailed) || !strings.Contains(err.Error(), "is not in the proven batch data") {
+		t.Fatalf("swapped row: %v, want a row not in the batch data", err)
+	}
+
+	// a profile whose root no single row opens to has no audits
+	plain, _ := circuit.LookupProfile("8")
+	if _, err := Commit(plain, pub, req, key); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("commit under a mimc profile: %v, want ErrInvalidInput", err)
+	}
+
+	// commitments are bound to the proven batch (signatures are not public
+	// inputs: the forged batch proves the same ones)
+	moved := *req
+	moved.Rows = slices.Clone(req.Rows)
+	moved.Rows[0].Size++
+	if _, err := Commit(profile, pub, &moved, key); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("commit to another batch: %v, want ErrArtifactMismatch", err)
+	}
+	movedPub, _ := server.BatchPublic(profile, &moved)
+	if _, err := Check(profile, movedPub, c, 3, o); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("other public inputs: %v, want ErrArtifactMismatch", err)
+	}
+	if _, err := client.Open(ctx, [32]byte{1}, rows); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("unknown batch: %v, want ErrNotFound", err)
+	}
+}
+
+func TestMiss(t *testing.T) {
+	for _, c := range []struct {
+		n, k, b int
+		want    float64
+	}{
+		{8, 8, 1, 0},
+		{8, 1, 1, 7.0 / 8},
+		{100, 10, 0, 1},
+		{100, 10, 5, 95.0 * 94 * 93 * 92 * 91 * 90 * 89 * 88 * 87 * 86 / (100.0 * 99 * 98 * 97 * 96 * 95 * 94 * 93 * 92 * 91)},
+	} {
+		if got := Miss(c.n, c.k, c.b); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("Miss(%d, %d, %d) = %v, want %v", c.n, c.k, c.b, got, c.want)
+		}
+	}
+}
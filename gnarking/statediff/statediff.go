@@ -0,0 +1,145 @@
+// Package statediff describes what settling proven batches does to the
+// settlement contract's state, for indexers and accounting systems that
+// apply it without re-parsing batch data or on-chain logs: per batch and
+// per recipient, the amount settled and the recipient's KOld before and
+// after. A Diff is written next to the proof it describes.
+package statediff
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+const Version = 1
+
+// Diff is the effect of settling Batches in order, in one transaction or
+// one after another, on the chain they are bound to.
+type Diff struct {
+	Version   int    `json:"version"`
+	Profile   string `json:"profile"`
+	ChainID   string `json:"chain_id"`             // decimal
+	SizeScale int    `json:"size_scale,omitempty"` // decimal places of the amounts' units, the deployment's
+	// BlockTarget is the chain head the batches were built at, their KOld
+	// read there or later: the diff applies to the state from that block
+	// on. 0 when the batches were not built against the chain.
+	BlockTarget uint64      `json:"block_target,omitempty"`
+	Batches     []Batch     `json:"batches"`
+	Recipients  []Recipient `json:"recipients"` // the net effect, by recipient
+}
+
+// Batch is one batch's effect: its recipient's KOld moves to KNew and
+// Settled is paid out. Amounts are base units, decimal.
+type Batch struct {
+	BatchID   string `json:"batch_id"`  // hex, circuit.BatchID
+	Recipient string `json:"recipient"` // 0x-hex, as in the public inputs JSON
+	KOld      string `json:"k_old"`
+	KNew      string `json:"k_new"` // the batch's M
+	Settled   string `json:"settled"`
+}
+
+// Recipient is the net effect of a diff's batches on one recipient.
+type Recipient struct {
+	Recipient string `json:"recipient"`
+	KOld      string `json:"k_old"` // before its first batch
+	KNew      string `json:"k_new"` // after its last
+	Settled   string `json:"settled"`
+	Batches   int    `json:"batches"`
+}
+
+// New is the diff of settling the batches of pubs, proven under profile,
+// in order. They must share a chain, and a recipient's batches must chain
+// KOld to the previous one's M, as the contract requires of them.
+func New(profile circuit.Profile, blockTarget uint64, pubs ...circuit.SettlementCircuitPublic) (*Diff, error) {
+	if len(pubs) == 0 {
+		return nil, fmt.Errorf("%w: no batches", errs.ErrInvalidInput)
+	}
+	d := &Diff{Version: Version, Profile: profile.Name, SizeScale: profile.SizeScale, BlockTarget: blockTarget}
+	net := make(map[string]*Recipient)
+	settled := make(map[string]*big.Int)
+	for i, pub := range pubs {
+		var p circuit.SettlementCircuitPublicJSON
+		b, err := json.Marshal(pub)
+		if err == nil {
+			err = json.Unmarshal(b, &p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+		id, err := circuit.BatchID(pub)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+		chainID := (*big.Int)(&p.ChainID).String()
+		if i == 0 {
+			d.ChainID = chainID
+		} else if chainID != d.ChainID {
+			return nil, fmt.Errorf("%w: batch %d is for chain %s, batch 0 for %s", errs.ErrInvalidBatch, i, chainID, d.ChainID)
+		}
+		batch := Batch{
+			BatchID:   hex.EncodeToString(id[:]),
+			Recipient: p.Recipient,
+			KOld:      (*big.Int)(&p.KOld).String(),
+			KNew:      (*big.Int)(&p.M).String(),
+			Settled:   (*big.Int)(&p.TotalSettle).String(),
+		}
+		d.Batches = append(d.Batches, batch)
+
+		r, ok := net[batch.Recipient]
+		if !ok {
+			r = &Recipient{Recipient: batch.Recipient, KOld: batch.KOld}
+			net[batch.Recipient] = r
+			settled[batch.Recipient] = new(big.Int)
+		} else if batch.KOld != r.KNew {
+			return nil, fmt.Errorf("%w: batch %d for recipient %s starts at KOld %s, its previous batch ends at %s", errs.ErrStaleNonce, i, batch.Recipient, batch.KOld, r.KNew)
+		}
+		r.KNew = batch.KNew
+		r.Batches++
+		settled[batch.Recipient].Add(settled[batch.Recipient], (*big.Int)(&p.TotalSettle))
+	}
+	for recipient, r := range net {
+		r.Settled = settled[recipient].String()
+		d.Recipients = append(d.Recipients, *r)
+	}
+	slices.SortFunc(d.Recipients, func(a, b Recipient) int { return recipientCmp(a.Recipient, b.Recipient) })
+	return d, nil
+}
+
+// recipientCmp orders 0x-hex recipients by value.
+func recipientCmp(a, b string) int {
+	x, _ := new(big.Int).SetString("0"+a[2:], 16)
+	y, _ := new(big.Int).SetString("0"+b[2:], 16)
+	return x.Cmp(y)
+}
+
+var _ io.WriterTo = (*Diff)(nil)
+var _ io.ReaderFrom = (*Diff)(nil)
+
+func (d *Diff) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+func (d *Diff) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, d); err != nil {
+		return int64(len(data)), fmt.Errorf("%w: state diff: %w", errs.ErrInvalidInput, err)
+	}
+	if d.Version != Version {
+		return int64(len(data)), fmt.Errorf("%w: state diff version %d, want %d", errs.ErrArtifactMismatch, d.Version, Version)
+	}
+	return int64(len(data)), nil
+}
@@ -0,0 +1,66 @@
+package statediff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func public(t *testing.T, recipient string, kOld, m, total, chainID int) circuit.SettlementCircuitPublic {
+	t.Helper()
+	var pub circuit.SettlementCircuitPublic
+	js := fmt.Sprintf(`{"recipient": %q, "k_old": "%d", "m": "%d", "total_settle": "%d", "chain_id": "%d",
+		"pk_x": "2a8d6951c9d6af7164cf30c995cbf329768b0a138672a24b7764552c8432adbf",
+		"pk_y": "0fe62eb78b1ebe7db09dc9be5b89b0c20c094cb2d208789f7f8700bf3f855fb3",
+		"batch_data_root": "0x01"}`, recipient, kOld, m, total, chainID)
+	if err := pub.UnmarshalJSON([]byte(js)); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestNew(t *testing.T) {
+	profile, err := circuit.LookupProfile(circuit.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(profile, 100,
+		public(t, "0x2b", 0, 8, 30, 1),
+		public(t, "0x2a", 0, 8, 8, 1),
+		public(t, "0x2b", 8, 16, 12, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ChainID != "1" || d.BlockTarget != 100 || len(d.Batches) != 3 || d.Batches[2].KOld != "8" || d.Batches[2].KNew != "16" {
+		t.Fatalf("diff %+v", d)
+	}
+	want := []Recipient{
+		{Recipient: "0x2a", KOld: "0", KNew: "8", Settled: "8", Batches: 1},
+		{Recipient: "0x2b", KOld: "0", KNew: "16", Settled: "42", Batches: 2},
+	}
+	if fmt.Sprint(d.Recipients) != fmt.Sprint(want) {
+		t.Fatalf("recipients %+v, want %+v", d.Recipients, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var back Diff
+	if _, err := back.ReadFrom(&buf); err != nil || fmt.Sprint(back) != fmt.Sprint(*d) {
+		t.Fatalf("round trip: %+v, %v", back, err)
+	}
+
+	// the contract would revert a batch not starting where the last ended
+	if _, err := New(profile, 0, public(t, "0x2a", 0, 8, 8, 1), public(t, "0x2a", 0, 8, 9, 1)); !errors.Is(err, errs.ErrStaleNonce) {
+		t.Fatalf("unchained batches: %v", err)
+	}
+	if _, err := New(profile, 0, public(t, "0x2a", 0, 8, 8, 1), public(t, "0x2b", 0, 8, 8, 5)); !errors.Is(err, errs.ErrInvalidBatch) {
+		t.Fatalf("batches for two chains: %v", err)
+	}
+}
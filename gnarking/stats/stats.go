@@ -0,0 +1,381 @@
+// Package stats keeps the statistics of every proof made, N, constraints,
+// phase timings, peak memory and cost, in an embedded time-series store:
+// append-only JSONL segments, one per UTC day, so retention deletes whole
+// files and a query over a window reads only the days it spans. Summarize
+// turns a window into percentiles.
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gnarking/errs"
+	"gnarking/prover"
+)
+
+// Sample is one proof.
+type Sample struct {
+	Time        time.Time     `json:"time"` // when proving ended
+	BatchID     string        `json:"batch_id,omitempty"`
+	Profile     string        `json:"profile"`
+	N           int           `json:"n"`
+	Constraints int           `json:"constraints,omitempty"`
+	Cores       int           `json:"cores,omitempty"`
+	ProveTime   time.Duration `json:"prove_time_ns"`
+	PeakMemory  uint64        `json:"peak_memory_bytes,omitempty"` // Go-managed, memwatch.InUse
+	CostUSD     float64       `json:"cost_usd,omitempty"`
+	// Timings break ProveTime down: the solve, the FFTs and each MSM
+	Timings *prover.Timings `json:"timings,omitempty"`
+}
+
+// Retention bounds the store. Segments go whole, oldest first; the one
+// being written is kept.
+type Retention struct {
+	MaxAge   time.Duration // segments whose day ended longer ago are deleted; 0 keeps them
+	MaxBytes int64         // the oldest segments are deleted while the store is larger; 0 for no limit
+}
+
+const day = 24 * time.Hour
+
+const segmentPrefix, segmentSuffix = "stats-", ".jsonl"
+
+func segmentName(t time.Time) string {
+	return segmentPrefix + t.UTC().Format(time.DateOnly) + segmentSuffix
+}
+
+// segmentDay is the day a segment file holds, false for other files.
+func segmentDay(name string) (time.Time, bool) {
+	d, ok := strings.CutPrefix(name, segmentPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	if d, ok = strings.CutSuffix(d, segmentSuffix); !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.DateOnly, d)
+	return t, err == nil
+}
+
+// Store is a directory of segments. It is safe for concurrent use; one
+// process writes a store at a time.
+type Store struct {
+	dir       string
+	retention Retention
+
+	mu  sync.Mutex
+	f   *os.File
+	day time.Time // of f
+}
+
+// Open opens the store in dir, creating it, and applies r.
+func Open(dir string, r Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, retention: r}
+	if _, err := s.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append records x in the segment of its day. Starting a new segment
+// applies the retention.
+func (s *Store) Append(x Sample) error {
+	line, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := x.Time.UTC().Truncate(day)
+	if s.f == nil || !d.Equal(s.day) {
+		if s.f != nil {
+			s.f.Close()
+			s.f = nil
+		}
+		f, err := os.OpenFile(filepath.Join(s.dir, segmentName(d)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.f, s.day = f, d
+		if _, err := s.prune(time.Now()); err != nil {
+			return err
+		}
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+type segment struct {
+	name string
+	day  time.Time
+	size int64
+}
+
+// segments lists the segment files, oldest first.
+func (s *Store) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []segment
+	for _, e := range entries {
+		d, ok := segmentDay(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segment{e.Name(), d, info.Size()})
+	}
+	slices.SortFunc(out, func(a, b segment) int { return a.day.Compare(b.day) })
+	return out, nil
+}
+
+// Prune deletes the segments the retention no longer keeps at now and
+// returns how many.
+func (s *Store) Prune(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prune(now)
+}
+
+func (s *Store) prune(now time.Time) (int, error) {
+	segs, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, seg := range segs {
+		total += seg.size
+	}
+	removed := 0
+	for _, seg := range segs {
+		if s.f != nil && seg.day.Equal(s.day) {
+			continue
+		}
+		old := s.retention.MaxAge > 0 && now.Sub(seg.day.Add(day)) > s.retention.MaxAge
+		big := s.retention.MaxBytes > 0 && total > s.retention.MaxBytes
+		if !old && !big {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, seg.name)); err != nil {
+			return removed, err
+		}
+		total -= seg.size
+		removed++
+	}
+	return removed, nil
+}
+
+// Query selects samples in [From, To); zero bounds are open, an empty
+// Profile matches every profile.
+type Query struct {
+	From, To time.Time
+	Profile  string
+}
+
+func (q Query) match(x Sample) bool {
+	return (q.From.IsZero() || !x.Time.Before(q.From)) &&
+		(q.To.IsZero() || x.Time.Before(q.To)) &&
+		(q.Profile == "" || x.Profile == q.Profile)
+}
+
+// Query returns the samples q selects, oldest first. A line that does not
+// parse, the torn end of a segment after a crash, is skipped.
+func (s *Store) Query(q Query) ([]Sample, error) {
+	s.mu.Lock()
+	segs, err := s.segments()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var out []Sample
+	for _, seg := range segs {
+		if (!q.From.IsZero() && !seg.day.Add(day).After(q.From)) || (!q.To.IsZero() && !seg.day.Before(q.To)) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, seg.name))
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			var x Sample
+			if json.Unmarshal(sc.Bytes(), &x) == nil && q.match(x) {
+				out = append(out, x)
+			}
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Sample) int { return a.Time.Compare(b.Time) })
+	return out, nil
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// Field is a statistic Summarize takes percentiles of.
+type Field string
+
+const (
+	FieldProveTime   Field = "prove_time" // seconds
+	FieldMemory      Field = "memory"     // MiB
+	FieldCost        Field = "cost"       // USD
+	FieldConstraints Field = "constraints"
+	FieldPerRow      Field = "per_row" // prove seconds per row
+	// seconds, of Sample.Timings, named as prover.Timings.Phases
+	FieldSolve  Field = "solve"
+	FieldCommit Field = "commit"
+	FieldFFT    Field = "fft"
+	FieldMSM    Field = "msm"
+	FieldMSMA   Field = "msm_a"
+	FieldMSMB1  Field = "msm_b1"
+	FieldMSMB2  Field = "msm_b2"
+	FieldMSMK   Field = "msm_k"
+	FieldMSMZ   Field = "msm_z"
+)
+
+// Fields lists every Field.
+var Fields = []Field{FieldProveTime, FieldMemory, FieldCost, FieldConstraints, FieldPerRow,
+	FieldSolve, FieldCommit, FieldFFT, FieldMSM, FieldMSMA, FieldMSMB1, FieldMSMB2, FieldMSMK, FieldMSMZ}
+
+// ParseField reads a Field by name.
+func ParseField(s string) (Field, error) {
+	if f := Field(s); slices.Contains(Fields, f) {
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: unknown field %q, want one of %v", errs.ErrInvalidInput, s, Fields)
+}
+
+// value is f of x, false when x did not record it.
+func (f Field) value(x Sample) (float64, bool) {
+	switch f {
+	case FieldProveTime:
+		return x.ProveTime.Seconds(), true
+	case FieldMemory:
+		return float64(x.PeakMemory) / (1 << 20), x.PeakMemory > 0
+	case FieldCost:
+		return x.CostUSD, x.CostUSD > 0
+	case FieldConstraints:
+		return float64(x.Constraints), x.Constraints > 0
+	case FieldPerRow:
+		return x.ProveTime.Seconds() / float64(x.N), x.N > 0
+	}
+	if x.Timings != nil {
+		for _, p := range x.Timings.Phases() {
+			if p.Phase == string(f) {
+				return p.Duration.Seconds(), p.Duration > 0
+			}
+		}
+	}
+	return 0, false
+}
+
+// Percentile is the value at P percent of a summary's samples.
+type Percentile struct {
+	P     float64 `json:"p"`
+	Value float64 `json:"value"`
+}
+
+// Summary is the distribution of one field over one profile's samples.
+type Summary struct {
+	Profile     string       `json:"profile"`
+	Field       Field        `json:"field"`
+	Count       int          `json:"count"`
+	Min         float64      `json:"min"`
+	Max         float64      `json:"max"`
+	Mean        float64      `json:"mean"`
+	Percentiles []Percentile `json:"percentiles"`
+}
+
+// Summarize takes the percentiles ps (0-100) of f over samples, one
+// Summary per profile, sorted by name. Samples that did not record f are
+// left out; profiles with none are too.
+func Summarize(samples []Sample, f Field, ps []float64) []Summary {
+	byProfile := make(map[string][]float64)
+	for _, x := range samples {
+		if v, ok := f.value(x); ok {
+			byProfile[x.Profile] = append(byProfile[x.Profile], v)
+		}
+	}
+	var out []Summary
+	for _, profile := range slices.Sorted(maps.Keys(byProfile)) {
+		vs := byProfile[profile]
+		slices.Sort(vs)
+		sum := Summary{Profile: profile, Field: f, Count: len(vs), Min: vs[0], Max: vs[len(vs)-1]}
+		var total float64
+		for _, v := range vs {
+			total += v
+		}
+		sum.Mean = total / float64(len(vs))
+		sum.Percentiles = Percentiles(vs, ps)
+		out = append(out, sum)
+	}
+	return out
+}
+
+// Percentiles takes the percentiles ps (0-100) of sorted, which must not be
+// empty.
+func Percentiles(sorted []float64, ps []float64) []Percentile {
+	var out []Percentile
+	for _, p := range ps {
+		out = append(out, Percentile{P: p, Value: percentile(sorted, p)})
+	}
+	return out
+}
+
+// percentile interpolates linearly between the closest ranks of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	rank := math.Max(0, math.Min(1, p/100)) * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := min(lo+1, len(sorted)-1)
+	return sorted[lo] + (rank-float64(lo))*(sorted[hi]-sorted[lo])
+}
+
+// WriteTable writes summaries as an aligned text table.
+func WriteTable(w io.Writer, sums []Summary) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-10s %-12s %6s %12s %12s", "profile", "field", "count", "min", "mean")
+	if len(sums) > 0 {
+		for _, p := range sums[0].Percentiles {
+			fmt.Fprintf(&b, " %12s", "p"+formatP(p.P))
+		}
+	}
+	fmt.Fprintf(&b, " %12s\n", "max")
+	for _, s := range sums {
+		fmt.Fprintf(&b, "%-10s %-12s %6d %12.4g %12.4g", s.Profile, s.Field, s.Count, s.Min, s.Mean)
+		for _, p := range s.Percentiles {
+			fmt.Fprintf(&b, " %12.4g", p.Value)
+		}
+		fmt.Fprintf(&b, " %12.4g\n", s.Max)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func formatP(p float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", p), "0"), ".")
+}
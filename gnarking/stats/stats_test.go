@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gnarking/prover"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 30 {
+		// three days, ten proofs each, prove times 1..10s
+		x := Sample{
+			Time:      day0.Add(time.Duration(i/10)*day + time.Duration(i%10)*time.Hour),
+			Profile:   "8",
+			N:         8,
+			ProveTime: time.Duration(i%10+1) * time.Second,
+		}
+		if i%10 == 9 {
+			x.Profile = "64"
+		}
+		if i < 2 {
+			x.Timings = &prover.Timings{Solve: time.Duration(i+1) * time.Second, FFT: time.Duration(i+2) * time.Second, MSMB2: time.Duration(i+3) * time.Second}
+		}
+		if err := s.Append(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	// a torn line at the end of a segment
+	f, _ := os.OpenFile(filepath.Join(dir, "stats-2026-03-03.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"time":"2026-03-03T23:00:00Z","prof`)
+	f.Close()
+
+	all, err := s.Query(Query{})
+	if err != nil || len(all) != 30 {
+		t.Fatalf("Query: %d samples, %v", len(all), err)
+	}
+	window, _ := s.Query(Query{From: day0.Add(day + 3*time.Hour), To: day0.Add(2 * day), Profile: "8"})
+	if len(window) != 6 {
+		t.Errorf("day 2 from 03:00, profile 8: %d samples, want 6", len(window))
+	}
+
+	sums := Summarize(all, FieldProveTime, []float64{50, 90})
+	if len(sums) != 2 || sums[0].Profile != "64" || sums[1].Profile != "8" {
+		t.Fatalf("summaries %+v", sums)
+	}
+	p8 := sums[1]
+	if p8.Count != 27 || p8.Min != 1 || p8.Max != 9 || p8.Percentiles[0].Value != 5 {
+		t.Errorf("profile 8: %+v", p8)
+	}
+	// 90th of 27 values 1..9 (three each): rank 23.4 between 8 and 9
+	if got := p8.Percentiles[1].Value; math.Abs(got-8.4) > 1e-9 {
+		t.Errorf("p90 = %v, want 8.4", got)
+	}
+	if got := Summarize(all, FieldMemory, []float64{50}); len(got) != 0 {
+		t.Errorf("memory was not recorded, got %+v", got)
+	}
+	if got := Summarize(all, FieldSolve, []float64{50}); len(got) != 1 || got[0].Count != 2 || got[0].Max != 2 {
+		t.Errorf("solve: %+v", got)
+	}
+	if got := Summarize(all, FieldFFT, []float64{50}); len(got) != 1 || got[0].Count != 2 || got[0].Max != 3 {
+		t.Errorf("fft: %+v", got)
+	}
+	if got := Summarize(all, FieldMSMB2, []float64{50}); len(got) != 1 || got[0].Count != 2 || got[0].Max != 4 {
+		t.Errorf("msm_b2: %+v", got)
+	}
+	if got := Summarize(all, FieldMSM, []float64{50}); len(got) != 0 {
+		t.Errorf("msm was not recorded, got %+v", got)
+	}
+
+	// retention: by age keeps the days that ended less than 36h ago
+	s, _ = Open(dir, Retention{})
+	s.retention = Retention{MaxAge: 36 * time.Hour}
+	if n, err := s.Prune(day0.Add(3*day + 12*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Prune by age: %d removed, %v", n, err)
+	}
+	if left, _ := s.Query(Query{}); len(left) != 20 || !left[0].Time.Equal(day0.Add(day)) {
+		t.Errorf("after pruning by age: %d samples from %v", len(left), left[0].Time)
+	}
+	// by size, oldest first, the segment being written kept
+	s.retention = Retention{}
+	if err := s.Append(Sample{Time: day0.Add(3 * day), Profile: "8", N: 8, ProveTime: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	s.retention = Retention{MaxBytes: 1}
+	if n, err := s.Prune(day0.Add(3 * day)); err != nil || n != 2 {
+		t.Fatalf("Prune by size: %d removed, %v", n, err)
+	}
+	if left, _ := s.Query(Query{}); len(left) != 1 {
+		t.Errorf("after pruning by size: %d samples, want the current segment's 1", len(left))
+	}
+	s.Close()
+}
@@ -0,0 +1,230 @@
+package stream
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+)
+
+// Kafka consumes Topics as consumer group Group through a Confluent REST
+// Proxy (API v2), with automatic commits off: Ack commits, per partition,
+// the offsets up to the first message not yet acknowledged, so a restart
+// resumes at the oldest intent whose batch is not proven. Messages are
+// JSON, each value an intent.
+type Kafka struct {
+	Proxy  string // e.g. http://127.0.0.1:8082
+	Group  string
+	Topics []string
+	HTTP   *http.Client  // http.DefaultClient when nil
+	Wait   time.Duration // long-poll time of a fetch, default 1s
+
+	base  string // the consumer instance, once created
+	parts map[partition]*offsets
+	buf   []Delivery // fetched past a Fetch's max
+}
+
+type partition struct {
+	topic string
+	n     int
+}
+
+// offsets tracks a partition's messages fetched and not committed, in
+// order; offsets may skip, e.g. on compacted topics.
+type offsets struct {
+	fetched []int64
+	acked   map[int64]bool
+	last    int64 // the last offset to commit
+}
+
+type kafkaRecord struct {
+	Topic     string          `json:"topic"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Value     json.RawMessage `json:"value"`
+}
+
+const kafkaJSON = "application/vnd.kafka.json.v2+json"
+
+var _ Source = (*Kafka)(nil)
+
+// start creates the consumer instance and subscribes it.
+func (k *Kafka) start(ctx context.Context) error {
+	if k.base != "" {
+		return nil
+	}
+	var created struct {
+		InstanceID string `json:"instance_id"`
+		BaseURI    string `json:"base_uri"`
+	}
+	group := strings.TrimSuffix(k.Proxy, "/") + "/consumers/" + url.PathEscape(k.Group)
+	cfg := map[string]string{"format": "json", "auto.offset.reset": "earliest", "auto.commit.enable": "false"}
+	if err := k.do(ctx, http.MethodPost, group, cfg, &created); err != nil {
+		return fmt.Errorf("kafka consumer: %w", err)
+	}
+	if err := k.do(ctx, http.MethodPost, created.BaseURI+"/subscription", map[string][]string{"topics": k.Topics}, nil); err != nil {
+		k.do(ctx, http.MethodDelete, created.BaseURI, nil, nil)
+		return fmt.Errorf("kafka subscription: %w", err)
+	}
+	k.base = created.BaseURI
+	k.parts = make(map[partition]*offsets)
+	return nil
+}
+
+func (k *Kafka) Fetch(ctx context.Context, max int) ([]Delivery, error) {
+	if err := k.start(ctx); err != nil {
+		return nil, err
+	}
+	if len(k.buf) == 0 {
+		if err := k.poll(ctx); err != nil {
+			return nil, err
+		}
+	}
+	n := min(max, len(k.buf))
+	ds := k.buf[:n:n]
+	k.buf = k.buf[n:]
+	return ds, nil
+}
+
+// poll reads the records the proxy has into buf; its batches are bounded
+// by bytes, not count.
+func (k *Kafka) poll(ctx context.Context) error {
+	wait := cmp.Or(k.Wait, time.Second)
+	q := url.Values{"timeout": {fmt.Sprint(wait.Milliseconds())}}
+	var records []kafkaRecord
+	err := k.do(ctx, http.MethodGet, k.base+"/records?"+q.Encode(), nil, &records)
+	if errors.Is(err, errs.ErrNotFound) {
+		// the proxy expired the instance: a new one starts at the
+		// committed offsets, redelivering what was not acknowledged
+		k.base, k.parts = "", nil
+		return fmt.Errorf("%w: kafka consumer expired: %w", errs.ErrUnavailable, err)
+	}
+	if err != nil {
+		return fmt.Errorf("kafka records: %w", err)
+	}
+	for _, rec := range records {
+		p := partition{rec.Topic, rec.Partition}
+		o, ok := k.parts[p]
+		if !ok {
+			o = &offsets{acked: make(map[int64]bool)}
+			k.parts[p] = o
+		}
+		o.fetched = append(o.fetched, rec.Offset)
+		k.buf = append(k.buf, Delivery{Data: rec.Value, ref: kafkaRef{p, rec.Offset}})
+	}
+	return nil
+}
+
+type kafkaRef struct {
+	p      partition
+	offset int64
+}
+
+// Ack marks ds acknowledged and commits every partition whose committed
+// offset they move.
+func (k *Kafka) Ack(ctx context.Context, ds []Delivery) error {
+	moved := make(map[partition]bool)
+	for _, d := range ds {
+		ref, ok := d.ref.(kafkaRef)
+		if !ok {
+			return fmt.Errorf("%w: not a kafka delivery", errs.ErrInvalidInput)
+		}
+		o := k.parts[ref.p]
+		if o == nil {
+			continue // fetched by an expired instance
+		}
+		o.acked[ref.offset] = true
+		for len(o.fetched) > 0 && o.acked[o.fetched[0]] {
+			o.last = o.fetched[0]
+			delete(o.acked, o.last)
+			o.fetched = o.fetched[1:]
+			moved[ref.p] = true
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	type offset struct {
+		Topic     string `json:"topic"`
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+	var commit struct {
+		Offsets []offset `json:"offsets"`
+	}
+	for p := range moved {
+		// v2 takes the last offset consumed and commits the one after it,
+		// where the group resumes
+		commit.Offsets = append(commit.Offsets, offset{p.topic, p.n, k.parts[p].last})
+	}
+	if err := k.do(ctx, http.MethodPost, k.base+"/offsets", commit, nil); err != nil {
+		return fmt.Errorf("kafka commit: %w", err)
+	}
+	return nil
+}
+
+// Close deletes the consumer instance, handing its partitions back to the
+// group.
+func (k *Kafka) Close() error {
+	if k.base == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := k.do(ctx, http.MethodDelete, k.base, nil, nil)
+	k.base = ""
+	return err
+}
+
+// do sends in, JSON, and decodes the reply into out when it is set.
+func (k *Kafka) do(ctx context.Context, method, endpoint string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", kafkaJSON)
+	}
+	req.Header.Set("Accept", kafkaJSON)
+	client := k.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		sentinel := errs.ErrUnavailable
+		if resp.StatusCode == http.StatusNotFound {
+			sentinel = errs.ErrNotFound
+		}
+		return fmt.Errorf("%w: %s %s: %s: %s", sentinel, method, endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %s %s: %w", errs.ErrUnavailable, method, endpoint, err)
+	}
+	return nil
+}
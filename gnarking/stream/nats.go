@@ -0,0 +1,318 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gnarking/errs"
+)
+
+// NATS pulls from the JetStream consumer Consumer of Stream, speaking the
+// NATS client protocol over TCP, upgraded to TLS for a tls:// URL or a
+// server that requires it. Credentials are only sent over TLS: a nats://
+// URL carrying them is refused. The consumer must exist, with
+// explicit acks and an AckWait longer than a batch takes to prove: a
+// message not acknowledged within it is redelivered, and intake absorbs
+// the repeat, but the batch holding it is proven before it is acked.
+type NATS struct {
+	URL      string // nats://host:4222, or tls://[user:pass@ | token@]host:4222
+	Stream   string
+	Consumer string
+	Wait     time.Duration  // long-poll time of a fetch, default 1s
+	RootCAs  *x509.CertPool // the server certificate's roots; the system's when nil
+
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string
+	seq   int
+}
+
+var _ Source = (*NATS)(nil)
+
+// natsMsg is a message a fetch reply carries.
+type natsMsg struct {
+	reply  string
+	status string // the header status line's code, "" for a message
+	data   []byte
+}
+
+// connect dials URL, when not connected, and subscribes the inbox fetches
+// are answered on.
+func (n *NATS) connect(ctx context.Context) error {
+	if n.conn != nil {
+		return nil
+	}
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return fmt.Errorf("%w: nats url: %w", errs.ErrInvalidInput, err)
+	}
+	var secure bool
+	switch u.Scheme {
+	case "nats":
+		if u.User != nil {
+			return fmt.Errorf("%w: nats url: credentials over plaintext, use tls://", errs.ErrInvalidInput)
+		}
+	case "tls":
+		secure = true
+	default:
+		return fmt.Errorf("%w: nats url: scheme %q, want nats or tls", errs.ErrInvalidInput, u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := n.handshake(ctx, u, secure); err != nil {
+		n.drop()
+		return err
+	}
+	n.conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// natsInfo is what connect reads of the server's INFO.
+type natsInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+}
+
+// handshake reads the server's INFO, upgrades to TLS when secure or the
+// server requires it, then connects and subscribes the inbox.
+func (n *NATS) handshake(ctx context.Context, u *url.URL, secure bool) error {
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("%w: nats: %w", errs.ErrUnavailable, err)
+	}
+	payload, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("%w: nats: server sent %q, not INFO", errs.ErrUnavailable, strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return fmt.Errorf("%w: nats: INFO: %w", errs.ErrUnavailable, err)
+	}
+	if secure && !info.TLSRequired && !info.TLSAvailable {
+		return fmt.Errorf("%w: nats: %s offers no TLS", errs.ErrUnavailable, u.Host)
+	}
+	if secure || info.TLSRequired {
+		c := tls.Client(n.conn, &tls.Config{ServerName: u.Hostname(), RootCAs: n.RootCAs, MinVersion: tls.VersionTLS12})
+		if err := c.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("%w: nats: tls: %w", errs.ErrUnavailable, err)
+		}
+		n.conn, n.r = c, bufio.NewReader(c)
+	}
+
+	user := u.User
+	opts := map[string]any{"verbose": false, "pedantic": false, "headers": true, "no_responders": true, "lang": "go", "name": "ddm stream"}
+	if user != nil {
+		if pass, ok := user.Password(); ok {
+			opts["user"], opts["pass"] = user.Username(), pass
+		} else {
+			opts["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	var b [8]byte
+	rand.Read(b[:])
+	n.inbox = "_INBOX." + hex.EncodeToString(b[:])
+	if err := n.write("CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", connect, n.inbox); err != nil {
+		return err
+	}
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%w: nats: %w", errs.ErrUnavailable, err)
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%w: nats: %s", errs.ErrUnavailable, line)
+		}
+	}
+}
+
+func (n *NATS) write(format string, args ...any) error {
+	if _, err := fmt.Fprintf(n.conn, format, args...); err != nil {
+		n.drop()
+		return fmt.Errorf("%w: nats: %w", errs.ErrUnavailable, err)
+	}
+	return nil
+}
+
+// drop closes a broken connection; the next call reconnects.
+func (n *NATS) drop() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.r = nil, nil
+	}
+}
+
+// Fetch asks the consumer for max messages, waiting up to Wait for them.
+func (n *NATS) Fetch(ctx context.Context, max int) ([]Delivery, error) {
+	if err := n.connect(ctx); err != nil {
+		return nil, err
+	}
+	wait := cmp.Or(n.Wait, time.Second)
+	n.seq++
+	reply := fmt.Sprintf("%s.%d", n.inbox, n.seq)
+	req, _ := json.Marshal(map[string]any{"batch": max, "expires": wait.Nanoseconds()})
+	subject := fmt.Sprintf("$JS.API.CONSUMER.MSG.NEXT.%s.%s", n.Stream, n.Consumer)
+	if err := n.write("PUB %s %s %d\r\n%s\r\n", subject, reply, len(req), req); err != nil {
+		return nil, err
+	}
+	// the server answers by the deadline: a status once expired
+	deadline := time.Now().Add(wait + 5*time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	n.conn.SetReadDeadline(deadline)
+	defer func() {
+		if n.conn != nil {
+			n.conn.SetReadDeadline(time.Time{})
+		}
+	}()
+	var ds []Delivery
+	for len(ds) < max {
+		m, subject, err := n.read()
+		if err != nil {
+			if len(ds) > 0 {
+				// keep what arrived; the connection is redialed next time
+				return ds, nil
+			}
+			return nil, err
+		}
+		switch {
+		case m.status == "":
+			ds = append(ds, Delivery{Data: m.data, ref: m.reply})
+		case subject != reply:
+			// a status of an earlier fetch
+		case m.status == "100":
+			// idle heartbeat
+		case m.status == "404", m.status == "408", m.status == "409":
+			// no messages, expired, or the consumer's limits: this fetch
+			// is over
+			return ds, nil
+		default:
+			return ds, fmt.Errorf("%w: nats: fetch status %s", errs.ErrUnavailable, m.status)
+		}
+	}
+	return ds, nil
+}
+
+// read reads up to the next message on the inbox, answering pings.
+func (n *NATS) read() (natsMsg, string, error) {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			// a timeout too: the server did not answer by the deadline
+			n.drop()
+			return natsMsg{}, "", fmt.Errorf("%w: nats: %w", errs.ErrUnavailable, err)
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "PING":
+			if err := n.write("PONG\r\n"); err != nil {
+				return natsMsg{}, "", err
+			}
+		case "-ERR":
+			n.drop()
+			return natsMsg{}, "", fmt.Errorf("%w: nats: %s", errs.ErrUnavailable, strings.TrimSpace(line))
+		case "MSG", "HMSG":
+			m, subject, err := n.msg(f)
+			if err != nil {
+				n.drop()
+			}
+			return m, subject, err
+		}
+		// +OK, PONG, INFO
+	}
+}
+
+// msg reads the payload of a MSG or HMSG line, split into fields:
+//
+//	MSG <subject> <sid> [reply] <bytes>
+//	HMSG <subject> <sid> [reply] <header bytes> <bytes>
+func (n *NATS) msg(f []string) (natsMsg, string, error) {
+	hdrs := f[0] == "HMSG"
+	want := 4
+	if hdrs {
+		want = 5
+	}
+	if len(f) != want && len(f) != want+1 {
+		return natsMsg{}, "", fmt.Errorf("%w: nats: malformed %s", errs.ErrUnavailable, f[0])
+	}
+	var m natsMsg
+	if len(f) == want+1 {
+		m.reply = f[3]
+	}
+	total, err := strconv.Atoi(f[len(f)-1])
+	hdrLen := 0
+	if err == nil && hdrs {
+		hdrLen, err = strconv.Atoi(f[len(f)-2])
+	}
+	if err != nil || hdrLen > total || total > 64<<20 {
+		return natsMsg{}, "", fmt.Errorf("%w: nats: malformed %s sizes", errs.ErrUnavailable, f[0])
+	}
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(n.r, buf); err != nil {
+		return natsMsg{}, "", fmt.Errorf("%w: nats: %w", errs.ErrUnavailable, err)
+	}
+	hdr, data := buf[:hdrLen], buf[hdrLen:total]
+	if hdrs {
+		// NATS/1.0 404 No Messages\r\n...
+		status, _, _ := bytes.Cut(hdr, []byte("\r\n"))
+		if fields := strings.Fields(string(status)); len(fields) > 1 {
+			m.status = fields[1]
+		}
+	}
+	m.data = data
+	return m, f[1], nil
+}
+
+// Ack acknowledges each message on its reply subject.
+func (n *NATS) Ack(ctx context.Context, ds []Delivery) error {
+	if err := n.connect(ctx); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	for _, d := range ds {
+		reply, ok := d.ref.(string)
+		if !ok {
+			return fmt.Errorf("%w: not a nats delivery", errs.ErrInvalidInput)
+		}
+		fmt.Fprintf(&b, "PUB %s 4\r\n+ACK\r\n", reply)
+	}
+	return n.write("%s", b.Bytes())
+}
+
+func (n *NATS) Close() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn, n.r = nil, nil
+	return err
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gnarking/errs"
+)
+
+// natsServer answers a NATS client's handshake and every fetch with 404 No
+// Messages, over TLS when cfg is set. It sends each CONNECT it reads.
+func natsServer(t *testing.T, info string, cfg *tls.Config) (string, chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connects := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveNATS(conn, info, cfg, connects)
+		}
+	}()
+	return ln.Addr().String(), connects
+}
+
+func serveNATS(conn net.Conn, info string, cfg *tls.Config, connects chan string) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO %s\r\n", info)
+	if cfg != nil {
+		c := tls.Server(conn, cfg)
+		if c.Handshake() != nil {
+			return
+		}
+		conn = c
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch f := strings.Fields(line); f[0] {
+		case "CONNECT":
+			connects <- line
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			r.ReadString('\n')
+			hdr := "NATS/1.0 404 No Messages\r\n\r\n"
+			fmt.Fprintf(conn, "HMSG %s 1 %d %d\r\n%s\r\n", f[2], len(hdr), len(hdr), hdr)
+		}
+	}
+}
+
+func TestNATSTLS(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cfg := &tls.Config{Certificates: ts.TLS.Certificates}
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	ts.Close()
+
+	fetch := func(url string, roots *x509.CertPool) error {
+		n := &NATS{URL: url, Stream: "S", Consumer: "C", RootCAs: roots}
+		defer n.Close()
+		ds, err := n.Fetch(ctx, 1)
+		if err == nil && len(ds) != 0 {
+			t.Fatalf("%s: %d deliveries", url, len(ds))
+		}
+		return err
+	}
+
+	// credentials go over TLS
+	addr, connects := natsServer(t, `{"tls_available":true}`, cfg)
+	if err := fetch("tls://ddm:secret@"+addr, roots); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-connects; !strings.Contains(c, `"pass":"secret"`) {
+		t.Fatalf("connect %s", c)
+	}
+	// and never over plaintext: refused before dialing
+	if err := fetch("nats://ddm:secret@"+addr, roots); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("credentials over nats://: %v", err)
+	}
+	if err := fetch("tls://"+addr, nil); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("untrusted certificate: %v", err)
+	}
+
+	// a server requiring TLS gets it from a nats:// URL too
+	addr, connects = natsServer(t, `{"tls_required":true}`, cfg)
+	if err := fetch("nats://"+addr, roots); err != nil {
+		t.Fatal(err)
+	}
+	<-connects
+
+	// tls:// to a server without TLS fails rather than falling back
+	addr, connects = natsServer(t, `{}`, nil)
+	if err := fetch("tls://token@"+addr, roots); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("tls:// to a plaintext server: %v", err)
+	}
+	select {
+	case c := <-connects:
+		t.Fatalf("sent %s in plaintext", c)
+	default:
+	}
+}
@@ -0,0 +1,453 @@
+// Package stream feeds the prover from event infrastructure: an Adapter
+// consumes signed intents (intake.Intent JSON) from a Kafka topic or a NATS
+// JetStream consumer, registers each with the server's intake, cuts them
+// into batches of the profile's N rows and proves them. Delivery is at
+// least once: a message is acknowledged only once its intent is settled one
+// way or the other, proven in a batch or refused for good, so a crash
+// redelivers every intent not yet proven and intake's (pk, nonce)
+// idempotency absorbs the repeats. Fetching pauses while the server's
+// queue is deep, leaving the backlog in the broker rather than in memory.
+package stream
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/intake"
+	"gnarking/server"
+	"gnarking/submitter"
+)
+
+// Delivery is one message of a Source.
+type Delivery struct {
+	Data []byte
+	ref  any // the Source's handle for Ack
+}
+
+// Source is a broker consumer. Fetch waits, up to the source's own long-poll
+// time, for at most max messages and may return none. Ack acknowledges
+// deliveries of its own, in any order. An Adapter calls a Source from one
+// goroutine.
+type Source interface {
+	Fetch(ctx context.Context, max int) ([]Delivery, error)
+	Ack(ctx context.Context, ds []Delivery) error
+	Close() error
+}
+
+// Prover is the server an Adapter feeds; *server.Client is one.
+type Prover interface {
+	Intent(ctx context.Context, in intake.Intent) (intake.Record, bool, error)
+	Prove(ctx context.Context, batch *server.ProveRequest) (submitter.Submission, error)
+	Status(ctx context.Context) (server.Status, error)
+}
+
+var _ Prover = (*server.Client)(nil)
+
+// Adapter batches the intents of Source and proves them on Prover. Intents
+// are batched by signer, recipient and chain, in nonce order, N at a time;
+// one batch per recipient is in flight, the next built on its M.
+type Adapter struct {
+	Source  Source
+	Prover  Prover
+	Profile circuit.Profile
+	// KOld, when set, is read for a recipient's first batch and whenever
+	// it is ahead of the last M proven here; without it KOld starts at 0.
+	KOld chainsync.Source
+	// MaxQueue pauses fetching while the server has this many batches
+	// queued or more; 0 never pauses.
+	MaxQueue int
+	// MaxPending pauses fetching while this many intents are held and a
+	// batch is in flight, default 4N. Intents short of a batch never
+	// pause it.
+	MaxPending int
+	// Poll is how long a pause lasts before the queue is checked again,
+	// and the wait before a failed batch is retried; default 1s.
+	Poll time.Duration
+	// Proven is called with every batch proven, before its messages are
+	// acknowledged. An error stops Run with them unacknowledged.
+	Proven func(submitter.Submission) error
+}
+
+// groupKey is what a batch shares.
+type groupKey struct {
+	pk, recipient string
+	chainID       uint64
+}
+
+// account is the recipient and chain a KOld belongs to.
+type account struct {
+	recipient string
+	chainID   uint64
+}
+
+// held is an intent waiting for its batch, with every delivery of it.
+type held struct {
+	in intake.Intent
+	ds []Delivery
+}
+
+type group struct {
+	rows    map[uint64]*held // by nonce
+	retryAt time.Time
+}
+
+type result struct {
+	g    groupKey
+	rows []*held
+	sub  submitter.Submission
+	err  error
+}
+
+// run is the state of one Run, owned by its goroutine.
+type run struct {
+	a        *Adapter
+	groups   map[groupKey]*group
+	kOld     map[account]uint64
+	inflight map[account]bool
+	retry    []Delivery // intake was unavailable
+	pending  int
+	results  chan result
+	busy     int
+}
+
+// Run consumes Source until ctx is done or a Source, Proven or intake
+// configuration error. It waits for the batches in flight before it
+// returns; the caller closes Source.
+func (a *Adapter) Run(ctx context.Context) error {
+	r := &run{
+		a:        a,
+		groups:   make(map[groupKey]*group),
+		kOld:     make(map[account]uint64),
+		inflight: make(map[account]bool),
+		results:  make(chan result),
+	}
+	err := r.loop(ctx)
+	for r.busy > 0 {
+		if rerr := r.finish(context.WithoutCancel(ctx), <-r.results); err == nil && ctx.Err() == nil {
+			err = rerr
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (a *Adapter) poll() time.Duration {
+	if a.Poll > 0 {
+		return a.Poll
+	}
+	return time.Second
+}
+
+func (a *Adapter) maxPending() int {
+	if a.MaxPending > 0 {
+		return a.MaxPending
+	}
+	return 4 * a.Profile.N
+}
+
+func (r *run) loop(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// results first: they free rows and accounts
+		for drained := false; !drained && r.busy > 0; {
+			select {
+			case res := <-r.results:
+				if err := r.finish(ctx, res); err != nil {
+					return err
+				}
+			default:
+				drained = true
+			}
+		}
+		if err := r.cut(ctx); err != nil {
+			return err
+		}
+		if wait, err := r.backpressure(ctx); err != nil {
+			return err
+		} else if wait {
+			if err := r.sleep(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ds := r.retry
+		r.retry = nil
+		if len(ds) == 0 {
+			var err error
+			ds, err = r.a.Source.Fetch(ctx, r.a.Profile.N)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case errors.Is(err, errs.ErrUnavailable):
+				log.Printf("stream: fetch: %v", err)
+				if err := r.sleep(ctx); err != nil {
+					return err
+				}
+				continue
+			case err != nil:
+				return fmt.Errorf("fetch: %w", err)
+			}
+		}
+		for _, d := range ds {
+			if err := r.take(ctx, d); err != nil {
+				return err
+			}
+		}
+		if len(r.retry) > 0 {
+			if err := r.sleep(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sleep waits a poll interval, or less when a batch finishes.
+func (r *run) sleep(ctx context.Context) error {
+	t := time.NewTimer(r.a.poll())
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-t.C:
+		return nil
+	case res := <-r.results:
+		return r.finish(ctx, res)
+	}
+}
+
+// backpressure reports whether fetching should pause: too many intents
+// held while batches are in flight, or the server's queue at MaxQueue.
+func (r *run) backpressure(ctx context.Context) (bool, error) {
+	if r.busy > 0 && r.pending >= r.a.maxPending() {
+		return true, nil
+	}
+	if r.a.MaxQueue <= 0 {
+		return false, nil
+	}
+	st, err := r.a.Prover.Status(ctx)
+	if err != nil {
+		if errors.Is(err, errs.ErrUnavailable) {
+			log.Printf("stream: server status: %v", err)
+			return true, nil
+		}
+		return false, err
+	}
+	return st.Backlog.Queue >= r.a.MaxQueue, nil
+}
+
+// take registers d's intent with intake and holds it for a batch. Messages
+// that are not intents of the profile, or that intake refuses, are
+// acknowledged and dropped: redelivering them would not change the answer.
+func (r *run) take(ctx context.Context, d Delivery) error {
+	var in intake.Intent
+	if err := json.Unmarshal(d.Data, &in); err != nil {
+		log.Printf("stream: dropping a message that is not an intent: %v", err)
+		return r.ack(ctx, []Delivery{d})
+	}
+	if cmp.Or(in.Profile, circuit.DefaultProfile) != r.a.Profile.Name {
+		log.Printf("stream: dropping intent %s/%d of profile %s, proving %s", in.Pk, in.Nonce, cmp.Or(in.Profile, circuit.DefaultProfile), r.a.Profile.Name)
+		return r.ack(ctx, []Delivery{d})
+	}
+	rec, _, err := r.a.Prover.Intent(ctx, in)
+	switch {
+	case errors.Is(err, errs.ErrUnavailable):
+		r.retry = append(r.retry, d)
+		return nil
+	case errors.Is(err, errs.ErrNotFound):
+		return fmt.Errorf("intake: %w", err)
+	case err != nil:
+		log.Printf("stream: dropping intent %s/%d: %v", in.Pk, in.Nonce, err)
+		return r.ack(ctx, []Delivery{d})
+	case rec.Status == intake.StatusProven || rec.Status == intake.StatusSettled:
+		return r.ack(ctx, []Delivery{d})
+	}
+	// intake's copy is canonical: hex in one form
+	in = rec.Intent
+	k := groupKey{pk: in.Pk, recipient: in.Recipient, chainID: in.ChainID}
+	g, ok := r.groups[k]
+	if !ok {
+		g = &group{rows: make(map[uint64]*held)}
+		r.groups[k] = g
+	}
+	if h, ok := g.rows[in.Nonce]; ok {
+		h.ds = append(h.ds, d)
+		return nil
+	}
+	g.rows[in.Nonce] = &held{in: in, ds: []Delivery{d}}
+	r.pending++
+	return nil
+}
+
+// cut starts a batch for every group holding N rows whose account has
+// none in flight.
+func (r *run) cut(ctx context.Context) error {
+	now := time.Now()
+	for _, k := range slices.SortedFunc(maps.Keys(r.groups), compareGroups) {
+		g := r.groups[k]
+		acct := account{k.recipient, k.chainID}
+		if len(g.rows) < r.a.Profile.N || r.inflight[acct] || now.Before(g.retryAt) {
+			continue
+		}
+		kOld, err := r.kOldOf(ctx, acct)
+		if err != nil {
+			return err
+		}
+		rows := make([]*held, 0, len(g.rows))
+		var stale []Delivery
+		for _, nonce := range slices.Sorted(maps.Keys(g.rows)) {
+			h := g.rows[nonce]
+			if r.a.Profile.Ordering != circuit.OrderingUnique && nonce <= kOld {
+				log.Printf("stream: dropping intent %s/%d, recipient %s is at KOld %d", k.pk, nonce, k.recipient, kOld)
+				stale = append(stale, h.ds...)
+				r.drop(k, nonce)
+				continue
+			}
+			rows = append(rows, h)
+		}
+		if err := r.ack(ctx, stale); err != nil {
+			return err
+		}
+		if len(rows) < r.a.Profile.N {
+			continue
+		}
+		rows = rows[:r.a.Profile.N]
+		for _, h := range rows {
+			r.drop(k, h.in.Nonce)
+		}
+		r.inflight[acct] = true
+		r.busy++
+		go r.prove(ctx, k, kOld, rows)
+	}
+	return nil
+}
+
+// kOldOf is the KOld the next batch of acct builds on.
+func (r *run) kOldOf(ctx context.Context, acct account) (uint64, error) {
+	if r.a.Profile.Ordering == circuit.OrderingUnique {
+		return 0, nil
+	}
+	local := r.kOld[acct]
+	if r.a.KOld == nil {
+		return local, nil
+	}
+	recipient, _ := new(big.Int).SetString(strings.TrimPrefix(acct.recipient, "0x"), 16)
+	chain, err := r.a.KOld.KOld(ctx, recipient)
+	if err != nil {
+		return 0, fmt.Errorf("KOld of %s: %w", acct.recipient, err)
+	}
+	if !chain.IsUint64() {
+		return 0, fmt.Errorf("%w: KOld of %s is %s", errs.ErrInvalidInput, acct.recipient, chain)
+	}
+	// ahead of the chain: the last batch proven here has not settled yet
+	return max(local, chain.Uint64()), nil
+}
+
+func (r *run) prove(ctx context.Context, k groupKey, kOld uint64, rows []*held) {
+	req := &server.ProveRequest{
+		Profile:   r.a.Profile.Name,
+		Recipient: k.recipient,
+		ChainID:   k.chainID,
+		KOld:      kOld,
+		Pk:        k.pk,
+		SizeScale: r.a.Profile.SizeScale,
+		Rows:      make([]server.ProveRow, len(rows)),
+	}
+	for i, h := range rows {
+		req.Rows[i] = server.ProveRow{Size: h.in.Size, Nonce: h.in.Nonce, Sig: h.in.Sig}
+	}
+	sub, err := r.a.Prover.Prove(ctx, req)
+	r.results <- result{g: k, rows: rows, sub: sub, err: err}
+}
+
+// finish takes a batch's result: proven, its messages are acknowledged;
+// failed for want of resources, its rows go back to their group; refused,
+// they are dropped.
+func (r *run) finish(ctx context.Context, res result) error {
+	r.busy--
+	acct := account{res.g.recipient, res.g.chainID}
+	delete(r.inflight, acct)
+	var ds []Delivery
+	for _, h := range res.rows {
+		ds = append(ds, h.ds...)
+	}
+	switch {
+	case res.err == nil:
+		if r.a.Proven != nil {
+			if err := r.a.Proven(res.sub); err != nil {
+				return err
+			}
+		}
+		// the rows are in nonce order: the last is M
+		r.kOld[acct] = res.rows[len(res.rows)-1].in.Nonce
+		return r.ack(ctx, ds)
+	case errors.Is(res.err, context.Canceled),
+		errors.Is(res.err, errs.ErrUnavailable),
+		errors.Is(res.err, errs.ErrProverTimeout),
+		errors.Is(res.err, errs.ErrMemoryLimit):
+		log.Printf("stream: batch of %s to %s failed, retrying: %v", res.g.pk, res.g.recipient, res.err)
+		g, ok := r.groups[res.g]
+		if !ok {
+			g = &group{rows: make(map[uint64]*held)}
+			r.groups[res.g] = g
+		}
+		for _, h := range res.rows {
+			if prev, ok := g.rows[h.in.Nonce]; ok {
+				// redelivered while in flight
+				h.ds = append(h.ds, prev.ds...)
+				r.pending--
+			}
+			g.rows[h.in.Nonce] = h
+			r.pending++
+		}
+		g.retryAt = time.Now().Add(r.a.poll())
+		return nil
+	default:
+		log.Printf("stream: dropping a batch of %s to %s: %v", res.g.pk, res.g.recipient, res.err)
+		return r.ack(ctx, ds)
+	}
+}
+
+// drop forgets a held row.
+func (r *run) drop(k groupKey, nonce uint64) {
+	g := r.groups[k]
+	delete(g.rows, nonce)
+	r.pending--
+	if len(g.rows) == 0 {
+		delete(r.groups, k)
+	}
+}
+
+func (r *run) ack(ctx context.Context, ds []Delivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	err := r.a.Source.Ack(ctx, ds)
+	if errors.Is(err, errs.ErrUnavailable) {
+		// the broker redelivers, intake absorbs the repeats
+		log.Printf("stream: ack: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ack: %w", err)
+	}
+	return nil
+}
+
+func compareGroups(a, b groupKey) int {
+	return cmp.Or(strings.Compare(a.recipient, b.recipient), cmp.Compare(a.chainID, b.chainID), strings.Compare(a.pk, b.pk))
+}
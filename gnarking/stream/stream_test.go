@@ -0,0 +1,284 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/intake"
+	"gnarking/server"
+	"gnarking/submitter"
+)
+
+// fakeSource delivers msgs in order, each ref its index.
+type fakeSource struct {
+	mu      sync.Mutex
+	msgs    [][]byte
+	next    int
+	fetches int
+	acked   []int
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, max int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	var ds []Delivery
+	for ; s.next < len(s.msgs) && len(ds) < max; s.next++ {
+		ds = append(ds, Delivery{Data: s.msgs[s.next], ref: s.next})
+	}
+	return ds, nil
+}
+
+func (s *fakeSource) Ack(ctx context.Context, ds []Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range ds {
+		s.acked = append(s.acked, d.ref.(int))
+	}
+	return nil
+}
+
+func (s *fakeSource) Close() error { return nil }
+
+func (s *fakeSource) state() (fetches int, acked []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches, slices.Sorted(slices.Values(s.acked))
+}
+
+// fakeProver takes every intent and proves every batch, failing the first
+// fail of them.
+type fakeProver struct {
+	mu      sync.Mutex
+	batches []*server.ProveRequest
+	fail    int
+	queue   int
+}
+
+func (p *fakeProver) Intent(ctx context.Context, in intake.Intent) (intake.Record, bool, error) {
+	if in.Pk == "" {
+		return intake.Record{}, false, fmt.Errorf("%w: no pk", errs.ErrInvalidInput)
+	}
+	return intake.Record{Intent: in, Status: intake.StatusReceived}, false, nil
+}
+
+func (p *fakeProver) Prove(ctx context.Context, req *server.ProveRequest) (submitter.Submission, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(p.batches, req)
+	if p.fail > 0 {
+		p.fail--
+		return submitter.Submission{}, fmt.Errorf("%w: prover restarting", errs.ErrUnavailable)
+	}
+	return submitter.Submission{}, nil
+}
+
+func (p *fakeProver) Status(ctx context.Context) (server.Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return server.Status{Backlog: server.Backlog{Queue: p.queue}}, nil
+}
+
+func (p *fakeProver) proven() []*server.ProveRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.batches)
+}
+
+func intentMsg(profile, pk string, nonce uint64) []byte {
+	b, _ := json.Marshal(intake.Intent{Profile: profile, Pk: pk, Recipient: "0x2a", ChainID: 1, Size: 10 * nonce, Nonce: nonce, Sig: "00"})
+	return b
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	profile := circuit.Profile{Name: "t", N: 2}
+	start := func(src *fakeSource, p *fakeProver, maxQueue int) (stop func() error) {
+		a := &Adapter{Source: src, Prover: p, Profile: profile, MaxQueue: maxQueue, Poll: 5 * time.Millisecond}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- a.Run(ctx) }()
+		return func() error {
+			cancel()
+			return <-done
+		}
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		src := &fakeSource{msgs: [][]byte{
+			intentMsg("t", "aa", 2),
+			[]byte("not json"),
+			intentMsg("t", "aa", 1),
+			intentMsg("other", "aa", 9), // another profile
+			intentMsg("t", "aa", 2),     // redelivered
+			intentMsg("t", "", 7),       // refused by intake
+			intentMsg("t", "aa", 4),
+			intentMsg("t", "bb", 3), // another signer, short of a batch
+			intentMsg("t", "aa", 3),
+			intentMsg("t", "aa", 5), // short of a batch
+		}}
+		p := &fakeProver{}
+		stop := start(src, p, 0)
+		waitFor(t, "two batches acked", func() bool {
+			_, acked := src.state()
+			return len(acked) == 8
+		})
+		if err := stop(); err != context.Canceled {
+			t.Fatalf("Run: %v", err)
+		}
+		if _, acked := src.state(); !slices.Equal(acked, []int{0, 1, 2, 3, 4, 5, 6, 8}) {
+			t.Errorf("acked %v, want every message but the held ones", acked)
+		}
+		got := p.proven()
+		if len(got) != 2 {
+			t.Fatalf("%d batches, want 2", len(got))
+		}
+		for i, want := range []struct {
+			kOld   uint64
+			nonces []uint64
+		}{{0, []uint64{1, 2}}, {2, []uint64{3, 4}}} {
+			var nonces []uint64
+			for _, row := range got[i].Rows {
+				nonces = append(nonces, row.Nonce)
+			}
+			if got[i].KOld != want.kOld || !slices.Equal(nonces, want.nonces) {
+				t.Errorf("batch %d: KOld %d, nonces %v, want %d, %v", i, got[i].KOld, nonces, want.kOld, want.nonces)
+			}
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		src := &fakeSource{msgs: [][]byte{intentMsg("t", "aa", 1), intentMsg("t", "aa", 2)}}
+		p := &fakeProver{fail: 1}
+		stop := start(src, p, 0)
+		waitFor(t, "the batch acked", func() bool {
+			_, acked := src.state()
+			return len(acked) == 2
+		})
+		stop()
+		if got := p.proven(); len(got) != 2 || got[1].Rows[0].Nonce != 1 || got[1].KOld != 0 {
+			t.Errorf("proved %d batches, want the failed one again", len(got))
+		}
+	})
+
+	t.Run("backpressure", func(t *testing.T) {
+		src := &fakeSource{msgs: [][]byte{intentMsg("t", "aa", 1), intentMsg("t", "aa", 2)}}
+		p := &fakeProver{queue: 3}
+		stop := start(src, p, 3)
+		time.Sleep(30 * time.Millisecond)
+		if fetches, _ := src.state(); fetches != 0 {
+			t.Errorf("fetched %d times with the queue at MaxQueue", fetches)
+		}
+		p.mu.Lock()
+		p.queue = 2
+		p.mu.Unlock()
+		waitFor(t, "the batch acked", func() bool {
+			_, acked := src.state()
+			return len(acked) == 2
+		})
+		stop()
+	})
+}
+
+func TestKafka(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		served  bool
+		commits []string
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/consumers/g":
+			json.NewEncoder(w).Encode(map[string]string{"instance_id": "i", "base_uri": srv.URL + "/consumers/g/instances/i"})
+		case strings.HasSuffix(r.URL.Path, "/subscription"):
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/records"):
+			if r.Header.Get("Accept") != kafkaJSON {
+				t.Errorf("records Accept %q", r.Header.Get("Accept"))
+			}
+			var recs []kafkaRecord
+			if !served {
+				served = true
+				for _, off := range []int64{10, 11, 13} {
+					recs = append(recs, kafkaRecord{Topic: "intents", Partition: 0, Offset: off, Value: json.RawMessage(fmt.Sprint(off))})
+				}
+			}
+			json.NewEncoder(w).Encode(recs)
+		case strings.HasSuffix(r.URL.Path, "/offsets"):
+			var body struct {
+				Offsets []struct {
+					Topic     string `json:"topic"`
+					Partition int    `json:"partition"`
+					Offset    int64  `json:"offset"`
+				} `json:"offsets"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, o := range body.Offsets {
+				commits = append(commits, fmt.Sprintf("%s/%d@%d", o.Topic, o.Partition, o.Offset))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	k := &Kafka{Proxy: srv.URL, Group: "g", Topics: []string{"intents"}, Wait: 10 * time.Millisecond}
+	defer k.Close()
+	first, err := k.Fetch(ctx, 2)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("Fetch: %d messages, %v", len(first), err)
+	}
+	rest, err := k.Fetch(ctx, 2)
+	if err != nil || len(rest) != 1 || string(rest[0].Data) != "13" {
+		t.Fatalf("Fetch: %d messages, %v, want the buffered one", len(rest), err)
+	}
+	committed := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(commits)
+	}
+	// out of order: nothing commits until the oldest is acked
+	if err := k.Ack(ctx, first[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if c := committed(); len(c) != 0 {
+		t.Fatalf("committed %v past an unacked message", c)
+	}
+	if err := k.Ack(ctx, first[:1]); err != nil {
+		t.Fatal(err)
+	}
+	// offsets skip, as on a compacted topic
+	if err := k.Ack(ctx, rest); err != nil {
+		t.Fatal(err)
+	}
+	if c := committed(); !slices.Equal(c, []string{"intents/0@11", "intents/0@13"}) {
+		t.Errorf("committed %v", c)
+	}
+}
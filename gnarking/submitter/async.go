@@ -0,0 +1,517 @@
+package submitter
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/retry"
+)
+
+// Defaults of the Async fields left zero.
+const (
+	DefaultConfirmations = 3
+	DefaultStallAfter    = 3 * time.Minute
+	DefaultBumpPercent   = 15 // geth replaces at +10%
+	DefaultMaxAttempts   = 3
+)
+
+// Chain is what Async needs of an Ethereum node; *chainsync.RPC is one.
+type Chain interface {
+	Nonce(ctx context.Context, addr, block string) (uint64, error)
+	SuggestFees(ctx context.Context) (maxFee, tip *big.Int, err error)
+	Send(ctx context.Context, tx chainsync.Tx) (string, error)
+	Receipt(ctx context.Context, hash string) (*chainsync.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+var _ Chain = (*chainsync.RPC)(nil)
+
+// PendingTx is a submission in flight: posted at Nonce, maybe several times
+// with rising fees, and not yet Confirmations deep.
+type PendingTx struct {
+	BatchID  string                          `json:"batch_id"` // hex
+	Calldata string                          `json:"calldata"` // hex
+	Public   circuit.SettlementCircuitPublic `json:"public"`
+	ProvenAt time.Time                       `json:"proven_at,omitzero"` // zero for legacy proofs
+	MaxAge   time.Duration                   `json:"max_age,omitempty"`
+
+	Nonce    uint64    `json:"nonce"`
+	MaxFee   *big.Int  `json:"max_fee"` // wei, of the latest broadcast
+	Tip      *big.Int  `json:"tip"`
+	Hashes   []string  `json:"hashes"` // every broadcast at Nonce, any may be mined; none yet after a failed send
+	SentAt   time.Time `json:"sent_at,omitzero"`
+	Attempts int       `json:"attempts"`        // nonces tried, the current one included
+	Mined    string    `json:"mined,omitempty"` // hash of the broadcast mined, until final
+	Block    uint64    `json:"block,omitempty"`
+	GasUsed  uint64    `json:"gas_used,omitempty"` // by its transactions mined so far, reverted ones included
+	Fee      *big.Int  `json:"fee,omitempty"`      // wei, the same transactions' gas times effective price
+}
+
+// submission is enough of p for Check and Requeue; it has no proof.
+func (p *PendingTx) submission() Submission {
+	s := Submission{Public: p.Public}
+	if !p.ProvenAt.IsZero() {
+		s.Header = &artifacts.ProofHeader{Timestamp: p.ProvenAt, MaxAge: p.MaxAge}
+	}
+	return s
+}
+
+// State is what Async persists: the next account nonce it hands out, the
+// submissions in flight and the last MaxDone that became final.
+type State struct {
+	NextNonce uint64      `json:"next_nonce"`
+	Pending   []PendingTx `json:"pending"`
+	Done      []Done      `json:"done,omitempty"` // oldest first
+}
+
+// MaxDone bounds State.Done; the oldest go first.
+const MaxDone = 1000
+
+// Done is a Result as State keeps it, for reports (ddm report).
+type Done struct {
+	BatchID string    `json:"batch_id"`
+	Time    time.Time `json:"time"` // when it became final
+	Total   string    `json:"total_settle"`
+	TxHash  string    `json:"tx_hash,omitempty"`
+	Block   uint64    `json:"block,omitempty"`
+	GasUsed uint64    `json:"gas_used,omitempty"`
+	Fee     *big.Int  `json:"fee,omitempty"`   // wei
+	Error   string    `json:"error,omitempty"` // empty once settled
+	Code    errs.Code `json:"code,omitempty"`
+}
+
+// Store persists State across restarts, so nonces are not reused and
+// in-flight transactions are still tracked.
+type Store interface {
+	Load() (State, error)
+	Save(State) error
+}
+
+// FileStore keeps State as JSON in the named file, replaced atomically; a
+// missing file is the empty State.
+type FileStore string
+
+func (f FileStore) Load() (State, error) {
+	var st State
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("%w: submitter state %s: %w", errs.ErrInvalidInput, f, err)
+	}
+	return st, nil
+}
+
+func (f FileStore) Save(st State) error {
+	return artifacts.WriteFile(string(f), artifacts.WriterFunc(func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		return e.Encode(&st)
+	}), false)
+}
+
+// Result is the final outcome of an enqueued submission.
+type Result struct {
+	BatchID string
+	TxHash  string // the broadcast that was mined
+	Block   uint64
+	GasUsed uint64   // by every transaction of the submission mined, reverted ones included
+	Fee     *big.Int // wei, their gas times effective price; nil when the node reports no price
+	Err     error    // nil once settled Confirmations deep
+}
+
+// Async posts submissions without waiting on them. It hands out account
+// nonces from its own State rather than the node's, prices transactions with
+// EIP-1559 fees, replaces one stalled in the mempool with bumped fees at the
+// same nonce, counts confirmations (a reorged-out transaction goes back to
+// pending), and reposts the same proof at a new nonce when its nonce is
+// taken by another, after re-checking it is still fresh. A revert is final.
+type Async struct {
+	Submitter // freshness checks, Requeue and Now; Poster is unused
+
+	Chain    Chain
+	Store    Store
+	From     string // 0x-prefixed sender address, held by the node
+	Verifier string // 0x-prefixed verifier contract address
+
+	Confirmations uint64        // blocks from the mined one to the head, that one included
+	StallAfter    time.Duration // unmined this long, a transaction is replaced
+	BumpPercent   int64         // fee increase of a replacement
+	MaxFeeCap     *big.Int      // highest fee cap bid, wei; nil for none
+	MaxAttempts   int           // nonces tried per submission
+
+	mu sync.Mutex
+}
+
+// Enqueue checks s and posts it, returning once the transaction is in the
+// node's mempool; Poll follows it from there. Enqueueing a batch already in
+// flight returns its transaction.
+func (a *Async) Enqueue(ctx context.Context, s Submission) (PendingTx, error) {
+	if err := a.checkOrRequeue(ctx, s); err != nil {
+		return PendingTx{}, err
+	}
+	calldata, err := Calldata(s)
+	if err != nil {
+		return PendingTx{}, err
+	}
+	id, err := circuit.BatchID(s.Public)
+	if err != nil {
+		return PendingTx{}, fmt.Errorf("%w: batch ID: %w", errs.ErrInvalidInput, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, err := a.Store.Load()
+	if err != nil {
+		return PendingTx{}, err
+	}
+	for _, p := range st.Pending {
+		if p.BatchID == hex.EncodeToString(id[:]) {
+			return p, nil
+		}
+	}
+	p := PendingTx{BatchID: hex.EncodeToString(id[:]), Calldata: hex.EncodeToString(calldata), Public: s.Public}
+	if s.Header != nil {
+		p.ProvenAt, p.MaxAge = s.Header.Timestamp, s.Header.MaxAge
+	}
+	if err := a.assignNonce(ctx, &st, &p); err != nil {
+		return PendingTx{}, err
+	}
+	if err := a.broadcast(ctx, &p); err != nil {
+		// st is not saved: the nonce is handed out again
+		return PendingTx{}, err
+	}
+	st.Pending = append(st.Pending, p)
+	return p, a.Store.Save(st)
+}
+
+// Poll advances every submission in flight once and returns those that
+// became final: settled, or given up on.
+func (a *Async) Poll(ctx context.Context) ([]Result, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, err := a.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	head, err := a.chain().BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mined, err := a.chain().Nonce(ctx, a.From, "latest")
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	pending := st.Pending[:0]
+	for _, p := range st.Pending {
+		if r, final := a.advance(ctx, &st, &p, head, mined); final {
+			results = append(results, r)
+			st.Done = append(st.Done, a.done(p, r))
+			continue
+		}
+		pending = append(pending, p)
+	}
+	st.Pending = pending
+	if len(st.Done) > MaxDone {
+		st.Done = slices.Delete(st.Done, 0, len(st.Done)-MaxDone)
+	}
+	return results, a.Store.Save(st)
+}
+
+// Run polls every interval until ctx ends, handing each final Result to
+// done. Unreachable nodes are retried; other errors stop it.
+func (a *Async) Run(ctx context.Context, interval time.Duration, done func(Result)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		results, err := a.Poll(ctx)
+		if err != nil && !errors.Is(err, errs.ErrUnavailable) {
+			return err
+		}
+		for _, r := range results {
+			done(r)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// advance moves p one step; mined is the account's mined transaction count.
+func (a *Async) advance(ctx context.Context, st *State, p *PendingTx, head, mined uint64) (Result, bool) {
+	r := Result{BatchID: p.BatchID}
+	if len(p.Hashes) == 0 {
+		// the last send failed: try again at the same nonce
+		a.broadcast(ctx, p)
+		return r, false
+	}
+
+	p.Mined, p.Block = "", 0
+	for _, h := range p.Hashes {
+		rc, err := a.chain().Receipt(ctx, h)
+		if err != nil {
+			return r, false
+		}
+		if rc != nil {
+			p.Mined, p.Block = h, rc.Block
+			if head+1 < rc.Block+a.confirmations() {
+				return r, false
+			}
+			if rc.Success {
+				p.charge(rc)
+				r.TxHash, r.Block, r.GasUsed, r.Fee = h, rc.Block, p.GasUsed, p.Fee
+				return r, true
+			}
+			return a.reverted(ctx, p, rc, h)
+		}
+	}
+
+	switch {
+	case mined > p.Nonce:
+		// our nonce is spent but none of our broadcasts mined
+		return a.retry(ctx, st, p, fmt.Errorf("%w: nonce %d taken by another transaction", errs.ErrUnavailable, p.Nonce))
+	case a.now().Sub(p.SentAt) >= a.stallAfter():
+		a.bump(ctx, p)
+	}
+	return r, false
+}
+
+// charge adds what the mined transaction of rc cost to p.
+func (p *PendingTx) charge(rc *chainsync.Receipt) {
+	p.GasUsed += rc.GasUsed
+	if rc.GasPrice != nil {
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(rc.GasUsed), rc.GasPrice)
+		if p.Fee != nil {
+			fee.Add(fee, p.Fee)
+		}
+		p.Fee = fee
+	}
+}
+
+// done is the record of p's final Result r.
+func (a *Async) done(p PendingTx, r Result) Done {
+	d := Done{BatchID: r.BatchID, Time: a.now(), TxHash: r.TxHash, Block: r.Block, GasUsed: r.GasUsed, Fee: r.Fee}
+	if total, err := bigOf(p.Public.TotalSettle); err == nil {
+		d.Total = total.String()
+	}
+	if r.Err != nil {
+		d.Error, d.Code = r.Err.Error(), errs.CodeOf(r.Err)
+	}
+	return d
+}
+
+// reverted settles p once its transaction h reverted, as rc reports. The
+// verifier refused the proof and would refuse it again, so p is final: failed
+// with the revert, or with the staleness that explains it, when it is
+// requeued. Only an unreachable chain leaves it pending, for the next poll
+// to check again.
+func (a *Async) reverted(ctx context.Context, p *PendingTx, rc *chainsync.Receipt, h string) (Result, bool) {
+	err := a.checkOrRequeue(ctx, p.submission())
+	if errors.Is(err, errs.ErrUnavailable) {
+		return Result{BatchID: p.BatchID}, false
+	}
+	if err == nil {
+		err = fmt.Errorf("%w: transaction %s reverted", errs.ErrVerificationFailed, h)
+	}
+	p.charge(rc)
+	return Result{BatchID: p.BatchID, TxHash: h, Block: rc.Block, GasUsed: p.GasUsed, Fee: p.Fee, Err: err}, true
+}
+
+// retry reposts p's proof at a new nonce, or gives up on it once it is stale
+// or out of attempts.
+func (a *Async) retry(ctx context.Context, st *State, p *PendingTx, reason error) (Result, bool) {
+	r := Result{BatchID: p.BatchID, TxHash: p.Mined, Block: p.Block, GasUsed: p.GasUsed, Fee: p.Fee, Err: reason}
+	if p.Attempts >= a.maxAttempts() {
+		r.Err = fmt.Errorf("gave up after %d attempts: %w", p.Attempts, reason)
+		return r, true
+	}
+	if err := a.checkOrRequeue(ctx, p.submission()); err != nil {
+		r.Err = err
+		return r, true
+	}
+	if err := a.assignNonce(ctx, st, p); err != nil {
+		// keep the old nonce's hashes; the next poll sees the same failure
+		return r, false
+	}
+	p.Attempts++
+	p.Hashes, p.Mined, p.Block = nil, "", 0
+	a.broadcast(ctx, p)
+	return r, false
+}
+
+// assignNonce gives p the next nonce neither State nor the node has used.
+func (a *Async) assignNonce(ctx context.Context, st *State, p *PendingTx) error {
+	nonce, err := a.chain().Nonce(ctx, a.From, "pending")
+	if err != nil {
+		return err
+	}
+	p.Nonce = max(nonce, st.NextNonce)
+	st.NextNonce = p.Nonce + 1
+	if p.Attempts == 0 {
+		p.Attempts = 1
+	}
+	return nil
+}
+
+// broadcast sends p at its nonce with freshly suggested fees.
+func (a *Async) broadcast(ctx context.Context, p *PendingTx) error {
+	maxFee, tip, err := a.chain().SuggestFees(ctx)
+	if err != nil {
+		return err
+	}
+	p.MaxFee, p.Tip = a.capped(maxFee), a.capped(tip)
+	return a.send(ctx, p)
+}
+
+// bump replaces p's transaction with fees raised by BumpPercent, or to the
+// node's current suggestion if that is higher. At MaxFeeCap it waits.
+func (a *Async) bump(ctx context.Context, p *PendingTx) {
+	maxFee, tip := a.raise(p.MaxFee), a.raise(p.Tip)
+	if suggested, suggestedTip, err := a.chain().SuggestFees(ctx); err == nil {
+		maxFee, tip = bigMax(maxFee, suggested), bigMax(tip, suggestedTip)
+	}
+	maxFee, tip = a.capped(maxFee), a.capped(tip)
+	if maxFee.Cmp(p.MaxFee) <= 0 {
+		return
+	}
+	old := *p
+	p.MaxFee, p.Tip = maxFee, tip
+	if a.send(ctx, p) != nil {
+		p.MaxFee, p.Tip, p.SentAt = old.MaxFee, old.Tip, old.SentAt
+	}
+}
+
+func (a *Async) send(ctx context.Context, p *PendingTx) error {
+	data, err := hex.DecodeString(p.Calldata)
+	if err != nil {
+		return fmt.Errorf("%w: calldata: %w", errs.ErrInvalidInput, err)
+	}
+	if p.Tip.Cmp(p.MaxFee) > 0 {
+		p.Tip = p.MaxFee
+	}
+	hash, err := a.chain().Send(ctx, chainsync.Tx{From: a.From, To: a.Verifier, Data: data, Nonce: p.Nonce, MaxFeePerGas: p.MaxFee, MaxPriorityFeePerGas: p.Tip})
+	if err != nil {
+		return err
+	}
+	p.Hashes = append(p.Hashes, hash)
+	p.SentAt = a.now()
+	return nil
+}
+
+// raise is x increased by BumpPercent, at least by 1 wei.
+func (a *Async) raise(x *big.Int) *big.Int {
+	y := new(big.Int).Mul(x, big.NewInt(100+a.bumpPercent()))
+	y.Quo(y, big.NewInt(100))
+	return y.Add(y, big.NewInt(1))
+}
+
+func (a *Async) capped(x *big.Int) *big.Int {
+	if a.MaxFeeCap != nil && x.Cmp(a.MaxFeeCap) > 0 {
+		return new(big.Int).Set(a.MaxFeeCap)
+	}
+	return x
+}
+
+func bigMax(x, y *big.Int) *big.Int {
+	if x.Cmp(y) >= 0 {
+		return x
+	}
+	return y
+}
+
+func (a *Async) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+func (a *Async) confirmations() uint64 {
+	if a.Confirmations == 0 {
+		return DefaultConfirmations
+	}
+	return a.Confirmations
+}
+
+func (a *Async) stallAfter() time.Duration {
+	if a.StallAfter == 0 {
+		return DefaultStallAfter
+	}
+	return a.StallAfter
+}
+
+func (a *Async) bumpPercent() int64 {
+	if a.BumpPercent == 0 {
+		return DefaultBumpPercent
+	}
+	return a.BumpPercent
+}
+
+func (a *Async) maxAttempts() int {
+	if a.MaxAttempts == 0 {
+		return DefaultMaxAttempts
+	}
+	return a.MaxAttempts
+}
+
+// chain is Chain under Retry.
+func (a *Async) chain() Chain {
+	return retryChain{a.Chain, a.Retry}
+}
+
+// retryChain retries every call; Send too, since a Tx pins its nonce.
+type retryChain struct {
+	Chain
+	p retry.Policy
+}
+
+func (c retryChain) Nonce(ctx context.Context, addr, block string) (uint64, error) {
+	return retry.Get(ctx, c.p, func(ctx context.Context) (uint64, error) {
+		return c.Chain.Nonce(ctx, addr, block)
+	})
+}
+
+func (c retryChain) SuggestFees(ctx context.Context) (maxFee, tip *big.Int, err error) {
+	err = c.p.Do(ctx, func(ctx context.Context) (err error) {
+		maxFee, tip, err = c.Chain.SuggestFees(ctx)
+		return err
+	})
+	return maxFee, tip, err
+}
+
+func (c retryChain) Send(ctx context.Context, tx chainsync.Tx) (string, error) {
+	return retry.Get(ctx, c.p, func(ctx context.Context) (string, error) {
+		return c.Chain.Send(ctx, tx)
+	})
+}
+
+func (c retryChain) Receipt(ctx context.Context, hash string) (*chainsync.Receipt, error) {
+	return retry.Get(ctx, c.p, func(ctx context.Context) (*chainsync.Receipt, error) {
+		return c.Chain.Receipt(ctx, hash)
+	})
+}
+
+func (c retryChain) BlockNumber(ctx context.Context) (uint64, error) {
+	return retry.Get(ctx, c.p, c.Chain.BlockNumber)
+}
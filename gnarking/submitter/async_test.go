@@ -0,0 +1,205 @@
+package submitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// fakeChain is a one-account chain: a mempool holding the latest broadcast
+// per nonce and blocks mined by hand, one transaction each.
+type fakeChain struct {
+	head     uint64
+	mined    uint64 // account nonce
+	mempool  map[uint64]chainsync.Tx
+	receipts map[string]*chainsync.Receipt
+	sends    []chainsync.Tx
+	baseFee  *big.Int
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{head: 100, mined: 5, mempool: map[uint64]chainsync.Tx{}, receipts: map[string]*chainsync.Receipt{}, baseFee: big.NewInt(100)}
+}
+
+func (c *fakeChain) Nonce(_ context.Context, _, block string) (uint64, error) {
+	n := c.mined
+	if block == "pending" {
+		for nonce := range c.mempool {
+			n = max(n, nonce+1)
+		}
+	}
+	return n, nil
+}
+
+func (c *fakeChain) SuggestFees(context.Context) (*big.Int, *big.Int, error) {
+	return new(big.Int).Add(new(big.Int).Lsh(c.baseFee, 1), big.NewInt(2)), big.NewInt(2), nil
+}
+
+func (c *fakeChain) Send(_ context.Context, tx chainsync.Tx) (string, error) {
+	if tx.Nonce < c.mined {
+		return "", fmt.Errorf("nonce too low")
+	}
+	if old, ok := c.mempool[tx.Nonce]; ok {
+		min := new(big.Int).Mul(old.MaxFeePerGas, big.NewInt(110))
+		if new(big.Int).Mul(tx.MaxFeePerGas, big.NewInt(100)).Cmp(min) < 0 {
+			return "", fmt.Errorf("replacement transaction underpriced")
+		}
+	}
+	c.mempool[tx.Nonce] = tx
+	c.sends = append(c.sends, tx)
+	return hash(tx.Nonce, len(c.sends)), nil
+}
+
+func hash(nonce uint64, send int) string { return fmt.Sprintf("0x%d-%d", nonce, send) }
+
+func (c *fakeChain) Receipt(_ context.Context, h string) (*chainsync.Receipt, error) {
+	return c.receipts[h], nil
+}
+
+func (c *fakeChain) BlockNumber(context.Context) (uint64, error) { return c.head, nil }
+
+// mine puts the broadcast h of the next nonce in a new block.
+func (c *fakeChain) mine(h string, success bool) {
+	c.head++
+	c.receipts[h] = &chainsync.Receipt{Block: c.head, Success: success, GasUsed: 50000, GasPrice: big.NewInt(150)}
+	delete(c.mempool, c.mined)
+	c.mined++
+}
+
+func TestAsync(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	src := &flaky{chain: chain{big.NewInt(8)}}
+	c := newFakeChain()
+	store := FileStore(filepath.Join(t.TempDir(), "submitter.json"))
+	var requeued []error
+	newAsync := func() *Async {
+		return &Async{
+			Submitter: Submitter{
+				Source:  src,
+				Requeue: func(_ Submission, reason error) { requeued = append(requeued, reason) },
+				Now:     func() time.Time { return now },
+			},
+			Chain: c, Store: store, From: "0x01", Verifier: "0x02",
+		}
+	}
+	a := newAsync()
+	batch := func(total int64) Submission {
+		var pub circuit.SettlementCircuitPublic
+		pub.Recipient, pub.KOld, pub.M, pub.TotalSettle, pub.ChainID = big.NewInt(42), big.NewInt(8), big.NewInt(16), big.NewInt(total), big.NewInt(1)
+		pub.Pk.A.X, pub.Pk.A.Y, pub.BatchDataRoot = big.NewInt(0), big.NewInt(1), big.NewInt(3)
+		return Submission{
+			Header: &artifacts.ProofHeader{Version: artifacts.ProofHeaderVersion, Timestamp: now, MaxAge: time.Hour},
+			Proof:  &groth16_bn254.Proof{},
+			Public: pub,
+		}
+	}
+	poll := func(want int) []Result {
+		t.Helper()
+		results, err := a.Poll(ctx)
+		if err != nil || len(results) != want {
+			t.Fatalf("poll: %d results %+v, err %v; want %d", len(results), results, err, want)
+		}
+		return results
+	}
+
+	// nonces come from the node once, then from State
+	p1, err := a.Enqueue(ctx, batch(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := a.Enqueue(ctx, batch(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := a.Enqueue(ctx, batch(8)); err != nil || again.Nonce != p1.Nonce {
+		t.Fatalf("re-enqueued batch: nonce %d, err %v", again.Nonce, err)
+	}
+	if p1.Nonce != 5 || p2.Nonce != 6 || len(c.sends) != 2 {
+		t.Fatalf("nonces %d, %d; %d sends", p1.Nonce, p2.Nonce, len(c.sends))
+	}
+	if fee := c.sends[0].MaxFeePerGas.Int64(); fee != 202 {
+		t.Fatalf("max fee %d, want 2 * base fee + tip", fee)
+	}
+
+	// stalled: both replaced at their nonce with bumped fees
+	poll(0)
+	now = now.Add(DefaultStallAfter)
+	poll(0)
+	if len(c.sends) != 4 || c.sends[2].Nonce != 5 || c.sends[3].Nonce != 6 {
+		t.Fatalf("replacements %+v", c.sends[2:])
+	}
+	if fee := c.sends[2].MaxFeePerGas.Int64(); fee != 202*115/100+1 {
+		t.Fatalf("bumped max fee %d", fee)
+	}
+
+	// the replacement is mined; final once DefaultConfirmations deep
+	c.mine(hash(5, 3), true)
+	poll(0)
+	c.head += DefaultConfirmations - 1
+	if r := poll(1)[0]; r.Err != nil || r.TxHash != hash(5, 3) || r.BatchID != p1.BatchID {
+		t.Fatalf("settled %+v", r)
+	}
+
+	// a revert is final, not reposted: the verifier would refuse the proof
+	// again. While the chain cannot be read the verdict waits for the next
+	// poll, and state survives a restart
+	src.fails = 1
+	c.mine(hash(6, 4), false)
+	c.head += DefaultConfirmations
+	sends := len(c.sends)
+	poll(0)
+	a = newAsync()
+	if r := poll(1)[0]; !errors.Is(r.Err, errs.ErrVerificationFailed) || r.BatchID != p2.BatchID || r.TxHash != hash(6, 4) || r.GasUsed != 50000 || len(c.sends) != sends || len(requeued) != 0 {
+		t.Fatalf("reverted %+v, %d sends", r, len(c.sends)-sends)
+	}
+	st, _ := store.Load()
+	if len(st.Pending) != 0 || st.NextNonce != 7 {
+		t.Fatalf("state %+v", st)
+	}
+	if len(st.Done) != 2 || st.Done[0].Total != "8" || st.Done[0].GasUsed != 50000 || st.Done[1].Total != "9" || st.Done[1].TxHash != hash(6, 4) || st.Done[1].Code != errs.CodeVerificationFailed {
+		t.Fatalf("done %+v", st.Done)
+	}
+
+	// at the fee cap a stalled transaction waits rather than overbids
+	a.MaxFeeCap = big.NewInt(202)
+	if _, err := a.Enqueue(ctx, batch(10)); err != nil {
+		t.Fatal(err)
+	}
+	sent := len(c.sends)
+	now = now.Add(DefaultStallAfter)
+	poll(0)
+	if len(c.sends) != sent {
+		t.Fatalf("bid past the cap: %+v", c.sends[sent:])
+	}
+
+	// reverted once the chain moved past the batch's KOld: requeued, not retried
+	src.kOld = big.NewInt(16)
+	c.mine(hash(7, sent), false)
+	c.head += DefaultConfirmations
+	if r := poll(1)[0]; !errors.Is(r.Err, errs.ErrStaleNonce) || len(requeued) != 1 || len(c.sends) != sent {
+		t.Fatalf("stale revert %+v, requeued %d", r, len(requeued))
+	}
+
+	// a nonce taken by a transaction we did not send is retried
+	src.kOld = big.NewInt(8)
+	if _, err := a.Enqueue(ctx, batch(11)); err != nil {
+		t.Fatal(err)
+	}
+	c.mine("0xforeign", true)
+	poll(0)
+	if last := c.sends[len(c.sends)-1]; last.Nonce != 9 {
+		t.Fatalf("after a foreign tx took nonce 8: sent at %d", last.Nonce)
+	}
+}
@@ -0,0 +1,150 @@
+// Package submitter posts settlement proofs on-chain, refusing stale ones: a
+// proof past its max age, or built against a KOld the chain has since moved
+// past, would at best revert and at worst settle outdated state. Stale
+// batches go back to a requeue hook to be proven again against fresh KOld.
+package submitter
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/chainsync"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/retry"
+)
+
+// Poster sends verifier calldata on-chain and returns the transaction hash.
+type Poster interface {
+	Post(ctx context.Context, calldata artifacts.Calldata) (string, error)
+}
+
+// RPCPoster posts with eth_sendTransaction from a node-held account.
+type RPCPoster struct {
+	RPC      *chainsync.RPC
+	From     string // 0x-prefixed sender address
+	Verifier string // 0x-prefixed verifier contract address
+}
+
+func (p *RPCPoster) Post(ctx context.Context, calldata artifacts.Calldata) (string, error) {
+	return p.RPC.SendTransaction(ctx, p.From, p.Verifier, calldata)
+}
+
+// Submission is one proven batch.
+type Submission struct {
+	Header *artifacts.ProofHeader // nil for legacy proofs: only MaxAge-less checks apply
+	Proof  *groth16_bn254.Proof
+	Public circuit.SettlementCircuitPublic
+}
+
+// Submitter checks freshness, then posts.
+type Submitter struct {
+	Poster Poster
+	// Source, when set, re-reads the recipient's on-chain KOld right before
+	// posting.
+	Source chainsync.Source
+	// MaxAge applies to proofs whose header carries none; zero means no
+	// limit for them.
+	MaxAge time.Duration
+	// Requeue, when set, gets every batch refused as stale (expired or stale
+	// nonce) so it can be proven again against the current KOld.
+	Requeue func(s Submission, reason error)
+	Now     func() time.Time // time.Now when nil
+	// Retry is applied to reads of Source and, in Async, to every Chain
+	// call; never to Poster, whose transaction a retry could send twice.
+	Retry retry.Policy
+}
+
+// Check returns an error wrapping errs.ErrProofExpired or errs.ErrStaleNonce
+// when s must not be posted.
+func (sub *Submitter) Check(ctx context.Context, s Submission) error {
+	now := time.Now
+	if sub.Now != nil {
+		now = sub.Now
+	}
+	if s.Header != nil {
+		expires, ok := s.Header.Expires()
+		if !ok && sub.MaxAge > 0 {
+			expires, ok = s.Header.Timestamp.Add(sub.MaxAge), true
+		}
+		if t := now(); ok && t.After(expires) {
+			return fmt.Errorf("%w: proven at %s, expired %s ago", errs.ErrProofExpired,
+				s.Header.Timestamp.UTC().Format(time.RFC3339), t.Sub(expires).Truncate(time.Second))
+		}
+	} else if sub.MaxAge > 0 {
+		return fmt.Errorf("%w: legacy proof has no timestamp, max age %s", errs.ErrProofExpired, sub.MaxAge)
+	}
+
+	if sub.Source != nil {
+		recipient, err := bigOf(s.Public.Recipient)
+		if err != nil {
+			return err
+		}
+		kOld, err := bigOf(s.Public.KOld)
+		if err != nil {
+			return err
+		}
+		err = sub.Retry.Do(ctx, func(ctx context.Context) error {
+			return chainsync.CheckFresh(ctx, sub.Source, recipient, kOld)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Submit checks s and posts it, returning the transaction hash. Stale
+// submissions are handed to Requeue and not posted.
+func (sub *Submitter) Submit(ctx context.Context, s Submission) (string, error) {
+	if err := sub.checkOrRequeue(ctx, s); err != nil {
+		return "", err
+	}
+	calldata, err := Calldata(s)
+	if err != nil {
+		return "", err
+	}
+	return sub.Poster.Post(ctx, calldata)
+}
+
+// checkOrRequeue is Check, handing s to Requeue when it is stale.
+func (sub *Submitter) checkOrRequeue(ctx context.Context, s Submission) error {
+	err := sub.Check(ctx, s)
+	if err != nil && sub.Requeue != nil && (errs.CodeOf(err) == errs.CodeProofExpired || errs.CodeOf(err) == errs.CodeStaleNonce) {
+		sub.Requeue(s, err)
+	}
+	return err
+}
+
+// Calldata is the verifier call posting s.
+func Calldata(s Submission) (artifacts.Calldata, error) {
+	proof, err := artifacts.NewProofWrap(s.Proof)
+	if err != nil {
+		return nil, err
+	}
+	w, err := circuit.PublicWitness(s.Public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(w)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.NewCalldata(proof, inputs)
+}
+
+func bigOf(v any) (*big.Int, error) {
+	switch x := v.(type) {
+	case *big.Int:
+		return x, nil
+	case big.Int:
+		return &x, nil
+	default:
+		return nil, fmt.Errorf("%w: public input of type %T", errs.ErrInvalidInput, v)
+	}
+}
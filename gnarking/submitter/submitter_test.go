@@ -0,0 +1,115 @@
+package submitter
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/retry"
+)
+
+type chain struct{ kOld *big.Int }
+
+func (c chain) KOld(context.Context, *big.Int) (*big.Int, error) { return c.kOld, nil }
+
+// flaky is a Source unreachable for its first fails reads.
+type flaky struct {
+	chain
+	fails int
+}
+
+func (f *flaky) KOld(ctx context.Context, r *big.Int) (*big.Int, error) {
+	if f.fails > 0 {
+		f.fails--
+		return nil, errs.ErrUnavailable
+	}
+	return f.chain.KOld(ctx, r)
+}
+
+type poster struct{ posted []artifacts.Calldata }
+
+func (p *poster) Post(_ context.Context, calldata artifacts.Calldata) (string, error) {
+	p.posted = append(p.posted, calldata)
+	return "0x01", nil
+}
+
+func TestSubmit(t *testing.T) {
+	proven := time.Unix(1700000000, 0)
+	now := proven.Add(5 * time.Minute)
+
+	var pub circuit.SettlementCircuitPublic
+	pub.Recipient, pub.KOld, pub.M, pub.TotalSettle, pub.ChainID = big.NewInt(42), big.NewInt(8), big.NewInt(16), big.NewInt(8), big.NewInt(1)
+	pub.Pk.A.X, pub.Pk.A.Y, pub.BatchDataRoot = big.NewInt(0), big.NewInt(1), big.NewInt(3)
+	sub := func(maxAge time.Duration) Submission {
+		return Submission{
+			Header: &artifacts.ProofHeader{Version: artifacts.ProofHeaderVersion, Timestamp: proven, MaxAge: maxAge},
+			Proof:  &groth16_bn254.Proof{},
+			Public: pub,
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		s       Submission
+		maxAge  time.Duration
+		chainK  int64
+		wantErr error
+	}{
+		{"fresh", sub(10 * time.Minute), 0, 8, nil},
+		{"no max age", sub(0), 0, 8, nil},
+		{"expired", sub(time.Minute), 0, 8, errs.ErrProofExpired},
+		{"submitter max age", sub(0), time.Minute, 8, errs.ErrProofExpired},
+		{"header max age wins", sub(10 * time.Minute), time.Minute, 8, nil},
+		{"legacy with max age", Submission{Proof: &groth16_bn254.Proof{}, Public: pub}, time.Minute, 8, errs.ErrProofExpired},
+		{"chain moved", sub(10 * time.Minute), 0, 16, errs.ErrStaleNonce},
+	} {
+		p := &poster{}
+		var requeued []error
+		s := Submitter{
+			Poster:  p,
+			Source:  chain{big.NewInt(tc.chainK)},
+			MaxAge:  tc.maxAge,
+			Requeue: func(_ Submission, reason error) { requeued = append(requeued, reason) },
+			Now:     func() time.Time { return now },
+		}
+		_, err := s.Submit(context.Background(), tc.s)
+		if tc.wantErr == nil {
+			if err != nil || len(p.posted) != 1 || len(requeued) != 0 {
+				t.Fatalf("%s: err %v, posted %d, requeued %d", tc.name, err, len(p.posted), len(requeued))
+			}
+			// verifyProof(uint256[8],uint256[8])
+			if n := len(p.posted[0]); n != 4+16*32 {
+				t.Fatalf("%s: calldata %d bytes", tc.name, n)
+			}
+			continue
+		}
+		if !errors.Is(err, tc.wantErr) || len(p.posted) != 0 || len(requeued) != 1 {
+			t.Fatalf("%s: err %v, posted %d, requeued %d", tc.name, err, len(p.posted), len(requeued))
+		}
+	}
+}
+
+func TestSubmitRetry(t *testing.T) {
+	var pub circuit.SettlementCircuitPublic
+	pub.Recipient, pub.KOld, pub.M, pub.TotalSettle, pub.ChainID = big.NewInt(42), big.NewInt(8), big.NewInt(16), big.NewInt(8), big.NewInt(1)
+	pub.Pk.A.X, pub.Pk.A.Y, pub.BatchDataRoot = big.NewInt(0), big.NewInt(1), big.NewInt(3)
+	s := Submission{Proof: &groth16_bn254.Proof{}, Public: pub}
+
+	p := &poster{}
+	sub := Submitter{Poster: p, Source: &flaky{chain{big.NewInt(8)}, 2}}
+	if _, err := sub.Submit(context.Background(), s); !errors.Is(err, errs.ErrUnavailable) || len(p.posted) != 0 {
+		t.Fatalf("no retry: err %v, posted %d", err, len(p.posted))
+	}
+	sub.Source = &flaky{chain{big.NewInt(8)}, 2}
+	sub.Retry = retry.Policy{Attempts: 3, Initial: time.Millisecond}
+	if _, err := sub.Submit(context.Background(), s); err != nil || len(p.posted) != 1 {
+		t.Fatalf("retried: err %v, posted %d", err, len(p.posted))
+	}
+}
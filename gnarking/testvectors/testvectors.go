@@ -0,0 +1,406 @@
+// Package testvectors builds the frozen cross-language fixtures: keys, row
+// messages, signatures, hashes, whole batches with their public inputs, and
+// optionally proofs. Everything but the proofs is a pure function of the
+// seed, so Solidity/Rust/TS implementations can check themselves against
+// identical data; testdata/vectors.json pins the default set and Layouts
+// documents every byte layout in it.
+//
+// Groth16 setup and proving are randomized: proof vectors verify, but only
+// reproduce byte for byte in a ddm_deterministic build (prover.SetSeed).
+package testvectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	mrand "math/rand/v2"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bnMimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	bnEddsa "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	te "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/canon"
+	"gnarking/circuit"
+)
+
+// Version 2: public is the JSON SettlementCircuitPublic writes, with
+// k_old/m/total_settle/chain_id as decimal strings. canonical_json and
+// batch_id are unchanged from version 1: they are still over batch_id_json,
+// which keeps those four as integers.
+const Version = 2
+
+// DefaultSeed generates testdata/vectors.json.
+var DefaultSeed = [32]byte{'d', 'd', 'm', '-', 't', 'e', 's', 't', 'v', 'e', 'c', 't', 'o', 'r', 's'}
+
+// Layouts documents the encodings used in Vectors, by name.
+var Layouts = map[string]string{
+	"hex":                    "0x-prefixed lowercase hex, no leading zeros stripped unless stated",
+	"field_element":          "BN254 scalar field element, 32 bytes big-endian (0x + 64 hex digits)",
+	"key_seed":               "32 bytes read by gnark-crypto eddsa.GenerateKey: h = blake2b-512(seed), scalar = clamp(h[0:32]) little-endian, nonce source = h[32:64]",
+	"eddsa_public_key":       "32 bytes, compressed twisted Edwards point: A.Y little-endian, most significant bit of the last byte set iff A.X is lexicographically largest; x/y are the affine coordinates as field_element",
+	"eddsa_signature":        "64 bytes: R compressed as in eddsa_public_key || S 32 bytes big-endian; r_x/r_y/s are R.X, R.Y, S as field_element",
+	"mimc":                   "MiMC-BN254 (gnark-crypto fr/mimc, Miyaguchi-Preneel), each input absorbed as one field_element; output is a field_element",
+	"msg_v1":                 "mimc(\"msettle1\" as big-endian integer, Recipient, Size, Nonce, ChainID)",
+	"msg_v2":                 "mimc(\"msettle2\" as big-endian integer, Recipient, ChainID, Size, Nonce)",
+	"batch_data_root_mimc":   "mimc(Size[0], Nonce[0], ..., Size[N-1], Nonce[N-1])",
+	"batch_data_root_keccak": "keccak256(Size[0] || Nonce[0] || ...), every value 8 bytes big-endian, keeping the low 31 bytes (& type(uint248).max)",
+	"recipient_commitment":   "mimc(Recipient, Blinding)",
+	"public_json":            "SettlementCircuitPublic JSON: recipient/batch_data_root 0x-hex and pk_x/pk_y hex without 0x, leading zeros stripped; k_old/m/total_settle/chain_id decimal strings (0x-hex strings and JSON integers also parse)",
+	"batch_id_json":          "public_json with k_old/m/total_settle/chain_id as JSON integers, the form BatchID hashes whichever way a file spells them",
+	"canonical_json":         "batch_id_json re-encoded with sorted keys, no whitespace, integers in plain decimal, JCS string escaping (package canon)",
+	"batch_id":               "sha256(canonical_json), 32 bytes",
+	"public_inputs":          "Solidity verifier input order: Recipient, KOld, M, TotalSettle, ChainID, Pk.X, Pk.Y, BatchDataRoot, each a field_element",
+	"proof":                  "8 field_element words of MarshalSolidity: A.X, A.Y, B.X.A1, B.X.A0, B.Y.A1, B.Y.A0, C.X, C.Y",
+	"verifying_key":          "gnark groth16 bn254 VerifyingKey.WriteTo (compressed points)",
+	"calldata":               "ABI call verifyProof(uint256[8] proof, uint256[n] input): 4-byte selector || proof words || input words",
+}
+
+type Vectors struct {
+	Version    int               `json:"version"`
+	Seed       string            `json:"seed"`
+	Layouts    map[string]string `json:"layouts"`
+	Keys       []Key             `json:"keys"`
+	Messages   []Message         `json:"messages"`
+	Signatures []Signature       `json:"signatures"`
+	Hashes     []Hash            `json:"hashes"`
+	Batches    []Batch           `json:"batches"`
+	Proofs     []Proof           `json:"proofs,omitempty"`
+}
+
+var _ io.WriterTo = (*Vectors)(nil)
+
+// WriteTo writes the indented JSON fixture file.
+func (v *Vectors) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+type Key struct {
+	Seed   string `json:"seed"`   // key_seed
+	Public string `json:"public"` // eddsa_public_key
+	X      string `json:"x"`
+	Y      string `json:"y"`
+
+	priv *bnEddsa.PrivateKey
+}
+
+type Message struct {
+	Format    string `json:"format"` // msg_v1 or msg_v2
+	Recipient string `json:"recipient"`
+	ChainID   uint64 `json:"chain_id"`
+	Size      uint64 `json:"size"`
+	Nonce     uint64 `json:"nonce"`
+	Msg       string `json:"msg"`
+}
+
+type Signature struct {
+	Key     int    `json:"key"`     // index into Keys
+	Message int    `json:"message"` // index into Messages
+	Sig     string `json:"sig"`     // eddsa_signature
+	RX      string `json:"r_x"`
+	RY      string `json:"r_y"`
+	S       string `json:"s"`
+}
+
+type Hash struct {
+	Layout string   `json:"layout"`
+	Inputs []string `json:"inputs"`
+	Output string   `json:"output"`
+}
+
+type Row struct {
+	Size  uint64 `json:"size"`
+	Nonce uint64 `json:"nonce"`
+	Msg   string `json:"msg"`
+	Sig   string `json:"sig"`
+}
+
+type Batch struct {
+	Name          string          `json:"name"`
+	DataHash      string          `json:"data_hash"`
+	Ordering      string          `json:"ordering"`
+	Msg           string          `json:"msg"`
+	Key           int             `json:"key"`
+	Rows          []Row           `json:"rows"`
+	Public        json.RawMessage `json:"public"` // public_json
+	CanonicalJSON string          `json:"canonical_json"`
+	BatchID       string          `json:"batch_id"`
+	PublicInputs  []string        `json:"public_inputs"`
+
+	assignment *circuit.SettlementCircuit
+}
+
+type Proof struct {
+	Batch        string   `json:"batch"`
+	VerifyingKey string   `json:"verifying_key"`
+	Proof        []string `json:"proof"`
+	PublicInputs []string `json:"public_inputs"`
+	Calldata     string   `json:"calldata"`
+
+	proof *groth16_bn254.Proof
+}
+
+// Generate builds the vector set for seed; proofs adds a Groth16 setup and a
+// proof for the first batch.
+func Generate(seed [32]byte, proofs bool) (*Vectors, error) {
+	rng := mrand.NewChaCha8(seed)
+	v := &Vectors{Version: Version, Seed: hexOf(seed[:]), Layouts: Layouts}
+
+	for range 2 {
+		k, err := newKey(rng)
+		if err != nil {
+			return nil, err
+		}
+		v.Keys = append(v.Keys, k)
+	}
+
+	recipient := big.NewInt(0x2a)
+	chainID := uint64(42161)
+	for _, msg := range []circuit.MsgVersion{circuit.MsgV1, circuit.MsgV2} {
+		for _, row := range [][2]uint64{{1, 1}, {1_000_000, 7}, {1<<64 - 1, 1<<64 - 1}} {
+			m := circuit.MsgHash(msg, recipient, new(big.Int).SetUint64(row[0]), new(big.Int).SetUint64(row[1]), new(big.Int).SetUint64(chainID))
+			v.Messages = append(v.Messages, Message{
+				Format:    "msg_" + msg.String(),
+				Recipient: fieldHex(recipient),
+				ChainID:   chainID,
+				Size:      row[0],
+				Nonce:     row[1],
+				Msg:       hexOf(m),
+			})
+			sig, err := v.sign(1, m)
+			if err != nil {
+				return nil, err
+			}
+			sig.Message = len(v.Messages) - 1
+			v.Signatures = append(v.Signatures, sig)
+		}
+	}
+
+	mimc := func(in ...*big.Int) *big.Int {
+		h := bnMimc.NewMiMC()
+		for _, x := range in {
+			h.Write(fieldBytes(x))
+		}
+		return new(big.Int).SetBytes(h.Sum(nil))
+	}
+	one, two := big.NewInt(1), big.NewInt(2)
+	v.Hashes = append(v.Hashes,
+		hash("mimc", mimc(), nil),
+		hash("mimc", mimc(one), []*big.Int{one}),
+		hash("mimc", mimc(one, two), []*big.Int{one, two}),
+		hash("recipient_commitment", circuit.RecipientCommitment(recipient, big.NewInt(7)), []*big.Int{recipient, big.NewInt(7)}),
+	)
+	for _, dh := range []circuit.DataHash{circuit.DataHashMiMC, circuit.DataHashKeccak} {
+		sizes := []*big.Int{big.NewInt(5), big.NewInt(1 << 40)}
+		nonces := []*big.Int{big.NewInt(1), big.NewInt(2)}
+		root, err := circuit.BatchDataRoot(dh, sizes, nonces)
+		if err != nil {
+			return nil, err
+		}
+		v.Hashes = append(v.Hashes, hash("batch_data_root_"+dh.String(), root, []*big.Int{sizes[0], nonces[0], sizes[1], nonces[1]}))
+	}
+
+	for _, spec := range []struct {
+		name     string
+		dataHash circuit.DataHash
+		ordering circuit.Ordering
+		msg      circuit.MsgVersion
+	}{
+		{"default", circuit.DataHashMiMC, circuit.OrderingMonotonic, circuit.MsgV1},
+		{"keccak-unique-v2", circuit.DataHashKeccak, circuit.OrderingUnique, circuit.MsgV2},
+	} {
+		b, err := v.batch(rng, spec.name, spec.dataHash, spec.ordering, spec.msg)
+		if err != nil {
+			return nil, fmt.Errorf("batch %s: %w", spec.name, err)
+		}
+		v.Batches = append(v.Batches, b)
+	}
+
+	if proofs {
+		p, err := prove(v.Batches[0])
+		if err != nil {
+			return nil, fmt.Errorf("proof: %w", err)
+		}
+		v.Proofs = append(v.Proofs, p)
+	}
+	return v, nil
+}
+
+func newKey(rng *mrand.ChaCha8) (Key, error) {
+	var seed [32]byte
+	rng.Read(seed[:])
+	priv, err := bnEddsa.GenerateKey(bytes.NewReader(seed[:]))
+	if err != nil {
+		return Key{}, err
+	}
+	pub := priv.PublicKey.A
+	return Key{
+		Seed:   hexOf(seed[:]),
+		Public: hexOf(priv.PublicKey.Bytes()),
+		X:      fieldHex(pub.X.BigInt(new(big.Int))),
+		Y:      fieldHex(pub.Y.BigInt(new(big.Int))),
+		priv:   priv,
+	}, nil
+}
+
+func (v *Vectors) sign(key int, msg []byte) (Signature, error) {
+	b, err := circuit.EdDSA{}.Sign(v.Keys[key].priv, msg)
+	if err != nil {
+		return Signature{}, err
+	}
+	var sig bnEddsa.Signature
+	if _, err := sig.SetBytes(b); err != nil {
+		return Signature{}, err
+	}
+	return Signature{
+		Key: key,
+		Sig: hexOf(b),
+		RX:  fieldHex(sig.R.X.BigInt(new(big.Int))),
+		RY:  fieldHex(sig.R.Y.BigInt(new(big.Int))),
+		S:   fieldHex(new(big.Int).SetBytes(sig.S[:])),
+	}, nil
+}
+
+// batch builds an N-row batch of the default profile size signed by key 0.
+func (v *Vectors) batch(rng *mrand.ChaCha8, name string, dh circuit.DataHash, ord circuit.Ordering, msg circuit.MsgVersion) (Batch, error) {
+	n := circuit.N
+	recipient, chainID, kOld := big.NewInt(0x2a), big.NewInt(1), big.NewInt(0)
+	sizes := make([]*big.Int, n)
+	nonces := make([]*big.Int, n)
+	for i := range n {
+		sizes[i] = new(big.Int).SetUint64(rng.Uint64() % 1_000_000)
+		nonces[i] = big.NewInt(int64(i + 1))
+	}
+	if ord == circuit.OrderingUnique {
+		// row IDs in any order
+		mrand.New(rng).Shuffle(n, func(i, j int) { nonces[i], nonces[j] = nonces[j], nonces[i] })
+	}
+
+	w := circuit.NewSettlementCircuit(n)
+	w.DataHash, w.Ordering, w.Msg = dh, ord, msg
+	w.P.Recipient, w.P.ChainID, w.P.KOld = recipient, chainID, kOld
+	b := Batch{Name: name, DataHash: dh.String(), Ordering: ord.String(), Msg: msg.String(), assignment: w}
+
+	total, maxNonce := new(big.Int), new(big.Int)
+	for i := range n {
+		m := circuit.MsgHash(msg, recipient, sizes[i], nonces[i], chainID)
+		sig, err := v.sign(b.Key, m)
+		if err != nil {
+			return Batch{}, err
+		}
+		raw, _ := hex.DecodeString(sig.Sig[2:])
+		w.Size[i], w.Nonce[i] = sizes[i], nonces[i]
+		w.Sig[i].Assign(te.BN254, raw)
+		total.Add(total, sizes[i])
+		if nonces[i].Cmp(maxNonce) > 0 {
+			maxNonce = nonces[i]
+		}
+		b.Rows = append(b.Rows, Row{Size: sizes[i].Uint64(), Nonce: nonces[i].Uint64(), Msg: hexOf(m), Sig: sig.Sig})
+	}
+	root, err := circuit.BatchDataRoot(dh, sizes, nonces)
+	if err != nil {
+		return Batch{}, err
+	}
+	w.P.TotalSettle, w.P.M, w.P.BatchDataRoot = total, maxNonce, root
+	w.P.Pk.Assign(te.BN254, v.Keys[b.Key].priv.PublicKey.Bytes())
+
+	if b.Public, err = json.Marshal(w.P); err != nil {
+		return Batch{}, err
+	}
+	js, err := circuit.BatchIDJSON(w.P)
+	if err != nil {
+		return Batch{}, err
+	}
+	c, err := canon.Canonicalize(js)
+	if err != nil {
+		return Batch{}, err
+	}
+	b.CanonicalJSON = string(c)
+	id, err := circuit.BatchID(w.P)
+	if err != nil {
+		return Batch{}, err
+	}
+	b.BatchID = hexOf(id[:])
+
+	pw, err := frontend.NewWitness(w, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return Batch{}, err
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(pw)
+	if err != nil {
+		return Batch{}, err
+	}
+	b.PublicInputs = inputs
+	return b, nil
+}
+
+func prove(b Batch) (Proof, error) {
+	c := circuit.NewSettlementCircuit(len(b.Rows))
+	c.DataHash, c.Ordering, c.Msg = b.assignment.DataHash, b.assignment.Ordering, b.assignment.Msg
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c)
+	if err != nil {
+		return Proof{}, err
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		return Proof{}, err
+	}
+	w, err := frontend.NewWitness(b.assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return Proof{}, err
+	}
+	proof, err := groth16_bn254.Prove(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w)
+	if err != nil {
+		return Proof{}, err
+	}
+	pw, err := artifacts.NewProofWrap(proof)
+	if err != nil {
+		return Proof{}, err
+	}
+	cd, err := artifacts.NewCalldata(pw, b.PublicInputs)
+	if err != nil {
+		return Proof{}, err
+	}
+	var vkBuf bytes.Buffer
+	if _, err := vk.WriteTo(&vkBuf); err != nil {
+		return Proof{}, err
+	}
+	return Proof{
+		Batch:        b.Name,
+		VerifyingKey: hexOf(vkBuf.Bytes()),
+		Proof:        pw[:],
+		PublicInputs: b.PublicInputs,
+		Calldata:     hexOf(cd),
+		proof:        proof,
+	}, nil
+}
+
+func hash(layout string, out *big.Int, in []*big.Int) Hash {
+	h := Hash{Layout: layout, Inputs: []string{}, Output: fieldHex(out)}
+	for _, x := range in {
+		h.Inputs = append(h.Inputs, fieldHex(x))
+	}
+	return h
+}
+
+func fieldBytes(x *big.Int) []byte {
+	out := make([]byte, 32)
+	return new(big.Int).Mod(x, ecc.BN254.ScalarField()).FillBytes(out)
+}
+
+func fieldHex(x *big.Int) string { return hexOf(fieldBytes(x)) }
+
+func hexOf(b []byte) string { return "0x" + hex.EncodeToString(b) }
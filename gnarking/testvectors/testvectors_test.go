@@ -0,0 +1,73 @@
+package testvectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/circuit"
+)
+
+// testdata/vectors.json is frozen: other implementations test against it, so
+// a diff here is a format break. Regenerate with `ddm vectors -out
+// testvectors/testdata/vectors.json` only for an intended, versioned change.
+func TestFrozen(t *testing.T) {
+	want, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Generate(DefaultSeed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if _, err := v.WriteTo(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatal("generated vectors differ from testdata/vectors.json")
+	}
+
+	for _, s := range v.Signatures {
+		pk, _ := hex.DecodeString(v.Keys[s.Key].Public[2:])
+		sig, _ := hex.DecodeString(s.Sig[2:])
+		msg, _ := hex.DecodeString(v.Messages[s.Message].Msg[2:])
+		if err := (circuit.EdDSA{}).Verify(pk, sig, msg); err != nil {
+			t.Fatalf("signature over message %d: %v", s.Message, err)
+		}
+	}
+}
+
+func TestProof(t *testing.T) {
+	if testing.Short() {
+		t.Skip("setup and prove of a full batch")
+	}
+	v, err := Generate(DefaultSeed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := v.Proofs[0]
+	raw, _ := hex.DecodeString(p.VerifyingKey[2:])
+	var vk groth16_bn254.VerifyingKey
+	if _, err := vk.ReadFrom(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	b := v.Batches[0]
+	pw, err := frontend.NewWitness(b.assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := groth16.Verify(p.proof, &vk, pw); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Proof) != 8 || !slices.Equal(p.PublicInputs, b.PublicInputs) {
+		t.Fatalf("proof vector %+v", p)
+	}
+}
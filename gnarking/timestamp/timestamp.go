@@ -0,0 +1,394 @@
+// Package timestamp gets and checks RFC 3161 trusted timestamps: a
+// Time-Stamp Authority signs a SHA-256 digest together with the time it saw
+// it, so whoever holds the token can later show the digested data existed
+// by then. Receipts (package publish) carry one over the published proof
+// artifacts, for disputes about when a batch was settled.
+//
+// Only what the receipts need is implemented: SHA-256 imprints, CMS
+// SignedData tokens signed with RSA PKCS #1 v1.5, ECDSA or Ed25519 over signed
+// attributes, and the signer's certificate carried in the token.
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"time"
+
+	"gnarking/errs"
+)
+
+// MaxResponse bounds a TSA's reply; tokens with a certificate chain are a
+// few KiB.
+const MaxResponse = 1 << 20
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue // issuerAndSerial, or [0] subject key ID
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional,default:false"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Token is a parsed TimeStampToken whose signature checked out against the
+// certificate it names.
+type Token struct {
+	DER    []byte    // the token as the TSA sent it, for the receipt
+	Time   time.Time // genTime: when the TSA says it saw the digest
+	Serial *big.Int  // unique per TSA
+	Policy asn1.ObjectIdentifier
+	Digest [32]byte // the SHA-256 imprint it covers
+	Nonce  *big.Int // nil when the request had none
+	Signer *x509.Certificate
+	Certs  []*x509.Certificate // all the token carries, the signer's included
+}
+
+// Client asks a TSA for timestamps over HTTP (RFC 3161 section 3.4).
+type Client struct {
+	URL  string
+	HTTP *http.Client // http.DefaultClient when nil
+}
+
+// Stamp gets a token over digest. The request asks for the signer's
+// certificate and carries a random nonce the token must echo; the token's
+// signature is checked, its chain is not (see Token.Verify).
+func (c *Client) Stamp(ctx context.Context, digest [32]byte) (*Token, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	body, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}, HashedMessage: digest[:]},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errs.ErrUnavailable, c.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s: %s", errs.ErrUnavailable, c.URL, resp.Status, bytes.TrimSpace(reply[:min(len(reply), 512)]))
+	}
+	if len(reply) > MaxResponse {
+		return nil, fmt.Errorf("%w: %s: reply over %d bytes", errs.ErrUnavailable, c.URL, MaxResponse)
+	}
+
+	var tsr timeStampResp
+	if rest, err := asn1.Unmarshal(reply, &tsr); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %s: malformed reply: %v", errs.ErrUnavailable, c.URL, err)
+	}
+	// 0 granted, 1 granted with modifications
+	if tsr.Status.Status > 1 {
+		return nil, fmt.Errorf("%w: %s refused, status %d %q, failure bits %x", errs.ErrUnavailable, c.URL, tsr.Status.Status, tsr.Status.StatusString, tsr.Status.FailInfo.Bytes)
+	}
+	if len(tsr.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: %s granted without a token", errs.ErrUnavailable, c.URL)
+	}
+	tok, err := Parse(tsr.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if tok.Digest != digest {
+		return nil, fmt.Errorf("%w: %s stamped %x, asked for %x", errs.ErrVerificationFailed, c.URL, tok.Digest, digest)
+	}
+	if tok.Nonce == nil || tok.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: %s did not echo the request nonce", errs.ErrVerificationFailed, c.URL)
+	}
+	return tok, nil
+}
+
+// Parse decodes a TimeStampToken and checks its CMS signature with the
+// signer's certificate, which the token must carry. Malformed tokens are
+// errs.ErrInvalidInput, ones whose signature or content digest does not
+// check errs.ErrVerificationFailed. Whether to trust the signer is left to
+// Verify.
+func Parse(der []byte) (*Token, error) {
+	malformed := func(what string, err error) error {
+		return fmt.Errorf("%w: timestamp token: %s: %v", errs.ErrInvalidInput, what, err)
+	}
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, malformed("content info", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, malformed("content type", fmt.Errorf("%v, not signed data", ci.ContentType))
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, malformed("signed data", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, malformed("encapsulated content", fmt.Errorf("%v, not TSTInfo", sd.EncapContentInfo.EContentType))
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, malformed("TSTInfo", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || len(info.MessageImprint.HashedMessage) != sha256.Size {
+		return nil, malformed("imprint", fmt.Errorf("%v of %d bytes, not SHA-256", info.MessageImprint.HashAlgorithm.Algorithm, len(info.MessageImprint.HashedMessage)))
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, malformed("certificates", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, malformed("signer infos", fmt.Errorf("%d, want 1", len(sd.SignerInfos)))
+	}
+	si := sd.SignerInfos[0]
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignature(si, signer, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+
+	tok := &Token{
+		DER:    der,
+		Time:   info.GenTime,
+		Serial: info.SerialNumber,
+		Policy: info.Policy,
+		Nonce:  info.Nonce,
+		Signer: signer,
+		Certs:  certs,
+	}
+	copy(tok.Digest[:], info.MessageImprint.HashedMessage)
+	return tok, nil
+}
+
+// Verify checks the token covers digest and, with roots, that its signer
+// chains to one of them as a time-stamping certificate valid at the
+// token's time. Without roots only the signature is vouched for: anyone
+// can make a certificate.
+func (t *Token) Verify(digest [32]byte, roots *x509.CertPool) error {
+	if t.Digest != digest {
+		return fmt.Errorf("%w: timestamp covers %x, not %x", errs.ErrVerificationFailed, t.Digest, digest)
+	}
+	if !slices.Contains(t.Signer.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return fmt.Errorf("%w: timestamp signer %q is not a time-stamping certificate", errs.ErrVerificationFailed, t.Signer.Subject)
+	}
+	if roots == nil {
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range t.Certs {
+		intermediates.AddCert(c)
+	}
+	_, err := t.Signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: timestamp signer %q: %w", errs.ErrVerificationFailed, t.Signer.Subject, err)
+	}
+	return nil
+}
+
+// findSigner is the certificate sid names: by issuer and serial number, or
+// by subject key identifier ([0]).
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: timestamp token lacks the certificate of key ID %x", errs.ErrVerificationFailed, sid.Bytes)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("%w: timestamp token: signer ID: %v", errs.ErrInvalidInput, err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.Serial) == 0 {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: timestamp token lacks the signer's certificate (serial %s)", errs.ErrVerificationFailed, ias.Serial)
+}
+
+// checkSignature checks si's signed attributes bind content (its content
+// type and digest) and are signed by cert.
+func checkSignature(si signerInfo, cert *x509.Certificate, content []byte) error {
+	hash, err := hashOf(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return fmt.Errorf("%w: timestamp token: no signed attributes", errs.ErrInvalidInput)
+	}
+	// signed as a SET, carried [0] IMPLICIT
+	signed := slices.Clone(si.SignedAttrs.FullBytes)
+	signed[0] = 0x31
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return fmt.Errorf("%w: timestamp token: signed attributes: %v", errs.ErrInvalidInput, err)
+	}
+	var digest []byte
+	var contentType asn1.ObjectIdentifier
+	for _, a := range attrs {
+		if len(a.Values) != 1 {
+			continue
+		}
+		switch {
+		case a.Type.Equal(oidMessageDigest):
+			asn1.Unmarshal(a.Values[0].FullBytes, &digest)
+		case a.Type.Equal(oidContentType):
+			asn1.Unmarshal(a.Values[0].FullBytes, &contentType)
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return fmt.Errorf("%w: timestamp token: signed content type %v, not TSTInfo", errs.ErrVerificationFailed, contentType)
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(digest, h.Sum(nil)) {
+		return fmt.Errorf("%w: timestamp token: TSTInfo does not match its signed digest", errs.ErrVerificationFailed)
+	}
+
+	var algo x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algo = map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA}[hash]
+	case *ecdsa.PublicKey:
+		algo = map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512}[hash]
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	}
+	if algo == x509.UnknownSignatureAlgorithm {
+		return fmt.Errorf("%w: timestamp token: %T signer key", errs.ErrInvalidInput, cert.PublicKey)
+	}
+	if err := cert.CheckSignature(algo, signed, si.Signature); err != nil {
+		return fmt.Errorf("%w: timestamp token signature: %w", errs.ErrVerificationFailed, err)
+	}
+	return nil
+}
+
+func hashOf(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: timestamp token: digest algorithm %v", errs.ErrInvalidInput, oid)
+}
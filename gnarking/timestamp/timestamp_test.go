@@ -0,0 +1,224 @@
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gnarking/errs"
+)
+
+// tsa is a minimal RFC 3161 authority: an ECDSA key with a time-stamping
+// certificate issued by its own root.
+type tsa struct {
+	root, cert *x509.Certificate
+	key        *ecdsa.PrivateKey
+	now        time.Time
+	status     int  // replied PKIStatus
+	dropNonce  bool // leave the nonce out of the token
+	serial     int64
+}
+
+func newTSA(t *testing.T) *tsa {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test TSA root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test TSA"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(certDER)
+	return &tsa{root: root, cert: cert, key: key, now: now}
+}
+
+func (a *tsa) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil || r.Header.Get("Content-Type") != "application/timestamp-query" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp := timeStampResp{Status: pkiStatusInfo{Status: a.status}}
+	if a.status <= 1 {
+		tok, err := a.token(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.TimeStampToken = asn1.RawValue{FullBytes: tok}
+	}
+	der, _ := asn1.Marshal(resp)
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(der)
+}
+
+func (a *tsa) token(req timeStampReq) ([]byte, error) {
+	a.serial++
+	info := tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(a.serial),
+		GenTime:        a.now,
+		Nonce:          req.Nonce,
+	}
+	if a.dropNonce {
+		info.Nonce = nil
+	}
+	content, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	value := func(v any) asn1.RawValue {
+		b, _ := asn1.Marshal(v)
+		return asn1.RawValue{FullBytes: b}
+	}
+	signed, err := asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{value(oidTSTInfo)}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{value(sum[:])}},
+	}, "set")
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(signed)
+	sig, err := a.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	implicit := append([]byte{0xa0}, signed[1:]...)
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(append([]byte{}, a.cert.Raw...), a.root.Raw...)},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                value(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: a.cert.RawIssuer}, Serial: a.cert.SerialNumber}),
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: implicit},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+}
+
+func TestStamp(t *testing.T) {
+	a := newTSA(t)
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+	c := &Client{URL: srv.URL}
+	ctx := context.Background()
+	digest := sha256.Sum256([]byte("receipt"))
+
+	tok, err := c.Stamp(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tok.Time.Equal(a.now) || tok.Serial.Int64() != 1 || tok.Signer.Subject.CommonName != "test TSA" {
+		t.Fatalf("token time %s serial %s signer %s", tok.Time, tok.Serial, tok.Signer.Subject)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(a.root)
+	if err := tok.Verify(digest, roots); err != nil {
+		t.Fatal(err)
+	}
+
+	// what a receipt keeps is all a verifier needs
+	again, err := Parse(tok.DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Verify(digest, roots); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Verify(sha256.Sum256([]byte("other receipt")), roots); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("other digest: %v, want ErrVerificationFailed", err)
+	}
+	other := x509.NewCertPool()
+	other.AddCert(newTSA(t).root)
+	if err := again.Verify(digest, other); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("untrusted root: %v, want ErrVerificationFailed", err)
+	}
+
+	// any byte the signature covers changed, or the signature itself, or
+	// the signer's certificate: the token no longer verifies (the rest of
+	// the CMS envelope is unsigned by design)
+	var ci contentInfo
+	var sd signedData
+	asn1.Unmarshal(tok.DER, &ci)
+	asn1.Unmarshal(ci.Content.Bytes, &sd)
+	for _, part := range [][]byte{sd.EncapContentInfo.EContent, sd.SignerInfos[0].SignedAttrs.FullBytes, sd.SignerInfos[0].Signature, tok.Signer.Raw} {
+		at := bytes.Index(tok.DER, part)
+		if at < 0 {
+			t.Fatal("token part not found")
+		}
+		for i := at; i < at+len(part); i++ {
+			bad := bytes.Clone(tok.DER)
+			bad[i] ^= 0x01
+			tok, err := Parse(bad)
+			if err == nil {
+				err = tok.Verify(digest, roots)
+			}
+			if err == nil {
+				t.Fatalf("token with byte %d flipped verifies", i)
+			}
+		}
+	}
+
+	a.dropNonce = true
+	if _, err := c.Stamp(ctx, digest); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("nonce not echoed: %v, want ErrVerificationFailed", err)
+	}
+	a.dropNonce, a.status = false, 2
+	if _, err := c.Stamp(ctx, digest); !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("refused: %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package tracing puts OpenTelemetry spans on compile, setup, the prove
+// with its witness solving and its FFTs and MSMs, and the verifier's
+// pairing check, with the batch's profile, size and ID as attributes, so a
+// latency regression can be pinned on one phase. Library code records
+// through the global tracer provider, a no-op until a binary calls Init.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init exports spans over OTLP/HTTP, which Jaeger and Tempo both accept,
+// when OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is
+// set (the exporter reads the rest of the standard OTEL_* variables);
+// otherwise tracing stays off. Call the returned shutdown before exiting to
+// flush what is buffered.
+func Init(ctx context.Context, service string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start opens a span named name under ctx's.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("gnarking").Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End closes span, marking it failed when err is set.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Attributes of a batch's spans.
+func Profile(name string) attribute.KeyValue { return attribute.String("ddm.profile", name) }
+func N(n int) attribute.KeyValue             { return attribute.Int("ddm.n", n) }
+func Constraints(n int) attribute.KeyValue   { return attribute.Int("ddm.constraints", n) }
+func CacheHit(hit bool) attribute.KeyValue   { return attribute.Bool("ddm.cache_hit", hit) }
+func BatchID(id [32]byte) attribute.KeyValue {
+	return attribute.String("ddm.batch_id", hex.EncodeToString(id[:]))
+}
+
+// Compile compiles c to a BN254 R1CS in a "compile" span.
+func Compile(ctx context.Context, c frontend.Circuit, attrs ...attribute.KeyValue) (ccs constraint.ConstraintSystem, err error) {
+	_, span := Start(ctx, "compile", attrs...)
+	defer func() { End(span, err) }()
+	ccs, err = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, c)
+	if err == nil {
+		span.SetAttributes(Constraints(ccs.GetNbConstraints()))
+	}
+	return ccs, err
+}
+
+// Setup runs the Groth16 setup of ccs in a "setup" span.
+func Setup(ctx context.Context, ccs constraint.ConstraintSystem, attrs ...attribute.KeyValue) (pk groth16.ProvingKey, vk groth16.VerifyingKey, err error) {
+	_, span := Start(ctx, "setup", append(attrs, Constraints(ccs.GetNbConstraints()))...)
+	defer func() { End(span, err) }()
+	return groth16.Setup(ccs)
+}
+
+// Carrier adapts headers for propagating a span across HTTP.
+type Carrier = propagation.HeaderCarrier
+
+// Inject writes ctx's span into outgoing headers, Extract reads it back.
+func Inject(ctx context.Context, c Carrier) { otel.GetTextMapPropagator().Inject(ctx, c) }
+func Extract(ctx context.Context, c Carrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, c)
+}
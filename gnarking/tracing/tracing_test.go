@@ -0,0 +1,96 @@
+package tracing_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"gnarking/circuit"
+	"gnarking/prover"
+	"gnarking/tracing"
+	"gnarking/verifier"
+)
+
+// shaped has the settlement public inputs, so verifier.VerifyContext takes
+// its proofs.
+type shaped struct {
+	P   circuit.SettlementCircuitPublic
+	X   frontend.Variable
+	Sum frontend.Variable
+}
+
+func (c *shaped) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.P.TotalSettle)
+	api.AssertIsEqual(c.Sum, api.Add(c.P.Recipient, c.P.KOld, c.P.M, c.P.ChainID, c.P.Pk.A.X, c.P.Pk.A.Y, c.P.BatchDataRoot))
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	ctx, root := tracing.Start(context.Background(), "batch", tracing.Profile("test"), tracing.N(1))
+	ccs, err := tracing.Compile(ctx, &shaped{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := tracing.Setup(ctx, ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := circuit.SettlementCircuitPublic{
+		Recipient: big.NewInt(42), KOld: big.NewInt(0), M: big.NewInt(8), TotalSettle: big.NewInt(49),
+		ChainID: big.NewInt(1), BatchDataRoot: big.NewInt(3),
+	}
+	pub.Pk.A.X, pub.Pk.A.Y = big.NewInt(1), big.NewInt(2)
+	w, err := frontend.NewWitness(&shaped{P: pub, X: 7, Sum: 57}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := new(prover.Tracker).Prove(ctx, ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w, 0, func(prover.Progress) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.VerifyContext(ctx, vk, proof, pub); err != nil {
+		t.Fatal(err)
+	}
+	bad := pub
+	bad.M = big.NewInt(9)
+	if err := verifier.VerifyContext(ctx, vk, proof, bad); err == nil {
+		t.Fatal("wrong M verified")
+	}
+	root.End()
+
+	// every phase under its parent, the failed verify marked as such
+	parent := map[string]string{
+		"compile": "batch", "setup": "batch", "prove": "batch", "solve": "prove", "msm": "prove",
+		"verify": "batch", "pairing check": "verify",
+	}
+	names := make(map[[8]byte]string)
+	spans := rec.Ended()
+	for _, s := range spans {
+		names[s.SpanContext().SpanID()] = s.Name()
+	}
+	failed := 0
+	for _, s := range spans {
+		if want, ok := parent[s.Name()]; ok && names[s.Parent().SpanID()] != want {
+			t.Errorf("span %s under %q, want %q", s.Name(), names[s.Parent().SpanID()], want)
+		}
+		if s.Name() == "verify" && s.Status().Code == codes.Error {
+			failed++
+		}
+	}
+	if len(spans) != 10 || failed != 1 {
+		t.Fatalf("%d spans, %d failed verifies; want 10 and 1", len(spans), failed)
+	}
+}
@@ -0,0 +1,183 @@
+package verifier
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/chaos"
+	"gnarking/circuit"
+	"gnarking/crash"
+	"gnarking/errs"
+)
+
+// BatchError reports which proofs of a batch failed. Errs is index-aligned
+// with the batch; nil entries verified.
+type BatchError struct {
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	var failed []string
+	for i, err := range e.Errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("proof %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("%d/%d proofs failed: %s", len(failed), len(e.Errs), strings.Join(failed, "; "))
+}
+
+func (e *BatchError) Unwrap() error { return errs.ErrVerificationFailed }
+
+// BatchVerify checks many settlement proofs made with the same vk.
+//
+// The Groth16 equations e(A_j, B_j) == e(α, β)·e(L_j, γ)·e(C_j, δ) are
+// combined with random 128-bit weights r_j into one multi-pairing of
+// len(proofs)+3 pairs:
+//
+//	Π e(r_j·A_j, B_j) · e(-Σ r_j·L_j, γ) · e(-Σ r_j·C_j, δ) · e(-(Σ r_j)·α, β) == 1
+//
+// If that check fails every proof is verified on its own and a *BatchError
+// names the bad ones. Keys with BSB22 commitments are always verified per proof.
+func BatchVerify(proofs []*groth16_bn254.Proof, publics []circuit.SettlementCircuitPublic, vk *groth16_bn254.VerifyingKey) (err error) {
+	if len(proofs) != len(publics) {
+		return fmt.Errorf("%w: %d proofs, %d public inputs", errs.ErrInvalidInput, len(proofs), len(publics))
+	}
+	defer crash.Guard("verify/batch", func() crash.Report {
+		ws := make([]io.WriterTo, len(proofs))
+		for i := range proofs {
+			ws[i] = proofs[i]
+		}
+		var pub circuit.SettlementCircuitPublic
+		if len(publics) > 0 {
+			pub = publics[0] // the summary is the first batch's
+		}
+		return crashReport(vk, pub, ws...)
+	}, &err)
+	wits := make([]fr.Vector, len(publics))
+	for i := range publics {
+		if err := CheckLayout(vk, len(publics[i].Extra)); err != nil {
+			return err
+		}
+		w, err := publicVector(publics[i])
+		if err != nil {
+			return fmt.Errorf("%w: public inputs %d: %w", errs.ErrInvalidInput, i, err)
+		}
+		wits[i] = w
+	}
+	return batchVerify(proofs, wits, vk)
+}
+
+func batchVerify(proofs []*groth16_bn254.Proof, wits []fr.Vector, vk *groth16_bn254.VerifyingKey) error {
+	if len(proofs) == 0 {
+		return nil
+	}
+	if len(vk.CommitmentKeys) > 0 || batchPairing(proofs, wits, vk) != nil {
+		return verifyEach(proofs, wits, vk)
+	}
+	return nil
+}
+
+func batchPairing(proofs []*groth16_bn254.Proof, wits []fr.Vector, vk *groth16_bn254.VerifyingKey) error {
+	n := len(proofs)
+	if len(vk.G1.K) == 0 {
+		return errors.New("empty verifying key")
+	}
+	r := make([]fr.Element, n)
+	var rSum fr.Element
+	bound := new(big.Int).Lsh(big.NewInt(1), 128)
+	for j := range r {
+		v, err := rand.Int(rand.Reader, bound)
+		if err != nil {
+			return err
+		}
+		r[j].SetBigInt(v)
+		rSum.Add(&rSum, &r[j])
+	}
+
+	P := make([]curve.G1Affine, 0, n+3)
+	Q := make([]curve.G2Affine, 0, n+3)
+
+	// Σ r_j·L_j = (Σ r_j)·K[0] + Σ_i (Σ_j r_j·x_ji)·K[i+1]
+	nbPublic := len(vk.G1.K) - 1
+	coeffs := make(fr.Vector, len(vk.G1.K))
+	coeffs[0] = rSum
+	var cSum curve.G1Jac
+	for j, p := range proofs {
+		if len(wits[j]) != nbPublic {
+			return fmt.Errorf("proof %d: %d public inputs, want %d", j, len(wits[j]), nbPublic)
+		}
+		if !p.Ar.IsInSubGroup() || !p.Krs.IsInSubGroup() || !p.Bs.IsInSubGroup() {
+			return fmt.Errorf("proof %d: points not in the correct subgroup", j)
+		}
+		for i := range wits[j] {
+			var t fr.Element
+			t.Mul(&r[j], &wits[j][i])
+			coeffs[i+1].Add(&coeffs[i+1], &t)
+		}
+
+		var a, c curve.G1Affine
+		a.ScalarMultiplication(&p.Ar, r[j].BigInt(new(big.Int)))
+		c.ScalarMultiplication(&p.Krs, r[j].BigInt(new(big.Int)))
+		var cj curve.G1Jac
+		cj.FromAffine(&c)
+		cSum.AddAssign(&cj)
+
+		P = append(P, a)
+		Q = append(Q, p.Bs)
+	}
+
+	var lSum curve.G1Affine
+	if _, err := lSum.MultiExp(vk.G1.K, coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	var cSumAff, alpha curve.G1Affine
+	cSumAff.FromJacobian(&cSum)
+	alpha.ScalarMultiplication(&vk.G1.Alpha, rSum.BigInt(new(big.Int)))
+
+	lSum.Neg(&lSum)
+	cSumAff.Neg(&cSumAff)
+	alpha.Neg(&alpha)
+	P = append(P, lSum, cSumAff, alpha)
+	Q = append(Q, vk.G2.Gamma, vk.G2.Delta, vk.G2.Beta)
+
+	ok, err := curve.PairingCheck(P, Q)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("batched pairing doesn't match")
+	}
+	return nil
+}
+
+func verifyEach(proofs []*groth16_bn254.Proof, wits []fr.Vector, vk *groth16_bn254.VerifyingKey) error {
+	results := make([]error, len(proofs))
+	failed := false
+	for j := range proofs {
+		results[j] = groth16_bn254.Verify(proofs[j], vk, wits[j])
+		failed = failed || results[j] != nil
+	}
+	if failed {
+		return &BatchError{Errs: results}
+	}
+	return nil
+}
+
+func publicVector(pub circuit.SettlementCircuitPublic) (fr.Vector, error) {
+	w, err := circuit.PublicWitness(pub)
+	if err != nil {
+		return nil, err
+	}
+	v := w.Vector().(fr.Vector)
+	chaos.FlipPublic(v)
+	return v, nil
+}
@@ -0,0 +1,81 @@
+package verifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/errs"
+)
+
+// squareCircuit proves knowledge of X with X*X == Y and X+Z == W.
+type squareCircuit struct {
+	X, Z frontend.Variable
+	Y, W frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	api.AssertIsEqual(api.Add(c.X, c.Z), c.W)
+	return nil
+}
+
+func TestBatchVerify(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 5
+	proofs := make([]*groth16_bn254.Proof, n)
+	wits := make([]fr.Vector, n)
+	for j := 0; j < n; j++ {
+		x, z := j+2, 7*j
+		w, err := frontend.NewWitness(&squareCircuit{X: x, Z: z, Y: x * x, W: x + z}, ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := groth16_bn254.Prove(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pw, _ := w.Public()
+		proofs[j], wits[j] = p, pw.Vector().(fr.Vector)
+	}
+	bvk := vk.(*groth16_bn254.VerifyingKey)
+
+	if err := batchPairing(proofs, wits, bvk); err != nil {
+		t.Fatalf("batched pairing: %v", err)
+	}
+	if err := batchVerify(proofs, wits, bvk); err != nil {
+		t.Fatal(err)
+	}
+
+	// a wrong public input fails the batch and is localized
+	wits[3] = append(fr.Vector{}, wits[3]...)
+	wits[3][0].SetUint64(1000)
+	if batchPairing(proofs, wits, bvk) == nil {
+		t.Fatal("batched pairing accepted a wrong public input")
+	}
+	var berr *BatchError
+	err = batchVerify(proofs, wits, bvk)
+	if !errors.As(err, &berr) || !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("want *BatchError, got %v", err)
+	}
+	for j, err := range berr.Errs {
+		if (err != nil) != (j == 3) {
+			t.Fatalf("proof %d: %v", j, err)
+		}
+	}
+}
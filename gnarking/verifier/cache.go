@@ -0,0 +1,167 @@
+package verifier
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/ioutilx"
+)
+
+const (
+	DefaultCacheTTL = 10 * time.Minute
+	DefaultCacheMax = 10000
+)
+
+// CacheKey names one verification: the proof as received, the public inputs
+// (their BatchID, a hash of the canonical form) and the verifying key. A
+// change to any of the three is another key.
+type CacheKey struct {
+	Proof  [32]byte
+	Public [32]byte
+	VK     [32]byte
+}
+
+// KeyOf is the key of verifying proof (the bytes as received, header
+// included) against pub under the vk hashing to vk.
+func KeyOf(proof []byte, pub circuit.SettlementCircuitPublic, vk [32]byte) (CacheKey, error) {
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	return CacheKey{Proof: sha256.Sum256(proof), Public: id, VK: vk}, nil
+}
+
+// VKHash is the sha256 of a verifying key's serialization.
+func VKHash(vk io.WriterTo) ([32]byte, error) {
+	_, sum, err := ioutilx.HashOf(vk)
+	return sum, err
+}
+
+// CacheStats are a Cache's counters since it was made.
+type CacheStats struct {
+	Entries       int    `json:"entries"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`     // dropped for room
+	Invalidations uint64 `json:"invalidations"` // dropped with their vk
+}
+
+// Cache remembers verification outcomes for TTL, so a server asked to verify
+// the same proof again answers without the pairing check. Only outcomes that
+// follow from the key alone are kept: valid, and ErrVerificationFailed.
+// Anything else (a cancelled context, an unavailable dependency) is returned
+// and forgotten. Safe for concurrent use.
+type Cache struct {
+	TTL time.Duration    // DefaultCacheTTL when zero
+	Max int              // entries, DefaultCacheMax when zero; the oldest go first
+	Now func() time.Time // time.Now when nil
+
+	mu      sync.Mutex
+	entries map[CacheKey]*list.Element
+	order   list.List // of *cacheEntry, oldest first: all share the TTL
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key     CacheKey
+	err     error
+	expires time.Time
+}
+
+// Do returns the cached outcome of key, or runs verify and caches its
+// outcome when it is one to keep. cached reports which.
+func (c *Cache) Do(key CacheKey, verify func() error) (cached bool, err error) {
+	if err, ok := c.get(key); ok {
+		return true, err
+	}
+	err = verify()
+	if err == nil || errors.Is(err, errs.ErrVerificationFailed) {
+		c.put(key, err)
+	}
+	return false, err
+}
+
+func (c *Cache) get(key CacheKey) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if c.now().Before(e.expires) {
+			c.stats.Hits++
+			return e.err, true
+		}
+		c.remove(el)
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *Cache) put(key CacheKey, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[CacheKey]*list.Element)
+	}
+	now := c.now()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	for el := c.order.Front(); el != nil && !now.Before(el.Value.(*cacheEntry).expires); el = c.order.Front() {
+		c.remove(el)
+	}
+	max := c.Max
+	if max <= 0 {
+		max = DefaultCacheMax
+	}
+	for c.order.Len() >= max {
+		c.remove(c.order.Front())
+		c.stats.Evictions++
+	}
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	c.entries[key] = c.order.PushBack(&cacheEntry{key: key, err: err, expires: now.Add(ttl)})
+}
+
+// Invalidate drops every outcome under the vk hashing to vk, for when it is
+// swapped out: its entries would never be hit again, only take room.
+func (c *Cache) Invalidate(vk [32]byte) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, el := range c.entries {
+		if key.VK == vk {
+			c.remove(el)
+			n++
+		}
+	}
+	c.stats.Invalidations += uint64(n)
+	return n
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.order.Len()
+	return s
+}
+
+func (c *Cache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	c.order.Remove(el)
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,93 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := &Cache{TTL: time.Minute, Max: 3, Now: func() time.Time { return now }}
+	vkA, vkB := [32]byte{0xa}, [32]byte{0xb}
+
+	var pub circuit.SettlementCircuitPublic
+	pub.Recipient, pub.KOld, pub.M, pub.TotalSettle, pub.ChainID = big.NewInt(42), big.NewInt(0), big.NewInt(8), big.NewInt(8), big.NewInt(1)
+	pub.Pk.A.X, pub.Pk.A.Y, pub.BatchDataRoot = big.NewInt(0), big.NewInt(1), big.NewInt(3)
+	key := func(proof string, vk [32]byte) CacheKey {
+		t.Helper()
+		k, err := KeyOf([]byte(proof), pub, vk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	calls := 0
+	do := func(k CacheKey, result error) (bool, error) {
+		return c.Do(k, func() error { calls++; return result })
+	}
+
+	// valid and invalid outcomes are both kept
+	bad := fmt.Errorf("%w: pairing", errs.ErrVerificationFailed)
+	if cached, err := do(key("p1", vkA), nil); cached || err != nil {
+		t.Fatalf("first: cached %v, %v", cached, err)
+	}
+	do(key("p2", vkA), bad)
+	if cached, err := do(key("p1", vkA), errors.New("not run")); !cached || err != nil {
+		t.Fatalf("valid again: cached %v, %v", cached, err)
+	}
+	if cached, err := do(key("p2", vkA), nil); !cached || !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("invalid again: cached %v, %v", cached, err)
+	}
+	if calls != 2 {
+		t.Fatalf("%d verifications, want 2", calls)
+	}
+
+	// other public inputs or another vk are other keys
+	other := pub
+	other.TotalSettle = big.NewInt(9)
+	k, _ := KeyOf([]byte("p1"), other, vkA)
+	if k == key("p1", vkA) || key("p1", vkB) == key("p1", vkA) {
+		t.Fatal("keys collide")
+	}
+
+	// transient errors are not remembered
+	do(key("p3", vkA), context.Canceled)
+	if cached, _ := do(key("p3", vkA), nil); cached {
+		t.Fatal("cancellation was cached")
+	}
+
+	// full: the oldest goes
+	do(key("p4", vkB), nil)
+	if s := c.Stats(); s.Entries != 3 || s.Evictions != 1 {
+		t.Fatalf("stats after eviction %+v", s)
+	}
+	if cached, _ := do(key("p1", vkA), nil); cached {
+		t.Fatal("evicted entry hit")
+	}
+
+	// expired entries are verified again, and make room
+	now = now.Add(time.Minute)
+	if cached, _ := do(key("p4", vkB), nil); cached {
+		t.Fatal("expired entry hit")
+	}
+
+	// a swapped-out vk takes its entries with it
+	do(key("p5", vkA), nil)
+	if n := c.Invalidate(vkA); n != 1 {
+		t.Fatalf("invalidated %d, want 1", n)
+	}
+	if cached, _ := do(key("p4", vkB), nil); !cached {
+		t.Fatal("other vk's entry dropped")
+	}
+	s := c.Stats()
+	if s.Entries != 1 || s.Invalidations != 1 || s.Hits != 3 {
+		t.Fatalf("stats %+v", s)
+	}
+}
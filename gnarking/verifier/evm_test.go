@@ -0,0 +1,195 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fp_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fp"
+	fr_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+)
+
+// testdata/evm is a profile 8 setup frozen with a proof, the Solidity
+// verifier ExportSolidity makes of its vk, and that verifier's runtime
+// bytecode: solc 0.8.30, optimizer on, 200 runs. To regenerate, prove a
+// batch, then
+//
+//	ddm export -vk vk_8.groth16 -proof proof_8.groth16 -public public_8.json -out verifier/testdata/evm
+//
+// keep settlement_verifier_8.sol, copy vk_8.groth16, proof_8.groth16 and
+// public_8.json in, and write the deployedBytecode solc compiles the .sol
+// to, hex, to settlement_verifier_8.bin-runtime.
+const evmDir = "testdata/evm/"
+
+// TestEVMParity runs the exported verifier under go-ethereum's EVM with the
+// calldata NewCalldata builds, for a valid proof and edge cases around it,
+// and checks it accepts exactly what native verification of the same words
+// accepts.
+func TestEVMParity(t *testing.T) {
+	var vk groth16_bn254.VerifyingKey
+	var proof groth16_bn254.Proof
+	var pub circuit.SettlementCircuitPublic
+	readTestdata(t, "vk_8.groth16", &vk)
+	readTestdata(t, "proof_8.groth16", &artifacts.Proof{Proof: &proof})
+	readTestdata(t, "public_8.json", &pub)
+	if err := Verify(&vk, &proof, pub); err != nil {
+		t.Fatalf("frozen proof: %v", err)
+	}
+
+	// the bytecode is of this vk's verifier as the exporter writes it today
+	sol, err := os.ReadFile(evmDir + "settlement_verifier_8.sol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported bytes.Buffer
+	if err := vk.ExportSolidity(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported.Bytes(), sol) {
+		t.Fatal("ExportSolidity output differs from testdata/evm/settlement_verifier_8.sol: regenerate testdata/evm")
+	}
+	code, err := os.ReadFile(evmDir + "settlement_verifier_8.bin-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err = hex.DecodeString(strings.TrimSpace(string(code))); err != nil {
+		t.Fatal(err)
+	}
+
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := artifacts.NewProofWrap(&proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer // Ar | Bs | Krs as the words, then the empty commitments
+	if _, err := proof.WriteRawTo(&raw); err != nil {
+		t.Fatal(err)
+	}
+
+	p, r := fp_bn254.Modulus(), fr_bn254.Modulus()
+	for _, tc := range []struct {
+		name  string
+		edit  func(proof []*big.Int, inputs []*big.Int) []*big.Int // returns the inputs to send
+		valid bool
+	}{
+		{"valid", nil, true},
+		{"input tampered", func(_, in []*big.Int) []*big.Int { in[3].Add(in[3], big.NewInt(1)); return in }, false},
+		{"input plus r", func(_, in []*big.Int) []*big.Int { in[0].Add(in[0], r); return in }, false},
+		{"input r", func(_, in []*big.Int) []*big.Int { in[1].Set(r); return in }, false},
+		{"input missing", func(_, in []*big.Int) []*big.Int { return in[:len(in)-1] }, false},
+		{"input extra", func(_, in []*big.Int) []*big.Int { return append(in, big.NewInt(0)) }, false},
+		{"A.x plus p", func(pr, in []*big.Int) []*big.Int { pr[0].Add(pr[0], p); return in }, false},
+		{"A negated", func(pr, in []*big.Int) []*big.Int { pr[1].Sub(p, pr[1]); return in }, false},
+		{"A off curve", func(pr, in []*big.Int) []*big.Int { pr[1].Add(pr[1], big.NewInt(1)); return in }, false},
+		{"B.x halves swapped", func(pr, in []*big.Int) []*big.Int { pr[2], pr[3] = pr[3], pr[2]; return in }, false},
+		{"C is A", func(pr, in []*big.Int) []*big.Int {
+			pr[6], pr[7] = new(big.Int).Set(pr[0]), new(big.Int).Set(pr[1])
+			return in
+		}, false},
+		{"zero proof", func(pr, in []*big.Int) []*big.Int {
+			for i := range pr {
+				pr[i].SetInt64(0)
+			}
+			return in
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pr, in := bigWords(words[:]), bigWords(inputs)
+			if tc.edit != nil {
+				in = tc.edit(pr, in)
+			}
+			native := nativeVerify(&vk, pr, in, raw.Bytes()[len(words)*32:]) == nil
+			_, _, evmErr := runtime.Execute(code, calldata(t, pr, in), nil)
+			if onChain := evmErr == nil; native != tc.valid || onChain != tc.valid {
+				t.Fatalf("native accepts: %v, EVM accepts: %v (%v), want %v", native, onChain, evmErr, tc.valid)
+			}
+		})
+	}
+}
+
+func readTestdata(t *testing.T, name string, r io.ReaderFrom) {
+	t.Helper()
+	f, err := os.Open(evmDir + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := r.ReadFrom(f); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func bigWords(hexWords []string) []*big.Int {
+	out := make([]*big.Int, len(hexWords))
+	for i, w := range hexWords {
+		out[i], _ = new(big.Int).SetString(strings.TrimPrefix(w, "0x"), 16)
+	}
+	return out
+}
+
+func calldata(t *testing.T, proof, inputs []*big.Int) []byte {
+	t.Helper()
+	var pw artifacts.ProofWrap
+	for i, w := range proof {
+		pw[i] = "0x" + w.Text(16)
+	}
+	in := make(artifacts.PublicInputsHex, len(inputs))
+	for i, w := range inputs {
+		in[i] = "0x" + w.Text(16)
+	}
+	c, err := artifacts.NewCalldata(pw, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// nativeVerify verifies the words the contract gets with gnark, decoding
+// them as gnark's binary proof and witness formats do: coordinates and
+// inputs must be canonical, points on the curve and in the subgroup.
+// rawTail is what follows the words in gnark's raw proof encoding.
+func nativeVerify(vk *groth16_bn254.VerifyingKey, proofWords, inputs []*big.Int, rawTail []byte) error {
+	var raw bytes.Buffer
+	for _, w := range proofWords {
+		raw.Write(w.FillBytes(make([]byte, 32)))
+	}
+	raw.Write(rawTail)
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(&raw); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, [3]uint32{uint32(len(inputs)), 0, uint32(len(inputs))})
+	for _, x := range inputs {
+		buf.Write(x.FillBytes(make([]byte, 32)))
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return err
+	}
+	if _, err := w.ReadFrom(&buf); err != nil {
+		return err
+	}
+	return groth16.Verify(proof, vk, w)
+}
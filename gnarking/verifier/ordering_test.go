@@ -0,0 +1,256 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+)
+
+var updateOrder = flag.Bool("update-order", false, "rewrite testdata/evm/public_order_8.json from the current layout")
+
+// orderSpec is the frozen contract between the Go side and the exported
+// verifier: which public input sits in which calldata word of
+// verifyProof(uint256[8] proof, uint256[n] input).
+type orderSpec struct {
+	Signature string       `json:"signature"`
+	Selector  string       `json:"selector"` // hex
+	Inputs    []orderInput `json:"inputs"`
+}
+
+type orderInput struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`   // key in public_N.json
+	Field  string `json:"field"`  // Go path in the circuit
+	Offset int    `json:"offset"` // byte offset of the word in the calldata
+}
+
+func currentOrderSpec(t *testing.T) []byte {
+	t.Helper()
+	layout, err := circuit.PublicLayout(circuit.Profile{Name: "8", N: circuit.N})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pw artifacts.ProofWrap
+	for i := range pw {
+		pw[i] = "0x0"
+	}
+	empty := make(artifacts.PublicInputsHex, len(layout))
+	for i := range empty {
+		empty[i] = "0x0"
+	}
+	c, err := artifacts.NewCalldata(pw, empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := orderSpec{
+		Signature: fmt.Sprintf("verifyProof(uint256[%d],uint256[%d])", len(pw), len(layout)),
+		Selector:  hex.EncodeToString(c[:4]),
+	}
+	for _, in := range layout {
+		spec.Inputs = append(spec.Inputs, orderInput{Index: in.Index, Name: in.Name, Field: in.Field, Offset: 4 + 32*(len(pw)+in.Index)})
+	}
+	b, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
+
+// TestPublicInputOrderSpec pins the input order to
+// testdata/evm/public_order_8.json, byte for byte, and checks
+// PublicInputsHex writes the fields in that order: each field gets a
+// distinct value, so a swap anywhere between the public struct, the witness
+// and the hex words shows. Run with -update-order after a deliberate
+// layout change, and redeploy every verifier.
+func TestPublicInputOrderSpec(t *testing.T) {
+	const name = evmDir + "public_order_8.json"
+	spec := currentOrderSpec(t)
+	if *updateOrder {
+		if err := os.WriteFile(name, spec, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frozen, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, frozen) {
+		t.Fatalf("public input order differs from %s:\n%s\nfrozen:\n%s", name, spec, frozen)
+	}
+	var s orderSpec
+	if err := json.Unmarshal(frozen, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]int64{}
+	for i, in := range s.Inputs {
+		values[in.Name] = int64(101 + i)
+	}
+	var pub circuit.SettlementCircuitPublic
+	pub.Recipient = big.NewInt(values["recipient"])
+	pub.KOld = big.NewInt(values["k_old"])
+	pub.M = big.NewInt(values["m"])
+	pub.TotalSettle = big.NewInt(values["total_settle"])
+	pub.ChainID = big.NewInt(values["chain_id"])
+	pub.Pk.A.X = big.NewInt(values["pk_x"])
+	pub.Pk.A.Y = big.NewInt(values["pk_y"])
+	pub.BatchDataRoot = big.NewInt(values["batch_data_root"])
+	if len(values) != len(circuit.PublicFields) {
+		t.Fatalf("spec names %d inputs, the circuit has %d", len(values), len(circuit.PublicFields))
+	}
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pw artifacts.ProofWrap
+	for i := range pw {
+		pw[i] = "0x0"
+	}
+	calldata, err := artifacts.NewCalldata(pw, words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(calldata[:4]); got != s.Selector {
+		t.Fatalf("selector %s, spec %s", got, s.Selector)
+	}
+	for _, in := range s.Inputs {
+		word := new(big.Int).SetBytes(calldata[in.Offset : in.Offset+32])
+		if word.Int64() != values[in.Name] {
+			t.Errorf("%s: calldata word at %d is %s, want %d", in.Name, in.Offset, word, values[in.Name])
+		}
+	}
+}
+
+// orderingCases generates the input orders and encodings that must not
+// verify: every transposition, every rotation, the reversal, seeded random
+// shuffles, and per input an off-by-one, a byte-reversed word and a zero.
+func orderingCases(inputs []*big.Int, shuffles int) map[string][]*big.Int {
+	n := len(inputs)
+	cases := map[string][]*big.Int{}
+	permuted := func(perm []int) []*big.Int {
+		out := make([]*big.Int, n)
+		for i, j := range perm {
+			out[i] = new(big.Int).Set(inputs[j])
+		}
+		return out
+	}
+	identity := make([]int, n)
+	for i := range identity {
+		identity[i] = i
+	}
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			perm := slices.Clone(identity)
+			perm[i], perm[j] = perm[j], perm[i]
+			cases[fmt.Sprintf("swap %d %d", i, j)] = permuted(perm)
+		}
+	}
+	for k := 1; k < n; k++ {
+		perm := append(slices.Clone(identity[k:]), identity[:k]...)
+		cases[fmt.Sprintf("rotate %d", k)] = permuted(perm)
+	}
+	reversed := slices.Clone(identity)
+	slices.Reverse(reversed)
+	cases["reverse"] = permuted(reversed)
+	rng := rand.New(rand.NewPCG(1224, 8))
+	for k := range shuffles {
+		perm := slices.Clone(identity)
+		rng.Shuffle(n, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+		cases[fmt.Sprintf("shuffle %d", k)] = permuted(perm)
+	}
+	for i := range n {
+		in := permuted(identity)
+		in[i].Add(in[i], big.NewInt(1))
+		cases[fmt.Sprintf("input %d plus one", i)] = in
+
+		in = permuted(identity)
+		b := in[i].FillBytes(make([]byte, 32))
+		slices.Reverse(b)
+		in[i].SetBytes(b)
+		cases[fmt.Sprintf("input %d little-endian", i)] = in
+
+		in = permuted(identity)
+		in[i].SetInt64(0)
+		cases[fmt.Sprintf("input %d zero", i)] = in
+	}
+	return cases
+}
+
+// TestInputOrdering runs the generated orders against the frozen proof, in
+// gnark and in the exported verifier under the EVM: only the canonical
+// word sequence verifies. An order that happens to give the same words
+// (two inputs of equal value swapped) is the canonical sequence, and must
+// verify.
+func TestInputOrdering(t *testing.T) {
+	var vk groth16_bn254.VerifyingKey
+	var proof groth16_bn254.Proof
+	var pub circuit.SettlementCircuitPublic
+	readTestdata(t, "vk_8.groth16", &vk)
+	readTestdata(t, "proof_8.groth16", &artifacts.Proof{Proof: &proof})
+	readTestdata(t, "public_8.json", &pub)
+	code, err := os.ReadFile(evmDir + "settlement_verifier_8.bin-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err = hex.DecodeString(strings.TrimSpace(string(code))); err != nil {
+		t.Fatal(err)
+	}
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := artifacts.NewProofWrap(&proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	if _, err := proof.WriteRawTo(&raw); err != nil {
+		t.Fatal(err)
+	}
+	rawTail := raw.Bytes()[len(words)*32:]
+	canonical := bigWords(inputs)
+
+	check := func(t *testing.T, in []*big.Int, valid bool) {
+		t.Helper()
+		native := nativeVerify(&vk, bigWords(words[:]), in, rawTail) == nil
+		_, _, evmErr := runtime.Execute(code, calldata(t, bigWords(words[:]), in), nil)
+		if onChain := evmErr == nil; native != valid || onChain != valid {
+			t.Fatalf("native accepts: %v, EVM accepts: %v (%v), want %v", native, onChain, evmErr, valid)
+		}
+	}
+	check(t, canonical, true)
+
+	distinct := 0
+	for name, in := range orderingCases(canonical, 16) {
+		same := slices.EqualFunc(in, canonical, func(a, b *big.Int) bool { return a.Cmp(b) == 0 })
+		if !same {
+			distinct++
+		}
+		t.Run(name, func(t *testing.T) { check(t, in, same) })
+	}
+	if distinct < len(canonical)*(len(canonical)-1)/2 {
+		t.Fatalf("only %d generated orders differ from the canonical one", distinct)
+	}
+}
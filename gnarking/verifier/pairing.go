@@ -0,0 +1,128 @@
+package verifier
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// PairingVerify is a second Groth16 verifier, written directly on
+// gnark-crypto's BN254 pairing and sharing no code with gnark's: the public
+// inputs are read off pub field by field in the Solidity verifier's order,
+// L = K[0] + Σ x_i·K[i+1] is summed with plain scalar multiplications, and
+// the proof is accepted iff
+//
+//	e(A, B) · e(-α, β) · e(-L, γ) · e(-C, δ) == 1
+//
+// gnark's key and proof types are only used to deserialize. It supports
+// circuits without commitments, which every profile is.
+func PairingVerify(vk *groth16_bn254.VerifyingKey, proof *groth16_bn254.Proof, pub circuit.SettlementCircuitPublic) error {
+	if len(vk.CommitmentKeys) > 0 || len(proof.Commitments) > 0 {
+		return fmt.Errorf("%w: pairing verifier does not support commitments", errs.ErrArtifactMismatch)
+	}
+	if want := len(circuit.PublicFields) + len(pub.Extra); len(vk.G1.K) != want+1 {
+		return fmt.Errorf("%w: verifying key takes %d public inputs, settlement layout has %d: [%s]",
+			errs.ErrArtifactMismatch, len(vk.G1.K)-1, want, strings.Join(layoutNames(len(pub.Extra)), " "))
+	}
+	inputs, err := publicInputs(pub)
+	if err != nil {
+		return fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	for _, p := range []*curve.G1Affine{&proof.Ar, &proof.Krs} {
+		if !p.IsOnCurve() || !p.IsInSubGroup() {
+			return fmt.Errorf("%w: proof G1 point not in the subgroup", errs.ErrVerificationFailed)
+		}
+	}
+	if !proof.Bs.IsOnCurve() || !proof.Bs.IsInSubGroup() {
+		return fmt.Errorf("%w: proof G2 point not in the subgroup", errs.ErrVerificationFailed)
+	}
+
+	var l curve.G1Jac
+	l.FromAffine(&vk.G1.K[0])
+	for i, x := range inputs {
+		var t curve.G1Jac
+		t.FromAffine(&vk.G1.K[i+1])
+		t.ScalarMultiplication(&t, x)
+		l.AddAssign(&t)
+	}
+	var lNeg, cNeg, alphaNeg curve.G1Affine
+	lNeg.FromJacobian(&l)
+	lNeg.Neg(&lNeg)
+	cNeg.Neg(&proof.Krs)
+	alphaNeg.Neg(&vk.G1.Alpha)
+
+	ok, err := curve.PairingCheck(
+		[]curve.G1Affine{proof.Ar, alphaNeg, lNeg, cNeg},
+		[]curve.G2Affine{proof.Bs, vk.G2.Beta, vk.G2.Gamma, vk.G2.Delta},
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrVerificationFailed, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: pairing check failed", errs.ErrVerificationFailed)
+	}
+	return nil
+}
+
+// CrossVerify accepts a proof only if Verify and PairingVerify both do. A
+// disagreement means one of the two verifiers regressed; it fails the proof
+// and names both verdicts.
+func CrossVerify(vk *groth16_bn254.VerifyingKey, proof *groth16_bn254.Proof, pub circuit.SettlementCircuitPublic) error {
+	gnarkErr := Verify(vk, proof, pub)
+	pairingErr := PairingVerify(vk, proof, pub)
+	switch {
+	case gnarkErr == nil && pairingErr == nil:
+		return nil
+	case gnarkErr != nil && pairingErr != nil:
+		return gnarkErr
+	}
+	return fmt.Errorf("%w: verifiers disagree: gnark: %v, pairing: %v", errs.ErrVerificationFailed, verdict(gnarkErr), verdict(pairingErr))
+}
+
+func verdict(err error) string {
+	if err == nil {
+		return "valid"
+	}
+	return err.Error()
+}
+
+// publicInputs is pub in verifier input order (Recipient, KOld, M,
+// TotalSettle, ChainID, Pk.X, Pk.Y, BatchDataRoot, then Extra), each
+// checked to be a field element rather than reduced.
+func publicInputs(pub circuit.SettlementCircuitPublic) ([]*big.Int, error) {
+	vars := []frontend.Variable{pub.Recipient, pub.KOld, pub.M, pub.TotalSettle, pub.ChainID, pub.Pk.A.X, pub.Pk.A.Y, pub.BatchDataRoot}
+	vars = append(vars, pub.Extra...)
+	names := layoutNames(len(pub.Extra))
+	out := make([]*big.Int, len(vars))
+	for i, v := range vars {
+		var x *big.Int
+		switch v := v.(type) {
+		case *big.Int:
+			x = v
+		case big.Int:
+			x = &v
+		case []byte:
+			x = new(big.Int).SetBytes(v)
+		case nil:
+			return nil, fmt.Errorf("%s unset", names[i])
+		default:
+			return nil, fmt.Errorf("%s: unexpected type %T", names[i], v)
+		}
+		if x == nil {
+			return nil, fmt.Errorf("%s unset", names[i])
+		}
+		if x.Sign() < 0 || x.Cmp(fr.Modulus()) >= 0 {
+			return nil, fmt.Errorf("%s: %s outside the scalar field", names[i], x)
+		}
+		out[i] = x
+	}
+	return out, nil
+}
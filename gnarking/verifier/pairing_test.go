@@ -0,0 +1,145 @@
+package verifier
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+	"gnarking/internal/testcircuit"
+)
+
+func TestPairingVerify(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &testcircuit.SettlementShaped{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vkAny, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := vkAny.(*groth16_bn254.VerifyingKey)
+	pub := circuit.SettlementCircuitPublic{
+		Recipient: big.NewInt(42), KOld: big.NewInt(0), M: big.NewInt(8), TotalSettle: big.NewInt(49),
+		ChainID: big.NewInt(1), BatchDataRoot: big.NewInt(3),
+	}
+	pub.Pk.A.X, pub.Pk.A.Y = append(make([]byte, 31), 1), append(make([]byte, 31), 2)
+	w, err := frontend.NewWitness(&testcircuit.SettlementShaped{P: pub, X: 7, Sum: 57}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16_bn254.Prove(ccs.(*cs_bn254.R1CS), pk.(*groth16_bn254.ProvingKey), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PairingVerify(vk, proof, pub); err != nil {
+		t.Fatalf("valid proof: %v", err)
+	}
+	if err := CrossVerify(vk, proof, pub); err != nil {
+		t.Fatalf("cross-check of a valid proof: %v", err)
+	}
+
+	// every input is bound: both verifiers reject any change
+	bad := pub
+	bad.ChainID = big.NewInt(2)
+	if err := PairingVerify(vk, proof, bad); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("other chain: %v", err)
+	}
+	if err := CrossVerify(vk, proof, bad); !errors.Is(err, errs.ErrVerificationFailed) || strings.Contains(err.Error(), "disagree") {
+		t.Fatalf("cross-check, other chain: %v", err)
+	}
+
+	// TotalSettle + r: gnark reduces it and accepts, the pairing verifier
+	// refuses a non-canonical input, and the cross-check reports the split
+	bad = pub
+	bad.TotalSettle = new(big.Int).Add(big.NewInt(49), ecc.BN254.ScalarField())
+	if err := Verify(vk, proof, bad); err != nil {
+		t.Fatalf("gnark on an unreduced input: %v", err)
+	}
+	if err := PairingVerify(vk, proof, bad); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Fatalf("pairing verifier on an unreduced input: %v", err)
+	}
+	if err := CrossVerify(vk, proof, bad); !errors.Is(err, errs.ErrVerificationFailed) || !strings.Contains(err.Error(), "disagree") {
+		t.Fatalf("cross-check on an unreduced input: %v", err)
+	}
+
+	// a proof point off the subgroup
+	off := *proof
+	off.Krs.X.SetOne()
+	off.Krs.Y.SetOne()
+	if err := PairingVerify(vk, &off, pub); !errors.Is(err, errs.ErrVerificationFailed) {
+		t.Fatalf("point off the curve: %v", err)
+	}
+}
+
+// extraPublic has one public input more than the settlement layout.
+type extraPublic struct {
+	testcircuit.SettlementShaped
+	Extra frontend.Variable `gnark:",public"`
+}
+
+func (c *extraPublic) Define(api frontend.API) error {
+	api.AssertIsEqual(c.Extra, c.Extra)
+	return c.SettlementShaped.Define(api)
+}
+
+func TestCheckLayout(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &extraPublic{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vkAny, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := vkAny.(*groth16_bn254.VerifyingKey)
+	pub := circuit.SettlementCircuitPublic{Recipient: 42, KOld: 0, M: 8, TotalSettle: 49, ChainID: 1, BatchDataRoot: 3}
+	pub.Pk.A.X, pub.Pk.A.Y = 1, 2
+	proof := new(groth16_bn254.Proof)
+
+	for name, err := range map[string]error{
+		"CheckLayout":   CheckLayout(vk, 0),
+		"Verify":        Verify(vk, proof, pub),
+		"PairingVerify": PairingVerify(vk, proof, pub),
+		"BatchVerify":   BatchVerify([]*groth16_bn254.Proof{proof}, []circuit.SettlementCircuitPublic{pub}, vk),
+	} {
+		if !errors.Is(err, errs.ErrArtifactMismatch) {
+			t.Errorf("%s: %v, want ErrArtifactMismatch", name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "takes 9 public inputs, settlement layout has 8: [recipient k_old") {
+			t.Errorf("%s: %q does not list the layout", name, err)
+		}
+	}
+	// the ninth is a variant's own input
+	if err := CheckLayout(vk, 1); err != nil {
+		t.Errorf("CheckLayout with an extra input: %v", err)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	p, err := circuit.LookupProfile("8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a cosign-8 setup's count: its co-signer key follows PublicFields
+	if err := CheckManifest(&artifacts.Manifest{PublicInputs: len(circuit.PublicFields) + 2}, p); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Errorf("another public-input count: %v, want ErrArtifactMismatch", err)
+	}
+	for _, n := range []int{0, len(circuit.PublicFields)} {
+		if err := CheckManifest(&artifacts.Manifest{PublicInputs: n}, p); err != nil {
+			t.Errorf("public_inputs %d: %v", n, err)
+		}
+	}
+}
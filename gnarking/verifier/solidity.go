@@ -0,0 +1,198 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fp"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/errs"
+)
+
+// solConstant matches a uint256 constant of an exported verifier, decimal
+// as ExportSolidity writes the vk's or hex as an edit might.
+var solConstant = regexp.MustCompile(`uint256\s+constant\s+([A-Za-z0-9_]+)\s*=\s*(0x[0-9a-fA-F]+|[0-9]+)\s*;`)
+
+// vkConstant matches the names ExportSolidity gives the vk's coordinates;
+// the other constants (P, R, the precompiles, …) are the template's.
+var vkConstant = regexp.MustCompile(`^(ALPHA|BETA_NEG|GAMMA_NEG|DELTA_NEG|PEDERSEN_G|PEDERSEN_GSIGMANEG|CONSTANT|PUB_[0-9]+)_[XY](_[01])?$`)
+
+// SolidityMismatch is one vk constant of an exported verifier that is not
+// the vk's: Got is empty when the source lacks it, Want when the vk has
+// no such point (e.g. PUB_8_X for 8 public inputs).
+type SolidityMismatch struct {
+	Name string `json:"name"`
+	Want string `json:"want,omitempty"`
+	Got  string `json:"got,omitempty"`
+}
+
+func (m SolidityMismatch) String() string {
+	switch {
+	case m.Got == "":
+		return fmt.Sprintf("%s missing, want %s", m.Name, m.Want)
+	case m.Want == "":
+		return fmt.Sprintf("%s = %s, the vk has no such point", m.Name, m.Got)
+	}
+	return fmt.Sprintf("%s = %s, want %s", m.Name, m.Got, m.Want)
+}
+
+// SolidityCheck is what CheckSolidity found in a verifier's source.
+type SolidityCheck struct {
+	// Constants is how many vk constants were compared.
+	Constants  int                `json:"constants"`
+	Mismatches []SolidityMismatch `json:"mismatches,omitempty"`
+	// Fingerprint is the sha256 of the source with the vk constants'
+	// values blanked: it names the template a verifier came from whatever
+	// its vk. ExportFingerprint is that of ExportSolidity's source for the
+	// vk, from the gnark this binary links.
+	Fingerprint       string `json:"fingerprint"`
+	ExportFingerprint string `json:"export_fingerprint"`
+	// FirstDiff is the first line, 1-based, where the blanked sources
+	// differ, 0 when the fingerprints match; Line and ExportLine are that
+	// line of each.
+	FirstDiff  int    `json:"first_diff,omitempty"`
+	Line       string `json:"line,omitempty"`
+	ExportLine string `json:"export_line,omitempty"`
+}
+
+// CodeMatches reports whether the source is ExportSolidity's but for the
+// vk constants.
+func (c *SolidityCheck) CodeMatches() bool { return c.Fingerprint == c.ExportFingerprint }
+
+// Err is ErrArtifactMismatch naming every mismatched constant, nil when
+// they all match; with code, a source not ExportSolidity's is one too.
+func (c *SolidityCheck) Err(code bool) error {
+	var msgs []string
+	for _, m := range c.Mismatches {
+		msgs = append(msgs, m.String())
+	}
+	if code && !c.CodeMatches() {
+		msgs = append(msgs, fmt.Sprintf("code differs from the export from line %d: %q, want %q", c.FirstDiff, c.Line, c.ExportLine))
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: Solidity verifier: %s", errs.ErrArtifactMismatch, strings.Join(msgs, "; "))
+}
+
+// CheckSolidity compares the vk constants embedded in src, a verifier
+// ExportSolidity wrote, against vk's points, and fingerprints the rest of
+// src against what ExportSolidity writes for vk now: a constant that
+// differs is a stale export or an edit, code that differs an edit or
+// another gnark's template. It errs only when src cannot be checked.
+func CheckSolidity(src []byte, vk *groth16_bn254.VerifyingKey) (*SolidityCheck, error) {
+	want, err := solidityConstants(vk)
+	if err != nil {
+		return nil, err
+	}
+	var export bytes.Buffer
+	if err := vk.ExportSolidity(&export); err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+	got := map[string]string{}
+	for _, m := range solConstant.FindAllSubmatch(src, -1) {
+		if name := string(m[1]); vkConstant.MatchString(name) {
+			got[name] = string(m[2])
+		}
+	}
+	if len(got) == 0 {
+		return nil, fmt.Errorf("%w: no verifying key constants in the source, not an exported Groth16 verifier", errs.ErrInvalidInput)
+	}
+
+	c := &SolidityCheck{Constants: len(want)}
+	names := maps.Clone(want)
+	maps.Copy(names, got)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		w, g := want[name], got[name]
+		if g != "" {
+			if x, ok := new(big.Int).SetString(g, 0); ok && w != "" && x.String() == w {
+				continue
+			}
+		}
+		c.Mismatches = append(c.Mismatches, SolidityMismatch{Name: name, Want: w, Got: g})
+	}
+	blanked, exported := blankConstants(src), blankConstants(export.Bytes())
+	c.Fingerprint, c.ExportFingerprint = fingerprint(blanked), fingerprint(exported)
+	if !c.CodeMatches() {
+		a, b := strings.Split(string(blanked), "\n"), strings.Split(string(exported), "\n")
+		for i := 0; i < max(len(a), len(b)); i++ {
+			if i >= len(a) || i >= len(b) || a[i] != b[i] {
+				c.FirstDiff = i + 1
+				c.Line, c.ExportLine = lineAt(a, i), lineAt(b, i)
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+// solidityConstants are the vk constants ExportSolidity writes for vk, by
+// name, in decimal: beta, gamma and delta negated, so the verifier does not
+// negate proof elements, and the commitment key of the first commitment.
+func solidityConstants(vk *groth16_bn254.VerifyingKey) (map[string]string, error) {
+	if len(vk.G1.K) == 0 {
+		return nil, fmt.Errorf("%w: verifying key has no K points", errs.ErrInvalidInput)
+	}
+	out := map[string]string{}
+	g1 := func(name string, p bn254.G1Affine) {
+		out[name+"_X"], out[name+"_Y"] = fpString(p.X), fpString(p.Y)
+	}
+	g2 := func(name string, p bn254.G2Affine, neg bool) {
+		if neg {
+			p.Neg(&p)
+		}
+		out[name+"_X_0"], out[name+"_X_1"] = fpString(p.X.A0), fpString(p.X.A1)
+		out[name+"_Y_0"], out[name+"_Y_1"] = fpString(p.Y.A0), fpString(p.Y.A1)
+	}
+	g1("ALPHA", vk.G1.Alpha)
+	g2("BETA_NEG", vk.G2.Beta, true)
+	g2("GAMMA_NEG", vk.G2.Gamma, true)
+	g2("DELTA_NEG", vk.G2.Delta, true)
+	if len(vk.CommitmentKeys) > 0 {
+		g2("PEDERSEN_G", vk.CommitmentKeys[0].G, false)
+		g2("PEDERSEN_GSIGMANEG", vk.CommitmentKeys[0].GSigmaNeg, false)
+	}
+	g1("CONSTANT", vk.G1.K[0])
+	for i, k := range vk.G1.K[1:] {
+		g1(fmt.Sprintf("PUB_%d", i), k)
+	}
+	return out, nil
+}
+
+func fpString(x fp.Element) string {
+	var b big.Int
+	return x.BigInt(&b).String()
+}
+
+// blankConstants is src with the values of its vk constants removed.
+func blankConstants(src []byte) []byte {
+	return solConstant.ReplaceAllFunc(src, func(m []byte) []byte {
+		sub := solConstant.FindSubmatch(m)
+		if !vkConstant.Match(sub[1]) {
+			return m
+		}
+		return fmt.Appendf(nil, "uint256 constant %s = ;", sub[1])
+	})
+}
+
+func fingerprint(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func lineAt(lines []string, i int) string {
+	if i >= len(lines) {
+		return "(end of file)"
+	}
+	return strings.TrimSpace(lines[i])
+}
@@ -0,0 +1,93 @@
+package verifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"gnarking/errs"
+)
+
+func TestCheckSolidity(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vks [2]*groth16_bn254.VerifyingKey
+	for i := range vks {
+		_, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vks[i] = vk.(*groth16_bn254.VerifyingKey)
+	}
+	var buf bytes.Buffer
+	if err := vks[0].ExportSolidity(&buf); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	constant := func(name string) *regexp.Regexp {
+		return regexp.MustCompile(fmt.Sprintf(`(uint256 constant %s = )([0-9]+);`, name))
+	}
+	check := func(name, src string, vk *groth16_bn254.VerifyingKey) *SolidityCheck {
+		t.Helper()
+		c, err := CheckSolidity([]byte(src), vk)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return c
+	}
+
+	c := check("export", src, vks[0])
+	// alpha 2, beta, gamma and delta 4 each, constant and 2 inputs 2 each
+	if c.Constants != 20 || len(c.Mismatches) != 0 || !c.CodeMatches() || c.Err(true) != nil {
+		t.Fatalf("the export itself: %+v", c)
+	}
+
+	// another setup's export: every constant differs, the code does not
+	c = check("stale", src, vks[1])
+	if len(c.Mismatches) != 20 || !c.CodeMatches() || !errors.Is(c.Err(false), errs.ErrArtifactMismatch) {
+		t.Errorf("another vk: %d mismatches, code %v", len(c.Mismatches), c.CodeMatches())
+	}
+
+	// one edited constant, and the same value in hex
+	m := constant("DELTA_NEG_X_0").FindStringSubmatch(src)
+	x, _ := new(big.Int).SetString(m[2], 10)
+	edited := strings.Replace(src, m[0], m[1]+new(big.Int).Add(x, big.NewInt(1)).String()+";", 1)
+	c = check("edited", edited, vks[0])
+	if len(c.Mismatches) != 1 || c.Mismatches[0].Name != "DELTA_NEG_X_0" || c.Mismatches[0].Want != m[2] || !c.CodeMatches() {
+		t.Errorf("edited constant: %+v", c.Mismatches)
+	}
+	c = check("hex", strings.Replace(src, m[0], fmt.Sprintf("%s0x%x;", m[1], x), 1), vks[0])
+	if len(c.Mismatches) != 0 || !c.CodeMatches() {
+		t.Errorf("hex constant: %+v", c)
+	}
+
+	// a missing input point and one the vk does not have
+	pub1 := constant("PUB_1_X").FindString(src)
+	c = check("missing", strings.Replace(src, pub1, "uint256 constant PUB_2_X = 1;", 1), vks[0])
+	if len(c.Mismatches) != 2 || c.Mismatches[0].Name != "PUB_1_X" || c.Mismatches[0].Got != "" || c.Mismatches[1].Name != "PUB_2_X" || c.Mismatches[1].Want != "" {
+		t.Errorf("missing and extra inputs: %+v", c.Mismatches)
+	}
+
+	// an edit to the code, constants untouched
+	code := strings.Replace(src, "PRECOMPILE_VERIFY = 0x08", "PRECOMPILE_VERIFY = 0x09", 1)
+	c = check("code", code, vks[0])
+	if len(c.Mismatches) != 0 || c.CodeMatches() || !strings.Contains(c.Line, "0x09") || c.Err(false) != nil || !errors.Is(c.Err(true), errs.ErrArtifactMismatch) {
+		t.Errorf("code edit: %+v", c)
+	}
+
+	if _, err := CheckSolidity([]byte("contract Nothing {}"), vks[0]); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("not a verifier: %v", err)
+	}
+}
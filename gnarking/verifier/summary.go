@@ -0,0 +1,122 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"golang.org/x/crypto/sha3"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// Summary is the compact record of a proof for light consumers: enough to
+// track what was proven under which setup, and to fetch and check the full
+// artifacts later. All four are hex, without 0x.
+type Summary struct {
+	// VKHash is the sha256 of the verifying key's serialization, as VKHash
+	VKHash string `json:"vk_hash"`
+	// PublicDigest is the keccak256 of the public inputs as the verifier
+	// takes them, 32-byte words in input order: what a contract computes as
+	// keccak256(abi.encodePacked(input)).
+	PublicDigest string `json:"public_digest"`
+	// ProofHash is the keccak256 of the proof's 8 words as calldata carries
+	// them, so framed, legacy and JSON copies of a proof share it.
+	ProofHash string `json:"proof_hash"`
+	BatchID   string `json:"batch_id"` // circuit.BatchID
+}
+
+var _ io.WriterTo = (*Summary)(nil)
+
+// NewSummary summarizes proof of pub under vk. It does not verify the
+// proof.
+func NewSummary(vk io.WriterTo, proof *groth16_bn254.Proof, pub circuit.SettlementCircuitPublic) (Summary, error) {
+	vkHash, err := VKHash(vk)
+	if err != nil {
+		return Summary{}, fmt.Errorf("vk hash: %w", err)
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return Summary{}, fmt.Errorf("%w: batch ID: %w", errs.ErrInvalidInput, err)
+	}
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		return Summary{}, err
+	}
+	vec, ok := wit.Vector().(fr.Vector)
+	if !ok {
+		return Summary{}, fmt.Errorf("unexpected witness vector type %T", wit.Vector())
+	}
+	digest := sha3.NewLegacyKeccak256()
+	for i := range vec {
+		b := vec[i].Bytes() // big-endian, as the uint256 word
+		digest.Write(b[:])
+	}
+	return Summary{
+		VKHash:       hex.EncodeToString(vkHash[:]),
+		PublicDigest: hex.EncodeToString(digest.Sum(nil)),
+		ProofHash:    hex.EncodeToString(keccak256(proof.MarshalSolidity())),
+		BatchID:      hex.EncodeToString(id[:]),
+	}, nil
+}
+
+func keccak256(b []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// CheckSummary fails with ErrArtifactMismatch, naming the fields that
+// differ, unless s summarizes proof of pub under vk. Hex compares without
+// regard to case or a 0x prefix. Like NewSummary it does not verify the
+// proof: a summary that matches is of these artifacts, valid or not.
+func CheckSummary(s Summary, vk io.WriterTo, proof *groth16_bn254.Proof, pub circuit.SettlementCircuitPublic) error {
+	want, err := NewSummary(vk, proof, pub)
+	if err != nil {
+		return err
+	}
+	var diff []string
+	for _, f := range []struct {
+		name      string
+		got, want string
+	}{
+		{"vk_hash", s.VKHash, want.VKHash},
+		{"public_digest", s.PublicDigest, want.PublicDigest},
+		{"proof_hash", s.ProofHash, want.ProofHash},
+		{"batch_id", s.BatchID, want.BatchID},
+	} {
+		if !strings.EqualFold(strings.TrimPrefix(f.got, "0x"), f.want) {
+			diff = append(diff, f.name)
+		}
+	}
+	if len(diff) > 0 {
+		return fmt.Errorf("%w: summary is not of these artifacts: %s differ", errs.ErrArtifactMismatch, strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+func (s *Summary) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(append(b, '\n')).WriteTo(w)
+}
+
+// ReadFrom reads a summary as WriteTo writes it.
+func (s *Summary) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(b)), err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return int64(len(b)), fmt.Errorf("%w: summary: %w", errs.ErrInvalidInput, err)
+	}
+	return int64(len(b)), nil
+}
@@ -0,0 +1,99 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+
+	"gnarking/artifacts"
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+func TestSummary(t *testing.T) {
+	var vk groth16_bn254.VerifyingKey
+	var proof groth16_bn254.Proof
+	var pub circuit.SettlementCircuitPublic
+	readTestdata(t, "vk_8.groth16", &vk)
+	readTestdata(t, "proof_8.groth16", &artifacts.Proof{Proof: &proof})
+	readTestdata(t, "public_8.json", &pub)
+
+	s, err := NewSummary(&vk, &proof, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the digests are what a contract computes from the calldata's words
+	wit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := artifacts.NewPublicInputsHexFromWitness(wit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := artifacts.NewProofWrap(&proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := func(hexWords []string) []byte {
+		var b []byte
+		for _, w := range hexWords {
+			d, err := hex.DecodeString(strings.TrimPrefix(w, "0x"))
+			if err != nil || len(d) != 32 {
+				t.Fatalf("word %q: %v", w, err)
+			}
+			b = append(b, d...)
+		}
+		return b
+	}
+	if want := hex.EncodeToString(keccak256(packed(inputs))); s.PublicDigest != want {
+		t.Errorf("public digest %s, want %s", s.PublicDigest, want)
+	}
+	if want := hex.EncodeToString(keccak256(packed(words[:]))); s.ProofHash != want {
+		t.Errorf("proof hash %s, want %s", s.ProofHash, want)
+	}
+	if id, _ := circuit.BatchID(pub); s.BatchID != hex.EncodeToString(id[:]) {
+		t.Errorf("batch ID %s", s.BatchID)
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var back Summary
+	if _, err := back.ReadFrom(&buf); err != nil || back != s {
+		t.Fatalf("round trip %+v: %v", back, err)
+	}
+	upper := s
+	upper.VKHash = "0x" + strings.ToUpper(s.VKHash)
+	if err := CheckSummary(upper, &vk, &proof, pub); err != nil {
+		t.Fatalf("matching summary: %v", err)
+	}
+
+	other := pub
+	other.ChainID = big.NewInt(999)
+	stale := s
+	stale.ProofHash = strings.Repeat("00", 32)
+	for name, tc := range map[string]struct {
+		s    Summary
+		pub  circuit.SettlementCircuitPublic
+		want string
+	}{
+		"other inputs": {s, other, "public_digest, batch_id differ"},
+		"other proof":  {stale, pub, "proof_hash differ"},
+	} {
+		err := CheckSummary(tc.s, &vk, &proof, tc.pub)
+		if !errors.Is(err, errs.ErrArtifactMismatch) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want ErrArtifactMismatch naming %s", name, err, tc.want)
+		}
+	}
+	if _, err := back.ReadFrom(strings.NewReader("{")); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("torn summary: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package verifier checks settlement proofs against a verifying key.
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+
+	"gnarking/artifacts"
+	"gnarking/chaos"
+	"gnarking/circuit"
+	"gnarking/crash"
+	"gnarking/errs"
+	"gnarking/tracing"
+)
+
+// CheckBatchID fails when a framed proof was made for other public inputs
+// than pub. Legacy proofs (hdr == nil) carry no batch ID and pass.
+func CheckBatchID(hdr *artifacts.ProofHeader, pub circuit.SettlementCircuitPublic) error {
+	if hdr == nil {
+		return nil
+	}
+	id, err := circuit.BatchID(pub)
+	if err != nil {
+		return fmt.Errorf("%w: batch ID: %w", errs.ErrInvalidInput, err)
+	}
+	if id != hdr.BatchID {
+		return fmt.Errorf("%w: proof is for batch %x, public inputs are batch %x", errs.ErrArtifactMismatch, hdr.BatchID[:8], id[:8])
+	}
+	return nil
+}
+
+// CheckFeatures fails when a framed proof was made under a setup with other
+// circuit.Features than want, the setup's verifying it. Legacy proofs and
+// headers before version 3 record none and pass.
+func CheckFeatures(hdr *artifacts.ProofHeader, want circuit.Features) error {
+	if hdr == nil || !hdr.HasFeatures() {
+		return nil
+	}
+	return circuit.Features(hdr.Features).Check("proof", want)
+}
+
+// CheckManifest fails when the setup m records compiled another feature set
+// or public-input count than profile, e.g. a variant circuit's keys loaded
+// under a plain settlement profile. Manifests that predate features or the
+// count pass that check.
+func CheckManifest(m *artifacts.Manifest, profile circuit.Profile) error {
+	if m.PublicInputs != 0 {
+		l, err := circuit.PublicLayout(profile)
+		if err != nil {
+			return err
+		}
+		if len(l) != m.PublicInputs {
+			return fmt.Errorf("%w: profile %s has %d public inputs, setup has %d", errs.ErrArtifactMismatch, profile.Name, len(l), m.PublicInputs)
+		}
+	}
+	if m.Features == "" {
+		return nil
+	}
+	f, err := circuit.ParseFeatures(m.Features)
+	if err != nil {
+		return fmt.Errorf("%w: manifest features: %w", errs.ErrArtifactMismatch, err)
+	}
+	if err := profile.Features().Check("profile "+profile.Name, f); err != nil {
+		return err
+	}
+	// a 2-of-2 setup's keys hold its co-signer's key
+	if co := profile.Cosigner(); co != m.Cosigner {
+		return fmt.Errorf("%w: profile %s has co-signer %q, setup has %q", errs.ErrArtifactMismatch, profile.Name, co, m.Cosigner)
+	}
+	return nil
+}
+
+// CheckLayout fails closed when vk takes another number of public inputs than
+// the settlement layout plus extra variant inputs (len(pub.Extra)) has,
+// naming the fields the layout expects, rather than leaving gnark to fail
+// on the witness length.
+func CheckLayout(vk interface{ NbPublicWitness() int }, extra int) error {
+	if n, want := vk.NbPublicWitness(), len(circuit.PublicFields)+extra; n != want {
+		return fmt.Errorf("%w: verifying key takes %d public inputs, settlement layout has %d: [%s]",
+			errs.ErrArtifactMismatch, n, want, strings.Join(layoutNames(extra), " "))
+	}
+	return nil
+}
+
+// layoutNames are the PublicFields, then extra[i] for each variant input.
+func layoutNames(extra int) []string {
+	names := slices.Clone(circuit.PublicFields)
+	for i := range extra {
+		names = append(names, fmt.Sprintf("extra[%d]", i))
+	}
+	return names
+}
+
+// Verify checks a settlement proof for the given public inputs.
+func Verify(vk groth16.VerifyingKey, proof groth16.Proof, pub circuit.SettlementCircuitPublic) error {
+	return VerifyContext(context.Background(), vk, proof, pub)
+}
+
+// VerifyContext is Verify in a "verify" span under ctx's, the pairing check
+// a span of its own. A panic in gnark on a malformed key or proof is
+// returned as a *crash.Error.
+func VerifyContext(ctx context.Context, vk groth16.VerifyingKey, proof groth16.Proof, pub circuit.SettlementCircuitPublic) (err error) {
+	ctx, span := tracing.Start(ctx, "verify")
+	defer func() { tracing.End(span, err) }()
+	defer crash.Guard("verify", func() crash.Report { return crashReport(vk, pub, proof) }, &err)
+
+	if err := CheckLayout(vk, len(pub.Extra)); err != nil {
+		return err
+	}
+	pubWit, err := circuit.PublicWitness(pub)
+	if err != nil {
+		return fmt.Errorf("%w: public inputs: %w", errs.ErrInvalidInput, err)
+	}
+	if id, err := circuit.BatchID(pub); err == nil {
+		span.SetAttributes(tracing.BatchID(id))
+	}
+	chaos.FlipPublic(pubWit.Vector().(fr.Vector))
+
+	_, pairing := tracing.Start(ctx, "pairing check")
+	err = groth16.Verify(proof, vk, pubWit)
+	tracing.End(pairing, err)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrVerificationFailed, err)
+	}
+	return nil
+}
+
+// crashReport is what the bundle of a crashed verification records: the
+// public inputs and the hashes of the key and proofs.
+func crashReport(vk io.WriterTo, pub circuit.SettlementCircuitPublic, proofs ...io.WriterTo) crash.Report {
+	r := crash.Report{Artifacts: []crash.Artifact{{Name: "vk", A: vk}}}
+	if wit, err := circuit.PublicWitness(pub); err == nil {
+		r.Batch = crash.Summarize(wit)
+	}
+	for i, p := range proofs {
+		r.Artifacts = append(r.Artifacts, crash.Artifact{Name: fmt.Sprintf("proof %d", i), A: p})
+	}
+	return r
+}
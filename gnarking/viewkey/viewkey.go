@@ -0,0 +1,117 @@
+// Package viewkey seals the opening (Recipient, Blinding) of a private-recipient
+// batch's RecipientCommitment under a symmetric viewing key, so whoever holds
+// the key (e.g. compliance) can reveal the recipient without the prover.
+//
+// A sealed note is nonce || AES-256-GCM(opening), with the commitment as
+// additional data: a note only opens against the commitment it was made for.
+package viewkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"gnarking/circuit"
+	"gnarking/errs"
+)
+
+// Key is a viewing key.
+type Key [32]byte
+
+func NewKey() (Key, error) {
+	var k Key
+	_, err := rand.Read(k[:])
+	return k, err
+}
+
+func (k Key) String() string { return hex.EncodeToString(k[:]) }
+
+func ParseKey(s string) (Key, error) {
+	var k Key
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != len(k) {
+		return k, fmt.Errorf("%w: viewing key must be %d hex bytes", errs.ErrInvalidInput, len(k))
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// NewBlinding returns a uniformly random BN254 scalar.
+func NewBlinding() (*big.Int, error) {
+	return rand.Int(rand.Reader, ecc.BN254.ScalarField())
+}
+
+// Opening opens a RecipientCommitment.
+type Opening struct {
+	Recipient *big.Int `json:"recipient"`
+	Blinding  *big.Int `json:"blinding"`
+}
+
+// Commitment is circuit.RecipientCommitment of the opening.
+func (o Opening) Commitment() *big.Int {
+	return circuit.RecipientCommitment(o.Recipient, o.Blinding)
+}
+
+// Seal encrypts o under k, bound to o's commitment.
+func Seal(k Key, o Opening) ([]byte, error) {
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, commitmentAD(o.Commitment())), nil
+}
+
+// Open decrypts a note and checks it opens commitment.
+func Open(k Key, sealed []byte, commitment *big.Int) (Opening, error) {
+	var o Opening
+	aead, err := newAEAD(k)
+	if err != nil {
+		return o, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return o, fmt.Errorf("%w: sealed note too short", errs.ErrInvalidInput)
+	}
+	if commitment == nil || commitment.Sign() < 0 || commitment.Cmp(ecc.BN254.ScalarField()) >= 0 {
+		return o, fmt.Errorf("%w: commitment is not a BN254 field element", errs.ErrInvalidInput)
+	}
+	nonce, ct := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ct, commitmentAD(commitment))
+	if err != nil {
+		return o, fmt.Errorf("%w: note does not open with this key and commitment", errs.ErrArtifactMismatch)
+	}
+	if err := json.Unmarshal(plain, &o); err != nil {
+		return o, fmt.Errorf("%w: note: %w", errs.ErrInvalidInput, err)
+	}
+	if o.Recipient == nil || o.Blinding == nil || o.Commitment().Cmp(commitment) != 0 {
+		return o, fmt.Errorf("%w: opening does not match the commitment", errs.ErrArtifactMismatch)
+	}
+	return o, nil
+}
+
+func newAEAD(k Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// commitmentAD is c as 32 bytes; c must be a field element.
+func commitmentAD(c *big.Int) []byte {
+	return c.FillBytes(make([]byte, 32))
+}
@@ -0,0 +1,55 @@
+package viewkey
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"gnarking/errs"
+)
+
+func TestSealOpen(t *testing.T) {
+	k, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBlinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Opening{Recipient: big.NewInt(42), Blinding: b}
+	c := o.Commitment()
+
+	note, err := Seal(k, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Open(k, note, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Recipient.Cmp(o.Recipient) != 0 || got.Blinding.Cmp(b) != 0 {
+		t.Fatalf("opened %+v, want %+v", got, o)
+	}
+
+	other, _ := NewKey()
+	if _, err := Open(other, note, c); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("wrong key: %v", err)
+	}
+	if _, err := Open(k, note, new(big.Int).Add(c, big.NewInt(1))); !errors.Is(err, errs.ErrArtifactMismatch) {
+		t.Fatalf("wrong commitment: %v", err)
+	}
+	// a -commitment past the field, even one too wide for 32 bytes, is refused
+	for _, c := range []*big.Int{ecc.BN254.ScalarField(), new(big.Int).Lsh(big.NewInt(1), 300), big.NewInt(-1)} {
+		if _, err := Open(k, note, c); !errors.Is(err, errs.ErrInvalidInput) {
+			t.Fatalf("commitment %s: %v", c, err)
+		}
+	}
+
+	parsed, err := ParseKey(k.String())
+	if err != nil || parsed != k {
+		t.Fatalf("key round trip: %v", err)
+	}
+}